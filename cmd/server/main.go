@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
@@ -31,27 +33,44 @@ func main() {
 	}
 	// Load configuration
 	cfg := config.Load()
-	services.InitJWT(cfg.JWTSecret)
+
+	// Subcommands (e.g. `server migrate up`) run and exit without starting the HTTP server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(cfg, os.Args[2:]))
+		case "reencrypt":
+			os.Exit(runReencryptCommand(cfg, os.Args[2:]))
+		case "verify-audit":
+			os.Exit(runVerifyAuditCommand(cfg, os.Args[2:]))
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+	}
+
+	if err := services.InitTokenService(cfg); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
 	services.InitGoogleCalendar(cfg)
+	services.InitMicrosoftCalendar(cfg)
+	services.InitCalendarFeeds(cfg)
 	services.LogCalendarStatus()
 	services.LogLLMStatus()
-	services.StartCalendarWorker()
-	services.InitRazorpay(cfg)
+	services.InitPaymentProviders(cfg)
+	services.InitMFA(cfg)
+	// Before anything can log a security event, so events are spooled if PostgreSQL is down
+	if err := services.InitAuditLog(cfg); err != nil {
+		log.Fatalf("Invalid audit log configuration: %v", err)
+	}
 
-	// Check encryption key (warn if not set, but don't fail)
-	if cfg.EncryptionKey == "" {
-		log.Println("⚠️  WARNING: ENCRYPTION_KEY not set. Recovery email encryption will not work.")
-		log.Println("   To generate a key, run: openssl rand -base64 32")
-		log.Println("   Set it in your environment: ENCRYPTION_KEY=<generated-key>")
+	// Check the encryption keyring (warn if not set, but don't fail)
+	if ring, err := utils.ActiveKeyring(); err != nil {
+		log.Printf("⚠️  WARNING: encryption keyring unavailable: %v", err)
+		log.Println("   Recovery email and calendar token encryption will not work.")
+		log.Println("   Set ENCRYPTION_KEY, or ENCRYPTION_KEYS=id:key,... with ENCRYPTION_ACTIVE_KEY_ID.")
+		log.Println("   Keys are base64-encoded 32 bytes. Generate with: openssl rand -base64 32")
 	} else {
-		// Validate encryption key format
-		if _, err := utils.GetEncryptionKey(); err != nil {
-			log.Printf("⚠️  WARNING: ENCRYPTION_KEY is invalid: %v", err)
-			log.Println("   Recovery email encryption will not work.")
-			log.Println("   Key must be base64-encoded 32 bytes. Generate with: openssl rand -base64 32")
-		} else {
-			log.Println("✅ Encryption key configured")
-		}
+		log.Printf("✅ Encryption keyring configured (active key %q, %d key(s))", ring.ActiveKeyID(), len(ring.KeyIDs()))
 	}
 
 	// Connect to PostgreSQL
@@ -61,6 +80,11 @@ func main() {
 	}
 	defer database.DisconnectPostgres()
 
+	// Apply pending schema migrations (advisory-locked, safe with multiple replicas)
+	if err := database.RunMigrations(context.Background()); err != nil {
+		log.Fatal("Failed to migrate PostgreSQL schema:", err)
+	}
+
 	// Connect to Redis
 	log.Printf("Connecting to Redis...")
 	if err := database.ConnectRedis(cfg.RedisURI); err != nil {
@@ -127,6 +151,44 @@ func main() {
 	services.StartViolationCleanup(1, 6) // Run every 1 hour, delete violations older than 6 hours
 	log.Println("✅ Violation cleanup service started (removes violations older than 6 hours)")
 
+	// Calendar queue: provider writes and .ics invites for booked, moved and cancelled sessions,
+	// and pulls of changes made in connected calendars. Needs Redis, so it starts after ConnectRedis
+	services.StartCalendarWorker()
+
+	// Renew Google watch channels and pull calendars that have not been read recently
+	services.StartCalendarSync()
+
+	// Keep recurring appointment series materialized for the booking horizon
+	services.StartSeriesExtender()
+
+	// Notification channels and the outbox worker that retries external deliveries
+	services.InitNotificationChannels(cfg)
+	services.StartNotificationWorker()
+
+	// Appointment reminders (Redis schedule with a Postgres fallback scan)
+	services.StartReminderScheduler()
+
+	// Expire unpaid slot holds and refund payments that arrive after them
+	services.StartSlotHoldSweeper()
+
+	// Finish refunds left pending between the gateway call and the bookkeeping
+	services.StartRefundSweeper()
+
+	// Expire lapsed session packages and forfeit their unused credits
+	services.StartPackageExpiry()
+
+	// Finish re-encryption runs interrupted by a restart
+	services.ResumeKeyRotations()
+
+	// Batched writer for the PHI access log
+	services.StartPHIAccessLogger()
+
+	// Tell patients about emergency access to their record once it ends
+	services.StartBreakGlassSweeper()
+
+	// Flush audit events spooled during outages and sign the audit chain's head periodically
+	services.StartAuditMaintenance(time.Duration(cfg.AuditCheckpointInterval) * time.Minute)
+
 	// Setup router
 	r := chi.NewRouter()
 
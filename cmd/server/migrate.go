@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+)
+
+const migrateUsage = `usage: server migrate <command> [n]
+
+commands:
+  up [n]     apply pending migrations (all, or the next n)
+  down [n]   revert the last n applied migrations (default 1)
+  status     list migrations and whether they are applied
+  redo       revert and re-apply the most recent migration`
+
+// runMigrateCommand implements `server migrate up|down|status|redo` and returns the process exit code.
+func runMigrateCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	n := 0
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			fmt.Fprintf(os.Stderr, "invalid step count %q\n", args[1])
+			return 2
+		}
+		n = v
+	}
+
+	if err := database.ConnectPostgres(cfg.PostgresURI); err != nil {
+		log.Printf("Failed to connect to PostgreSQL: %v", err)
+		return 1
+	}
+	defer database.DisconnectPostgres()
+
+	m, err := database.NewMigrator(database.PostgresDB)
+	if err != nil {
+		log.Printf("Failed to load migrations: %v", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx, n)
+		if err != nil {
+			log.Printf("migrate up failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ %d migration(s) applied", applied)
+	case "down":
+		reverted, err := m.Down(ctx, n)
+		if err != nil {
+			log.Printf("migrate down failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ %d migration(s) reverted", reverted)
+	case "redo":
+		if err := m.Redo(ctx); err != nil {
+			log.Printf("migrate redo failed: %v", err)
+			return 1
+		}
+		log.Println("✅ Latest migration redone")
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			log.Printf("migrate status failed: %v", err)
+			return 1
+		}
+		fmt.Printf("%-8s %-40s %-8s %s\n", "VERSION", "NAME", "STATE", "APPLIED AT")
+		for _, s := range statuses {
+			state := "pending"
+			appliedAt := "-"
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state = "MODIFIED"
+			}
+			if s.Missing {
+				state = "MISSING"
+			}
+			fmt.Printf("%04d     %-40s %-8s %s\n", s.Version, s.Name, state, appliedAt)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const reencryptUsage = `usage: server reencrypt <command>
+
+commands:
+  run [--dry-run]   re-encrypt every encrypted column under the active key
+                    (an interrupted run for the same key is resumed)
+  status            list recent runs and their progress
+  cancel <run-id>   stop a running job after its current batch`
+
+// runReencryptCommand implements `server reencrypt run|status|cancel` and returns the process exit code.
+func runReencryptCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, reencryptUsage)
+		return 2
+	}
+	ring, err := utils.ActiveKeyring()
+	if err != nil {
+		log.Printf("Encryption keyring unavailable: %v", err)
+		return 1
+	}
+	if err := database.ConnectPostgres(cfg.PostgresURI); err != nil {
+		log.Printf("Failed to connect to PostgreSQL: %v", err)
+		return 1
+	}
+	defer database.DisconnectPostgres()
+
+	switch args[0] {
+	case "run":
+		dryRun := len(args) > 1 && args[1] == "--dry-run"
+		id, err := services.ClaimKeyRotationRun(dryRun, nil)
+		if err != nil {
+			log.Printf("reencrypt failed: %v", err)
+			return 1
+		}
+		log.Printf("Run %s: re-encrypting under key %q (dry run: %v)", id, ring.ActiveKeyID(), dryRun)
+
+		// Interrupting leaves the run resumable; the next `reencrypt run` or server start picks it up.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		run, err := services.RunKeyRotation(ctx, id, printRotationProgress)
+		if err != nil {
+			log.Printf("reencrypt stopped: %v", err)
+			return 1
+		}
+		printRotationRun(run)
+		if run.Status != "completed" {
+			return 1
+		}
+	case "status":
+		runs, err := services.ListKeyRotationRuns(10)
+		if err != nil {
+			log.Printf("reencrypt status failed: %v", err)
+			return 1
+		}
+		fmt.Printf("active key %q, keyring: %s\n\n", ring.ActiveKeyID(), strings.Join(ring.KeyIDs(), ", "))
+		for _, run := range runs {
+			printRotationRun(run)
+			fmt.Println()
+		}
+	case "cancel":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, reencryptUsage)
+			return 2
+		}
+		id, err := uuid.Parse(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid run id %q\n", args[1])
+			return 2
+		}
+		if err := services.CancelKeyRotation(id); err != nil {
+			log.Printf("reencrypt cancel failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ Run %s cancelled", id)
+	default:
+		fmt.Fprintln(os.Stderr, reencryptUsage)
+		return 2
+	}
+	return 0
+}
+
+func printRotationProgress(run models.KeyRotationRun) {
+	for _, p := range run.Progress {
+		if !p.Done {
+			log.Printf("  %-40s %d/%d scanned, %d rotated, %d failed", p.Target, p.Scanned, p.Total, p.Rotated, p.Failed)
+			return
+		}
+	}
+}
+
+func printRotationRun(run models.KeyRotationRun) {
+	mode := ""
+	if run.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("%s  key %q  %s%s  started %s\n", run.ID, run.TargetKeyID, run.Status, mode,
+		run.StartedAt.Format("2006-01-02 15:04:05"))
+	if run.Error != "" {
+		fmt.Printf("  error: %s\n", run.Error)
+	}
+	fmt.Printf("  %-40s %8s %8s %8s %8s\n", "COLUMN", "TOTAL", "SCANNED", "ROTATED", "FAILED")
+	for _, p := range run.Progress {
+		fmt.Printf("  %-40s %8d %8d %8d %8d\n", p.Target, p.Total, p.Scanned, p.Rotated, p.Failed)
+	}
+}
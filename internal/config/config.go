@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -10,6 +11,12 @@ type Config struct {
 	PostgresURI         string
 	RedisURI            string
 	JWTSecret           string
+	JWTSigningKeys      string // kid:base64 Ed25519 seed pairs; required in production, otherwise empty derives one key from JWTSecret
+	JWTActiveKeyID      string
+	JWTIssuer           string
+	// JWTLegacyHS256Cutoff is when tokens moved to EdDSA (RFC3339). HS256 tokens issued before it
+	// verify until one access-token lifetime after it; empty rejects HS256 outright.
+	JWTLegacyHS256Cutoff string
 	EncryptionKey       string
 	Port                string
 	FrontendURL         string
@@ -24,9 +31,41 @@ type Config struct {
 	GoogleClientID     string
 	GoogleClientSecret string
 	GoogleRedirectURI  string
+	// Microsoft 365 calendar sync through Microsoft Graph; tenant "common" accepts work and
+	// personal accounts
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftRedirectURI  string
+	MicrosoftTenant       string
 	RazorpayKeyID        string
 	RazorpayKeySecret    string
 	RazorpayWebhookSecret string
+	StripeSecretKey      string
+	StripePublishableKey string
+	StripeWebhookSecret  string
+	PaymentSandbox       bool // in-process sandbox payment provider, outside production only
+	// Notification delivery channels (all optional)
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	LoopsNotificationTransactionalID string
+	SMSGatewayURL   string
+	SMSGatewayToken string
+	VAPIDPublicKey  string
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+	NotificationWebhookSecret string
+	// WebAuthn relying party for staff MFA; defaults derive from FRONTEND_URL and ALLOWED_ORIGINS
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+	// Security audit log: checkpoint signing key (base64 Ed25519 seed; required in production,
+	// elsewhere empty derives one from JWTSecret) and where events are spooled while PostgreSQL is unreachable
+	AuditSigningKey         string
+	AuditSpoolDir           string
+	AuditCheckpointInterval int // minutes
 }
 
 func Load() *Config {
@@ -76,6 +115,10 @@ func Load() *Config {
 		PostgresURI:         getEnv("POSTGRES_URI", "postgres://localhost:5432/serenify?sslmode=disable"),
 		RedisURI:            getEnv("REDIS_URI", "redis://localhost:6379/0"),
 		JWTSecret:           getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTSigningKeys:      getEnv("JWT_SIGNING_KEYS", ""),
+		JWTActiveKeyID:      getEnv("JWT_ACTIVE_KEY_ID", ""),
+		JWTIssuer:           getEnv("JWT_ISSUER", "serenify"),
+		JWTLegacyHS256Cutoff: getEnv("JWT_LEGACY_HS256_CUTOFF", ""),
 		EncryptionKey:       getEnv("ENCRYPTION_KEY", ""),
 		Host:                host,
 		Environment:         env,
@@ -90,9 +133,35 @@ func Load() *Config {
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		GoogleRedirectURI:  getEnv("GOOGLE_REDIRECT_URI", host+"/api/v1/calendar/oauth/callback"),
+		MicrosoftClientID:     getEnv("MICROSOFT_CLIENT_ID", ""),
+		MicrosoftClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
+		MicrosoftRedirectURI:  getEnv("MICROSOFT_REDIRECT_URI", host+"/api/v1/calendar/oauth/microsoft/callback"),
+		MicrosoftTenant:       getEnv("MICROSOFT_TENANT", "common"),
 		RazorpayKeyID:        getEnv("RAZORPAY_KEY_ID", ""),
 		RazorpayKeySecret:    getEnv("RAZORPAY_KEY_SECRET", ""),
 		RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
+		StripeSecretKey:      getEnv("STRIPE_SECRET_KEY", ""),
+		StripePublishableKey: getEnv("STRIPE_PUBLISHABLE_KEY", ""),
+		StripeWebhookSecret:  getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		PaymentSandbox:       strings.EqualFold(getEnv("PAYMENT_SANDBOX", "false"), "true"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
+		LoopsNotificationTransactionalID: getEnv("LOOPS_NOTIFICATION_TRANSACTIONAL_ID", ""),
+		SMSGatewayURL:   getEnv("SMS_GATEWAY_URL", ""),
+		SMSGatewayToken: getEnv("SMS_GATEWAY_TOKEN", ""),
+		VAPIDPublicKey:  getEnv("VAPID_PUBLIC_KEY", ""),
+		VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:    getEnv("VAPID_SUBJECT", "mailto:support@salvioris.com"),
+		NotificationWebhookSecret: getEnv("NOTIFICATION_WEBHOOK_SECRET", ""),
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "Serenify"),
+		WebAuthnOrigins: parseOrigins(getEnv("WEBAUTHN_ORIGINS", "")),
+		AuditSigningKey:         getEnv("AUDIT_SIGNING_KEY", ""),
+		AuditSpoolDir:           getEnv("AUDIT_SPOOL_DIR", "audit-spool"),
+		AuditCheckpointInterval: getEnvInt("AUDIT_CHECKPOINT_INTERVAL_MIN", 60),
 	}
 }
 
@@ -131,3 +200,10 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil && v > 0 {
+		return v
+	}
+	return defaultValue
+}
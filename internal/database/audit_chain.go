@@ -0,0 +1,398 @@
+package database
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// auditChainLockKey serialises appends to the audit chain across replicas.
+const auditChainLockKey = "security_audit_chain"
+
+// auditTimeLayout is how created_at enters the row hash. PostgreSQL TIMESTAMP keeps microseconds,
+// so times are truncated to that before they are written.
+const auditTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// AuditRecord is a chained security_audit_logs row.
+type AuditRecord struct {
+	ID        string
+	ChainDate string // YYYY-MM-DD (UTC) of the chain the row belongs to
+	ChainSeq  int64  // 1-based position in that day's chain
+	PrevHash  string
+	RowHash   string
+	EventType string
+	TargetID  string
+	ActorID   string
+	ActorRole string
+	Reason    string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// auditGenesisHash is the prev_hash of the first row of a day's chain.
+func auditGenesisHash(chainDate string) string {
+	sum := sha256.Sum256([]byte("serenify-audit-genesis:" + chainDate))
+	return hex.EncodeToString(sum[:])
+}
+
+// computeHash returns the row hash over the record's position, predecessor and content.
+func (rec AuditRecord) computeHash() string {
+	fields, _ := json.Marshal([]string{
+		rec.ChainDate, strconv.FormatInt(rec.ChainSeq, 10), rec.PrevHash, rec.ID,
+		rec.EventType, rec.TargetID, rec.ActorID, rec.ActorRole, rec.Reason, rec.IPAddress, rec.UserAgent,
+		rec.CreatedAt.UTC().Format(auditTimeLayout),
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteSecurityEvent appends an event to today's audit chain and reports any failure. An event whose
+// ID is already in the chain is skipped, so replaying the spool is safe. Most callers want
+// LogSecurityEvent, which spools the event instead of failing.
+func WriteSecurityEvent(ctx context.Context, event AuditEvent) error {
+	if PostgresDB == nil {
+		return errors.New("postgres connection is not active")
+	}
+	event = event.withDefaults()
+
+	tx, err := PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, auditChainLockKey); err != nil {
+		return err
+	}
+	var written bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM security_audit_logs WHERE id = $1)
+	`, event.ID).Scan(&written); err != nil {
+		return err
+	}
+	if written {
+		return nil
+	}
+
+	rec := AuditRecord{
+		ID:        event.ID,
+		ChainDate: time.Now().UTC().Format("2006-01-02"),
+		EventType: event.EventType,
+		TargetID:  event.TargetID,
+		ActorID:   event.ActorID,
+		ActorRole: event.ActorRole,
+		Reason:    event.ActionDetails,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		CreatedAt: event.OccurredAt.UTC().Truncate(time.Microsecond),
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT chain_seq, row_hash FROM security_audit_logs
+		WHERE chain_date = $1
+		ORDER BY chain_seq DESC
+		LIMIT 1
+	`, rec.ChainDate).Scan(&rec.ChainSeq, &rec.PrevHash)
+	if err == sql.ErrNoRows {
+		rec.ChainSeq, rec.PrevHash, err = 0, auditGenesisHash(rec.ChainDate), nil
+	}
+	if err != nil {
+		return err
+	}
+	rec.ChainSeq++
+	rec.RowHash = rec.computeHash()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO security_audit_logs (id, event_type, target_id, actor_id, actor_role, reason, ip_address, user_agent,
+			created_at, chain_date, chain_seq, prev_hash, row_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, rec.ID, rec.EventType, rec.TargetID, rec.ActorID, rec.ActorRole, rec.Reason, rec.IPAddress, rec.UserAgent,
+		rec.CreatedAt, rec.ChainDate, rec.ChainSeq, rec.PrevHash, rec.RowHash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ── Checkpoints ─────────────────────────────────────────────
+
+var auditSigner struct {
+	sync.RWMutex
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// InitAuditSigning sets the Ed25519 key that signs chain checkpoints. seedB64 is a base64 32-byte
+// seed; when empty a key is derived from fallbackSecret.
+func InitAuditSigning(seedB64, fallbackSecret string) error {
+	var seed []byte
+	if seedB64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(seedB64)
+		if err != nil || len(decoded) != ed25519.SeedSize {
+			return fmt.Errorf("audit signing key must be %d base64-encoded bytes", ed25519.SeedSize)
+		}
+		seed = decoded
+	} else {
+		sum := sha256.Sum256([]byte("serenify-audit-checkpoint:" + fallbackSecret))
+		seed = sum[:]
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	kidSum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+
+	auditSigner.Lock()
+	defer auditSigner.Unlock()
+	auditSigner.key = key
+	auditSigner.keyID = hex.EncodeToString(kidSum[:8])
+	return nil
+}
+
+// AuditCheckpoint is a signed statement of a day's chain head.
+type AuditCheckpoint struct {
+	ID        string
+	ChainDate string
+	ChainSeq  int64
+	RowHash   string
+	KeyID     string
+	Signature string
+	CreatedAt time.Time
+}
+
+func (c AuditCheckpoint) signedMessage() []byte {
+	return []byte(fmt.Sprintf("serenify-audit-checkpoint|%s|%d|%s", c.ChainDate, c.ChainSeq, c.RowHash))
+}
+
+// verifySignature checks the checkpoint against the configured signing key.
+func (c AuditCheckpoint) verifySignature() error {
+	auditSigner.RLock()
+	key, keyID := auditSigner.key, auditSigner.keyID
+	auditSigner.RUnlock()
+	if key == nil {
+		return errors.New("audit signing key is not configured")
+	}
+	if c.KeyID != keyID {
+		return fmt.Errorf("signed with unknown key %q", c.KeyID)
+	}
+	sig, err := base64.StdEncoding.DecodeString(c.Signature)
+	if err != nil || !ed25519.Verify(key.Public().(ed25519.PublicKey), c.signedMessage(), sig) {
+		return errors.New("signature does not verify")
+	}
+	return nil
+}
+
+// WriteAuditCheckpoints signs the current head of today's and yesterday's chains, skipping heads
+// that are already checkpointed. Yesterday is included so each day's final head gets sealed.
+func WriteAuditCheckpoints(ctx context.Context) (int, error) {
+	if PostgresDB == nil {
+		return 0, errors.New("postgres connection is not active")
+	}
+	auditSigner.RLock()
+	key, keyID := auditSigner.key, auditSigner.keyID
+	auditSigner.RUnlock()
+	if key == nil {
+		return 0, errors.New("audit signing key is not configured")
+	}
+
+	now := time.Now().UTC()
+	written := 0
+	for _, day := range []string{now.AddDate(0, 0, -1).Format("2006-01-02"), now.Format("2006-01-02")} {
+		c := AuditCheckpoint{ChainDate: day, KeyID: keyID}
+		err := PostgresDB.QueryRowContext(ctx, `
+			SELECT chain_seq, row_hash FROM security_audit_logs
+			WHERE chain_date = $1
+			ORDER BY chain_seq DESC
+			LIMIT 1
+		`, day).Scan(&c.ChainSeq, &c.RowHash)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return written, err
+		}
+		var latest sql.NullInt64
+		if err := PostgresDB.QueryRowContext(ctx, `
+			SELECT MAX(chain_seq) FROM security_audit_checkpoints WHERE chain_date = $1
+		`, day).Scan(&latest); err != nil {
+			return written, err
+		}
+		if latest.Valid && latest.Int64 >= c.ChainSeq {
+			continue
+		}
+		c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, c.signedMessage()))
+		if _, err := PostgresDB.ExecContext(ctx, `
+			INSERT INTO security_audit_checkpoints (chain_date, chain_seq, row_hash, key_id, signature)
+			VALUES ($1, $2, $3, $4, $5)
+		`, c.ChainDate, c.ChainSeq, c.RowHash, c.KeyID, c.Signature); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// ── Verification ────────────────────────────────────────────
+
+// AuditIssue is one problem found while verifying the chain.
+type AuditIssue struct {
+	ChainDate string
+	ChainSeq  int64
+	Kind      string // gap, hash_mismatch, broken_link, bad_checkpoint, truncated, missing_day, unchained
+	Detail    string
+}
+
+// AuditVerifyReport summarises a verification run.
+type AuditVerifyReport struct {
+	Days        int
+	Rows        int64
+	Checkpoints int
+	Issues      []AuditIssue
+}
+
+// OK reports whether the verified range is intact.
+func (r AuditVerifyReport) OK() bool { return len(r.Issues) == 0 }
+
+// verifyAuditDay checks one day's chain rows, in chain_seq order, against its checkpoints.
+func verifyAuditDay(day string, rows []AuditRecord, checkpoints []AuditCheckpoint) []AuditIssue {
+	var issues []AuditIssue
+	hashes := make(map[int64]string, len(rows))
+	expectSeq, prev := int64(1), auditGenesisHash(day)
+	for _, rec := range rows {
+		if rec.ChainSeq != expectSeq {
+			issues = append(issues, AuditIssue{day, rec.ChainSeq, "gap",
+				fmt.Sprintf("rows %d to %d are missing", expectSeq, rec.ChainSeq-1)})
+		} else if rec.PrevHash != prev {
+			issues = append(issues, AuditIssue{day, rec.ChainSeq, "broken_link",
+				"prev_hash does not match the preceding row"})
+		}
+		if got := rec.computeHash(); got != rec.RowHash {
+			issues = append(issues, AuditIssue{day, rec.ChainSeq, "hash_mismatch",
+				"row content does not match its hash (edited row)"})
+		}
+		hashes[rec.ChainSeq] = rec.RowHash
+		expectSeq, prev = rec.ChainSeq+1, rec.RowHash
+	}
+
+	for _, c := range checkpoints {
+		if err := c.verifySignature(); err != nil {
+			issues = append(issues, AuditIssue{day, c.ChainSeq, "bad_checkpoint", err.Error()})
+			continue
+		}
+		h, ok := hashes[c.ChainSeq]
+		switch {
+		case !ok && len(rows) == 0:
+			issues = append(issues, AuditIssue{day, c.ChainSeq, "missing_day",
+				fmt.Sprintf("checkpoint covers %d rows but the day has none", c.ChainSeq)})
+		case !ok && c.ChainSeq > rows[len(rows)-1].ChainSeq:
+			issues = append(issues, AuditIssue{day, c.ChainSeq, "truncated",
+				fmt.Sprintf("checkpoint covers %d rows but the chain ends at %d", c.ChainSeq, rows[len(rows)-1].ChainSeq)})
+		case !ok:
+			// Reported as a gap above
+		case h != c.RowHash:
+			issues = append(issues, AuditIssue{day, c.ChainSeq, "bad_checkpoint",
+				"chain head differs from the signed checkpoint (chain rewritten)"})
+		}
+	}
+	return issues
+}
+
+// VerifyAuditChain checks every chain between from and to (UTC dates, inclusive): that each day's
+// rows are contiguous, linked and unedited, and that they match the signed checkpoints.
+func VerifyAuditChain(ctx context.Context, from, to time.Time) (AuditVerifyReport, error) {
+	var report AuditVerifyReport
+	fromDay, toDay := from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02")
+
+	checkpoints := map[string][]AuditCheckpoint{}
+	crows, err := PostgresDB.QueryContext(ctx, `
+		SELECT id, chain_date::text, chain_seq, row_hash, key_id, signature, created_at
+		FROM security_audit_checkpoints
+		WHERE chain_date BETWEEN $1 AND $2
+		ORDER BY chain_date, chain_seq
+	`, fromDay, toDay)
+	if err != nil {
+		return report, err
+	}
+	for crows.Next() {
+		var c AuditCheckpoint
+		if err := crows.Scan(&c.ID, &c.ChainDate, &c.ChainSeq, &c.RowHash, &c.KeyID, &c.Signature, &c.CreatedAt); err != nil {
+			crows.Close()
+			return report, err
+		}
+		checkpoints[c.ChainDate] = append(checkpoints[c.ChainDate], c)
+		report.Checkpoints++
+	}
+	crows.Close()
+	if err := crows.Err(); err != nil {
+		return report, err
+	}
+
+	rows, err := PostgresDB.QueryContext(ctx, `
+		SELECT id::text, chain_date::text, chain_seq, prev_hash, row_hash, event_type, target_id, actor_id,
+			actor_role, reason, ip_address, user_agent, created_at
+		FROM security_audit_logs
+		WHERE chain_date BETWEEN $1 AND $2
+		ORDER BY chain_date, chain_seq
+	`, fromDay, toDay)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	var day string
+	var dayRows []AuditRecord
+	flush := func() {
+		if day == "" {
+			return
+		}
+		report.Days++
+		report.Issues = append(report.Issues, verifyAuditDay(day, dayRows, checkpoints[day])...)
+		seen[day] = true
+	}
+	for rows.Next() {
+		var rec AuditRecord
+		if err := rows.Scan(&rec.ID, &rec.ChainDate, &rec.ChainSeq, &rec.PrevHash, &rec.RowHash, &rec.EventType,
+			&rec.TargetID, &rec.ActorID, &rec.ActorRole, &rec.Reason, &rec.IPAddress, &rec.UserAgent, &rec.CreatedAt); err != nil {
+			return report, err
+		}
+		if rec.ChainDate != day {
+			flush()
+			day, dayRows = rec.ChainDate, nil
+		}
+		dayRows = append(dayRows, rec)
+		report.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	flush()
+
+	// Days whose rows are all gone but whose checkpoints remain
+	for d, cps := range checkpoints {
+		if !seen[d] {
+			report.Days++
+			report.Issues = append(report.Issues, verifyAuditDay(d, nil, cps)...)
+		}
+	}
+
+	// Rows that bypassed the chain (only possible with the check constraint dropped)
+	var unchained int64
+	if err := PostgresDB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM security_audit_logs
+		WHERE row_hash IS NULL AND created_at >= $1::date AND created_at < $2::date + 1
+			AND created_at >= COALESCE((SELECT MIN(created_at) FROM security_audit_logs WHERE row_hash IS NOT NULL), 'infinity')
+	`, fromDay, toDay).Scan(&unchained); err != nil {
+		return report, err
+	}
+	if unchained > 0 {
+		report.Issues = append(report.Issues, AuditIssue{Kind: "unchained",
+			Detail: fmt.Sprintf("%d row(s) written outside the chain", unchained)})
+	}
+	return report, nil
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testAuditChain(day string, n int) []AuditRecord {
+	rows := make([]AuditRecord, 0, n)
+	prev := auditGenesisHash(day)
+	for i := 1; i <= n; i++ {
+		rec := AuditRecord{
+			ID:        fmt.Sprintf("row-%d", i),
+			ChainDate: day,
+			ChainSeq:  int64(i),
+			PrevHash:  prev,
+			EventType: "LOGIN_SUCCESS",
+			TargetID:  "user-1",
+			ActorID:   "user-1",
+			ActorRole: "user",
+			Reason:    "signed in",
+			IPAddress: "10.0.0.1",
+			UserAgent: "test",
+			CreatedAt: time.Date(2026, 3, 1, 9, 0, i, 123456000, time.UTC),
+		}
+		rec.RowHash = rec.computeHash()
+		prev = rec.RowHash
+		rows = append(rows, rec)
+	}
+	return rows
+}
+
+func testCheckpoint(t *testing.T, rec AuditRecord) AuditCheckpoint {
+	t.Helper()
+	auditSigner.RLock()
+	key, keyID := auditSigner.key, auditSigner.keyID
+	auditSigner.RUnlock()
+	c := AuditCheckpoint{ChainDate: rec.ChainDate, ChainSeq: rec.ChainSeq, RowHash: rec.RowHash, KeyID: keyID}
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, c.signedMessage()))
+	return c
+}
+
+func issueKinds(issues []AuditIssue) []string {
+	kinds := make([]string, len(issues))
+	for i, issue := range issues {
+		kinds[i] = issue.Kind
+	}
+	return kinds
+}
+
+func TestAuditRowHashCoversContent(t *testing.T) {
+	rec := testAuditChain("2026-03-01", 1)[0]
+	if rec.computeHash() != rec.RowHash {
+		t.Fatal("hash is not deterministic")
+	}
+	edited := rec
+	edited.Reason = "nothing to see"
+	if edited.computeHash() == rec.RowHash {
+		t.Fatal("editing the reason did not change the hash")
+	}
+	moved := rec
+	moved.ChainSeq = 2
+	if moved.computeHash() == rec.RowHash {
+		t.Fatal("moving the row did not change the hash")
+	}
+	if auditGenesisHash("2026-03-01") == auditGenesisHash("2026-03-02") {
+		t.Fatal("days share a genesis hash")
+	}
+}
+
+func TestVerifyAuditDay(t *testing.T) {
+	if err := InitAuditSigning("", "test-secret"); err != nil {
+		t.Fatal(err)
+	}
+	const day = "2026-03-01"
+
+	rows := testAuditChain(day, 5)
+	if issues := verifyAuditDay(day, rows, []AuditCheckpoint{testCheckpoint(t, rows[4])}); len(issues) != 0 {
+		t.Fatalf("intact chain reported %v", issues)
+	}
+
+	edited := testAuditChain(day, 5)
+	edited[2].ActorID = "someone-else"
+	if got := issueKinds(verifyAuditDay(day, edited, nil)); len(got) != 1 || got[0] != "hash_mismatch" {
+		t.Fatalf("edited row: got %v", got)
+	}
+
+	// A row rewritten with a fresh hash still breaks the link to the next row
+	rehashed := testAuditChain(day, 5)
+	rehashed[2].ActorID = "someone-else"
+	rehashed[2].RowHash = rehashed[2].computeHash()
+	if got := issueKinds(verifyAuditDay(day, rehashed, nil)); len(got) != 1 || got[0] != "broken_link" {
+		t.Fatalf("rehashed row: got %v", got)
+	}
+
+	full := testAuditChain(day, 5)
+	gapped := append(append([]AuditRecord{}, full[:2]...), full[3:]...)
+	if got := issueKinds(verifyAuditDay(day, gapped, nil)); len(got) != 1 || got[0] != "gap" {
+		t.Fatalf("deleted row: got %v", got)
+	}
+
+	head := testCheckpoint(t, full[4])
+	if got := issueKinds(verifyAuditDay(day, full[:3], []AuditCheckpoint{head})); len(got) != 1 || got[0] != "truncated" {
+		t.Fatalf("truncated chain: got %v", got)
+	}
+	if got := issueKinds(verifyAuditDay(day, nil, []AuditCheckpoint{head})); len(got) != 1 || got[0] != "missing_day" {
+		t.Fatalf("deleted day: got %v", got)
+	}
+
+	// Rewriting the rest of the chain to match an edit is only caught by the signed head
+	rewritten := testAuditChain(day, 5)
+	rewritten[2].ActorID = "someone-else"
+	for i := 2; i < len(rewritten); i++ {
+		rewritten[i].PrevHash = rewritten[i-1].RowHash
+		rewritten[i].RowHash = rewritten[i].computeHash()
+	}
+	if got := issueKinds(verifyAuditDay(day, rewritten, []AuditCheckpoint{head})); len(got) != 1 || got[0] != "bad_checkpoint" {
+		t.Fatalf("rewritten chain: got %v", got)
+	}
+
+	forged := head
+	forged.RowHash = full[3].RowHash
+	if got := issueKinds(verifyAuditDay(day, full, []AuditCheckpoint{forged})); len(got) != 1 || got[0] != "bad_checkpoint" {
+		t.Fatalf("forged checkpoint: got %v", got)
+	}
+
+	if err := InitAuditSigning(base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize)), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := issueKinds(verifyAuditDay(day, full, []AuditCheckpoint{head})); len(got) != 1 || got[0] != "bad_checkpoint" {
+		t.Fatalf("checkpoint from another key: got %v", got)
+	}
+}
+
+func TestInitAuditSigningRejectsBadSeed(t *testing.T) {
+	if err := InitAuditSigning("not base64!", ""); err == nil {
+		t.Fatal("expected error for invalid seed")
+	}
+	if err := InitAuditSigning(base64.StdEncoding.EncodeToString([]byte("short")), ""); err == nil {
+		t.Fatal("expected error for short seed")
+	}
+}
+
+func TestAuditSpoolKeepsEventsUntilFlushed(t *testing.T) {
+	dir := t.TempDir()
+	if err := ConfigureAuditSpool(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		auditSpool.Lock()
+		auditSpool.dir = ""
+		auditSpool.Unlock()
+	})
+
+	event := AuditEvent{EventType: "LOGIN_SUCCESS", TargetID: "user-1", ActorID: "user-1"}.withDefaults()
+	if err := spoolAuditEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if n := SpooledAuditEvents(); n != 1 {
+		t.Fatalf("spooled %d events, want 1", n)
+	}
+	// The event keeps its ID on disk so a replay after a partial flush is not written twice
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spooled AuditEvent
+	if err := json.Unmarshal(data, &spooled); err != nil || spooled.ID == "" || spooled.ID != event.ID {
+		t.Fatalf("spooled ID %q, want %q (%v)", spooled.ID, event.ID, err)
+	}
+
+	// No database: the flush fails and the event stays on disk
+	db := PostgresDB
+	PostgresDB = nil
+	defer func() { PostgresDB = db }()
+	if n, err := FlushAuditSpool(context.Background()); err == nil || n != 0 {
+		t.Fatalf("flush without database: n=%d err=%v", n, err)
+	}
+	if n := SpooledAuditEvents(); n != 1 {
+		t.Fatalf("%d events left after failed flush, want 1", n)
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"time"
 
 	"github.com/AnshRaj112/serenify-backend/pkg/clientip"
+	"github.com/google/uuid"
 )
 
 // AuditEvent represents a structured record in our append-only security logs.
 type AuditEvent struct {
+	// ID becomes the row id; it is kept in the spool so a replayed event is written only once
+	ID            string
 	EventType     string
 	TargetID      string
 	ActorID       string
@@ -18,43 +21,43 @@ type AuditEvent struct {
 	ActionDetails string
 	IPAddress     string
 	UserAgent     string
+	OccurredAt    time.Time // set when logged; kept when the event waits in the spool
 }
 
-// LogSecurityEvent writes a structured audit event to the append-only security_audit_logs PostgreSQL table.
-// If any database error occurs, it prints to standard error but does NOT panic to avoid disrupting application flow.
-func LogSecurityEvent(ctx context.Context, event AuditEvent) {
-	if PostgresDB == nil {
-		log.Println("⚠️ Audit log skipped: PostgreSQL connection is not active")
-		return
-	}
-
-	query := `
-		INSERT INTO security_audit_logs (event_type, target_id, actor_id, actor_role, reason, ip_address, user_agent, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`
-
+func (e AuditEvent) withDefaults() AuditEvent {
 	// Enforce default field values if empty
-	if event.IPAddress == "" {
-		event.IPAddress = "0.0.0.0"
+	if e.ID == "" {
+		e.ID = uuid.NewString()
 	}
-	if event.UserAgent == "" {
-		event.UserAgent = "unknown-agent"
+	if e.IPAddress == "" {
+		e.IPAddress = "0.0.0.0"
 	}
+	if e.UserAgent == "" {
+		e.UserAgent = "unknown-agent"
+	}
+	if e.ActorRole == "" {
+		e.ActorRole = "unknown"
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+	return e
+}
 
-	_, err := PostgresDB.ExecContext(ctx, query,
-		event.EventType,
-		event.TargetID,
-		event.ActorID,
-		event.ActorRole,
-		event.ActionDetails,
-		event.IPAddress,
-		event.UserAgent,
-		time.Now().UTC(),
-	)
-
-	if err != nil {
-		log.Printf("🔴 SECURITY AUDIT LOG WRITE FAILURE: %v | Event details: %+v", err, event)
+// LogSecurityEvent appends a structured audit event to the hash-chained security_audit_logs table.
+// When PostgreSQL cannot take the write, the event is spooled to disk and flushed later. It never
+// panics or returns an error, to avoid disrupting application flow.
+func LogSecurityEvent(ctx context.Context, event AuditEvent) {
+	event = event.withDefaults()
+	err := WriteSecurityEvent(ctx, event)
+	if err == nil {
+		return
+	}
+	if spoolErr := spoolAuditEvent(event); spoolErr != nil {
+		log.Printf("🔴 SECURITY AUDIT LOG WRITE FAILURE: %v (spool: %v) | Event details: %+v", err, spoolErr, event)
+		return
 	}
+	log.Printf("⚠️ Audit event %s spooled to disk: %v", event.EventType, err)
 }
 
 // TriggerAuditEvent extracts metadata from an HTTP request and logs a security event.
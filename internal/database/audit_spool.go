@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Audit events that cannot be written to PostgreSQL are kept on local disk, one JSON file per
+// event named so that lexical order is the order they were logged, and appended to the chain by
+// FlushAuditSpool once the database is back.
+var auditSpool struct {
+	sync.Mutex
+	dir string
+}
+
+// ConfigureAuditSpool sets, and creates, the directory that holds spooled audit events.
+func ConfigureAuditSpool(dir string) error {
+	if dir == "" {
+		return errors.New("audit spool directory is empty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	auditSpool.Lock()
+	defer auditSpool.Unlock()
+	auditSpool.dir = dir
+	return nil
+}
+
+func spoolAuditEvent(event AuditEvent) error {
+	auditSpool.Lock()
+	dir := auditSpool.dir
+	auditSpool.Unlock()
+	if dir == "" {
+		return errors.New("audit spool is not configured")
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%s.json", event.OccurredAt.UnixNano(), event.ID)
+	tmp := filepath.Join(dir, "."+name+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	// The event must survive a crash once we report it spooled
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, name))
+}
+
+// FlushAuditSpool appends spooled events to the chain, oldest first, and removes each one once it
+// is written. It stops at the first write failure so events keep their order.
+func FlushAuditSpool(ctx context.Context) (int, error) {
+	auditSpool.Lock()
+	defer auditSpool.Unlock()
+	if auditSpool.dir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(auditSpool.dir)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	flushed := 0
+	for _, name := range names {
+		path := filepath.Join(auditSpool.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return flushed, err
+		}
+		var event AuditEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			// Keep the bytes for an operator rather than dropping them
+			log.Printf("🔴 Unreadable spooled audit event %s: %v", name, err)
+			_ = os.Rename(path, path+".bad")
+			continue
+		}
+		if event.ID == "" {
+			// Spooled before events carried an ID; the file name holds a stable one
+			event.ID = strings.TrimSuffix(name[strings.IndexByte(name, '-')+1:], ".json")
+		}
+		if err := WriteSecurityEvent(ctx, event); err != nil {
+			return flushed, err
+		}
+		if err := os.Remove(path); err != nil {
+			return flushed, err
+		}
+		flushed++
+	}
+	return flushed, nil
+}
+
+// SpooledAuditEvents returns how many events are waiting in the spool.
+func SpooledAuditEvents() int {
+	auditSpool.Lock()
+	defer auditSpool.Unlock()
+	if auditSpool.dir == "" {
+		return 0
+	}
+	matches, _ := filepath.Glob(filepath.Join(auditSpool.dir, "*.json"))
+	return len(matches)
+}
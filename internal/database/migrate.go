@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrations run so that
+// only one replica mutates the schema at a time.
+const migrationLockID int64 = 72419830
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change loaded from internal/database/migrations.
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+}
+
+// MigrationStatus describes a migration as seen by both the embedded files and schema_migrations.
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Checksum  string     `json:"checksum"`
+	Modified  bool       `json:"modified"` // file checksum differs from the one recorded when applied
+	Missing   bool       `json:"missing"`  // recorded as applied but no longer present on disk
+}
+
+// ErrMigrationModified is returned when an applied migration file has been edited since it ran.
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+// LoadMigrations parses NNNN_name.up.sql / NNNN_name.down.sql pairs from fsys, sorted by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, p := range entries {
+		m := migrationFileRe.FindStringSubmatch(path.Base(p))
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration filename: %s", p)
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", p, err)
+		}
+		body, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.UpSQL = string(body)
+		} else {
+			mig.DownSQL = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.UpSQL == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", mig.Version, mig.Name)
+		}
+		mig.Checksum = migrationChecksum(mig.UpSQL)
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func migrationChecksum(sqlText string) string {
+	sum := sha256.Sum256([]byte(sqlText))
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrator applies and reverts migrations against a single database.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// NewMigrator returns a Migrator over the migrations embedded in the binary.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// RunMigrations applies every pending migration to PostgresDB. It is called on server boot.
+func RunMigrations(ctx context.Context) error {
+	m, err := NewMigrator(PostgresDB)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if applied == 0 {
+		log.Println("✅ PostgreSQL schema up to date")
+	} else {
+		log.Printf("✅ PostgreSQL schema migrated (%d applied)", applied)
+	}
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			execution_ms INTEGER NOT NULL DEFAULT 0,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func loadApplied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]appliedMigration{}
+	for rows.Next() {
+		var v int64
+		var a appliedMigration
+		if err := rows.Scan(&v, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		out[v] = a
+	}
+	return out, rows.Err()
+}
+
+func (m *Migrator) verifyChecksums(applied map[int64]appliedMigration) error {
+	for _, mig := range m.Migrations {
+		if a, ok := applied[mig.Version]; ok && a.Checksum != mig.Checksum {
+			return fmt.Errorf("%w: %04d_%s", ErrMigrationModified, mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies up to n pending migrations (all of them when n <= 0) and returns how many ran.
+func (m *Migrator) Up(ctx context.Context, n int) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(applied); err != nil {
+			return err
+		}
+		for _, mig := range m.Migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if n > 0 && count >= n {
+				break
+			}
+			if err := applyMigration(ctx, conn, mig); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverts the n most recently applied migrations (one when n <= 0) and returns how many ran.
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	if n <= 0 {
+		n = 1
+	}
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(applied); err != nil {
+			return err
+		}
+		for i := len(m.Migrations) - 1; i >= 0 && count < n; i-- {
+			mig := m.Migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := revertMigration(ctx, conn, mig); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Redo reverts and re-applies the most recently applied migration.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(applied); err != nil {
+			return err
+		}
+		for i := len(m.Migrations) - 1; i >= 0; i-- {
+			mig := m.Migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := revertMigration(ctx, conn, mig); err != nil {
+				return err
+			}
+			return applyMigration(ctx, conn, mig)
+		}
+		return errors.New("no applied migrations to redo")
+	})
+}
+
+// Status reports every known migration, including rows in schema_migrations with no matching file.
+// It only reads, so it does not wait for the migration lock and does not create the table; a run
+// in progress may show as partly applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[int64]appliedMigration{}
+	if exists {
+		if applied, err = loadApplied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []MigrationStatus
+	known := map[int64]bool{}
+	for _, mig := range m.Migrations {
+		known[mig.Version] = true
+		st := MigrationStatus{Version: mig.Version, Name: mig.Name, Checksum: mig.Checksum}
+		if a, ok := applied[mig.Version]; ok {
+			t := a.AppliedAt
+			st.Applied = true
+			st.AppliedAt = &t
+			st.Modified = a.Checksum != mig.Checksum
+		}
+		out = append(out, st)
+	}
+	for v, a := range applied {
+		if known[v] {
+			continue
+		}
+		t := a.AppliedAt
+		out = append(out, MigrationStatus{
+			Version: v, Name: a.Name, Applied: true, AppliedAt: &t, Checksum: a.Checksum, Missing: true,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.UpSQL); err != nil {
+		return fmt.Errorf("migration %04d_%s up: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (version, name, checksum, execution_ms)
+		VALUES ($1, $2, $3, $4)
+	`, mig.Version, mig.Name, mig.Checksum, time.Since(start).Milliseconds()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("  ↑ applied %04d_%s (%s)", mig.Version, mig.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func revertMigration(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if mig.DownSQL == "" {
+		return fmt.Errorf("migration %04d_%s is irreversible (no down file)", mig.Version, mig.Name)
+	}
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mig.DownSQL); err != nil {
+		return fmt.Errorf("migration %04d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("  ↓ reverted %04d_%s (%s)", mig.Version, mig.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrationsOrdersAndPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_x.up.sql":      {Data: []byte("ALTER TABLE t ADD COLUMN x INT;")},
+		"migrations/0002_add_x.down.sql":    {Data: []byte("ALTER TABLE t DROP COLUMN x;")},
+		"migrations/0001_baseline.up.sql":   {Data: []byte("CREATE TABLE t (id INT);")},
+		"migrations/0001_baseline.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+	migs, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 || migs[0].Version != 1 || migs[1].Version != 2 {
+		t.Fatalf("unexpected order: %+v", migs)
+	}
+	if migs[1].Name != "add_x" || migs[1].DownSQL == "" {
+		t.Fatalf("down not paired: %+v", migs[1])
+	}
+	if migs[0].Checksum != migrationChecksum("CREATE TABLE t (id INT);") {
+		t.Fatal("checksum mismatch")
+	}
+}
+
+func TestLoadMigrationsRejectsBadInput(t *testing.T) {
+	bad := []fstest.MapFS{
+		{"migrations/init.up.sql": {Data: []byte("SELECT 1;")}},
+		{"migrations/0003_only_down.down.sql": {Data: []byte("SELECT 1;")}},
+	}
+	for _, fsys := range bad {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Fatalf("expected error for %v", fsys)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migs, err := LoadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) == 0 || migs[0].Version != 1 {
+		t.Fatalf("baseline migration missing: %+v", migs)
+	}
+}
@@ -0,0 +1,46 @@
+-- Reverts 0001_baseline. This drops every application table and is only
+-- meant for disposable development databases.
+
+DROP TRIGGER IF EXISTS restrict_audit_mutations ON security_audit_logs;
+DROP FUNCTION IF EXISTS block_modifications();
+
+DROP TABLE IF EXISTS receptionists CASCADE;
+DROP TABLE IF EXISTS calendar_event_mappings CASCADE;
+DROP TABLE IF EXISTS payments CASCADE;
+DROP TABLE IF EXISTS invoices CASCADE;
+DROP TABLE IF EXISTS billing_profiles CASCADE;
+DROP TABLE IF EXISTS tasks CASCADE;
+DROP TABLE IF EXISTS prescriptions CASCADE;
+DROP TABLE IF EXISTS calendar_integrations CASCADE;
+DROP TABLE IF EXISTS availability_slots CASCADE;
+DROP TABLE IF EXISTS appointments CASCADE;
+DROP TABLE IF EXISTS patients CASCADE;
+DROP TABLE IF EXISTS refresh_tokens CASCADE;
+DROP TABLE IF EXISTS tenants CASCADE;
+DROP TABLE IF EXISTS patient_onboardings CASCADE;
+DROP TABLE IF EXISTS notifications CASCADE;
+DROP TABLE IF EXISTS consent_history CASCADE;
+DROP TABLE IF EXISTS connection_requests CASCADE;
+DROP TABLE IF EXISTS therapist_user_connections CASCADE;
+DROP TABLE IF EXISTS referral_usages CASCADE;
+DROP TABLE IF EXISTS referral_codes CASCADE;
+DROP TABLE IF EXISTS security_audit_logs CASCADE;
+DROP TABLE IF EXISTS group_blocks CASCADE;
+DROP TABLE IF EXISTS abuse_reports CASCADE;
+DROP TABLE IF EXISTS activity_events CASCADE;
+DROP TABLE IF EXISTS group_messages CASCADE;
+DROP TABLE IF EXISTS group_members CASCADE;
+DROP TABLE IF EXISTS groups CASCADE;
+DROP TABLE IF EXISTS staff_sessions CASCADE;
+DROP TABLE IF EXISTS admins CASCADE;
+DROP TABLE IF EXISTS therapist_waitlist CASCADE;
+DROP TABLE IF EXISTS user_waitlist CASCADE;
+DROP TABLE IF EXISTS contact_us CASCADE;
+DROP TABLE IF EXISTS feedbacks CASCADE;
+DROP TABLE IF EXISTS password_reset_tokens CASCADE;
+DROP TABLE IF EXISTS blocked_ips CASCADE;
+DROP TABLE IF EXISTS violations CASCADE;
+DROP TABLE IF EXISTS therapists CASCADE;
+DROP TABLE IF EXISTS user_devices CASCADE;
+DROP TABLE IF EXISTS user_recovery CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_appointments_series_occurrence;
+ALTER TABLE appointments DROP COLUMN IF EXISTS is_exception;
+ALTER TABLE appointments DROP COLUMN IF EXISTS recurrence_id;
+ALTER TABLE appointments DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS appointment_series;
@@ -0,0 +1,28 @@
+-- Recurring appointment series. Occurrences are materialized into appointments
+-- and linked back through series_id / recurrence_id.
+CREATE TABLE IF NOT EXISTS appointment_series (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	type VARCHAR(20) NOT NULL,
+	rrule TEXT NOT NULL,
+	starts_at TIMESTAMP NOT NULL,
+	duration_min INTEGER NOT NULL DEFAULT 60,
+	timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Kolkata',
+	meeting_link TEXT,
+	location TEXT,
+	notes TEXT,
+	status VARCHAR(20) NOT NULL DEFAULT 'active',
+	materialized_until TIMESTAMP,
+	created_by UUID REFERENCES therapists(id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_appointment_series_tenant ON appointment_series(tenant_id, status);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS series_id UUID REFERENCES appointment_series(id) ON DELETE SET NULL;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS recurrence_id TIMESTAMP;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS is_exception BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_series_occurrence
+	ON appointments(series_id, recurrence_id) WHERE series_id IS NOT NULL AND status <> 'cancelled';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS appointment_reminders;
+ALTER TABLE tenants DROP COLUMN IF EXISTS reminder_offsets_min;
@@ -0,0 +1,16 @@
+-- Per-tenant reminder offsets (minutes before starts_at) and the reminder schedule.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS reminder_offsets_min INTEGER[] NOT NULL DEFAULT '{1440,60}';
+
+CREATE TABLE IF NOT EXISTS appointment_reminders (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	offset_min INTEGER NOT NULL,
+	remind_at TIMESTAMP NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	sent_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (appointment_id, offset_min)
+);
+CREATE INDEX IF NOT EXISTS idx_appointment_reminders_due ON appointment_reminders(remind_at) WHERE status = 'pending';
@@ -0,0 +1,48 @@
+-- Notification delivery pipeline: per-recipient settings, channel preferences and a durable outbox.
+CREATE TABLE IF NOT EXISTS notification_settings (
+	recipient_id UUID NOT NULL,
+	recipient_role VARCHAR(20) NOT NULL,
+	quiet_start TIME,
+	quiet_end TIME,
+	timezone VARCHAR(64),
+	email VARCHAR(255),
+	phone VARCHAR(50),
+	webhook_url TEXT,
+	push_subscription JSONB,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (recipient_id, recipient_role)
+);
+
+-- notif_type '*' applies to every notification type; a specific type overrides it.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	recipient_id UUID NOT NULL,
+	recipient_role VARCHAR(20) NOT NULL,
+	channel VARCHAR(20) NOT NULL,
+	notif_type VARCHAR(50) NOT NULL DEFAULT '*',
+	enabled BOOLEAN NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (recipient_id, recipient_role, channel, notif_type)
+);
+
+CREATE TABLE IF NOT EXISTS notification_outbox (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	recipient_id UUID NOT NULL,
+	recipient_role VARCHAR(20) NOT NULL,
+	channel VARCHAR(20) NOT NULL,
+	notif_type VARCHAR(50) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	message TEXT NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	data JSONB,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 6,
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_error TEXT,
+	sent_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_recipient ON notification_outbox(recipient_id, created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE invoices DROP COLUMN IF EXISTS place_of_supply;
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS state_code;
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS business_address;
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS sac_code;
@@ -0,0 +1,8 @@
+-- GST details printed on tax invoices.
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS sac_code VARCHAR(10) NOT NULL DEFAULT '9993';
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS business_address TEXT;
+-- Two-digit GST state code; derived from gst_number when empty.
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS state_code VARCHAR(2);
+
+-- Place of supply (GST state code). Empty means the supplier's own state (CGST + SGST).
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS place_of_supply VARCHAR(2);
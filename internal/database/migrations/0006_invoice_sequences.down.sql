@@ -0,0 +1,5 @@
+UPDATE invoices SET invoice_number = 'DRAFT-' || id::text WHERE invoice_number IS NULL;
+ALTER TABLE invoices ALTER COLUMN invoice_number SET NOT NULL;
+ALTER TABLE invoices DROP COLUMN IF EXISTS issued_at;
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS invoice_number_format;
+DROP TABLE IF EXISTS invoice_sequences;
@@ -0,0 +1,17 @@
+-- Gap-free invoice numbering: one counter per tenant and financial year (April-March),
+-- incremented in the same transaction that numbers the invoice.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	fiscal_year INTEGER NOT NULL,
+	last_value BIGINT NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (tenant_id, fiscal_year)
+);
+
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS invoice_number_format VARCHAR(100) NOT NULL DEFAULT '{prefix}/{fy}/{seq:05}';
+
+-- Drafts carry no number until they are issued.
+ALTER TABLE invoices ALTER COLUMN invoice_number DROP NOT NULL;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS issued_at TIMESTAMP;
+UPDATE invoices SET issued_at = created_at WHERE issued_at IS NULL AND status <> 'draft';
+UPDATE invoices SET invoice_number = NULL WHERE status = 'draft';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS credit_notes;
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS credit_note_prefix;
+DELETE FROM invoice_sequences WHERE series <> 'invoice';
+ALTER TABLE invoice_sequences DROP CONSTRAINT IF EXISTS invoice_sequences_pkey;
+ALTER TABLE invoice_sequences ADD PRIMARY KEY (tenant_id, fiscal_year);
+ALTER TABLE invoice_sequences DROP COLUMN IF EXISTS series;
+ALTER TABLE invoices DROP COLUMN IF EXISTS amount_refunded;
+ALTER TABLE invoices DROP COLUMN IF EXISTS amount_paid;
@@ -0,0 +1,45 @@
+-- Partial payments and refunds: invoices track what was collected and refunded.
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_paid DECIMAL(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_refunded DECIMAL(12,2) NOT NULL DEFAULT 0;
+UPDATE invoices i SET amount_paid = COALESCE((
+	SELECT SUM(p.amount) FROM payments p WHERE p.invoice_id = i.id AND p.status = 'succeeded'
+), 0);
+UPDATE invoices SET amount_paid = total WHERE status = 'paid' AND amount_paid < total;
+
+-- Credit notes are numbered from their own series next to invoices.
+ALTER TABLE invoice_sequences ADD COLUMN IF NOT EXISTS series VARCHAR(20) NOT NULL DEFAULT 'invoice';
+ALTER TABLE invoice_sequences DROP CONSTRAINT IF EXISTS invoice_sequences_pkey;
+ALTER TABLE invoice_sequences ADD PRIMARY KEY (tenant_id, series, fiscal_year);
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS credit_note_prefix VARCHAR(20) NOT NULL DEFAULT 'CN';
+
+CREATE TABLE IF NOT EXISTS credit_notes (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+	credit_note_number VARCHAR(50) NOT NULL,
+	subtotal DECIMAL(12,2) NOT NULL,
+	gst_amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+	total DECIMAL(12,2) NOT NULL,
+	currency VARCHAR(10) NOT NULL DEFAULT 'INR',
+	reason TEXT,
+	created_by UUID,
+	issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (tenant_id, credit_note_number)
+);
+CREATE INDEX IF NOT EXISTS idx_credit_notes_invoice ON credit_notes(tenant_id, invoice_id);
+
+CREATE TABLE IF NOT EXISTS refunds (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+	payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+	credit_note_id UUID REFERENCES credit_notes(id) ON DELETE SET NULL,
+	provider VARCHAR(20) NOT NULL,
+	external_id TEXT,
+	amount DECIMAL(12,2) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'processed',
+	reason TEXT,
+	created_by UUID,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_invoice ON refunds(tenant_id, invoice_id);
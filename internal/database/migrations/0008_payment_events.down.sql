@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payment_events;
+DROP INDEX IF EXISTS idx_payments_order;
+ALTER TABLE payments DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS order_id;
@@ -0,0 +1,25 @@
+-- Payments keep the provider order they belong to; external_id becomes the captured payment ID.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS order_id TEXT;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+UPDATE payments SET order_id = external_id WHERE order_id IS NULL AND external_id LIKE 'order\_%';
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(provider, order_id);
+
+-- Ledger of provider webhook events. The provider's event ID makes redelivery a no-op.
+CREATE TABLE IF NOT EXISTS payment_events (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	provider VARCHAR(20) NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type VARCHAR(60) NOT NULL,
+	order_id TEXT,
+	payment_id TEXT,
+	payload JSONB NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'received', -- received, processed, ignored, failed
+	detail TEXT,
+	attempts INT NOT NULL DEFAULT 0,
+	occurred_at TIMESTAMP,
+	received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	processed_at TIMESTAMP,
+	UNIQUE (provider, event_id)
+);
+CREATE INDEX IF NOT EXISTS idx_payment_events_order ON payment_events(provider, order_id);
+CREATE INDEX IF NOT EXISTS idx_payment_events_status ON payment_events(status, received_at);
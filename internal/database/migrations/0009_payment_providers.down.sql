@@ -0,0 +1 @@
+ALTER TABLE billing_profiles DROP COLUMN IF EXISTS payment_provider;
@@ -0,0 +1,2 @@
+-- Each tenant picks the gateway its patients pay through.
+ALTER TABLE billing_profiles ADD COLUMN IF NOT EXISTS payment_provider VARCHAR(20) NOT NULL DEFAULT 'razorpay';
@@ -0,0 +1,4 @@
+ALTER TABLE appointments DROP COLUMN IF EXISTS patient_package_id;
+DROP TABLE IF EXISTS package_ledger;
+DROP TABLE IF EXISTS patient_packages;
+DROP TABLE IF EXISTS session_packages;
@@ -0,0 +1,76 @@
+-- Session packages: prepaid bundles of sessions that completed appointments draw down.
+CREATE TABLE IF NOT EXISTS session_packages (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	name VARCHAR(120) NOT NULL,
+	description TEXT,
+	session_count INT NOT NULL CHECK (session_count > 0),
+	price DECIMAL(12,2) NOT NULL CHECK (price > 0),
+	validity_days INT NOT NULL DEFAULT 90 CHECK (validity_days > 0),
+	appointment_type VARCHAR(20),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_session_packages_tenant ON session_packages(tenant_id, is_active);
+
+-- A package bought by a patient. Terms are copied at purchase so later edits to the package
+-- do not change what was sold; price is the invoice total and is recognized per session used.
+CREATE TABLE IF NOT EXISTS patient_packages (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	package_id UUID REFERENCES session_packages(id) ON DELETE SET NULL,
+	invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL,
+	name VARCHAR(120) NOT NULL,
+	appointment_type VARCHAR(20),
+	sessions_total INT NOT NULL CHECK (sessions_total > 0),
+	sessions_used INT NOT NULL DEFAULT 0 CHECK (sessions_used >= 0),
+	price DECIMAL(12,2) NOT NULL DEFAULT 0,
+	validity_days INT NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending_payment', -- pending_payment, active, exhausted, expired, cancelled
+	activated_at TIMESTAMP,
+	expires_at TIMESTAMP,
+	created_by UUID,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CHECK (sessions_used <= sessions_total)
+);
+CREATE INDEX IF NOT EXISTS idx_patient_packages_patient ON patient_packages(tenant_id, patient_id, status);
+CREATE INDEX IF NOT EXISTS idx_patient_packages_expiry ON patient_packages(expires_at) WHERE status = 'active';
+CREATE UNIQUE INDEX IF NOT EXISTS ux_patient_packages_invoice ON patient_packages(invoice_id) WHERE invoice_id IS NOT NULL;
+
+-- Usage ledger: credits granted on purchase, drawn by sessions and forfeited on expiry. revenue
+-- is the share of the package price recognized by the entry.
+CREATE TABLE IF NOT EXISTS package_ledger (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	patient_package_id UUID NOT NULL REFERENCES patient_packages(id) ON DELETE CASCADE,
+	patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	appointment_id UUID REFERENCES appointments(id) ON DELETE SET NULL,
+	entry VARCHAR(20) NOT NULL, -- purchase, session, expiry
+	sessions INT NOT NULL,
+	revenue DECIMAL(12,2) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_package_ledger_patient ON package_ledger(tenant_id, patient_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_package_ledger_revenue ON package_ledger(tenant_id, created_at) WHERE revenue <> 0;
+CREATE UNIQUE INDEX IF NOT EXISTS ux_package_ledger_session ON package_ledger(appointment_id) WHERE entry = 'session';
+
+-- Appointments booked against a package hold one of its credits until they are completed.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS patient_package_id UUID REFERENCES patient_packages(id) ON DELETE SET NULL;
+
+-- Carry over packages tenants had entered in billing_profiles.package_fees, where they are
+-- shaped like [{"name": ..., "sessions": 8, "price": 12000, "validity_days": 90}].
+INSERT INTO session_packages (tenant_id, name, session_count, price, validity_days)
+SELECT bp.tenant_id,
+	COALESCE(NULLIF(e->>'name', ''), (e->>'sessions') || ' sessions'),
+	(e->>'sessions')::int,
+	(e->>'price')::numeric,
+	CASE WHEN (e->>'validity_days') ~ '^[1-9][0-9]*$' THEN (e->>'validity_days')::int ELSE 90 END
+FROM billing_profiles bp,
+	jsonb_array_elements(CASE WHEN jsonb_typeof(bp.package_fees) = 'array' THEN bp.package_fees ELSE '[]'::jsonb END) e
+WHERE jsonb_typeof(e) = 'object'
+	AND (e->>'sessions') ~ '^[1-9][0-9]*$'
+	AND CASE WHEN (e->>'price') ~ '^[0-9]+(\.[0-9]+)?$' THEN (e->>'price')::numeric > 0 ELSE FALSE END
+	AND NOT EXISTS (SELECT 1 FROM session_packages sp WHERE sp.tenant_id = bp.tenant_id);
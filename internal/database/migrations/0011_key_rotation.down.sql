@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS key_rotation_progress;
+DROP TABLE IF EXISTS key_rotation_runs;
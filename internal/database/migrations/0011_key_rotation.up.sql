@@ -0,0 +1,27 @@
+-- Re-encryption runs that move encrypted columns onto the active keyring key. Progress is kept
+-- per column so an interrupted run resumes where it stopped.
+CREATE TABLE IF NOT EXISTS key_rotation_runs (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	target_key_id VARCHAR(32) NOT NULL,
+	dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+	status VARCHAR(20) NOT NULL DEFAULT 'running', -- running, completed, failed, cancelled
+	error TEXT,
+	started_by UUID,
+	started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	heartbeat_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_key_rotation_runs_status ON key_rotation_runs(status, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS key_rotation_progress (
+	run_id UUID NOT NULL REFERENCES key_rotation_runs(id) ON DELETE CASCADE,
+	target VARCHAR(100) NOT NULL, -- table.column
+	total INT NOT NULL DEFAULT 0,
+	last_id UUID,
+	scanned INT NOT NULL DEFAULT 0,
+	rotated INT NOT NULL DEFAULT 0,
+	failed INT NOT NULL DEFAULT 0,
+	done BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (run_id, target)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE tenants DROP COLUMN IF EXISTS receptionist_mfa_required;
+DROP INDEX IF EXISTS idx_staff_sessions_actor;
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS mfa_factors;
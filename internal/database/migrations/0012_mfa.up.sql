@@ -0,0 +1,50 @@
+-- Second factors for staff (admins, therapists, receptionists). A factor counts once confirmed:
+-- TOTP after the first valid code, WebAuthn once the registration is verified.
+CREATE TABLE IF NOT EXISTS mfa_factors (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_type VARCHAR(20) NOT NULL, -- admin, therapist, receptionist
+	actor_id UUID NOT NULL,
+	kind VARCHAR(20) NOT NULL, -- totp, webauthn
+	name VARCHAR(100) NOT NULL DEFAULT '',
+	totp_secret_enc TEXT,
+	totp_last_step BIGINT NOT NULL DEFAULT 0, -- last accepted time step; older codes are replays
+	credential_id TEXT UNIQUE, -- base64url WebAuthn credential ID
+	public_key BYTEA, -- COSE_Key
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	confirmed_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_factors_actor ON mfa_factors(actor_type, actor_id);
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_type VARCHAR(20) NOT NULL,
+	actor_id UUID NOT NULL,
+	code_hash VARCHAR(64) NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_actor ON mfa_recovery_codes(actor_type, actor_id);
+
+-- Pending second steps: a sign-in waiting for a factor (signin), a sign-in that must enroll one
+-- first (enroll), or a WebAuthn registration (register). The token is only stored hashed.
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	actor_type VARCHAR(20) NOT NULL,
+	actor_id UUID NOT NULL,
+	tenant_id UUID,
+	purpose VARCHAR(20) NOT NULL,
+	challenge BYTEA NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP NOT NULL,
+	consumed_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires ON mfa_challenges(expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_staff_sessions_actor ON staff_sessions(actor_id, active);
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS receptionist_mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
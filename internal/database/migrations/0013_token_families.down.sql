@@ -0,0 +1,7 @@
+DELETE FROM refresh_tokens WHERE tenant_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN tenant_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_refresh_tokens_family;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS replaced_by;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS role;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS family_id;
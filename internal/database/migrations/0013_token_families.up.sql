@@ -0,0 +1,13 @@
+-- Refresh tokens rotate on every use. Each sign-in starts a family; presenting a token that was
+-- already rotated means it leaked, and the whole family is revoked.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS role VARCHAR(20);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS replaced_by UUID;
+UPDATE refresh_tokens SET family_id = id WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+UPDATE refresh_tokens SET role = 'therapist' WHERE role IS NULL AND user_id IN (SELECT id FROM therapists);
+UPDATE refresh_tokens SET role = 'receptionist' WHERE role IS NULL AND user_id IN (SELECT id FROM receptionists);
+-- Admin tokens carry no tenant.
+ALTER TABLE refresh_tokens ALTER COLUMN tenant_id DROP NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
@@ -0,0 +1,19 @@
+-- One row per sign-in, for every role, so users can see and end the sessions they have open.
+-- A sign-in is backed by a refresh token family, an opaque Redis session, or both (therapists).
+CREATE TABLE IF NOT EXISTS auth_sessions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_type VARCHAR(20) NOT NULL,
+	actor_id UUID NOT NULL,
+	refresh_family_id UUID,
+	session_token_hash VARCHAR(64),
+	device_hash VARCHAR(64) NOT NULL,
+	user_agent TEXT,
+	ip_address VARCHAR(255),
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_actor ON auth_sessions(actor_type, actor_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auth_sessions_family ON auth_sessions(refresh_family_id) WHERE refresh_family_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_session_hash ON auth_sessions(session_token_hash) WHERE session_token_hash IS NOT NULL;
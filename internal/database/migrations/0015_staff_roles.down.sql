@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tenant_staff_roles;
+DROP TABLE IF EXISTS tenant_roles;
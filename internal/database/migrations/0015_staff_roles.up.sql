@@ -0,0 +1,24 @@
+-- Custom staff roles per tenant. Built-in roles (owner, receptionist, billing_clerk,
+-- associate_therapist, supervisor, auditor) are defined in code and not stored here.
+CREATE TABLE IF NOT EXISTS tenant_roles (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	key VARCHAR(50) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	permissions TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (tenant_id, key)
+);
+
+-- Roles held by tenant staff. Staff with no row keep their account type's default role.
+CREATE TABLE IF NOT EXISTS tenant_staff_roles (
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	staff_id UUID NOT NULL,
+	role_key VARCHAR(50) NOT NULL,
+	assigned_by UUID,
+	assigned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (tenant_id, staff_id, role_key)
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_staff_roles_staff ON tenant_staff_roles(staff_id);
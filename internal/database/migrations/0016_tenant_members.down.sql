@@ -0,0 +1,14 @@
+-- Reverts 0016_tenant_members. Members other than a practice's owner lose access to it, and
+-- the 1:1 tenants.therapist_id constraint can only come back while no therapist owns more than
+-- one practice; otherwise this stops before changing anything.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM tenants GROUP BY therapist_id HAVING COUNT(*) > 1) THEN
+		RAISE EXCEPTION 'cannot revert 0016_tenant_members: some therapists own more than one tenant; merge or reassign those tenants first';
+	END IF;
+END
+$$;
+
+DROP TABLE IF EXISTS tenant_invitations;
+DROP TABLE IF EXISTS tenant_members;
+ALTER TABLE tenants ADD CONSTRAINT tenants_therapist_id_key UNIQUE (therapist_id);
@@ -0,0 +1,37 @@
+-- Tenants can have several practitioners. tenants.therapist_id stays as the practice's
+-- primary owner; membership and per-tenant admin rights live in tenant_members.
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_therapist_id_key;
+
+CREATE TABLE IF NOT EXISTS tenant_members (
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	invited_by UUID,
+	joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (tenant_id, therapist_id)
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_members_therapist ON tenant_members(therapist_id);
+
+-- Every existing 1:1 tenant becomes a practice with its therapist as owner
+INSERT INTO tenant_members (tenant_id, therapist_id, role, joined_at)
+SELECT id, therapist_id, 'owner', created_at FROM tenants
+ON CONFLICT DO NOTHING;
+
+-- Invitations are addressed to a therapist's account email and accepted after sign-in.
+CREATE TABLE IF NOT EXISTS tenant_invitations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member')),
+	invited_by UUID NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP,
+	accepted_by UUID,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_invitations_email ON tenant_invitations(LOWER(email));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_invitations_pending
+	ON tenant_invitations(tenant_id, LOWER(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS security_audit_checkpoints;
+ALTER TABLE security_audit_logs DROP CONSTRAINT IF EXISTS security_audit_logs_chained;
+DROP INDEX IF EXISTS idx_security_audit_chain;
+ALTER TABLE security_audit_logs DROP COLUMN IF EXISTS row_hash;
+ALTER TABLE security_audit_logs DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE security_audit_logs DROP COLUMN IF EXISTS chain_seq;
+ALTER TABLE security_audit_logs DROP COLUMN IF EXISTS chain_date;
@@ -0,0 +1,29 @@
+-- Hash chain over security_audit_logs: each row carries the hash of the row before it in the
+-- same UTC day's chain. Rows written before this migration stay unchained.
+ALTER TABLE security_audit_logs ADD COLUMN IF NOT EXISTS chain_date DATE;
+ALTER TABLE security_audit_logs ADD COLUMN IF NOT EXISTS chain_seq BIGINT;
+ALTER TABLE security_audit_logs ADD COLUMN IF NOT EXISTS prev_hash CHAR(64);
+ALTER TABLE security_audit_logs ADD COLUMN IF NOT EXISTS row_hash CHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_security_audit_chain ON security_audit_logs(chain_date, chain_seq);
+
+-- New rows must be chained; NOT VALID leaves the existing rows alone
+ALTER TABLE security_audit_logs DROP CONSTRAINT IF EXISTS security_audit_logs_chained;
+ALTER TABLE security_audit_logs ADD CONSTRAINT security_audit_logs_chained
+	CHECK (chain_date IS NOT NULL AND chain_seq IS NOT NULL AND prev_hash IS NOT NULL AND row_hash IS NOT NULL) NOT VALID;
+
+-- Signed heads of each day's chain, so truncating a chain or rewriting it end to end is detected
+CREATE TABLE IF NOT EXISTS security_audit_checkpoints (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	chain_date DATE NOT NULL,
+	chain_seq BIGINT NOT NULL,
+	row_hash CHAR(64) NOT NULL,
+	key_id VARCHAR(32) NOT NULL,
+	signature TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_security_audit_checkpoints_date ON security_audit_checkpoints(chain_date, chain_seq);
+
+DROP TRIGGER IF EXISTS restrict_audit_checkpoint_mutations ON security_audit_checkpoints;
+CREATE TRIGGER restrict_audit_checkpoint_mutations
+BEFORE UPDATE OR DELETE ON security_audit_checkpoints
+FOR EACH ROW EXECUTE FUNCTION block_modifications();
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_security_audit_tenant;
+DROP INDEX IF EXISTS idx_security_audit_event;
+DROP INDEX IF EXISTS idx_security_audit_target;
+DROP INDEX IF EXISTS idx_security_audit_created_id;
+ALTER TABLE admins DROP CONSTRAINT IF EXISTS admins_role_check;
+ALTER TABLE admins DROP COLUMN IF EXISTS role;
@@ -0,0 +1,13 @@
+-- Admin accounts are either platform admins or compliance reviewers. Reviewers only reach the
+-- audit review API; admins do not.
+ALTER TABLE admins ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'admin';
+ALTER TABLE admins DROP CONSTRAINT IF EXISTS admins_role_check;
+ALTER TABLE admins ADD CONSTRAINT admins_role_check CHECK (role IN ('admin', 'compliance'));
+
+-- Audit review filters. Tenant-scoped events carry their tenant at the start of reason
+-- ("tenant=<uuid> resource=..."), which the expression index makes searchable.
+CREATE INDEX IF NOT EXISTS idx_security_audit_created_id ON security_audit_logs(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_security_audit_target ON security_audit_logs(target_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_security_audit_event ON security_audit_logs(event_type, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_security_audit_tenant
+	ON security_audit_logs((substring(reason FROM '^tenant=([0-9a-f-]{36})')), created_at DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS phi_access_log;
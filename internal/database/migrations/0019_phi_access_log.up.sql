@@ -0,0 +1,26 @@
+-- Every staff read and write of patient health data. Append-only like security_audit_logs; no
+-- foreign keys, so entries outlive the patients and staff they name.
+CREATE TABLE IF NOT EXISTS phi_access_log (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	occurred_at TIMESTAMP NOT NULL,
+	tenant_id UUID,
+	patient_id UUID,
+	actor_id UUID NOT NULL,
+	actor_role VARCHAR(30) NOT NULL,
+	action VARCHAR(10) NOT NULL CHECK (action IN ('read', 'write')),
+	resource_type VARCHAR(50) NOT NULL,
+	resource_id VARCHAR(100) NOT NULL DEFAULT '',
+	method VARCHAR(10) NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	ip_address VARCHAR(45) NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_phi_access_patient ON phi_access_log(patient_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_phi_access_actor ON phi_access_log(actor_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_phi_access_tenant ON phi_access_log(tenant_id, occurred_at DESC);
+
+DROP TRIGGER IF EXISTS restrict_phi_access_mutations ON phi_access_log;
+CREATE TRIGGER restrict_phi_access_mutations
+BEFORE UPDATE OR DELETE ON phi_access_log
+FOR EACH ROW EXECUTE FUNCTION block_modifications();
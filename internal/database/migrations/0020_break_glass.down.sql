@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_phi_access_break_glass;
+ALTER TABLE phi_access_log DROP COLUMN IF EXISTS break_glass_id;
+DROP TABLE IF EXISTS break_glass_grants;
+UPDATE admins SET role = 'admin', is_active = FALSE WHERE role = 'safety';
+ALTER TABLE admins DROP CONSTRAINT IF EXISTS admins_role_check;
+ALTER TABLE admins ADD CONSTRAINT admins_role_check CHECK (role IN ('admin', 'compliance'));
@@ -0,0 +1,34 @@
+-- Platform safety officers are admin accounts that can only use break-glass access.
+ALTER TABLE admins DROP CONSTRAINT IF EXISTS admins_role_check;
+ALTER TABLE admins ADD CONSTRAINT admins_role_check CHECK (role IN ('admin', 'compliance', 'safety'));
+
+-- Time-boxed emergency access to one patient's record outside the normal tenant scope. Grants
+-- are never deleted; like the PHI access log they have no foreign keys.
+CREATE TABLE IF NOT EXISTS break_glass_grants (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL,
+	patient_id UUID NOT NULL,
+	grantee_id UUID NOT NULL,
+	grantee_role VARCHAR(20) NOT NULL CHECK (grantee_role IN ('therapist', 'safety')),
+	justification TEXT NOT NULL CHECK (char_length(btrim(justification)) >= 20),
+	starts_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	ended_at TIMESTAMP,
+	ended_by UUID,
+	end_reason VARCHAR(20) CHECK (end_reason IN ('released', 'revoked')),
+	notified_approvers UUID[] NOT NULL DEFAULT '{}',
+	approved_by UUID,
+	approved_at TIMESTAMP,
+	patient_notified_at TIMESTAMP,
+	CHECK (expires_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS idx_break_glass_grantee ON break_glass_grants(grantee_id, starts_at DESC);
+CREATE INDEX IF NOT EXISTS idx_break_glass_patient ON break_glass_grants(patient_id, starts_at DESC);
+CREATE INDEX IF NOT EXISTS idx_break_glass_tenant ON break_glass_grants(tenant_id, starts_at DESC);
+CREATE INDEX IF NOT EXISTS idx_break_glass_unnotified ON break_glass_grants(expires_at)
+	WHERE patient_notified_at IS NULL;
+
+-- Accesses made under a grant are flagged for review
+ALTER TABLE phi_access_log ADD COLUMN IF NOT EXISTS break_glass_id UUID;
+CREATE INDEX IF NOT EXISTS idx_phi_access_break_glass ON phi_access_log(break_glass_id, occurred_at)
+	WHERE break_glass_id IS NOT NULL;
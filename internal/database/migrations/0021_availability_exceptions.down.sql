@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_appointments_schedule_conflict;
+ALTER TABLE appointments DROP COLUMN IF EXISTS schedule_conflict_id;
+ALTER TABLE appointments DROP COLUMN IF EXISTS schedule_conflict;
+DROP TABLE IF EXISTS tenant_holidays;
+DROP TABLE IF EXISTS availability_overrides;
+DROP TABLE IF EXISTS availability_time_off;
+ALTER TABLE availability_slots DROP COLUMN IF EXISTS buffer_min;
@@ -0,0 +1,50 @@
+-- Gap kept free after each session generated from a block
+ALTER TABLE availability_slots ADD COLUMN IF NOT EXISTS buffer_min INT NOT NULL DEFAULT 0 CHECK (buffer_min >= 0);
+
+-- Blackout periods (vacation, sick leave): nothing is offered between starts_at and ends_at (UTC)
+CREATE TABLE IF NOT EXISTS availability_time_off (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	starts_at TIMESTAMP NOT NULL,
+	ends_at TIMESTAMP NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_by UUID,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CHECK (ends_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS idx_time_off_therapist ON availability_time_off(tenant_id, therapist_id, starts_at);
+
+-- Extra availability on one date, in addition to the weekly template. Overrides also open a
+-- practitioner on a tenant holiday.
+CREATE TABLE IF NOT EXISTS availability_overrides (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	date DATE NOT NULL,
+	start_time TIME NOT NULL,
+	end_time TIME NOT NULL,
+	slot_duration_min INT NOT NULL DEFAULT 60 CHECK (slot_duration_min > 0),
+	buffer_min INT NOT NULL DEFAULT 0 CHECK (buffer_min >= 0),
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CHECK (end_time > start_time)
+);
+CREATE INDEX IF NOT EXISTS idx_availability_overrides_date ON availability_overrides(tenant_id, therapist_id, date);
+
+-- Practice-wide closed days, entered by hand or imported from an iCal feed
+CREATE TABLE IF NOT EXISTS tenant_holidays (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	date DATE NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	source VARCHAR(10) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'ical')),
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (tenant_id, date, name)
+);
+
+-- Appointments that time off or a holiday added later now falls on, for staff to reschedule
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS schedule_conflict VARCHAR(20)
+	CHECK (schedule_conflict IN ('time_off', 'holiday'));
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS schedule_conflict_id UUID;
+CREATE INDEX IF NOT EXISTS idx_appointments_schedule_conflict ON appointments(schedule_conflict_id)
+	WHERE schedule_conflict_id IS NOT NULL;
@@ -0,0 +1,30 @@
+-- btree_gist lets the exclusion constraint compare therapist_id with =
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- A patient's claim on a slot while they pay for it. Two held slots of one practitioner can
+-- never overlap; a hold stops counting once it is confirmed, released or expired.
+CREATE TABLE IF NOT EXISTS slot_holds (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	appointment_id UUID REFERENCES appointments(id) ON DELETE SET NULL,
+	starts_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'held'
+		CHECK (status IN ('held', 'confirmed', 'released', 'expired')),
+	ended_at TIMESTAMPTZ,
+	-- Set once a payment that arrived after expiry has been refunded
+	payment_refunded_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK (ends_at > starts_at),
+	CONSTRAINT slot_holds_no_overlap EXCLUDE USING gist (
+		therapist_id WITH =,
+		tstzrange(starts_at, ends_at) WITH &&
+	) WHERE (status = 'held')
+);
+CREATE INDEX IF NOT EXISTS idx_slot_holds_appointment ON slot_holds(appointment_id);
+CREATE INDEX IF NOT EXISTS idx_slot_holds_expiry ON slot_holds(expires_at) WHERE status = 'held';
+CREATE INDEX IF NOT EXISTS idx_slot_holds_refund ON slot_holds(ended_at)
+	WHERE status = 'expired' AND payment_refunded_at IS NULL;
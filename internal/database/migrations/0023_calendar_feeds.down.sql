@@ -0,0 +1,3 @@
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS attachments;
+DROP TABLE IF EXISTS appointment_invites;
+DROP TABLE IF EXISTS calendar_feed_tokens;
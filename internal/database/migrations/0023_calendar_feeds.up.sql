@@ -0,0 +1,27 @@
+-- Secret-token ICS subscription feeds. Only the SHA-256 of the token is stored; the URL is shown
+-- once when the feed is created or rotated. Rotating revokes the previous token.
+CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	owner_role VARCHAR(20) NOT NULL CHECK (owner_role IN ('therapist', 'patient')),
+	owner_id UUID NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_feed_tokens_active
+	ON calendar_feed_tokens(owner_role, owner_id) WHERE revoked_at IS NULL;
+
+-- The last .ics invite sent for an appointment, so reschedules bump SEQUENCE and a CANCEL is
+-- only sent for appointments that were invited.
+CREATE TABLE IF NOT EXISTS appointment_invites (
+	appointment_id UUID PRIMARY KEY REFERENCES appointments(id) ON DELETE CASCADE,
+	sequence INT NOT NULL DEFAULT 0,
+	starts_at TIMESTAMP NOT NULL,
+	ends_at TIMESTAMP NOT NULL,
+	cancelled_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS attachments JSONB;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS calendar_busy_times;
+ALTER TABLE calendar_event_mappings DROP COLUMN IF EXISTS conflict_reason;
+DROP INDEX IF EXISTS idx_calendar_integrations_channel;
+ALTER TABLE calendar_integrations
+	DROP COLUMN IF EXISTS sync_token,
+	DROP COLUMN IF EXISTS last_pulled_at,
+	DROP COLUMN IF EXISTS channel_id,
+	DROP COLUMN IF EXISTS channel_resource_id,
+	DROP COLUMN IF EXISTS channel_token_hash,
+	DROP COLUMN IF EXISTS channel_expires_at;
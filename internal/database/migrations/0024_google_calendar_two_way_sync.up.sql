@@ -0,0 +1,31 @@
+-- Incremental sync state and the push notification (watch) channel of each Google integration
+ALTER TABLE calendar_integrations
+	ADD COLUMN IF NOT EXISTS sync_token TEXT,
+	ADD COLUMN IF NOT EXISTS last_pulled_at TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS channel_id VARCHAR(64),
+	ADD COLUMN IF NOT EXISTS channel_resource_id TEXT,
+	-- SHA-256 of the secret Google echoes back in X-Goog-Channel-Token
+	ADD COLUMN IF NOT EXISTS channel_token_hash VARCHAR(64),
+	ADD COLUMN IF NOT EXISTS channel_expires_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_integrations_channel
+	ON calendar_integrations(channel_id) WHERE channel_id IS NOT NULL;
+
+-- sync_status gains 'conflict': the event was deleted in Google while the booking still stands
+ALTER TABLE calendar_event_mappings
+	ADD COLUMN IF NOT EXISTS conflict_reason TEXT;
+
+-- Busy times of events in the practitioner's Google calendar that are not Serenify appointments,
+-- kept current by the sync so slot generation never calls Google.
+CREATE TABLE IF NOT EXISTS calendar_busy_times (
+	integration_id UUID NOT NULL REFERENCES calendar_integrations(id) ON DELETE CASCADE,
+	external_event_id TEXT NOT NULL,
+	therapist_id UUID NOT NULL REFERENCES therapists(id) ON DELETE CASCADE,
+	starts_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (integration_id, external_event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_calendar_busy_times_therapist
+	ON calendar_busy_times(therapist_id, starts_at, ends_at);
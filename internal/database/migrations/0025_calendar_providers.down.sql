@@ -0,0 +1,6 @@
+DELETE FROM calendar_integrations WHERE provider <> 'google';
+ALTER TABLE calendar_integrations DROP CONSTRAINT IF EXISTS calendar_integrations_provider_check;
+ALTER TABLE calendar_integrations
+	DROP COLUMN IF EXISTS provider,
+	DROP COLUMN IF EXISTS account_username;
+ALTER TABLE calendar_integrations ALTER COLUMN calendar_id TYPE VARCHAR(255);
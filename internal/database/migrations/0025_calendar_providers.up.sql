@@ -0,0 +1,11 @@
+-- Integrations can sync to Google, Microsoft 365 (Graph) or any CalDAV server. For CalDAV,
+-- calendar_id is the calendar collection URL and access_token_enc holds the app password.
+ALTER TABLE calendar_integrations
+	ADD COLUMN IF NOT EXISTS provider VARCHAR(20) NOT NULL DEFAULT 'google',
+	ADD COLUMN IF NOT EXISTS account_username TEXT;
+
+ALTER TABLE calendar_integrations DROP CONSTRAINT IF EXISTS calendar_integrations_provider_check;
+ALTER TABLE calendar_integrations ADD CONSTRAINT calendar_integrations_provider_check
+	CHECK (provider IN ('google', 'microsoft', 'caldav'));
+
+ALTER TABLE calendar_integrations ALTER COLUMN calendar_id TYPE TEXT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_refunds_pending;
+UPDATE refunds SET status = 'pending' WHERE status = 'processing';
@@ -0,0 +1,4 @@
+-- Refunds are written as pending before the gateway is called and finished afterwards.
+-- Gateway refunds still being paid out were stored as pending; they are processing now.
+UPDATE refunds SET status = 'processing' WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_refunds_pending ON refunds(created_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_appointment_reminders_processing;
+UPDATE appointment_reminders SET status = 'pending' WHERE status = 'processing';
+UPDATE appointment_reminders SET status = 'cancelled' WHERE status = 'failed';
+ALTER TABLE appointment_reminders
+	DROP COLUMN IF EXISTS next_attempt_at,
+	DROP COLUMN IF EXISTS attempts;
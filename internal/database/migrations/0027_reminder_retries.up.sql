@@ -0,0 +1,6 @@
+-- Reminders are claimed as processing while they are dispatched and only marked sent once the
+-- dispatch succeeded. Failed dispatches go back to pending and are retried with a backoff.
+ALTER TABLE appointment_reminders
+	ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_appointment_reminders_processing ON appointment_reminders(updated_at) WHERE status = 'processing';
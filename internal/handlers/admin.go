@@ -197,6 +197,32 @@ func DeleteTherapist(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	// Practices the therapist shares pass to their longest-serving admin (or member) so the
+	// tenant, and the other practitioners' records, survive the cascade
+	_, err = tx.ExecContext(r.Context(), `
+		WITH heir AS (
+			SELECT DISTINCT ON (m.tenant_id) m.tenant_id, m.therapist_id
+			FROM tenant_members m
+			JOIN tenants tn ON tn.id = m.tenant_id AND tn.therapist_id = $1
+			WHERE m.therapist_id <> $1 AND m.is_active = TRUE
+			ORDER BY m.tenant_id, (m.role = 'admin') DESC, m.joined_at
+		), moved AS (
+			UPDATE tenants tn SET therapist_id = heir.therapist_id, updated_at = NOW()
+			FROM heir WHERE tn.id = heir.tenant_id
+			RETURNING tn.id, tn.therapist_id
+		), promoted AS (
+			UPDATE tenant_members m SET role = 'owner', updated_at = NOW()
+			FROM moved WHERE m.tenant_id = moved.id AND m.therapist_id = moved.therapist_id
+		)
+		UPDATE receptionists rc SET therapist_id = moved.therapist_id
+		FROM moved WHERE rc.tenant_id = moved.id AND rc.therapist_id = $1
+	`, therapistID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Failed to hand over shared practices"})
+		return
+	}
+
 	var tenantIDs []uuid.UUID
 	rows, err := tx.QueryContext(r.Context(), `SELECT id FROM tenants WHERE therapist_id = $1`, therapistID)
 	if err != nil {
@@ -859,10 +885,15 @@ func AdminBlockGroupMember(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. Immutably log administrative block action
-	_, _ = database.PostgresDB.ExecContext(r.Context(), `
-		INSERT INTO security_audit_logs (id, event_type, target_id, actor_id, actor_role, reason, ip_address, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, uuid.New(), "ADMIN_MEMBER_GROUP_BLOCKED", userUUID.String(), "admin", "admin", "User blocked administratively from group chat: "+groupUUID.String(), clientip.RealClientIP(r), time.Now().UTC())
+	database.LogSecurityEvent(r.Context(), database.AuditEvent{
+		EventType:     "ADMIN_MEMBER_GROUP_BLOCKED",
+		TargetID:      userUUID.String(),
+		ActorID:       "admin",
+		ActorRole:     "admin",
+		ActionDetails: "User blocked administratively from group chat: " + groupUUID.String(),
+		IPAddress:     clientip.RealClientIP(r),
+		UserAgent:     r.UserAgent(),
+	})
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -40,6 +40,11 @@ type AdminSigninResponse struct {
 	Message string `json:"message"`
 	Admin   map[string]interface{} `json:"admin,omitempty"`
 	Token   string `json:"token,omitempty"`
+	// JWT pair for clients on the token service; the session token above keeps working
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // shown once, after enrolling the first factor
 }
 
 // AdminSignup handles creating a new admin account (backend only, no frontend)
@@ -189,15 +194,15 @@ func AdminSignin(w http.ResponseWriter, r *http.Request) {
 
 	// Find admin by username
 	var adminID uuid.UUID
-	var username, email, passwordHash string
+	var username, email, passwordHash, role string
 	var isActive bool
 	var createdAt time.Time
 
 	err := database.PostgresDB.QueryRow(`
-		SELECT id, created_at, username, email, password_hash, is_active
+		SELECT id, created_at, username, email, password_hash, is_active, role
 		FROM admins
 		WHERE username = $1
-	`, req.Username).Scan(&adminID, &createdAt, &username, &email, &passwordHash, &isActive)
+	`, req.Username).Scan(&adminID, &createdAt, &username, &email, &passwordHash, &isActive, &role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.Header().Set("Content-Type", "application/json")
@@ -240,7 +245,55 @@ func AdminSignin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create admin session token (stored in Redis)
+	// Admins verify their second factor before the session is issued; privileged roles without
+	// one get an enrollment challenge instead of a session
+	challenge, err := services.BeginMFASignin(services.MFAActor{Type: services.MFAActorAdmin, ID: adminID})
+	if err != nil {
+		log.Printf("ERROR: Failed to start MFA sign-in for %s: %v", username, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(AdminSigninResponse{
+			Success: false,
+			Message: "Failed to start MFA",
+		})
+		return
+	}
+	if challenge != nil {
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	writeAdminSignin(w, r, adminID, username, email, role, createdAt, nil)
+}
+
+// AdminSigninMFA finishes an admin sign-in with its second factor.
+func AdminSigninMFA(w http.ResponseWriter, r *http.Request) {
+	actor, recoveryCodes, ok := completeMFASignin(w, r, services.MFAActorAdmin)
+	if !ok {
+		return
+	}
+	var username, email, role string
+	var isActive bool
+	var createdAt time.Time
+	err := database.PostgresDB.QueryRow(`
+		SELECT created_at, username, email, is_active, role FROM admins WHERE id = $1
+	`, actor.ID).Scan(&createdAt, &username, &email, &isActive, &role)
+	if err != nil || !isActive {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(AdminSigninResponse{
+			Success: false,
+			Message: "Admin account is inactive",
+		})
+		return
+	}
+	writeAdminSignin(w, r, actor.ID, username, email, role, createdAt, recoveryCodes)
+}
+
+// writeAdminSignin creates the admin session and writes the sign-in response.
+func writeAdminSignin(w http.ResponseWriter, r *http.Request, adminID uuid.UUID, username, email, role string, createdAt time.Time, recoveryCodes []string) {
+	// Create admin session token (stored in Redis) for V1 endpoints. The token family is the
+	// authoritative credential; recordSignin ties this session to it so it ends with the family
 	sessionToken, err := services.CreateAdminSession(adminID)
 	if err != nil {
 		log.Printf("ERROR: Failed to create admin session for %s: %v", username, err)
@@ -252,6 +305,18 @@ func AdminSignin(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	tokenPair, err := services.IssueAdminTokens(adminID)
+	if err != nil {
+		log.Printf("ERROR: Failed to issue admin tokens for %s: %v", username, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(AdminSigninResponse{
+			Success: false,
+			Message: "Failed to create admin session",
+		})
+		return
+	}
+	recordSignin(r, services.TokenRoleAdmin, adminID, sessionToken, tokenPair.FamilyID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -262,9 +327,14 @@ func AdminSignin(w http.ResponseWriter, r *http.Request) {
 			"id":        adminID.String(),
 			"username":  username,
 			"email":     email,
+			"role":      role,
 			"created_at": createdAt,
 		},
-		Token: sessionToken,
+		Token:         sessionToken,
+		AccessToken:   tokenPair.AccessToken,
+		RefreshToken:  tokenPair.RefreshToken,
+		ExpiresIn:     tokenPair.ExpiresIn,
+		RecoveryCodes: recoveryCodes,
 	})
 }
 
@@ -284,9 +354,42 @@ func extractBearerToken(authHeader string) string {
 }
 
 // requireAdminAuth validates the admin session token from Authorization: Bearer <token>
-// and returns the adminID.
+// and returns the adminID. Compliance reviewer accounts are refused.
 func requireAdminAuth(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	adminID, ok := authenticateAdmin(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	role, active, err := services.AdminRole(adminID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Failed to validate admin session",
+		})
+		return uuid.Nil, false
+	}
+	if !active || role != services.AdminRoleAdmin {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Forbidden",
+		})
+		return uuid.Nil, false
+	}
+	return adminID, true
+}
+
+// authenticateAdmin resolves the signed-in admin account of any role.
+func authenticateAdmin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
 	token := extractBearerToken(r.Header.Get("Authorization"))
+	if claims, ok := services.ValidateAdminAccessToken(token); ok {
+		if adminID, err := uuid.Parse(claims.UserID); err == nil {
+			return adminID, true
+		}
+	}
 	adminID, ok, err := services.ValidateAdminSession(token)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
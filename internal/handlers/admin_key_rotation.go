@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// AdminListKeyRotations shows the keyring (IDs only) and recent re-encryption runs with progress.
+func AdminListKeyRotations(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	ring, err := utils.ActiveKeyring()
+	if err != nil {
+		http.Error(w, "Encryption keyring not configured: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	runs, err := services.ListKeyRotationRuns(limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch key rotation runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"active_key_id": ring.ActiveKeyID(),
+		"key_ids":       ring.KeyIDs(),
+		"runs":          runs,
+	})
+}
+
+// AdminStartKeyRotation re-encrypts every encrypted column under the active key in the
+// background. With dry_run it only counts what would change and checks that it can be read.
+func AdminStartKeyRotation(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := requireAdminAuth(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+	}
+	run, err := services.StartKeyRotation(req.DryRun, &adminID)
+	switch {
+	case errors.Is(err, services.ErrKeyRotationRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to start key rotation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"run":     run,
+	})
+}
+
+func AdminGetKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "runId"))
+	if err != nil {
+		http.Error(w, "Invalid run ID", http.StatusBadRequest)
+		return
+	}
+	run, err := services.GetKeyRotationRun(id)
+	if err != nil {
+		writeKeyRotationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"run":     run,
+	})
+}
+
+// AdminCancelKeyRotation stops a running job after its current batch.
+func AdminCancelKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "runId"))
+	if err != nil {
+		http.Error(w, "Invalid run ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.CancelKeyRotation(id); err != nil {
+		writeKeyRotationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Key rotation cancelled",
+	})
+}
+
+func writeKeyRotationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrKeyRotationNotFound) {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to fetch key rotation run: "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// AdminListPaymentEvents lists webhook events from the payment ledger, newest first.
+// Optional filters: status, order_id, limit.
+func AdminListPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	events, err := services.ListPaymentEvents(q.Get("status"), q.Get("order_id"), limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch payment events: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"events":  events,
+		"count":   len(events),
+	})
+}
+
+// AdminReplayPaymentEvent applies a stored event again. Events are idempotent, so replaying one
+// that was already applied changes nothing.
+func AdminReplayPaymentEvent(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "eventId"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	ev, err := services.ProcessPaymentEvent(id)
+	writePaymentEventResult(w, ev, err)
+}
+
+// AdminReconcilePaymentEvent fetches the event's order from the provider and applies the
+// provider's status.
+func AdminReconcilePaymentEvent(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdminAuth(w, r); !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "eventId"))
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+	ev, err := services.ReconcilePaymentEvent(r.Context(), id)
+	writePaymentEventResult(w, ev, err)
+}
+
+func writePaymentEventResult(w http.ResponseWriter, ev interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+			"event":   ev,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"event":   ev,
+	})
+}
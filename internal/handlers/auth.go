@@ -392,23 +392,12 @@ func TherapistSignin(w http.ResponseWriter, r *http.Request) {
 
 	// Find therapist
 	var therapistID uuid.UUID
-	var name, email, password, licenseNumber, licenseState, specialization, phone sql.NullString
-	var collegeDegree, mastersInstitution, psychologistType, dsmAwareness, therapyTypes sql.NullString
-	var certificateImagePath, degreeImagePath sql.NullString
-	var yearsOfExperience, successfulCases int
+	var password sql.NullString
 	var isApproved bool
-	var createdAt time.Time
-	
+
 	err := database.PostgresDB.QueryRow(`
-		SELECT id, created_at, name, email, password, license_number, license_state,
-			years_of_experience, specialization, phone, college_degree, masters_institution,
-			psychologist_type, successful_cases, dsm_awareness, therapy_types,
-			certificate_image_path, degree_image_path, is_approved
-		FROM therapists WHERE email = $1
-	`, req.Email).Scan(&therapistID, &createdAt, &name, &email, &password, &licenseNumber, &licenseState,
-		&yearsOfExperience, &specialization, &phone, &collegeDegree, &mastersInstitution,
-		&psychologistType, &successfulCases, &dsmAwareness, &therapyTypes,
-		&certificateImagePath, &degreeImagePath, &isApproved)
+		SELECT id, password, is_approved FROM therapists WHERE email = $1
+	`, req.Email).Scan(&therapistID, &password, &isApproved)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
@@ -429,13 +418,64 @@ func TherapistSignin(w http.ResponseWriter, r *http.Request) {
 	if !isApproved {
 		if os.Getenv("ENV") != "production" {
 			_, _ = database.PostgresDB.Exec("UPDATE therapists SET is_approved = TRUE WHERE id = $1", therapistID)
-			isApproved = true
 		} else {
 			http.Error(w, "Your application is pending approval. Please wait for admin approval before logging in.", http.StatusForbidden)
 			return
 		}
 	}
 
+	// Therapists with a second factor verify it before any session is issued
+	challenge, err := services.BeginMFASignin(services.MFAActor{Type: services.MFAActorTherapist, ID: therapistID})
+	if err != nil {
+		log.Printf("ERROR: Failed to start MFA sign-in for therapist %s: %v", therapistID, err)
+		http.Error(w, "Failed to start MFA", http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	writeTherapistSignin(w, r, therapistID, nil)
+}
+
+// TherapistSigninMFA finishes a therapist sign-in with its second factor.
+func TherapistSigninMFA(w http.ResponseWriter, r *http.Request) {
+	actor, recoveryCodes, ok := completeMFASignin(w, r, services.MFAActorTherapist)
+	if !ok {
+		return
+	}
+	writeTherapistSignin(w, r, actor.ID, recoveryCodes)
+}
+
+// writeTherapistSignin issues the therapist's session and tokens and writes the sign-in response.
+func writeTherapistSignin(w http.ResponseWriter, r *http.Request, therapistID uuid.UUID, recoveryCodes []string) {
+	var name, email, licenseNumber, licenseState, specialization, phone sql.NullString
+	var collegeDegree, mastersInstitution, psychologistType, dsmAwareness, therapyTypes sql.NullString
+	var certificateImagePath, degreeImagePath sql.NullString
+	var yearsOfExperience, successfulCases int
+	var isApproved bool
+	var createdAt time.Time
+
+	err := database.PostgresDB.QueryRow(`
+		SELECT created_at, name, email, license_number, license_state,
+			years_of_experience, specialization, phone, college_degree, masters_institution,
+			psychologist_type, successful_cases, dsm_awareness, therapy_types,
+			certificate_image_path, degree_image_path, is_approved
+		FROM therapists WHERE id = $1
+	`, therapistID).Scan(&createdAt, &name, &email, &licenseNumber, &licenseState,
+		&yearsOfExperience, &specialization, &phone, &collegeDegree, &mastersInstitution,
+		&psychologistType, &successfulCases, &dsmAwareness, &therapyTypes,
+		&certificateImagePath, &degreeImagePath, &isApproved)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !isApproved {
+		http.Error(w, "Your application is pending approval. Please wait for admin approval before logging in.", http.StatusForbidden)
+		return
+	}
+
 	// Return therapist (without password)
 	therapistMap := map[string]interface{}{
 		"id":                   therapistID.String(),
@@ -458,7 +498,8 @@ func TherapistSignin(w http.ResponseWriter, r *http.Request) {
 		"is_approved":          isApproved,
 	}
 
-	// Create Redis session for the approved therapist (V1 compat)
+	// Create Redis session for the approved therapist (V1 compat). The token family issued below
+	// is the authoritative credential; recordSignin ties this session to it so it ends with the family
 	sessionToken, err := services.CreateSession(therapistID)
 	if err != nil {
 		log.Printf("ERROR: Failed to create session for therapist %s: %v", email.String, err)
@@ -476,9 +517,12 @@ func TherapistSignin(w http.ResponseWriter, r *http.Request) {
 	therapistMap["tenant_id"] = tenantID.String()
 
 	var tokenPair *services.TokenPair
+	familyID := uuid.Nil
 	if pair, err := services.IssueTherapistTokens(therapistID, tenantID); err == nil {
 		tokenPair = pair
+		familyID = pair.FamilyID
 	}
+	recordSignin(r, services.TokenRoleTherapist, therapistID, sessionToken, familyID)
 
 	resp := map[string]interface{}{
 		"success": true,
@@ -491,6 +535,9 @@ func TherapistSignin(w http.ResponseWriter, r *http.Request) {
 		resp["refresh_token"] = tokenPair.RefreshToken
 		resp["expires_in"] = tokenPair.ExpiresIn
 	}
+	if len(recoveryCodes) > 0 {
+		resp["recovery_codes"] = recoveryCodes
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
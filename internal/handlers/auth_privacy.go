@@ -196,6 +196,7 @@ func PrivacySignup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Link referral code if provided
+	var referredBy uuid.UUID
 	if req.ReferralCode != "" {
 		var referralID uuid.UUID
 		var therapistID uuid.UUID
@@ -293,15 +294,7 @@ func PrivacySignup(w http.ResponseWriter, r *http.Request) {
 
 		// Dispatch secure audit log
 		database.TriggerAuditEvent("REFERRAL_CODE_USED", referralID.String(), userID.String(), "user", fmt.Sprintf("Referral code %s used during registration to link user with therapist %s", req.ReferralCode, therapistID.String()), r)
-
-		// Create real-time notification for the therapist
-		_, err = tx.Exec(`
-			INSERT INTO notifications (id, recipient_id, recipient_role, title, message, type, is_read, created_at, data)
-			VALUES (gen_random_uuid(), $1, 'therapist', $2, $3, 'connection_request', FALSE, NOW(), $4)
-		`, therapistID, "New Referral Connection", fmt.Sprintf("A new client (username: %s) has successfully registered and linked via your referral code.", normalizedUsername), fmt.Sprintf(`{"user_id": "%s", "username": "%s", "connection_type": "referral"}`, userID.String(), normalizedUsername))
-		if err != nil {
-			log.Printf("WARNING: Failed to write therapist notification event: %v", err)
-		}
+		referredBy = therapistID
 	}
 
 	// Commit transaction
@@ -310,12 +303,30 @@ func PrivacySignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Create real-time notification for the therapist
+	if referredBy != uuid.Nil {
+		err = services.Dispatch(services.Notification{
+			RecipientID:   referredBy,
+			RecipientRole: "therapist",
+			Type:          "connection_request",
+			Title:         "New Referral Connection",
+			Message:       fmt.Sprintf("A new client (username: %s) has successfully registered and linked via your referral code.", normalizedUsername),
+			Data:          map[string]string{"user_id": userID.String(), "username": normalizedUsername, "connection_type": "referral"},
+		})
+		if err != nil {
+			log.Printf("WARNING: Failed to write therapist notification event: %v", err)
+		}
+	}
+
 	// Create session for the new user (7 days)
 	sessionToken, err := services.CreateSession(userID)
 	if err != nil {
 		log.Printf("WARNING: Failed to create session for user %s: %v", normalizedUsername, err)
 		// Continue without session - user can still sign in
 	}
+	if sessionToken != "" {
+		recordSignin(r, services.SessionRoleUser, userID, sessionToken, uuid.Nil)
+	}
 
 	// Return anonymous user data only
 	userMap := map[string]interface{}{
@@ -392,6 +403,9 @@ func PrivacySignin(w http.ResponseWriter, r *http.Request) {
 		log.Printf("WARNING: Failed to create session for user %s: %v", normalizedUsername, err)
 		// Continue without session - but this should not happen normally
 	}
+	if sessionToken != "" {
+		recordSignin(r, services.SessionRoleUser, userID, sessionToken, uuid.Nil)
+	}
 
 	// Track device for support purposes
 	deviceToken := generateDeviceToken()
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// The compliance API is mounted behind middleware.AdminAuth, RequireRole(compliance) and
+// MFAEnforcer. Reviewing the audit log is itself audited.
+
+var auditExportColumns = []string{
+	"id", "created_at", "event_type", "actor_id", "actor_role", "target_id", "tenant_id",
+	"reason", "ip_address", "user_agent", "chain_date", "chain_seq", "row_hash",
+}
+
+// ComplianceListAuditEvents filters audit events by actor_id, target_id, event_type (comma
+// separated), tenant_id, from and to, newest first. Pass next_cursor back as cursor for the next
+// page.
+func ComplianceListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, next, err := services.QueryAuditEvents(r.Context(), q)
+	if errors.Is(err, services.ErrInvalidAuditCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to query audit events", http.StatusInternalServerError)
+		return
+	}
+	auditComplianceAccess(r, "AUDIT_LOG_QUERIED", "security_audit_logs", r.URL.RawQuery)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"events":      events,
+		"next_cursor": next,
+	})
+}
+
+// ComplianceExportAuditEvents streams every event matching the same filters, oldest first, as
+// CSV (format=csv, the default) or NDJSON (format=ndjson).
+func ComplianceExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	auditComplianceAccess(r, "AUDIT_LOG_EXPORTED", "security_audit_logs", "format="+format+" "+r.URL.RawQuery)
+
+	filename := fmt.Sprintf("audit-events-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Headers are sent with the first row, so a failure part-way can only be logged
+	if format == "ndjson" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		err = services.StreamAuditEvents(r.Context(), q, func(e services.AuditLogEntry) error {
+			return enc.Encode(e)
+		})
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		if err = cw.Write(auditExportColumns); err == nil {
+			err = services.StreamAuditEvents(r.Context(), q, func(e services.AuditLogEntry) error {
+				return cw.Write(auditExportRow(e))
+			})
+		}
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: audit export stopped: %v", err)
+	}
+}
+
+// CompliancePatientAccessReport lists who accessed a patient's record between from and to: the
+// audit events that name the patient and each logged read or write of their health data, plus
+// the staff who can read their clinical record today.
+func CompliancePatientAccessReport(w http.ResponseWriter, r *http.Request) {
+	patientID, err := uuid.Parse(chi.URLParam(r, "patientId"))
+	if err != nil {
+		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		return
+	}
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := services.BuildPatientAccessReport(r.Context(), patientID, q.From, q.To)
+	if errors.Is(err, services.ErrPatientNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to build access report", http.StatusInternalServerError)
+		return
+	}
+	auditComplianceAccess(r, "PATIENT_ACCESS_REPORT_VIEWED", patientID.String(), "tenant="+report.TenantID.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// ComplianceListBreakGlass lists emergency access grants across tenants, filtered by tenant_id,
+// patient_id, grantee_id and status.
+func ComplianceListBreakGlass(w http.ResponseWriter, r *http.Request) {
+	f, ok := breakGlassFilter(w, r)
+	if !ok {
+		return
+	}
+	if s := r.URL.Query().Get("tenant_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid tenant_id", http.StatusBadRequest)
+			return
+		}
+		f.TenantID = &id
+	}
+	if s := r.URL.Query().Get("grantee_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid grantee_id", http.StatusBadRequest)
+			return
+		}
+		f.GranteeID = &id
+	}
+	grants, err := services.ListBreakGlassGrants(r.Context(), f)
+	if err != nil {
+		http.Error(w, "Failed to list break-glass access", http.StatusInternalServerError)
+		return
+	}
+	auditComplianceAccess(r, "BREAK_GLASS_GRANTS_QUERIED", "break_glass_grants", r.URL.RawQuery)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"grants":  grants,
+	})
+}
+
+// ComplianceGetBreakGlass returns a grant with every record read under it, for review.
+func ComplianceGetBreakGlass(w http.ResponseWriter, r *http.Request) {
+	grantID, err := uuid.Parse(chi.URLParam(r, "grantId"))
+	if err != nil {
+		http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+	grant, err := services.GetBreakGlassGrant(grantID)
+	if errors.Is(err, services.ErrBreakGlassNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load break-glass access", http.StatusInternalServerError)
+		return
+	}
+	access, err := services.ListBreakGlassAccesses(r.Context(), grantID)
+	if err != nil {
+		http.Error(w, "Failed to load break-glass access", http.StatusInternalServerError)
+		return
+	}
+	auditComplianceAccess(r, "BREAK_GLASS_GRANT_REVIEWED", grant.PatientID.String(), services.BreakGlassAuditDetails(grant, ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"grant":         grant,
+		"record_access": access,
+	})
+}
+
+// parseAuditQuery reads the audit filters from a query string. from and to take RFC 3339 times
+// or YYYY-MM-DD dates; a date in to includes that whole day.
+func parseAuditQuery(v url.Values) (services.AuditQuery, error) {
+	q := services.AuditQuery{
+		ActorID:  strings.TrimSpace(v.Get("actor_id")),
+		TargetID: strings.TrimSpace(v.Get("target_id")),
+		Cursor:   v.Get("cursor"),
+	}
+	for _, t := range strings.Split(v.Get("event_type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			q.EventTypes = append(q.EventTypes, strings.ToUpper(t))
+		}
+	}
+	if s := v.Get("tenant_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return q, errors.New("invalid tenant_id")
+		}
+		q.TenantID = &id
+	}
+	if s := v.Get("from"); s != "" {
+		t, _, err := parseAuditTime(s)
+		if err != nil {
+			return q, errors.New("invalid from: use RFC 3339 or YYYY-MM-DD")
+		}
+		q.From = &t
+	}
+	if s := v.Get("to"); s != "" {
+		t, dateOnly, err := parseAuditTime(s)
+		if err != nil {
+			return q, errors.New("invalid to: use RFC 3339 or YYYY-MM-DD")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		q.To = &t
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return q, errors.New("from must be before to")
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func parseAuditTime(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t.UTC(), false, err
+}
+
+func auditExportRow(e services.AuditLogEntry) []string {
+	tenant, seq := "", ""
+	if e.TenantID != nil {
+		tenant = e.TenantID.String()
+	}
+	if e.ChainSeq > 0 {
+		seq = strconv.FormatInt(e.ChainSeq, 10)
+	}
+	row := []string{
+		e.ID.String(), e.CreatedAt.UTC().Format(time.RFC3339Nano), e.EventType, e.ActorID, e.ActorRole,
+		e.TargetID, tenant, e.Reason, e.IPAddress, e.UserAgent, e.ChainDate, seq, e.RowHash,
+	}
+	for i, cell := range row {
+		row[i] = csvSafeCell(cell)
+	}
+	return row
+}
+
+// csvSafeCell stops spreadsheets from evaluating a cell as a formula. Reasons and user agents
+// come from users, so a leading =, +, -, @, tab or CR is escaped with a quote.
+func csvSafeCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// auditComplianceAccess records a reviewer reading the audit log.
+func auditComplianceAccess(r *http.Request, eventType, targetID, details string) {
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+	database.TriggerAuditEvent(eventType, targetID, actorID, role, details, r)
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// mfaProofRequest completes a sign-in's second step.
+type mfaProofRequest struct {
+	MFAToken     string                       `json:"mfa_token"`
+	Code         string                       `json:"code"`
+	RecoveryCode string                       `json:"recovery_code"`
+	WebAuthn     *services.WebAuthnCredential `json:"webauthn"`
+	Registration *services.WebAuthnCredential `json:"webauthn_registration"`
+	Name         string                       `json:"name"`
+}
+
+func (req mfaProofRequest) proof() services.MFAProof {
+	return services.MFAProof{
+		Code:         req.Code,
+		RecoveryCode: req.RecoveryCode,
+		Assertion:    req.WebAuthn,
+		Registration: req.Registration,
+		Name:         req.Name,
+	}
+}
+
+type finishWebAuthnRequest struct {
+	RegistrationToken string                      `json:"registration_token"`
+	Name              string                      `json:"name"`
+	Credential        services.WebAuthnCredential `json:"credential"`
+}
+
+type securitySettingsRequest struct {
+	ReceptionistMFARequired *bool `json:"receptionist_mfa_required"`
+}
+
+// The factor management handlers below are mounted for admins (admin session), therapists
+// (tenant routes) and receptionists (reception routes); mfaActor works out who is calling.
+
+func ListMFAFactors(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, false)
+	if !ok {
+		return
+	}
+	factors, remaining, err := services.ListMFAFactors(actor)
+	if err != nil {
+		http.Error(w, "Failed to list MFA factors", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"factors":                  factors,
+		"recovery_codes_remaining": remaining,
+	}})
+}
+
+// StartTOTPEnrollment returns a new TOTP secret and its otpauth:// URI for the QR code. The
+// factor becomes active once a code from it is confirmed.
+func StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, true)
+	if !ok {
+		return
+	}
+	factor, secret, uri, err := services.BeginTOTPEnrollment(actor)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{
+		"factor":      factor,
+		"secret":      secret,
+		"otpauth_uri": uri,
+	}})
+}
+
+// ConfirmTOTPEnrollment activates a TOTP factor. Recovery codes are returned once, with the
+// first factor.
+func ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, false)
+	if !ok {
+		return
+	}
+	factorID, err := uuid.Parse(chi.URLParam(r, "factorId"))
+	if err != nil {
+		http.Error(w, "Invalid factor ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	codes, err := services.ConfirmTOTPEnrollment(actor, factorID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	database.TriggerAuditEvent("MFA_FACTOR_ENROLLED", factorID.String(), actor.ID.String(), actor.Type, "TOTP factor confirmed", r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"factor_id":      factorID,
+		"recovery_codes": codes,
+	}})
+}
+
+// StartWebAuthnRegistration returns the options for navigator.credentials.create. A sign-in
+// that must enroll sends its mfa_token as X-MFA-Token and completes through the sign-in MFA
+// endpoint with webauthn_registration.
+func StartWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	actor, enrollToken, ok := mfaActor(w, r, true)
+	if !ok {
+		return
+	}
+	token, options, err := services.BeginWebAuthnRegistration(actor, enrollToken)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"registration_token": token,
+		"options":            options,
+	}})
+}
+
+func FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, false)
+	if !ok {
+		return
+	}
+	var req finishWebAuthnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	factor, codes, err := services.FinishWebAuthnRegistration(actor, req.RegistrationToken, req.Name, req.Credential)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	database.TriggerAuditEvent("MFA_FACTOR_ENROLLED", factor.ID.String(), actor.ID.String(), actor.Type, "WebAuthn credential registered", r)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{
+		"factor":         factor,
+		"recovery_codes": codes,
+	}})
+}
+
+func DeleteMFAFactor(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, false)
+	if !ok {
+		return
+	}
+	factorID, err := uuid.Parse(chi.URLParam(r, "factorId"))
+	if err != nil {
+		http.Error(w, "Invalid factor ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.DeleteMFAFactor(actor, factorID); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	database.TriggerAuditEvent("MFA_FACTOR_REMOVED", factorID.String(), actor.ID.String(), actor.Type, "MFA factor removed", r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateMFARecoveryCodes replaces the recovery codes; the old ones stop working.
+func RegenerateMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	actor, _, ok := mfaActor(w, r, false)
+	if !ok {
+		return
+	}
+	codes, err := services.RegenerateRecoveryCodes(actor)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	database.TriggerAuditEvent("MFA_RECOVERY_CODES_REGENERATED", actor.ID.String(), actor.ID.String(), actor.Type, "Recovery codes regenerated", r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"recovery_codes": codes,
+	}})
+}
+
+func GetSecuritySettingsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	required, err := services.TenantReceptionistMFARequired(tenantID)
+	if err != nil {
+		http.Error(w, "Failed to load security settings", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"receptionist_mfa_required": required,
+	}})
+}
+
+// UpdateSecuritySettingsV2 lets the practice require MFA for its receptionists. Receptionists
+// without a factor are asked to enroll one at their next sign-in.
+func UpdateSecuritySettingsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	var req securitySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReceptionistMFARequired == nil {
+		http.Error(w, "receptionist_mfa_required is required", http.StatusBadRequest)
+		return
+	}
+	if err := services.SetTenantReceptionistMFARequired(tenantID, *req.ReceptionistMFARequired); err != nil {
+		http.Error(w, "Failed to update security settings", http.StatusInternalServerError)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "SECURITY_SETTINGS_UPDATED", "tenant", tenantID.String(), actorID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"receptionist_mfa_required": *req.ReceptionistMFARequired,
+	}})
+}
+
+// mfaActor resolves who is managing factors: a receptionist or therapist from the tenant route
+// middleware, an admin from the admin session, or, with allowEnroll, a sign-in that has to enroll
+// before it gets a session (its mfa_token in X-MFA-Token, returned as enrollToken).
+func mfaActor(w http.ResponseWriter, r *http.Request, allowEnroll bool) (actor services.MFAActor, enrollToken string, ok bool) {
+	ctx := r.Context()
+	if id, ok := middleware.ReceptionistIDFromCtx(ctx); ok {
+		tenantID, _ := middleware.TenantIDFromCtx(ctx)
+		return services.MFAActor{Type: services.MFAActorReceptionist, ID: id, TenantID: tenantID}, "", true
+	}
+	if id, ok := middleware.TherapistIDFromCtx(ctx); ok {
+		return services.MFAActor{Type: services.MFAActorTherapist, ID: id}, "", true
+	}
+	if token := r.Header.Get("X-MFA-Token"); token != "" {
+		if !allowEnroll {
+			http.Error(w, "Sign in to manage MFA factors", http.StatusUnauthorized)
+			return actor, "", false
+		}
+		actor, err := services.MFAChallengeActor(token)
+		if err != nil {
+			writeMFAError(w, err)
+			return actor, "", false
+		}
+		return actor, token, true
+	}
+	// Compliance reviewers manage their factors here too
+	id, ok := authenticateAdmin(w, r)
+	return services.MFAActor{Type: services.MFAActorAdmin, ID: id}, "", ok
+}
+
+// completeMFASignin verifies a sign-in's second step and returns who signed in, writing the error
+// response itself when verification fails.
+func completeMFASignin(w http.ResponseWriter, r *http.Request, actorType string) (services.MFAActor, []string, bool) {
+	var req mfaProofRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return services.MFAActor{}, nil, false
+	}
+	actor, codes, err := services.CompleteMFASignin(actorType, req.MFAToken, req.proof())
+	if err != nil {
+		if errors.Is(err, services.ErrMFAInvalid) {
+			database.TriggerAuditEvent("MFA_SIGNIN_FAILED", "MFA_SIGNIN", "unknown", actorType, err.Error(), r)
+		}
+		writeMFAError(w, err)
+		return services.MFAActor{}, nil, false
+	}
+	database.TriggerAuditEvent("MFA_SIGNIN_VERIFIED", actor.ID.String(), actor.ID.String(), actorType, "Second factor verified at sign-in", r)
+	return actor, codes, true
+}
+
+// writeMFAChallenge answers a password sign-in that still needs its second factor.
+func writeMFAChallenge(w http.ResponseWriter, challenge *services.MFASigninChallenge) {
+	message := "Verify your second factor to finish signing in"
+	if challenge.EnrollmentRequired {
+		message = "Set up a second factor to finish signing in"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"message":      message,
+		"mfa_required": true,
+		"mfa":          challenge,
+	})
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrMFAInvalid):
+		http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+	case errors.Is(err, services.ErrMFAChallengeExpired):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, services.ErrMFAFactorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrMFARequired):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "MFA request failed", http.StatusInternalServerError)
+	}
+}
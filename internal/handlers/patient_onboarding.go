@@ -196,15 +196,7 @@ func OnboardPatient(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Sync to V2 patients table for patient self-service dashboard APIs.
-	var tenantID uuid.UUID
-	err = tx.QueryRow(`SELECT id FROM tenants WHERE therapist_id = $1`, therapistID).Scan(&tenantID)
-	if err == sql.ErrNoRows {
-		err = tx.QueryRow(`
-			INSERT INTO tenants (therapist_id, display_name)
-			VALUES ($1, $2)
-			RETURNING id
-		`, therapistID, therapistName).Scan(&tenantID)
-	}
+	tenantID, err := services.EnsureTenantForTherapist(therapistID)
 	if err != nil {
 		log.Printf("ERROR: Failed to ensure tenant for onboarded patient %s: %v", userID, err)
 		http.Error(w, "Failed to link patient dashboard profile", http.StatusInternalServerError)
@@ -48,18 +48,16 @@ func ReceptionistSignin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var id uuid.UUID
-	var tenantID, therapistID uuid.UUID
-	var name, storedHash string
+	var id, tenantID uuid.UUID
+	var storedHash string
 	var isActive bool
-	var createdAt time.Time
 
 	err := database.PostgresDB.QueryRow(`
-		SELECT r.id, r.tenant_id, r.therapist_id, r.name, r.password_hash, r.is_active, r.created_at
+		SELECT r.id, r.tenant_id, r.password_hash, r.is_active
 		FROM receptionists r
 		WHERE r.email = $1
 		LIMIT 1
-	`, req.Email).Scan(&id, &tenantID, &therapistID, &name, &storedHash, &isActive, &createdAt)
+	`, req.Email).Scan(&id, &tenantID, &storedHash, &isActive)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
@@ -79,51 +77,99 @@ func ReceptionistSignin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A second factor is verified (or, when the practice requires one, enrolled) before the
+	// session is issued
+	challenge, err := services.BeginMFASignin(services.MFAActor{Type: services.MFAActorReceptionist, ID: id, TenantID: tenantID})
+	if err != nil {
+		log.Printf("ERROR: Failed to start MFA sign-in for receptionist %s: %v", req.Email, err)
+		http.Error(w, "Failed to start MFA", http.StatusInternalServerError)
+		return
+	}
+	if challenge != nil {
+		writeMFAChallenge(w, challenge)
+		return
+	}
+
+	writeReceptionistSignin(w, r, id, nil)
+}
+
+// ReceptionistSigninMFA finishes a receptionist sign-in with its second factor.
+func ReceptionistSigninMFA(w http.ResponseWriter, r *http.Request) {
+	actor, recoveryCodes, ok := completeMFASignin(w, r, services.MFAActorReceptionist)
+	if !ok {
+		return
+	}
+	writeReceptionistSignin(w, r, actor.ID, recoveryCodes)
+}
+
+// writeReceptionistSignin issues the receptionist's tokens and writes the sign-in response.
+func writeReceptionistSignin(w http.ResponseWriter, r *http.Request, id uuid.UUID, recoveryCodes []string) {
+	var tenantID, therapistID uuid.UUID
+	var name, email string
+	var isActive bool
+	var createdAt time.Time
+	err := database.PostgresDB.QueryRow(`
+		SELECT tenant_id, therapist_id, name, email, is_active, created_at
+		FROM receptionists WHERE id = $1
+	`, id).Scan(&tenantID, &therapistID, &name, &email, &isActive, &createdAt)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !isActive {
+		http.Error(w, "Account has been deactivated. Contact your therapist.", http.StatusForbidden)
+		return
+	}
+
 	// Fetch therapist name for context
 	var therapistName string
 	_ = database.PostgresDB.QueryRow(`SELECT name FROM therapists WHERE id = $1`, therapistID).Scan(&therapistName)
 
 	tokenPair, err := services.IssueReceptionistTokens(id, tenantID)
 	if err != nil {
-		log.Printf("ERROR: Failed to issue receptionist tokens for %s: %v", req.Email, err)
+		log.Printf("ERROR: Failed to issue receptionist tokens for %s: %v", email, err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
-
-	// Also cache in Redis for fast middleware lookups
-	services.SetReceptionistAuthCache(tokenPair.AccessToken, id)
+	recordSignin(r, services.TokenRoleReceptionist, id, "", tokenPair.FamilyID)
 
 	receptionistMap := map[string]interface{}{
 		"id":             id.String(),
 		"name":           name,
-		"email":          req.Email,
+		"email":          email,
 		"tenant_id":      tenantID.String(),
 		"therapist_id":   therapistID.String(),
 		"therapist_name": therapistName,
 		"created_at":     createdAt,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"success":       true,
 		"message":       "Login successful",
 		"receptionist":  receptionistMap,
 		"access_token":  tokenPair.AccessToken,
 		"refresh_token": tokenPair.RefreshToken,
 		"expires_in":    tokenPair.ExpiresIn,
-	})
+	}
+	if len(recoveryCodes) > 0 {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
-// ReceptionistSignout clears the Redis cache for the token.
+// ReceptionistSignout revokes the access token and the refresh family it was issued with.
 func ReceptionistSignout(w http.ResponseWriter, r *http.Request) {
-	// Clear Redis cache for the token
 	authHeader := r.Header.Get("Authorization")
 	var token string
 	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 		token = authHeader[7:]
 	}
 	if token != "" {
-		services.ClearReceptionistAuthCache(token)
+		if err := services.Logout(token, ""); err != nil {
+			http.Error(w, "Failed to sign out", http.StatusInternalServerError)
+			return
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Signed out"})
@@ -137,7 +183,7 @@ func ReceptionistSignout(w http.ResponseWriter, r *http.Request) {
 // Protected by TenantAuth — only the owning therapist can call this.
 func TherapistCreateReceptionist(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req createReceptionistRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -264,6 +310,10 @@ func TherapistDeactivateReceptionist(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Receptionist not found", http.StatusNotFound)
 		return
 	}
+	// Sign the receptionist out everywhere instead of waiting for their tokens to expire
+	if err := services.RevokeUserTokens(receptionistID); err != nil {
+		log.Printf("revoke tokens for receptionist %s: %v", receptionistID, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Receptionist deactivated"})
@@ -24,7 +24,8 @@ func ReceptionListAppointments(w http.ResponseWriter, r *http.Request) {
 
 	query := `
 		SELECT id, tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
-			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at
+			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at,
+			series_id, recurrence_id, is_exception, schedule_conflict, schedule_conflict_id
 		FROM appointments WHERE tenant_id = $1 AND starts_at >= $2 AND starts_at <= $3
 	`
 	args := []interface{}{tenantID, from, to}
@@ -57,7 +58,7 @@ func ReceptionListAppointments(w http.ResponseWriter, r *http.Request) {
 // linked therapist ID when no explicit therapist_id is supplied in the body.
 func ReceptionWalkIn(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req walkInRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -116,6 +117,7 @@ func ReceptionWalkIn(w http.ResponseWriter, r *http.Request) {
 	}
 
 	services.EnqueueCalendarSync("create", tenantID, aptID)
+	services.ScheduleAppointmentReminders(tenantID, aptID)
 	patient, _ := getPatientByID(tenantID, patientID)
 	apt, _ := getAppointment(tenantID, aptID)
 	writeJSON(w, http.StatusCreated, map[string]interface{}{
@@ -126,7 +128,7 @@ func ReceptionWalkIn(w http.ResponseWriter, r *http.Request) {
 // ReceptionQuickRegister registers a patient without scheduling an appointment.
 func ReceptionQuickRegister(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req quickRegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -171,13 +173,37 @@ func ReceptionCollectPayment(w http.ResponseWriter, r *http.Request) {
 	ReceptionCollectPaymentV2(w, r)
 }
 
+// ──────────────────────────────────────────────────────────────────────────────
+// Reception Portal — Session packages (catalog, balances, desk sales)
+// ──────────────────────────────────────────────────────────────────────────────
+
+// ReceptionListPackages returns the packages currently on sale.
+func ReceptionListPackages(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	listSessionPackages(w, tenantID, true)
+}
+
+// ReceptionListPatientPackages shows a patient's package balances and usage, so reception can
+// tell whether a visit is prepaid.
+func ReceptionListPatientPackages(w http.ResponseWriter, r *http.Request) {
+	ListPatientPackagesV2(w, r)
+}
+
+// ReceptionSellPackage sells a package at the desk; the invoice is then settled through
+// collect-payment.
+func ReceptionSellPackage(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	receptionistID, _ := middleware.ReceptionistIDFromCtx(r.Context())
+	sellPatientPackage(w, r, tenantID, receptionistID)
+}
+
 // ──────────────────────────────────────────────────────────────────────────────
 // Reception Portal — Referrals (read-only)
 // ──────────────────────────────────────────────────────────────────────────────
 
 // ReceptionListReferralCodes returns the referral codes for the therapist — read-only for reception.
 func ReceptionListReferralCodes(w http.ResponseWriter, r *http.Request) {
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	rows, err := database.PostgresDB.Query(`
 		SELECT id, code, created_at, expires_at, usage_limit, usage_count, is_revoked
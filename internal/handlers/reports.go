@@ -83,10 +83,14 @@ func SubmitAbuseReport(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 4. Safe Logging only (no plaintext or encrypted payload is logged)
-	_, _ = database.PostgresDB.ExecContext(r.Context(), `
-		INSERT INTO security_audit_logs (id, event_type, target_id, actor_id, actor_role, reason, ip_address, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, uuid.New(), "USER_REPORT_SUBMITTED", reportID.String(), reporterID.String(), "user", "Abuse/Harassment report filed securely", ipAddress, time.Now().UTC())
+	database.LogSecurityEvent(r.Context(), database.AuditEvent{
+		EventType:     "USER_REPORT_SUBMITTED",
+		TargetID:      reportID.String(),
+		ActorID:       reporterID.String(),
+		ActorRole:     "user",
+		ActionDetails: "Abuse/Harassment report filed securely",
+		IPAddress:     ipAddress,
+	})
 
 	// 5. Ephemeral Moderation Queue Priority Check in Redis
 	// Standard triage queue push (the specific category priority sorting will occur during processing or metadata analysis)
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/AnshRaj112/serenify-backend/pkg/clientip"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// The /me/sessions handlers serve every role: the bearer token decides whose sessions are
+// listed (access token, admin session, or user/therapist session).
+
+func ListMySessions(w http.ResponseWriter, r *http.Request) {
+	owner, ok := sessionOwner(w, r)
+	if !ok {
+		return
+	}
+	sessions, err := services.ListAuthSessions(owner)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": sessions})
+}
+
+// RevokeMySession signs out one session. Revoking the current session signs the caller out.
+func RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	owner, ok := sessionOwner(w, r)
+	if !ok {
+		return
+	}
+	sessionID, err := uuid.Parse(chi.URLParam(r, "sessionId"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeAuthSession(owner, sessionID); err != nil {
+		if errors.Is(err, services.ErrAuthSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	database.TriggerAuditEvent("SESSION_REVOKED", sessionID.String(), owner.ID.String(), owner.Role, "Session signed out by its owner", r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every session except the one making the request.
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	owner, ok := sessionOwner(w, r)
+	if !ok {
+		return
+	}
+	n, err := services.RevokeOtherAuthSessions(owner)
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	database.TriggerAuditEvent("SESSIONS_REVOKED_OTHERS", owner.ID.String(), owner.ID.String(), owner.Role, fmt.Sprintf("Signed out of %d other session(s)", n), r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"revoked": n,
+	}})
+}
+
+func sessionOwner(w http.ResponseWriter, r *http.Request) (services.SessionOwner, bool) {
+	owner, ok := services.ResolveSessionOwner(extractBearerToken(r.Header.Get("Authorization")))
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return owner, ok
+}
+
+// recordSignin lists a new sign-in under the account's sessions and tells the account holder when
+// it comes from a device they have not used before. Failures are logged; they never block sign-in.
+func recordSignin(r *http.Request, role string, actorID uuid.UUID, sessionToken string, familyID uuid.UUID) {
+	ip := clientip.RealClientIP(r)
+	sessionID, newDevice, err := services.RecordAuthSession(role, actorID, sessionToken, familyID, ip, r.UserAgent())
+	if err != nil {
+		log.Printf("sessions: record sign-in for %s %s: %v", role, actorID, err)
+		return
+	}
+	if !newDevice {
+		return
+	}
+	device := services.DescribeDevice(r.UserAgent())
+	database.TriggerAuditEvent("NEW_DEVICE_SIGNIN", sessionID.String(), actorID.String(), role, "Sign-in from a new device: "+device, r)
+	services.NotifyUser(actorID, role, "New sign-in to your account",
+		fmt.Sprintf("Your account was signed in from %s (IP %s). If this wasn't you, sign out of that session and change your password.", device, ip),
+		services.NewDeviceNotificationType)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type staffRoleRequest struct {
+	Key         string   `json:"key"`
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func ListPermissionsV2(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": services.PermissionRegistry})
+}
+
+// MyPermissionsV2 returns what the signed-in staff member may do, so the portal can show only
+// the screens they can use.
+func MyPermissionsV2(w http.ResponseWriter, r *http.Request) {
+	perms, _ := middleware.PermissionsFromCtx(r.Context())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": perms.List()})
+}
+
+func ListStaffRolesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	roles, err := services.ListTenantRoles(tenantID)
+	if err != nil {
+		http.Error(w, "Failed to list roles", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": roles})
+}
+
+func CreateStaffRoleV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req staffRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == nil || *req.Name == "" {
+		http.Error(w, "key and name are required", http.StatusBadRequest)
+		return
+	}
+	role := services.StaffRole{Key: req.Key, Name: *req.Name, Permissions: req.Permissions}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	created, err := services.CreateTenantRole(tenantID, role)
+	if err != nil {
+		writeStaffRoleError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "STAFF_ROLE_CREATED", "staff_role", created.Key, staffActorID(r))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": created})
+}
+
+func UpdateStaffRoleV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	key := chi.URLParam(r, "roleKey")
+	var req staffRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	updated, err := services.UpdateTenantRole(tenantID, key, req.Name, req.Description, req.Permissions)
+	if err != nil {
+		writeStaffRoleError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "STAFF_ROLE_UPDATED", "staff_role", key, staffActorID(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": updated})
+}
+
+func DeleteStaffRoleV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	key := chi.URLParam(r, "roleKey")
+	if err := services.DeleteTenantRole(tenantID, key); err != nil {
+		writeStaffRoleError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "STAFF_ROLE_DELETED", "staff_role", key, staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetStaffMemberRolesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	staffID, err := uuid.Parse(chi.URLParam(r, "staffId"))
+	if err != nil {
+		http.Error(w, "Invalid staff ID", http.StatusBadRequest)
+		return
+	}
+	keys, err := services.StaffRoleKeys(tenantID, staffID)
+	if err != nil {
+		http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"staff_id": staffID,
+		"roles":    keys,
+	}})
+}
+
+// SetStaffMemberRolesV2 replaces a staff member's roles. An empty list returns them to their
+// account's default role.
+func SetStaffMemberRolesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	staffID, err := uuid.Parse(chi.URLParam(r, "staffId"))
+	if err != nil {
+		http.Error(w, "Invalid staff ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	actor := staffActorID(r)
+	if staffID.String() == actor {
+		http.Error(w, "You cannot change your own roles", http.StatusForbidden)
+		return
+	}
+	assignedBy, _ := uuid.Parse(actor)
+	if err := services.SetStaffRoles(tenantID, staffID, assignedBy, req.Roles); err != nil {
+		writeStaffRoleError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "STAFF_ROLES_ASSIGNED", "staff", staffID.String(), actor)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"staff_id": staffID,
+		"roles":    req.Roles,
+	}})
+}
+
+// staffActorID is the staff member making a tenant request: the receptionist when one is signed
+// in, otherwise the therapist.
+func staffActorID(r *http.Request) string {
+	id, _ := middleware.ActorFromCtx(r.Context())
+	return id.String()
+}
+
+func writeStaffRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound), errors.Is(err, services.ErrStaffNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrRoleKeyTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrUnknownPermission), errors.Is(err, services.ErrInvalidRoleKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Role update failed", http.StatusInternalServerError)
+	}
+}
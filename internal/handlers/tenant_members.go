@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ListTenantMembersV2 lists the practice's practitioners, so staff can book with and filter by
+// each of them.
+func ListTenantMembersV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	members, err := services.ListTenantMembers(tenantID)
+	if err != nil {
+		http.Error(w, "Failed to list members", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": members})
+}
+
+func UpdateTenantMemberV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, err := uuid.Parse(chi.URLParam(r, "therapistId"))
+	if err != nil {
+		http.Error(w, "Invalid therapist ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := services.SetTenantMemberRole(tenantID, therapistID, req.Role); err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TENANT_MEMBER_ROLE_CHANGED", "tenant_member", therapistID.String(), staffActorID(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"therapist_id": therapistID,
+		"role":         req.Role,
+	}})
+}
+
+// RemoveTenantMemberV2 ends a practitioner's access to the practice. Their records stay.
+func RemoveTenantMemberV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, err := uuid.Parse(chi.URLParam(r, "therapistId"))
+	if err != nil {
+		http.Error(w, "Invalid therapist ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.RemoveTenantMember(tenantID, therapistID); err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TENANT_MEMBER_REMOVED", "tenant_member", therapistID.String(), staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ListTenantInvitationsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	invitations, err := services.ListTenantInvitations(tenantID)
+	if err != nil {
+		http.Error(w, "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": invitations})
+}
+
+// InviteTenantMemberV2 invites a therapist by account email. Therapists who already have an
+// account are notified; others see the invitation once they sign up with that email.
+func InviteTenantMemberV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	actor := staffActorID(r)
+	invitedBy, _ := uuid.Parse(actor)
+	inv, inviteeID, err := services.CreateTenantInvitation(tenantID, invitedBy, req.Email, req.Role)
+	if err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TENANT_MEMBER_INVITED", "tenant_invitation", inv.ID.String(), actor)
+
+	if inviteeID != uuid.Nil {
+		var practice string
+		_ = database.PostgresDB.QueryRow(`SELECT display_name FROM tenants WHERE id = $1`, tenantID).Scan(&practice)
+		services.NotifyUser(inviteeID, "therapist", "Invitation to join "+practice,
+			fmt.Sprintf("You have been invited to join %s as %s. Open your practice invitations to accept.", practice, inv.Role),
+			services.TenantInvitationNotificationType)
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": inv})
+}
+
+func RevokeTenantInvitationV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	invitationID, err := uuid.Parse(chi.URLParam(r, "invitationId"))
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.RevokeTenantInvitation(tenantID, invitationID); err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TENANT_INVITATION_REVOKED", "tenant_invitation", invitationID.String(), staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMyTenantsV2 lists the practices the signed-in therapist works in.
+func ListMyTenantsV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := requireTherapistAuth(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if _, err := services.EnsureTenantForTherapist(therapistID); err != nil {
+		http.Error(w, "Failed to load practices", http.StatusInternalServerError)
+		return
+	}
+	tenants, err := services.ListTherapistTenants(therapistID)
+	if err != nil {
+		http.Error(w, "Failed to load practices", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": tenants})
+}
+
+func ListMyTenantInvitationsV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := requireTherapistAuth(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	invitations, err := services.ListInvitationsForTherapist(therapistID)
+	if err != nil {
+		http.Error(w, "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": invitations})
+}
+
+func AcceptTenantInvitationV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := requireTherapistAuth(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	invitationID, err := uuid.Parse(chi.URLParam(r, "invitationId"))
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+	tenant, err := services.AcceptTenantInvitation(therapistID, invitationID)
+	if err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenant.TenantID, "TENANT_INVITATION_ACCEPTED", "tenant_invitation", invitationID.String(), therapistID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": tenant})
+}
+
+func DeclineTenantInvitationV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := requireTherapistAuth(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	invitationID, err := uuid.Parse(chi.URLParam(r, "invitationId"))
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+	if err := services.DeclineTenantInvitation(therapistID, invitationID); err != nil {
+		writeTenantMemberError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTenantMemberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrInvitationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrInvitationPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrOwnerMembership):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvitationExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, services.ErrInvalidMemberRole), errors.Is(err, services.ErrInvalidInviteeEmail):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Membership update failed", http.StatusInternalServerError)
+	}
+}
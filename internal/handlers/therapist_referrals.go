@@ -625,14 +625,6 @@ func RespondToRequest(w http.ResponseWriter, r *http.Request) {
 		// Trigger secure audit event
 		database.TriggerAuditEvent("CONNECTION_REQUEST_APPROVED", reqID.String(), therapistID.String(), "therapist", fmt.Sprintf("Therapist approved connection request from user: %s", userID.String()), r)
 
-		// Create user notification
-		_, err = tx.Exec(`
-			INSERT INTO notifications (id, recipient_id, recipient_role, title, message, type, is_read, created_at)
-			VALUES (gen_random_uuid(), $1, 'user', 'Connection Approved', 'A therapist has approved your connection request. You can now start communicating.', 'connection_approved', FALSE, NOW())
-		`, userID)
-		if err != nil {
-			log.Printf("WARNING: Failed to write patient notification: %v", err)
-		}
 	} else {
 		responseStatus = "rejected"
 
@@ -652,6 +644,10 @@ func RespondToRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if responseStatus == "approved" {
+		services.NotifyUser(userID, "user", "Connection Approved", "A therapist has approved your connection request. You can now start communicating.", "connection_approved")
+	}
+
 	invalidateTherapistCaches(therapistID, "requests", "connections")
 
 	w.Header().Set("Content-Type", "application/json")
@@ -726,20 +722,13 @@ func DisconnectUser(w http.ResponseWriter, r *http.Request) {
 	// Log secure audit event
 	database.TriggerAuditEvent("CONNECTION_DISCONNECTED", connID.String(), therapistID.String(), "therapist", fmt.Sprintf("Therapist disconnected connection with user %s", userID.String()), r)
 
-	// Create user notification
-	_, err = tx.Exec(`
-		INSERT INTO notifications (id, recipient_id, recipient_role, title, message, type, is_read, created_at)
-		VALUES (gen_random_uuid(), $1, 'user', 'Connection Ended', 'A therapist has disconnected their profile relationship with you.', 'connection_disconnected', FALSE, NOW())
-	`, userID)
-	if err != nil {
-		log.Printf("WARNING: Failed to create user notification: %v", err)
-	}
-
 	if err = tx.Commit(); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
+	services.NotifyUser(userID, "user", "Connection Ended", "A therapist has disconnected their profile relationship with you.", "connection_disconnected")
+
 	invalidateTherapistCaches(therapistID, "connections")
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1258,10 +1247,14 @@ func RequestConnection(w http.ResponseWriter, r *http.Request) {
 	var patientName string
 	_ = database.PostgresDB.QueryRow("SELECT username FROM users WHERE id = $1", patientID).Scan(&patientName)
 
-	_, err = database.PostgresDB.Exec(`
-		INSERT INTO notifications (id, recipient_id, recipient_role, title, message, type, is_read, data)
-		VALUES (gen_random_uuid(), $1, 'therapist', 'Connection Request Received', $2, 'connection_request', FALSE, $3)
-	`, therapistID, fmt.Sprintf("Patient (username: %s) requested a direct profile connection with you.", patientName), fmt.Sprintf(`{"user_id": "%s", "username": "%s"}`, patientID.String(), patientName))
+	err = services.Dispatch(services.Notification{
+		RecipientID:   therapistID,
+		RecipientRole: "therapist",
+		Type:          "connection_request",
+		Title:         "Connection Request Received",
+		Message:       fmt.Sprintf("Patient (username: %s) requested a direct profile connection with you.", patientName),
+		Data:          map[string]string{"user_id": patientID.String(), "username": patientName},
+	})
 	if err != nil {
 		log.Printf("WARNING: Failed to log therapist notification: %v", err)
 	}
@@ -1329,23 +1322,16 @@ func UserDisconnectTherapist(w http.ResponseWriter, r *http.Request) {
 	// Log secure audit event
 	database.TriggerAuditEvent("CONNECTION_DISCONNECTED", connID.String(), patientID.String(), "user", fmt.Sprintf("Patient disconnected from therapist %s", therapistID.String()), r)
 
-	// Notify therapist
-	var patientName string
-	_ = database.PostgresDB.QueryRow("SELECT username FROM users WHERE id = $1", patientID).Scan(&patientName)
-
-	_, err = tx.Exec(`
-		INSERT INTO notifications (id, recipient_id, recipient_role, title, message, type, is_read)
-		VALUES (gen_random_uuid(), $1, 'therapist', 'Client Connection Removed', $2, 'connection_disconnected', FALSE)
-	`, therapistID, fmt.Sprintf("Patient (username: %s) has ended their relationship connection with your profile.", patientName))
-	if err != nil {
-		log.Printf("WARNING: Failed to log therapist notification: %v", err)
-	}
-
 	if err = tx.Commit(); err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
+	// Notify therapist
+	var patientName string
+	_ = database.PostgresDB.QueryRow("SELECT username FROM users WHERE id = $1", patientID).Scan(&patientName)
+	services.NotifyUser(therapistID, "therapist", "Client Connection Removed", fmt.Sprintf("Patient (username: %s) has ended their relationship connection with your profile.", patientName), "connection_disconnected")
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -21,7 +21,7 @@ func AISummarizeSessionV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	plain, rating, err := services.GetSessionNotePlainText(req.NoteID)
+	plain, rating, err := services.GetSessionNotePlainText(tenantID, req.NoteID, noteViewerID(r))
 	if err != nil {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
@@ -35,6 +35,7 @@ func AISummarizeSessionV2(w http.ResponseWriter, r *http.Request) {
 	}
 	if req.PatientID != "" {
 		if pid, e := uuid.Parse(req.PatientID); e == nil {
+			middleware.NotePHIPatient(r.Context(), pid)
 			services.CacheAIInsight(tenantID, pid, "session_summary", result)
 		}
 	}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"math"
 	"net/http"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 
 func AnalyticsOverviewV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var activePatients, sessionsMonth, appointmentsWeek int
 	var revenueMonth sql.NullFloat64
@@ -59,11 +60,23 @@ func AnalyticsRevenueV2(w http.ResponseWriter, r *http.Request) {
 	}
 	from := time.Now().AddDate(0, 0, -days)
 
+	// Package invoices are deferred: their price is recognized from the package ledger as
+	// sessions are used or forfeited at expiry, not when the package is paid for.
 	rows, err := database.PostgresDB.Query(`
-		SELECT DATE(paid_at) as d, SUM(total) as amount, COUNT(*) as count
-		FROM invoices
-		WHERE tenant_id = $1 AND status = 'paid' AND paid_at >= $2
-		GROUP BY DATE(paid_at) ORDER BY d
+		SELECT d, SUM(invoice_amount), SUM(invoice_count), SUM(package_amount), SUM(package_sessions) FROM (
+			SELECT DATE(paid_at) AS d, SUM(total) AS invoice_amount, COUNT(*) AS invoice_count,
+				0 AS package_amount, 0 AS package_sessions
+			FROM invoices i
+			WHERE tenant_id = $1 AND status = 'paid' AND paid_at >= $2
+				AND NOT EXISTS (SELECT 1 FROM patient_packages pp WHERE pp.invoice_id = i.id)
+			GROUP BY DATE(paid_at)
+			UNION ALL
+			SELECT DATE(created_at), 0, 0, SUM(revenue), COUNT(*) FILTER (WHERE entry = 'session')
+			FROM package_ledger
+			WHERE tenant_id = $1 AND created_at >= $2 AND entry IN ('session', 'expiry')
+			GROUP BY DATE(created_at)
+		) r
+		GROUP BY d ORDER BY d
 	`, tenantID, from)
 	if err != nil {
 		http.Error(w, "Failed to load revenue", http.StatusInternalServerError)
@@ -74,14 +87,25 @@ func AnalyticsRevenueV2(w http.ResponseWriter, r *http.Request) {
 	series := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var d time.Time
-		var amount float64
-		var count int
-		_ = rows.Scan(&d, &amount, &count)
+		var invoiceAmount, packageAmount float64
+		var count, packageSessions int
+		_ = rows.Scan(&d, &invoiceAmount, &count, &packageAmount, &packageSessions)
 		series = append(series, map[string]interface{}{
-			"date": d.Format("2006-01-02"), "amount": amount, "count": count,
+			"date": d.Format("2006-01-02"), "amount": math.Round((invoiceAmount+packageAmount)*100) / 100, "count": count,
+			"invoice_amount": invoiceAmount, "package_amount": packageAmount, "package_sessions": packageSessions,
 		})
 	}
-	writeJSON(w, http.StatusOK, map[string]interface{}{"data": series, "period_days": days})
+
+	// Paid for but not yet used: what active packages still owe in sessions.
+	var deferred float64
+	_ = database.PostgresDB.QueryRow(`
+		SELECT COALESCE(SUM(pp.price - COALESCE((
+			SELECT SUM(l.revenue) FROM package_ledger l WHERE l.patient_package_id = pp.id
+		), 0)), 0)
+		FROM patient_packages pp WHERE pp.tenant_id = $1 AND pp.status = 'active'
+	`, tenantID).Scan(&deferred)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": series, "period_days": days, "package_deferred": deferred})
 }
 
 func AnalyticsAppointmentsV2(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type appointmentSeriesRequest struct {
+	PatientID   string `json:"patient_id"`
+	TherapistID string `json:"therapist_id,omitempty"`
+	Type        string `json:"type"`
+	StartsAt    string `json:"starts_at"`
+	DurationMin int    `json:"duration_min,omitempty"`
+	RRule       string `json:"rrule"`
+	MeetingLink string `json:"meeting_link,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+}
+
+func CreateAppointmentSeriesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
+
+	var req appointmentSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	patientID, err := uuid.Parse(req.PatientID)
+	if err != nil || !patientBelongsToTenant(tenantID, patientID) {
+		http.Error(w, "Invalid patient", http.StatusBadRequest)
+		return
+	}
+
+	aptTherapist := therapistID
+	if req.TherapistID != "" {
+		if tid, e := uuid.Parse(req.TherapistID); e == nil && services.TherapistInTenant(tenantID, tid) {
+			aptTherapist = tid
+		}
+	}
+
+	aptType := strings.TrimSpace(req.Type)
+	if !services.ValidateAppointmentType(aptType) {
+		http.Error(w, "Invalid appointment type", http.StatusBadRequest)
+		return
+	}
+
+	startsAt, err := services.ParseRFC3339(req.StartsAt)
+	if err != nil {
+		http.Error(w, "Invalid starts_at (RFC3339)", http.StatusBadRequest)
+		return
+	}
+	if _, err := services.ParseRecurrenceRule(req.RRule); err != nil {
+		http.Error(w, "Invalid rrule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, conflicts, err := services.CreateAppointmentSeries(models.AppointmentSeries{
+		TenantID:    tenantID,
+		PatientID:   patientID,
+		TherapistID: aptTherapist,
+		Type:        aptType,
+		RRule:       req.RRule,
+		StartsAt:    startsAt,
+		DurationMin: req.DurationMin,
+		MeetingLink: strings.TrimSpace(req.MeetingLink),
+		Location:    strings.TrimSpace(req.Location),
+		Notes:       strings.TrimSpace(req.Notes),
+		CreatedBy:   &therapistID,
+	})
+	if err != nil {
+		http.Error(w, "Failed to create appointment series", http.StatusInternalServerError)
+		return
+	}
+	writeSeriesResponse(w, http.StatusCreated, series, conflicts)
+}
+
+func GetAppointmentSeriesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	seriesID, err := uuid.Parse(chi.URLParam(r, "seriesId"))
+	if err != nil {
+		http.Error(w, "Invalid series ID", http.StatusBadRequest)
+		return
+	}
+	series, err := services.GetAppointmentSeries(tenantID, seriesID)
+	if err != nil {
+		seriesErr(w, err)
+		return
+	}
+	writeSeriesResponse(w, http.StatusOK, series, nil)
+}
+
+// updateAppointmentSeries handles PATCH /appointments/{id} with scope "following" or "all".
+func updateAppointmentSeries(w http.ResponseWriter, existing models.Appointment, req appointmentRequest, scope string) {
+	edit := services.SeriesEdit{
+		DurationMin: req.DurationMin,
+		RRule:       strings.TrimSpace(req.RRule),
+		MeetingLink: strings.TrimSpace(req.MeetingLink),
+		Location:    strings.TrimSpace(req.Location),
+		Notes:       strings.TrimSpace(req.Notes),
+	}
+	if req.Type != "" {
+		if !services.ValidateAppointmentType(req.Type) {
+			http.Error(w, "Invalid appointment type", http.StatusBadRequest)
+			return
+		}
+		edit.Type = req.Type
+	}
+	if req.StartsAt != "" {
+		t, err := services.ParseRFC3339(req.StartsAt)
+		if err != nil {
+			http.Error(w, "Invalid starts_at (RFC3339)", http.StatusBadRequest)
+			return
+		}
+		edit.StartsAt = &t
+	}
+	if edit.RRule != "" {
+		if _, err := services.ParseRecurrenceRule(edit.RRule); err != nil {
+			http.Error(w, "Invalid rrule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var (
+		series    models.AppointmentSeries
+		conflicts []services.SeriesConflict
+		err       error
+	)
+	if scope == services.SeriesScopeFollowing {
+		series, conflicts, err = services.EditSeriesFollowing(existing, edit)
+	} else {
+		series, conflicts, err = services.EditSeriesAll(existing, edit)
+	}
+	if err != nil {
+		seriesErr(w, err)
+		return
+	}
+	writeSeriesResponse(w, http.StatusOK, series, conflicts)
+}
+
+// parseSeriesScope validates an edit/cancel scope; "following" and "all" need a series occurrence.
+func parseSeriesScope(scope string, apt models.Appointment) (string, bool) {
+	switch scope {
+	case "", services.SeriesScopeThis:
+		return services.SeriesScopeThis, true
+	case services.SeriesScopeFollowing, services.SeriesScopeAll:
+		return scope, apt.SeriesID != nil
+	}
+	return "", false
+}
+
+func writeSeriesResponse(w http.ResponseWriter, status int, series models.AppointmentSeries, conflicts []services.SeriesConflict) {
+	occurrences, err := listSeriesAppointments(series.TenantID, series.ID)
+	if err != nil {
+		http.Error(w, "Failed to load series appointments", http.StatusInternalServerError)
+		return
+	}
+	if conflicts == nil {
+		conflicts = []services.SeriesConflict{}
+	}
+	writeJSON(w, status, map[string]interface{}{"data": map[string]interface{}{
+		"series":       series,
+		"appointments": occurrences,
+		"conflicts":    conflicts,
+	}})
+}
+
+func listSeriesAppointments(tenantID, seriesID uuid.UUID) ([]models.Appointment, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
+			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at,
+			series_id, recurrence_id, is_exception, schedule_conflict, schedule_conflict_id
+		FROM appointments WHERE tenant_id = $1 AND series_id = $2
+		ORDER BY starts_at ASC
+	`, tenantID, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := make([]models.Appointment, 0)
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+	return appointments, rows.Err()
+}
+
+func seriesErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrSeriesNotFound):
+		http.Error(w, "Series not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrSeriesInactive):
+		http.Error(w, "Series is no longer active", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update appointment series", http.StatusInternalServerError)
+	}
+}
@@ -27,10 +27,13 @@ type appointmentRequest struct {
 	Location    string `json:"location,omitempty"`
 	Notes       string `json:"notes,omitempty"`
 	Status      string `json:"status,omitempty"`
+	RRule       string `json:"rrule,omitempty"`
+	Scope       string `json:"scope,omitempty"` // this | following | all (series occurrences only)
 }
 
 type cancelRequest struct {
 	Reason string `json:"reason,omitempty"`
+	Scope  string `json:"scope,omitempty"`
 }
 
 func ListAppointmentsV2(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +42,8 @@ func ListAppointmentsV2(w http.ResponseWriter, r *http.Request) {
 
 	query := `
 		SELECT id, tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
-			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at
+			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at,
+			series_id, recurrence_id, is_exception, schedule_conflict, schedule_conflict_id
 		FROM appointments WHERE tenant_id = $1 AND starts_at >= $2 AND starts_at <= $3
 	`
 	args := []interface{}{tenantID, from, to}
@@ -79,7 +83,7 @@ func ListAppointmentsV2(w http.ResponseWriter, r *http.Request) {
 
 func CreateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req appointmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -147,6 +151,7 @@ func CreateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	services.EnqueueCalendarSync("create", tenantID, id)
+	services.ScheduleAppointmentReminders(tenantID, id)
 	a, _ := getAppointment(tenantID, id)
 	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": a})
 }
@@ -194,6 +199,16 @@ func UpdateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, ok := parseSeriesScope(req.Scope, existing)
+	if !ok {
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return
+	}
+	if scope != services.SeriesScopeThis {
+		updateAppointmentSeries(w, existing, req, scope)
+		return
+	}
+
 	startsAt := existing.StartsAt
 	endsAt := existing.EndsAt
 	if req.StartsAt != "" {
@@ -216,6 +231,9 @@ func UpdateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 		aptType = req.Type
 	}
 
+	diverged := !startsAt.Equal(existing.StartsAt) || !endsAt.Equal(existing.EndsAt) || aptType != existing.Type ||
+		req.MeetingLink != "" || req.Location != "" || req.Notes != ""
+
 	newStatus := existing.Status
 	if req.Status == "completed" && existing.Status != "cancelled" {
 		newStatus = "completed"
@@ -230,9 +248,13 @@ func UpdateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 			location = COALESCE(NULLIF($7,''), location),
 			notes = COALESCE(NULLIF($8,''), notes),
 			status = $9,
+			is_exception = is_exception OR (series_id IS NOT NULL AND $10),
+			-- Moving the appointment resolves a time off or holiday conflict
+			schedule_conflict = CASE WHEN starts_at = $4 AND ends_at = $5 THEN schedule_conflict END,
+			schedule_conflict_id = CASE WHEN starts_at = $4 AND ends_at = $5 THEN schedule_conflict_id END,
 			updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2
-	`, aptID, tenantID, aptType, startsAt, endsAt, req.MeetingLink, req.Location, req.Notes, newStatus)
+	`, aptID, tenantID, aptType, startsAt, endsAt, req.MeetingLink, req.Location, req.Notes, newStatus, diverged)
 	if err != nil {
 		http.Error(w, "Failed to update appointment", http.StatusInternalServerError)
 		return
@@ -243,6 +265,7 @@ func UpdateAppointmentV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	services.EnqueueCalendarSync("update", tenantID, aptID)
+	services.ScheduleAppointmentReminders(tenantID, aptID)
 	a, _ := getAppointment(tenantID, aptID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": a})
 }
@@ -258,9 +281,33 @@ func CancelAppointmentV2(w http.ResponseWriter, r *http.Request) {
 	var req cancelRequest
 	_ = json.NewDecoder(r.Body).Decode(&req)
 
+	if req.Scope != "" && req.Scope != services.SeriesScopeThis {
+		existing, err := getAppointment(tenantID, aptID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load appointment", http.StatusInternalServerError)
+			return
+		}
+		scope, ok := parseSeriesScope(req.Scope, existing)
+		if !ok {
+			http.Error(w, "Invalid scope", http.StatusBadRequest)
+			return
+		}
+		if _, err := services.CancelSeries(existing, scope, strings.TrimSpace(req.Reason)); err != nil {
+			seriesErr(w, err)
+			return
+		}
+		a, _ := getAppointment(tenantID, aptID)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": a})
+		return
+	}
+
 	res, err := database.PostgresDB.Exec(`
 		UPDATE appointments SET status = 'cancelled', cancelled_at = NOW(),
-			cancel_reason = $3, updated_at = NOW()
+			cancel_reason = $3, is_exception = is_exception OR series_id IS NOT NULL, updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2 AND status NOT IN ('cancelled', 'completed')
 	`, aptID, tenantID, strings.TrimSpace(req.Reason))
 	if err != nil {
@@ -272,8 +319,10 @@ func CancelAppointmentV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found or already cancelled", http.StatusNotFound)
 		return
 	}
+	_ = services.ReleaseSlotHold(aptID)
 
 	services.EnqueueCalendarSync("delete", tenantID, aptID)
+	services.ScheduleAppointmentReminders(tenantID, aptID)
 	a, _ := getAppointment(tenantID, aptID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": a})
 }
@@ -285,7 +334,8 @@ func ListMyAppointmentsV2(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := database.PostgresDB.Query(`
 		SELECT id, tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
-			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at
+			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at,
+			series_id, recurrence_id, is_exception, schedule_conflict, schedule_conflict_id
 		FROM appointments
 		WHERE tenant_id = $1 AND patient_id = $2 AND starts_at >= $3 AND starts_at <= $4
 		ORDER BY starts_at ASC
@@ -307,7 +357,8 @@ func ListMyAppointmentsV2(w http.ResponseWriter, r *http.Request) {
 func getAppointment(tenantID, id uuid.UUID) (models.Appointment, error) {
 	row := database.PostgresDB.QueryRow(`
 		SELECT id, tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
-			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at
+			meeting_link, location, notes, reminder_sent, created_by, cancelled_at, cancel_reason, created_at, updated_at,
+			series_id, recurrence_id, is_exception, schedule_conflict, schedule_conflict_id
 		FROM appointments WHERE id = $1 AND tenant_id = $2
 	`, id, tenantID)
 	return scanAppointmentRow(row)
@@ -315,13 +366,15 @@ func getAppointment(tenantID, id uuid.UUID) (models.Appointment, error) {
 
 func scanAppointment(rows *sql.Rows) (models.Appointment, error) {
 	var a models.Appointment
-	var meeting, location, notes, cancelReason sql.NullString
+	var meeting, location, notes, cancelReason, conflict sql.NullString
 	var createdBy sql.NullString
-	var cancelledAt sql.NullTime
+	var cancelledAt, recurrenceID sql.NullTime
+	var seriesID, conflictID uuid.NullUUID
 	err := rows.Scan(
 		&a.ID, &a.TenantID, &a.PatientID, &a.TherapistID, &a.Type, &a.Status,
 		&a.StartsAt, &a.EndsAt, &meeting, &location, &notes, &a.ReminderSent,
 		&createdBy, &cancelledAt, &cancelReason, &a.CreatedAt, &a.UpdatedAt,
+		&seriesID, &recurrenceID, &a.IsException, &conflict, &conflictID,
 	)
 	if err != nil {
 		return a, err
@@ -338,18 +391,33 @@ func scanAppointment(rows *sql.Rows) (models.Appointment, error) {
 		t := cancelledAt.Time
 		a.CancelledAt = &t
 	}
+	if seriesID.Valid {
+		id := seriesID.UUID
+		a.SeriesID = &id
+	}
+	if recurrenceID.Valid {
+		t := recurrenceID.Time
+		a.RecurrenceID = &t
+	}
+	a.ScheduleConflict = conflict.String
+	if conflictID.Valid {
+		id := conflictID.UUID
+		a.ScheduleConflictID = &id
+	}
 	return a, nil
 }
 
 func scanAppointmentRow(row *sql.Row) (models.Appointment, error) {
 	var a models.Appointment
-	var meeting, location, notes, cancelReason sql.NullString
+	var meeting, location, notes, cancelReason, conflict sql.NullString
 	var createdBy sql.NullString
-	var cancelledAt sql.NullTime
+	var cancelledAt, recurrenceID sql.NullTime
+	var seriesID, conflictID uuid.NullUUID
 	err := row.Scan(
 		&a.ID, &a.TenantID, &a.PatientID, &a.TherapistID, &a.Type, &a.Status,
 		&a.StartsAt, &a.EndsAt, &meeting, &location, &notes, &a.ReminderSent,
 		&createdBy, &cancelledAt, &cancelReason, &a.CreatedAt, &a.UpdatedAt,
+		&seriesID, &recurrenceID, &a.IsException, &conflict, &conflictID,
 	)
 	if err != nil {
 		return a, err
@@ -366,6 +434,19 @@ func scanAppointmentRow(row *sql.Row) (models.Appointment, error) {
 		t := cancelledAt.Time
 		a.CancelledAt = &t
 	}
+	if seriesID.Valid {
+		id := seriesID.UUID
+		a.SeriesID = &id
+	}
+	if recurrenceID.Valid {
+		t := recurrenceID.Time
+		a.RecurrenceID = &t
+	}
+	a.ScheduleConflict = conflict.String
+	if conflictID.Valid {
+		id := conflictID.UUID
+		a.ScheduleConflictID = &id
+	}
 	return a, nil
 }
 
@@ -2,15 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/AnshRaj112/serenify-backend/pkg/clientip"
 )
 
 type refreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// RefreshTokenV2 rotates a refresh token. The response carries a new refresh token; the one
+// presented stops working, and presenting it again revokes the whole sign-in.
 func RefreshTokenV2(w http.ResponseWriter, r *http.Request) {
 	var req refreshRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
@@ -19,9 +24,43 @@ func RefreshTokenV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pair, err := services.RefreshAccessToken(req.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		database.TriggerAuditEvent("REFRESH_TOKEN_REUSE", "REFRESH_TOKEN", "unknown", "unknown", "Rotated refresh token presented again; token family revoked", r)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
 		return
 	}
+	services.TouchTokenFamilySession(pair.FamilyID, clientip.RealClientIP(r))
 	writeJSON(w, http.StatusOK, pair)
 }
+
+// LogoutV2 revokes the bearer access token and its refresh family immediately. The refresh token
+// may be sent in the body when the access token has already expired.
+func LogoutV2(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	token := extractBearerToken(r.Header.Get("Authorization"))
+	if token == "" && req.RefreshToken == "" {
+		http.Error(w, "access or refresh token is required", http.StatusBadRequest)
+		return
+	}
+	if err := services.Logout(token, req.RefreshToken); err != nil {
+		http.Error(w, "Failed to sign out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes the access token verification keys for other services.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, services.JWKS())
+}
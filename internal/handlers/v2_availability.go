@@ -19,12 +19,13 @@ type availabilityRequest struct {
 	StartTime       string `json:"start_time"`
 	EndTime         string `json:"end_time"`
 	SlotDurationMin int    `json:"slot_duration_min,omitempty"`
+	BufferMin       int    `json:"buffer_min,omitempty"`
 	IsActive        *bool  `json:"is_active,omitempty"`
 }
 
 func ListAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	tid := therapistID
 	if v := r.URL.Query().Get("therapist_id"); v != "" {
@@ -35,7 +36,7 @@ func ListAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := database.PostgresDB.Query(`
 		SELECT id, tenant_id, therapist_id, day_of_week, start_time::text, end_time::text,
-			slot_duration_min, is_active
+			slot_duration_min, buffer_min, is_active
 		FROM availability_slots
 		WHERE tenant_id = $1 AND therapist_id = $2
 		ORDER BY day_of_week, start_time
@@ -50,7 +51,7 @@ func ListAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var s models.AvailabilitySlot
 		if err := rows.Scan(&s.ID, &s.TenantID, &s.TherapistID, &s.DayOfWeek,
-			&s.StartTime, &s.EndTime, &s.SlotDurationMin, &s.IsActive); err != nil {
+			&s.StartTime, &s.EndTime, &s.SlotDurationMin, &s.BufferMin, &s.IsActive); err != nil {
 			http.Error(w, "Failed to read availability", http.StatusInternalServerError)
 			return
 		}
@@ -61,7 +62,7 @@ func ListAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 
 func CreateAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req availabilityRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -72,6 +73,14 @@ func CreateAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "day_of_week must be 0-6", http.StatusBadRequest)
 		return
 	}
+	if err := services.ValidateClockRange(req.StartTime, req.EndTime); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BufferMin < 0 {
+		http.Error(w, "buffer_min must not be negative", http.StatusBadRequest)
+		return
+	}
 
 	tid := therapistID
 	if req.TherapistID != "" {
@@ -79,6 +88,10 @@ func CreateAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 			tid = parsed
 		}
 	}
+	if !canManagePractitioner(r, tid) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
 
 	dur := req.SlotDurationMin
 	if dur <= 0 {
@@ -87,10 +100,10 @@ func CreateAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 
 	var id uuid.UUID
 	err := database.PostgresDB.QueryRow(`
-		INSERT INTO availability_slots (tenant_id, therapist_id, day_of_week, start_time, end_time, slot_duration_min)
-		VALUES ($1, $2, $3, $4::time, $5::time, $6)
+		INSERT INTO availability_slots (tenant_id, therapist_id, day_of_week, start_time, end_time, slot_duration_min, buffer_min)
+		VALUES ($1, $2, $3, $4::time, $5::time, $6, $7)
 		RETURNING id
-	`, tenantID, tid, req.DayOfWeek, req.StartTime, req.EndTime, dur).Scan(&id)
+	`, tenantID, tid, req.DayOfWeek, req.StartTime, req.EndTime, dur, req.BufferMin).Scan(&id)
 	if err != nil {
 		http.Error(w, "Failed to create availability slot", http.StatusBadRequest)
 		return
@@ -107,7 +120,16 @@ func DeleteAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid slot ID", http.StatusBadRequest)
 		return
 	}
-	_, err := database.PostgresDB.Exec(`
+	slot, err := getAvailabilitySlot(tenantID, slotID)
+	if err != nil {
+		http.Error(w, "Slot not found", http.StatusNotFound)
+		return
+	}
+	if !canManagePractitioner(r, slot.TherapistID) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
+	_, err = database.PostgresDB.Exec(`
 		DELETE FROM availability_slots WHERE id = $1 AND tenant_id = $2
 	`, slotID, tenantID)
 	if err != nil {
@@ -119,50 +141,63 @@ func DeleteAvailabilityV2(w http.ResponseWriter, r *http.Request) {
 
 func GetOpenSlotsV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	dateStr := r.URL.Query().Get("date")
 	if dateStr == "" {
 		dateStr = time.Now().Format("2006-01-02")
 	}
-	day, err := time.Parse("2006-01-02", dateStr)
+	day, err := time.ParseInLocation("2006-01-02", dateStr, services.TenantLocation(tenantID))
 	if err != nil {
 		http.Error(w, "Invalid date", http.StatusBadRequest)
 		return
 	}
+	if v := r.URL.Query().Get("therapist_id"); v != "" {
+		if parsed, err := uuid.Parse(v); err == nil && services.TherapistInTenant(tenantID, parsed) {
+			therapistID = parsed
+		}
+	}
 
-	rows, err := database.PostgresDB.Query(`
-		SELECT start_time::text, end_time::text, slot_duration_min
-		FROM availability_slots
-		WHERE tenant_id = $1 AND therapist_id = $2 AND day_of_week = $3 AND is_active = TRUE
-	`, tenantID, therapistID, int(day.Weekday()))
+	open, err := services.OpenSlots(tenantID, therapistID, day)
 	if err != nil {
 		http.Error(w, "Failed to load availability", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": clockSlots(open), "date": dateStr})
+}
 
-	type slot struct {
-		Start string `json:"start"`
-		End   string `json:"end"`
-	}
-	open := make([]slot, 0)
-	for rows.Next() {
-		var start, end string
-		var dur int
-		_ = rows.Scan(&start, &end, &dur)
-		open = append(open, slot{Start: start, End: end})
+type clockSlot struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// clockSlots formats open sessions as local wall clock times, as the slot endpoints return them.
+func clockSlots(open []services.TimeRange) []clockSlot {
+	slots := make([]clockSlot, 0, len(open))
+	for _, s := range open {
+		slots = append(slots, clockSlot{Start: services.FormatTimeOnly(s.Start), End: services.FormatTimeOnly(s.End)})
 	}
-	writeJSON(w, http.StatusOK, map[string]interface{}{"data": open, "date": dateStr})
+	return slots
 }
 
 func getAvailabilitySlot(tenantID, id uuid.UUID) (models.AvailabilitySlot, error) {
 	var s models.AvailabilitySlot
 	err := database.PostgresDB.QueryRow(`
 		SELECT id, tenant_id, therapist_id, day_of_week, start_time::text, end_time::text,
-			slot_duration_min, is_active
+			slot_duration_min, buffer_min, is_active
 		FROM availability_slots WHERE id = $1 AND tenant_id = $2
 	`, id, tenantID).Scan(&s.ID, &s.TenantID, &s.TherapistID, &s.DayOfWeek,
-		&s.StartTime, &s.EndTime, &s.SlotDurationMin, &s.IsActive)
+		&s.StartTime, &s.EndTime, &s.SlotDurationMin, &s.BufferMin, &s.IsActive)
 	return s, err
 }
+
+// canManagePractitioner reports whether the caller may change another practitioner's calendar
+// settings. Practitioners manage their own; tenant admins and front-desk staff manage anyone's.
+func canManagePractitioner(r *http.Request, therapistID uuid.UUID) bool {
+	role, isMember := middleware.MemberRoleFromCtx(r.Context())
+	if !isMember || services.IsTenantAdminRole(role) {
+		return true
+	}
+	self, _ := middleware.TherapistIDFromCtx(r.Context())
+	return self == therapistID
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxICalBody bounds holiday calendar uploads.
+const maxICalBody = 1 << 20
+
+type timeOffRequest struct {
+	TherapistID string `json:"therapist_id,omitempty"`
+	StartsAt    string `json:"starts_at,omitempty"`
+	EndsAt      string `json:"ends_at,omitempty"`
+	StartDate   string `json:"start_date,omitempty"`
+	EndDate     string `json:"end_date,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type overrideRequest struct {
+	TherapistID     string `json:"therapist_id,omitempty"`
+	Date            string `json:"date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	SlotDurationMin int    `json:"slot_duration_min,omitempty"`
+	BufferMin       int    `json:"buffer_min,omitempty"`
+}
+
+// practitionerParam resolves the therapist_id a request names within the tenant, defaulting to
+// the caller.
+func practitionerParam(r *http.Request, tenantID uuid.UUID, v string) uuid.UUID {
+	tid, _ := middleware.ScheduleTherapistFromCtx(r.Context())
+	if v != "" {
+		if parsed, err := uuid.Parse(v); err == nil && services.TherapistInTenant(tenantID, parsed) {
+			tid = parsed
+		}
+	}
+	return tid
+}
+
+// dateRangeParams reads from and to (YYYY-MM-DD), defaulting to the next 90 days.
+func dateRangeParams(r *http.Request, loc *time.Location) (time.Time, time.Time, bool) {
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 90)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return from, to, false
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return from, to, false
+		}
+		to = t
+	}
+	return from, to, !to.Before(from)
+}
+
+// ListTimeOffV2 lists a practitioner's time off between from and to.
+func ListTimeOffV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	tid := practitionerParam(r, tenantID, r.URL.Query().Get("therapist_id"))
+	from, to, ok := dateRangeParams(r, services.TenantLocation(tenantID))
+	if !ok {
+		http.Error(w, "Invalid from/to (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	list, err := services.ListTimeOff(tenantID, tid, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		http.Error(w, "Failed to list time off", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+// CreateTimeOffV2 blocks a practitioner's calendar, either between starts_at and ends_at
+// (RFC3339) or for whole days from start_date to end_date inclusive. Appointments already
+// booked inside it are flagged and returned as conflicts.
+func CreateTimeOffV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req timeOffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tid := practitionerParam(r, tenantID, req.TherapistID)
+	if !canManagePractitioner(r, tid) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
+
+	t := models.AvailabilityTimeOff{TenantID: tenantID, TherapistID: tid, Reason: req.Reason}
+	var err error
+	if req.StartDate != "" {
+		loc := services.TenantLocation(tenantID)
+		if req.EndDate == "" {
+			req.EndDate = req.StartDate
+		}
+		t.StartsAt, err = time.ParseInLocation("2006-01-02", req.StartDate, loc)
+		if err == nil {
+			t.EndsAt, err = time.ParseInLocation("2006-01-02", req.EndDate, loc)
+			t.EndsAt = t.EndsAt.AddDate(0, 0, 1)
+		}
+		if err != nil {
+			http.Error(w, "Invalid start_date/end_date (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	} else {
+		t.StartsAt, err = services.ParseRFC3339(req.StartsAt)
+		if err == nil {
+			t.EndsAt, err = services.ParseRFC3339(req.EndsAt)
+		}
+		if err != nil {
+			http.Error(w, "Give starts_at and ends_at (RFC3339) or start_date and end_date", http.StatusBadRequest)
+			return
+		}
+	}
+	actorID := staffActorID(r)
+	if id, err := uuid.Parse(actorID); err == nil {
+		t.CreatedBy = &id
+	}
+
+	created, conflicts, err := services.CreateTimeOff(t)
+	if errors.Is(err, services.ErrTimeOffRange) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create time off", http.StatusInternalServerError)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TIME_OFF_CREATED", "availability_time_off", created.ID.String(), actorID)
+	self, _ := middleware.TherapistIDFromCtx(r.Context())
+	services.NotifyScheduleConflicts(conflicts, self, "your new time off")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": created, "conflicts": conflicts})
+}
+
+// DeleteTimeOffV2 removes time off and clears the conflict flags it set.
+func DeleteTimeOffV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "timeOffId"))
+	if err != nil {
+		http.Error(w, "Invalid time off ID", http.StatusBadRequest)
+		return
+	}
+	t, err := services.GetTimeOff(tenantID, id)
+	if errors.Is(err, services.ErrTimeOffNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load time off", http.StatusInternalServerError)
+		return
+	}
+	if !canManagePractitioner(r, t.TherapistID) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
+	if err := services.DeleteTimeOff(tenantID, id); err != nil && !errors.Is(err, services.ErrTimeOffNotFound) {
+		http.Error(w, "Failed to delete time off", http.StatusInternalServerError)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "TIME_OFF_DELETED", "availability_time_off", id.String(), staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAvailabilityOverridesV2 lists a practitioner's date overrides between from and to.
+func ListAvailabilityOverridesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	tid := practitionerParam(r, tenantID, r.URL.Query().Get("therapist_id"))
+	from, to, ok := dateRangeParams(r, services.TenantLocation(tenantID))
+	if !ok {
+		http.Error(w, "Invalid from/to (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	list, err := services.ListAvailabilityOverrides(tenantID, tid, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, "Failed to list availability overrides", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+// CreateAvailabilityOverrideV2 opens extra hours on one date, in addition to the weekly hours.
+// Overrides also apply on practice holidays.
+func CreateAvailabilityOverrideV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req overrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tid := practitionerParam(r, tenantID, req.TherapistID)
+	if !canManagePractitioner(r, tid) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
+	if req.BufferMin < 0 {
+		http.Error(w, "buffer_min must not be negative", http.StatusBadRequest)
+		return
+	}
+	o, err := services.CreateAvailabilityOverride(models.AvailabilityOverride{
+		TenantID:        tenantID,
+		TherapistID:     tid,
+		Date:            req.Date,
+		StartTime:       req.StartTime,
+		EndTime:         req.EndTime,
+		SlotDurationMin: req.SlotDurationMin,
+		BufferMin:       req.BufferMin,
+	})
+	if err != nil {
+		http.Error(w, "Invalid availability override: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "AVAILABILITY_OVERRIDE_CREATED", "availability_override", o.ID.String(), staffActorID(r))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": o})
+}
+
+func DeleteAvailabilityOverrideV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "overrideId"))
+	if err != nil {
+		http.Error(w, "Invalid override ID", http.StatusBadRequest)
+		return
+	}
+	tid, err := services.AvailabilityOverrideTherapist(tenantID, id)
+	if errors.Is(err, services.ErrOverrideNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load availability override", http.StatusInternalServerError)
+		return
+	}
+	if !canManagePractitioner(r, tid) {
+		http.Error(w, "You can only edit your own availability", http.StatusForbidden)
+		return
+	}
+	if err := services.DeleteAvailabilityOverride(tenantID, id); err != nil && !errors.Is(err, services.ErrOverrideNotFound) {
+		http.Error(w, "Failed to delete availability override", http.StatusInternalServerError)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "AVAILABILITY_OVERRIDE_DELETED", "availability_override", id.String(), staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListHolidaysV2 lists the practice's holidays between from and to.
+func ListHolidaysV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	from, to, ok := dateRangeParams(r, services.TenantLocation(tenantID))
+	if !ok {
+		http.Error(w, "Invalid from/to (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	list, err := services.ListTenantHolidays(tenantID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, "Failed to list holidays", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+// CreateHolidayV2 closes the practice on a date. Appointments already booked that day are
+// flagged and returned as conflicts.
+func CreateHolidayV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	addHolidays(w, r, tenantID, []models.TenantHoliday{{Date: req.Date, Name: req.Name, Source: "manual"}})
+}
+
+// ImportHolidaysV2 adds every event of an uploaded iCalendar file (text/calendar body) as a
+// practice holiday. Dates already on the calendar under the same name are skipped.
+func ImportHolidaysV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	loc := services.TenantLocation(tenantID)
+	events, err := services.ParseICalEvents(io.LimitReader(r.Body, maxICalBody), loc)
+	if err != nil {
+		http.Error(w, "Invalid iCalendar file", http.StatusBadRequest)
+		return
+	}
+	holidays, err := services.HolidaysFromICal(events, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addHolidays(w, r, tenantID, holidays)
+}
+
+func addHolidays(w http.ResponseWriter, r *http.Request, tenantID uuid.UUID, holidays []models.TenantHoliday) {
+	added, conflicts, err := services.AddTenantHolidays(tenantID, holidays)
+	if err != nil {
+		http.Error(w, "Failed to add holidays: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	actorID := staffActorID(r)
+	for _, h := range added {
+		services.AuditV2Tenant(r, tenantID, "HOLIDAY_CREATED", "tenant_holiday", h.ID.String(), actorID)
+	}
+	self, _ := middleware.TherapistIDFromCtx(r.Context())
+	services.NotifyScheduleConflicts(conflicts, self, "a practice holiday")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": added, "conflicts": conflicts})
+}
+
+// DeleteHolidayV2 reopens the date and clears the conflict flags the holiday set.
+func DeleteHolidayV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "holidayId"))
+	if err != nil {
+		http.Error(w, "Invalid holiday ID", http.StatusBadRequest)
+		return
+	}
+	err = services.DeleteTenantHoliday(tenantID, id)
+	if errors.Is(err, services.ErrHolidayNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete holiday", http.StatusInternalServerError)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "HOLIDAY_DELETED", "tenant_holiday", id.String(), staffActorID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
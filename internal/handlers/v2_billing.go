@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +30,12 @@ type billingProfileRequest struct {
 	SessionFeeChat     float64         `json:"session_fee_chat"`
 	SessionFeeVoice    float64         `json:"session_fee_voice"`
 	SessionFeeVideo    float64         `json:"session_fee_video"`
+	SACCode            string          `json:"sac_code,omitempty"`
+	BusinessAddress    string          `json:"business_address,omitempty"`
+	StateCode          string          `json:"state_code,omitempty"`
+	InvoiceNumberFormat string         `json:"invoice_number_format,omitempty"`
+	CreditNotePrefix   string          `json:"credit_note_prefix,omitempty"`
+	PaymentProvider    string          `json:"payment_provider,omitempty"`
 }
 
 type createInvoiceRequest struct {
@@ -36,6 +44,7 @@ type createInvoiceRequest struct {
 	LineItems     []models.InvoiceLineItem `json:"line_items,omitempty"`
 	Notes         string                  `json:"notes,omitempty"`
 	DueAt         string                  `json:"due_at,omitempty"`
+	PlaceOfSupply string                  `json:"place_of_supply,omitempty"`
 }
 
 type initiatePaymentRequest struct {
@@ -48,10 +57,27 @@ type collectPaymentRequest struct {
 	Amount    float64 `json:"amount"`
 }
 
+// paymentCallbackFields is the checkout result posted by the client. The razorpay_* names are
+// still accepted for clients built against Razorpay Checkout.
+type paymentCallbackFields struct {
+	OrderID           string `json:"order_id"`
+	PaymentID         string `json:"payment_id"`
+	Signature         string `json:"signature"`
+	RazorpayOrderID   string `json:"razorpay_order_id"`
+	RazorpayPaymentID string `json:"razorpay_payment_id"`
+	RazorpaySignature string `json:"razorpay_signature"`
+}
+
+func (f paymentCallbackFields) callback() services.PaymentCallback {
+	cb := services.PaymentCallback{OrderID: f.OrderID, PaymentID: f.PaymentID, Signature: f.Signature}
+	if cb.OrderID == "" {
+		cb = services.PaymentCallback{OrderID: f.RazorpayOrderID, PaymentID: f.RazorpayPaymentID, Signature: f.RazorpaySignature}
+	}
+	return cb
+}
+
 type verifyPaymentRequest struct {
-	OrderID   string `json:"razorpay_order_id"`
-	PaymentID string `json:"razorpay_payment_id"`
-	Signature string `json:"razorpay_signature"`
+	paymentCallbackFields
 	InvoiceID string `json:"invoice_id"`
 }
 
@@ -72,6 +98,20 @@ func UpdateBillingProfileV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid body", http.StatusBadRequest)
 		return
 	}
+	if _, ok := services.GetPaymentProvider(req.PaymentProvider); req.PaymentProvider != "" && !ok {
+		http.Error(w, fmt.Sprintf("payment_provider must be one of %v", services.PaymentProviderNames()), http.StatusBadRequest)
+		return
+	}
+	if _, ok := services.GSTStateNames[req.StateCode]; req.StateCode != "" && !ok {
+		http.Error(w, "Invalid state_code", http.StatusBadRequest)
+		return
+	}
+	if req.InvoiceNumberFormat != "" {
+		if err := services.ValidateInvoiceNumberFormat(req.InvoiceNumberFormat); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	_ = services.EnsureBillingProfile(tenantID)
 	_, err := database.PostgresDB.Exec(`
 		UPDATE billing_profiles SET
@@ -80,11 +120,18 @@ func UpdateBillingProfileV2(w http.ResponseWriter, r *http.Request) {
 			gst_number = $5, package_fees = $6,
 			session_fee_in_person = $7, session_fee_chat = $8,
 			session_fee_voice = $9, session_fee_video = $10,
+			sac_code = COALESCE(NULLIF($11,''), sac_code),
+			business_address = $12, state_code = $13,
+			invoice_number_format = COALESCE(NULLIF($14,''), invoice_number_format),
+			credit_note_prefix = COALESCE(NULLIF($15,''), credit_note_prefix),
+			payment_provider = COALESCE(NULLIF($16,''), payment_provider),
 			updated_at = NOW()
 		WHERE tenant_id = $1
 	`, tenantID, req.ConsultationFee, req.SessionFee,
 		req.InvoicePrefix, nullStr(req.GSTNumber), nullableJSON(req.PackageFees),
-		req.SessionFeeInPerson, req.SessionFeeChat, req.SessionFeeVoice, req.SessionFeeVideo)
+		req.SessionFeeInPerson, req.SessionFeeChat, req.SessionFeeVoice, req.SessionFeeVideo,
+		strings.TrimSpace(req.SACCode), nullStr(req.BusinessAddress), nullStr(req.StateCode),
+		req.InvoiceNumberFormat, strings.TrimSpace(req.CreditNotePrefix), req.PaymentProvider)
 	if err != nil {
 		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
@@ -129,11 +176,14 @@ func CreateInvoiceV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "line_items required", http.StatusBadRequest)
 		return
 	}
+	if _, ok := services.GSTStateNames[req.PlaceOfSupply]; req.PlaceOfSupply != "" && !ok {
+		http.Error(w, "Invalid place_of_supply", http.StatusBadRequest)
+		return
+	}
 
 	profile, _ := services.GetBillingProfile(tenantID)
 	subtotal := services.SumLineItems(items)
 	gst, total := services.CalcInvoiceTotals(subtotal, profile.GSTRate)
-	invNum, _ := services.NextInvoiceNumber(tenantID, profile.InvoicePrefix)
 
 	var dueAt *time.Time
 	if req.DueAt != "" {
@@ -149,19 +199,20 @@ func CreateInvoiceV2(w http.ResponseWriter, r *http.Request) {
 	var id uuid.UUID
 	err = database.PostgresDB.QueryRow(`
 		INSERT INTO invoices (
-			tenant_id, patient_id, invoice_number, appointment_id,
-			subtotal, gst_amount, total, currency, status, due_at, line_items, notes
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,'draft',$9,$10,$11)
+			tenant_id, patient_id, appointment_id,
+			subtotal, gst_amount, total, currency, status, due_at, line_items, notes, place_of_supply
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,'draft',$8,$9,$10,$11)
 		RETURNING id
-	`, tenantID, patientID, invNum, aptID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON, nullStr(req.Notes)).Scan(&id)
+	`, tenantID, patientID, aptID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON, nullStr(req.Notes),
+		nullStr(req.PlaceOfSupply)).Scan(&id)
 	if err != nil {
 		http.Error(w, "Failed to create invoice", http.StatusInternalServerError)
 		return
 	}
 
 	inv, _ := getInvoice(tenantID, id)
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
-	services.AuditV2Tenant(r, tenantID, "INVOICE_CREATED", "invoice", id.String(), therapistID.String())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	services.AuditV2Tenant(r, tenantID, "INVOICE_CREATED", "invoice", id.String(), actorID.String())
 	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": inv})
 }
 
@@ -191,11 +242,10 @@ func SendInvoiceV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
 		return
 	}
-	_, err := database.PostgresDB.Exec(`
-		UPDATE invoices SET status = 'sent', updated_at = NOW()
-		WHERE id = $1 AND tenant_id = $2 AND status = 'draft'
-	`, invID, tenantID)
-	if err != nil {
+	if _, err := services.IssueInvoice(tenantID, invID); err == sql.ErrNoRows {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to send invoice", http.StatusInternalServerError)
 		return
 	}
@@ -212,18 +262,14 @@ func VerifyPatientPaymentV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid body", http.StatusBadRequest)
 		return
 	}
-	if !services.VerifyRazorpayPaymentSignature(req.OrderID, req.PaymentID, req.Signature) {
-		http.Error(w, "Invalid signature", http.StatusBadRequest)
-		return
-	}
 	invID, _ := uuid.Parse(req.InvoiceID)
 	inv, err := getInvoice(tenantID, invID)
 	if err != nil || inv.PatientID != patientID {
 		http.Error(w, "Invoice not found", http.StatusNotFound)
 		return
 	}
-	if err := markInvoicePaid(invID, req.PaymentID, "razorpay"); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := confirmPayment(r.Context(), invID, req.callback()); err != nil {
+		writePaymentConfirmError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
@@ -242,23 +288,64 @@ func GenerateInvoicePDFV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var patientName, tenantName string
-	_ = database.PostgresDB.QueryRow(`SELECT full_name FROM patients WHERE id = $1`, inv.PatientID).Scan(&patientName)
-	_ = database.PostgresDB.QueryRow(`SELECT display_name FROM tenants WHERE id = $1`, tenantID).Scan(&tenantName)
-
-	if cloudinaryService == nil {
-		http.Error(w, "File storage not configured", http.StatusServiceUnavailable)
+	doc, err := buildInvoiceDocument(tenantID, inv)
+	if err != nil {
+		http.Error(w, "Failed to load invoice details", http.StatusInternalServerError)
 		return
 	}
-	url, err := services.UploadInvoicePDF(context.Background(), cloudinaryService, tenantID.String(), inv, patientName, tenantName)
+	pdf := services.RenderInvoicePDF(doc)
+	hash := doc.Hash()
+
+	// Storage is optional: ?store=true also uploads the PDF and records its URL.
+	if r.URL.Query().Get("store") == "true" {
+		if cloudinaryService == nil {
+			http.Error(w, "File storage not configured", http.StatusServiceUnavailable)
+			return
+		}
+		if inv.InvoiceNumber == "" {
+			http.Error(w, "Draft invoices cannot be stored; send the invoice first", http.StatusConflict)
+			return
+		}
+		url, err := services.UploadInvoicePDF(r.Context(), cloudinaryService, tenantID.String(), inv.InvoiceNumber, pdf)
+		if err != nil {
+			http.Error(w, "Failed to store PDF", http.StatusInternalServerError)
+			return
+		}
+		_, _ = database.PostgresDB.Exec(`UPDATE invoices SET pdf_url = $3, updated_at = NOW() WHERE id = $1 AND tenant_id = $2`,
+			invID, tenantID, url)
+		w.Header().Set("X-Invoice-PDF-URL", url)
+	}
+
+	filename := "draft-" + inv.ID.String() + ".pdf"
+	if inv.InvoiceNumber != "" {
+		filename = strings.ReplaceAll(inv.InvoiceNumber, "/", "-") + ".pdf"
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Header().Set("X-Document-Hash", hash)
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pdf)
+}
+
+// buildInvoiceDocument loads the seller and buyer details printed on an invoice.
+func buildInvoiceDocument(tenantID uuid.UUID, inv models.Invoice) (services.InvoiceDocument, error) {
+	profile, err := services.GetBillingProfile(tenantID)
 	if err != nil {
-		http.Error(w, "Failed to generate PDF", http.StatusInternalServerError)
-		return
+		return services.InvoiceDocument{}, err
 	}
-	_, _ = database.PostgresDB.Exec(`UPDATE invoices SET pdf_url = $3, updated_at = NOW() WHERE id = $1 AND tenant_id = $2`,
-		invID, tenantID, url)
-	inv.PDFURL = url
-	writeJSON(w, http.StatusOK, map[string]interface{}{"data": inv, "pdf_url": url})
+	var seller, buyer services.InvoiceParty
+	_ = database.PostgresDB.QueryRow(`SELECT display_name FROM tenants WHERE id = $1`, tenantID).Scan(&seller.Name)
+	var address, email, phone sql.NullString
+	err = database.PostgresDB.QueryRow(`
+		SELECT full_name, address, email, phone FROM patients WHERE id = $1 AND tenant_id = $2
+	`, inv.PatientID, tenantID).Scan(&buyer.Name, &address, &email, &phone)
+	if err != nil {
+		return services.InvoiceDocument{}, err
+	}
+	buyer.Address, buyer.Email, buyer.Phone = address.String, email.String, phone.String
+	return services.BuildInvoiceDocument(inv, profile, seller, buyer, services.TenantLocation(tenantID)), nil
 }
 
 func InitiatePaymentV2(w http.ResponseWriter, r *http.Request) {
@@ -273,7 +360,7 @@ func InitiatePaymentV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid invoice_id", http.StatusBadRequest)
 		return
 	}
-	resp, err := createPaymentOrder(tenantID, invID)
+	resp, err := createPaymentOrder(r.Context(), tenantID, invID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -287,13 +374,9 @@ func VerifyPaymentV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid body", http.StatusBadRequest)
 		return
 	}
-	if !services.VerifyRazorpayPaymentSignature(req.OrderID, req.PaymentID, req.Signature) {
-		http.Error(w, "Invalid signature", http.StatusBadRequest)
-		return
-	}
 	invID, _ := uuid.Parse(req.InvoiceID)
-	if err := markInvoicePaid(invID, req.PaymentID, "razorpay"); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := confirmPayment(r.Context(), invID, req.callback()); err != nil {
+		writePaymentConfirmError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
@@ -315,24 +398,56 @@ func ReceptionCollectPaymentV2(w http.ResponseWriter, r *http.Request) {
 	if provider == "" {
 		provider = "cash"
 	}
-	inv, err := getInvoice(tenantID, invID)
+	tx, err := database.PostgresDB.Begin()
 	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	// The invoice stays locked until the payment is recorded, so two desks can't both take the
+	// same balance.
+	var status string
+	var total, paid float64
+	err = tx.QueryRow(`
+		SELECT status, total, amount_paid FROM invoices WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+	`, invID, tenantID).Scan(&status, &total, &paid)
+	if err == sql.ErrNoRows {
 		http.Error(w, "Invoice not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+	if status == "paid" || status == "cancelled" || status == "refunded" {
+		http.Error(w, "Invoice is not payable", http.StatusConflict)
+		return
+	}
+	// Reception can collect in installments; without an amount the remaining balance is taken.
+	balanceDue := services.InvoiceBalanceDue(total, paid)
 	amount := req.Amount
 	if amount <= 0 {
-		amount = inv.Total
+		amount = balanceDue
 	}
-	_, _ = database.PostgresDB.Exec(`
+	if amount <= 0 || amount > balanceDue+0.005 {
+		http.Error(w, fmt.Sprintf("Amount must be between 0 and the balance due (%.2f)", balanceDue), http.StatusBadRequest)
+		return
+	}
+	_, err = tx.Exec(`
 		INSERT INTO payments (tenant_id, invoice_id, provider, amount, status)
 		VALUES ($1, $2, $3, $4, 'succeeded')
 	`, tenantID, invID, provider, amount)
-	_, _ = database.PostgresDB.Exec(`
-		UPDATE invoices SET status = 'paid', paid_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND tenant_id = $2
-	`, invID, tenantID)
-	inv, _ = getInvoice(tenantID, invID)
+	if err == nil {
+		err = settleInvoice(tx, tenantID, invID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+	inv, _ := getInvoice(tenantID, invID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": inv})
 }
 
@@ -355,7 +470,7 @@ func PayMyInvoiceV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invoice not found", http.StatusNotFound)
 		return
 	}
-	resp, err := createPaymentOrder(tenantID, invID)
+	resp, err := createPaymentOrder(r.Context(), tenantID, invID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -366,7 +481,7 @@ func PayMyInvoiceV2(w http.ResponseWriter, r *http.Request) {
 func ListPaymentsV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
 	rows, err := database.PostgresDB.Query(`
-		SELECT id, tenant_id, invoice_id, provider, external_id, amount, status, refunded_amount, created_at
+		SELECT id, tenant_id, invoice_id, provider, order_id, external_id, amount, status, refunded_amount, created_at
 		FROM payments WHERE tenant_id = $1 ORDER BY created_at DESC LIMIT 100
 	`, tenantID)
 	if err != nil {
@@ -377,44 +492,61 @@ func ListPaymentsV2(w http.ResponseWriter, r *http.Request) {
 	payments := make([]models.Payment, 0)
 	for rows.Next() {
 		var p models.Payment
-		var ext sql.NullString
-		_ = rows.Scan(&p.ID, &p.TenantID, &p.InvoiceID, &p.Provider, &ext, &p.Amount, &p.Status, &p.RefundedAmount, &p.CreatedAt)
-		p.ExternalID = ext.String
+		var order, ext sql.NullString
+		_ = rows.Scan(&p.ID, &p.TenantID, &p.InvoiceID, &p.Provider, &order, &ext, &p.Amount, &p.Status, &p.RefundedAmount, &p.CreatedAt)
+		p.OrderID, p.ExternalID = order.String, ext.String
 		payments = append(payments, p)
 	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": payments})
 }
 
-func createPaymentOrder(tenantID, invID uuid.UUID) (map[string]interface{}, error) {
-	if !services.RazorpayEnabled() {
-		return nil, errRazorpayNotConfigured
+func createPaymentOrder(ctx context.Context, tenantID, invID uuid.UUID) (map[string]interface{}, error) {
+	provider, err := services.TenantPaymentProvider(tenantID)
+	if err != nil {
+		return nil, errPaymentsNotConfigured
 	}
 	inv, err := getInvoice(tenantID, invID)
 	if err != nil {
 		return nil, err
 	}
-	if inv.Status == "paid" || inv.Status == "cancelled" {
+	if inv.Status == "paid" || inv.Status == "cancelled" || inv.Status == "refunded" || inv.BalanceDue <= 0 {
 		return nil, errInvoiceNotPayable
 	}
-	order, err := services.CreateRazorpayOrder(inv.Total, inv.Currency, inv.InvoiceNumber)
+	receipt := inv.InvoiceNumber
+	if receipt == "" {
+		receipt = inv.ID.String()
+	}
+	order, err := provider.CreateOrder(ctx, inv.BalanceDue, inv.Currency, receipt)
 	if err != nil {
 		return nil, err
 	}
 	_, _ = database.PostgresDB.Exec(`
-		INSERT INTO payments (tenant_id, invoice_id, provider, external_id, amount, status)
-		VALUES ($1, $2, 'razorpay', $3, $4, 'pending')
-	`, tenantID, invID, order.ID, inv.Total)
-	return map[string]interface{}{
+		INSERT INTO payments (tenant_id, invoice_id, provider, order_id, external_id, amount, status)
+		VALUES ($1, $2, $3, $4, $4, $5, 'pending')
+	`, tenantID, invID, order.Provider, order.ID, inv.BalanceDue)
+	return checkoutResponse(order, map[string]interface{}{"invoice_id": invID.String()}), nil
+}
+
+// checkoutResponse is the order plus the provider's checkout parameters (key_id for Razorpay,
+// client_secret for Stripe) for the client.
+func checkoutResponse(order services.PaymentOrder, extra map[string]interface{}) map[string]interface{} {
+	resp := map[string]interface{}{
+		"provider": order.Provider,
 		"order_id": order.ID,
 		"amount":   order.Amount,
 		"currency": order.Currency,
-		"key_id":   services.RazorpayKeyID(),
-		"invoice_id": invID.String(),
-	}, nil
+	}
+	for k, v := range order.Checkout {
+		resp[k] = v
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	return resp
 }
 
 var (
-	errRazorpayNotConfigured = &billingErr{"razorpay not configured"}
+	errPaymentsNotConfigured = &billingErr{"online payments not configured"}
 	errInvoiceNotPayable   = &billingErr{"invoice not payable"}
 )
 
@@ -422,33 +554,57 @@ type billingErr struct{ msg string }
 
 func (e *billingErr) Error() string { return e.msg }
 
-func markInvoicePaid(invID uuid.UUID, externalID, provider string) error {
-	var tenantID uuid.UUID
-	var total float64
-	err := database.PostgresDB.QueryRow(`
-		SELECT tenant_id, total FROM invoices WHERE id = $1
-	`, invID).Scan(&tenantID, &total)
+// confirmPayment verifies a checkout callback with the provider the order was created with and
+// records the payment through the payment state machine, so a webhook that already applied it
+// makes this a no-op.
+func confirmPayment(ctx context.Context, invID uuid.UUID, cb services.PaymentCallback) error {
+	provider, err := services.PaymentProviderForOrder(invID, cb.OrderID)
 	if err != nil {
 		return err
 	}
-	_, err = database.PostgresDB.Exec(`
-		UPDATE payments SET status = 'succeeded', external_id = COALESCE(NULLIF($3,''), external_id)
-		WHERE invoice_id = $1 AND tenant_id = $2 AND status = 'pending'
-	`, invID, tenantID, externalID)
+	paymentID, err := provider.VerifyCallback(ctx, cb)
+	if err != nil {
+		return &billingErr{err.Error()}
+	}
+	tx, err := database.PostgresDB.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = database.PostgresDB.Exec(`
-		UPDATE invoices SET status = 'paid', paid_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND tenant_id = $2
-	`, invID, tenantID)
-	return err
+	defer tx.Rollback()
+	_, err = services.ApplyPaymentUpdate(tx, services.PaymentUpdate{
+		Provider: provider.Name(), OrderID: cb.OrderID, PaymentID: paymentID,
+		Status: services.PaymentSucceeded, InvoiceID: invID,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func writePaymentConfirmError(w http.ResponseWriter, err error) {
+	var be *billingErr
+	switch {
+	case errors.As(err, &be):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrPaymentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrPaymentProviderUnavailable):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+	}
+}
+
+// settleInvoice numbers the invoice if it was still a draft and updates what has been paid.
+func settleInvoice(tx *sql.Tx, tenantID, invID uuid.UUID) error {
+	return services.SettleInvoicePayments(tx, tenantID, invID)
 }
 
 func listInvoices(w http.ResponseWriter, tenantID uuid.UUID, patientID, status string) {
 	query := `
 		SELECT id, tenant_id, patient_id, invoice_number, appointment_id,
-			subtotal, gst_amount, total, currency, status, due_at, paid_at, pdf_url, line_items, notes, created_at, updated_at
+			subtotal, gst_amount, total, currency, status, issued_at, due_at, paid_at, pdf_url, line_items, notes,
+			place_of_supply, amount_paid, amount_refunded, created_at, updated_at
 		FROM invoices WHERE tenant_id = $1
 	`
 	args := []interface{}{tenantID}
@@ -485,7 +641,8 @@ func listInvoices(w http.ResponseWriter, tenantID uuid.UUID, patientID, status s
 func getInvoice(tenantID, id uuid.UUID) (models.Invoice, error) {
 	row := database.PostgresDB.QueryRow(`
 		SELECT id, tenant_id, patient_id, invoice_number, appointment_id,
-			subtotal, gst_amount, total, currency, status, due_at, paid_at, pdf_url, line_items, notes, created_at, updated_at
+			subtotal, gst_amount, total, currency, status, issued_at, due_at, paid_at, pdf_url, line_items, notes,
+			place_of_supply, amount_paid, amount_refunded, created_at, updated_at
 		FROM invoices WHERE id = $1 AND tenant_id = $2
 	`, id, tenantID)
 	return scanInvoiceRow(row)
@@ -494,12 +651,13 @@ func getInvoice(tenantID, id uuid.UUID) (models.Invoice, error) {
 func scanInvoice(rows *sql.Rows) (models.Invoice, error) {
 	var inv models.Invoice
 	var aptID sql.NullString
-	var due, paid sql.NullTime
-	var pdf, notes sql.NullString
+	var issued, due, paid sql.NullTime
+	var number, pdf, notes, pos sql.NullString
 	var lineJSON []byte
-	err := rows.Scan(&inv.ID, &inv.TenantID, &inv.PatientID, &inv.InvoiceNumber, &aptID,
+	err := rows.Scan(&inv.ID, &inv.TenantID, &inv.PatientID, &number, &aptID,
 		&inv.Subtotal, &inv.GSTAmount, &inv.Total, &inv.Currency, &inv.Status,
-		&due, &paid, &pdf, &lineJSON, &notes, &inv.CreatedAt, &inv.UpdatedAt)
+		&issued, &due, &paid, &pdf, &lineJSON, &notes, &pos, &inv.AmountPaid, &inv.AmountRefunded,
+		&inv.CreatedAt, &inv.UpdatedAt)
 	if err != nil {
 		return inv, err
 	}
@@ -507,6 +665,11 @@ func scanInvoice(rows *sql.Rows) (models.Invoice, error) {
 		id := uuid.MustParse(aptID.String)
 		inv.AppointmentID = &id
 	}
+	inv.InvoiceNumber = number.String
+	if issued.Valid {
+		t := issued.Time
+		inv.IssuedAt = &t
+	}
 	if due.Valid {
 		t := due.Time
 		inv.DueAt = &t
@@ -517,6 +680,8 @@ func scanInvoice(rows *sql.Rows) (models.Invoice, error) {
 	}
 	inv.PDFURL = pdf.String
 	inv.Notes = notes.String
+	inv.PlaceOfSupply = pos.String
+	inv.BalanceDue = services.InvoiceBalanceDue(inv.Total, inv.AmountPaid)
 	_ = json.Unmarshal(lineJSON, &inv.LineItems)
 	return inv, nil
 }
@@ -524,12 +689,13 @@ func scanInvoice(rows *sql.Rows) (models.Invoice, error) {
 func scanInvoiceRow(row *sql.Row) (models.Invoice, error) {
 	var inv models.Invoice
 	var aptID sql.NullString
-	var due, paid sql.NullTime
-	var pdf, notes sql.NullString
+	var issued, due, paid sql.NullTime
+	var number, pdf, notes, pos sql.NullString
 	var lineJSON []byte
-	err := row.Scan(&inv.ID, &inv.TenantID, &inv.PatientID, &inv.InvoiceNumber, &aptID,
+	err := row.Scan(&inv.ID, &inv.TenantID, &inv.PatientID, &number, &aptID,
 		&inv.Subtotal, &inv.GSTAmount, &inv.Total, &inv.Currency, &inv.Status,
-		&due, &paid, &pdf, &lineJSON, &notes, &inv.CreatedAt, &inv.UpdatedAt)
+		&issued, &due, &paid, &pdf, &lineJSON, &notes, &pos, &inv.AmountPaid, &inv.AmountRefunded,
+		&inv.CreatedAt, &inv.UpdatedAt)
 	if err != nil {
 		return inv, err
 	}
@@ -537,6 +703,11 @@ func scanInvoiceRow(row *sql.Row) (models.Invoice, error) {
 		id := uuid.MustParse(aptID.String)
 		inv.AppointmentID = &id
 	}
+	inv.InvoiceNumber = number.String
+	if issued.Valid {
+		t := issued.Time
+		inv.IssuedAt = &t
+	}
 	if due.Valid {
 		t := due.Time
 		inv.DueAt = &t
@@ -547,6 +718,8 @@ func scanInvoiceRow(row *sql.Row) (models.Invoice, error) {
 	}
 	inv.PDFURL = pdf.String
 	inv.Notes = notes.String
+	inv.PlaceOfSupply = pos.String
+	inv.BalanceDue = services.InvoiceBalanceDue(inv.Total, inv.AmountPaid)
 	_ = json.Unmarshal(lineJSON, &inv.LineItems)
 	return inv, nil
 }
@@ -1,59 +1,53 @@
 package handlers
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 
-	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/AnshRaj112/serenify-backend/internal/services"
-	"github.com/google/uuid"
+	"github.com/go-chi/chi/v5"
 )
 
-func RazorpayWebhookV2(w http.ResponseWriter, r *http.Request) {
+// PaymentWebhookV2 receives webhooks at /api/v1/webhooks/{provider} and records each delivery in
+// the payment event ledger before acting on it. Providers retry until they get a 2xx, so
+// redelivered events are acknowledged without being applied again, and processing errors return
+// 500 to get the event retried.
+func PaymentWebhookV2(w http.ResponseWriter, r *http.Request) {
+	provider, ok := services.GetPaymentProvider(chi.URLParam(r, "provider"))
+	if !ok {
+		http.Error(w, "Unknown payment provider", http.StatusNotFound)
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
-	sig := r.Header.Get("X-Razorpay-Signature")
-	if !services.VerifyRazorpayWebhook(body, sig) {
+	if !provider.VerifyWebhook(body, r.Header) {
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
 
-	var payload struct {
-		Event   string `json:"event"`
-		Payload struct {
-			Payment struct {
-				Entity struct {
-					ID      string `json:"id"`
-					OrderID string `json:"order_id"`
-					Status  string `json:"status"`
-				} `json:"entity"`
-			} `json:"payment"`
-		} `json:"payload"`
-	}
-	if err := json.Unmarshal(body, &payload); err != nil {
+	ev, err := provider.ParseWebhook(body, r.Header)
+	if err != nil {
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
-
-	if payload.Event == "payment.captured" || payload.Payload.Payment.Entity.Status == "captured" {
-		orderID := payload.Payload.Payment.Entity.OrderID
-		paymentID := payload.Payload.Payment.Entity.ID
-		var invID uuid.UUID
-		err := database.PostgresDB.QueryRow(`
-			SELECT invoice_id FROM payments WHERE external_id = $1 AND provider = 'razorpay' LIMIT 1
-		`, orderID).Scan(&invID)
-		if err == nil {
-			if err := markInvoicePaid(invID, paymentID, "razorpay"); err != nil {
-				log.Printf("webhook payment mark failed: %v", err)
-			}
-		}
+	ev, created, err := services.RecordPaymentEvent(ev)
+	if err != nil {
+		log.Printf("webhook event %s not recorded: %v", ev.EventID, err)
+		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+	if !created && (ev.Status == "processed" || ev.Status == "ignored") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "duplicate"})
+		return
+	}
+	if _, err := services.ProcessPaymentEvent(ev.ID); err != nil {
+		log.Printf("webhook event %s (%s %s) failed: %v", ev.EventID, ev.Provider, ev.EventType, err)
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
 }
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -21,23 +22,15 @@ type bookingInitiateRequest struct {
 	Type        string `json:"type"`
 	StartsAt    string `json:"starts_at"`
 	Notes       string `json:"notes,omitempty"`
+	UsePackage  bool   `json:"use_package,omitempty"`
 }
 
 type bookingVerifyRequest struct {
-	OrderID       string `json:"razorpay_order_id"`
-	PaymentID     string `json:"razorpay_payment_id"`
-	Signature     string `json:"razorpay_signature"`
+	paymentCallbackFields
 	InvoiceID     string `json:"invoice_id"`
 	AppointmentID string `json:"appointment_id"`
 }
 
-func parseTimeStr(s string) (time.Time, error) {
-	if len(s) == 5 {
-		return time.Parse("15:04", s)
-	}
-	return time.Parse("15:04:05", s)
-}
-
 func GetTherapistAvailabilityForPatientV2(w http.ResponseWriter, r *http.Request) {
 	_, ok := middleware.UserIDFromCtx(r.Context())
 	if !ok {
@@ -62,125 +55,19 @@ func GetTherapistAvailabilityForPatientV2(w http.ResponseWriter, r *http.Request
 		dateStr = time.Now().Format("2006-01-02")
 	}
 
-	timezoneStr := "Asia/Kolkata"
-	_ = database.PostgresDB.QueryRow(`SELECT timezone FROM tenants WHERE id = $1`, tenantID).Scan(&timezoneStr)
-	loc, _ := time.LoadLocation(timezoneStr)
-	if loc == nil {
-		loc = time.UTC
-	}
-
-	day, err := time.ParseInLocation("2006-01-02", dateStr, loc)
+	day, err := time.ParseInLocation("2006-01-02", dateStr, services.TenantLocation(tenantID))
 	if err != nil {
 		http.Error(w, "Invalid date format (use YYYY-MM-DD)", http.StatusBadRequest)
 		return
 	}
 
-	// 1. Fetch doctor's availability slots for this day of week
-	rows, err := database.PostgresDB.Query(`
-		SELECT start_time::text, end_time::text, slot_duration_min
-		FROM availability_slots
-		WHERE tenant_id = $1 AND therapist_id = $2 AND day_of_week = $3 AND is_active = TRUE
-	`, tenantID, therapistID, int(day.Weekday()))
+	// Weekly hours and date overrides, minus holidays, time off, bookings and Google Calendar
+	open, err := services.OpenSlots(tenantID, therapistID, day)
 	if err != nil {
 		http.Error(w, "Failed to load therapist availability slots", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type slot struct {
-		Start string `json:"start"`
-		End   string `json:"end"`
-	}
-	slots := make([]slot, 0)
-	for rows.Next() {
-		var start, end string
-		var dur int
-		_ = rows.Scan(&start, &end, &dur)
-		if dur <= 0 {
-			dur = 60
-		}
-
-		startTime, err1 := parseTimeStr(start)
-		endTime, err2 := parseTimeStr(end)
-		if err1 != nil || err2 != nil {
-			continue
-		}
-
-		for current := startTime; !current.Add(time.Duration(dur) * time.Minute).After(endTime); current = current.Add(time.Duration(dur) * time.Minute) {
-			slotStartStr := current.Format("15:04:05")
-			slotEndStr := current.Add(time.Duration(dur) * time.Minute).Format("15:04:05")
-			slots = append(slots, slot{Start: slotStartStr, End: slotEndStr})
-		}
-	}
-
-	// 2. Define day start and end times for queries
-	dayStart := day
-	dayEnd := day.Add(24 * time.Hour).Add(-1 * time.Second)
-
-	// 3. Fetch busy ranges from existing database bookings
-	bookingRows, err := database.PostgresDB.Query(`
-		SELECT starts_at, ends_at FROM appointments
-		WHERE therapist_id = $1 AND status NOT IN ('cancelled', 'no_show', 'pending_payment')
-		AND starts_at >= $2 AND starts_at <= $3
-	`, therapistID, dayStart, dayEnd)
-	
-	type busyRange struct {
-		Start time.Time
-		End   time.Time
-	}
-	var busyRanges []busyRange
-	if err == nil {
-		defer bookingRows.Close()
-		for bookingRows.Next() {
-			var bs, be time.Time
-			if err := bookingRows.Scan(&bs, &be); err == nil {
-				busyRanges = append(busyRanges, busyRange{Start: bs, End: be})
-			}
-		}
-	}
-
-	// 4. Fetch busy ranges from Google Calendar
-	gRanges, gErr := services.GetGoogleCalendarBusyTimes(tenantID, therapistID, dayStart, dayEnd)
-	if gErr == nil {
-		for _, gr := range gRanges {
-			busyRanges = append(busyRanges, busyRange{Start: gr.Start, End: gr.End})
-		}
-	}
-
-	// 5. Check which slots are free
-	freeSlots := make([]slot, 0)
-	for _, s := range slots {
-		// Construct absolute time for slot start/end in UTC/Z format
-		sStartStr := dateStr + "T" + s.Start
-		if len(s.Start) == 5 {
-			sStartStr += ":00"
-		}
-		sEndStr := dateStr + "T" + s.End
-		if len(s.End) == 5 {
-			sEndStr += ":00"
-		}
-		
-		// Parse in the therapist's local timezone
-		slotStart, err1 := time.ParseInLocation("2006-01-02T15:04:05", sStartStr, loc)
-		slotEnd, err2 := time.ParseInLocation("2006-01-02T15:04:05", sEndStr, loc)
-		if err1 != nil || err2 != nil {
-			continue
-		}
-
-		overlap := false
-		for _, busy := range busyRanges {
-			// standard overlap check: startA < endB and endA > startB
-			if slotStart.Before(busy.End) && slotEnd.After(busy.Start) {
-				overlap = true
-				break
-			}
-		}
-		if !overlap {
-			freeSlots = append(freeSlots, s)
-		}
-	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{"data": freeSlots, "date": dateStr})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": clockSlots(open), "date": dateStr})
 }
 
 func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
@@ -214,31 +101,17 @@ func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	timezoneStr := "Asia/Kolkata"
-	_ = database.PostgresDB.QueryRow(`SELECT timezone FROM tenants WHERE id = $1`, tenantID).Scan(&timezoneStr)
-	loc, _ := time.LoadLocation(timezoneStr)
-	if loc == nil {
-		loc = time.UTC
+	// The start must be one of the open sessions, which also gives the session length
+	slot, open, err := services.FindOpenSlot(tenantID, therapistID, startsAt)
+	if err != nil {
+		http.Error(w, "Failed to check therapist availability", http.StatusInternalServerError)
+		return
 	}
-
-	startsAtLocal := startsAt.In(loc)
-	timeOnlyStr := startsAtLocal.Format("15:04:05")
-
-	// Resolve slot duration for this specific block from availability settings
-	slotDuration := 60 // default fallback
-	var dbSlotDur int
-	err = database.PostgresDB.QueryRow(`
-		SELECT slot_duration_min 
-		FROM availability_slots
-		WHERE tenant_id = $1 AND therapist_id = $2 AND day_of_week = $3 
-		AND start_time <= $4::time AND end_time >= $4::time AND is_active = TRUE
-		LIMIT 1
-	`, tenantID, therapistID, int(startsAtLocal.Weekday()), timeOnlyStr).Scan(&dbSlotDur)
-	if err == nil && dbSlotDur > 0 {
-		slotDuration = dbSlotDur
+	if !open {
+		http.Error(w, "This time slot is not available", http.StatusConflict)
+		return
 	}
-
-	endsAt := startsAt.Add(time.Duration(slotDuration) * time.Minute)
+	endsAt := slot.End
 
 	// Validate slot is not conflicted in DB
 	conflict, err := services.TherapistHasConflict(therapistID, startsAt, endsAt, nil)
@@ -247,17 +120,6 @@ func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate against Google Calendar busy times
-	gBusy, err := services.GetGoogleCalendarBusyTimes(tenantID, therapistID, startsAt.Add(-1*time.Minute), endsAt.Add(1*time.Minute))
-	if err == nil {
-		for _, busy := range gBusy {
-			if startsAt.Before(busy.End) && endsAt.After(busy.Start) {
-				http.Error(w, "This time slot conflicts with the therapist's Google Calendar", http.StatusConflict)
-				return
-			}
-		}
-	}
-
 	// Resolve the patient ID under the therapist's tenant
 	var patientID uuid.UUID
 	err = database.PostgresDB.QueryRow(`
@@ -299,12 +161,23 @@ func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Prepaid package credits replace the payment step
+	if req.UsePackage {
+		bookWithPackageCredit(w, tenantID, therapistID, patientID, userID, req, startsAt, endsAt)
+		return
+	}
+
 	// Resolve the fee configuration
 	profile, err := services.GetBillingProfile(tenantID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve therapist billing profile", http.StatusInternalServerError)
 		return
 	}
+	provider, err := services.TenantPaymentProvider(tenantID)
+	if err != nil {
+		http.Error(w, "Payment provider integration is disabled", http.StatusServiceUnavailable)
+		return
+	}
 
 	fee := 0.0
 	desc := ""
@@ -341,14 +214,39 @@ func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
 		fee = 1000.0 // ultimate fallback
 	}
 
+	// Hold the slot while the patient pays; the draft appointment and invoice are written with it
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create booking draft", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	hold, err := services.HoldSlot(tx, services.SlotHold{
+		TenantID: tenantID, TherapistID: therapistID, PatientID: patientID, StartsAt: startsAt, EndsAt: endsAt,
+	}, 0)
+	if err != nil {
+		writeSlotHoldError(w, err)
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			services.DropSlotReservation(hold)
+		}
+	}()
+
 	// Write draft appointment with status 'pending_payment'
 	var appointmentID uuid.UUID
-	err = database.PostgresDB.QueryRow(`
+	err = tx.QueryRow(`
 		INSERT INTO appointments (
 			tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at, notes
 		) VALUES ($1, $2, $3, $4, 'pending_payment', $5, $6, $7)
 		RETURNING id
 	`, tenantID, patientID, therapistID, req.Type, startsAt, endsAt, nullStr(req.Notes)).Scan(&appointmentID)
+	if err == nil {
+		err = services.AttachSlotHold(tx, hold.ID, appointmentID)
+	}
 	if err != nil {
 		http.Error(w, "Failed to create booking draft: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -357,54 +255,143 @@ func InitiateBookingV2(w http.ResponseWriter, r *http.Request) {
 	// Create draft invoice
 	subtotal := fee
 	gst, total := services.CalcInvoiceTotals(subtotal, profile.GSTRate)
-	invNum, _ := services.NextInvoiceNumber(tenantID, profile.InvoicePrefix)
 	dueAt := time.Now().AddDate(0, 0, 1)
 
 	lineItem := models.InvoiceLineItem{Description: desc, Amount: fee}
 	itemsJSON, _ := json.Marshal([]models.InvoiceLineItem{lineItem})
 
 	var invoiceID uuid.UUID
-	err = database.PostgresDB.QueryRow(`
+	err = tx.QueryRow(`
 		INSERT INTO invoices (
-			tenant_id, patient_id, invoice_number, appointment_id,
+			tenant_id, patient_id, appointment_id,
 			subtotal, gst_amount, total, currency, status, due_at, line_items, notes
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,'draft',$9,$10,$11)
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,'draft',$8,$9,$10)
 		RETURNING id
-	`, tenantID, patientID, invNum, appointmentID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON, "Direct booking fee payment").Scan(&invoiceID)
+	`, tenantID, patientID, appointmentID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON, "Direct booking fee payment").Scan(&invoiceID)
 	if err != nil {
 		http.Error(w, "Failed to generate draft invoice: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Generate Razorpay Order
-	if !services.RazorpayEnabled() {
-		http.Error(w, "Payment provider integration is disabled", http.StatusServiceUnavailable)
+	if err = tx.Commit(); err != nil {
+		http.Error(w, "Transaction commit failure", http.StatusInternalServerError)
 		return
 	}
+	committed = true
 
-	order, err := services.CreateRazorpayOrder(total, profile.Currency, invNum)
+	// The invoice is numbered once paid; until then the order receipt is the invoice ID.
+	order, err := provider.CreateOrder(r.Context(), total, profile.Currency, invoiceID.String())
 	if err != nil {
-		http.Error(w, "Razorpay order generation failed: "+err.Error(), http.StatusInternalServerError)
+		abandonHeldBooking(tenantID, appointmentID)
+		http.Error(w, "Payment order generation failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Record payment status
 	_, err = database.PostgresDB.Exec(`
-		INSERT INTO payments (tenant_id, invoice_id, provider, external_id, amount, status)
-		VALUES ($1, $2, 'razorpay', $3, $4, 'pending')
-	`, tenantID, invoiceID, order.ID, total)
+		INSERT INTO payments (tenant_id, invoice_id, provider, order_id, external_id, amount, status)
+		VALUES ($1, $2, $3, $4, $4, $5, 'pending')
+	`, tenantID, invoiceID, order.Provider, order.ID, total)
 	if err != nil {
 		http.Error(w, "Failed to record payment transaction details", http.StatusInternalServerError)
 		return
 	}
 
+	writeJSON(w, http.StatusOK, checkoutResponse(order, map[string]interface{}{
+		"invoice_id":      invoiceID.String(),
+		"appointment_id":  appointmentID.String(),
+		"hold_expires_at": hold.ExpiresAt,
+	}))
+}
+
+// abandonHeldBooking frees the slot of a booking whose payment could not be started.
+func abandonHeldBooking(tenantID, appointmentID uuid.UUID) {
+	_, _ = database.PostgresDB.Exec(`
+		UPDATE appointments SET status = 'cancelled', cancelled_at = NOW(), cancel_reason = 'Payment could not be started', updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND status = 'pending_payment'
+	`, appointmentID, tenantID)
+	_ = services.ReleaseSlotHold(appointmentID)
+}
+
+func writeSlotHoldError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrSlotHeld):
+		http.Error(w, "This time slot is being booked by another patient, please pick another", http.StatusConflict)
+	case errors.Is(err, services.ErrSlotTaken):
+		http.Error(w, "This time slot is already booked", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to reserve the time slot", http.StatusInternalServerError)
+	}
+}
+
+// bookWithPackageCredit schedules the appointment straight away against one of the patient's
+// package credits. The appointment holds the credit until it is completed, when it is used.
+func bookWithPackageCredit(w http.ResponseWriter, tenantID, therapistID, patientID, userID uuid.UUID,
+	req bookingInitiateRequest, startsAt, endsAt time.Time) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create booking", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	hold, err := services.HoldSlot(tx, services.SlotHold{
+		TenantID: tenantID, TherapistID: therapistID, PatientID: patientID, StartsAt: startsAt, EndsAt: endsAt,
+	}, 0)
+	if err != nil {
+		writeSlotHoldError(w, err)
+		return
+	}
+	// The hold is confirmed in this transaction, so its reservation is done with either way
+	defer services.DropSlotReservation(hold)
+
+	pkg, err := services.ReservePackageCredit(tx, tenantID, patientID, req.Type)
+	if errors.Is(err, services.ErrNoPackageCredit) {
+		http.Error(w, "No package credit available for this session type", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check package credits", http.StatusInternalServerError)
+		return
+	}
+
+	var appointmentID uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO appointments (
+			tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at, notes, patient_package_id
+		) VALUES ($1, $2, $3, $4, 'scheduled', $5, $6, $7, $8)
+		RETURNING id
+	`, tenantID, patientID, therapistID, req.Type, startsAt, endsAt, nullStr(req.Notes), pkg.ID).Scan(&appointmentID)
+	if err == nil {
+		err = services.AttachSlotHold(tx, hold.ID, appointmentID)
+	}
+	if err == nil {
+		_, err = services.ConfirmSlotHold(tx, appointmentID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to create booking", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(`
+		INSERT INTO therapist_user_connections (id, therapist_id, user_id, connected_at, connection_type)
+		VALUES (gen_random_uuid(), $1, $2, NOW(), 'booking')
+		ON CONFLICT (therapist_id, user_id) DO NOTHING
+	`, therapistID, userID)
+	if err != nil {
+		http.Error(w, "Failed to establish user connection link", http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		http.Error(w, "Transaction commit failure", http.StatusInternalServerError)
+		return
+	}
+
+	services.EnqueueCalendarSync("create", tenantID, appointmentID)
+	services.ScheduleAppointmentReminders(tenantID, appointmentID)
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"order_id":       order.ID,
-		"amount":         order.Amount,
-		"currency":       order.Currency,
-		"key_id":         services.RazorpayKeyID(),
-		"invoice_id":     invoiceID.String(),
-		"appointment_id": appointmentID.String(),
+		"appointment_id":     appointmentID.String(),
+		"patient_package_id": pkg.ID.String(),
+		"status":             "scheduled",
 	})
 }
 
@@ -421,12 +408,6 @@ func VerifyBookingPaymentV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Verify Payment signature
-	if !services.VerifyRazorpayPaymentSignature(req.OrderID, req.PaymentID, req.Signature) {
-		http.Error(w, "Invalid payment signature verification failed", http.StatusBadRequest)
-		return
-	}
-
 	aptID, err := uuid.Parse(req.AppointmentID)
 	if err != nil {
 		http.Error(w, "Invalid appointment ID", http.StatusBadRequest)
@@ -458,6 +439,19 @@ func VerifyBookingPaymentV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 1. Verify the payment with the provider the order was created with
+	cb := req.callback()
+	provider, err := services.PaymentProviderForOrder(invID, cb.OrderID)
+	if err != nil {
+		http.Error(w, "Payment not found for this booking", http.StatusNotFound)
+		return
+	}
+	paymentID, err := provider.VerifyCallback(r.Context(), cb)
+	if err != nil {
+		http.Error(w, "Invalid payment signature verification failed", http.StatusBadRequest)
+		return
+	}
+
 	// 2. Transact: mark invoice as paid, payment succeeded, appointment scheduled
 	tx, err := database.PostgresDB.Begin()
 	if err != nil {
@@ -466,21 +460,31 @@ func VerifyBookingPaymentV2(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
-		UPDATE payments SET status = 'succeeded', external_id = $3
-		WHERE invoice_id = $1 AND tenant_id = $2 AND status = 'pending'
-	`, invID, aptTenantID, req.PaymentID)
+	_, err = services.ApplyPaymentUpdate(tx, services.PaymentUpdate{
+		Provider: provider.Name(), OrderID: cb.OrderID, PaymentID: paymentID,
+		Status: services.PaymentSucceeded, InvoiceID: invID,
+	})
 	if err != nil {
-		http.Error(w, "Failed to update payment status", http.StatusInternalServerError)
+		http.Error(w, "Failed to mark invoice as paid", http.StatusInternalServerError)
 		return
 	}
 
-	_, err = tx.Exec(`
-		UPDATE invoices SET status = 'paid', paid_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND tenant_id = $2
-	`, invID, aptTenantID)
+	// A payment that completes after the slot hold lapsed is kept on record and refunded
+	hold, err := services.ConfirmSlotHold(tx, aptID)
+	if errors.Is(err, services.ErrSlotHoldExpired) {
+		if err = tx.Commit(); err != nil {
+			http.Error(w, "Transaction commit failure", http.StatusInternalServerError)
+			return
+		}
+		if _, err := services.RefundLateHoldPayment(r.Context(), hold.ID); err != nil {
+			http.Error(w, "Your slot reservation expired before payment completed; the payment will be refunded", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Your slot reservation expired before payment completed; the payment has been refunded", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to mark invoice as paid", http.StatusInternalServerError)
+		http.Error(w, "Failed to confirm the slot hold", http.StatusInternalServerError)
 		return
 	}
 
@@ -509,8 +513,11 @@ func VerifyBookingPaymentV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	services.DropSlotReservation(hold)
+
 	// 4. Trigger calendar synchronization
 	services.EnqueueCalendarSync("create", aptTenantID, aptID)
+	services.ScheduleAppointmentReminders(aptTenantID, aptID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
 }
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Break-glass routes are mounted behind middleware.BreakGlassActor and RequireStaffMFA; the
+// patient record itself is read through the usual V2 handlers behind BreakGlassScope.
+
+// StartBreakGlassV2 opens emergency access to a patient outside the caller's practices. The
+// justification is required; duration_minutes defaults to 60 and is capped at 240.
+func StartBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	actorID, role := breakGlassCaller(r)
+	var req struct {
+		PatientID       string `json:"patient_id"`
+		Justification   string `json:"justification"`
+		DurationMinutes int    `json:"duration_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	patientID, err := uuid.Parse(req.PatientID)
+	if err != nil {
+		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		return
+	}
+	grant, err := services.StartBreakGlass(services.BreakGlassRequest{
+		PatientID:     patientID,
+		GranteeID:     actorID,
+		GranteeRole:   role,
+		Justification: req.Justification,
+		Duration:      time.Duration(req.DurationMinutes) * time.Minute,
+	})
+	if err != nil {
+		writeBreakGlassError(w, err)
+		return
+	}
+	// The justification goes in the hash-chained audit log too; the grant row can be edited
+	services.AuditV2(r, "BREAK_GLASS_STARTED", patientID.String(), actorID.String(), role,
+		services.BreakGlassAuditDetails(grant, "expires_at="+grant.ExpiresAt.UTC().Format(time.RFC3339)+
+			" justification="+strconv.Quote(grant.Justification)))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": grant})
+}
+
+// ListMyBreakGlassV2 lists the caller's own grants, newest first, optionally filtered by status.
+func ListMyBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := breakGlassCaller(r)
+	f, ok := breakGlassFilter(w, r)
+	if !ok {
+		return
+	}
+	f.GranteeID = &actorID
+	grants, err := services.ListBreakGlassGrants(r.Context(), f)
+	if err != nil {
+		http.Error(w, "Failed to list break-glass access", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": grants})
+}
+
+// ReleaseBreakGlassV2 ends the caller's access before it expires.
+func ReleaseBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	actorID, role := breakGlassCaller(r)
+	grantID, err := uuid.Parse(chi.URLParam(r, "grantId"))
+	if err != nil {
+		http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+	grant, err := services.ReleaseBreakGlass(grantID, actorID)
+	if err != nil {
+		writeBreakGlassError(w, err)
+		return
+	}
+	services.AuditV2(r, "BREAK_GLASS_RELEASED", grant.PatientID.String(), actorID.String(), role,
+		services.BreakGlassAuditDetails(grant, ""))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": grant})
+}
+
+// ListTenantBreakGlassV2 shows the practice's owner and admins every emergency access to its
+// patients, filtered by status and patient_id.
+func ListTenantBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	f, ok := breakGlassFilter(w, r)
+	if !ok {
+		return
+	}
+	f.TenantID = &tenantID
+	grants, err := services.ListBreakGlassGrants(r.Context(), f)
+	if err != nil {
+		http.Error(w, "Failed to list break-glass access", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": grants})
+}
+
+// ApproveBreakGlassV2 is the second approver signing off on an emergency access.
+func ApproveBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	grantID, err := uuid.Parse(chi.URLParam(r, "grantId"))
+	if err != nil {
+		http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+	grant, err := services.ApproveBreakGlass(tenantID, grantID, therapistID)
+	if err != nil {
+		writeBreakGlassError(w, err)
+		return
+	}
+	services.AuditV2(r, "BREAK_GLASS_APPROVED", grant.PatientID.String(), therapistID.String(), "therapist",
+		services.BreakGlassAuditDetails(grant, ""))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": grant})
+}
+
+// RevokeBreakGlassV2 ends someone's emergency access to one of the practice's patients.
+func RevokeBreakGlassV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	grantID, err := uuid.Parse(chi.URLParam(r, "grantId"))
+	if err != nil {
+		http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+	grant, err := services.RevokeBreakGlass(tenantID, grantID, therapistID)
+	if err != nil {
+		writeBreakGlassError(w, err)
+		return
+	}
+	services.AuditV2(r, "BREAK_GLASS_REVOKED", grant.PatientID.String(), therapistID.String(), "therapist",
+		services.BreakGlassAuditDetails(grant, ""))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": grant})
+}
+
+// breakGlassCaller is the therapist or safety officer resolved by middleware.BreakGlassActor.
+func breakGlassCaller(r *http.Request) (uuid.UUID, string) {
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	role, _ := r.Context().Value(middleware.UserRoleKey).(string)
+	id, _ := uuid.Parse(actorID)
+	return id, role
+}
+
+// breakGlassFilter reads the status, patient_id and limit filters shared by the grant lists.
+func breakGlassFilter(w http.ResponseWriter, r *http.Request) (services.BreakGlassFilter, bool) {
+	q := r.URL.Query()
+	f := services.BreakGlassFilter{Status: q.Get("status")}
+	switch f.Status {
+	case "", services.BreakGlassActive, services.BreakGlassExpired, services.BreakGlassReleased, services.BreakGlassRevoked:
+	default:
+		http.Error(w, "status must be active, expired, released or revoked", http.StatusBadRequest)
+		return f, false
+	}
+	if s := q.Get("patient_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid patient_id", http.StatusBadRequest)
+			return f, false
+		}
+		f.PatientID = &id
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return f, false
+		}
+		f.Limit = n
+	}
+	return f, true
+}
+
+func writeBreakGlassError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrBreakGlassJustification), errors.Is(err, services.ErrBreakGlassDuration):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrPatientNotFound), errors.Is(err, services.ErrBreakGlassNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrBreakGlassMember), errors.Is(err, services.ErrBreakGlassSelfApproval):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrBreakGlassAlreadyActive), errors.Is(err, services.ErrBreakGlassInactive),
+		errors.Is(err, services.ErrBreakGlassApproved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrBreakGlassNoApprover):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, "Break-glass request failed", http.StatusInternalServerError)
+	}
+}
@@ -1,15 +1,32 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/AnshRaj112/serenify-backend/internal/middleware"
 	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/google/uuid"
 )
 
+// calendarOwner is the practitioner whose calendar a request connects. Receptionists have no
+// calendar of their own.
+func calendarOwner(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	therapistID, ok := middleware.TherapistIDFromCtx(r.Context())
+	if !ok || therapistID == uuid.Nil {
+		http.Error(w, "Only practitioners can connect a calendar", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return therapistID, true
+}
+
 func ConnectGoogleCalendarV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := calendarOwner(w, r)
+	if !ok {
+		return
+	}
 
 	url, err := services.GoogleAuthURL(tenantID, therapistID)
 	if err != nil {
@@ -34,10 +51,80 @@ func GoogleCalendarCallback(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("<html><body><h2>Google Calendar connected.</h2><p>You can close this window.</p></body></html>"))
 }
 
-func DisconnectGoogleCalendarV2(w http.ResponseWriter, r *http.Request) {
+func ConnectMicrosoftCalendarV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, ok := calendarOwner(w, r)
+	if !ok {
+		return
+	}
+
+	url, err := services.MicrosoftAuthURL(tenantID, therapistID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"auth_url": url})
+}
+
+func MicrosoftCalendarCallback(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	state := r.URL.Query().Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "Missing code or state", http.StatusBadRequest)
+		return
+	}
+	if err := services.HandleMicrosoftCallback(code, state); err != nil {
+		http.Error(w, "OAuth failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("<html><body><h2>Microsoft 365 Calendar connected.</h2><p>You can close this window.</p></body></html>"))
+}
+
+// ConnectCalDAVCalendarV2 connects a calendar on a CalDAV server (iCloud, Fastmail,
+// Nextcloud, ...) with an app password.
+func ConnectCalDAVCalendarV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
-	if err := services.DisconnectGoogleCalendar(tenantID, therapistID); err != nil {
+	therapistID, ok := calendarOwner(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ServerURL string `json:"server_url"`
+		Username  string `json:"username"`
+		Password  string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ServerURL == "" || req.Username == "" || req.Password == "" {
+		http.Error(w, "server_url, username and password are required", http.StatusBadRequest)
+		return
+	}
+	err := services.ConnectCalDAVCalendar(tenantID, therapistID, req.ServerURL, req.Username, req.Password)
+	switch {
+	case errors.Is(err, services.ErrCalDAVInvalidURL), errors.Is(err, services.ErrCalDAVNoCalendar):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrCalDAVUnauthorized):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Failed to connect to the CalDAV server", http.StatusBadGateway)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "CALENDAR_CONNECTED", "calendar_integration", therapistID.String(), therapistID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "provider": services.CalendarProviderCalDAV})
+}
+
+func DisconnectCalendarV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, ok := calendarOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := services.DisconnectCalendar(tenantID, therapistID); err != nil {
 		http.Error(w, "Failed to disconnect", http.StatusInternalServerError)
 		return
 	}
@@ -46,17 +133,39 @@ func DisconnectGoogleCalendarV2(w http.ResponseWriter, r *http.Request) {
 
 func CalendarStatusV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
-
-	connected := false
-	if services.GoogleCalendarEnabled() {
-		// lightweight check via integration row
-		type row struct{}
-		_ = tenantID
-		connected = services.HasCalendarIntegration(tenantID, therapistID)
+	therapistID, ok := calendarOwner(w, r)
+	if !ok {
+		return
 	}
+
+	provider := services.ConnectedCalendarProvider(tenantID, therapistID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"configured": services.GoogleCalendarEnabled(),
-		"connected":  connected,
+		"connected":  provider != "",
+		"provider":   provider,
+		"providers": map[string]bool{
+			services.CalendarProviderGoogle:    services.GoogleCalendarEnabled(),
+			services.CalendarProviderMicrosoft: services.MicrosoftCalendarEnabled(),
+			services.CalendarProviderCalDAV:    true,
+		},
 	})
 }
+
+// GoogleCalendarNotification receives Google Calendar push notifications. The body is empty;
+// the headers name the channel and carry the secret set when it was opened.
+func GoogleCalendarNotification(w http.ResponseWriter, r *http.Request) {
+	err := services.HandleGoogleCalendarNotification(
+		r.Header.Get("X-Goog-Channel-ID"),
+		r.Header.Get("X-Goog-Channel-Token"),
+		r.Header.Get("X-Goog-Resource-State"),
+	)
+	if errors.Is(err, services.ErrUnknownGoogleChannel) {
+		http.Error(w, "Unknown channel", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to process notification", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// therapistFeedOwner is the practitioner whose feed a tenant request manages. Receptionists
+// have no calendar of their own.
+func therapistFeedOwner(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	therapistID, ok := middleware.TherapistIDFromCtx(r.Context())
+	if !ok || therapistID == uuid.Nil {
+		http.Error(w, "Only practitioners have a calendar feed", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return therapistID, true
+}
+
+func patientFeedOwner(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	patientID, ok := middleware.PatientIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "No patient profile linked to this account", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return patientID, true
+}
+
+func writeCalendarFeed(w http.ResponseWriter, ownerRole string, ownerID uuid.UUID) {
+	feed, err := services.GetCalendarFeed(ownerRole, ownerID)
+	if errors.Is(err, services.ErrCalendarFeedNotFound) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": nil})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load calendar feed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": feed})
+}
+
+func GetMyTherapistCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	if therapistID, ok := therapistFeedOwner(w, r); ok {
+		writeCalendarFeed(w, services.CalendarFeedTherapist, therapistID)
+	}
+}
+
+// RotateMyTherapistCalendarFeedV2 issues a new feed URL; the previous one stops working.
+// The URL is only returned here.
+func RotateMyTherapistCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := therapistFeedOwner(w, r)
+	if !ok {
+		return
+	}
+	feed, err := services.RotateCalendarFeed(services.CalendarFeedTherapist, therapistID)
+	if err != nil {
+		http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	services.AuditV2Tenant(r, tenantID, "CALENDAR_FEED_ROTATED", "calendar_feed", feed.ID.String(), therapistID.String())
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": feed})
+}
+
+func RevokeMyTherapistCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	therapistID, ok := therapistFeedOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := services.RevokeCalendarFeed(services.CalendarFeedTherapist, therapistID); err != nil {
+		calendarFeedErr(w, err)
+		return
+	}
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	services.AuditV2Tenant(r, tenantID, "CALENDAR_FEED_REVOKED", "calendar_feed", therapistID.String(), therapistID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func GetMyPatientCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	if patientID, ok := patientFeedOwner(w, r); ok {
+		writeCalendarFeed(w, services.CalendarFeedPatient, patientID)
+	}
+}
+
+func RotateMyPatientCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	patientID, ok := patientFeedOwner(w, r)
+	if !ok {
+		return
+	}
+	feed, err := services.RotateCalendarFeed(services.CalendarFeedPatient, patientID)
+	if err != nil {
+		http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+	userID, _ := middleware.UserIDFromCtx(r.Context())
+	services.AuditV2(r, "CALENDAR_FEED_ROTATED", patientID.String(), userID.String(), "patient", "feed="+feed.ID.String())
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": feed})
+}
+
+func RevokeMyPatientCalendarFeedV2(w http.ResponseWriter, r *http.Request) {
+	patientID, ok := patientFeedOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := services.RevokeCalendarFeed(services.CalendarFeedPatient, patientID); err != nil {
+		calendarFeedErr(w, err)
+		return
+	}
+	userID, _ := middleware.UserIDFromCtx(r.Context())
+	services.AuditV2(r, "CALENDAR_FEED_REVOKED", patientID.String(), userID.String(), "patient", "")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func calendarFeedErr(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrCalendarFeedNotFound) {
+		http.Error(w, "No active calendar feed", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to update calendar feed", http.StatusInternalServerError)
+}
+
+// CalendarFeedICS serves a subscription feed to calendar apps. The secret token in the URL
+// is the only credential, so unknown and revoked tokens look the same.
+func CalendarFeedICS(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(chi.URLParam(r, "token"), ".ics")
+	feed, err := services.CalendarFeedForToken(token)
+	if errors.Is(err, services.ErrCalendarFeedNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+	body, err := services.RenderCalendarFeed(feed)
+	if err != nil {
+		log.Printf("calendar feed %s: %v", feed.ID, err)
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="sessions.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
@@ -37,14 +37,14 @@ func DMWebSocket(w http.ResponseWriter, r *http.Request) {
 		userID, _ = uuid.Parse(claims.UserID)
 		role = "therapist"
 		if claims.TenantID != tenantID.String() {
-			if owns, _ := services.TherapistOwnsTenant(userID, tenantID); !owns {
+			if !services.TherapistInTenant(tenantID, userID) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
 		}
 	} else if uid, ok, err := services.ValidateSession(token); err == nil && ok {
 		userID = uid
-		if owns, _ := services.TherapistOwnsTenant(uid, tenantID); owns {
+		if services.TherapistInTenant(tenantID, uid) {
 			role = "therapist"
 		} else {
 			var pt uuid.UUID
@@ -122,7 +122,10 @@ func ListPatientJournalsV2(w http.ResponseWriter, r *http.Request) {
 
 func CommentOnJournalV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	journalID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "journalId"))
 	if !ok || err != nil || !patientBelongsToTenant(tenantID, patientID) {
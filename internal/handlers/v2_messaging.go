@@ -98,28 +98,32 @@ func GetOrCreatePatientConversationV2(w http.ResponseWriter, r *http.Request) {
 func ListConversationMessagesV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
 	convoID := chi.URLParam(r, "conversationId")
-	if !conversationInTenant(tenantID, convoID) {
+	patientID, ok := conversationPatient(tenantID, convoID)
+	if !ok {
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
+	middleware.NotePHIPatient(r.Context(), patientID)
 	listMessages(w, r, tenantID.String(), convoID)
 }
 
 func SendConversationMessageV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	senderID, senderRole := middleware.ActorFromCtx(r.Context())
 	convoID := chi.URLParam(r, "conversationId")
-	if !conversationInTenant(tenantID, convoID) {
+	patientID, ok := conversationPatient(tenantID, convoID)
+	if !ok {
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
+	middleware.NotePHIPatient(r.Context(), patientID)
 
 	var req sendMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid body", http.StatusBadRequest)
 		return
 	}
-	msg, err := insertDMMessage(tenantID.String(), convoID, therapistID.String(), "therapist", req)
+	msg, err := insertDMMessage(tenantID.String(), convoID, senderID.String(), senderRole, req)
 	if err != nil {
 		http.Error(w, "Failed to send message", http.StatusInternalServerError)
 		return
@@ -229,7 +233,7 @@ func MarkMyConversationReadV2(w http.ResponseWriter, r *http.Request) {
 		bson.M{"$set": bson.M{"unread_count_patient": 0}},
 	)
 	_, _ = database.DB.Collection("dm_messages").UpdateMany(ctx,
-		bson.M{"conversation_id": convo.ID.Hex(), "sender_role": "therapist", "read_at": nil},
+		bson.M{"conversation_id": convo.ID.Hex(), "sender_role": bson.M{"$ne": "patient"}, "read_at": nil},
 		bson.M{"$set": bson.M{"read_at": time.Now()}},
 	)
 	w.WriteHeader(http.StatusNoContent)
@@ -349,13 +353,20 @@ func listMessages(w http.ResponseWriter, r *http.Request, tenantID, convoID stri
 	})
 }
 
-func conversationInTenant(tenantID uuid.UUID, convoID string) bool {
+// conversationPatient returns the patient of a conversation in the tenant; ok is false when the
+// conversation is not there.
+func conversationPatient(tenantID uuid.UUID, convoID string) (patientID uuid.UUID, ok bool) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
-	n, err := database.DB.Collection("dm_conversations").CountDocuments(ctx, bson.M{
+	var convo models.DMConversation
+	err := database.DB.Collection("dm_conversations").FindOne(ctx, bson.M{
 		"_id": mustObjectID(convoID), "tenant_id": tenantID.String(),
-	})
-	return err == nil && n > 0
+	}, options.FindOne().SetProjection(bson.M{"patient_id": 1})).Decode(&convo)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	patientID, _ = uuid.Parse(convo.PatientID)
+	return patientID, true
 }
 
 func mustObjectID(hex string) primitive.ObjectID {
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/google/uuid"
+)
+
+// Therapist (tenant group)
+func GetTherapistNotificationSettingsV2(w http.ResponseWriter, r *http.Request) {
+	actorID, role := middleware.ActorFromCtx(r.Context())
+	getNotificationSettings(w, actorID, role)
+}
+
+func UpdateTherapistNotificationSettingsV2(w http.ResponseWriter, r *http.Request) {
+	actorID, role := middleware.ActorFromCtx(r.Context())
+	updateNotificationSettings(w, r, actorID, role)
+}
+
+// Patient self-service
+func GetMyNotificationSettingsV2(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromCtx(r.Context())
+	getNotificationSettings(w, userID, "user")
+}
+
+func UpdateMyNotificationSettingsV2(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.UserIDFromCtx(r.Context())
+	updateNotificationSettings(w, r, userID, "user")
+}
+
+// Reception portal
+func ReceptionGetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	receptionistID, _ := middleware.ReceptionistIDFromCtx(r.Context())
+	getNotificationSettings(w, receptionistID, "receptionist")
+}
+
+func ReceptionUpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	receptionistID, _ := middleware.ReceptionistIDFromCtx(r.Context())
+	updateNotificationSettings(w, r, receptionistID, "receptionist")
+}
+
+func getNotificationSettings(w http.ResponseWriter, recipientID uuid.UUID, role string) {
+	settings, err := services.GetNotificationSettings(recipientID, role)
+	if err != nil {
+		http.Error(w, "Failed to load notification settings", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": settings})
+}
+
+func updateNotificationSettings(w http.ResponseWriter, r *http.Request, recipientID uuid.UUID, role string) {
+	var req services.NotificationSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.SaveNotificationSettings(recipientID, role, req); err != nil {
+		http.Error(w, "Failed to update notification settings", http.StatusInternalServerError)
+		return
+	}
+	getNotificationSettings(w, recipientID, role)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type sessionPackageRequest struct {
+	Name            *string  `json:"name"`
+	Description     *string  `json:"description"`
+	SessionCount    *int     `json:"session_count"`
+	Price           *float64 `json:"price"`
+	ValidityDays    *int     `json:"validity_days"`
+	AppointmentType *string  `json:"appointment_type"`
+	IsActive        *bool    `json:"is_active"`
+}
+
+// apply copies the fields present in the request onto p.
+func (req sessionPackageRequest) apply(p *models.SessionPackage) {
+	if req.Name != nil {
+		p.Name = *req.Name
+	}
+	if req.Description != nil {
+		p.Description = *req.Description
+	}
+	if req.SessionCount != nil {
+		p.SessionCount = *req.SessionCount
+	}
+	if req.Price != nil {
+		p.Price = *req.Price
+	}
+	if req.ValidityDays != nil {
+		p.ValidityDays = *req.ValidityDays
+	}
+	if req.AppointmentType != nil {
+		p.AppointmentType = *req.AppointmentType
+	}
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+}
+
+type sellPackageRequest struct {
+	PackageID string `json:"package_id"`
+}
+
+func ListSessionPackagesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	listSessionPackages(w, tenantID, r.URL.Query().Get("active") == "true")
+}
+
+func CreateSessionPackageV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	var req sessionPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	p := models.SessionPackage{TenantID: tenantID, ValidityDays: 90, IsActive: true}
+	req.apply(&p)
+	p, err := services.CreateSessionPackage(p)
+	if err != nil {
+		writePackageError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "PACKAGE_CREATED", "session_package", p.ID.String(), actorID.String())
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": p})
+}
+
+func UpdateSessionPackageV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	id, ok := parsePatientIDParam(chi.URLParam(r, "packageId"))
+	if !ok {
+		http.Error(w, "Invalid package ID", http.StatusBadRequest)
+		return
+	}
+	var req sessionPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := services.GetSessionPackage(tenantID, id)
+	if err != nil {
+		writePackageError(w, err)
+		return
+	}
+	req.apply(&p)
+	p, err = services.UpdateSessionPackage(p)
+	if err != nil {
+		writePackageError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "PACKAGE_UPDATED", "session_package", p.ID.String(), actorID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": p})
+}
+
+// ListPatientPackagesV2 returns a patient's packages with their balances and usage ledger.
+func ListPatientPackagesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
+	if !ok || !patientBelongsToTenant(tenantID, patientID) {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+	writePatientPackages(w, tenantID, patientID)
+}
+
+// SellPatientPackageV2 sells a package to a patient. The returned invoice is paid like any
+// other (online, or collected at reception) and the credits are granted once it is paid.
+func SellPatientPackageV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	sellPatientPackage(w, r, tenantID, actorID)
+}
+
+func ListPackageCatalogV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	listSessionPackages(w, tenantID, true)
+}
+
+func ListMyPackagesV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	patientID, _ := middleware.PatientIDFromCtx(r.Context())
+	writePatientPackages(w, tenantID, patientID)
+}
+
+// BuyPackageV2 starts an online purchase. The client completes checkout and confirms it through
+// /payments/verify with the returned invoice_id, as for any invoice.
+func BuyPackageV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	patientID, _ := middleware.PatientIDFromCtx(r.Context())
+	packageID, ok := parsePatientIDParam(chi.URLParam(r, "packageId"))
+	if !ok {
+		http.Error(w, "Invalid package ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := services.TenantPaymentProvider(tenantID); err != nil {
+		http.Error(w, errPaymentsNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	pp, err := services.PurchaseSessionPackage(tenantID, patientID, packageID, nil)
+	if err != nil {
+		writePackageError(w, err)
+		return
+	}
+	resp, err := createPaymentOrder(r.Context(), tenantID, *pp.InvoiceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp["patient_package_id"] = pp.ID.String()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func listSessionPackages(w http.ResponseWriter, tenantID uuid.UUID, activeOnly bool) {
+	packages, err := services.ListSessionPackages(tenantID, activeOnly)
+	if err != nil {
+		http.Error(w, "Failed to list packages", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": packages})
+}
+
+func writePatientPackages(w http.ResponseWriter, tenantID, patientID uuid.UUID) {
+	packages, err := services.ListPatientPackages(tenantID, patientID)
+	if err != nil {
+		http.Error(w, "Failed to list packages", http.StatusInternalServerError)
+		return
+	}
+	ledger, err := services.ListPackageLedger(tenantID, patientID, 100)
+	if err != nil {
+		http.Error(w, "Failed to list packages", http.StatusInternalServerError)
+		return
+	}
+	available := 0
+	for _, p := range packages {
+		available += p.SessionsAvailable
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"sessions_available": available,
+		"packages":           packages,
+		"ledger":             ledger,
+	}})
+}
+
+func sellPatientPackage(w http.ResponseWriter, r *http.Request, tenantID, actorID uuid.UUID) {
+	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
+	if !ok || !patientBelongsToTenant(tenantID, patientID) {
+		http.Error(w, "Patient not found", http.StatusNotFound)
+		return
+	}
+	var req sellPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	packageID, err := uuid.Parse(req.PackageID)
+	if err != nil {
+		http.Error(w, "Invalid package_id", http.StatusBadRequest)
+		return
+	}
+	pp, err := services.PurchaseSessionPackage(tenantID, patientID, packageID, &actorID)
+	if err != nil {
+		writePackageError(w, err)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "PACKAGE_SOLD", "patient_package", pp.ID.String(), actorID.String())
+	inv, _ := getInvoice(tenantID, *pp.InvoiceID)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{
+		"package": pp,
+		"invoice": inv,
+	}})
+}
+
+func writePackageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrPackageNotFound):
+		http.Error(w, "Package not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrPackageInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrPackageInactive):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save package", http.StatusInternalServerError)
+	}
+}
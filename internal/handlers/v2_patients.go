@@ -32,7 +32,7 @@ func ListPatientsV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 	_ = services.SyncConnectedUsersToPatients(tenantID, therapistID)
 
 	rows, err := database.PostgresDB.Query(`
@@ -67,7 +67,7 @@ func CreatePatientV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	therapistID, ok := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := middleware.ScheduleTherapistFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -284,6 +284,17 @@ func nullStr(s string) interface{} {
 	return s
 }
 
+// requirePractitioner returns the signed-in practitioner. Clinical records are authored by
+// practitioners only, so receptionists and other staff get a 403.
+func requirePractitioner(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	therapistID, ok := middleware.TherapistIDFromCtx(r.Context())
+	if !ok || therapistID == uuid.Nil {
+		http.Error(w, "Only practitioners can author clinical records", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return therapistID, true
+}
+
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
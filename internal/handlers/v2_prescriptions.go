@@ -36,7 +36,10 @@ func ListPrescriptionsV2(w http.ResponseWriter, r *http.Request) {
 
 func CreatePrescriptionV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	if !ok || !patientBelongsToTenant(tenantID, patientID) {
 		http.Error(w, "Patient not found", http.StatusNotFound)
@@ -115,6 +118,7 @@ func UpdatePrescriptionV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
+	middleware.NotePHIPatient(r.Context(), rx.PatientID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": rx})
 }
 
@@ -30,7 +30,7 @@ type quickRegisterRequest struct {
 
 func ReceptionWalkInV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req walkInRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -89,6 +89,7 @@ func ReceptionWalkInV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	services.EnqueueCalendarSync("create", tenantID, aptID)
+	services.ScheduleAppointmentReminders(tenantID, aptID)
 	patient, _ := getPatientByID(tenantID, patientID)
 	apt, _ := getAppointment(tenantID, aptID)
 	writeJSON(w, http.StatusCreated, map[string]interface{}{
@@ -98,7 +99,7 @@ func ReceptionWalkInV2(w http.ResponseWriter, r *http.Request) {
 
 func ReceptionQuickRegisterV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, _ := middleware.ScheduleTherapistFromCtx(r.Context())
 
 	var req quickRegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
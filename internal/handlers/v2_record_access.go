@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+)
+
+// ListMyRecordAccessV2 shows the signed-in patient which staff read or changed their health
+// record, newest first. Pass the last entry's occurred_at as before for the next page.
+func ListMyRecordAccessV2(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit, _ := pagination(r)
+	var before *time.Time
+	if v := r.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "Invalid before: use RFC 3339", http.StatusBadRequest)
+			return
+		}
+		before = &t
+	}
+	entries, err := services.ListRecordViewsForUser(r.Context(), userID, before, limit)
+	if err != nil {
+		http.Error(w, "Failed to load record access", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": entries})
+}
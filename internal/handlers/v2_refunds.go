@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+)
+
+type createRefundRequest struct {
+	Amount float64 `json:"amount"` // 0 refunds everything still refundable
+	Reason string  `json:"reason"`
+}
+
+func CreateInvoiceRefundV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	actorID, _ := middleware.ActorFromCtx(r.Context())
+	invID, ok := parsePatientIDParam(chi.URLParam(r, "invoiceId"))
+	if !ok {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	var req createRefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		http.Error(w, "amount must not be negative", http.StatusBadRequest)
+		return
+	}
+	if _, err := getInvoice(tenantID, invID); err != nil {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := services.RefundInvoice(r.Context(), tenantID, invID, req.Amount, strings.TrimSpace(req.Reason), actorID)
+	switch {
+	case errors.Is(err, services.ErrInvoiceNotRefundable):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrRefundAmount):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Refund failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	services.AuditV2Tenant(r, tenantID, "INVOICE_REFUNDED", "invoice", invID.String(), actorID.String())
+
+	inv, _ := getInvoice(tenantID, invID)
+	resp := map[string]interface{}{"invoice": inv, "refunds": res.Refunds, "credit_note": res.CreditNote}
+	if res.Incomplete != nil {
+		// Part of the amount was refunded and credited; the rest can be retried.
+		resp["warning"] = res.Incomplete.Error()
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": resp})
+}
+
+func ListInvoiceRefundsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	invID, ok := parsePatientIDParam(chi.URLParam(r, "invoiceId"))
+	if !ok {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	refunds, notes, err := services.ListInvoiceRefunds(tenantID, invID)
+	if err != nil {
+		http.Error(w, "Failed to list refunds", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"refunds":      refunds,
+		"credit_notes": notes,
+	}})
+}
+
+func GetCreditNotePDFV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	cnID, ok := parsePatientIDParam(chi.URLParam(r, "creditNoteId"))
+	if !ok {
+		http.Error(w, "Invalid credit note ID", http.StatusBadRequest)
+		return
+	}
+	cn, err := services.GetCreditNote(tenantID, cnID)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	inv, err := getInvoice(tenantID, cn.InvoiceID)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	invDoc, err := buildInvoiceDocument(tenantID, inv)
+	if err != nil {
+		http.Error(w, "Failed to load invoice details", http.StatusInternalServerError)
+		return
+	}
+	profile, err := services.GetBillingProfile(tenantID)
+	if err != nil {
+		http.Error(w, "Failed to load invoice details", http.StatusInternalServerError)
+		return
+	}
+	doc := services.BuildCreditNoteDocument(cn, inv, profile, invDoc.Seller, invDoc.Buyer, services.TenantLocation(tenantID))
+	pdf := services.RenderInvoicePDF(doc)
+	hash := doc.Hash()
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", strings.ReplaceAll(cn.CreditNoteNumber, "/", "-")+".pdf"))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Header().Set("X-Document-Hash", hash)
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pdf)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+)
+
+type reminderSettingsRequest struct {
+	OffsetsMin []int `json:"offsets_min"`
+}
+
+func GetReminderSettingsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"offsets_min": services.TenantReminderOffsets(tenantID),
+	}})
+}
+
+func UpdateReminderSettingsV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	var req reminderSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if _, err := services.NormalizeReminderOffsets(req.OffsetsMin); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offsets, err := services.SetTenantReminderOffsets(tenantID, req.OffsetsMin)
+	if err != nil {
+		http.Error(w, "Failed to update reminder settings", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+		"offsets_min": offsets,
+	}})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/AnshRaj112/serenify-backend/internal/middleware"
 	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -25,6 +26,7 @@ type sessionNoteRequest struct {
 	ProgressRating          int         `json:"progress_rating,omitempty"`
 	Attachments             []string    `json:"attachments,omitempty"`
 	SessionDate             string      `json:"session_date,omitempty"`
+	Shared                  bool        `json:"shared,omitempty"`
 }
 
 func ListSessionNotesV2(w http.ResponseWriter, r *http.Request) {
@@ -38,7 +40,9 @@ func ListSessionNotesV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
-	filter := bson.M{"tenant_id": tenantID.String(), "patient_id": patientID.String()}
+	filter := services.SessionNoteVisibility(noteViewerID(r))
+	filter["tenant_id"] = tenantID.String()
+	filter["patient_id"] = patientID.String()
 	opts := options.Find().SetSort(bson.D{{Key: "session_number", Value: 1}})
 
 	cursor, err := database.DB.Collection("session_notes").Find(ctx, filter, opts)
@@ -58,7 +62,10 @@ func ListSessionNotesV2(w http.ResponseWriter, r *http.Request) {
 
 func CreateSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	if !ok || !patientBelongsToTenant(tenantID, patientID) {
 		http.Error(w, "Patient not found", http.StatusNotFound)
@@ -102,6 +109,7 @@ func CreateSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 		FollowUpRecommendations: strings.TrimSpace(req.FollowUpRecommendations),
 		ProgressRating:          req.ProgressRating,
 		Attachments:             req.Attachments,
+		Shared:                  req.Shared,
 		CreatedAt:               now,
 		UpdatedAt:               now,
 	}
@@ -125,10 +133,7 @@ func GetSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
-	var note models.SessionNote
-	err = database.DB.Collection("session_notes").FindOne(ctx, bson.M{
-		"_id": noteID, "tenant_id": tenantID.String(), "patient_id": patientID.String(),
-	}).Decode(&note)
+	note, err := findVisibleNote(ctx, r, tenantID, patientID, noteID)
 	if err != nil {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
@@ -138,7 +143,10 @@ func GetSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 
 func UpdateSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	noteID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "noteId"))
 	if !ok || err != nil || !patientBelongsToTenant(tenantID, patientID) {
@@ -155,14 +163,15 @@ func UpdateSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
-	var existing models.SessionNote
-	err = database.DB.Collection("session_notes").FindOne(ctx, bson.M{
-		"_id": noteID, "tenant_id": tenantID.String(), "patient_id": patientID.String(),
-	}).Decode(&existing)
+	existing, err := findVisibleNote(ctx, r, tenantID, patientID, noteID)
 	if err != nil {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
 	}
+	if existing.TherapistID != therapistID.String() {
+		http.Error(w, "Only the note's author can change it", http.StatusForbidden)
+		return
+	}
 	if existing.Status != "draft" {
 		http.Error(w, "Only draft notes can be edited", http.StatusConflict)
 		return
@@ -197,7 +206,10 @@ func UpdateSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 
 func PublishSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	noteID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "noteId"))
 	if !ok || err != nil || !patientBelongsToTenant(tenantID, patientID) {
@@ -208,14 +220,15 @@ func PublishSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
-	var existing models.SessionNote
-	err = database.DB.Collection("session_notes").FindOne(ctx, bson.M{
-		"_id": noteID, "tenant_id": tenantID.String(), "patient_id": patientID.String(),
-	}).Decode(&existing)
+	existing, err := findVisibleNote(ctx, r, tenantID, patientID, noteID)
 	if err != nil {
 		http.Error(w, "Note not found", http.StatusNotFound)
 		return
 	}
+	if existing.TherapistID != therapistID.String() {
+		http.Error(w, "Only the note's author can change it", http.StatusForbidden)
+		return
+	}
 
 	saveNoteVersion(ctx, existing, therapistID.String())
 	now := time.Now()
@@ -235,8 +248,8 @@ func PublishSessionNoteV2(w http.ResponseWriter, r *http.Request) {
 func ListSessionNoteVersionsV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
-	noteID := chi.URLParam(r, "noteId")
-	if !ok || !patientBelongsToTenant(tenantID, patientID) {
+	noteID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "noteId"))
+	if !ok || err != nil || !patientBelongsToTenant(tenantID, patientID) {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
@@ -244,8 +257,13 @@ func ListSessionNoteVersionsV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
+	if _, err := findVisibleNote(ctx, r, tenantID, patientID, noteID); err != nil {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
 	cursor, err := database.DB.Collection("session_note_versions").Find(ctx, bson.M{
-		"note_id": noteID, "tenant_id": tenantID.String(),
+		"note_id": noteID.Hex(), "tenant_id": tenantID.String(),
 	}, options.Find().SetSort(bson.D{{Key: "version", Value: -1}}))
 	if err != nil {
 		http.Error(w, "Failed to list versions", http.StatusInternalServerError)
@@ -266,7 +284,9 @@ func SearchSessionNotesV2(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := mongoCtx()
 	defer cancel()
 
-	filter := bson.M{"tenant_id": tenantID.String(), "status": "published"}
+	filter := services.SessionNoteVisibility(noteViewerID(r))
+	filter["tenant_id"] = tenantID.String()
+	filter["status"] = "published"
 	if patientFilter != "" {
 		if pid, err := uuid.Parse(patientFilter); err == nil {
 			filter["patient_id"] = pid.String()
@@ -289,6 +309,75 @@ func SearchSessionNotesV2(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": notes})
 }
 
+// ShareSessionNoteV2 lets a note's author share it with the practice or make it private again.
+func ShareSessionNoteV2(w http.ResponseWriter, r *http.Request) {
+	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
+	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
+	noteID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "noteId"))
+	if !ok || err != nil || !patientBelongsToTenant(tenantID, patientID) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Shared bool `json:"shared"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := mongoCtx()
+	defer cancel()
+
+	existing, err := findVisibleNote(ctx, r, tenantID, patientID, noteID)
+	if err != nil {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	if existing.TherapistID != therapistID.String() {
+		http.Error(w, "Only the note's author can change who sees it", http.StatusForbidden)
+		return
+	}
+	_, err = database.DB.Collection("session_notes").UpdateByID(ctx, noteID, bson.M{"$set": bson.M{
+		"shared": req.Shared, "updated_at": time.Now(),
+	}})
+	if err != nil {
+		http.Error(w, "Failed to update note", http.StatusInternalServerError)
+		return
+	}
+	existing.Shared = req.Shared
+	event := "SESSION_NOTE_UNSHARED"
+	if req.Shared {
+		event = "SESSION_NOTE_SHARED"
+	}
+	services.AuditV2Tenant(r, tenantID, event, "session_note", noteID.Hex(), therapistID.String())
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": existing})
+}
+
+// noteViewerID is the practitioner whose private notes the request may read, or "" for
+// receptionists and other non-practitioner staff, who see shared notes only.
+func noteViewerID(r *http.Request) string {
+	if _, ok := middleware.MemberRoleFromCtx(r.Context()); !ok {
+		return ""
+	}
+	id, _ := middleware.TherapistIDFromCtx(r.Context())
+	return id.String()
+}
+
+func findVisibleNote(ctx context.Context, r *http.Request, tenantID, patientID uuid.UUID, noteID primitive.ObjectID) (models.SessionNote, error) {
+	filter := services.SessionNoteVisibility(noteViewerID(r))
+	filter["_id"] = noteID
+	filter["tenant_id"] = tenantID.String()
+	filter["patient_id"] = patientID.String()
+	var note models.SessionNote
+	err := database.DB.Collection("session_notes").FindOne(ctx, filter).Decode(&note)
+	return note, err
+}
+
 func saveNoteVersion(ctx context.Context, note models.SessionNote, changedBy string) {
 	count, _ := database.DB.Collection("session_note_versions").CountDocuments(ctx, bson.M{"note_id": note.ID.Hex()})
 	ver := models.SessionNoteVersion{
@@ -39,7 +39,10 @@ func ListPatientTasksV2(w http.ResponseWriter, r *http.Request) {
 
 func CreateTaskV2(w http.ResponseWriter, r *http.Request) {
 	tenantID, _ := middleware.TenantIDFromCtx(r.Context())
-	therapistID, _ := middleware.TherapistIDFromCtx(r.Context())
+	therapistID, ok := requirePractitioner(w, r)
+	if !ok {
+		return
+	}
 	patientID, ok := parsePatientIDParam(chi.URLParam(r, "patientId"))
 	if !ok || !patientBelongsToTenant(tenantID, patientID) {
 		http.Error(w, "Patient not found", http.StatusNotFound)
@@ -114,6 +117,7 @@ func UpdateTaskV2(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
+	middleware.NotePHIPatient(r.Context(), task.PatientID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"data": task})
 }
 
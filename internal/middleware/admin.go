@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/google/uuid"
+)
+
+// AdminAuth resolves the signed-in admin account and puts its ID and role (admin, compliance or safety)
+// in the request context, for RequireRole and MFAEnforcer to check.
+func AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r.Header.Get("Authorization"))
+
+		var adminID uuid.UUID
+		var ok bool
+		if claims, valid := services.ValidateAdminAccessToken(token); valid {
+			var err error
+			adminID, err = uuid.Parse(claims.UserID)
+			ok = err == nil
+		} else if token != "" {
+			adminID, ok, _ = services.ValidateAdminSession(token)
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		role, active, err := services.AdminRole(adminID)
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, adminID.String())
+		ctx = context.WithValue(ctx, UserRoleKey, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// CtxBreakGlassID is the emergency access grant a request is made under
+const CtxBreakGlassID ctxKey = "break_glass_id"
+
+// BreakGlassActor resolves who may request emergency access: an approved therapist or a platform
+// safety officer. Their ID and role (therapist or safety) go in the request context; therapists
+// also get CtxTherapistID.
+func BreakGlassActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r.Header.Get("Authorization"))
+
+		if adminID, ok := resolveAdmin(token); ok {
+			role, active, err := services.AdminRole(adminID)
+			if err != nil {
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			if !active || role != services.AdminRoleSafety {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(r.Context(), UserIDKey, adminID.String())
+			ctx = context.WithValue(ctx, UserRoleKey, services.BreakGlassRoleSafety)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		var therapistID uuid.UUID
+		var ok bool
+		if claims, valid := services.ValidateAccessToken(token); valid {
+			var err error
+			therapistID, err = uuid.Parse(claims.UserID)
+			ok = err == nil
+		} else {
+			therapistID, ok = resolveTherapistSession(token)
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var approved bool
+		err := database.PostgresDB.QueryRow(
+			`SELECT is_approved FROM therapists WHERE id = $1`, therapistID,
+		).Scan(&approved)
+		if err == sql.ErrNoRows || (err == nil && !approved) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), CtxTherapistID, therapistID)
+		ctx = context.WithValue(ctx, UserIDKey, therapistID.String())
+		ctx = context.WithValue(ctx, UserRoleKey, services.BreakGlassRoleTherapist)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func resolveAdmin(token string) (uuid.UUID, bool) {
+	if claims, valid := services.ValidateAdminAccessToken(token); valid {
+		id, err := uuid.Parse(claims.UserID)
+		return id, err == nil
+	}
+	if token == "" {
+		return uuid.Nil, false
+	}
+	id, ok, _ := services.ValidateAdminSession(token)
+	return id, ok
+}
+
+// BreakGlassScope admits the holder of an open grant ({grantId}) to the granted patient's record
+// ({patientId}) with read-only clinical permissions, in the patient's tenant. It runs after
+// BreakGlassActor; PHIAccess flags everything read under it with the grant.
+func BreakGlassScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grantID, err := uuid.Parse(chi.URLParam(r, "grantId"))
+		if err != nil {
+			http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+			return
+		}
+		patientID, err := uuid.Parse(chi.URLParam(r, "patientId"))
+		if err != nil {
+			http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+			return
+		}
+		actorID, _ := r.Context().Value(UserIDKey).(string)
+		granteeID, err := uuid.Parse(actorID)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		grant, err := services.ActiveBreakGlassGrant(grantID, granteeID)
+		switch {
+		case errors.Is(err, services.ErrBreakGlassNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, services.ErrBreakGlassInactive):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if grant.PatientID != patientID {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), CtxTenantID, grant.TenantID)
+		ctx = context.WithValue(ctx, CtxPermissions, services.BreakGlassPermissions())
+		ctx = context.WithValue(ctx, CtxBreakGlassID, grant.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// BreakGlassIDFromCtx returns the grant the request is made under, if any.
+func BreakGlassIDFromCtx(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(CtxBreakGlassID).(uuid.UUID)
+	return id, ok
+}
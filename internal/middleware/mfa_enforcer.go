@@ -5,23 +5,34 @@ import (
 	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
 )
 
 // MFAEnforcer verifies that the current administrator session has completed hardware-backed FIDO2/MFA authentication.
 func MFAEnforcer(next http.Handler) http.Handler {
+	// Enforce strictly for privileged staff/admin roles; sign-in makes them enroll a factor
+	return requireMFA(next, services.AdminRoleRequiresMFA)
+}
+
+// RequireStaffMFA is MFAEnforcer for every role, for routes where any staff member, privileged
+// or not, must have completed MFA recently.
+func RequireStaffMFA(next http.Handler) http.Handler {
+	return requireMFA(next, func(string) bool { return true })
+}
+
+func requireMFA(next http.Handler, enforced func(role string) bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		actorID, _ := ctx.Value(UserIDKey).(string)
 		role, _ := ctx.Value(UserRoleKey).(string)
 
-		// Enforce strictly for privileged staff/admin roles
-		if role == "admin" || role == "moderator" || role == "compliance" {
+		if enforced(role) {
 			var mfaVerified bool
 			var lastMfaAt time.Time
 
 			err := database.PostgresDB.QueryRowContext(ctx, `
-				SELECT mfa_verified, last_mfa_at 
-				FROM staff_sessions 
+				SELECT mfa_verified, last_mfa_at
+				FROM staff_sessions
 				WHERE actor_id = $1 AND active = true
 				ORDER BY last_mfa_at DESC LIMIT 1
 			`, actorID).Scan(&mfaVerified, &lastMfaAt)
@@ -29,7 +40,7 @@ func MFAEnforcer(next http.Handler) http.Handler {
 			if err != nil || !mfaVerified || time.Since(lastMfaAt) > 12*time.Hour {
 				database.TriggerAuditEvent("PRIVILEGED_MFA_CHALLENGE_FAILED", "MFA_ENFORCER", actorID, role, "Hardware MFA validation expired or missing", r)
 				w.Header().Set("X-MFA-Challenge-Required", "true")
-				http.Error(w, "Multi-Factor Authentication Required", http.StatusPreconditionRequired)
+				http.Error(w, "Multi-Factor Authentication Required: sign in again to verify or set up a second factor", http.StatusPreconditionRequired)
 				return
 			}
 		}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/AnshRaj112/serenify-backend/pkg/clientip"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const ctxPHIAccess ctxKey = "phi_access"
+
+// recordPHIAccess is replaced in tests
+var recordPHIAccess = services.RecordPHIAccess
+
+// phiAccessNote lets the handler name the patient when the URL does not, e.g. for a conversation
+// or prescription addressed by its own ID.
+type phiAccessNote struct {
+	patientID uuid.UUID
+}
+
+// NotePHIPatient records which patient the current PHI request touched. It is a no-op outside
+// routes wrapped in PHIAccess.
+func NotePHIPatient(ctx context.Context, patientID uuid.UUID) {
+	if note, ok := ctx.Value(ctxPHIAccess).(*phiAccessNote); ok {
+		note.patientID = patientID
+	}
+}
+
+// PHIAccess records every successful request to the route in the PHI access log, as a read for
+// GET and a write otherwise. It runs after TenantAuth or BreakGlassScope, which identify the staff
+// member; accesses under break-glass are flagged with the grant.
+func PHIAccess(resourceType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			note := &phiAccessNote{}
+			if id, err := uuid.Parse(chi.URLParam(r, "patientId")); err == nil {
+				note.patientID = id
+			}
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), ctxPHIAccess, note)))
+			if sw.status >= 400 {
+				return
+			}
+
+			ctx := r.Context()
+			a := services.PHIAccess{
+				PatientID:    note.patientID,
+				ResourceType: resourceType,
+				ResourceID:   phiResourceID(r),
+				Method:       r.Method,
+				Path:         r.URL.Path,
+				Status:       sw.status,
+				IPAddress:    clientip.RealClientIP(r),
+				UserAgent:    r.UserAgent(),
+				Action:       services.PHIActionWrite,
+			}
+			if r.Method == http.MethodGet {
+				a.Action = services.PHIActionRead
+			}
+			a.TenantID, _ = TenantIDFromCtx(ctx)
+			if id, ok := ReceptionistIDFromCtx(ctx); ok {
+				a.ActorID, a.ActorRole = id, "receptionist"
+			} else if id, ok := TherapistIDFromCtx(ctx); ok {
+				a.ActorID, a.ActorRole = id, "therapist"
+			} else if id, ok := safetyOfficerFromCtx(ctx); ok {
+				a.ActorID, a.ActorRole = id, services.BreakGlassRoleSafety
+			} else {
+				return
+			}
+			a.BreakGlassID, _ = BreakGlassIDFromCtx(ctx)
+			recordPHIAccess(a)
+		})
+	}
+}
+
+// safetyOfficerFromCtx returns the platform safety officer resolved by BreakGlassActor.
+func safetyOfficerFromCtx(ctx context.Context) (uuid.UUID, bool) {
+	if role, _ := ctx.Value(UserRoleKey).(string); role != services.BreakGlassRoleSafety {
+		return uuid.Nil, false
+	}
+	actorID, _ := ctx.Value(UserIDKey).(string)
+	id, err := uuid.Parse(actorID)
+	return id, err == nil
+}
+
+// phiResourceID is the route's own ID parameter, e.g. noteId in /patients/{patientId}/notes/{noteId}.
+func phiResourceID(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	for i := len(rctx.URLParams.Keys) - 1; i >= 0; i-- {
+		switch rctx.URLParams.Keys[i] {
+		case "tenantId", "patientId", "grantId", "*":
+		default:
+			return rctx.URLParams.Values[i]
+		}
+	}
+	return ""
+}
+
+// statusWriter remembers the response status for middleware that acts after the handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
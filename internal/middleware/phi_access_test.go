@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestPHIAccessRecordsSuccessfulRequests(t *testing.T) {
+	var recorded []services.PHIAccess
+	recordPHIAccess = func(a services.PHIAccess) { recorded = append(recorded, a) }
+	defer func() { recordPHIAccess = services.RecordPHIAccess }()
+
+	therapistID, tenantID, patientID := uuid.New(), uuid.New(), uuid.New()
+	notedPatient := uuid.New()
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), CtxTherapistID, therapistID)
+			ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.With(PHIAccess("session_note")).Get("/tenant/{tenantId}/patients/{patientId}/notes/{noteId}",
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) })
+	r.With(PHIAccess("prescription")).Patch("/tenant/{tenantId}/prescriptions/{rxId}",
+		func(w http.ResponseWriter, r *http.Request) { NotePHIPatient(r.Context(), notedPatient) })
+	r.With(PHIAccess("session_note")).Get("/tenant/{tenantId}/patients/{patientId}/missing",
+		func(w http.ResponseWriter, r *http.Request) { http.Error(w, "Not found", http.StatusNotFound) })
+
+	serve := func(method, path string) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+	serve(http.MethodGet, "/tenant/"+tenantID.String()+"/patients/"+patientID.String()+"/notes/note-1")
+	serve(http.MethodPatch, "/tenant/"+tenantID.String()+"/prescriptions/rx-1")
+	serve(http.MethodGet, "/tenant/"+tenantID.String()+"/patients/"+patientID.String()+"/missing")
+
+	if len(recorded) != 2 {
+		t.Fatalf("recorded %d accesses, want 2 (failed requests are skipped)", len(recorded))
+	}
+	read, write := recorded[0], recorded[1]
+	if read.Action != services.PHIActionRead || read.PatientID != patientID || read.ResourceID != "note-1" ||
+		read.ActorID != therapistID || read.ActorRole != "therapist" || read.TenantID != tenantID {
+		t.Fatalf("unexpected read: %+v", read)
+	}
+	if write.Action != services.PHIActionWrite || write.PatientID != notedPatient || write.ResourceID != "rx-1" ||
+		write.ResourceType != "prescription" {
+		t.Fatalf("unexpected write: %+v", write)
+	}
+}
+
+func TestPHIAccessFlagsBreakGlassAccess(t *testing.T) {
+	var recorded []services.PHIAccess
+	recordPHIAccess = func(a services.PHIAccess) { recorded = append(recorded, a) }
+	defer func() { recordPHIAccess = services.RecordPHIAccess }()
+
+	officerID, tenantID, grantID, patientID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	r := chi.NewRouter()
+	r.Route("/break-glass/{grantId}/patients/{patientId}", func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := context.WithValue(r.Context(), UserIDKey, officerID.String())
+				ctx = context.WithValue(ctx, UserRoleKey, services.BreakGlassRoleSafety)
+				ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+				ctx = context.WithValue(ctx, CtxBreakGlassID, grantID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		})
+		r.With(PHIAccess("patient")).Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet,
+		"/break-glass/"+grantID.String()+"/patients/"+patientID.String(), nil))
+
+	if len(recorded) != 1 {
+		t.Fatalf("recorded %d accesses, want 1", len(recorded))
+	}
+	a := recorded[0]
+	if a.BreakGlassID != grantID || a.ActorID != officerID || a.ActorRole != services.BreakGlassRoleSafety ||
+		a.PatientID != patientID || a.TenantID != tenantID || a.ResourceID != "" {
+		t.Fatalf("unexpected access: %+v", a)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AnshRaj112/serenify-backend/internal/services"
+)
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(services.PermInvoicesRefund)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(perms services.PermissionSet) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tenant/x/invoices/y/refunds", nil)
+		if perms != nil {
+			req = req.WithContext(context.WithValue(req.Context(), CtxPermissions, perms))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(nil); code != http.StatusForbidden {
+		t.Fatalf("missing context: %d", code)
+	}
+	if code := serve(services.PermissionSet{services.PermInvoicesRead: true}); code != http.StatusForbidden {
+		t.Fatalf("missing permission: %d", code)
+	}
+	if code := serve(services.PermissionSet{services.PermInvoicesRefund: true}); code != http.StatusNoContent {
+		t.Fatalf("granted permission: %d", code)
+	}
+	if code := serve(services.AllPermissions()); code != http.StatusNoContent {
+		t.Fatalf("owner: %d", code)
+	}
+}
+
+func TestRequireTenantAdmin(t *testing.T) {
+	handler := RequireTenantAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(role string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tenant/x/members/invitations", nil)
+		if role != "" {
+			req = req.WithContext(context.WithValue(req.Context(), CtxMemberRole, role))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for role, want := range map[string]int{
+		"":                        http.StatusForbidden,
+		services.MemberRoleMember: http.StatusForbidden,
+		services.MemberRoleAdmin:  http.StatusNoContent,
+		services.MemberRoleOwner:  http.StatusNoContent,
+	} {
+		if code := serve(role); code != want {
+			t.Fatalf("role %q: got %d, want %d", role, code, want)
+		}
+	}
+}
@@ -13,6 +13,10 @@ import (
 
 const (
 	CtxReceptionistID ctxKey = "receptionist_id"
+	// CtxDeskTherapistID is the practitioner a receptionist works for. It only picks whose
+	// calendar and patients the desk works on by default; receptionists never get
+	// CtxTherapistID, so they cannot act as that practitioner.
+	CtxDeskTherapistID ctxKey = "desk_therapist_id"
 )
 
 // ReceptionistAuth validates that the caller is an active receptionist belonging
@@ -25,49 +29,83 @@ func ReceptionistAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		token := bearerToken(r.Header.Get("Authorization"))
-		var receptionistID uuid.UUID
-		var ok bool
-
-		if claims, valid := services.ValidateReceptionistAccessToken(token); valid {
-			receptionistID, err = uuid.Parse(claims.UserID)
-			ok = err == nil
-		} else {
-			receptionistID, ok = services.GetReceptionistAuthCache(token)
-		}
+		claims, ok := services.ValidateReceptionistAccessToken(bearerToken(r.Header.Get("Authorization")))
 		if !ok {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-
-		// Verify this receptionist is active and belongs to the requested tenant
-		var therapistID uuid.UUID
-		var isActive bool
-		err = database.PostgresDB.QueryRow(`
-			SELECT therapist_id, is_active FROM receptionists
-			WHERE id = $1 AND tenant_id = $2
-		`, receptionistID, tenantID).Scan(&therapistID, &isActive)
-		if err == sql.ErrNoRows {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		if err != nil {
-			http.Error(w, "Internal error", http.StatusInternalServerError)
-			return
-		}
-		if !isActive {
-			http.Error(w, "Account deactivated", http.StatusForbidden)
+		ctx, ok := receptionistContext(w, r, tenantID, claims)
+		if !ok {
 			return
 		}
-
-		ctx := context.WithValue(r.Context(), CtxReceptionistID, receptionistID)
-		ctx = context.WithValue(ctx, CtxTenantID, tenantID)
-		ctx = context.WithValue(ctx, CtxTherapistID, therapistID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// receptionistContext checks that the token's receptionist is active in tenantID and returns the
+// request context for them, with the practitioner they work for and their permissions. It
+// writes the error response itself when the check fails.
+func receptionistContext(w http.ResponseWriter, r *http.Request, tenantID uuid.UUID, claims *services.TokenClaims) (context.Context, bool) {
+	receptionistID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Verify this receptionist is active and belongs to the requested tenant
+	var therapistID uuid.UUID
+	var isActive bool
+	err = database.PostgresDB.QueryRow(`
+		SELECT therapist_id, is_active FROM receptionists
+		WHERE id = $1 AND tenant_id = $2
+	`, receptionistID, tenantID).Scan(&therapistID, &isActive)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !isActive {
+		http.Error(w, "Account deactivated", http.StatusForbidden)
+		return nil, false
+	}
+
+	perms, err := services.StaffPermissions(tenantID, receptionistID, services.RoleReceptionist)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), CtxReceptionistID, receptionistID)
+	ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+	ctx = context.WithValue(ctx, CtxDeskTherapistID, therapistID)
+	ctx = context.WithValue(ctx, CtxPermissions, perms)
+	return ctx, true
+}
+
 func ReceptionistIDFromCtx(ctx context.Context) (uuid.UUID, bool) {
 	id, ok := ctx.Value(CtxReceptionistID).(uuid.UUID)
 	return id, ok
 }
+
+// ActorFromCtx returns the signed-in tenant staff member and whether they are a "therapist" or
+// a "receptionist". Use it for audit actors and records of who did something.
+func ActorFromCtx(ctx context.Context) (uuid.UUID, string) {
+	if id, ok := ReceptionistIDFromCtx(ctx); ok {
+		return id, "receptionist"
+	}
+	id, _ := TherapistIDFromCtx(ctx)
+	return id, "therapist"
+}
+
+// ScheduleTherapistFromCtx returns the practitioner a request schedules for when it names
+// none: the signed-in practitioner, or the one a receptionist works for.
+func ScheduleTherapistFromCtx(ctx context.Context) (uuid.UUID, bool) {
+	if id, ok := TherapistIDFromCtx(ctx); ok {
+		return id, true
+	}
+	id, ok := ctx.Value(CtxDeskTherapistID).(uuid.UUID)
+	return id, ok
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReceptionistDoesNotActAsTherapist(t *testing.T) {
+	receptionistID, deskTherapistID := uuid.New(), uuid.New()
+	ctx := context.WithValue(context.Background(), CtxReceptionistID, receptionistID)
+	ctx = context.WithValue(ctx, CtxDeskTherapistID, deskTherapistID)
+
+	if _, ok := TherapistIDFromCtx(ctx); ok {
+		t.Fatal("receptionist resolved as a therapist")
+	}
+	if id, role := ActorFromCtx(ctx); id != receptionistID || role != "receptionist" {
+		t.Fatalf("actor %s %s", id, role)
+	}
+	if id, ok := ScheduleTherapistFromCtx(ctx); !ok || id != deskTherapistID {
+		t.Fatalf("schedule therapist %s %v", id, ok)
+	}
+
+	therapistID := uuid.New()
+	ctx = context.WithValue(context.Background(), CtxTherapistID, therapistID)
+	if id, role := ActorFromCtx(ctx); id != therapistID || role != "therapist" {
+		t.Fatalf("actor %s %s", id, role)
+	}
+	if id, ok := ScheduleTherapistFromCtx(ctx); !ok || id != therapistID {
+		t.Fatalf("schedule therapist %s %v", id, ok)
+	}
+}
@@ -16,6 +16,8 @@ type ctxKey string
 const (
 	CtxTherapistID ctxKey = "therapist_id"
 	CtxTenantID    ctxKey = "tenant_id"
+	// CtxMemberRole is the signed-in practitioner's tenant_members role; unset for receptionists
+	CtxMemberRole ctxKey = "member_role"
 )
 
 func TenantAuth(next http.Handler) http.Handler {
@@ -27,6 +29,16 @@ func TenantAuth(next http.Handler) http.Handler {
 		}
 
 		token := bearerToken(r.Header.Get("Authorization"))
+
+		// Tenant staff reach the practice routes with the permissions of their roles
+		if claims, valid := services.ValidateReceptionistAccessToken(token); valid {
+			ctx, ok := receptionistContext(w, r, tenantID, claims)
+			if ok {
+				next.ServeHTTP(w, r.WithContext(ctx))
+			}
+			return
+		}
+
 		var therapistID uuid.UUID
 		var ok bool
 
@@ -54,14 +66,25 @@ func TenantAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		owns, err := services.TherapistOwnsTenant(therapistID, tenantID)
-		if err != nil || !owns {
+		role, member, err := services.TenantMemberRole(tenantID, therapistID)
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if !member {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		perms, err := services.MemberPermissions(tenantID, therapistID, role)
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
 
 		ctx := context.WithValue(r.Context(), CtxTherapistID, therapistID)
 		ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+		ctx = context.WithValue(ctx, CtxMemberRole, role)
+		ctx = context.WithValue(ctx, CtxPermissions, perms)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -96,3 +119,9 @@ func TenantIDFromCtx(ctx context.Context) (uuid.UUID, bool) {
 	id, ok := ctx.Value(CtxTenantID).(uuid.UUID)
 	return id, ok
 }
+
+// MemberRoleFromCtx returns the practitioner's role in the tenant. ok is false for receptionists.
+func MemberRoleFromCtx(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(CtxMemberRole).(string)
+	return role, ok
+}
@@ -22,8 +22,37 @@ type Appointment struct {
 	CreatedBy    *uuid.UUID `json:"created_by,omitempty"`
 	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
 	CancelReason string     `json:"cancel_reason,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	SeriesID     *uuid.UUID `json:"series_id,omitempty"`
+	RecurrenceID *time.Time `json:"recurrence_id,omitempty"`
+	IsException  bool       `json:"is_exception"`
+	// ScheduleConflict is time_off or holiday when a blackout added after booking covers the
+	// appointment; ScheduleConflictID names the time off or holiday.
+	ScheduleConflict   string     `json:"schedule_conflict,omitempty"`
+	ScheduleConflictID *uuid.UUID `json:"schedule_conflict_id,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// AppointmentSeries is a recurring appointment template. StartsAt is the first
+// occurrence (UTC) and RRule an RFC 5545 recurrence rule evaluated in Timezone.
+type AppointmentSeries struct {
+	ID                uuid.UUID  `json:"id"`
+	TenantID          uuid.UUID  `json:"tenant_id"`
+	PatientID         uuid.UUID  `json:"patient_id"`
+	TherapistID       uuid.UUID  `json:"therapist_id"`
+	Type              string     `json:"type"`
+	RRule             string     `json:"rrule"`
+	StartsAt          time.Time  `json:"starts_at"`
+	DurationMin       int        `json:"duration_min"`
+	Timezone          string     `json:"timezone"`
+	MeetingLink       string     `json:"meeting_link,omitempty"`
+	Location          string     `json:"location,omitempty"`
+	Notes             string     `json:"notes,omitempty"`
+	Status            string     `json:"status"`
+	MaterializedUntil *time.Time `json:"materialized_until,omitempty"`
+	CreatedBy         *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
 type AvailabilitySlot struct {
@@ -34,5 +63,41 @@ type AvailabilitySlot struct {
 	StartTime       string    `json:"start_time"`
 	EndTime         string    `json:"end_time"`
 	SlotDurationMin int       `json:"slot_duration_min"`
+	BufferMin       int       `json:"buffer_min"`
 	IsActive        bool      `json:"is_active"`
 }
+
+// AvailabilityTimeOff blocks a practitioner's calendar between StartsAt and EndsAt (UTC).
+type AvailabilityTimeOff struct {
+	ID          uuid.UUID  `json:"id"`
+	TenantID    uuid.UUID  `json:"tenant_id"`
+	TherapistID uuid.UUID  `json:"therapist_id"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at"`
+	Reason      string     `json:"reason,omitempty"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AvailabilityOverride is extra availability on one date (YYYY-MM-DD, tenant timezone).
+type AvailabilityOverride struct {
+	ID              uuid.UUID `json:"id"`
+	TenantID        uuid.UUID `json:"tenant_id"`
+	TherapistID     uuid.UUID `json:"therapist_id"`
+	Date            string    `json:"date"`
+	StartTime       string    `json:"start_time"`
+	EndTime         string    `json:"end_time"`
+	SlotDurationMin int       `json:"slot_duration_min"`
+	BufferMin       int       `json:"buffer_min"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TenantHoliday closes the whole practice on Date (YYYY-MM-DD, tenant timezone).
+type TenantHoliday struct {
+	ID        uuid.UUID `json:"id"`
+	TenantID  uuid.UUID `json:"tenant_id"`
+	Date      string    `json:"date"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
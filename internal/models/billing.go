@@ -8,45 +8,57 @@ import (
 )
 
 type BillingProfile struct {
-	TenantID           uuid.UUID       `json:"tenant_id"`
-	ConsultationFee    float64         `json:"consultation_fee"`
-	SessionFee         float64         `json:"session_fee"`
-	SessionFeeInPerson float64         `json:"session_fee_in_person"`
-	SessionFeeChat     float64         `json:"session_fee_chat"`
-	SessionFeeVoice    float64         `json:"session_fee_voice"`
-	SessionFeeVideo    float64         `json:"session_fee_video"`
-	PackageFees        json.RawMessage `json:"package_fees,omitempty"`
-	GSTRate            float64         `json:"gst_rate"`
-	InvoicePrefix      string          `json:"invoice_prefix"`
-	Currency           string          `json:"currency"`
-	GSTNumber          string          `json:"gst_number,omitempty"`
-	CreatedAt          time.Time       `json:"created_at"`
-	UpdatedAt          time.Time       `json:"updated_at"`
+	TenantID            uuid.UUID       `json:"tenant_id"`
+	ConsultationFee     float64         `json:"consultation_fee"`
+	SessionFee          float64         `json:"session_fee"`
+	SessionFeeInPerson  float64         `json:"session_fee_in_person"`
+	SessionFeeChat      float64         `json:"session_fee_chat"`
+	SessionFeeVoice     float64         `json:"session_fee_voice"`
+	SessionFeeVideo     float64         `json:"session_fee_video"`
+	PackageFees         json.RawMessage `json:"package_fees,omitempty"` // legacy; packages are session_packages
+	GSTRate             float64         `json:"gst_rate"`
+	InvoicePrefix       string          `json:"invoice_prefix"`
+	InvoiceNumberFormat string          `json:"invoice_number_format"`
+	CreditNotePrefix    string          `json:"credit_note_prefix"`
+	PaymentProvider     string          `json:"payment_provider"`
+	Currency            string          `json:"currency"`
+	GSTNumber           string          `json:"gst_number,omitempty"`
+	SACCode             string          `json:"sac_code"`
+	BusinessAddress     string          `json:"business_address,omitempty"`
+	StateCode           string          `json:"state_code,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
 }
 
 type InvoiceLineItem struct {
 	Description string  `json:"description"`
 	Amount      float64 `json:"amount"`
+	SACCode     string  `json:"sac_code,omitempty"`
 }
 
 type Invoice struct {
-	ID            uuid.UUID         `json:"id"`
-	TenantID      uuid.UUID         `json:"tenant_id"`
-	PatientID     uuid.UUID         `json:"patient_id"`
-	InvoiceNumber string            `json:"invoice_number"`
-	AppointmentID *uuid.UUID        `json:"appointment_id,omitempty"`
-	Subtotal      float64           `json:"subtotal"`
-	GSTAmount     float64           `json:"gst_amount"`
-	Total         float64           `json:"total"`
-	Currency      string            `json:"currency"`
-	Status        string            `json:"status"`
-	DueAt         *time.Time        `json:"due_at,omitempty"`
-	PaidAt        *time.Time        `json:"paid_at,omitempty"`
-	PDFURL        string            `json:"pdf_url,omitempty"`
-	LineItems     []InvoiceLineItem `json:"line_items"`
-	Notes         string            `json:"notes,omitempty"`
-	CreatedAt     time.Time         `json:"created_at"`
-	UpdatedAt     time.Time         `json:"updated_at"`
+	ID             uuid.UUID         `json:"id"`
+	TenantID       uuid.UUID         `json:"tenant_id"`
+	PatientID      uuid.UUID         `json:"patient_id"`
+	InvoiceNumber  string            `json:"invoice_number"`
+	AppointmentID  *uuid.UUID        `json:"appointment_id,omitempty"`
+	Subtotal       float64           `json:"subtotal"`
+	GSTAmount      float64           `json:"gst_amount"`
+	Total          float64           `json:"total"`
+	AmountPaid     float64           `json:"amount_paid"`
+	AmountRefunded float64           `json:"amount_refunded"`
+	BalanceDue     float64           `json:"balance_due"`
+	Currency       string            `json:"currency"`
+	Status         string            `json:"status"`
+	IssuedAt       *time.Time        `json:"issued_at,omitempty"`
+	DueAt          *time.Time        `json:"due_at,omitempty"`
+	PaidAt         *time.Time        `json:"paid_at,omitempty"`
+	PDFURL         string            `json:"pdf_url,omitempty"`
+	LineItems      []InvoiceLineItem `json:"line_items"`
+	Notes          string            `json:"notes,omitempty"`
+	PlaceOfSupply  string            `json:"place_of_supply,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
 }
 
 type Payment struct {
@@ -54,9 +66,103 @@ type Payment struct {
 	TenantID       uuid.UUID `json:"tenant_id"`
 	InvoiceID      uuid.UUID `json:"invoice_id"`
 	Provider       string    `json:"provider"`
+	OrderID        string    `json:"order_id,omitempty"`
 	ExternalID     string    `json:"external_id,omitempty"`
 	Amount         float64   `json:"amount"`
 	Status         string    `json:"status"`
 	RefundedAmount float64   `json:"refunded_amount"`
 	CreatedAt      time.Time `json:"created_at"`
 }
+
+type Refund struct {
+	ID           uuid.UUID  `json:"id"`
+	TenantID     uuid.UUID  `json:"tenant_id"`
+	InvoiceID    uuid.UUID  `json:"invoice_id"`
+	PaymentID    uuid.UUID  `json:"payment_id"`
+	CreditNoteID *uuid.UUID `json:"credit_note_id,omitempty"`
+	Provider     string     `json:"provider"`
+	ExternalID   string     `json:"external_id,omitempty"`
+	Amount       float64    `json:"amount"`
+	Status       string     `json:"status"`
+	Reason       string     `json:"reason,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type CreditNote struct {
+	ID               uuid.UUID `json:"id"`
+	TenantID         uuid.UUID `json:"tenant_id"`
+	InvoiceID        uuid.UUID `json:"invoice_id"`
+	CreditNoteNumber string    `json:"credit_note_number"`
+	Subtotal         float64   `json:"subtotal"`
+	GSTAmount        float64   `json:"gst_amount"`
+	Total            float64   `json:"total"`
+	Currency         string    `json:"currency"`
+	Reason           string    `json:"reason,omitempty"`
+	IssuedAt         time.Time `json:"issued_at"`
+}
+
+// PaymentEvent is a provider webhook delivery recorded in the payment event ledger.
+type PaymentEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	OrderID     string          `json:"order_id,omitempty"`
+	PaymentID   string          `json:"payment_id,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Detail      string          `json:"detail,omitempty"`
+	Attempts    int             `json:"attempts"`
+	OccurredAt  *time.Time      `json:"occurred_at,omitempty"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+}
+
+// SessionPackage is a prepaid bundle of sessions a tenant sells, e.g. 8 sessions valid 90 days.
+// An empty AppointmentType means the credits can be used for any session type.
+type SessionPackage struct {
+	ID              uuid.UUID `json:"id"`
+	TenantID        uuid.UUID `json:"tenant_id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	SessionCount    int       `json:"session_count"`
+	Price           float64   `json:"price"`
+	ValidityDays    int       `json:"validity_days"`
+	AppointmentType string    `json:"appointment_type,omitempty"`
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PatientPackage is a package bought by a patient, with its terms as sold.
+type PatientPackage struct {
+	ID                uuid.UUID  `json:"id"`
+	TenantID          uuid.UUID  `json:"tenant_id"`
+	PatientID         uuid.UUID  `json:"patient_id"`
+	PackageID         *uuid.UUID `json:"package_id,omitempty"`
+	InvoiceID         *uuid.UUID `json:"invoice_id,omitempty"`
+	Name              string     `json:"name"`
+	AppointmentType   string     `json:"appointment_type,omitempty"`
+	SessionsTotal     int        `json:"sessions_total"`
+	SessionsUsed      int        `json:"sessions_used"`
+	SessionsReserved  int        `json:"sessions_reserved"`
+	SessionsAvailable int        `json:"sessions_available"`
+	Price             float64    `json:"price"`
+	ValidityDays      int        `json:"validity_days"`
+	Status            string     `json:"status"`
+	ActivatedAt       *time.Time `json:"activated_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// PackageLedgerEntry is one movement of a patient's package credits.
+type PackageLedgerEntry struct {
+	ID               uuid.UUID  `json:"id"`
+	PatientPackageID uuid.UUID  `json:"patient_package_id"`
+	PatientID        uuid.UUID  `json:"patient_id"`
+	AppointmentID    *uuid.UUID `json:"appointment_id,omitempty"`
+	Entry            string     `json:"entry"`
+	Sessions         int        `json:"sessions"`
+	Revenue          float64    `json:"revenue"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyRotationRun is a pass of the re-encryption job over every encrypted column.
+type KeyRotationRun struct {
+	ID          uuid.UUID             `json:"id"`
+	TargetKeyID string                `json:"target_key_id"`
+	DryRun      bool                  `json:"dry_run"`
+	Status      string                `json:"status"`
+	Error       string                `json:"error,omitempty"`
+	StartedAt   time.Time             `json:"started_at"`
+	HeartbeatAt time.Time             `json:"heartbeat_at"`
+	FinishedAt  *time.Time            `json:"finished_at,omitempty"`
+	Progress    []KeyRotationProgress `json:"progress"`
+}
+
+// KeyRotationProgress is a run's position in one encrypted column. In a dry run Rotated counts
+// the values that would be re-encrypted.
+type KeyRotationProgress struct {
+	Target  string `json:"target"`
+	Total   int    `json:"total"`
+	Scanned int    `json:"scanned"`
+	Rotated int    `json:"rotated"`
+	Failed  int    `json:"failed"`
+	Done    bool   `json:"done"`
+}
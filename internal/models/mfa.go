@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MFAFactor is an enrolled second factor. Secrets and public keys never leave the service.
+type MFAFactor struct {
+	ID          uuid.UUID  `json:"id"`
+	Kind        string     `json:"kind"` // totp, webauthn
+	Name        string     `json:"name"`
+	Confirmed   bool       `json:"confirmed"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
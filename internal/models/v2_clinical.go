@@ -22,6 +22,7 @@ type SessionNote struct {
 	FollowUpRecommendations string             `bson:"follow_up_recommendations,omitempty" json:"follow_up_recommendations,omitempty"`
 	ProgressRating          int                `bson:"progress_rating,omitempty" json:"progress_rating,omitempty"`
 	Attachments             []string           `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	Shared                  bool               `bson:"shared" json:"shared"` // visible to the practice, not just the author
 	CreatedAt               time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt               time.Time          `bson:"updated_at" json:"updated_at"`
 	PublishedAt             *time.Time         `bson:"published_at,omitempty" json:"published_at,omitempty"`
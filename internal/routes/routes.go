@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/AnshRaj112/serenify-backend/internal/handlers"
 	"github.com/AnshRaj112/serenify-backend/internal/middleware"
+	"github.com/AnshRaj112/serenify-backend/internal/services"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -21,6 +22,7 @@ func SetupRoutes(r *chi.Mux) {
 	r.Post("/api/auth/user/signin", handlers.UserSignin)
 	r.Post("/api/auth/therapist/signup", handlers.TherapistSignup)
 	r.Post("/api/auth/therapist/signin", handlers.TherapistSignin)
+	r.Post("/api/auth/therapist/signin/mfa", handlers.TherapistSigninMFA)
 
 	// Therapist status routes
 	r.Get("/api/therapist/status", handlers.CheckTherapistStatus)
@@ -69,6 +71,13 @@ func SetupRoutes(r *chi.Mux) {
 	r.Delete("/api/admin/therapists/reject", handlers.RejectTherapist)
 	r.Get("/api/admin/therapists/{id}/gst", handlers.GetTherapistGSTRate)
 	r.Put("/api/admin/therapists/{id}/gst", handlers.UpdateTherapistGSTRate)
+	r.Get("/api/admin/payment-events", handlers.AdminListPaymentEvents)
+	r.Post("/api/admin/payment-events/{eventId}/replay", handlers.AdminReplayPaymentEvent)
+	r.Post("/api/admin/payment-events/{eventId}/reconcile", handlers.AdminReconcilePaymentEvent)
+	r.Get("/api/admin/encryption/rotations", handlers.AdminListKeyRotations)
+	r.Post("/api/admin/encryption/rotations", handlers.AdminStartKeyRotation)
+	r.Get("/api/admin/encryption/rotations/{runId}", handlers.AdminGetKeyRotation)
+	r.Post("/api/admin/encryption/rotations/{runId}/cancel", handlers.AdminCancelKeyRotation)
 	r.Get("/api/admin/violations", handlers.GetViolations)
 	r.Get("/api/admin/blocked-ips", handlers.GetBlockedIPs)
 	r.Put("/api/admin/unblock-ip", handlers.UnblockIP)
@@ -113,6 +122,29 @@ func SetupRoutes(r *chi.Mux) {
 	// Admin auth routes (signup removed - admin accounts must be created directly in database)
 	// r.Post("/api/admin/signup", handlers.AdminSignup) // Disabled - use database directly
 	r.Post("/api/admin/signin", handlers.AdminSignin)
+	r.Post("/api/admin/signin/mfa", handlers.AdminSigninMFA)
+
+	// Staff MFA. The same handlers serve admins here and therapists/receptionists under their
+	// tenant routes. A sign-in that must enroll first starts enrollment with its X-MFA-Token.
+	r.Get("/api/admin/mfa", handlers.ListMFAFactors)
+	r.Post("/api/admin/mfa/totp", handlers.StartTOTPEnrollment)
+	r.Post("/api/admin/mfa/totp/{factorId}/confirm", handlers.ConfirmTOTPEnrollment)
+	r.Post("/api/admin/mfa/webauthn", handlers.StartWebAuthnRegistration)
+	r.Post("/api/admin/mfa/webauthn/finish", handlers.FinishWebAuthnRegistration)
+	r.Delete("/api/admin/mfa/{factorId}", handlers.DeleteMFAFactor)
+	r.Post("/api/admin/mfa/recovery-codes", handlers.RegenerateMFARecoveryCodes)
+	r.Post("/api/auth/mfa/enroll/totp", handlers.StartTOTPEnrollment)
+	r.Post("/api/auth/mfa/enroll/webauthn", handlers.StartWebAuthnRegistration)
+
+	// Compliance review of the audit log: compliance reviewer accounts only, with a recent MFA
+	r.Route("/api/admin/compliance", func(r chi.Router) {
+		r.Use(middleware.AdminAuth, middleware.RequireRole(services.AdminRoleCompliance), middleware.MFAEnforcer)
+		r.Get("/audit-events", handlers.ComplianceListAuditEvents)
+		r.Get("/audit-events/export", handlers.ComplianceExportAuditEvents)
+		r.Get("/patients/{patientId}/access-report", handlers.CompliancePatientAccessReport)
+		r.Get("/break-glass", handlers.ComplianceListBreakGlass)
+		r.Get("/break-glass/{grantId}", handlers.ComplianceGetBreakGlass)
+	})
 
 	// Group community routes (Telegram-style community system)
 	r.Post("/api/groups", handlers.CreateGroup)
@@ -136,111 +168,218 @@ func SetupRoutes(r *chi.Mux) {
 
 	// V2 P0: JWT refresh + tenant-scoped patient APIs
 	r.Post("/api/v1/auth/refresh", handlers.RefreshTokenV2)
+	r.Post("/api/v1/auth/logout", handlers.LogoutV2)
+	// Active sessions for every role, resolved from the bearer token
+	r.Get("/api/v1/me/sessions", handlers.ListMySessions)
+	r.Post("/api/v1/me/sessions/revoke-others", handlers.RevokeOtherSessions)
+	r.Delete("/api/v1/me/sessions/{sessionId}", handlers.RevokeMySession)
+	r.Get("/.well-known/jwks.json", handlers.JWKS)
+	// Practices the signed-in therapist belongs to, and invitations to join others
+	r.Get("/api/v1/therapist/tenants", handlers.ListMyTenantsV2)
+	r.Get("/api/v1/therapist/tenant-invitations", handlers.ListMyTenantInvitationsV2)
+	r.Post("/api/v1/therapist/tenant-invitations/{invitationId}/accept", handlers.AcceptTenantInvitationV2)
+	r.Post("/api/v1/therapist/tenant-invitations/{invitationId}/decline", handlers.DeclineTenantInvitationV2)
+	// Break-glass: time-boxed, read-only emergency access to one patient's record for a covering
+	// therapist or a platform safety officer, with a recent MFA
+	r.Route("/api/v1/break-glass", func(r chi.Router) {
+		r.Use(middleware.BreakGlassActor, middleware.RequireStaffMFA)
+		r.Post("/", handlers.StartBreakGlassV2)
+		r.Get("/", handlers.ListMyBreakGlassV2)
+		r.Post("/{grantId}/release", handlers.ReleaseBreakGlassV2)
+		r.Route("/{grantId}/patients/{patientId}", func(r chi.Router) {
+			r.Use(middleware.BreakGlassScope)
+			// Every read is flagged with the grant in the PHI access log
+			phi := middleware.PHIAccess
+			r.With(phi("patient")).Get("/", handlers.GetPatientV2)
+			r.With(phi("session_note")).Get("/notes", handlers.ListSessionNotesV2)
+			r.With(phi("session_note")).Get("/notes/{noteId}", handlers.GetSessionNoteV2)
+			r.With(phi("wellness")).Get("/wellness", handlers.ListPatientWellnessV2)
+			r.With(phi("wellness")).Get("/wellness/trends", handlers.WellnessTrendsV2)
+			r.With(phi("journal")).Get("/journals", handlers.ListPatientJournalsV2)
+			r.With(phi("prescription")).Get("/prescriptions", handlers.ListPrescriptionsV2)
+			r.With(phi("task")).Get("/tasks", handlers.ListPatientTasksV2)
+			r.With(phi("ai_insight")).Get("/ai/progress", handlers.AIPatientProgressV2)
+			r.With(phi("ai_insight")).Get("/ai/mood-analysis", handlers.AIMoodAnalysisV2)
+		})
+	})
 	r.Route("/api/v1/tenant/{tenantId}", func(r chi.Router) {
 		r.Use(middleware.TenantAuth)
-		r.Get("/patients", handlers.ListPatientsV2)
-		r.Post("/patients", handlers.CreatePatientV2)
-		r.Get("/patients/{patientId}", handlers.GetPatientV2)
-		r.Patch("/patients/{patientId}", handlers.UpdatePatientV2)
-		r.Delete("/patients/{patientId}", handlers.DeletePatientV2)
+		can := middleware.RequirePermission
+		// Reads and writes of patient health data go to the PHI access log
+		phi := middleware.PHIAccess
+		r.With(can(services.PermPatientsRead), phi("patient")).Get("/patients", handlers.ListPatientsV2)
+		r.With(can(services.PermPatientsWrite), phi("patient")).Post("/patients", handlers.CreatePatientV2)
+		r.With(can(services.PermPatientsRead), phi("patient")).Get("/patients/{patientId}", handlers.GetPatientV2)
+		r.With(can(services.PermPatientsWrite), phi("patient")).Patch("/patients/{patientId}", handlers.UpdatePatientV2)
+		r.With(can(services.PermPatientsWrite), phi("patient")).Delete("/patients/{patientId}", handlers.DeletePatientV2)
 
 		// P1: Session notes
-		r.Get("/patients/{patientId}/notes", handlers.ListSessionNotesV2)
-		r.Post("/patients/{patientId}/notes", handlers.CreateSessionNoteV2)
-		r.Get("/patients/{patientId}/notes/{noteId}", handlers.GetSessionNoteV2)
-		r.Patch("/patients/{patientId}/notes/{noteId}", handlers.UpdateSessionNoteV2)
-		r.Post("/patients/{patientId}/notes/{noteId}/publish", handlers.PublishSessionNoteV2)
-		r.Get("/patients/{patientId}/notes/{noteId}/versions", handlers.ListSessionNoteVersionsV2)
-		r.Get("/notes/search", handlers.SearchSessionNotesV2)
+		r.With(can(services.PermNotesRead), phi("session_note")).Get("/patients/{patientId}/notes", handlers.ListSessionNotesV2)
+		r.With(can(services.PermNotesWrite), phi("session_note")).Post("/patients/{patientId}/notes", handlers.CreateSessionNoteV2)
+		r.With(can(services.PermNotesRead), phi("session_note")).Get("/patients/{patientId}/notes/{noteId}", handlers.GetSessionNoteV2)
+		r.With(can(services.PermNotesWrite), phi("session_note")).Patch("/patients/{patientId}/notes/{noteId}", handlers.UpdateSessionNoteV2)
+		r.With(can(services.PermNotesWrite), phi("session_note")).Post("/patients/{patientId}/notes/{noteId}/publish", handlers.PublishSessionNoteV2)
+		r.With(can(services.PermNotesRead), phi("session_note")).Get("/patients/{patientId}/notes/{noteId}/versions", handlers.ListSessionNoteVersionsV2)
+		r.With(can(services.PermNotesWrite), phi("session_note")).Put("/patients/{patientId}/notes/{noteId}/sharing", handlers.ShareSessionNoteV2)
+		r.With(can(services.PermNotesRead), phi("session_note")).Get("/notes/search", handlers.SearchSessionNotesV2)
 
 		// P1: Wellness (therapist view)
-		r.Get("/patients/wellness", handlers.ListAllPatientsWellnessV2)
-		r.Get("/patients/{patientId}/wellness", handlers.ListPatientWellnessV2)
-		r.Get("/patients/{patientId}/wellness/trends", handlers.WellnessTrendsV2)
+		r.With(can(services.PermClinicalRead), phi("wellness")).Get("/patients/wellness", handlers.ListAllPatientsWellnessV2)
+		r.With(can(services.PermClinicalRead), phi("wellness")).Get("/patients/{patientId}/wellness", handlers.ListPatientWellnessV2)
+		r.With(can(services.PermClinicalRead), phi("wellness")).Get("/patients/{patientId}/wellness/trends", handlers.WellnessTrendsV2)
 
 		// P1: Journals (therapist view + comments)
-		r.Get("/patients/{patientId}/journals", handlers.ListPatientJournalsV2)
-		r.Post("/patients/{patientId}/journals/{journalId}/comments", handlers.CommentOnJournalV2)
+		r.With(can(services.PermClinicalRead), phi("journal")).Get("/patients/{patientId}/journals", handlers.ListPatientJournalsV2)
+		r.With(can(services.PermClinicalWrite), phi("journal")).Post("/patients/{patientId}/journals/{journalId}/comments", handlers.CommentOnJournalV2)
 
 		// P2: Appointments
-		r.Get("/appointments", handlers.ListAppointmentsV2)
-		r.Post("/appointments", handlers.CreateAppointmentV2)
-		r.Get("/appointments/{appointmentId}", handlers.GetAppointmentV2)
-		r.Patch("/appointments/{appointmentId}", handlers.UpdateAppointmentV2)
-		r.Post("/appointments/{appointmentId}/cancel", handlers.CancelAppointmentV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/appointments", handlers.ListAppointmentsV2)
+		r.With(can(services.PermAppointmentsWrite)).Post("/appointments", handlers.CreateAppointmentV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/appointments/{appointmentId}", handlers.GetAppointmentV2)
+		r.With(can(services.PermAppointmentsWrite)).Patch("/appointments/{appointmentId}", handlers.UpdateAppointmentV2)
+		r.With(can(services.PermAppointmentsWrite)).Post("/appointments/{appointmentId}/cancel", handlers.CancelAppointmentV2)
+		r.With(can(services.PermAppointmentsWrite)).Post("/appointment-series", handlers.CreateAppointmentSeriesV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/appointment-series/{seriesId}", handlers.GetAppointmentSeriesV2)
+		r.With(can(services.PermSettingsManage)).Get("/reminders/settings", handlers.GetReminderSettingsV2)
+		r.With(can(services.PermSettingsManage)).Patch("/reminders/settings", handlers.UpdateReminderSettingsV2)
+		r.With(can(services.PermSettingsManage)).Get("/notifications/settings", handlers.GetTherapistNotificationSettingsV2)
+		r.With(can(services.PermSettingsManage)).Put("/notifications/settings", handlers.UpdateTherapistNotificationSettingsV2)
 
 		// P2: Availability
-		r.Get("/availability", handlers.ListAvailabilityV2)
-		r.Post("/availability", handlers.CreateAvailabilityV2)
-		r.Delete("/availability/{slotId}", handlers.DeleteAvailabilityV2)
-		r.Get("/availability/open-slots", handlers.GetOpenSlotsV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/availability", handlers.ListAvailabilityV2)
+		r.With(can(services.PermAvailabilityWrite)).Post("/availability", handlers.CreateAvailabilityV2)
+		r.With(can(services.PermAvailabilityWrite)).Delete("/availability/{slotId}", handlers.DeleteAvailabilityV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/availability/open-slots", handlers.GetOpenSlotsV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/availability/time-off", handlers.ListTimeOffV2)
+		r.With(can(services.PermAvailabilityWrite)).Post("/availability/time-off", handlers.CreateTimeOffV2)
+		r.With(can(services.PermAvailabilityWrite)).Delete("/availability/time-off/{timeOffId}", handlers.DeleteTimeOffV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/availability/overrides", handlers.ListAvailabilityOverridesV2)
+		r.With(can(services.PermAvailabilityWrite)).Post("/availability/overrides", handlers.CreateAvailabilityOverrideV2)
+		r.With(can(services.PermAvailabilityWrite)).Delete("/availability/overrides/{overrideId}", handlers.DeleteAvailabilityOverrideV2)
+		r.With(can(services.PermAppointmentsRead)).Get("/holidays", handlers.ListHolidaysV2)
+		r.With(can(services.PermSettingsManage)).Post("/holidays", handlers.CreateHolidayV2)
+		r.With(can(services.PermSettingsManage)).Post("/holidays/import", handlers.ImportHolidaysV2)
+		r.With(can(services.PermSettingsManage)).Delete("/holidays/{holidayId}", handlers.DeleteHolidayV2)
 
 		// P2: Reception
-		r.Post("/reception/walk-in", handlers.ReceptionWalkInV2)
-		r.Post("/reception/quick-register", handlers.ReceptionQuickRegisterV2)
+		r.With(can(services.PermAppointmentsWrite)).Post("/reception/walk-in", handlers.ReceptionWalkInV2)
+		r.With(can(services.PermPatientsRegister)).Post("/reception/quick-register", handlers.ReceptionQuickRegisterV2)
 
 		// P2: Google Calendar
-		r.Get("/calendar/status", handlers.CalendarStatusV2)
-		r.Get("/calendar/connect/google", handlers.ConnectGoogleCalendarV2)
-		r.Delete("/calendar/disconnect", handlers.DisconnectGoogleCalendarV2)
+		r.With(can(services.PermCalendarManage)).Get("/calendar/status", handlers.CalendarStatusV2)
+		r.With(can(services.PermCalendarManage)).Get("/calendar/connect/google", handlers.ConnectGoogleCalendarV2)
+		r.With(can(services.PermCalendarManage)).Get("/calendar/connect/microsoft", handlers.ConnectMicrosoftCalendarV2)
+		r.With(can(services.PermCalendarManage)).Post("/calendar/connect/caldav", handlers.ConnectCalDAVCalendarV2)
+		r.With(can(services.PermCalendarManage)).Delete("/calendar/disconnect", handlers.DisconnectCalendarV2)
+		// ICS subscription feed of the signed-in practitioner's sessions
+		r.With(can(services.PermCalendarManage)).Get("/calendar/feed", handlers.GetMyTherapistCalendarFeedV2)
+		r.With(can(services.PermCalendarManage)).Post("/calendar/feed/rotate", handlers.RotateMyTherapistCalendarFeedV2)
+		r.With(can(services.PermCalendarManage)).Delete("/calendar/feed", handlers.RevokeMyTherapistCalendarFeedV2)
 
 		// P3: Prescriptions
-		r.Get("/patients/{patientId}/prescriptions", handlers.ListPrescriptionsV2)
-		r.Post("/patients/{patientId}/prescriptions", handlers.CreatePrescriptionV2)
-		r.Patch("/prescriptions/{rxId}", handlers.UpdatePrescriptionV2)
+		r.With(can(services.PermClinicalRead), phi("prescription")).Get("/patients/{patientId}/prescriptions", handlers.ListPrescriptionsV2)
+		r.With(can(services.PermClinicalWrite), phi("prescription")).Post("/patients/{patientId}/prescriptions", handlers.CreatePrescriptionV2)
+		r.With(can(services.PermClinicalWrite), phi("prescription")).Patch("/prescriptions/{rxId}", handlers.UpdatePrescriptionV2)
 
 		// P3: Tasks
-		r.Get("/patients/{patientId}/tasks", handlers.ListPatientTasksV2)
-		r.Post("/patients/{patientId}/tasks", handlers.CreateTaskV2)
-		r.Patch("/tasks/{taskId}", handlers.UpdateTaskV2)
+		r.With(can(services.PermClinicalRead), phi("task")).Get("/patients/{patientId}/tasks", handlers.ListPatientTasksV2)
+		r.With(can(services.PermClinicalWrite), phi("task")).Post("/patients/{patientId}/tasks", handlers.CreateTaskV2)
+		r.With(can(services.PermClinicalWrite), phi("task")).Patch("/tasks/{taskId}", handlers.UpdateTaskV2)
 
 		// P3: Messaging
-		r.Get("/conversations", handlers.ListConversationsV2)
-		r.Get("/patients/{patientId}/conversation", handlers.GetOrCreatePatientConversationV2)
-		r.Get("/conversations/{conversationId}/messages", handlers.ListConversationMessagesV2)
-		r.Post("/conversations/{conversationId}/messages", handlers.SendConversationMessageV2)
-		r.Patch("/conversations/{conversationId}/read", handlers.MarkConversationReadV2)
+		r.With(can(services.PermMessagesRead)).Get("/conversations", handlers.ListConversationsV2)
+		r.With(can(services.PermMessagesWrite), phi("conversation")).Get("/patients/{patientId}/conversation", handlers.GetOrCreatePatientConversationV2)
+		r.With(can(services.PermMessagesRead), phi("conversation")).Get("/conversations/{conversationId}/messages", handlers.ListConversationMessagesV2)
+		r.With(can(services.PermMessagesWrite), phi("conversation")).Post("/conversations/{conversationId}/messages", handlers.SendConversationMessageV2)
+		r.With(can(services.PermMessagesRead)).Patch("/conversations/{conversationId}/read", handlers.MarkConversationReadV2)
 
 		// P4: Billing
-		r.Get("/billing/profile", handlers.GetBillingProfileV2)
-		r.Patch("/billing/profile", handlers.UpdateBillingProfileV2)
-		r.Get("/invoices", handlers.ListInvoicesV2)
-		r.Post("/invoices", handlers.CreateInvoiceV2)
-		r.Get("/invoices/{invoiceId}", handlers.GetInvoiceV2)
-		r.Post("/invoices/{invoiceId}/send", handlers.SendInvoiceV2)
-		r.Get("/invoices/{invoiceId}/pdf", handlers.GenerateInvoicePDFV2)
-		r.Post("/payments/initiate", handlers.InitiatePaymentV2)
-		r.Post("/payments/verify", handlers.VerifyPaymentV2)
-		r.Get("/payments", handlers.ListPaymentsV2)
-		r.Post("/reception/collect-payment", handlers.ReceptionCollectPaymentV2)
+		r.With(can(services.PermInvoicesRead)).Get("/billing/profile", handlers.GetBillingProfileV2)
+		r.With(can(services.PermBillingManage)).Patch("/billing/profile", handlers.UpdateBillingProfileV2)
+		r.With(can(services.PermInvoicesRead)).Get("/invoices", handlers.ListInvoicesV2)
+		r.With(can(services.PermInvoicesWrite)).Post("/invoices", handlers.CreateInvoiceV2)
+		r.With(can(services.PermInvoicesRead)).Get("/invoices/{invoiceId}", handlers.GetInvoiceV2)
+		r.With(can(services.PermInvoicesWrite)).Post("/invoices/{invoiceId}/send", handlers.SendInvoiceV2)
+		r.With(can(services.PermInvoicesRead)).Get("/invoices/{invoiceId}/pdf", handlers.GenerateInvoicePDFV2)
+		r.With(can(services.PermInvoicesRefund)).Post("/invoices/{invoiceId}/refunds", handlers.CreateInvoiceRefundV2)
+		r.With(can(services.PermInvoicesRead)).Get("/invoices/{invoiceId}/refunds", handlers.ListInvoiceRefundsV2)
+		r.With(can(services.PermInvoicesRead)).Get("/credit-notes/{creditNoteId}/pdf", handlers.GetCreditNotePDFV2)
+		r.With(can(services.PermInvoicesCollect)).Post("/payments/initiate", handlers.InitiatePaymentV2)
+		r.With(can(services.PermInvoicesCollect)).Post("/payments/verify", handlers.VerifyPaymentV2)
+		r.With(can(services.PermInvoicesRead)).Get("/payments", handlers.ListPaymentsV2)
+		r.With(can(services.PermInvoicesCollect)).Post("/reception/collect-payment", handlers.ReceptionCollectPaymentV2)
+		r.With(can(services.PermPackagesRead)).Get("/packages", handlers.ListSessionPackagesV2)
+		r.With(can(services.PermPackagesWrite)).Post("/packages", handlers.CreateSessionPackageV2)
+		r.With(can(services.PermPackagesWrite)).Patch("/packages/{packageId}", handlers.UpdateSessionPackageV2)
+		r.With(can(services.PermPackagesRead)).Get("/patients/{patientId}/packages", handlers.ListPatientPackagesV2)
+		r.With(can(services.PermPackagesSell)).Post("/patients/{patientId}/packages", handlers.SellPatientPackageV2)
 
 		// P5: Analytics
-		r.Get("/analytics/overview", handlers.AnalyticsOverviewV2)
-		r.Get("/analytics/revenue", handlers.AnalyticsRevenueV2)
-		r.Get("/analytics/appointments", handlers.AnalyticsAppointmentsV2)
-		r.Get("/analytics/wellness-trends", handlers.AnalyticsWellnessTrendsV2)
+		r.With(can(services.PermAnalyticsRead)).Get("/analytics/overview", handlers.AnalyticsOverviewV2)
+		r.With(can(services.PermAnalyticsRead)).Get("/analytics/revenue", handlers.AnalyticsRevenueV2)
+		r.With(can(services.PermAnalyticsRead)).Get("/analytics/appointments", handlers.AnalyticsAppointmentsV2)
+		r.With(can(services.PermAnalyticsRead)).Get("/analytics/wellness-trends", handlers.AnalyticsWellnessTrendsV2)
 
 		// P5: AI Copilot (rule-based insights)
-		r.Post("/ai/summarize-session", handlers.AISummarizeSessionV2)
-		r.Get("/patients/{patientId}/ai/progress", handlers.AIPatientProgressV2)
-		r.Get("/patients/{patientId}/ai/mood-analysis", handlers.AIMoodAnalysisV2)
-		r.Get("/ai/risk-alerts", handlers.AIRiskAlertsV2)
+		r.With(can(services.PermClinicalRead), phi("ai_insight")).Post("/ai/summarize-session", handlers.AISummarizeSessionV2)
+		r.With(can(services.PermClinicalRead), phi("ai_insight")).Get("/patients/{patientId}/ai/progress", handlers.AIPatientProgressV2)
+		r.With(can(services.PermClinicalRead), phi("ai_insight")).Get("/patients/{patientId}/ai/mood-analysis", handlers.AIMoodAnalysisV2)
+		r.With(can(services.PermClinicalRead), phi("ai_insight")).Get("/ai/risk-alerts", handlers.AIRiskAlertsV2)
 
 		// ── Therapist-managed Receptionist Staff ────────────────
-		r.Post("/receptionists", handlers.TherapistCreateReceptionist)
-		r.Get("/receptionists", handlers.TherapistListReceptionists)
-		r.Delete("/receptionists/{receptionistId}", handlers.TherapistDeactivateReceptionist)
-		r.Patch("/receptionists/{receptionistId}/reactivate", handlers.TherapistReactivateReceptionist)
+		r.With(can(services.PermStaffManage)).Post("/receptionists", handlers.TherapistCreateReceptionist)
+		r.With(can(services.PermStaffManage)).Get("/receptionists", handlers.TherapistListReceptionists)
+		r.With(can(services.PermStaffManage)).Delete("/receptionists/{receptionistId}", handlers.TherapistDeactivateReceptionist)
+		r.With(can(services.PermStaffManage)).Patch("/receptionists/{receptionistId}/reactivate", handlers.TherapistReactivateReceptionist)
+
+		// Security: the therapist's own MFA factors, and whether receptionists must use MFA
+		r.Get("/mfa", handlers.ListMFAFactors)
+		r.Post("/mfa/totp", handlers.StartTOTPEnrollment)
+		r.Post("/mfa/totp/{factorId}/confirm", handlers.ConfirmTOTPEnrollment)
+		r.Post("/mfa/webauthn", handlers.StartWebAuthnRegistration)
+		r.Post("/mfa/webauthn/finish", handlers.FinishWebAuthnRegistration)
+		r.Delete("/mfa/{factorId}", handlers.DeleteMFAFactor)
+		r.Post("/mfa/recovery-codes", handlers.RegenerateMFARecoveryCodes)
+		r.With(can(services.PermSettingsManage)).Get("/security/settings", handlers.GetSecuritySettingsV2)
+		r.With(can(services.PermSettingsManage)).Put("/security/settings", handlers.UpdateSecuritySettingsV2)
+
+		// Staff roles and permissions
+		r.Get("/permissions", handlers.ListPermissionsV2)
+		r.Get("/me/permissions", handlers.MyPermissionsV2)
+		r.With(can(services.PermStaffManage)).Get("/roles", handlers.ListStaffRolesV2)
+		r.With(can(services.PermStaffManage)).Post("/roles", handlers.CreateStaffRoleV2)
+		r.With(can(services.PermStaffManage)).Patch("/roles/{roleKey}", handlers.UpdateStaffRoleV2)
+		r.With(can(services.PermStaffManage)).Delete("/roles/{roleKey}", handlers.DeleteStaffRoleV2)
+		r.With(can(services.PermStaffManage)).Get("/staff/{staffId}/roles", handlers.GetStaffMemberRolesV2)
+		r.With(can(services.PermStaffManage)).Put("/staff/{staffId}/roles", handlers.SetStaffMemberRolesV2)
+
+		// Practitioners sharing the tenant; membership is managed by the owner and tenant admins
+		r.Get("/members", handlers.ListTenantMembersV2)
+		r.With(middleware.RequireTenantAdmin).Patch("/members/{therapistId}", handlers.UpdateTenantMemberV2)
+		r.With(middleware.RequireTenantAdmin).Delete("/members/{therapistId}", handlers.RemoveTenantMemberV2)
+		r.With(middleware.RequireTenantAdmin).Get("/invitations", handlers.ListTenantInvitationsV2)
+		r.With(middleware.RequireTenantAdmin).Post("/invitations", handlers.InviteTenantMemberV2)
+		r.With(middleware.RequireTenantAdmin).Delete("/invitations/{invitationId}", handlers.RevokeTenantInvitationV2)
+
+		// Emergency access to the practice's patients from outside it, for the owner and admins to review
+		r.With(middleware.RequireTenantAdmin).Get("/break-glass", handlers.ListTenantBreakGlassV2)
+		r.With(middleware.RequireTenantAdmin).Post("/break-glass/{grantId}/approve", handlers.ApproveBreakGlassV2)
+		r.With(middleware.RequireTenantAdmin).Post("/break-glass/{grantId}/revoke", handlers.RevokeBreakGlassV2)
 	})
 
-	// P2: Google OAuth callback (no tenant prefix)
+	// P2: calendar OAuth callbacks (no tenant prefix)
 	r.Get("/api/v1/calendar/oauth/callback", handlers.GoogleCalendarCallback)
+	r.Get("/api/v1/calendar/oauth/microsoft/callback", handlers.MicrosoftCalendarCallback)
+	// Google Calendar push notifications; checked against the watch channel's secret
+	r.Post("/api/v1/calendar/google/notifications", handlers.GoogleCalendarNotification)
+	// ICS subscription feeds; the secret token in the path is the credential
+	r.Get("/api/v1/calendar/feeds/{token}", handlers.CalendarFeedICS)
 
 	// P3: 1:1 DM WebSocket
 	r.Get("/ws/v1/tenant/{tenantId}/dm", handlers.DMWebSocket)
 
-	// P4: Razorpay webhook (no auth)
-	r.Post("/api/v1/webhooks/razorpay", handlers.RazorpayWebhookV2)
+	// P4: Payment provider webhooks (no auth; signed by the provider)
+	r.Post("/api/v1/webhooks/{provider}", handlers.PaymentWebhookV2)
 
 	// P1: Patient self-service
 	r.Route("/api/v1/patient/me", func(r chi.Router) {
@@ -260,6 +399,16 @@ func SetupRoutes(r *chi.Mux) {
 		r.Get("/invoices", handlers.ListMyInvoicesV2)
 		r.Post("/invoices/{invoiceId}/pay", handlers.PayMyInvoiceV2)
 		r.Post("/payments/verify", handlers.VerifyPatientPaymentV2)
+		r.Get("/packages", handlers.ListMyPackagesV2)
+		r.Get("/packages/catalog", handlers.ListPackageCatalogV2)
+		r.Post("/packages/{packageId}/purchase", handlers.BuyPackageV2)
+		r.Get("/notifications/settings", handlers.GetMyNotificationSettingsV2)
+		r.Put("/notifications/settings", handlers.UpdateMyNotificationSettingsV2)
+		r.Get("/calendar/feed", handlers.GetMyPatientCalendarFeedV2)
+		r.Post("/calendar/feed/rotate", handlers.RotateMyPatientCalendarFeedV2)
+		r.Delete("/calendar/feed", handlers.RevokeMyPatientCalendarFeedV2)
+		// Who read or changed this patient's record
+		r.Get("/access-log", handlers.ListMyRecordAccessV2)
 
 		// Direct Booking & Availability check
 		r.Get("/therapists/{therapistId}/availability", handlers.GetTherapistAvailabilityForPatientV2)
@@ -269,6 +418,7 @@ func SetupRoutes(r *chi.Mux) {
 
 	// ── Receptionist Auth (public — no tenant prefix required) ──────────────────
 	r.Post("/api/auth/receptionist/signin", handlers.ReceptionistSignin)
+	r.Post("/api/auth/receptionist/signin/mfa", handlers.ReceptionistSigninMFA)
 	r.Post("/api/auth/receptionist/signout", handlers.ReceptionistSignout)
 
 
@@ -276,20 +426,42 @@ func SetupRoutes(r *chi.Mux) {
 	// ── Reception Portal (all endpoints under ReceptionistAuth) ────────────────
 	r.Route("/api/v1/reception/{tenantId}", func(r chi.Router) {
 		r.Use(middleware.ReceptionistAuth)
+		can := middleware.RequirePermission
 
 		// Appointments — full calendar view + walk-in creation
-		r.Get("/appointments", handlers.ReceptionListAppointments)
-		r.Post("/appointments/walk-in", handlers.ReceptionWalkIn)
-		r.Post("/appointments/quick-register", handlers.ReceptionQuickRegister)
+		r.With(can(services.PermAppointmentsRead)).Get("/appointments", handlers.ReceptionListAppointments)
+		r.With(can(services.PermAppointmentsWrite)).Post("/appointments/walk-in", handlers.ReceptionWalkIn)
+		r.With(can(services.PermPatientsRegister)).Post("/appointments/quick-register", handlers.ReceptionQuickRegister)
 
 		// Patients — list only (no clinical data)
-		r.Get("/patients", handlers.ReceptionListPatients)
+		r.With(can(services.PermPatientsRead), middleware.PHIAccess("patient")).Get("/patients", handlers.ReceptionListPatients)
 
 		// Billing — view invoices + collect payment
-		r.Get("/invoices", handlers.ReceptionListInvoices)
-		r.Post("/invoices/collect-payment", handlers.ReceptionCollectPayment)
+		r.With(can(services.PermInvoicesRead)).Get("/invoices", handlers.ReceptionListInvoices)
+		r.With(can(services.PermInvoicesCollect)).Post("/invoices/collect-payment", handlers.ReceptionCollectPayment)
+
+		// Session packages — catalog, patient balances, sales at the desk
+		r.With(can(services.PermPackagesRead)).Get("/packages", handlers.ReceptionListPackages)
+		r.With(can(services.PermPackagesRead)).Get("/patients/{patientId}/packages", handlers.ReceptionListPatientPackages)
+		r.With(can(services.PermPackagesSell)).Post("/patients/{patientId}/packages", handlers.ReceptionSellPackage)
 
 		// Referrals — read-only
-		r.Get("/referral-codes", handlers.ReceptionListReferralCodes)
+		r.With(can(services.PermReferralsRead)).Get("/referral-codes", handlers.ReceptionListReferralCodes)
+
+		// What the signed-in receptionist's roles allow
+		r.Get("/me/permissions", handlers.MyPermissionsV2)
+
+		// Notification preferences for the signed-in receptionist
+		r.Get("/notifications/settings", handlers.ReceptionGetNotificationSettings)
+		r.Put("/notifications/settings", handlers.ReceptionUpdateNotificationSettings)
+
+		// MFA factors for the signed-in receptionist
+		r.Get("/mfa", handlers.ListMFAFactors)
+		r.Post("/mfa/totp", handlers.StartTOTPEnrollment)
+		r.Post("/mfa/totp/{factorId}/confirm", handlers.ConfirmTOTPEnrollment)
+		r.Post("/mfa/webauthn", handlers.StartWebAuthnRegistration)
+		r.Post("/mfa/webauthn/finish", handlers.FinishWebAuthnRegistration)
+		r.Delete("/mfa/{factorId}", handlers.DeleteMFAFactor)
+		r.Post("/mfa/recovery-codes", handlers.RegenerateMFARecoveryCodes)
 	})
 }
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
 	"fmt"
 	"time"
@@ -18,6 +19,12 @@ const (
 	AdminSessionKeyPrefix = "admin_session:"
 	// AdminToSessionKeyPrefix is the Redis key prefix for admin->session mapping
 	AdminToSessionKeyPrefix = "admin_to_session:"
+
+	// Admin account roles. Compliance reviewers only reach the audit review API; safety officers
+	// only open break-glass access to patient records.
+	AdminRoleAdmin      = "admin"
+	AdminRoleCompliance = "compliance"
+	AdminRoleSafety     = "safety"
 )
 
 // CreateAdminSession creates a new session for an admin and stores it in Redis.
@@ -69,10 +76,25 @@ func ValidateAdminSession(sessionToken string) (uuid.UUID, bool, error) {
 	if err != nil {
 		return uuid.Nil, false, err
 	}
+	touchOpaqueSession(sessionToken)
 
 	return adminID, true, nil
 }
 
+// AdminRole returns the role of an active admin account; ok is false when the account is missing
+// or inactive.
+func AdminRole(adminID uuid.UUID) (role string, ok bool, err error) {
+	var active bool
+	err = database.PostgresDB.QueryRow(`SELECT role, is_active FROM admins WHERE id = $1`, adminID).Scan(&role, &active)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return role, active, nil
+}
+
 // RefreshAdminSession extends the session expiration by 7 days from now.
 func RefreshAdminSession(sessionToken string) error {
 	if sessionToken == "" {
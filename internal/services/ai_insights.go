@@ -163,7 +163,9 @@ func CountPublishedNotes(tenantID, patientID uuid.UUID) int {
 	return int(n)
 }
 
-func GetSessionNotePlainText(noteID string) (string, int, error) {
+// GetSessionNotePlainText returns a note of the tenant that viewerID may read (see
+// SessionNoteVisibility).
+func GetSessionNotePlainText(tenantID uuid.UUID, noteID, viewerID string) (string, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	oid, err := primitive.ObjectIDFromHex(noteID)
@@ -174,6 +176,19 @@ func GetSessionNotePlainText(noteID string) (string, int, error) {
 		PlainText       string `bson:"plain_text"`
 		ProgressRating  int    `bson:"progress_rating"`
 	}
-	err = database.DB.Collection("session_notes").FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	filter := SessionNoteVisibility(viewerID)
+	filter["_id"] = oid
+	filter["tenant_id"] = tenantID.String()
+	err = database.DB.Collection("session_notes").FindOne(ctx, filter).Decode(&doc)
 	return doc.PlainText, doc.ProgressRating, err
 }
+
+// SessionNoteVisibility is the session_notes filter for notes viewerID may read: their own and
+// those shared with the practice. Staff who are not practitioners pass "" and see shared notes
+// only.
+func SessionNoteVisibility(viewerID string) bson.M {
+	if viewerID == "" {
+		return bson.M{"shared": true}
+	}
+	return bson.M{"$or": bson.A{bson.M{"therapist_id": viewerID}, bson.M{"shared": true}}}
+}
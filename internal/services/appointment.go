@@ -1,6 +1,7 @@
 package services
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -17,28 +18,50 @@ func ValidateAppointmentType(t string) bool {
 	return validAptTypes[t]
 }
 
-func TherapistHasConflict(therapistID uuid.UUID, startsAt, endsAt time.Time, excludeID *uuid.UUID) (bool, error) {
-	query := `
-		SELECT EXISTS(
-			SELECT 1 FROM appointments
-			WHERE therapist_id = $1 AND status NOT IN ('cancelled', 'no_show', 'pending_payment')
-			AND starts_at < $3 AND ends_at > $2
-	`
-	args := []interface{}{therapistID, startsAt, endsAt}
+// therapistConflictQuery reports whether the therapist is booked between $2 and $3, ignoring
+// appointment $4. Slots held for a patient who is paying count as taken.
+const therapistConflictQuery = `
+	SELECT EXISTS(
+		SELECT 1 FROM appointments
+		WHERE therapist_id = $1 AND status NOT IN ('cancelled', 'no_show', 'pending_payment')
+		AND starts_at < $3 AND ends_at > $2
+		AND ($4::uuid IS NULL OR id != $4)
+	) OR EXISTS(
+		SELECT 1 FROM slot_holds
+		WHERE therapist_id = $1 AND status = 'held' AND expires_at > NOW()
+		AND starts_at AT TIME ZONE 'UTC' < $3 AND ends_at AT TIME ZONE 'UTC' > $2
+		AND ($4::uuid IS NULL OR appointment_id IS DISTINCT FROM $4)
+	)
+`
+
+func therapistConflictArgs(therapistID uuid.UUID, startsAt, endsAt time.Time, excludeID *uuid.UUID) []interface{} {
+	args := []interface{}{therapistID, startsAt, endsAt, uuid.NullUUID{}}
 	if excludeID != nil {
-		query += ` AND id != $4`
-		args = append(args, *excludeID)
+		args[3] = uuid.NullUUID{UUID: *excludeID, Valid: true}
 	}
-	query += `)`
+	return args
+}
+
+func TherapistHasConflict(therapistID uuid.UUID, startsAt, endsAt time.Time, excludeID *uuid.UUID) (bool, error) {
+	var exists bool
+	err := database.PostgresDB.QueryRow(therapistConflictQuery,
+		therapistConflictArgs(therapistID, startsAt, endsAt, excludeID)...).Scan(&exists)
+	return exists, err
+}
+
+// therapistHasConflictTx is TherapistHasConflict inside tx, so it sees the tx's own writes.
+func therapistHasConflictTx(tx *sql.Tx, therapistID uuid.UUID, startsAt, endsAt time.Time, excludeID *uuid.UUID) (bool, error) {
 	var exists bool
-	err := database.PostgresDB.QueryRow(query, args...).Scan(&exists)
+	err := tx.QueryRow(therapistConflictQuery,
+		therapistConflictArgs(therapistID, startsAt, endsAt, excludeID)...).Scan(&exists)
 	return exists, err
 }
 
+// TherapistInTenant reports whether the therapist is an active practitioner of the tenant.
 func TherapistInTenant(tenantID, therapistID uuid.UUID) bool {
 	var ok bool
 	_ = database.PostgresDB.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM tenants WHERE id = $1 AND therapist_id = $2)
+		SELECT EXISTS(SELECT 1 FROM tenant_members WHERE tenant_id = $1 AND therapist_id = $2 AND is_active = TRUE)
 	`, tenantID, therapistID).Scan(&ok)
 	return ok
 }
@@ -0,0 +1,630 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// seriesHorizon is how far ahead recurring occurrences are materialized into appointments.
+	seriesHorizon = 180 * 24 * time.Hour
+	// maxSeriesOccurrences caps the rows created for one series in a single materialization pass.
+	maxSeriesOccurrences = 200
+)
+
+// Scopes for editing or cancelling an occurrence of a series.
+const (
+	SeriesScopeThis      = "this"
+	SeriesScopeFollowing = "following"
+	SeriesScopeAll       = "all"
+)
+
+var (
+	ErrSeriesNotFound = errors.New("appointment series not found")
+	ErrSeriesInactive = errors.New("appointment series is not active")
+)
+
+// SeriesConflict is an occurrence that was skipped because the therapist was already booked.
+type SeriesConflict struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// SeriesEdit holds the fields changed by a "this and following" or "all" edit.
+// Zero values leave the series template untouched.
+type SeriesEdit struct {
+	Type        string
+	StartsAt    *time.Time
+	DurationMin int
+	RRule       string
+	MeetingLink string
+	Location    string
+	Notes       string
+}
+
+const seriesColumns = `id, tenant_id, patient_id, therapist_id, type, rrule, starts_at, duration_min, timezone,
+	meeting_link, location, notes, status, materialized_until, created_by, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSeries(row rowScanner) (models.AppointmentSeries, error) {
+	var s models.AppointmentSeries
+	var meeting, location, notes sql.NullString
+	var materialized sql.NullTime
+	var createdBy uuid.NullUUID
+	err := row.Scan(
+		&s.ID, &s.TenantID, &s.PatientID, &s.TherapistID, &s.Type, &s.RRule, &s.StartsAt, &s.DurationMin,
+		&s.Timezone, &meeting, &location, &notes, &s.Status, &materialized, &createdBy, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return s, err
+	}
+	s.MeetingLink = meeting.String
+	s.Location = location.String
+	s.Notes = notes.String
+	if materialized.Valid {
+		t := materialized.Time
+		s.MaterializedUntil = &t
+	}
+	if createdBy.Valid {
+		id := createdBy.UUID
+		s.CreatedBy = &id
+	}
+	return s, nil
+}
+
+func GetAppointmentSeries(tenantID, seriesID uuid.UUID) (models.AppointmentSeries, error) {
+	s, err := scanSeries(database.PostgresDB.QueryRow(
+		`SELECT `+seriesColumns+` FROM appointment_series WHERE id = $1 AND tenant_id = $2`, seriesID, tenantID,
+	))
+	if err == sql.ErrNoRows {
+		return s, ErrSeriesNotFound
+	}
+	return s, err
+}
+
+// seriesChanges are the appointments a series write touched. Their calendar sync and reminders
+// are queued once the write has committed.
+type seriesChanges struct {
+	tenantID  uuid.UUID
+	created   []uuid.UUID
+	updated   []uuid.UUID
+	cancelled []uuid.UUID
+}
+
+func (c seriesChanges) publish() {
+	for _, id := range c.created {
+		EnqueueCalendarSync("create", c.tenantID, id)
+		ScheduleAppointmentReminders(c.tenantID, id)
+	}
+	for _, id := range c.updated {
+		EnqueueCalendarSync("update", c.tenantID, id)
+	}
+	for _, id := range c.cancelled {
+		EnqueueCalendarSync("delete", c.tenantID, id)
+		ScheduleAppointmentReminders(c.tenantID, id)
+	}
+}
+
+// CreateAppointmentSeries stores a new series and materializes its occurrences for the
+// booking horizon. Occurrences that clash with the therapist's calendar are skipped and returned.
+func CreateAppointmentSeries(s models.AppointmentSeries) (models.AppointmentSeries, []SeriesConflict, error) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return s, nil, err
+	}
+	defer tx.Rollback()
+	changes := seriesChanges{tenantID: s.TenantID}
+	s, conflicts, err := createSeries(tx, s, &changes)
+	if err != nil {
+		return s, conflicts, err
+	}
+	if err := tx.Commit(); err != nil {
+		return s, conflicts, err
+	}
+	changes.publish()
+	return s, conflicts, nil
+}
+
+func createSeries(tx *sql.Tx, s models.AppointmentSeries, changes *seriesChanges) (models.AppointmentSeries, []SeriesConflict, error) {
+	rule, err := ParseRecurrenceRule(s.RRule)
+	if err != nil {
+		return s, nil, err
+	}
+	s.RRule = rule.String()
+	s.StartsAt = s.StartsAt.UTC()
+	if s.DurationMin <= 0 {
+		s.DurationMin = 60
+	}
+	if s.Timezone == "" {
+		s.Timezone = TenantLocation(s.TenantID).String()
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO appointment_series (
+			tenant_id, patient_id, therapist_id, type, rrule, starts_at, duration_min, timezone,
+			meeting_link, location, notes, created_by
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9,''),NULLIF($10,''),NULLIF($11,''),$12)
+		RETURNING id, status, created_at, updated_at
+	`, s.TenantID, s.PatientID, s.TherapistID, s.Type, s.RRule, s.StartsAt, s.DurationMin, s.Timezone,
+		s.MeetingLink, s.Location, s.Notes, s.CreatedBy).Scan(&s.ID, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, nil, err
+	}
+
+	conflicts, err := materializeSeries(tx, &s, s.StartsAt, time.Now().UTC().Add(seriesHorizon), changes)
+	return s, conflicts, err
+}
+
+// MaterializeSeries creates appointments for occurrences starting in [from, until) that do not
+// exist yet. Each occurrence goes through TherapistHasConflict and is queued for calendar sync.
+func MaterializeSeries(s *models.AppointmentSeries, from, until time.Time) ([]SeriesConflict, error) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	changes := seriesChanges{tenantID: s.TenantID}
+	conflicts, err := materializeSeries(tx, s, from, until, &changes)
+	if err != nil {
+		return conflicts, err
+	}
+	if err := tx.Commit(); err != nil {
+		return conflicts, err
+	}
+	changes.publish()
+	return conflicts, nil
+}
+
+func materializeSeries(tx *sql.Tx, s *models.AppointmentSeries, from, until time.Time, changes *seriesChanges) ([]SeriesConflict, error) {
+	conflicts := make([]SeriesConflict, 0)
+	rule, err := ParseRecurrenceRule(s.RRule)
+	if err != nil {
+		return conflicts, err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	existing, err := seriesOccurrenceSet(tx, s.ID)
+	if err != nil {
+		return conflicts, err
+	}
+
+	duration := DefaultDuration(s.DurationMin)
+	reached := until
+	created := 0
+	for _, start := range rule.Expand(s.StartsAt, loc, until, 0) {
+		if start.Before(from) || existing[start.Unix()] {
+			continue
+		}
+		if created >= maxSeriesOccurrences {
+			reached = start
+			break
+		}
+		end := start.Add(duration)
+		conflict, err := therapistHasConflictTx(tx, s.TherapistID, start, end, nil)
+		if err != nil {
+			return conflicts, err
+		}
+		if conflict {
+			conflicts = append(conflicts, SeriesConflict{StartsAt: start, EndsAt: end})
+			continue
+		}
+
+		var id uuid.UUID
+		err = tx.QueryRow(`
+			INSERT INTO appointments (
+				tenant_id, patient_id, therapist_id, type, status, starts_at, ends_at,
+				meeting_link, location, notes, created_by, series_id, recurrence_id
+			) VALUES ($1,$2,$3,$4,'scheduled',$5,$6,NULLIF($7,''),NULLIF($8,''),NULLIF($9,''),$10,$11,$5)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, s.TenantID, s.PatientID, s.TherapistID, s.Type, start, end,
+			s.MeetingLink, s.Location, s.Notes, s.CreatedBy, s.ID).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return conflicts, err
+		}
+		changes.created = append(changes.created, id)
+		created++
+	}
+
+	_, err = tx.Exec(`
+		UPDATE appointment_series SET materialized_until = $2, updated_at = NOW() WHERE id = $1
+	`, s.ID, reached)
+	s.MaterializedUntil = &reached
+	return conflicts, err
+}
+
+// seriesOccurrenceSet returns the recurrence IDs (unix seconds) that must not be generated again:
+// live occurrences and explicitly cancelled exceptions.
+func seriesOccurrenceSet(tx *sql.Tx, seriesID uuid.UUID) (map[int64]bool, error) {
+	rows, err := tx.Query(`
+		SELECT recurrence_id FROM appointments
+		WHERE series_id = $1 AND recurrence_id IS NOT NULL AND (status <> 'cancelled' OR is_exception)
+	`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]bool{}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out[t.Unix()] = true
+	}
+	return out, rows.Err()
+}
+
+// EditSeriesFollowing applies edit to apt and every later occurrence by ending the current
+// series just before apt and starting a new series from it, all in one transaction.
+func EditSeriesFollowing(apt models.Appointment, edit SeriesEdit) (models.AppointmentSeries, []SeriesConflict, error) {
+	s, err := activeSeriesFor(apt)
+	if err != nil {
+		return s, nil, err
+	}
+	pivot := occurrenceKey(apt)
+
+	rule, err := ParseRecurrenceRule(s.RRule)
+	if err != nil {
+		return s, nil, err
+	}
+	next := s
+	next.ID = uuid.Nil
+	next.MaterializedUntil = nil
+	next.StartsAt = pivot
+	if edit.RRule != "" {
+		next.RRule = edit.RRule
+	} else if rule.Count > 0 {
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		rule.Count -= len(rule.Expand(s.StartsAt, loc, pivot, 0))
+		if rule.Count < 1 {
+			rule.Count = 1
+		}
+		next.RRule = rule.String()
+	}
+	if _, err := ParseRecurrenceRule(next.RRule); err != nil {
+		return s, nil, err
+	}
+	if edit.StartsAt != nil {
+		next.StartsAt = edit.StartsAt.UTC()
+	}
+	applySeriesTemplate(&next, edit)
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return s, nil, err
+	}
+	defer tx.Rollback()
+	if err := lockActiveSeries(tx, s.ID); err != nil {
+		return s, nil, err
+	}
+	changes := seriesChanges{tenantID: s.TenantID}
+	if err := endSeriesBefore(tx, &s, pivot); err != nil {
+		return s, nil, err
+	}
+	if err := cancelSeriesOccurrences(tx, &changes, s.ID, "Series updated", `recurrence_id >= $4`, pivot); err != nil {
+		return s, nil, err
+	}
+	created, conflicts, err := createSeries(tx, next, &changes)
+	if err != nil {
+		return s, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return s, nil, err
+	}
+	changes.publish()
+	return created, conflicts, nil
+}
+
+// EditSeriesAll updates the series template and every occurrence that has not started yet.
+// Timing changes regenerate upcoming occurrences; other changes are applied in place.
+// Occurrences edited individually (exceptions) are left alone.
+func EditSeriesAll(apt models.Appointment, edit SeriesEdit) (models.AppointmentSeries, []SeriesConflict, error) {
+	conflicts := make([]SeriesConflict, 0)
+	s, err := activeSeriesFor(apt)
+	if err != nil {
+		return s, conflicts, err
+	}
+
+	retime := false
+	if edit.StartsAt != nil {
+		if delta := edit.StartsAt.Sub(occurrenceKey(apt)); delta != 0 {
+			s.StartsAt = s.StartsAt.Add(delta)
+			retime = true
+		}
+	}
+	if edit.DurationMin > 0 && edit.DurationMin != s.DurationMin {
+		retime = true
+	}
+	if edit.RRule != "" {
+		rule, err := ParseRecurrenceRule(edit.RRule)
+		if err != nil {
+			return s, conflicts, err
+		}
+		if rule.String() != s.RRule {
+			s.RRule = rule.String()
+			retime = true
+		}
+	}
+	applySeriesTemplate(&s, edit)
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return s, conflicts, err
+	}
+	defer tx.Rollback()
+	if err := lockActiveSeries(tx, s.ID); err != nil {
+		return s, conflicts, err
+	}
+	_, err = tx.Exec(`
+		UPDATE appointment_series SET type = $3, rrule = $4, starts_at = $5, duration_min = $6,
+			meeting_link = NULLIF($7,''), location = NULLIF($8,''), notes = NULLIF($9,''), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+	`, s.ID, s.TenantID, s.Type, s.RRule, s.StartsAt, s.DurationMin, s.MeetingLink, s.Location, s.Notes)
+	if err != nil {
+		return s, conflicts, err
+	}
+
+	changes := seriesChanges{tenantID: s.TenantID}
+	now := time.Now().UTC()
+	if retime {
+		if err := cancelSeriesOccurrences(tx, &changes, s.ID, "Series updated", `starts_at >= $4 AND NOT is_exception`, now); err != nil {
+			return s, conflicts, err
+		}
+		if conflicts, err = materializeSeries(tx, &s, now, now.Add(seriesHorizon), &changes); err != nil {
+			return s, conflicts, err
+		}
+	} else {
+		rows, err := tx.Query(`
+			UPDATE appointments SET type = $3, meeting_link = NULLIF($4,''), location = NULLIF($5,''),
+				notes = NULLIF($6,''), updated_at = NOW()
+			WHERE tenant_id = $1 AND series_id = $2 AND starts_at >= $7 AND NOT is_exception
+				AND status IN ('scheduled', 'confirmed')
+			RETURNING id
+		`, s.TenantID, s.ID, s.Type, s.MeetingLink, s.Location, s.Notes, now)
+		if err != nil {
+			return s, conflicts, err
+		}
+		if changes.updated, err = collectIDs(rows); err != nil {
+			return s, conflicts, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return s, conflicts, err
+	}
+	changes.publish()
+	return s, conflicts, nil
+}
+
+// CancelSeries cancels apt and every later occurrence (SeriesScopeFollowing) or the whole
+// remaining series (SeriesScopeAll). Single occurrences are cancelled by the caller.
+func CancelSeries(apt models.Appointment, scope, reason string) (models.AppointmentSeries, error) {
+	s, err := activeSeriesFor(apt)
+	if err != nil {
+		return s, err
+	}
+	if scope != SeriesScopeFollowing && scope != SeriesScopeAll {
+		return s, errors.New("unsupported series scope")
+	}
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return s, err
+	}
+	defer tx.Rollback()
+	if err := lockActiveSeries(tx, s.ID); err != nil {
+		return s, err
+	}
+	changes := seriesChanges{tenantID: s.TenantID}
+	switch scope {
+	case SeriesScopeFollowing:
+		pivot := occurrenceKey(apt)
+		if err := endSeriesBefore(tx, &s, pivot); err != nil {
+			return s, err
+		}
+		err = cancelSeriesOccurrences(tx, &changes, s.ID, reason, `recurrence_id >= $4`, pivot)
+	case SeriesScopeAll:
+		if _, err := tx.Exec(`
+			UPDATE appointment_series SET status = 'cancelled', updated_at = NOW() WHERE id = $1
+		`, s.ID); err != nil {
+			return s, err
+		}
+		s.Status = "cancelled"
+		err = cancelSeriesOccurrences(tx, &changes, s.ID, reason, `starts_at >= $4`, time.Now().UTC())
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := tx.Commit(); err != nil {
+		return s, err
+	}
+	changes.publish()
+	return s, nil
+}
+
+// lockActiveSeries locks the series row for the rest of tx, so concurrent edits of the same
+// series run one after the other, and checks it is still active.
+func lockActiveSeries(tx *sql.Tx, seriesID uuid.UUID) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM appointment_series WHERE id = $1 FOR UPDATE`, seriesID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrSeriesNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != "active" {
+		return ErrSeriesInactive
+	}
+	return nil
+}
+
+func activeSeriesFor(apt models.Appointment) (models.AppointmentSeries, error) {
+	if apt.SeriesID == nil {
+		return models.AppointmentSeries{}, ErrSeriesNotFound
+	}
+	s, err := GetAppointmentSeries(apt.TenantID, *apt.SeriesID)
+	if err != nil {
+		return s, err
+	}
+	if s.Status != "active" {
+		return s, ErrSeriesInactive
+	}
+	return s, nil
+}
+
+// occurrenceKey is the originally scheduled start of an occurrence, even if it was moved.
+func occurrenceKey(apt models.Appointment) time.Time {
+	if apt.RecurrenceID != nil {
+		return apt.RecurrenceID.UTC()
+	}
+	return apt.StartsAt.UTC()
+}
+
+func applySeriesTemplate(s *models.AppointmentSeries, edit SeriesEdit) {
+	if edit.Type != "" {
+		s.Type = edit.Type
+	}
+	if edit.DurationMin > 0 {
+		s.DurationMin = edit.DurationMin
+	}
+	if edit.MeetingLink != "" {
+		s.MeetingLink = edit.MeetingLink
+	}
+	if edit.Location != "" {
+		s.Location = edit.Location
+	}
+	if edit.Notes != "" {
+		s.Notes = edit.Notes
+	}
+}
+
+// endSeriesBefore rewrites the series rule so its last occurrence is strictly before pivot.
+// A series cut at its first occurrence is cancelled outright.
+func endSeriesBefore(tx *sql.Tx, s *models.AppointmentSeries, pivot time.Time) error {
+	if !pivot.After(s.StartsAt) {
+		_, err := tx.Exec(`
+			UPDATE appointment_series SET status = 'cancelled', updated_at = NOW() WHERE id = $1
+		`, s.ID)
+		s.Status = "cancelled"
+		return err
+	}
+	rule, err := ParseRecurrenceRule(s.RRule)
+	if err != nil {
+		return err
+	}
+	until := pivot.Add(-time.Second)
+	rule.Count = 0
+	rule.Until = &until
+	s.RRule = rule.String()
+	if s.MaterializedUntil == nil || s.MaterializedUntil.After(pivot) {
+		s.MaterializedUntil = &pivot
+	}
+	_, err = tx.Exec(`
+		UPDATE appointment_series SET rrule = $2, materialized_until = $3, updated_at = NOW() WHERE id = $1
+	`, s.ID, s.RRule, s.MaterializedUntil)
+	return err
+}
+
+// cancelSeriesOccurrences cancels the series' open occurrences matching cond (which may use $4
+// onwards) and adds them to changes so their calendar events are deleted after commit.
+func cancelSeriesOccurrences(tx *sql.Tx, changes *seriesChanges, seriesID uuid.UUID, reason, cond string, args ...interface{}) error {
+	rows, err := tx.Query(`
+		UPDATE appointments SET status = 'cancelled', cancelled_at = NOW(), cancel_reason = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND series_id = $2 AND status NOT IN ('cancelled', 'completed', 'no_show')
+			AND `+cond+`
+		RETURNING id
+	`, append([]interface{}{changes.tenantID, seriesID, reason}, args...)...)
+	if err != nil {
+		return err
+	}
+	ids, err := collectIDs(rows)
+	if err != nil {
+		return err
+	}
+	changes.cancelled = append(changes.cancelled, ids...)
+	return nil
+}
+
+func collectIDs(rows *sql.Rows) ([]uuid.UUID, error) {
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// StartSeriesExtender materializes active series forward once a day so open-ended
+// series always cover the booking horizon.
+func StartSeriesExtender() {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		ExtendActiveSeries()
+		for range ticker.C {
+			ExtendActiveSeries()
+		}
+	}()
+}
+
+// ExtendActiveSeries materializes every active series up to the booking horizon.
+func ExtendActiveSeries() {
+	until := time.Now().UTC().Add(seriesHorizon)
+	rows, err := database.PostgresDB.Query(`
+		SELECT `+seriesColumns+` FROM appointment_series
+		WHERE status = 'active' AND (materialized_until IS NULL OR materialized_until < $1)
+	`, until)
+	if err != nil {
+		log.Printf("series extender: %v", err)
+		return
+	}
+	var series []models.AppointmentSeries
+	for rows.Next() {
+		s, err := scanSeries(rows)
+		if err != nil {
+			log.Printf("series extender: %v", err)
+			continue
+		}
+		series = append(series, s)
+	}
+	rows.Close()
+
+	for i := range series {
+		s := &series[i]
+		from := s.StartsAt
+		if s.MaterializedUntil != nil {
+			from = *s.MaterializedUntil
+		}
+		conflicts, err := MaterializeSeries(s, from, until)
+		if err != nil {
+			log.Printf("series extender: series %s: %v", s.ID, err)
+			continue
+		}
+		if len(conflicts) > 0 {
+			log.Printf("series extender: series %s skipped %d conflicting occurrence(s)", s.ID, len(conflicts))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+)
+
+// auditSpoolFlushInterval is how often events spooled during a database outage are retried.
+const auditSpoolFlushInterval = time.Minute
+
+// InitAuditLog configures the checkpoint signing key and the disk spool of the security audit log.
+// Production refuses to start without AUDIT_SIGNING_KEY; elsewhere the key is derived from
+// JWT_SECRET.
+func InitAuditLog(cfg *config.Config) error {
+	if cfg.AuditSigningKey == "" {
+		if cfg.IsProduction() {
+			return errors.New("AUDIT_SIGNING_KEY must be set in production")
+		}
+		log.Println("⚠️  AUDIT_SIGNING_KEY not set; signing audit checkpoints with a key derived from JWT_SECRET")
+	}
+	if err := database.InitAuditSigning(cfg.AuditSigningKey, cfg.JWTSecret); err != nil {
+		return err
+	}
+	return database.ConfigureAuditSpool(cfg.AuditSpoolDir)
+}
+
+// StartAuditMaintenance flushes the audit spool every minute and signs chain checkpoints every
+// checkpointEvery.
+func StartAuditMaintenance(checkpointEvery time.Duration) {
+	go func() {
+		flush := time.NewTicker(auditSpoolFlushInterval)
+		defer flush.Stop()
+		checkpoint := time.NewTicker(checkpointEvery)
+		defer checkpoint.Stop()
+
+		flushAuditSpool()
+		writeAuditCheckpoints()
+		for {
+			select {
+			case <-flush.C:
+				flushAuditSpool()
+			case <-checkpoint.C:
+				writeAuditCheckpoints()
+			}
+		}
+	}()
+}
+
+func flushAuditSpool() {
+	if database.SpooledAuditEvents() == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	n, err := database.FlushAuditSpool(ctx)
+	if n > 0 {
+		log.Printf("✅ Flushed %d spooled audit event(s)", n)
+	}
+	if err != nil {
+		log.Printf("audit spool: flush stopped, %d event(s) still waiting: %v", database.SpooledAuditEvents(), err)
+	}
+}
+
+func writeAuditCheckpoints() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := database.WriteAuditCheckpoints(ctx); err != nil {
+		log.Printf("audit checkpoint: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 500
+	// MaxPatientAccessEvents caps the audit events, and the PHI accesses, in one patient access report
+	MaxPatientAccessEvents = 1000
+
+	auditCursorLayout = "2006-01-02 15:04:05.999999"
+)
+
+var (
+	ErrInvalidAuditCursor = errors.New("invalid cursor")
+	ErrPatientNotFound    = errors.New("patient not found")
+)
+
+// auditTenantExpr extracts the tenant of tenant-scoped events, which AuditV2Tenant writes at the
+// start of reason. It must match the expression of idx_security_audit_tenant.
+const auditTenantExpr = `substring(reason FROM '^tenant=([0-9a-f-]{36})')`
+
+// clinicalReadPermissions are the permissions that let staff read a patient's health record.
+var clinicalReadPermissions = []string{PermPatientsRead, PermNotesRead, PermClinicalRead, PermMessagesRead}
+
+// AuditLogEntry is a security_audit_logs row as shown to compliance reviewers.
+type AuditLogEntry struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	EventType string     `json:"event_type"`
+	ActorID   string     `json:"actor_id"`
+	ActorRole string     `json:"actor_role"`
+	TargetID  string     `json:"target_id"`
+	TenantID  *uuid.UUID `json:"tenant_id,omitempty"`
+	Reason    string     `json:"reason"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	ChainDate string     `json:"chain_date,omitempty"`
+	ChainSeq  int64      `json:"chain_seq,omitempty"`
+	RowHash   string     `json:"row_hash,omitempty"`
+}
+
+// AuditQuery filters audit events. Zero fields match everything; From is inclusive and To
+// exclusive.
+type AuditQuery struct {
+	ActorID    string
+	TargetID   string
+	EventTypes []string
+	TenantID   *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+	Cursor     string
+	Limit      int
+}
+
+// auditWhere builds the WHERE clause and its arguments for q, cursor included.
+func auditWhere(q AuditQuery) (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "$?", fmt.Sprintf("$%d", len(args))))
+	}
+	if q.ActorID != "" {
+		add("actor_id = $?", q.ActorID)
+	}
+	if q.TargetID != "" {
+		add("target_id = $?", q.TargetID)
+	}
+	if len(q.EventTypes) > 0 {
+		add("event_type = ANY($?)", pq.Array(q.EventTypes))
+	}
+	if q.TenantID != nil {
+		add(auditTenantExpr+" = $?", q.TenantID.String())
+	}
+	if q.From != nil {
+		add("created_at >= $?", q.From.UTC())
+	}
+	if q.To != nil {
+		add("created_at < $?", q.To.UTC())
+	}
+	if q.Cursor != "" {
+		at, id, err := decodeAuditCursor(q.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, at, id)
+		conds = append(conds, fmt.Sprintf("(created_at < $%d OR (created_at = $%d AND id < $%d))",
+			len(args)-1, len(args)-1, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// encodeAuditCursor points after the entry in newest-first order.
+func encodeAuditCursor(e AuditLogEntry) string {
+	raw := e.CreatedAt.UTC().Format(auditCursorLayout) + "|" + e.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(cursor string) (string, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", uuid.Nil, ErrInvalidAuditCursor
+	}
+	at, idStr, found := strings.Cut(string(raw), "|")
+	if !found {
+		return "", uuid.Nil, ErrInvalidAuditCursor
+	}
+	if _, err := time.Parse(auditCursorLayout, at); err != nil {
+		return "", uuid.Nil, ErrInvalidAuditCursor
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return "", uuid.Nil, ErrInvalidAuditCursor
+	}
+	return at, id, nil
+}
+
+const auditEntryColumns = `id, created_at, event_type, actor_id, actor_role, target_id, ` + auditTenantExpr + `,
+	reason, ip_address, user_agent, COALESCE(chain_date::text, ''), COALESCE(chain_seq, 0), COALESCE(row_hash, '')`
+
+func scanAuditEntry(rows *sql.Rows) (AuditLogEntry, error) {
+	var e AuditLogEntry
+	var tenant sql.NullString
+	err := rows.Scan(&e.ID, &e.CreatedAt, &e.EventType, &e.ActorID, &e.ActorRole, &e.TargetID, &tenant,
+		&e.Reason, &e.IPAddress, &e.UserAgent, &e.ChainDate, &e.ChainSeq, &e.RowHash)
+	if err != nil {
+		return e, err
+	}
+	if id, err := uuid.Parse(tenant.String); err == nil {
+		e.TenantID = &id
+	}
+	return e, nil
+}
+
+// QueryAuditEvents returns one page of matching events, newest first, and the cursor of the next
+// page ("" on the last page).
+func QueryAuditEvents(ctx context.Context, q AuditQuery) ([]AuditLogEntry, string, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultAuditPageSize
+	}
+	if q.Limit > MaxAuditPageSize {
+		q.Limit = MaxAuditPageSize
+	}
+	where, args, err := auditWhere(q)
+	if err != nil {
+		return nil, "", err
+	}
+	// One extra row tells whether another page follows
+	args = append(args, q.Limit+1)
+	rows, err := database.PostgresDB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM security_audit_logs %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, auditEntryColumns, where, len(args)), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	entries := []AuditLogEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+		next = encodeAuditCursor(entries[len(entries)-1])
+	}
+	return entries, next, nil
+}
+
+// StreamAuditEvents calls fn for every matching event, oldest first, ignoring the cursor and
+// limit. It stops at the first error fn returns.
+func StreamAuditEvents(ctx context.Context, q AuditQuery, fn func(AuditLogEntry) error) error {
+	q.Cursor = ""
+	where, args, err := auditWhere(q)
+	if err != nil {
+		return err
+	}
+	rows, err := database.PostgresDB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM security_audit_logs %s
+		ORDER BY created_at, id
+	`, auditEntryColumns, where), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ClinicalAccessHolder is a staff member who can currently read a patient's record.
+type ClinicalAccessHolder struct {
+	StaffID     uuid.UUID `json:"staff_id"`
+	StaffType   string    `json:"staff_type"` // therapist or receptionist
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Assigned    bool      `json:"assigned"` // the patient's assigned therapist
+	Permissions []string  `json:"permissions"`
+}
+
+// PatientAccessReport answers "who accessed this record": the audit events naming the patient, the
+// PHI access log of their record, everyone who holds read access to it now and every emergency
+// access grant to it.
+type PatientAccessReport struct {
+	PatientID      uuid.UUID              `json:"patient_id"`
+	TenantID       uuid.UUID              `json:"tenant_id"`
+	From           *time.Time             `json:"from,omitempty"`
+	To             *time.Time             `json:"to,omitempty"`
+	Events         []AuditLogEntry        `json:"events"`
+	RecordAccess   []PHIAccessEntry       `json:"record_access"`
+	Truncated      bool                   `json:"truncated"`
+	ClinicalAccess []ClinicalAccessHolder `json:"clinical_access"`
+	BreakGlass     []BreakGlassGrant      `json:"break_glass"`
+	GeneratedAt    time.Time              `json:"generated_at"`
+}
+
+// BuildPatientAccessReport gathers the access report for a patient over [from, to).
+func BuildPatientAccessReport(ctx context.Context, patientID uuid.UUID, from, to *time.Time) (*PatientAccessReport, error) {
+	report := &PatientAccessReport{PatientID: patientID, From: from, To: to, GeneratedAt: time.Now().UTC()}
+	var assigned uuid.NullUUID
+	err := database.PostgresDB.QueryRowContext(ctx, `
+		SELECT tenant_id, assigned_therapist_id FROM patients WHERE id = $1
+	`, patientID).Scan(&report.TenantID, &assigned)
+	if err == sql.ErrNoRows {
+		return nil, ErrPatientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := QueryAuditEvents(ctx, AuditQuery{
+		TargetID: patientID.String(), From: from, To: to, Limit: MaxPatientAccessEvents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Events, report.Truncated = events, next != ""
+
+	access, err := ListPatientPHIAccess(ctx, patientID, from, to, MaxPatientAccessEvents+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(access) > MaxPatientAccessEvents {
+		access, report.Truncated = access[:MaxPatientAccessEvents], true
+	}
+	report.RecordAccess = access
+
+	report.ClinicalAccess, err = clinicalAccessHolders(report.TenantID, assigned.UUID)
+	if err != nil {
+		return nil, err
+	}
+	report.BreakGlass, err = ListBreakGlassGrants(ctx, BreakGlassFilter{PatientID: &patientID, Limit: MaxAuditPageSize})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// clinicalAccessHolders lists the tenant's active practitioners and receptionists whose roles let
+// them read clinical data.
+func clinicalAccessHolders(tenantID, assignedTherapist uuid.UUID) ([]ClinicalAccessHolder, error) {
+	var staff []ClinicalAccessHolder
+	rows, err := database.PostgresDB.Query(`
+		SELECT m.therapist_id, COALESCE(t.name, ''), COALESCE(t.email, ''), m.role
+		FROM tenant_members m
+		JOIN therapists t ON t.id = m.therapist_id
+		WHERE m.tenant_id = $1 AND m.is_active = TRUE
+		ORDER BY m.joined_at
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		h := ClinicalAccessHolder{StaffType: "therapist"}
+		if err := rows.Scan(&h.StaffID, &h.Name, &h.Email, &h.Role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		staff = append(staff, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = database.PostgresDB.Query(`
+		SELECT id, name, email FROM receptionists
+		WHERE tenant_id = $1 AND is_active = TRUE
+		ORDER BY created_at
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		h := ClinicalAccessHolder{StaffType: "receptionist", Role: RoleReceptionist}
+		if err := rows.Scan(&h.StaffID, &h.Name, &h.Email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		staff = append(staff, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	holders := []ClinicalAccessHolder{}
+	for _, h := range staff {
+		var perms PermissionSet
+		if h.StaffType == "therapist" {
+			perms, err = MemberPermissions(tenantID, h.StaffID, h.Role)
+		} else {
+			perms, err = StaffPermissions(tenantID, h.StaffID, RoleReceptionist)
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.Permissions = []string{}
+		for _, p := range clinicalReadPermissions {
+			if perms.Has(p) {
+				h.Permissions = append(h.Permissions, p)
+			}
+		}
+		h.Assigned = h.StaffType == "therapist" && h.StaffID == assignedTherapist
+		if len(h.Permissions) > 0 || h.Assigned {
+			holders = append(holders, h)
+		}
+	}
+	return holders, nil
+}
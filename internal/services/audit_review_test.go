@@ -0,0 +1,49 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuditWhereNumbersArguments(t *testing.T) {
+	tenant := uuid.New()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	entry := AuditLogEntry{ID: uuid.New(), CreatedAt: time.Date(2026, 3, 2, 10, 30, 0, 123456000, time.UTC)}
+	where, args, err := auditWhere(AuditQuery{
+		ActorID:    "actor",
+		EventTypes: []string{"V2_PATIENT_CREATED"},
+		TenantID:   &tenant,
+		From:       &from,
+		Cursor:     encodeAuditCursor(entry),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 6 {
+		t.Fatalf("got %d args: %v", len(args), args)
+	}
+	for _, want := range []string{"actor_id = $1", "event_type = ANY($2)", "= $3", "created_at >= $4",
+		"(created_at < $5 OR (created_at = $5 AND id < $6))"} {
+		if !strings.Contains(where, want) {
+			t.Fatalf("%q missing from %s", want, where)
+		}
+	}
+	if args[2] != tenant.String() || args[4] != "2026-03-02 10:30:00.123456" || args[5] != entry.ID {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	if where, args, _ := auditWhere(AuditQuery{}); where != "" || len(args) != 0 {
+		t.Fatalf("empty query: %q %v", where, args)
+	}
+}
+
+func TestDecodeAuditCursorRejectsGarbage(t *testing.T) {
+	for _, c := range []string{"!!", "bm8tc2VwYXJhdG9y", encodeAuditCursor(AuditLogEntry{})[:10]} {
+		if _, _, err := decodeAuditCursor(c); err != ErrInvalidAuditCursor {
+			t.Fatalf("cursor %q: %v", c, err)
+		}
+	}
+}
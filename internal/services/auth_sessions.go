@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// SessionRoleUser is the session owner role of end-user (patient) accounts; staff sessions use
+// the token roles.
+const SessionRoleUser = "user"
+
+// NewDeviceNotificationType is the notification type sent when an account signs in from a
+// device it has not used before. Users can turn it off through their notification preferences.
+const NewDeviceNotificationType = "new_device_login"
+
+// authSessionTouchInterval bounds how often a request on an opaque session updates last_seen_at.
+const authSessionTouchInterval = 5 * time.Minute
+
+var ErrAuthSessionNotFound = errors.New("session not found")
+
+// AuthSession is one sign-in as shown to its owner.
+type AuthSession struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionOwner is who a request is signed in as, and with which sign-in.
+type SessionOwner struct {
+	Role        string
+	ID          uuid.UUID
+	familyID    uuid.UUID // token service sign-ins
+	sessionHash string    // opaque Redis sessions
+}
+
+// ResolveSessionOwner identifies the caller from a bearer token: an access token of any role,
+// an admin session, or a user or therapist session.
+func ResolveSessionOwner(token string) (SessionOwner, bool) {
+	if token == "" {
+		return SessionOwner{}, false
+	}
+	if claims, err := ParseAccessToken(token); err == nil {
+		id, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return SessionOwner{}, false
+		}
+		familyID, _ := uuid.Parse(claims.FamilyID)
+		return SessionOwner{Role: claims.Role, ID: id, familyID: familyID}, true
+	}
+	if database.RedisClient == nil {
+		return SessionOwner{}, false
+	}
+	if id, ok, err := ValidateAdminSession(token); err == nil && ok {
+		return SessionOwner{Role: TokenRoleAdmin, ID: id, sessionHash: hashToken(token)}, true
+	}
+	id, ok, err := ValidateSession(token)
+	if err != nil || !ok {
+		return SessionOwner{}, false
+	}
+	role := SessionRoleUser
+	var isTherapist bool
+	if database.PostgresDB.QueryRow(`SELECT EXISTS(SELECT 1 FROM therapists WHERE id = $1)`, id).Scan(&isTherapist) == nil && isTherapist {
+		role = TokenRoleTherapist
+	}
+	return SessionOwner{Role: role, ID: id, sessionHash: hashToken(token)}, true
+}
+
+// RecordAuthSession records a sign-in backed by an opaque session token, a refresh token family,
+// or both (pass "" or uuid.Nil for the one not issued). When both are issued the token family is
+// the authoritative credential: the opaque session only serves V1 endpoints and is ended whenever
+// the family is revoked. newDevice reports that the account has signed in before, but never from
+// this user agent.
+func RecordAuthSession(role string, actorID uuid.UUID, sessionToken string, familyID uuid.UUID, ip, userAgent string) (id uuid.UUID, newDevice bool, err error) {
+	deviceHash := hashToken(strings.TrimSpace(userAgent))
+	var hasPrior, knownDevice bool
+	err = database.PostgresDB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM auth_sessions WHERE actor_type = $1 AND actor_id = $2),
+			EXISTS(SELECT 1 FROM auth_sessions WHERE actor_type = $1 AND actor_id = $2 AND device_hash = $3)
+	`, role, actorID, deviceHash).Scan(&hasPrior, &knownDevice)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+
+	var sessionHash sql.NullString
+	if sessionToken != "" {
+		sessionHash = sql.NullString{String: hashToken(sessionToken), Valid: true}
+	}
+	err = database.PostgresDB.QueryRow(`
+		INSERT INTO auth_sessions (actor_type, actor_id, refresh_family_id, session_token_hash, device_hash, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, role, actorID, uuid.NullUUID{UUID: familyID, Valid: familyID != uuid.Nil}, sessionHash,
+		deviceHash, userAgent, ip).Scan(&id)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return id, hasPrior && !knownDevice, nil
+}
+
+// liveAuthSession is an AuthSession with the credentials that back it.
+type liveAuthSession struct {
+	AuthSession
+	familyID    uuid.NullUUID
+	sessionHash string
+}
+
+// ListAuthSessions returns the owner's sign-ins that can still be used, most recently seen first.
+func ListAuthSessions(owner SessionOwner) ([]AuthSession, error) {
+	live, err := liveAuthSessions(owner)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]AuthSession, 0, len(live))
+	for _, s := range live {
+		sessions = append(sessions, s.AuthSession)
+	}
+	return sessions, nil
+}
+
+// liveAuthSessions loads the owner's usable sign-ins. A sign-in is live while its refresh family
+// has an unused token or its opaque session is the one Redis holds for the account (opaque
+// sessions are one per account).
+func liveAuthSessions(owner SessionOwner) ([]liveAuthSession, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT s.id, s.refresh_family_id, COALESCE(s.session_token_hash, ''), COALESCE(s.user_agent, ''),
+			COALESCE(s.ip_address, ''), s.created_at, s.last_seen_at
+		FROM auth_sessions s
+		WHERE s.actor_type = $1 AND s.actor_id = $2 AND s.revoked_at IS NULL
+			AND (s.session_token_hash = $3 OR EXISTS (
+				SELECT 1 FROM refresh_tokens rt
+				WHERE rt.family_id = s.refresh_family_id AND rt.revoked_at IS NULL
+					AND rt.rotated_at IS NULL AND rt.expires_at > NOW()
+			))
+		ORDER BY s.last_seen_at DESC
+	`, owner.Role, owner.ID, liveOpaqueSessionHash(owner.Role, owner.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []liveAuthSession
+	for rows.Next() {
+		var s liveAuthSession
+		if err := rows.Scan(&s.ID, &s.familyID, &s.sessionHash, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		s.Device = DescribeDevice(s.UserAgent)
+		s.Current = owner.owns(s.familyID, s.sessionHash)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (o SessionOwner) owns(familyID uuid.NullUUID, sessionHash string) bool {
+	return (familyID.Valid && familyID.UUID == o.familyID) || (sessionHash != "" && sessionHash == o.sessionHash)
+}
+
+// RevokeAuthSession ends one of the owner's sign-ins, including the caller's own.
+func RevokeAuthSession(owner SessionOwner, sessionID uuid.UUID) error {
+	var familyID uuid.NullUUID
+	var sessionHash sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT refresh_family_id, session_token_hash FROM auth_sessions
+		WHERE id = $1 AND actor_type = $2 AND actor_id = $3 AND revoked_at IS NULL
+	`, sessionID, owner.Role, owner.ID).Scan(&familyID, &sessionHash)
+	if err == sql.ErrNoRows {
+		return ErrAuthSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return endAuthSession(owner, sessionID, familyID, sessionHash.String)
+}
+
+// RevokeOtherAuthSessions signs the owner out everywhere except the sign-in making the request
+// and returns how many sessions were ended.
+func RevokeOtherAuthSessions(owner SessionOwner) (int, error) {
+	live, err := liveAuthSessions(owner)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range live {
+		if s.Current {
+			continue
+		}
+		if err := endAuthSession(owner, s.ID, s.familyID, s.sessionHash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func endAuthSession(owner SessionOwner, sessionID uuid.UUID, familyID uuid.NullUUID, sessionHash string) error {
+	if familyID.Valid {
+		if err := RevokeTokenFamily(familyID.UUID); err != nil {
+			return err
+		}
+	}
+	if sessionHash != "" {
+		if err := invalidateOpaqueSession(owner.Role, owner.ID, sessionHash); err != nil {
+			return err
+		}
+	}
+	_, err := database.PostgresDB.Exec(`UPDATE auth_sessions SET revoked_at = NOW() WHERE id = $1`, sessionID)
+	return err
+}
+
+// endOpaqueSessions invalidates the opaque sessions of the live sign-ins matching cond, an
+// auth_sessions condition on $1, and marks those sign-ins revoked.
+func endOpaqueSessions(cond string, arg interface{}) error {
+	rows, err := database.PostgresDB.Query(`
+		SELECT actor_type, actor_id, session_token_hash FROM auth_sessions
+		WHERE revoked_at IS NULL AND session_token_hash IS NOT NULL AND `+cond, arg)
+	if err != nil {
+		return err
+	}
+	var owners []SessionOwner
+	for rows.Next() {
+		var o SessionOwner
+		if err := rows.Scan(&o.Role, &o.ID, &o.sessionHash); err != nil {
+			rows.Close()
+			return err
+		}
+		owners = append(owners, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, o := range owners {
+		if err := invalidateOpaqueSession(o.Role, o.ID, o.sessionHash); err != nil {
+			return err
+		}
+	}
+	_, err = database.PostgresDB.Exec(`UPDATE auth_sessions SET revoked_at = NOW() WHERE revoked_at IS NULL AND `+cond, arg)
+	return err
+}
+
+// endOpaqueSignin signs out the sign-in an opaque session token belongs to, revoking the token
+// family issued with it as well.
+func endOpaqueSignin(token string) error {
+	owner, ok := ResolveSessionOwner(token)
+	if !ok || owner.sessionHash == "" {
+		return nil
+	}
+	var familyID uuid.NullUUID
+	err := database.PostgresDB.QueryRow(`
+		SELECT refresh_family_id FROM auth_sessions
+		WHERE session_token_hash = $1 AND revoked_at IS NULL AND refresh_family_id IS NOT NULL
+		LIMIT 1
+	`, owner.sessionHash).Scan(&familyID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if familyID.Valid {
+		if err := RevokeTokenFamily(familyID.UUID); err != nil {
+			return err
+		}
+	}
+	// Sign-ins recorded before auth_sessions existed have no row; end the session directly
+	if err := invalidateOpaqueSession(owner.Role, owner.ID, owner.sessionHash); err != nil {
+		return err
+	}
+	return endOpaqueSessions(`session_token_hash = $1`, owner.sessionHash)
+}
+
+// liveOpaqueSessionHash returns the hash of the opaque session Redis currently holds for the
+// account, or "" when there is none.
+func liveOpaqueSessionHash(role string, actorID uuid.UUID) string {
+	if database.RedisClient == nil {
+		return ""
+	}
+	key := UserSessionKeyPrefix + actorID.String()
+	if role == TokenRoleAdmin {
+		key = AdminToSessionKeyPrefix + actorID.String()
+	}
+	token, err := database.RedisClient.Get(context.Background(), key).Result()
+	if err != nil || token == "" {
+		return ""
+	}
+	return hashToken(token)
+}
+
+func invalidateOpaqueSession(role string, actorID uuid.UUID, sessionHash string) error {
+	if database.RedisClient == nil {
+		return nil
+	}
+	key := UserSessionKeyPrefix + actorID.String()
+	if role == TokenRoleAdmin {
+		key = AdminToSessionKeyPrefix + actorID.String()
+	}
+	token, err := database.RedisClient.Get(context.Background(), key).Result()
+	if err != nil || hashToken(token) != sessionHash {
+		// Already replaced or expired
+		return nil
+	}
+	if role == TokenRoleAdmin {
+		return InvalidateAdminSession(token)
+	}
+	return InvalidateSession(token)
+}
+
+// TouchTokenFamilySession updates last_seen_at when a sign-in refreshes its tokens.
+func TouchTokenFamilySession(familyID uuid.UUID, ip string) {
+	_, _ = database.PostgresDB.Exec(`
+		UPDATE auth_sessions SET last_seen_at = NOW(), ip_address = COALESCE(NULLIF($2, ''), ip_address)
+		WHERE refresh_family_id = $1 AND revoked_at IS NULL
+	`, familyID, ip)
+}
+
+// touchOpaqueSession updates last_seen_at for an opaque session, at most once per
+// authSessionTouchInterval.
+func touchOpaqueSession(sessionToken string) {
+	if database.RedisClient == nil || database.PostgresDB == nil {
+		return
+	}
+	hash := hashToken(sessionToken)
+	first, err := database.RedisClient.SetNX(context.Background(), "auth_session_seen:"+hash, "1", authSessionTouchInterval).Result()
+	if err != nil || !first {
+		return
+	}
+	_, _ = database.PostgresDB.Exec(`
+		UPDATE auth_sessions SET last_seen_at = NOW() WHERE session_token_hash = $1 AND revoked_at IS NULL
+	`, hash)
+}
+
+// DescribeDevice turns a user agent into a short label such as "Chrome on macOS".
+func DescribeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"crios/", "Chrome"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"okhttp", "Android app"},
+		{"cfnetwork", "iOS app"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"mac os x", "macOS"},
+		{"macintosh", "macOS"},
+		{"windows", "Windows"},
+		{"cros", "ChromeOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36":                "Chrome on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile Safari/604.1": "Safari on iPhone",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36 Edg/126.0":            "Edge on Windows",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0":                                                           "Firefox on Linux",
+		"okhttp/4.12.0": "Android app",
+		"":              "Unknown device",
+	}
+	for ua, want := range cases {
+		if got := DescribeDevice(ua); got != want {
+			t.Errorf("DescribeDevice(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestSessionOwnerMatchesCurrentSignin(t *testing.T) {
+	family := uuid.New()
+	jwtOwner := SessionOwner{Role: TokenRoleTherapist, ID: uuid.New(), familyID: family}
+	if !jwtOwner.owns(uuid.NullUUID{UUID: family, Valid: true}, "") {
+		t.Fatal("sign-in with the owner's refresh family should be current")
+	}
+	if jwtOwner.owns(uuid.NullUUID{UUID: uuid.New(), Valid: true}, "") || jwtOwner.owns(uuid.NullUUID{}, "") {
+		t.Fatal("other sign-ins should not be current")
+	}
+
+	sessionOwner := SessionOwner{Role: SessionRoleUser, ID: uuid.New(), sessionHash: hashToken("session-token")}
+	if !sessionOwner.owns(uuid.NullUUID{}, hashToken("session-token")) {
+		t.Fatal("sign-in with the owner's session should be current")
+	}
+	if sessionOwner.owns(uuid.NullUUID{}, hashToken("other")) || sessionOwner.owns(uuid.NullUUID{}, "") {
+		t.Fatal("other sessions should not be current")
+	}
+}
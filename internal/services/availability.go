@@ -0,0 +1,594 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Schedule conflicts flagged on appointments that a later blackout covers.
+const (
+	ScheduleConflictTimeOff = "time_off"
+	ScheduleConflictHoliday = "holiday"
+)
+
+// MaxTimeOffDuration keeps a single time off entry to a sensible range.
+const MaxTimeOffDuration = 366 * 24 * time.Hour
+
+var (
+	ErrTimeOffRange     = errors.New("time off must end after it starts and last at most a year")
+	ErrTimeOffNotFound  = errors.New("time off not found")
+	ErrOverrideNotFound = errors.New("availability override not found")
+	ErrHolidayNotFound  = errors.New("holiday not found")
+	ErrInvalidClock     = errors.New("times must be HH:MM, with end after start")
+)
+
+// ScheduleConflict is an existing appointment that new time off or a new holiday falls on.
+type ScheduleConflict struct {
+	AppointmentID uuid.UUID `json:"appointment_id"`
+	TenantID      uuid.UUID `json:"tenant_id"`
+	TherapistID   uuid.UUID `json:"therapist_id"`
+	PatientID     uuid.UUID `json:"patient_id"`
+	StartsAt      time.Time `json:"starts_at"`
+	EndsAt        time.Time `json:"ends_at"`
+	Status        string    `json:"status"`
+}
+
+// availabilityBlock is a stretch of bookable time, cut into sessions of SlotDuration with
+// Buffer kept free after each.
+type availabilityBlock struct {
+	Start        time.Time
+	End          time.Time
+	SlotDuration time.Duration
+	Buffer       time.Duration
+}
+
+// parseClock reads a wall clock time such as 09:30 or 09:30:00 (PostgreSQL TIME text).
+func parseClock(s string) (h, m, sec int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, 0, ErrInvalidClock
+	}
+	vals := []int{0, 0, 0}
+	for i, p := range parts {
+		if _, err := fmt.Sscanf(p, "%d", &vals[i]); err != nil {
+			return 0, 0, 0, ErrInvalidClock
+		}
+	}
+	h, m, sec = vals[0], vals[1], vals[2]
+	if h < 0 || h > 24 || m < 0 || m > 59 || sec < 0 || sec > 59 || (h == 24 && (m > 0 || sec > 0)) {
+		return 0, 0, 0, ErrInvalidClock
+	}
+	return h, m, sec, nil
+}
+
+// ValidateClockRange checks a start and end wall clock time for a block or an override.
+func ValidateClockRange(start, end string) error {
+	sh, sm, ss, err := parseClock(start)
+	if err != nil {
+		return err
+	}
+	eh, em, es, err := parseClock(end)
+	if err != nil {
+		return err
+	}
+	if eh*3600+em*60+es <= sh*3600+sm*60+ss {
+		return ErrInvalidClock
+	}
+	return nil
+}
+
+// blockOn places wall clock start and end times on a local date. Across a DST change the
+// block keeps its wall clock times, not its length.
+func blockOn(day time.Time, start, end string, slotMin, bufferMin int) (availabilityBlock, bool) {
+	sh, sm, ss, err1 := parseClock(start)
+	eh, em, es, err2 := parseClock(end)
+	if err1 != nil || err2 != nil {
+		return availabilityBlock{}, false
+	}
+	y, mo, d := day.Date()
+	loc := day.Location()
+	b := availabilityBlock{
+		Start:        time.Date(y, mo, d, sh, sm, ss, 0, loc),
+		End:          time.Date(y, mo, d, eh, em, es, 0, loc),
+		SlotDuration: DefaultDuration(slotMin),
+		Buffer:       time.Duration(max(bufferMin, 0)) * time.Minute,
+	}
+	return b, b.End.After(b.Start)
+}
+
+// cutSlots splits blocks into sessions and drops those overlapping a blackout, or coming within
+// the block's buffer of a busy range. Sessions are returned in order without duplicates.
+func cutSlots(blocks []availabilityBlock, blackouts, busy []TimeRange) []TimeRange {
+	overlaps := func(s, e time.Time, ranges []TimeRange, pad time.Duration) bool {
+		for _, r := range ranges {
+			if s.Before(r.End.Add(pad)) && e.After(r.Start.Add(-pad)) {
+				return true
+			}
+		}
+		return false
+	}
+	seen := map[int64]bool{}
+	var slots []TimeRange
+	for _, b := range blocks {
+		step := b.SlotDuration + b.Buffer
+		for cur := b.Start; !cur.Add(b.SlotDuration).After(b.End); cur = cur.Add(step) {
+			end := cur.Add(b.SlotDuration)
+			if overlaps(cur, end, blackouts, 0) || overlaps(cur, end, busy, b.Buffer) {
+				continue
+			}
+			key := cur.Unix()<<20 ^ end.Unix()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			slots = append(slots, TimeRange{Start: cur, End: end})
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		if slots[i].Start.Equal(slots[j].Start) {
+			return slots[i].End.Before(slots[j].End)
+		}
+		return slots[i].Start.Before(slots[j].Start)
+	})
+	return slots
+}
+
+// OpenSlots returns the practitioner's bookable sessions on a date, given as local midnight in
+// the tenant's timezone: the weekly template (not on tenant holidays) plus overrides for the
+// date, minus time off, booked appointments and Google Calendar busy times.
+func OpenSlots(tenantID, therapistID uuid.UUID, day time.Time) ([]TimeRange, error) {
+	y, mo, d := day.Date()
+	day = time.Date(y, mo, d, 0, 0, 0, 0, day.Location())
+	dayEnd := day.AddDate(0, 0, 1)
+	date := day.Format("2006-01-02")
+
+	var holiday bool
+	if err := database.PostgresDB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM tenant_holidays WHERE tenant_id = $1 AND date = $2)
+	`, tenantID, date).Scan(&holiday); err != nil {
+		return nil, err
+	}
+
+	var blocks []availabilityBlock
+	addBlocks := func(rows *sql.Rows) error {
+		defer rows.Close()
+		for rows.Next() {
+			var start, end string
+			var slotMin, bufferMin int
+			if err := rows.Scan(&start, &end, &slotMin, &bufferMin); err != nil {
+				return err
+			}
+			if b, ok := blockOn(day, start, end, slotMin, bufferMin); ok {
+				blocks = append(blocks, b)
+			}
+		}
+		return rows.Err()
+	}
+	if !holiday {
+		rows, err := database.PostgresDB.Query(`
+			SELECT start_time::text, end_time::text, slot_duration_min, buffer_min
+			FROM availability_slots
+			WHERE tenant_id = $1 AND therapist_id = $2 AND day_of_week = $3 AND is_active = TRUE
+		`, tenantID, therapistID, int(day.Weekday()))
+		if err != nil {
+			return nil, err
+		}
+		if err := addBlocks(rows); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := database.PostgresDB.Query(`
+		SELECT start_time::text, end_time::text, slot_duration_min, buffer_min
+		FROM availability_overrides
+		WHERE tenant_id = $1 AND therapist_id = $2 AND date = $3
+	`, tenantID, therapistID, date)
+	if err != nil {
+		return nil, err
+	}
+	if err := addBlocks(rows); err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return []TimeRange{}, nil
+	}
+
+	// Time off belongs to the practitioner, so it blocks every practice they work in
+	blackouts, err := queryRanges(`
+		SELECT starts_at, ends_at FROM availability_time_off
+		WHERE therapist_id = $1 AND starts_at < $3 AND ends_at > $2
+	`, therapistID, day.UTC(), dayEnd.UTC())
+	if err != nil {
+		return nil, err
+	}
+	// Bookings, slots held for patients who are paying and the practitioner's other Google
+	// Calendar events as last synced; buffers can reach into the neighbouring days
+	busy, err := queryRanges(`
+		SELECT starts_at, ends_at FROM appointments
+		WHERE therapist_id = $1 AND status NOT IN ('cancelled', 'no_show', 'pending_payment')
+			AND starts_at < $3 AND ends_at > $2
+		UNION ALL
+		SELECT starts_at AT TIME ZONE 'UTC', ends_at AT TIME ZONE 'UTC' FROM slot_holds
+		WHERE therapist_id = $1 AND status = 'held' AND expires_at > NOW()
+			AND starts_at AT TIME ZONE 'UTC' < $3 AND ends_at AT TIME ZONE 'UTC' > $2
+		UNION ALL
+		SELECT starts_at AT TIME ZONE 'UTC', ends_at AT TIME ZONE 'UTC' FROM calendar_busy_times
+		WHERE therapist_id = $1
+			AND starts_at AT TIME ZONE 'UTC' < $3 AND ends_at AT TIME ZONE 'UTC' > $2
+	`, therapistID, day.AddDate(0, 0, -1).UTC(), dayEnd.AddDate(0, 0, 1).UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	slots := cutSlots(blocks, blackouts, busy)
+	for i := range slots {
+		slots[i].Start, slots[i].End = slots[i].Start.In(day.Location()), slots[i].End.In(day.Location())
+	}
+	if slots == nil {
+		slots = []TimeRange{}
+	}
+	return slots, nil
+}
+
+// FindOpenSlot returns the open session starting at startsAt, if there is one.
+func FindOpenSlot(tenantID, therapistID uuid.UUID, startsAt time.Time) (TimeRange, bool, error) {
+	loc := TenantLocation(tenantID)
+	slots, err := OpenSlots(tenantID, therapistID, startsAt.In(loc))
+	if err != nil {
+		return TimeRange{}, false, err
+	}
+	for _, s := range slots {
+		if s.Start.Equal(startsAt) {
+			return s, true, nil
+		}
+	}
+	return TimeRange{}, false, nil
+}
+
+// queryRanges reads (start, end) rows stored as UTC timestamps.
+func queryRanges(query string, args ...interface{}) ([]TimeRange, error) {
+	rows, err := database.PostgresDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ranges []TimeRange
+	for rows.Next() {
+		var r TimeRange
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// ── Time off ────────────────────────────────────────────────────────────────
+
+// CreateTimeOff blocks the practitioner's calendar and flags their appointments inside it.
+func CreateTimeOff(t models.AvailabilityTimeOff) (*models.AvailabilityTimeOff, []ScheduleConflict, error) {
+	t.StartsAt, t.EndsAt = t.StartsAt.UTC(), t.EndsAt.UTC()
+	if !t.EndsAt.After(t.StartsAt) || t.EndsAt.Sub(t.StartsAt) > MaxTimeOffDuration {
+		return nil, nil, ErrTimeOffRange
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(`
+		INSERT INTO availability_time_off (tenant_id, therapist_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, t.TenantID, t.TherapistID, t.StartsAt, t.EndsAt, strings.TrimSpace(t.Reason), t.CreatedBy).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflicts, err := flagScheduleConflicts(tx, ScheduleConflictTimeOff, t.ID, `a.therapist_id = $3`,
+		t.StartsAt, t.EndsAt, t.TherapistID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	t.Reason = strings.TrimSpace(t.Reason)
+	return &t, conflicts, nil
+}
+
+// flagScheduleConflicts marks upcoming active appointments overlapping [from, to) that match
+// scope ($3 onwards), unless they are already flagged.
+func flagScheduleConflicts(tx *sql.Tx, kind string, sourceID uuid.UUID, scope string, from, to time.Time, scopeArgs ...interface{}) ([]ScheduleConflict, error) {
+	args := append([]interface{}{from.UTC(), to.UTC()}, scopeArgs...)
+	args = append(args, kind, sourceID)
+	n := len(args)
+	rows, err := tx.Query(fmt.Sprintf(`
+		UPDATE appointments a SET schedule_conflict = $%d, schedule_conflict_id = $%d, updated_at = NOW()
+		WHERE a.starts_at < $2 AND a.ends_at > $1 AND a.ends_at > NOW()
+			AND a.status IN ('scheduled', 'confirmed', 'pending_payment')
+			AND a.schedule_conflict IS NULL
+			AND %s
+		RETURNING a.id, a.tenant_id, a.therapist_id, a.patient_id, a.starts_at, a.ends_at, a.status
+	`, n-1, n, scope), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conflicts := []ScheduleConflict{}
+	for rows.Next() {
+		var c ScheduleConflict
+		if err := rows.Scan(&c.AppointmentID, &c.TenantID, &c.TherapistID, &c.PatientID, &c.StartsAt, &c.EndsAt, &c.Status); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// clearScheduleConflicts drops the flags a removed time off or holiday put on appointments.
+func clearScheduleConflicts(tx *sql.Tx, sourceID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE appointments SET schedule_conflict = NULL, schedule_conflict_id = NULL, updated_at = NOW()
+		WHERE schedule_conflict_id = $1
+	`, sourceID)
+	return err
+}
+
+// ListTimeOff returns the practitioner's time off overlapping [from, to).
+func ListTimeOff(tenantID, therapistID uuid.UUID, from, to time.Time) ([]models.AvailabilityTimeOff, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, tenant_id, therapist_id, starts_at, ends_at, reason, created_by, created_at
+		FROM availability_time_off
+		WHERE tenant_id = $1 AND therapist_id = $2 AND starts_at < $4 AND ends_at > $3
+		ORDER BY starts_at
+	`, tenantID, therapistID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.AvailabilityTimeOff{}
+	for rows.Next() {
+		t, err := scanTimeOff(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// GetTimeOff loads one time off entry of the tenant.
+func GetTimeOff(tenantID, id uuid.UUID) (models.AvailabilityTimeOff, error) {
+	t, err := scanTimeOff(database.PostgresDB.QueryRow(`
+		SELECT id, tenant_id, therapist_id, starts_at, ends_at, reason, created_by, created_at
+		FROM availability_time_off WHERE id = $1 AND tenant_id = $2
+	`, id, tenantID))
+	if err == sql.ErrNoRows {
+		return t, ErrTimeOffNotFound
+	}
+	return t, err
+}
+
+func scanTimeOff(row rowScanner) (models.AvailabilityTimeOff, error) {
+	var t models.AvailabilityTimeOff
+	var createdBy uuid.NullUUID
+	err := row.Scan(&t.ID, &t.TenantID, &t.TherapistID, &t.StartsAt, &t.EndsAt, &t.Reason, &createdBy, &t.CreatedAt)
+	if createdBy.Valid {
+		t.CreatedBy = &createdBy.UUID
+	}
+	return t, err
+}
+
+// DeleteTimeOff removes time off and the conflict flags it set.
+func DeleteTimeOff(tenantID, id uuid.UUID) error {
+	return deleteAvailabilityException(`DELETE FROM availability_time_off WHERE id = $1 AND tenant_id = $2`,
+		tenantID, id, ErrTimeOffNotFound)
+}
+
+func deleteAvailabilityException(query string, tenantID, id uuid.UUID, notFound error) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(query, id, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return notFound
+	}
+	if err := clearScheduleConflicts(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ── Date overrides ──────────────────────────────────────────────────────────
+
+// CreateAvailabilityOverride adds extra availability on one date.
+func CreateAvailabilityOverride(o models.AvailabilityOverride) (*models.AvailabilityOverride, error) {
+	if _, err := time.Parse("2006-01-02", o.Date); err != nil {
+		return nil, errors.New("date must be YYYY-MM-DD")
+	}
+	if err := ValidateClockRange(o.StartTime, o.EndTime); err != nil {
+		return nil, err
+	}
+	if o.SlotDurationMin <= 0 {
+		o.SlotDurationMin = 60
+	}
+	if o.BufferMin < 0 {
+		o.BufferMin = 0
+	}
+	err := database.PostgresDB.QueryRow(`
+		INSERT INTO availability_overrides (tenant_id, therapist_id, date, start_time, end_time, slot_duration_min, buffer_min)
+		VALUES ($1, $2, $3, $4::time, $5::time, $6, $7)
+		RETURNING id, start_time::text, end_time::text, created_at
+	`, o.TenantID, o.TherapistID, o.Date, o.StartTime, o.EndTime, o.SlotDurationMin, o.BufferMin).
+		Scan(&o.ID, &o.StartTime, &o.EndTime, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// ListAvailabilityOverrides returns the practitioner's overrides for dates in [from, to].
+func ListAvailabilityOverrides(tenantID, therapistID uuid.UUID, from, to string) ([]models.AvailabilityOverride, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, tenant_id, therapist_id, to_char(date, 'YYYY-MM-DD'), start_time::text, end_time::text,
+			slot_duration_min, buffer_min, created_at
+		FROM availability_overrides
+		WHERE tenant_id = $1 AND therapist_id = $2 AND date BETWEEN $3 AND $4
+		ORDER BY date, start_time
+	`, tenantID, therapistID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.AvailabilityOverride{}
+	for rows.Next() {
+		var o models.AvailabilityOverride
+		if err := rows.Scan(&o.ID, &o.TenantID, &o.TherapistID, &o.Date, &o.StartTime, &o.EndTime,
+			&o.SlotDurationMin, &o.BufferMin, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// AvailabilityOverrideTherapist returns whose calendar an override belongs to.
+func AvailabilityOverrideTherapist(tenantID, id uuid.UUID) (uuid.UUID, error) {
+	var therapistID uuid.UUID
+	err := database.PostgresDB.QueryRow(`
+		SELECT therapist_id FROM availability_overrides WHERE id = $1 AND tenant_id = $2
+	`, id, tenantID).Scan(&therapistID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrOverrideNotFound
+	}
+	return therapistID, err
+}
+
+func DeleteAvailabilityOverride(tenantID, id uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`DELETE FROM availability_overrides WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOverrideNotFound
+	}
+	return nil
+}
+
+// ── Holidays ────────────────────────────────────────────────────────────────
+
+// AddTenantHolidays closes the practice on each holiday's date and flags the appointments on
+// it, except those of practitioners who added an override for the date. Holidays already on
+// the calendar (same date and name) are skipped.
+func AddTenantHolidays(tenantID uuid.UUID, holidays []models.TenantHoliday) ([]models.TenantHoliday, []ScheduleConflict, error) {
+	loc := TenantLocation(tenantID)
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	added := []models.TenantHoliday{}
+	conflicts := []ScheduleConflict{}
+	for _, h := range holidays {
+		day, err := time.ParseInLocation("2006-01-02", h.Date, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid holiday date %q", h.Date)
+		}
+		h.Name = strings.TrimSpace(h.Name)
+		if h.Name == "" {
+			h.Name = "Holiday"
+		}
+		if len(h.Name) > 255 {
+			h.Name = h.Name[:255]
+		}
+		if h.Source == "" {
+			h.Source = "manual"
+		}
+		h.TenantID = tenantID
+		err = tx.QueryRow(`
+			INSERT INTO tenant_holidays (tenant_id, date, name, source)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (tenant_id, date, name) DO NOTHING
+			RETURNING id, created_at
+		`, tenantID, h.Date, h.Name, h.Source).Scan(&h.ID, &h.CreatedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		added = append(added, h)
+
+		flagged, err := flagScheduleConflicts(tx, ScheduleConflictHoliday, h.ID, `a.tenant_id = $3
+			AND NOT EXISTS (SELECT 1 FROM availability_overrides o
+				WHERE o.tenant_id = a.tenant_id AND o.therapist_id = a.therapist_id AND o.date = $4)`,
+			day, day.AddDate(0, 0, 1), tenantID, h.Date)
+		if err != nil {
+			return nil, nil, err
+		}
+		conflicts = append(conflicts, flagged...)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return added, conflicts, nil
+}
+
+// ListTenantHolidays returns the practice's holidays for dates in [from, to].
+func ListTenantHolidays(tenantID uuid.UUID, from, to string) ([]models.TenantHoliday, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, tenant_id, to_char(date, 'YYYY-MM-DD'), name, source, created_at
+		FROM tenant_holidays
+		WHERE tenant_id = $1 AND date BETWEEN $2 AND $3
+		ORDER BY date, name
+	`, tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []models.TenantHoliday{}
+	for rows.Next() {
+		var h models.TenantHoliday
+		if err := rows.Scan(&h.ID, &h.TenantID, &h.Date, &h.Name, &h.Source, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// DeleteTenantHoliday reopens the date and clears the conflict flags the holiday set.
+func DeleteTenantHoliday(tenantID, id uuid.UUID) error {
+	return deleteAvailabilityException(`DELETE FROM tenant_holidays WHERE id = $1 AND tenant_id = $2`,
+		tenantID, id, ErrHolidayNotFound)
+}
+
+// NotifyScheduleConflicts tells each practitioner, other than the one who made the change,
+// how many of their appointments now need rescheduling.
+func NotifyScheduleConflicts(conflicts []ScheduleConflict, actorID uuid.UUID, cause string) {
+	counts := map[uuid.UUID]int{}
+	for _, c := range conflicts {
+		counts[c.TherapistID]++
+	}
+	for therapistID, n := range counts {
+		if therapistID == actorID {
+			continue
+		}
+		NotifyUser(therapistID, "therapist", "Appointments need rescheduling",
+			fmt.Sprintf("%d of your appointments fall on %s. Please reschedule or cancel them.", n, cause),
+			"schedule_conflict")
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCutSlotsBufferAndBlackouts(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	b, ok := blockOn(day, "09:00:00", "13:00:00", 50, 10)
+	if !ok {
+		t.Fatal("expected a valid block")
+	}
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+
+	slots := cutSlots([]availabilityBlock{b}, nil, nil)
+	if len(slots) != 4 || !slots[1].Start.Equal(at(10, 0)) || !slots[3].End.Equal(at(12, 50)) {
+		t.Fatalf("unexpected slots %v", slots)
+	}
+
+	// Time off over the 10:00 session, and a booking at 11:55 that leaves no buffer after the
+	// 11:00 session or before the 12:00 one
+	blackouts := []TimeRange{{Start: at(10, 0), End: at(10, 50)}}
+	busy := []TimeRange{{Start: at(11, 55), End: at(12, 0)}}
+	slots = cutSlots([]availabilityBlock{b}, blackouts, busy)
+	if len(slots) != 1 || !slots[0].Start.Equal(at(9, 0)) {
+		t.Fatalf("unexpected slots %v", slots)
+	}
+
+	// A booking ending ten minutes before the 12:00 session leaves it open
+	busy = []TimeRange{{Start: at(11, 0), End: at(11, 50)}}
+	slots = cutSlots([]availabilityBlock{b}, blackouts, busy)
+	if len(slots) != 2 || !slots[0].Start.Equal(at(9, 0)) || !slots[1].Start.Equal(at(12, 0)) {
+		t.Fatalf("unexpected slots %v", slots)
+	}
+}
+
+func TestCutSlotsMergesOverlappingBlocks(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	weekly, _ := blockOn(day, "09:00", "11:00", 60, 0)
+	override, _ := blockOn(day, "10:00", "12:00", 60, 0)
+	slots := cutSlots([]availabilityBlock{override, weekly}, nil, nil)
+	if len(slots) != 3 {
+		t.Fatalf("expected 3 distinct slots, got %v", slots)
+	}
+	for i := 1; i < len(slots); i++ {
+		if !slots[i-1].Start.Before(slots[i].Start) {
+			t.Fatalf("slots out of order: %v", slots)
+		}
+	}
+}
+
+func TestValidateClockRange(t *testing.T) {
+	if err := ValidateClockRange("09:00", "17:30:00"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [][2]string{{"17:00", "09:00"}, {"9", "10:00"}, {"09:00", "25:00"}, {"09:60", "10:00"}} {
+		if ValidateClockRange(c[0], c[1]) == nil {
+			t.Fatalf("expected error for %v", c)
+		}
+	}
+}
+
+func TestParseICalHolidays(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:diwali-2026",
+		"DTSTART;VALUE=DATE:20261108",
+		"DTEND;VALUE=DATE:20261110",
+		"SUMMARY:Diwali\\, day",
+		"  one and two",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:staff-day",
+		"DTSTART;TZID=Asia/Kolkata:20261225T090000",
+		"DTEND;TZID=Asia/Kolkata:20261225T170000",
+		"SUMMARY:Christmas",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	events, err := ParseICalEvents(strings.NewReader(ics), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[0].AllDay || events[0].Summary != "Diwali, day one and two" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	holidays, err := HolidaysFromICal(events, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dates []string
+	for _, h := range holidays {
+		dates = append(dates, h.Date)
+	}
+	if strings.Join(dates, ",") != "2026-11-08,2026-11-09,2026-12-25" {
+		t.Fatalf("unexpected holiday dates %v", dates)
+	}
+
+	if _, err := ParseICalEvents(strings.NewReader("hello"), loc); err == nil {
+		t.Fatal("expected error for a non-calendar body")
+	}
+}
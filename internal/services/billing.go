@@ -3,7 +3,6 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"math"
 	"time"
 
@@ -12,8 +11,18 @@ import (
 	"github.com/google/uuid"
 )
 
+// billingProfileQueryer is satisfied by both *sql.DB and *sql.Tx.
+type billingProfileQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func EnsureBillingProfile(tenantID uuid.UUID) error {
-	_, err := database.PostgresDB.Exec(`
+	return ensureBillingProfile(database.PostgresDB, tenantID)
+}
+
+func ensureBillingProfile(q billingProfileQueryer, tenantID uuid.UUID) error {
+	_, err := q.Exec(`
 		INSERT INTO billing_profiles (tenant_id) VALUES ($1)
 		ON CONFLICT (tenant_id) DO NOTHING
 	`, tenantID)
@@ -21,20 +30,29 @@ func EnsureBillingProfile(tenantID uuid.UUID) error {
 }
 
 func GetBillingProfile(tenantID uuid.UUID) (models.BillingProfile, error) {
-	_ = EnsureBillingProfile(tenantID)
+	return loadBillingProfile(database.PostgresDB, tenantID)
+}
+
+// loadBillingProfile reads the profile through q, creating it if missing, so callers inside a
+// transaction see and lock nothing outside it.
+func loadBillingProfile(q billingProfileQueryer, tenantID uuid.UUID) (models.BillingProfile, error) {
+	_ = ensureBillingProfile(q, tenantID)
 	var p models.BillingProfile
 	var consult, session, gst sql.NullFloat64
-	var prefix, currency, gstNum sql.NullString
+	var prefix, currency, gstNum, address, stateCode, numberFormat, cnPrefix, provider sql.NullString
 	var packages sql.NullString
 	var sessionInPerson, sessionChat, sessionVoice, sessionVideo sql.NullFloat64
-	err := database.PostgresDB.QueryRow(`
+	err := q.QueryRow(`
 		SELECT tenant_id, consultation_fee, session_fee, package_fees, gst_rate,
 			invoice_prefix, currency, gst_number, created_at, updated_at,
-			session_fee_in_person, session_fee_chat, session_fee_voice, session_fee_video
+			session_fee_in_person, session_fee_chat, session_fee_voice, session_fee_video,
+			sac_code, business_address, state_code, invoice_number_format, credit_note_prefix,
+			payment_provider
 		FROM billing_profiles WHERE tenant_id = $1
 	`, tenantID).Scan(&p.TenantID, &consult, &session, &packages, &gst,
 		&prefix, &currency, &gstNum, &p.CreatedAt, &p.UpdatedAt,
-		&sessionInPerson, &sessionChat, &sessionVoice, &sessionVideo)
+		&sessionInPerson, &sessionChat, &sessionVoice, &sessionVideo,
+		&p.SACCode, &address, &stateCode, &numberFormat, &cnPrefix, &provider)
 	if err != nil {
 		return p, err
 	}
@@ -57,6 +75,23 @@ func GetBillingProfile(tenantID uuid.UUID) (models.BillingProfile, error) {
 		p.Currency = "INR"
 	}
 	p.GSTNumber = gstNum.String
+	p.InvoiceNumberFormat = numberFormat.String
+	if p.InvoiceNumberFormat == "" {
+		p.InvoiceNumberFormat = DefaultInvoiceNumberFormat
+	}
+	p.CreditNotePrefix = cnPrefix.String
+	p.PaymentProvider = provider.String
+	if p.PaymentProvider == "" {
+		p.PaymentProvider = DefaultPaymentProvider
+	}
+	if p.CreditNotePrefix == "" {
+		p.CreditNotePrefix = "CN"
+	}
+	p.BusinessAddress = address.String
+	p.StateCode = stateCode.String
+	if p.StateCode == "" {
+		p.StateCode = GSTINStateCode(p.GSTNumber)
+	}
 	if packages.Valid {
 		p.PackageFees = json.RawMessage(packages.String)
 	}
@@ -69,18 +104,6 @@ func CalcInvoiceTotals(subtotal, gstRate float64) (gst, total float64) {
 	return
 }
 
-func NextInvoiceNumber(tenantID uuid.UUID, prefix string) (string, error) {
-	var count int
-	err := database.PostgresDB.QueryRow(`
-		SELECT COUNT(*) FROM invoices WHERE tenant_id = $1
-	`, tenantID).Scan(&count)
-	if err != nil {
-		return "", err
-	}
-	year := time.Now().Year()
-	return fmt.Sprintf("%s-%d-%04d", prefix, year, count+1), nil
-}
-
 func LineItemsFromAppointment(tenantID uuid.UUID, appointmentID uuid.UUID) ([]models.InvoiceLineItem, error) {
 	profile, err := GetBillingProfile(tenantID)
 	if err != nil {
@@ -150,6 +173,10 @@ func CreateDraftInvoiceFromAppointment(tenantID, appointmentID uuid.UUID) error
 	if exists > 0 {
 		return nil
 	}
+	// Sessions covered by a prepaid package draw a credit instead of being invoiced.
+	if consumed, err := ConsumePackageCredit(tenantID, appointmentID); err != nil || consumed {
+		return err
+	}
 
 	var patientID uuid.UUID
 	err := database.PostgresDB.QueryRow(`
@@ -167,17 +194,44 @@ func CreateDraftInvoiceFromAppointment(tenantID, appointmentID uuid.UUID) error
 	profile, _ := GetBillingProfile(tenantID)
 	subtotal := SumLineItems(items)
 	gst, total := CalcInvoiceTotals(subtotal, profile.GSTRate)
-	invNum, err := NextInvoiceNumber(tenantID, profile.InvoicePrefix)
-	if err != nil {
-		return err
-	}
 	dueAt := time.Now().AddDate(0, 0, 7)
 	itemsJSON, _ := json.Marshal(items)
 	_, err = database.PostgresDB.Exec(`
 		INSERT INTO invoices (
-			tenant_id, patient_id, invoice_number, appointment_id,
+			tenant_id, patient_id, appointment_id,
 			subtotal, gst_amount, total, currency, status, due_at, line_items
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,'draft',$9,$10)
-	`, tenantID, patientID, invNum, appointmentID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON)
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,'draft',$8,$9)
+	`, tenantID, patientID, appointmentID, subtotal, gst, total, profile.Currency, dueAt, itemsJSON)
 	return err
 }
+
+// SettleInvoicePayments recomputes amount_paid from the invoice's succeeded payments and moves it
+// to partially_paid or paid. A payment issues the invoice, so drafts are numbered first, and a
+// fully paid package invoice grants the package's credits.
+func SettleInvoicePayments(tx *sql.Tx, tenantID, invoiceID uuid.UUID) error {
+	if _, err := AssignInvoiceNumber(tx, tenantID, invoiceID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		UPDATE invoices i SET
+			amount_paid = p.paid,
+			status = CASE WHEN p.paid >= i.total THEN 'paid' WHEN p.paid > 0 THEN 'partially_paid' ELSE i.status END,
+			paid_at = CASE WHEN p.paid >= i.total THEN COALESCE(i.paid_at, NOW()) ELSE i.paid_at END,
+			updated_at = NOW()
+		FROM (
+			SELECT COALESCE(SUM(amount), 0) AS paid FROM payments
+			WHERE invoice_id = $1 AND tenant_id = $2 AND status = 'succeeded'
+		) p
+		WHERE i.id = $1 AND i.tenant_id = $2
+	`, invoiceID, tenantID)
+	if err != nil {
+		return err
+	}
+	return activatePackagesForInvoice(tx, tenantID, invoiceID)
+}
+
+// InvoiceBalanceDue is what the patient still owes. Refunds are always matched by a credit note
+// of the same amount, so they reduce what was kept and the invoice value equally.
+func InvoiceBalanceDue(total, amountPaid float64) float64 {
+	return math.Max(0, math.Round((total-amountPaid)*100)/100)
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/models"
 )
@@ -24,3 +26,54 @@ func TestSumLineItems(t *testing.T) {
 		t.Fatalf("got %v", sum)
 	}
 }
+
+func TestFinancialYearStart(t *testing.T) {
+	if got := FinancialYearStart(time.Date(2027, 3, 31, 23, 0, 0, 0, time.UTC)); got != 2026 {
+		t.Fatalf("31 Mar 2027: got %d", got)
+	}
+	if got := FinancialYearStart(time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC)); got != 2027 {
+		t.Fatalf("1 Apr 2027: got %d", got)
+	}
+}
+
+func TestFormatInvoiceNumber(t *testing.T) {
+	got, err := FormatInvoiceNumber(DefaultInvoiceNumberFormat, "INV", 2026, 42)
+	if err != nil || got != "INV/2026-27/00042" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	got, _ = FormatInvoiceNumber("{prefix}-{fy_short}-{seq}", "CL", 2099, 7)
+	if got != "CL-99-00-7" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestDocumentNumberPattern(t *testing.T) {
+	// A tenant whose format renders legacy-shaped numbers must continue after them
+	re := regexp.MustCompile(documentNumberPattern("{prefix}-{fy_start}-{seq:04}", "INV.1", 2026))
+	for number, want := range map[string]string{
+		"INV.1-2026-0042":  "0042",
+		"INV.1-2026-12345": "12345",
+		"INV.1-2025-0042":  "",
+		"INVX1-2026-0042":  "",
+		"INV.1-2026-42a":   "",
+	} {
+		got := ""
+		if m := re.FindStringSubmatch(number); m != nil {
+			got = m[1]
+		}
+		if got != want {
+			t.Errorf("%s: sequence %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestValidateInvoiceNumberFormat(t *testing.T) {
+	if err := ValidateInvoiceNumberFormat(DefaultInvoiceNumberFormat); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"{prefix}-{seq}", "{prefix}/{fy}", "{prefix}/{fy}/{seq}/{month}", "{prefix}/{fy}/{seq:05"} {
+		if ValidateInvoiceNumberFormat(bad) == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
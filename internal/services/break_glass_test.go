@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateBreakGlassRequest(t *testing.T) {
+	reason := "Patient disclosed suicidal intent; assigned therapist unreachable"
+	cases := []struct {
+		name     string
+		req      BreakGlassRequest
+		want     error
+		duration time.Duration
+	}{
+		{"defaults duration", BreakGlassRequest{Justification: reason}, nil, BreakGlassDefaultDuration},
+		{"custom duration", BreakGlassRequest{Justification: reason, Duration: 30 * time.Minute}, nil, 30 * time.Minute},
+		{"short justification", BreakGlassRequest{Justification: "emergency"}, ErrBreakGlassJustification, 0},
+		{"padding does not count", BreakGlassRequest{Justification: "   emergency " + strings.Repeat(" ", 20)}, ErrBreakGlassJustification, 0},
+		{"too short", BreakGlassRequest{Justification: reason, Duration: time.Minute}, ErrBreakGlassDuration, 0},
+		{"too long", BreakGlassRequest{Justification: reason, Duration: 5 * time.Hour}, ErrBreakGlassDuration, 0},
+	}
+	for _, tc := range cases {
+		req := tc.req
+		err := validateBreakGlassRequest(&req)
+		if err != tc.want {
+			t.Fatalf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+		if err == nil && (req.Duration != tc.duration || req.Justification != reason) {
+			t.Fatalf("%s: got duration %v, justification %q", tc.name, req.Duration, req.Justification)
+		}
+	}
+}
+
+func TestBreakGlassPermissionsAreReadOnly(t *testing.T) {
+	perms := BreakGlassPermissions()
+	if !perms.Has(PermPatientsRead, PermNotesRead, PermClinicalRead) {
+		t.Fatalf("break-glass cannot read the clinical record: %v", perms.List())
+	}
+	for _, p := range []string{PermPatientsWrite, PermNotesWrite, PermClinicalWrite, PermMessagesWrite, PermInvoicesRead} {
+		if perms[p] {
+			t.Fatalf("break-glass grants %s", p)
+		}
+	}
+}
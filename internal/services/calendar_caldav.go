@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// caldavMaxResponse caps how much of a server response is read
+	caldavMaxResponse = 8 << 20
+	// caldavDiscoveryMaxHops bounds the principal lookups when finding a calendar
+	caldavDiscoveryMaxHops = 3
+)
+
+var (
+	ErrCalDAVInvalidURL     = errors.New("caldav server URL must be a public https URL")
+	ErrCalDAVUnauthorized   = errors.New("caldav server rejected the username or password")
+	ErrCalDAVNoCalendar     = errors.New("no calendar for events found on the caldav server")
+	errCalDAVPrivateAddress = errors.New("caldav server resolves to a private address")
+)
+
+// caldavFilenameReplacer turns an event UID into a safe resource name
+var caldavFilenameReplacer = strings.NewReplacer("@", "-", "/", "-", "\\", "-", "?", "-", "#", "-", "%", "-")
+
+// caldavHTTPClient talks to servers the practitioner chose, so it refuses to connect to
+// private, loopback and link-local addresses, whatever the host name resolves to at the time.
+var caldavHTTPClient = &http.Client{
+	Timeout: 20 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refusePrivateAddresses(errCalDAVPrivateAddress),
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// refusePrivateAddresses is a net.Dialer Control hook that fails with refused when the address
+// being dialled is not public. It runs after DNS resolution, so rebinding can't get around it.
+func refusePrivateAddresses(refused error) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+			return refused
+		}
+		return nil
+	}
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// CalDAVProvider writes appointments to a calendar collection on a CalDAV server (RFC 4791),
+// such as iCloud, Fastmail or Nextcloud, using HTTP basic auth with an app password. CalDAV
+// servers do not email attendees, so patients keep getting Serenify's own invites.
+type CalDAVProvider struct {
+	// CalendarURL is the calendar collection, or before Connect any URL on the server
+	CalendarURL string
+	Username    string
+	Password    string
+	Client      *http.Client
+	// Location reads all-day and floating times; UTC when nil
+	Location *time.Location
+}
+
+// Connect finds the calendar to sync with: CalendarURL itself when it is a calendar,
+// otherwise the first event calendar in the account's calendar home.
+func (p *CalDAVProvider) Connect(ctx context.Context) (string, error) {
+	target := p.CalendarURL
+	for hop := 0; hop < caldavDiscoveryMaxHops; hop++ {
+		res, err := p.propfind(ctx, target, "0", `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+<d:prop><d:resourcetype/><d:current-user-principal/><c:calendar-home-set/><c:supported-calendar-component-set/></d:prop>
+</d:propfind>`)
+		if err != nil {
+			return "", err
+		}
+		if len(res) == 0 {
+			return "", ErrCalDAVNoCalendar
+		}
+		prop := res[0].prop()
+		switch {
+		case prop.ResourceType.Calendar != nil && prop.supportsEvents():
+			return res[0].Href, nil
+		case prop.CalendarHomeSet.Href != "":
+			return p.findEventCalendar(ctx, resolveDAVHref(target, prop.CalendarHomeSet.Href))
+		case prop.CurrentUserPrincipal.Href != "":
+			principal := resolveDAVHref(target, prop.CurrentUserPrincipal.Href)
+			if principal == target {
+				return "", ErrCalDAVNoCalendar
+			}
+			target = principal
+		default:
+			return "", ErrCalDAVNoCalendar
+		}
+	}
+	return "", ErrCalDAVNoCalendar
+}
+
+func (p *CalDAVProvider) findEventCalendar(ctx context.Context, home string) (string, error) {
+	res, err := p.propfind(ctx, home, "1", `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+<d:prop><d:resourcetype/><c:supported-calendar-component-set/></d:prop>
+</d:propfind>`)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range res {
+		if prop := r.prop(); prop.ResourceType.Calendar != nil && prop.supportsEvents() {
+			return r.Href, nil
+		}
+	}
+	return "", ErrCalDAVNoCalendar
+}
+
+// UpsertEvent stores the event as <uid>.ics in the calendar and returns the resource URL.
+func (p *CalDAVProvider) UpsertEvent(ctx context.Context, eventID string, e CalendarEvent) (string, error) {
+	var body bytes.Buffer
+	err := WriteICalendar(&body, ICalendar{Events: []ICalEvent{{
+		UID:         e.UID,
+		Summary:     e.Summary,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       e.Start,
+		End:         e.End,
+	}}})
+	if err != nil {
+		return "", err
+	}
+
+	target, create := eventID, eventID == ""
+	if create {
+		target = strings.TrimRight(p.CalendarURL, "/") + "/" + caldavFilenameReplacer.Replace(e.UID) + ".ics"
+	}
+	status, err := p.putEvent(ctx, target, body.Bytes(), create)
+	if err == nil && status == http.StatusPreconditionFailed {
+		// Created before but the mapping was lost; replace it
+		status, err = p.putEvent(ctx, target, body.Bytes(), false)
+	}
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK && status != http.StatusCreated && status != http.StatusNoContent {
+		return "", fmt.Errorf("caldav PUT %s: status %d", target, status)
+	}
+	return target, nil
+}
+
+func (p *CalDAVProvider) putEvent(ctx context.Context, target string, body []byte, create bool) (int, error) {
+	header := http.Header{"Content-Type": {"text/calendar; charset=utf-8"}}
+	if create {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := p.do(ctx, http.MethodPut, target, header, body)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (p *CalDAVProvider) DeleteEvent(ctx context.Context, eventID string) error {
+	resp, err := p.do(ctx, http.MethodDelete, eventID, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusGone:
+		return nil
+	}
+	return fmt.Errorf("caldav DELETE %s: status %d", eventID, resp.StatusCode)
+}
+
+// ListBusy runs a calendar-query for events overlapping the range, with recurring events
+// expanded by the server. Cancelled events and events marked free are left out.
+func (p *CalDAVProvider) ListBusy(ctx context.Context, from, to time.Time) ([]CalendarBusyEvent, error) {
+	start, end := icalUTC(from), icalUTC(to)
+	body := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+<d:prop><d:getetag/><c:calendar-data><c:expand start="` + start + `" end="` + end + `"/></c:calendar-data></d:prop>
+<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+<c:time-range start="` + start + `" end="` + end + `"/>
+</c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+	res, err := p.multistatus(ctx, "REPORT", p.CalendarURL, "1", body)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var busy []CalendarBusyEvent
+	for _, r := range res {
+		data := r.prop().CalendarData
+		if data == "" {
+			continue
+		}
+		events, err := ParseICalEvents(strings.NewReader(data), loc)
+		if err != nil {
+			log.Printf("[CalDAV] Skipping unreadable event %s: %v", r.Href, err)
+			continue
+		}
+		for _, e := range events {
+			if e.Status == "CANCELLED" || e.Transparent || !e.End.After(e.Start) ||
+				!e.Start.Before(to) || !e.End.After(from) {
+				continue
+			}
+			id := r.Href
+			if len(events) > 1 {
+				// Instances of an expanded recurring event share the resource
+				id += "#" + strconv.FormatInt(e.Start.Unix(), 10)
+			}
+			busy = append(busy, CalendarBusyEvent{EventID: id, TimeRange: TimeRange{Start: e.Start.UTC(), End: e.End.UTC()}})
+		}
+	}
+	return busy, nil
+}
+
+func (p *CalDAVProvider) do(ctx context.Context, method, target string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.SetBasicAuth(p.Username, p.Password)
+	client := p.Client
+	if client == nil {
+		client = caldavHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		return nil, ErrCalDAVUnauthorized
+	}
+	return resp, nil
+}
+
+func (p *CalDAVProvider) propfind(ctx context.Context, target, depth, body string) ([]davResponse, error) {
+	return p.multistatus(ctx, "PROPFIND", target, depth, body)
+}
+
+// multistatus sends a WebDAV request and returns its responses with hrefs made absolute.
+func (p *CalDAVProvider) multistatus(ctx context.Context, method, target, depth, body string) ([]davResponse, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := p.do(ctx, method, target, header, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("caldav %s %s: status %d", method, target, resp.StatusCode)
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, caldavMaxResponse)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("caldav %s %s: %w", method, target, err)
+	}
+	for i := range ms.Responses {
+		ms.Responses[i].Href = resolveDAVHref(target, ms.Responses[i].Href)
+	}
+	return ms.Responses, nil
+}
+
+func resolveDAVHref(base, href string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return href
+	}
+	h, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return b.ResolveReference(h).String()
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	CurrentUserPrincipal davHref `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	ComponentSet         *struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+// prop returns the properties the server found; those in non-200 propstats are missing.
+func (r davResponse) prop() davProp {
+	for _, ps := range r.Propstats {
+		if strings.Contains(ps.Status, " 200 ") || strings.HasSuffix(ps.Status, " 200") {
+			return ps.Prop
+		}
+	}
+	return davProp{}
+}
+
+// supportsEvents reports whether a calendar can hold VEVENTs. Calendars that do not say
+// accept every component.
+func (p davProp) supportsEvents() bool {
+	if p.ComponentSet == nil || len(p.ComponentSet.Comps) == 0 {
+		return true
+	}
+	for _, c := range p.ComponentSet.Comps {
+		if strings.EqualFold(c.Name, "VEVENT") {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectCalDAVCalendar connects the practitioner's calendar on a CalDAV server, replacing any
+// other calendar connection. The password should be an app-specific one; it is stored
+// encrypted.
+func ConnectCalDAVCalendar(tenantID, therapistID uuid.UUID, serverURL, username, password string) error {
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return ErrCalDAVInvalidURL
+	}
+	provider := &CalDAVProvider{CalendarURL: u.String(), Username: username, Password: password,
+		Location: TenantLocation(tenantID)}
+	ctx, cancel := context.WithTimeout(context.Background(), calendarSyncTimeout)
+	defer cancel()
+	calendarURL, err := provider.Connect(ctx)
+	if errors.Is(err, errCalDAVPrivateAddress) {
+		return ErrCalDAVInvalidURL
+	}
+	if err != nil {
+		return err
+	}
+
+	passwordEnc, err := utils.Encrypt(password)
+	if err != nil {
+		return err
+	}
+	integrationID, err := saveCalendarIntegration(calendarIntegration{
+		TenantID:    tenantID,
+		TherapistID: therapistID,
+		Provider:    CalendarProviderCalDAV,
+		CalendarID:  calendarURL,
+		Username:    username,
+		accessEnc:   passwordEnc,
+	}, time.Time{})
+	if err != nil {
+		return err
+	}
+	log.Printf("[CalDAV] Connected calendar %s for therapist %s", calendarURL, therapistID)
+	go startCalendarIntegration(tenantID, therapistID, integrationID)
+	return nil
+}
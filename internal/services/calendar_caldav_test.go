@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCalDAV is a stand-in CalDAV server: a principal with a calendar home holding a task
+// list and an event calendar, whose resources live in memory.
+type fakeCalDAV struct {
+	mu        sync.Mutex
+	resources map[string]string
+}
+
+const fakeCalDAVCalendar = "/calendars/alex/work/"
+
+func newFakeCalDAV(t *testing.T) (*fakeCalDAV, *httptest.Server) {
+	t.Helper()
+	f := &fakeCalDAV{resources: map[string]string{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeCalDAV) put(path, ics string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resources[path] = ics
+}
+
+func (f *fakeCalDAV) get(path string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ics, ok := f.resources[path]
+	return ics, ok
+}
+
+func (f *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "alex" || pass != "app-password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	multistatus := func(body string) {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`+body+`</d:multistatus>`)
+	}
+	response := func(href, props string) string {
+		return `<d:response><d:href>` + href + `</d:href><d:propstat><d:prop>` + props +
+			`</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+	}
+
+	switch {
+	case r.Method == "PROPFIND" && r.URL.Path == "/":
+		multistatus(response("/", `<d:resourcetype><d:collection/></d:resourcetype>
+			<d:current-user-principal><d:href>/principals/alex/</d:href></d:current-user-principal>`) +
+			`<d:response><d:href>/</d:href><d:propstat><d:prop><c:calendar-home-set/></d:prop>
+			<d:status>HTTP/1.1 404 Not Found</d:status></d:propstat></d:response>`)
+	case r.Method == "PROPFIND" && r.URL.Path == "/principals/alex/":
+		multistatus(response(r.URL.Path, `<d:resourcetype><d:principal/></d:resourcetype>
+			<c:calendar-home-set><d:href>/calendars/alex/</d:href></c:calendar-home-set>`))
+	case r.Method == "PROPFIND" && r.URL.Path == "/calendars/alex/":
+		if r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		multistatus(response("/calendars/alex/", `<d:resourcetype><d:collection/></d:resourcetype>`) +
+			response("/calendars/alex/tasks/", `<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>`) +
+			response(fakeCalDAVCalendar, `<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>
+				<c:supported-calendar-component-set><c:comp name="VEVENT"/></c:supported-calendar-component-set>`))
+	case r.Method == "REPORT" && r.URL.Path == fakeCalDAVCalendar:
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte("calendar-query")) || !bytes.Contains(body, []byte(`<c:expand start=`)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		paths := make([]string, 0, len(f.resources))
+		for p := range f.resources {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		var out strings.Builder
+		for _, p := range paths {
+			var data bytes.Buffer
+			_ = xml.EscapeText(&data, []byte(f.resources[p]))
+			out.WriteString(response(p, `<d:getetag>"1"</d:getetag><c:calendar-data>`+data.String()+`</c:calendar-data>`))
+		}
+		multistatus(out.String())
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, fakeCalDAVCalendar):
+		_, exists := f.resources[r.URL.Path]
+		if exists && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.resources[r.URL.Path] = string(body)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, fakeCalDAVCalendar):
+		if _, ok := f.resources[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.resources, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func fakeCalDAVEvent(uid string, start time.Time, extra string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\n" +
+		"DTSTART:" + icalUTC(start) + "\r\nDTEND:" + icalUTC(start.Add(time.Hour)) + "\r\n" +
+		extra + "END:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestCalDAVProviderSync(t *testing.T) {
+	fake, srv := newFakeCalDAV(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	from, to := day, day.Add(48*time.Hour)
+
+	p := &CalDAVProvider{CalendarURL: srv.URL + "/", Username: "alex", Password: "app-password", Client: srv.Client()}
+	calendarURL, err := p.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendarURL != srv.URL+fakeCalDAVCalendar {
+		t.Fatalf("discovered %q", calendarURL)
+	}
+	p.CalendarURL = calendarURL
+
+	fake.put(fakeCalDAVCalendar+"dentist.ics", fakeCalDAVEvent("dentist", day.Add(9*time.Hour), ""))
+	fake.put(fakeCalDAVCalendar+"reminder.ics", fakeCalDAVEvent("reminder", day.Add(11*time.Hour), "TRANSP:TRANSPARENT\r\n"))
+	fake.put(fakeCalDAVCalendar+"called-off.ics", fakeCalDAVEvent("called-off", day.Add(12*time.Hour), "STATUS:CANCELLED\r\n"))
+
+	event := CalendarEvent{
+		UID:           "6f1c2b1e-8d4a-4c1e-9a55-2f1d3e4b5c6d@serenify",
+		Summary:       "Session: Sam",
+		Description:   "Type: video",
+		Start:         day.Add(14 * time.Hour),
+		End:           day.Add(14*time.Hour + 50*time.Minute),
+		AttendeeEmail: "sam@example.com",
+	}
+	eventID, err := p.UpsertEvent(ctx, "", event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fakeCalDAVCalendar + "6f1c2b1e-8d4a-4c1e-9a55-2f1d3e4b5c6d-serenify.ics"
+	if eventID != srv.URL+path {
+		t.Fatalf("event ID %q", eventID)
+	}
+	stored, ok := fake.get(path)
+	if !ok || !strings.Contains(stored, "UID:"+event.UID) || strings.Contains(stored, "METHOD:") ||
+		strings.Contains(stored, "ATTENDEE") {
+		t.Fatalf("stored event:\n%s", stored)
+	}
+
+	busy, err := p.ListBusy(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]TimeRange{}
+	for _, b := range busy {
+		got[strings.TrimPrefix(b.EventID, srv.URL)] = b.TimeRange
+	}
+	if len(got) != 2 || !got[fakeCalDAVCalendar+"dentist.ics"].Start.Equal(day.Add(9*time.Hour)) ||
+		!got[path].Start.Equal(event.Start) {
+		t.Fatalf("busy times %v", got)
+	}
+
+	event.Start, event.End = event.Start.Add(2*time.Hour), event.End.Add(2*time.Hour)
+	if id, err := p.UpsertEvent(ctx, eventID, event); err != nil || id != eventID {
+		t.Fatalf("update: %q %v", id, err)
+	}
+	// A lost mapping writes over the existing resource instead of failing
+	if id, err := p.UpsertEvent(ctx, "", event); err != nil || id != eventID {
+		t.Fatalf("recreate: %q %v", id, err)
+	}
+	busy, err = p.ListBusy(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range busy {
+		if b.EventID == eventID && !b.Start.Equal(day.Add(16*time.Hour)) {
+			t.Fatalf("moved event busy at %v", b.Start)
+		}
+	}
+
+	if err := p.DeleteEvent(ctx, eventID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.get(path); ok {
+		t.Fatal("event not deleted")
+	}
+	if err := p.DeleteEvent(ctx, eventID); err != nil {
+		t.Fatalf("deleting a missing event: %v", err)
+	}
+
+	p.Password = "wrong"
+	if _, err := p.ListBusy(ctx, from, to); !errors.Is(err, ErrCalDAVUnauthorized) {
+		t.Fatalf("expected ErrCalDAVUnauthorized, got %v", err)
+	}
+}
+
+func TestCalDAVClientRefusesPrivateAddresses(t *testing.T) {
+	_, srv := newFakeCalDAV(t)
+	p := &CalDAVProvider{CalendarURL: srv.URL + "/", Username: "alex", Password: "app-password"}
+	if _, err := p.Connect(context.Background()); !errors.Is(err, errCalDAVPrivateAddress) {
+		t.Fatalf("expected errCalDAVPrivateAddress, got %v", err)
+	}
+}
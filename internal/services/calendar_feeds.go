@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// Calendar feed owners. A therapist feed covers every practice they work in; a patient feed
+// covers every patient record linked to the same user account.
+const (
+	CalendarFeedTherapist = "therapist"
+	CalendarFeedPatient   = "patient"
+)
+
+const (
+	// calendarFeedPast keeps recent sessions in subscribed calendars instead of dropping them
+	// the moment they start.
+	calendarFeedPast    = 30 * 24 * time.Hour
+	calendarFeedAhead   = 365 * 24 * time.Hour
+	calendarFeedMaxRows = 2000
+)
+
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+var (
+	calendarFeedBaseURL = "http://localhost:8080"
+	calendarOrganizer   = ICalAttendee{Name: "Serenify", Email: "no-reply@localhost"}
+)
+
+// InitCalendarFeeds sets the public base URL of feed links and the ORGANIZER of .ics invites.
+func InitCalendarFeeds(cfg *config.Config) {
+	if cfg.Host != "" {
+		calendarFeedBaseURL = strings.TrimRight(cfg.Host, "/")
+	}
+	if addr, err := mail.ParseAddress(cfg.SMTPFrom); err == nil {
+		calendarOrganizer = ICalAttendee{Name: addr.Name, Email: addr.Address}
+		if calendarOrganizer.Name == "" {
+			calendarOrganizer.Name = "Serenify"
+		}
+	} else if u, err := url.Parse(calendarFeedBaseURL); err == nil && u.Hostname() != "" {
+		calendarOrganizer.Email = "no-reply@" + u.Hostname()
+	}
+}
+
+// CalendarFeed is an ICS subscription. URL is only known right after the token is created.
+type CalendarFeed struct {
+	ID         uuid.UUID  `json:"id"`
+	OwnerRole  string     `json:"owner_role"`
+	OwnerID    uuid.UUID  `json:"owner_id"`
+	URL        string     `json:"url,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// GetCalendarFeed returns the owner's active feed, or ErrCalendarFeedNotFound.
+func GetCalendarFeed(ownerRole string, ownerID uuid.UUID) (*CalendarFeed, error) {
+	return scanCalendarFeed(database.PostgresDB.QueryRow(`
+		SELECT id, owner_role, owner_id, created_at, last_used_at FROM calendar_feed_tokens
+		WHERE owner_role = $1 AND owner_id = $2 AND revoked_at IS NULL
+	`, ownerRole, ownerID))
+}
+
+// RotateCalendarFeed revokes the owner's active feed, if any, and issues a new secret URL.
+func RotateCalendarFeed(ownerRole string, ownerID uuid.UUID) (*CalendarFeed, error) {
+	token, err := newCalendarSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE calendar_feed_tokens SET revoked_at = NOW()
+		WHERE owner_role = $1 AND owner_id = $2 AND revoked_at IS NULL
+	`, ownerRole, ownerID); err != nil {
+		return nil, err
+	}
+	feed, err := scanCalendarFeed(tx.QueryRow(`
+		INSERT INTO calendar_feed_tokens (owner_role, owner_id, token_hash) VALUES ($1, $2, $3)
+		RETURNING id, owner_role, owner_id, created_at, last_used_at
+	`, ownerRole, ownerID, hashToken(token)))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	feed.URL = calendarFeedBaseURL + "/api/v1/calendar/feeds/" + token + ".ics"
+	return feed, nil
+}
+
+// RevokeCalendarFeed stops the owner's active feed URL from working.
+func RevokeCalendarFeed(ownerRole string, ownerID uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE calendar_feed_tokens SET revoked_at = NOW()
+		WHERE owner_role = $1 AND owner_id = $2 AND revoked_at IS NULL
+	`, ownerRole, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCalendarFeedNotFound
+	}
+	return nil
+}
+
+// CalendarFeedForToken resolves an active feed from the token in its URL and records the use.
+func CalendarFeedForToken(token string) (*CalendarFeed, error) {
+	if token == "" {
+		return nil, ErrCalendarFeedNotFound
+	}
+	return scanCalendarFeed(database.PostgresDB.QueryRow(`
+		UPDATE calendar_feed_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		RETURNING id, owner_role, owner_id, created_at, last_used_at
+	`, hashToken(token)))
+}
+
+// newCalendarSecret returns a random token for a feed URL or a Google watch channel.
+func newCalendarSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func scanCalendarFeed(row rowScanner) (*CalendarFeed, error) {
+	var f CalendarFeed
+	var lastUsed sql.NullTime
+	err := row.Scan(&f.ID, &f.OwnerRole, &f.OwnerID, &f.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, ErrCalendarFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		f.LastUsedAt = &lastUsed.Time
+	}
+	return &f, nil
+}
+
+// RenderCalendarFeed writes the feed's sessions from calendarFeedPast ago to a year ahead.
+// Cancelled and unpaid bookings are left out; events carry no clinical notes.
+func RenderCalendarFeed(feed *CalendarFeed) ([]byte, error) {
+	from := time.Now().UTC().Add(-calendarFeedPast)
+	to := time.Now().UTC().Add(calendarFeedAhead)
+
+	var ownerFilter, name string
+	switch feed.OwnerRole {
+	case CalendarFeedTherapist:
+		ownerFilter = `a.therapist_id = $1`
+		name = "Serenify sessions"
+	case CalendarFeedPatient:
+		ownerFilter = `a.patient_id IN (
+			SELECT id FROM patients WHERE id = $1
+			UNION
+			SELECT o.id FROM patients o JOIN patients p ON p.user_id = o.user_id
+			WHERE p.id = $1 AND o.deleted_at IS NULL
+		)`
+		name = "My therapy sessions"
+	default:
+		return nil, ErrCalendarFeedNotFound
+	}
+
+	rows, err := database.PostgresDB.Query(`
+		SELECT a.id, a.starts_at, a.ends_at, a.type, COALESCE(a.meeting_link, ''), COALESCE(a.location, ''),
+			p.full_name, th.name, tn.display_name, COALESCE(i.sequence, 0)
+		FROM appointments a
+		JOIN patients p ON p.id = a.patient_id
+		JOIN therapists th ON th.id = a.therapist_id
+		JOIN tenants tn ON tn.id = a.tenant_id
+		LEFT JOIN appointment_invites i ON i.appointment_id = a.id
+		WHERE `+ownerFilter+`
+			AND a.status NOT IN ('cancelled', 'pending_payment')
+			AND a.starts_at >= $2 AND a.starts_at < $3
+		ORDER BY a.starts_at
+		LIMIT $4
+	`, feed.OwnerID, from, to, calendarFeedMaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ICalEvent
+	for rows.Next() {
+		var s appointmentEventSource
+		if err := rows.Scan(&s.ID, &s.StartsAt, &s.EndsAt, &s.Type, &s.MeetingLink, &s.Location,
+			&s.PatientName, &s.TherapistName, &s.PracticeName, &s.Sequence); err != nil {
+			return nil, err
+		}
+		e := s.event(feed.OwnerRole)
+		// Feeds are read by the owner alone; there is nobody to invite
+		e.Organizer, e.Attendees = nil, nil
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, ICalendar{Name: name, Events: events}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appointmentEventSource is the appointment data an ICS event is built from.
+type appointmentEventSource struct {
+	ID             uuid.UUID
+	StartsAt       time.Time
+	EndsAt         time.Time
+	Type           string
+	MeetingLink    string
+	Location       string
+	PatientName    string
+	PatientEmail   string
+	TherapistName  string
+	TherapistEmail string
+	PracticeName   string
+	Sequence       int
+}
+
+// event renders the appointment as seen by a therapist or a patient. The UID is stable so
+// feeds and invites update the same calendar entry.
+func (s appointmentEventSource) event(viewer string) ICalEvent {
+	organizer := calendarOrganizer
+	e := ICalEvent{
+		UID:       s.ID.String() + "@serenify",
+		Start:     s.StartsAt,
+		End:       s.EndsAt,
+		Location:  s.Location,
+		URL:       s.MeetingLink,
+		Sequence:  s.Sequence,
+		Organizer: &organizer,
+		Attendees: []ICalAttendee{
+			{Name: s.TherapistName, Email: s.TherapistEmail},
+			{Name: s.PatientName, Email: s.PatientEmail},
+		},
+	}
+	if viewer == CalendarFeedTherapist {
+		e.Summary = "Session: " + s.PatientName
+	} else {
+		e.Summary = "Therapy session with " + s.TherapistName
+	}
+	var desc []string
+	if s.PracticeName != "" {
+		desc = append(desc, s.PracticeName)
+	}
+	if s.Type != "" {
+		desc = append(desc, "Type: "+s.Type)
+	}
+	if s.MeetingLink != "" {
+		desc = append(desc, "Join online: "+s.MeetingLink)
+	}
+	e.Description = strings.Join(desc, "\n")
+	return e
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// CalendarActionPull is the calendar job that reads changes from an integration's calendar.
+const CalendarActionPull = "pull"
+
+const (
+	googleCalendarID = "primary"
+	// googleWatchTTL is the channel lifetime requested from Google; channels are renewed
+	// googleWatchRenewBefore they run out.
+	googleWatchTTL         = 7 * 24 * time.Hour
+	googleWatchRenewBefore = 24 * time.Hour
+	googleSyncPollInterval = 5 * time.Minute
+	// googlePullFallbackAfter is how stale an integration with a watch channel may get before it
+	// is pulled anyway, in case push notifications were lost.
+	googlePullFallbackAfter = 30 * time.Minute
+	// googleFullSyncPast is how far back a full sync reads events
+	googleFullSyncPast = 24 * time.Hour
+	// googleBusyRetention is how long busy times stay cached after they end
+	googleBusyRetention = 24 * time.Hour
+
+	calendarPullQueuedKeyPrefix = "cal:pull:queued:"
+	calendarPullLockKeyPrefix   = "cal:pull:lock:"
+)
+
+var (
+	ErrGoogleSyncTokenExpired = errors.New("google calendar sync token expired")
+	ErrUnknownGoogleChannel   = errors.New("unknown google calendar channel")
+)
+
+// googleWebhookURL receives Google push notifications. Google only delivers to HTTPS, so it
+// stays empty in local setups and integrations are polled instead.
+var googleWebhookURL string
+
+// EnqueueCalendarPull queues a pull of the integration's calendar. A pull
+// that is already queued picks up the new changes too, so repeated notifications coalesce.
+func EnqueueCalendarPull(integrationID uuid.UUID) {
+	job := CalendarJob{Action: CalendarActionPull, IntegrationID: integrationID.String()}
+	if database.RedisClient == nil {
+		go processCalendarJob(job)
+		return
+	}
+	ctx := context.Background()
+	queuedKey := calendarPullQueuedKeyPrefix + integrationID.String()
+	if ok, err := database.RedisClient.SetNX(ctx, queuedKey, "1", 2*time.Minute).Result(); err == nil && !ok {
+		return
+	}
+	data, _ := json.Marshal(job)
+	if err := database.RedisClient.LPush(ctx, calendarQueueKey, data).Err(); err != nil {
+		log.Printf("calendar queue push failed: %v", err)
+		database.RedisClient.Del(ctx, queuedKey)
+		go processCalendarJob(job)
+	}
+}
+
+// PullGoogleCalendarChanges applies what changed in the integration's Google calendar since
+// the last pull: unrelated events refresh the cached busy times and edits to Serenify's own
+// events go through the conflict rules of reconcileGoogleEvent. Without a sync token, or when
+// Google expired it, the whole calendar from googleFullSyncPast ago is read again.
+func PullGoogleCalendarChanges(in *calendarIntegration) error {
+	if !GoogleCalendarEnabled() {
+		return nil
+	}
+	var syncToken sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT sync_token FROM calendar_integrations WHERE id = $1
+	`, in.ID).Scan(&syncToken)
+	if err != nil {
+		return err
+	}
+	svc, err := googleCalendarService(in)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	since := time.Now().UTC().Add(-googleFullSyncPast)
+	full := !syncToken.Valid || syncToken.String == ""
+	events, next, err := fetchGoogleChanges(ctx, svc, googleCalendarID, syncToken.String, since)
+	if errors.Is(err, ErrGoogleSyncTokenExpired) {
+		full = true
+		events, next, err = fetchGoogleChanges(ctx, svc, googleCalendarID, "", since)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := applyGoogleChanges(in, events, full); err != nil {
+		return err
+	}
+	_, err = database.PostgresDB.Exec(`
+		UPDATE calendar_integrations SET sync_token = $2, last_pulled_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, in.ID, nullIfEmpty(next))
+	return err
+}
+
+// fetchGoogleChanges lists every page of events changed since syncToken, or every event from
+// since onwards when syncToken is empty, and returns them with the token for the next pull.
+// Recurring events are expanded into instances.
+func fetchGoogleChanges(ctx context.Context, svc *calendar.Service, calendarID, syncToken string, since time.Time) ([]*calendar.Event, string, error) {
+	var events []*calendar.Event
+	pageToken := ""
+	for {
+		call := svc.Events.List(calendarID).SingleEvents(true).MaxResults(250).Context(ctx)
+		if syncToken != "" {
+			call = call.SyncToken(syncToken)
+		} else {
+			call = call.TimeMin(since.Format(time.RFC3339))
+		}
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		res, err := call.Do()
+		if err != nil {
+			var gerr *googleapi.Error
+			if errors.As(err, &gerr) && gerr.Code == http.StatusGone {
+				return nil, "", ErrGoogleSyncTokenExpired
+			}
+			return nil, "", err
+		}
+		events = append(events, res.Items...)
+		if res.NextPageToken == "" {
+			return events, res.NextSyncToken, nil
+		}
+		pageToken = res.NextPageToken
+	}
+}
+
+// applyGoogleChanges stores pulled events. A full sync replaces the integration's cached busy
+// times; an incremental one updates them event by event.
+func applyGoogleChanges(in *calendarIntegration, events []*calendar.Event, full bool) error {
+	if full {
+		if _, err := database.PostgresDB.Exec(`DELETE FROM calendar_busy_times WHERE integration_id = $1`, in.ID); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.Id)
+	}
+	mapped := map[string]uuid.UUID{}
+	rows, err := database.PostgresDB.Query(`
+		SELECT external_event_id, appointment_id FROM calendar_event_mappings
+		WHERE integration_id = $1 AND external_event_id = ANY($2)
+	`, in.ID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var eventID string
+		var aptID uuid.UUID
+		if rows.Scan(&eventID, &aptID) == nil {
+			mapped[eventID] = aptID
+		}
+	}
+	rows.Close()
+
+	loc := TenantLocation(in.TenantID)
+	for _, e := range events {
+		if aptID, ok := mapped[e.Id]; ok {
+			if err := reconcileGoogleEvent(in, aptID, e, loc); err != nil {
+				log.Printf("[Google Calendar Sync] Reconcile event %s of appointment %s: %v", e.Id, aptID, err)
+			}
+			continue
+		}
+		r, busy := googleEventBusy(e, loc)
+		if !busy {
+			_, err = database.PostgresDB.Exec(`
+				DELETE FROM calendar_busy_times WHERE integration_id = $1 AND external_event_id = $2
+			`, in.ID, e.Id)
+		} else {
+			_, err = database.PostgresDB.Exec(`
+				INSERT INTO calendar_busy_times (integration_id, external_event_id, therapist_id, starts_at, ends_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (integration_id, external_event_id) DO UPDATE SET
+					starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at, updated_at = NOW()
+			`, in.ID, e.Id, in.TherapistID, r.Start, r.End)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = database.PostgresDB.Exec(`
+		DELETE FROM calendar_busy_times WHERE integration_id = $1 AND ends_at < NOW() - make_interval(secs => $2)
+	`, in.ID, googleBusyRetention.Seconds())
+	return err
+}
+
+// googleEventRange reads an event's times. All-day dates are read in loc and end exclusively.
+func googleEventRange(e *calendar.Event, loc *time.Location) (TimeRange, bool) {
+	if e.Start == nil || e.End == nil {
+		return TimeRange{}, false
+	}
+	parse := func(d *calendar.EventDateTime) (time.Time, error) {
+		if d.DateTime != "" {
+			return time.Parse(time.RFC3339, d.DateTime)
+		}
+		return time.ParseInLocation("2006-01-02", d.Date, loc)
+	}
+	start, err1 := parse(e.Start)
+	end, err2 := parse(e.End)
+	if err1 != nil || err2 != nil || !end.After(start) {
+		return TimeRange{}, false
+	}
+	return TimeRange{Start: start.UTC(), End: end.UTC()}, true
+}
+
+// googleEventBusy reports whether an event blocks the practitioner's time: cancelled events,
+// events marked "free" and invitations they declined do not.
+func googleEventBusy(e *calendar.Event, loc *time.Location) (TimeRange, bool) {
+	if e.Status == "cancelled" || e.Transparency == "transparent" {
+		return TimeRange{}, false
+	}
+	for _, a := range e.Attendees {
+		if a.Self && a.ResponseStatus == "declined" {
+			return TimeRange{}, false
+		}
+	}
+	return googleEventRange(e, loc)
+}
+
+// googleSyncAction is what a change to a Serenify event in Google does to its appointment.
+type googleSyncAction int
+
+const (
+	googleSyncNone googleSyncAction = iota
+	// googleSyncApplyRemote moves the appointment to the event's new time
+	googleSyncApplyRemote
+	// googleSyncRestoreLocal pushes the appointment back over the event
+	googleSyncRestoreLocal
+	// googleSyncFlagDeleted keeps the booking and flags the mapping for the practitioner
+	googleSyncFlagDeleted
+	// googleSyncForget drops the mapping of an event nobody needs any more
+	googleSyncForget
+)
+
+// mappedAppointment is the local side of an event mapping.
+type mappedAppointment struct {
+	Status string
+	Range  TimeRange
+	// LocallyChanged is set when the appointment changed after its last push to Google
+	LocallyChanged bool
+}
+
+// googleEventChange is the Google side of an event mapping after a pull.
+type googleEventChange struct {
+	Cancelled bool
+	Range     TimeRange
+	HasRange  bool
+}
+
+// resolveMappedEventChange applies the conflict rules for an edited Serenify event:
+//   - Deleting the event never cancels a session the patient still expects; an upcoming
+//     booking is flagged for the practitioner to cancel in Serenify instead.
+//   - A move is accepted when the appointment has no unpushed local change and both the old
+//     and new times are in the future and the new time is free; otherwise Serenify's time is
+//     pushed back. A local change always wins over a Google one.
+//   - Events of cancelled appointments are deleted again; past sessions are left alone.
+func resolveMappedEventChange(apt mappedAppointment, remote googleEventChange, now time.Time, slotFree bool) googleSyncAction {
+	active := apt.Status == "scheduled" || apt.Status == "confirmed"
+	if remote.Cancelled {
+		if active && apt.Range.End.After(now) {
+			return googleSyncFlagDeleted
+		}
+		return googleSyncForget
+	}
+	if apt.Status == "cancelled" {
+		return googleSyncRestoreLocal
+	}
+	if !active || !remote.HasRange {
+		return googleSyncNone
+	}
+	if remote.Range.Start.Equal(apt.Range.Start) && remote.Range.End.Equal(apt.Range.End) {
+		return googleSyncNone
+	}
+	if apt.LocallyChanged || !apt.Range.Start.After(now) || !remote.Range.Start.After(now) || !slotFree {
+		return googleSyncRestoreLocal
+	}
+	return googleSyncApplyRemote
+}
+
+// reconcileGoogleEvent applies resolveMappedEventChange to an appointment whose Google event
+// changed.
+func reconcileGoogleEvent(in *calendarIntegration, aptID uuid.UUID, e *calendar.Event, loc *time.Location) error {
+	var apt mappedAppointment
+	var patientID uuid.UUID
+	var patientName, syncStatus string
+	err := database.PostgresDB.QueryRow(`
+		SELECT a.status, a.starts_at, a.ends_at, a.patient_id, p.full_name, m.sync_status,
+			a.updated_at > COALESCE(m.last_synced_at, 'epoch'::timestamp)
+		FROM calendar_event_mappings m
+		JOIN appointments a ON a.id = m.appointment_id
+		JOIN patients p ON p.id = a.patient_id
+		WHERE m.appointment_id = $1 AND m.integration_id = $2
+	`, aptID, in.ID).Scan(&apt.Status, &apt.Range.Start, &apt.Range.End, &patientID, &patientName,
+		&syncStatus, &apt.LocallyChanged)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	remote := googleEventChange{Cancelled: e.Status == "cancelled"}
+	if !remote.Cancelled {
+		remote.Range, remote.HasRange = googleEventRange(e, loc)
+	}
+	slotFree := true
+	if remote.HasRange && !remote.Cancelled {
+		conflict, err := TherapistHasConflict(in.TherapistID, remote.Range.Start, remote.Range.End, &aptID)
+		if err != nil {
+			return err
+		}
+		slotFree = !conflict
+	}
+	now := time.Now().UTC()
+	action := resolveMappedEventChange(apt, remote, now, slotFree)
+	when := func(t time.Time) string { return t.In(loc).Format("Mon, 2 Jan 2006 at 15:04 MST") }
+
+	switch action {
+	case googleSyncForget:
+		_, err = database.PostgresDB.Exec(`
+			DELETE FROM calendar_event_mappings WHERE appointment_id = $1 AND integration_id = $2
+		`, aptID, in.ID)
+		return err
+
+	case googleSyncFlagDeleted:
+		if syncStatus == "conflict" {
+			return nil
+		}
+		_, err = database.PostgresDB.Exec(`
+			UPDATE calendar_event_mappings SET sync_status = 'conflict', conflict_reason = 'deleted_in_google',
+				last_synced_at = NOW()
+			WHERE appointment_id = $1 AND integration_id = $2
+		`, aptID, in.ID)
+		if err != nil {
+			return err
+		}
+		NotifyUser(in.TherapistID, "therapist", "Session removed from Google Calendar",
+			"Your session with "+patientName+" on "+when(apt.Range.Start)+" was deleted in Google Calendar but is still booked. Cancel it in Serenify if it should not take place.",
+			"calendar")
+		return nil
+
+	case googleSyncRestoreLocal:
+		EnqueueCalendarSync("update", in.TenantID, aptID)
+		if apt.Status != "cancelled" && !apt.LocallyChanged {
+			NotifyUser(in.TherapistID, "therapist", "Calendar change not applied",
+				"Your session with "+patientName+" could not be moved in Google Calendar because the new time is taken or in the past. It stays on "+when(apt.Range.Start)+".",
+				"calendar")
+		}
+		return nil
+
+	case googleSyncApplyRemote:
+		res, err := database.PostgresDB.Exec(`
+			UPDATE appointments SET starts_at = $2, ends_at = $3,
+				is_exception = is_exception OR series_id IS NOT NULL, updated_at = NOW()
+			WHERE id = $1 AND starts_at = $4 AND ends_at = $5 AND status IN ('scheduled', 'confirmed')
+		`, aptID, remote.Range.Start, remote.Range.End, apt.Range.Start, apt.Range.End)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		// The appointment now matches the event, so it has nothing to push
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE calendar_event_mappings SET sync_status = 'synced', conflict_reason = NULL, last_synced_at = NOW()
+			WHERE appointment_id = $1 AND integration_id = $2
+		`, aptID, in.ID)
+		ScheduleAppointmentReminders(in.TenantID, aptID)
+		// Sends the patient an updated invite with a bumped SEQUENCE; the event already matches
+		EnqueueCalendarSync("update", in.TenantID, aptID)
+		NotifyPatientByID(patientID, "Session rescheduled",
+			"Your session has moved to "+when(remote.Range.Start)+".", "appointment")
+		log.Printf("[Google Calendar Sync] Moved appointment %s to %s from Google", aptID, remote.Range.Start.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// watchGoogleCalendar opens a push notification channel on the calendar's events and returns
+// the watched resource ID and when the channel expires.
+func watchGoogleCalendar(ctx context.Context, svc *calendar.Service, calendarID, channelID, token, address string, ttl time.Duration) (string, time.Time, error) {
+	ch, err := svc.Events.Watch(calendarID, &calendar.Channel{
+		Id:      channelID,
+		Type:    "web_hook",
+		Address: address,
+		Token:   token,
+		Params:  map[string]string{"ttl": strconv.Itoa(int(ttl.Seconds()))},
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return ch.ResourceId, time.UnixMilli(ch.Expiration).UTC(), nil
+}
+
+// EnsureGoogleCalendarWatch opens a push channel for the integration, replacing one that is
+// missing or about to expire. It does nothing when no public webhook URL is configured.
+func EnsureGoogleCalendarWatch(integrationID uuid.UUID) error {
+	if googleWebhookURL == "" || !GoogleCalendarEnabled() {
+		return nil
+	}
+	var oldChannel, oldResource sql.NullString
+	var expiresAt sql.NullTime
+	err := database.PostgresDB.QueryRow(`
+		SELECT channel_id, channel_resource_id, channel_expires_at FROM calendar_integrations
+		WHERE id = $1 AND sync_enabled = TRUE AND provider = 'google'
+	`, integrationID).Scan(&oldChannel, &oldResource, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if oldChannel.Valid && expiresAt.Valid && time.Until(expiresAt.Time) > googleWatchRenewBefore {
+		return nil
+	}
+	svc, err := calendarServiceByID(integrationID)
+	if err != nil || svc == nil {
+		return err
+	}
+	token, err := newCalendarSecret()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	channelID := uuid.NewString()
+	resourceID, expires, err := watchGoogleCalendar(ctx, svc, googleCalendarID, channelID, token, googleWebhookURL, googleWatchTTL)
+	if err != nil {
+		return err
+	}
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE calendar_integrations SET channel_id = $2, channel_resource_id = $3, channel_token_hash = $4,
+			channel_expires_at = $5, updated_at = NOW()
+		WHERE id = $1
+	`, integrationID, channelID, resourceID, hashToken(token), expires); err != nil {
+		return err
+	}
+	if oldChannel.Valid {
+		stopGoogleChannel(ctx, svc, oldChannel.String, oldResource.String)
+	}
+	return nil
+}
+
+func stopGoogleChannel(ctx context.Context, svc *calendar.Service, channelID, resourceID string) {
+	if err := svc.Channels.Stop(&calendar.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do(); err != nil {
+		log.Printf("[Google Calendar Sync] Stop channel %s: %v", channelID, err)
+	}
+}
+
+// HandleGoogleCalendarNotification checks a push notification against the channel's secret
+// and queues a pull. The initial "sync" message only confirms the channel.
+func HandleGoogleCalendarNotification(channelID, token, resourceState string) error {
+	var integrationID uuid.UUID
+	var tokenHash sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT id, channel_token_hash FROM calendar_integrations
+		WHERE channel_id = $1 AND sync_enabled = TRUE
+	`, channelID).Scan(&integrationID, &tokenHash)
+	if err == sql.ErrNoRows {
+		return ErrUnknownGoogleChannel
+	}
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(tokenHash.String)) != 1 {
+		return ErrUnknownGoogleChannel
+	}
+	if resourceState != "sync" {
+		EnqueueCalendarPull(integrationID)
+	}
+	return nil
+}
+
+// StartCalendarSync keeps connected calendars current. Google watch channels are renewed
+// before they expire, and integrations that have not been pulled recently are pulled: Google
+// every few minutes without push notifications and as a safety net with them, other providers
+// every few minutes since they have no push notifications here. It must start after PostgreSQL
+// is connected and migrated.
+func StartCalendarSync() {
+	go func() {
+		ticker := time.NewTicker(googleSyncPollInterval)
+		defer ticker.Stop()
+		for {
+			if googleWebhookURL != "" && GoogleCalendarEnabled() {
+				ids, err := calendarIntegrationIDs(`
+					SELECT id FROM calendar_integrations
+					WHERE sync_enabled = TRUE AND provider = 'google'
+						AND (channel_id IS NULL OR channel_expires_at < NOW() + make_interval(secs => $1))
+				`, googleWatchRenewBefore.Seconds())
+				if err != nil {
+					log.Printf("[Calendar Sync] Renewal scan: %v", err)
+				}
+				for _, id := range ids {
+					if err := EnsureGoogleCalendarWatch(id); err != nil {
+						log.Printf("[Calendar Sync] Watch %s: %v", id, err)
+					}
+				}
+			}
+
+			googleStale := googlePullFallbackAfter
+			if googleWebhookURL == "" {
+				googleStale = googleSyncPollInterval
+			}
+			ids, err := calendarIntegrationIDs(`
+				SELECT id FROM calendar_integrations
+				WHERE sync_enabled = TRUE
+					AND (last_pulled_at IS NULL OR last_pulled_at < NOW() - make_interval(secs =>
+						CASE WHEN provider = 'google' THEN $1 ELSE $2 END))
+			`, googleStale.Seconds(), googleSyncPollInterval.Seconds())
+			if err != nil {
+				log.Printf("[Calendar Sync] Pull scan: %v", err)
+			}
+			for _, id := range ids {
+				EnqueueCalendarPull(id)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Println("✅ Calendar sync started")
+}
+
+func calendarIntegrationIDs(query string, args ...interface{}) ([]uuid.UUID, error) {
+	if database.PostgresDB == nil {
+		return nil, errors.New("postgres connection is not active")
+	}
+	rows, err := database.PostgresDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectIDs(rows)
+}
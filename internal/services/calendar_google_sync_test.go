@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// fakeGoogleCalendar serves the parts of the Calendar API the sync uses.
+func fakeGoogleCalendar(t *testing.T, handler http.HandlerFunc) *calendar.Service {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	svc, err := calendar.NewService(context.Background(),
+		option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func writeFakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestFetchGoogleChangesPagesAndSyncToken(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	svc := fakeGoogleCalendar(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/calendars/primary/events" || q.Get("singleEvents") != "true" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		switch {
+		case q.Get("syncToken") == "stale":
+			w.WriteHeader(http.StatusGone)
+			writeFakeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 410, "message": "Sync token is no longer valid"}})
+		case q.Get("syncToken") == "token-1":
+			if q.Get("timeMin") != "" {
+				t.Errorf("timeMin sent with a sync token")
+			}
+			writeFakeJSON(w, calendar.Events{Items: []*calendar.Event{{Id: "c", Status: "cancelled"}}, NextSyncToken: "token-2"})
+		case q.Get("pageToken") == "":
+			if q.Get("timeMin") != since.Format(time.RFC3339) {
+				t.Errorf("full sync timeMin = %q", q.Get("timeMin"))
+			}
+			writeFakeJSON(w, calendar.Events{Items: []*calendar.Event{{Id: "a"}}, NextPageToken: "page-2"})
+		default:
+			writeFakeJSON(w, calendar.Events{Items: []*calendar.Event{{Id: "b"}}, NextSyncToken: "token-1"})
+		}
+	})
+	ctx := context.Background()
+
+	events, next, err := fetchGoogleChanges(ctx, svc, "primary", "", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Id != "a" || events[1].Id != "b" || next != "token-1" {
+		t.Fatalf("full sync got %d events, next %q", len(events), next)
+	}
+
+	events, next, err = fetchGoogleChanges(ctx, svc, "primary", "token-1", since)
+	if err != nil || len(events) != 1 || events[0].Status != "cancelled" || next != "token-2" {
+		t.Fatalf("incremental sync got %v %q %v", events, next, err)
+	}
+
+	if _, _, err := fetchGoogleChanges(ctx, svc, "primary", "stale", since); !errors.Is(err, ErrGoogleSyncTokenExpired) {
+		t.Fatalf("expected ErrGoogleSyncTokenExpired, got %v", err)
+	}
+}
+
+func TestWatchGoogleCalendar(t *testing.T) {
+	expires := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	svc := fakeGoogleCalendar(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/calendars/primary/events/watch" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		var ch calendar.Channel
+		_ = json.NewDecoder(r.Body).Decode(&ch)
+		if ch.Id != "chan-1" || ch.Type != "web_hook" || ch.Token != "secret" ||
+			ch.Address != "https://api.example.com/hook" || ch.Params["ttl"] != "604800" {
+			t.Errorf("unexpected channel %+v", ch)
+		}
+		writeFakeJSON(w, calendar.Channel{Id: ch.Id, ResourceId: "res-1", Expiration: expires.UnixMilli()})
+	})
+	resourceID, exp, err := watchGoogleCalendar(context.Background(), svc, "primary", "chan-1", "secret",
+		"https://api.example.com/hook", googleWatchTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resourceID != "res-1" || !exp.Equal(expires) {
+		t.Fatalf("got %q %v", resourceID, exp)
+	}
+}
+
+func TestGoogleEventBusy(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	timed := &calendar.Event{
+		Start: &calendar.EventDateTime{DateTime: "2026-03-02T10:00:00+05:30"},
+		End:   &calendar.EventDateTime{DateTime: "2026-03-02T11:00:00+05:30"},
+	}
+	r, ok := googleEventBusy(timed, loc)
+	if !ok || !r.Start.Equal(time.Date(2026, 3, 2, 4, 30, 0, 0, time.UTC)) || r.Start.Location() != time.UTC {
+		t.Fatalf("timed event: %v %v", r, ok)
+	}
+
+	allDay := &calendar.Event{
+		Start: &calendar.EventDateTime{Date: "2026-03-02"},
+		End:   &calendar.EventDateTime{Date: "2026-03-03"},
+	}
+	r, ok = googleEventBusy(allDay, loc)
+	if !ok || r.End.Sub(r.Start) != 24*time.Hour || !r.Start.Equal(time.Date(2026, 3, 1, 18, 30, 0, 0, time.UTC)) {
+		t.Fatalf("all-day event: %v %v", r, ok)
+	}
+
+	for name, e := range map[string]*calendar.Event{
+		"free":      {Transparency: "transparent", Start: timed.Start, End: timed.End},
+		"cancelled": {Status: "cancelled"},
+		"declined": {Start: timed.Start, End: timed.End,
+			Attendees: []*calendar.EventAttendee{{Self: true, ResponseStatus: "declined"}}},
+	} {
+		if _, ok := googleEventBusy(e, loc); ok {
+			t.Errorf("%s event counted as busy", name)
+		}
+	}
+}
+
+func TestResolveMappedEventChange(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(days, hour int) TimeRange {
+		start := now.AddDate(0, 0, days).Truncate(24 * time.Hour).Add(time.Duration(hour) * time.Hour)
+		return TimeRange{Start: start, End: start.Add(50 * time.Minute)}
+	}
+	upcoming := mappedAppointment{Status: "scheduled", Range: at(2, 10)}
+	moved := googleEventChange{Range: at(2, 14), HasRange: true}
+
+	cases := []struct {
+		name     string
+		apt      mappedAppointment
+		remote   googleEventChange
+		slotFree bool
+		want     googleSyncAction
+	}{
+		{"unchanged", upcoming, googleEventChange{Range: at(2, 10), HasRange: true}, true, googleSyncNone},
+		{"moved to a free slot", upcoming, moved, true, googleSyncApplyRemote},
+		{"moved onto a booking", upcoming, moved, false, googleSyncRestoreLocal},
+		{"moved into the past", upcoming, googleEventChange{Range: at(-1, 10), HasRange: true}, true, googleSyncRestoreLocal},
+		{"moved after a local edit", mappedAppointment{Status: "confirmed", Range: at(2, 10), LocallyChanged: true}, moved, true, googleSyncRestoreLocal},
+		{"deleted while booked", upcoming, googleEventChange{Cancelled: true}, true, googleSyncFlagDeleted},
+		{"deleted after the session", mappedAppointment{Status: "scheduled", Range: at(-1, 10)}, googleEventChange{Cancelled: true}, true, googleSyncForget},
+		{"deleted after cancelling", mappedAppointment{Status: "cancelled", Range: at(2, 10)}, googleEventChange{Cancelled: true}, true, googleSyncForget},
+		{"cancelled locally but still in Google", mappedAppointment{Status: "cancelled", Range: at(2, 10)}, moved, true, googleSyncRestoreLocal},
+		{"completed session moved", mappedAppointment{Status: "completed", Range: at(-1, 10)}, moved, true, googleSyncNone},
+	}
+	for _, c := range cases {
+		if got := resolveMappedEventChange(c.apt, c.remote, now, c.slotFree); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCalendarIntegrationIDsWithoutPostgres(t *testing.T) {
+	db := database.PostgresDB
+	database.PostgresDB = nil
+	defer func() { database.PostgresDB = db }()
+	if _, err := calendarIntegrationIDs(`SELECT id FROM calendar_integrations`); err == nil {
+		t.Fatal("expected an error before PostgreSQL is connected")
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// SendAppointmentInvites emails .ics invites to the patient and practitioner of the job's
+// appointment: a REQUEST when it is booked or moved, and a CANCEL once an invited appointment
+// is cancelled. Practitioners syncing to Google or Microsoft 365 get invites from there instead.
+func SendAppointmentInvites(job CalendarJob) error {
+	appointmentID, err := uuid.Parse(job.AppointmentID)
+	if err != nil {
+		return err
+	}
+	tenantID, err := uuid.Parse(job.TenantID)
+	if err != nil {
+		return err
+	}
+
+	var s appointmentEventSource
+	var therapistID, patientID uuid.UUID
+	var patientUserID uuid.NullUUID
+	var status string
+	err = database.PostgresDB.QueryRow(`
+		SELECT a.therapist_id, a.patient_id, p.user_id, a.status, a.starts_at, a.ends_at, a.type,
+			COALESCE(a.meeting_link, ''), COALESCE(a.location, ''),
+			p.full_name, COALESCE(p.email, ''), th.name, th.email, tn.display_name
+		FROM appointments a
+		JOIN patients p ON p.id = a.patient_id
+		JOIN therapists th ON th.id = a.therapist_id
+		JOIN tenants tn ON tn.id = a.tenant_id
+		WHERE a.id = $1 AND a.tenant_id = $2
+	`, appointmentID, tenantID).Scan(&therapistID, &patientID, &patientUserID, &status, &s.StartsAt, &s.EndsAt,
+		&s.Type, &s.MeetingLink, &s.Location, &s.PatientName, &s.PatientEmail, &s.TherapistName,
+		&s.TherapistEmail, &s.PracticeName)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.ID = appointmentID
+	if CalendarProviderSendsInvites(tenantID, therapistID) {
+		return nil
+	}
+
+	var lastSeq int
+	var lastStart, lastEnd time.Time
+	var lastCancelled bool
+	err = database.PostgresDB.QueryRow(`
+		SELECT sequence, starts_at, ends_at, cancelled_at IS NOT NULL FROM appointment_invites
+		WHERE appointment_id = $1
+	`, appointmentID).Scan(&lastSeq, &lastStart, &lastEnd, &lastCancelled)
+	invited := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	method := ICalMethodRequest
+	switch {
+	case status == "cancelled":
+		if !invited || lastCancelled {
+			return nil
+		}
+		method = ICalMethodCancel
+		s.Sequence = lastSeq + 1
+	case status != "scheduled" && status != "confirmed", !s.EndsAt.After(time.Now().UTC()):
+		// Unpaid bookings get their invite once payment confirms them; past sessions get none
+		return nil
+	case !invited:
+		s.Sequence = 0
+	case !lastCancelled && lastStart.Equal(s.StartsAt) && lastEnd.Equal(s.EndsAt):
+		return nil
+	default:
+		s.Sequence = lastSeq + 1
+	}
+
+	// Record the invite before sending it so a concurrent job for the same change backs off
+	var res sql.Result
+	if invited {
+		res, err = database.PostgresDB.Exec(`
+			UPDATE appointment_invites SET sequence = $3, starts_at = $4, ends_at = $5,
+				cancelled_at = CASE WHEN $6 THEN NOW() END, updated_at = NOW()
+			WHERE appointment_id = $1 AND sequence = $2
+		`, appointmentID, lastSeq, s.Sequence, s.StartsAt, s.EndsAt, method == ICalMethodCancel)
+	} else {
+		res, err = database.PostgresDB.Exec(`
+			INSERT INTO appointment_invites (appointment_id, sequence, starts_at, ends_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (appointment_id) DO NOTHING
+		`, appointmentID, s.Sequence, s.StartsAt, s.EndsAt)
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	when := s.StartsAt.In(TenantLocation(tenantID)).Format("Mon, 2 Jan 2006 at 15:04 MST")
+	send := func(recipientID uuid.UUID, role, viewer, other string) {
+		e := s.event(viewer)
+		title, message := "Session booked", "Your session with "+other+" is on "+when+". Add the attached invite to your calendar."
+		switch {
+		case method == ICalMethodCancel:
+			e.Status = "CANCELLED"
+			title, message = "Session cancelled", "Your session with "+other+" on "+when+" was cancelled."
+		case s.Sequence > 0:
+			title, message = "Session rescheduled", "Your session with "+other+" has moved to "+when+". The attached invite updates your calendar."
+		}
+		var buf bytes.Buffer
+		if err := WriteICalendar(&buf, ICalendar{Method: method, Events: []ICalEvent{e}}); err != nil {
+			log.Printf("calendar invite %s: %v", appointmentID, err)
+			return
+		}
+		err := Dispatch(Notification{
+			RecipientID:   recipientID,
+			RecipientRole: role,
+			Type:          "appointment_invite",
+			Title:         title,
+			Message:       message,
+			Data: map[string]string{
+				"appointment_id": appointmentID.String(),
+				"meeting_link":   s.MeetingLink,
+				"location":       s.Location,
+			},
+			Attachments: []NotificationAttachment{{
+				Filename:    "invite.ics",
+				ContentType: "text/calendar; charset=UTF-8; method=" + method,
+				Content:     buf.Bytes(),
+			}},
+			Channels: []string{ChannelEmail},
+		})
+		if err != nil {
+			log.Printf("notifications: dispatch appointment_invite to %s %s: %v", role, recipientID, err)
+		}
+	}
+
+	if patientUserID.Valid {
+		send(patientUserID.UUID, "user", CalendarFeedPatient, s.TherapistName)
+	} else {
+		send(patientID, "patient", CalendarFeedPatient, s.TherapistName)
+	}
+	send(therapistID, "therapist", CalendarFeedTherapist, s.PatientName)
+	return nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+)
+
+const (
+	microsoftGraphURL = "https://graph.microsoft.com/v1.0"
+	// microsoftGraphTime is how Graph writes dateTimeTimeZone values, without an offset
+	microsoftGraphTime = "2006-01-02T15:04:05.999999999"
+)
+
+var microsoftOAuthConfig *oauth2.Config
+
+func InitMicrosoftCalendar(cfg *config.Config) {
+	if cfg.MicrosoftClientID == "" || cfg.MicrosoftClientSecret == "" {
+		return
+	}
+	microsoftOAuthConfig = &oauth2.Config{
+		ClientID:     cfg.MicrosoftClientID,
+		ClientSecret: cfg.MicrosoftClientSecret,
+		RedirectURL:  cfg.MicrosoftRedirectURI,
+		Scopes:       []string{"offline_access", "Calendars.ReadWrite"},
+		Endpoint:     microsoft.AzureADEndpoint(cfg.MicrosoftTenant),
+	}
+}
+
+func MicrosoftCalendarEnabled() bool {
+	return microsoftOAuthConfig != nil
+}
+
+func MicrosoftAuthURL(tenantID, therapistID uuid.UUID) (string, error) {
+	if !MicrosoftCalendarEnabled() {
+		return "", fmt.Errorf("microsoft calendar not configured")
+	}
+	state := fmt.Sprintf("%s:%s", tenantID.String(), therapistID.String())
+	return microsoftOAuthConfig.AuthCodeURL(state, oauth2.SetAuthURLParam("prompt", "select_account")), nil
+}
+
+// HandleMicrosoftCallback finishes the OAuth flow and connects the account's default
+// calendar, replacing any other calendar connection of the practitioner.
+func HandleMicrosoftCallback(code, state string) error {
+	if !MicrosoftCalendarEnabled() {
+		return fmt.Errorf("microsoft calendar not configured")
+	}
+	tenantID, therapistID, err := parseCalendarOAuthState(state)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), calendarSyncTimeout)
+	defer cancel()
+	tok, err := microsoftOAuthConfig.Exchange(ctx, code)
+	if err != nil {
+		log.Printf("[Microsoft Calendar OAuth] Exchange failed: %v", err)
+		return err
+	}
+	provider := &MicrosoftCalendarProvider{Client: microsoftOAuthConfig.Client(ctx, tok)}
+	calendarID, err := provider.Connect(ctx)
+	if err != nil {
+		log.Printf("[Microsoft Calendar OAuth] Reading default calendar failed: %v", err)
+		return err
+	}
+
+	accessEnc, _ := utils.Encrypt(tok.AccessToken)
+	refreshEnc, _ := utils.Encrypt(tok.RefreshToken)
+	integrationID, err := saveCalendarIntegration(calendarIntegration{
+		TenantID:    tenantID,
+		TherapistID: therapistID,
+		Provider:    CalendarProviderMicrosoft,
+		CalendarID:  calendarID,
+		accessEnc:   accessEnc,
+		refreshEnc:  refreshEnc,
+	}, tok.Expiry)
+	if err != nil {
+		log.Printf("[Microsoft Calendar OAuth] Failed to save integration: %v", err)
+		return err
+	}
+	log.Printf("[Microsoft Calendar OAuth] Successfully saved integration for therapist %s", therapistID)
+	go startCalendarIntegration(tenantID, therapistID, integrationID)
+	return nil
+}
+
+// MicrosoftCalendarProvider writes appointments to an Outlook / Microsoft 365 calendar through
+// Microsoft Graph. Exchange emails the patient an invitation for each event.
+type MicrosoftCalendarProvider struct {
+	// Client sends the account's OAuth token
+	Client     *http.Client
+	CalendarID string
+	// BaseURL defaults to Graph v1.0
+	BaseURL string
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphEvent struct {
+	ID            string          `json:"id,omitempty"`
+	TransactionID string          `json:"transactionId,omitempty"`
+	Subject       string          `json:"subject,omitempty"`
+	Body          *graphItemBody  `json:"body,omitempty"`
+	Start         *graphDateTime  `json:"start,omitempty"`
+	End           *graphDateTime  `json:"end,omitempty"`
+	Location      *graphLocation  `json:"location,omitempty"`
+	Attendees     []graphAttendee `json:"attendees,omitempty"`
+	ShowAs        string          `json:"showAs,omitempty"`
+	IsCancelled   bool            `json:"isCancelled,omitempty"`
+}
+
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphLocation struct {
+	DisplayName string `json:"displayName"`
+}
+
+type graphAttendee struct {
+	EmailAddress struct {
+		Address string `json:"address"`
+	} `json:"emailAddress"`
+	Type string `json:"type"`
+}
+
+func (p *MicrosoftCalendarProvider) Connect(ctx context.Context) (string, error) {
+	var cal struct {
+		ID string `json:"id"`
+	}
+	if _, err := p.send(ctx, http.MethodGet, "/me/calendar", nil, nil, &cal); err != nil {
+		return "", err
+	}
+	return cal.ID, nil
+}
+
+// UpsertEvent creates or patches the event. An event deleted in Outlook is created again.
+func (p *MicrosoftCalendarProvider) UpsertEvent(ctx context.Context, eventID string, e CalendarEvent) (string, error) {
+	event := graphEvent{
+		Subject: e.Summary,
+		Body:    &graphItemBody{ContentType: "text", Content: e.Description},
+		Start:   &graphDateTime{DateTime: e.Start.UTC().Format(microsoftGraphTime), TimeZone: "UTC"},
+		End:     &graphDateTime{DateTime: e.End.UTC().Format(microsoftGraphTime), TimeZone: "UTC"},
+	}
+	if e.Location != "" {
+		event.Location = &graphLocation{DisplayName: e.Location}
+	}
+	if e.AttendeeEmail != "" {
+		a := graphAttendee{Type: "required"}
+		a.EmailAddress.Address = e.AttendeeEmail
+		event.Attendees = []graphAttendee{a}
+	}
+
+	var saved graphEvent
+	if eventID != "" {
+		status, err := p.send(ctx, http.MethodPatch, "/me/events/"+url.PathEscape(eventID), nil, event, &saved)
+		if status != http.StatusNotFound {
+			if err != nil {
+				return "", err
+			}
+			return saved.ID, nil
+		}
+	}
+	// The transaction ID makes a retried create return the first event instead of a duplicate
+	event.TransactionID = e.UID
+	if _, err := p.send(ctx, http.MethodPost, p.calendarPath()+"/events", nil, event, &saved); err != nil {
+		return "", err
+	}
+	return saved.ID, nil
+}
+
+func (p *MicrosoftCalendarProvider) DeleteEvent(ctx context.Context, eventID string) error {
+	status, err := p.send(ctx, http.MethodDelete, "/me/events/"+url.PathEscape(eventID), nil, nil, nil)
+	if status == http.StatusNotFound || status == http.StatusGone {
+		return nil
+	}
+	return err
+}
+
+// ListBusy reads the calendar view, which expands recurring events, in UTC. Cancelled events
+// and events shown as free are left out.
+func (p *MicrosoftCalendarProvider) ListBusy(ctx context.Context, from, to time.Time) ([]CalendarBusyEvent, error) {
+	q := url.Values{
+		"startDateTime": {from.UTC().Format(time.RFC3339)},
+		"endDateTime":   {to.UTC().Format(time.RFC3339)},
+		"$select":       {"id,start,end,showAs,isCancelled"},
+		"$top":          {"100"},
+	}
+	next := p.calendarPath() + "/calendarView?" + q.Encode()
+	header := http.Header{"Prefer": {`outlook.timezone="UTC"`}}
+
+	var busy []CalendarBusyEvent
+	for next != "" {
+		var page struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if _, err := p.send(ctx, http.MethodGet, next, header, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, e := range page.Value {
+			if e.IsCancelled || strings.EqualFold(e.ShowAs, "free") || e.Start == nil || e.End == nil {
+				continue
+			}
+			start, err1 := time.ParseInLocation(microsoftGraphTime, e.Start.DateTime, time.UTC)
+			end, err2 := time.ParseInLocation(microsoftGraphTime, e.End.DateTime, time.UTC)
+			if err1 != nil || err2 != nil || !end.After(start) {
+				continue
+			}
+			busy = append(busy, CalendarBusyEvent{EventID: e.ID, TimeRange: TimeRange{Start: start, End: end}})
+		}
+		next = page.NextLink
+	}
+	return busy, nil
+}
+
+func (p *MicrosoftCalendarProvider) calendarPath() string {
+	if p.CalendarID == "" {
+		return "/me/calendar"
+	}
+	return "/me/calendars/" + url.PathEscape(p.CalendarID)
+}
+
+// send makes a Graph request. path is relative to BaseURL unless it is a full URL, as next
+// links are. The response status is returned along with any error.
+func (p *MicrosoftCalendarProvider) send(ctx context.Context, method, path string, header http.Header, in, out interface{}) (int, error) {
+	target := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		base := p.BaseURL
+		if base == "" {
+			base = microsoftGraphURL
+		}
+		target = strings.TrimRight(base, "/") + path
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("microsoft graph %s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
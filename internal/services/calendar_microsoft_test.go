@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMicrosoftCalendarProvider(t *testing.T) {
+	var created graphEvent
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPatch && r.URL.Path == "/me/events/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/me/calendars/cal-1/events":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			writeFakeJSON(w, graphEvent{ID: "evt-2"})
+		case r.Method == http.MethodGet && r.URL.Path == "/me/calendars/cal-1/calendarView":
+			if r.Header.Get("Prefer") != `outlook.timezone="UTC"` {
+				t.Errorf("missing UTC preference")
+			}
+			if r.URL.Query().Get("page") == "" {
+				writeFakeJSON(w, map[string]interface{}{
+					"value": []graphEvent{
+						{ID: "busy", ShowAs: "busy", Start: &graphDateTime{DateTime: "2026-03-02T09:00:00.0000000"}, End: &graphDateTime{DateTime: "2026-03-02T10:00:00.0000000"}},
+						{ID: "free", ShowAs: "free", Start: &graphDateTime{DateTime: "2026-03-02T11:00:00.0000000"}, End: &graphDateTime{DateTime: "2026-03-02T12:00:00.0000000"}},
+					},
+					"@odata.nextLink": srv.URL + "/me/calendars/cal-1/calendarView?page=2",
+				})
+				return
+			}
+			writeFakeJSON(w, map[string]interface{}{"value": []graphEvent{
+				{ID: "off", ShowAs: "busy", IsCancelled: true, Start: &graphDateTime{DateTime: "2026-03-02T13:00:00.0000000"}, End: &graphDateTime{DateTime: "2026-03-02T14:00:00.0000000"}},
+				{ID: "ooo", ShowAs: "oof", Start: &graphDateTime{DateTime: "2026-03-03T00:00:00.0000000"}, End: &graphDateTime{DateTime: "2026-03-04T00:00:00.0000000"}},
+			}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	p := &MicrosoftCalendarProvider{Client: srv.Client(), CalendarID: "cal-1", BaseURL: srv.URL}
+	ctx := context.Background()
+	start := time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)
+
+	// An event deleted in Outlook is created again, idempotently
+	id, err := p.UpsertEvent(ctx, "gone", CalendarEvent{UID: "apt@serenify", Summary: "Session: Sam",
+		Start: start, End: start.Add(50 * time.Minute), AttendeeEmail: "sam@example.com"})
+	if err != nil || id != "evt-2" {
+		t.Fatalf("upsert: %q %v", id, err)
+	}
+	if created.TransactionID != "apt@serenify" || created.Start.DateTime != "2026-03-02T14:00:00" ||
+		created.Start.TimeZone != "UTC" || len(created.Attendees) != 1 || created.Attendees[0].EmailAddress.Address != "sam@example.com" {
+		t.Fatalf("created %+v", created)
+	}
+
+	busy, err := p.ListBusy(ctx, start.Add(-24*time.Hour), start.Add(72*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busy) != 2 || busy[0].EventID != "busy" || busy[1].EventID != "ooo" ||
+		!busy[0].Start.Equal(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)) || busy[1].End.Sub(busy[1].Start) != 24*time.Hour {
+		t.Fatalf("busy %+v", busy)
+	}
+}
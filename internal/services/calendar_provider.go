@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// Calendar providers an integration can sync to (calendar_integrations.provider).
+const (
+	CalendarProviderGoogle    = "google"
+	CalendarProviderMicrosoft = "microsoft"
+	CalendarProviderCalDAV    = "caldav"
+)
+
+const (
+	// calendarBusyHorizon is how far ahead busy times are read from providers without
+	// incremental sync
+	calendarBusyHorizon = 120 * 24 * time.Hour
+	calendarSyncTimeout = 30 * time.Second
+)
+
+// CalendarProvider is an external calendar appointments are written to and busy times are
+// read from.
+type CalendarProvider interface {
+	// Connect checks the credentials and returns the ID of the calendar to sync with
+	Connect(ctx context.Context) (string, error)
+	// UpsertEvent creates the event when eventID is empty, otherwise replaces it, and returns
+	// the event's ID
+	UpsertEvent(ctx context.Context, eventID string, e CalendarEvent) (string, error)
+	// DeleteEvent removes the event; one that is already gone is not an error
+	DeleteEvent(ctx context.Context, eventID string) error
+	// ListBusy returns the events that block time between from and to
+	ListBusy(ctx context.Context, from, to time.Time) ([]CalendarBusyEvent, error)
+}
+
+// CalendarEvent is an appointment as written to an external calendar.
+type CalendarEvent struct {
+	// UID is the appointment's iCalendar UID, the same in every calendar
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	// AttendeeEmail is invited by providers that send invitations themselves
+	AttendeeEmail string
+}
+
+// CalendarBusyEvent is an event that blocks the practitioner's time.
+type CalendarBusyEvent struct {
+	EventID string
+	TimeRange
+}
+
+// calendarIntegration is a calendar_integrations row with its credentials still encrypted.
+type calendarIntegration struct {
+	ID          uuid.UUID
+	TenantID    uuid.UUID
+	TherapistID uuid.UUID
+	Provider    string
+	CalendarID  string
+	Username    string
+	accessEnc   string
+	refreshEnc  string
+	expiresAt   sql.NullTime
+}
+
+// loadCalendarIntegration returns the enabled integration matching cond, or nil.
+func loadCalendarIntegration(cond string, args ...interface{}) (*calendarIntegration, error) {
+	var in calendarIntegration
+	var calendarID, username sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT id, tenant_id, therapist_id, provider, calendar_id, account_username,
+			access_token_enc, refresh_token_enc, token_expires_at
+		FROM calendar_integrations
+		WHERE sync_enabled = TRUE AND `+cond, args...).Scan(&in.ID, &in.TenantID, &in.TherapistID, &in.Provider,
+		&calendarID, &username, &in.accessEnc, &in.refreshEnc, &in.expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	in.CalendarID, in.Username = calendarID.String, username.String
+	return &in, nil
+}
+
+// provider builds the client for the integration, or nil when its provider is not
+// configured on this server.
+func (in *calendarIntegration) provider() (CalendarProvider, error) {
+	switch in.Provider {
+	case CalendarProviderGoogle:
+		if !GoogleCalendarEnabled() {
+			return nil, nil
+		}
+		svc, err := googleCalendarService(in)
+		if err != nil {
+			return nil, err
+		}
+		calendarID := in.CalendarID
+		if calendarID == "" {
+			calendarID = googleCalendarID
+		}
+		return &GoogleCalendarProvider{Service: svc, CalendarID: calendarID, Location: TenantLocation(in.TenantID)}, nil
+	case CalendarProviderMicrosoft:
+		if !MicrosoftCalendarEnabled() {
+			return nil, nil
+		}
+		client, err := oauthHTTPClient(microsoftOAuthConfig, in)
+		if err != nil {
+			return nil, err
+		}
+		return &MicrosoftCalendarProvider{Client: client, CalendarID: in.CalendarID}, nil
+	case CalendarProviderCalDAV:
+		password, err := utils.Decrypt(in.accessEnc)
+		if err != nil {
+			return nil, err
+		}
+		return &CalDAVProvider{CalendarURL: in.CalendarID, Username: in.Username, Password: password,
+			Location: TenantLocation(in.TenantID)}, nil
+	}
+	return nil, fmt.Errorf("unknown calendar provider %q", in.Provider)
+}
+
+// oauthHTTPClient returns a client authorized with the integration's OAuth tokens. Refreshed
+// tokens are saved; Microsoft rotates the refresh token as well.
+func oauthHTTPClient(conf *oauth2.Config, in *calendarIntegration) (*http.Client, error) {
+	access, _ := utils.Decrypt(in.accessEnc)
+	refresh, _ := utils.Decrypt(in.refreshEnc)
+	tok := &oauth2.Token{AccessToken: access, RefreshToken: refresh}
+	if in.expiresAt.Valid {
+		tok.Expiry = in.expiresAt.Time
+	}
+
+	ctx := context.Background()
+	ts := conf.TokenSource(ctx, tok)
+	newTok, err := ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	if newTok.AccessToken != access {
+		accessEnc, _ := utils.Encrypt(newTok.AccessToken)
+		refreshEnc := in.refreshEnc
+		if newTok.RefreshToken != "" && newTok.RefreshToken != refresh {
+			refreshEnc, _ = utils.Encrypt(newTok.RefreshToken)
+		}
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE calendar_integrations SET access_token_enc = $1, refresh_token_enc = $2, token_expires_at = $3,
+				updated_at = NOW()
+			WHERE id = $4
+		`, accessEnc, refreshEnc, newTok.Expiry, in.ID)
+	}
+	return oauth2.NewClient(ctx, ts), nil
+}
+
+// saveCalendarIntegration connects the practitioner's calendar in the tenant, replacing any
+// earlier connection. Sync state starts over; event mappings are dropped when the calendar
+// itself changed, so appointments are written to the new one.
+func saveCalendarIntegration(in calendarIntegration, expiry time.Time) (uuid.UUID, error) {
+	var oldProvider, oldCalendar sql.NullString
+	_ = database.PostgresDB.QueryRow(`
+		SELECT provider, calendar_id FROM calendar_integrations WHERE tenant_id = $1 AND therapist_id = $2
+	`, in.TenantID, in.TherapistID).Scan(&oldProvider, &oldCalendar)
+
+	var expiresAt interface{}
+	if !expiry.IsZero() {
+		expiresAt = expiry
+	}
+	var id uuid.UUID
+	err := database.PostgresDB.QueryRow(`
+		INSERT INTO calendar_integrations (tenant_id, therapist_id, provider, calendar_id, account_username,
+			access_token_enc, refresh_token_enc, token_expires_at, sync_enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, TRUE)
+		ON CONFLICT (tenant_id, therapist_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			calendar_id = EXCLUDED.calendar_id,
+			account_username = EXCLUDED.account_username,
+			access_token_enc = EXCLUDED.access_token_enc,
+			refresh_token_enc = EXCLUDED.refresh_token_enc,
+			token_expires_at = EXCLUDED.token_expires_at,
+			sync_enabled = TRUE,
+			sync_token = NULL, last_pulled_at = NULL, channel_id = NULL, channel_resource_id = NULL,
+			channel_token_hash = NULL, channel_expires_at = NULL,
+			updated_at = NOW()
+		RETURNING id
+	`, in.TenantID, in.TherapistID, in.Provider, in.CalendarID, nullIfEmpty(in.Username),
+		in.accessEnc, in.refreshEnc, expiresAt).Scan(&id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := database.PostgresDB.Exec(`DELETE FROM calendar_busy_times WHERE integration_id = $1`, id); err != nil {
+		return id, err
+	}
+	if oldProvider.Valid && (oldProvider.String != in.Provider || oldCalendar.String != in.CalendarID) {
+		if _, err := database.PostgresDB.Exec(`DELETE FROM calendar_event_mappings WHERE integration_id = $1`, id); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// startCalendarIntegration writes the practitioner's open appointments to a newly connected
+// calendar and reads its busy times.
+func startCalendarIntegration(tenantID, therapistID, integrationID uuid.UUID) {
+	SyncAllPendingAppointments(tenantID, therapistID)
+	// Watch before the first pull so no change falls between them
+	if err := EnsureGoogleCalendarWatch(integrationID); err != nil {
+		log.Printf("[Calendar Sync] Watch %s: %v", integrationID, err)
+	}
+	EnqueueCalendarPull(integrationID)
+}
+
+// SyncAppointmentToCalendar writes an appointment change to the practitioner's connected
+// calendar, whichever provider it is.
+func SyncAppointmentToCalendar(job CalendarJob) error {
+	appointmentID, err := uuid.Parse(job.AppointmentID)
+	if err != nil {
+		return err
+	}
+	tenantID, err := uuid.Parse(job.TenantID)
+	if err != nil {
+		return err
+	}
+
+	lockKey := "cal:sync:lock:" + appointmentID.String()
+	if database.RedisClient != nil {
+		ok, _ := database.RedisClient.SetNX(context.Background(), lockKey, "1", 60*time.Second).Result()
+		if !ok {
+			return nil
+		}
+		defer database.RedisClient.Del(context.Background(), lockKey)
+	}
+
+	var therapistID uuid.UUID
+	var patientName, patientEmail, aptType, status, meetingLink, location, notes sql.NullString
+	var startsAt, endsAt time.Time
+	err = database.PostgresDB.QueryRow(`
+		SELECT a.therapist_id, p.full_name, p.email, a.type, a.status, a.starts_at, a.ends_at,
+			a.meeting_link, a.location, a.notes
+		FROM appointments a
+		JOIN patients p ON p.id = a.patient_id
+		WHERE a.id = $1 AND a.tenant_id = $2
+	`, appointmentID, tenantID).Scan(
+		&therapistID, &patientName, &patientEmail, &aptType, &status, &startsAt, &endsAt,
+		&meetingLink, &location, &notes,
+	)
+	if err != nil {
+		return err
+	}
+
+	in, err := loadCalendarIntegration(`tenant_id = $1 AND therapist_id = $2`, tenantID, therapistID)
+	if err != nil {
+		return err
+	}
+	if in == nil {
+		if GoogleCalendarEnabled() {
+			NotifyUser(therapistID, "therapist", "Google Calendar Not Connected", "Please connect your Google Calendar in your dashboard settings to automatically synchronize your booked therapy sessions.", "calendar")
+		}
+		return nil
+	}
+	provider, err := in.provider()
+	if err != nil || provider == nil {
+		return err
+	}
+	log.Printf("[Calendar Sync] Syncing appointment %s to %s for tenant %s (Action: %s)", appointmentID, in.Provider, tenantID, job.Action)
+
+	var externalID, mappingStatus string
+	_ = database.PostgresDB.QueryRow(`
+		SELECT external_event_id, sync_status FROM calendar_event_mappings
+		WHERE appointment_id = $1 AND integration_id = $2
+	`, appointmentID, in.ID).Scan(&externalID, &mappingStatus)
+	// The event was deleted in the calendar; a local change recreates it
+	deletedRemotely := mappingStatus == "conflict"
+	if deletedRemotely {
+		externalID = ""
+	}
+
+	action := job.Action
+	if status.String == "cancelled" {
+		action = "delete"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), calendarSyncTimeout)
+	defer cancel()
+
+	if action == "delete" {
+		if externalID != "" {
+			if err := provider.DeleteEvent(ctx, externalID); err != nil {
+				log.Printf("[Calendar Sync] Delete failed: %v", err)
+				markSyncFailed(appointmentID, in.ID)
+				return err
+			}
+		} else if !deletedRemotely {
+			return nil
+		}
+		_, _ = database.PostgresDB.Exec(`DELETE FROM calendar_event_mappings WHERE appointment_id = $1 AND integration_id = $2`,
+			appointmentID, in.ID)
+		return nil
+	}
+
+	event := CalendarEvent{
+		UID:         appointmentID.String() + "@serenify",
+		Summary:     fmt.Sprintf("Session: %s", patientName.String),
+		Description: fmt.Sprintf("Type: %s\n%s", aptType.String, notes.String),
+		Location:    location.String,
+		Start:       startsAt,
+		End:         endsAt,
+	}
+	if meetingLink.Valid && meetingLink.String != "" {
+		event.Description += "\nMeeting: " + meetingLink.String
+	}
+	event.AttendeeEmail = strings.TrimSpace(patientEmail.String)
+
+	eventID, err := provider.UpsertEvent(ctx, externalID, event)
+	if err != nil {
+		log.Printf("[Calendar Sync] Upsert failed: %v", err)
+		markSyncFailed(appointmentID, in.ID)
+		return err
+	}
+	_, err = database.PostgresDB.Exec(`
+		INSERT INTO calendar_event_mappings (tenant_id, appointment_id, integration_id, external_event_id, sync_status, last_synced_at)
+		VALUES ($1, $2, $3, $4, 'synced', NOW())
+		ON CONFLICT (appointment_id, integration_id) DO UPDATE SET
+			external_event_id = EXCLUDED.external_event_id,
+			sync_status = 'synced', conflict_reason = NULL, last_synced_at = NOW()
+	`, tenantID, appointmentID, in.ID, eventID)
+	return err
+}
+
+// PullCalendarChanges refreshes what Serenify knows about an integration's calendar. Google
+// integrations sync incrementally; other providers have their busy times re-read.
+func PullCalendarChanges(integrationID uuid.UUID) error {
+	if database.RedisClient != nil {
+		ctx := context.Background()
+		database.RedisClient.Del(ctx, calendarPullQueuedKeyPrefix+integrationID.String())
+		lockKey := calendarPullLockKeyPrefix + integrationID.String()
+		ok, _ := database.RedisClient.SetNX(ctx, lockKey, "1", 2*time.Minute).Result()
+		if !ok {
+			return nil
+		}
+		defer database.RedisClient.Del(ctx, lockKey)
+	}
+
+	in, err := loadCalendarIntegration(`id = $1`, integrationID)
+	if err != nil || in == nil {
+		return err
+	}
+	if in.Provider == CalendarProviderGoogle {
+		return PullGoogleCalendarChanges(in)
+	}
+	return refreshCalendarBusyTimes(in)
+}
+
+// refreshCalendarBusyTimes replaces the integration's cached busy times with the provider's
+// current ones, leaving out Serenify's own events.
+func refreshCalendarBusyTimes(in *calendarIntegration) error {
+	provider, err := in.provider()
+	if err != nil || provider == nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	now := time.Now().UTC()
+	busy, err := provider.ListBusy(ctx, now.Add(-googleBusyRetention), now.Add(calendarBusyHorizon))
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM calendar_busy_times WHERE integration_id = $1`, in.ID); err != nil {
+		return err
+	}
+	for _, b := range busy {
+		if _, err := tx.Exec(`
+			INSERT INTO calendar_busy_times (integration_id, external_event_id, therapist_id, starts_at, ends_at)
+			SELECT $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (
+				SELECT 1 FROM calendar_event_mappings WHERE integration_id = $1 AND external_event_id = $2
+			)
+			ON CONFLICT (integration_id, external_event_id) DO NOTHING
+		`, in.ID, b.EventID, in.TherapistID, b.Start.UTC(), b.End.UTC()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE calendar_integrations SET last_pulled_at = NOW(), updated_at = NOW() WHERE id = $1
+	`, in.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CalendarProviderSendsInvites reports whether the practitioner's connected calendar invites
+// patients itself, so Serenify's own .ics invites would be duplicates.
+func CalendarProviderSendsInvites(tenantID, therapistID uuid.UUID) bool {
+	var provider string
+	err := database.PostgresDB.QueryRow(`
+		SELECT provider FROM calendar_integrations
+		WHERE tenant_id = $1 AND therapist_id = $2 AND sync_enabled = TRUE
+	`, tenantID, therapistID).Scan(&provider)
+	if err != nil {
+		return false
+	}
+	switch provider {
+	case CalendarProviderGoogle:
+		return GoogleCalendarEnabled()
+	case CalendarProviderMicrosoft:
+		return MicrosoftCalendarEnabled()
+	}
+	return false
+}
+
+// ConnectedCalendarProvider returns the provider of the practitioner's connected calendar, or
+// "" when none is connected.
+func ConnectedCalendarProvider(tenantID, therapistID uuid.UUID) string {
+	var provider string
+	_ = database.PostgresDB.QueryRow(`
+		SELECT provider FROM calendar_integrations
+		WHERE tenant_id = $1 AND therapist_id = $2 AND sync_enabled = TRUE
+	`, tenantID, therapistID).Scan(&provider)
+	return provider
+}
+
+// DisconnectCalendar stops syncing, closes a Google watch channel, wipes the stored
+// credentials and forgets the cached busy times, which would otherwise keep blocking slots.
+func DisconnectCalendar(tenantID, therapistID uuid.UUID) error {
+	var integrationID uuid.UUID
+	var provider string
+	var channelID, resourceID sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT id, provider, channel_id, channel_resource_id FROM calendar_integrations
+		WHERE tenant_id = $1 AND therapist_id = $2
+	`, tenantID, therapistID).Scan(&integrationID, &provider, &channelID, &resourceID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if provider == CalendarProviderGoogle && channelID.Valid && GoogleCalendarEnabled() {
+		if svc, _ := calendarServiceByID(integrationID); svc != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			stopGoogleChannel(ctx, svc, channelID.String, resourceID.String)
+			cancel()
+		}
+	}
+	_, err = database.PostgresDB.Exec(`
+		UPDATE calendar_integrations SET sync_enabled = FALSE, access_token_enc = '', refresh_token_enc = '',
+			sync_token = NULL, channel_id = NULL, channel_resource_id = NULL, channel_token_hash = NULL,
+			channel_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, integrationID)
+	if err != nil {
+		return err
+	}
+	_, err = database.PostgresDB.Exec(`DELETE FROM calendar_busy_times WHERE integration_id = $1`, integrationID)
+	return err
+}
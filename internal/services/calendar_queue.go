@@ -3,19 +3,23 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 const calendarQueueKey = "queue:calendar:sync"
 
 type CalendarJob struct {
-	Action        string `json:"action"` // create | update | delete
-	AppointmentID string `json:"appointment_id"`
-	TenantID      string `json:"tenant_id"`
+	Action        string `json:"action"` // create | update | delete | pull
+	AppointmentID string `json:"appointment_id,omitempty"`
+	TenantID      string `json:"tenant_id,omitempty"`
+	// IntegrationID is set for pulls, which read changes from the calendar instead of pushing them
+	IntegrationID string `json:"integration_id,omitempty"`
 }
 
 func EnqueueCalendarSync(action string, tenantID, appointmentID uuid.UUID) {
@@ -36,29 +40,67 @@ func EnqueueCalendarSync(action string, tenantID, appointmentID uuid.UUID) {
 	}
 }
 
+// calendarJobHandlers run calendar jobs; tests replace them to observe jobs without a database.
+var calendarJobHandlers struct {
+	sync    func(CalendarJob) error
+	invites func(CalendarJob) error
+	pull    func(uuid.UUID) error
+}
+
+// Set in init because the handlers enqueue jobs themselves.
+func init() {
+	calendarJobHandlers.sync = SyncAppointmentToCalendar
+	calendarJobHandlers.invites = SendAppointmentInvites
+	calendarJobHandlers.pull = PullCalendarChanges
+}
+
+// StartCalendarWorker consumes the calendar queue. It must run after ConnectRedis: without Redis
+// jobs run inline and there is nothing to consume.
 func StartCalendarWorker() {
 	if database.RedisClient == nil {
 		log.Println("⚠️  Calendar worker: Redis unavailable, inline sync only")
 		return
 	}
-	go func() {
-		ctx := context.Background()
-		for {
-			result, err := database.RedisClient.BRPop(ctx, 5*time.Second, calendarQueueKey).Result()
-			if err != nil || len(result) < 2 {
-				continue
-			}
-			var job CalendarJob
-			if json.Unmarshal([]byte(result[1]), &job) == nil {
-				processCalendarJob(job)
-			}
-		}
-	}()
+	go runCalendarWorker(database.RedisClient)
 	log.Println("✅ Calendar sync worker started")
 }
 
+func runCalendarWorker(client *redis.Client) {
+	ctx := context.Background()
+	for {
+		result, err := client.BRPop(ctx, 5*time.Second, calendarQueueKey).Result()
+		if errors.Is(err, redis.ErrClosed) {
+			return
+		}
+		if err != nil && err != redis.Nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		if len(result) < 2 {
+			continue
+		}
+		var job CalendarJob
+		if json.Unmarshal([]byte(result[1]), &job) == nil {
+			processCalendarJob(job)
+		}
+	}
+}
+
 func processCalendarJob(job CalendarJob) {
-	if err := SyncAppointmentToGoogle(job); err != nil {
+	if job.Action == CalendarActionPull {
+		id, err := uuid.Parse(job.IntegrationID)
+		if err == nil {
+			err = calendarJobHandlers.pull(id)
+		}
+		if err != nil {
+			log.Printf("calendar pull %s: %v", job.IntegrationID, err)
+		}
+		return
+	}
+	if err := calendarJobHandlers.sync(job); err != nil {
 		log.Printf("calendar sync %s %s: %v", job.Action, job.AppointmentID, err)
 	}
+	if err := calendarJobHandlers.invites(job); err != nil {
+		log.Printf("calendar invites %s %s: %v", job.Action, job.AppointmentID, err)
+	}
 }
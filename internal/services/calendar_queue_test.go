@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedisQueue speaks just enough RESP2 for the calendar queue: LPUSH, BRPOP, SET NX and DEL.
+type fakeRedisQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lists  map[string][]string
+	values map[string]string
+}
+
+func newFakeRedisQueue(t *testing.T) *redis.Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedisQueue{lists: map[string][]string{}, values: map[string]string{}}
+	f.cond = sync.NewCond(&f.mu)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	client := redis.NewClient(&redis.Options{Addr: ln.Addr().String(), Protocol: 2, DisableIndentity: true})
+	t.Cleanup(func() {
+		client.Close()
+		ln.Close()
+	})
+	return client
+}
+
+func (f *fakeRedisQueue) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedisQueue) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "LPUSH":
+		for _, v := range args[2:] {
+			f.lists[args[1]] = append([]string{v}, f.lists[args[1]]...)
+		}
+		f.cond.Broadcast()
+		return fmt.Sprintf(":%d\r\n", len(f.lists[args[1]]))
+	case "BRPOP":
+		key := args[1]
+		timeout, _ := strconv.ParseFloat(args[len(args)-1], 64)
+		deadline := time.Now().Add(time.Duration(timeout * float64(time.Second)))
+		for len(f.lists[key]) == 0 && time.Now().Before(deadline) {
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				f.cond.Broadcast()
+			}()
+			f.cond.Wait()
+		}
+		list := f.lists[key]
+		if len(list) == 0 {
+			return "*-1\r\n"
+		}
+		v := list[len(list)-1]
+		f.lists[key] = list[:len(list)-1]
+		return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(key), key, len(v), v)
+	case "SET":
+		if _, ok := f.values[args[1]]; ok {
+			return "$-1\r\n"
+		}
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		delete(f.values, args[1])
+		return ":1\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// recordCalendarJobs swaps the job handlers for ones that report each job on the returned channel.
+func recordCalendarJobs(t *testing.T) <-chan CalendarJob {
+	t.Helper()
+	jobs := make(chan CalendarJob, 8)
+	saved := calendarJobHandlers
+	t.Cleanup(func() { calendarJobHandlers = saved })
+	calendarJobHandlers.sync = func(CalendarJob) error { return nil }
+	calendarJobHandlers.invites = func(job CalendarJob) error {
+		jobs <- job
+		return nil
+	}
+	calendarJobHandlers.pull = func(id uuid.UUID) error {
+		jobs <- CalendarJob{Action: CalendarActionPull, IntegrationID: id.String()}
+		return nil
+	}
+	return jobs
+}
+
+func useRedisClient(t *testing.T, client *redis.Client) {
+	t.Helper()
+	saved := database.RedisClient
+	database.RedisClient = client
+	t.Cleanup(func() { database.RedisClient = saved })
+}
+
+func waitForCalendarJob(t *testing.T, jobs <-chan CalendarJob) CalendarJob {
+	t.Helper()
+	select {
+	case job := <-jobs:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("calendar job was not processed")
+		return CalendarJob{}
+	}
+}
+
+func TestCalendarWorkerSendsInvitesForQueuedBookings(t *testing.T) {
+	jobs := recordCalendarJobs(t)
+	useRedisClient(t, newFakeRedisQueue(t))
+	StartCalendarWorker()
+
+	tenantID, appointmentID := uuid.New(), uuid.New()
+	EnqueueCalendarSync("create", tenantID, appointmentID)
+	job := waitForCalendarJob(t, jobs)
+	if job.Action != "create" || job.AppointmentID != appointmentID.String() || job.TenantID != tenantID.String() {
+		t.Fatalf("invites sent for %+v", job)
+	}
+}
+
+func TestCalendarWorkerAppliesQueuedPulls(t *testing.T) {
+	jobs := recordCalendarJobs(t)
+	useRedisClient(t, newFakeRedisQueue(t))
+	StartCalendarWorker()
+
+	// A burst of push notifications for one calendar queues a single pull
+	integrationID := uuid.New()
+	EnqueueCalendarPull(integrationID)
+	EnqueueCalendarPull(integrationID)
+	if job := waitForCalendarJob(t, jobs); job.IntegrationID != integrationID.String() {
+		t.Fatalf("pulled %+v", job)
+	}
+	select {
+	case job := <-jobs:
+		t.Fatalf("second pull queued: %+v", job)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCalendarJobsRunInlineWithoutRedis(t *testing.T) {
+	jobs := recordCalendarJobs(t)
+	useRedisClient(t, nil)
+
+	appointmentID := uuid.New()
+	EnqueueCalendarSync("create", uuid.New(), appointmentID)
+	if job := waitForCalendarJob(t, jobs); job.AppointmentID != appointmentID.String() {
+		t.Fatalf("invites sent for %+v", job)
+	}
+}
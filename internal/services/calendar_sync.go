@@ -2,9 +2,10 @@ package services
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -31,6 +33,9 @@ func InitGoogleCalendar(cfg *config.Config) {
 		Scopes:       []string{calendar.CalendarEventsScope},
 		Endpoint:     google.Endpoint,
 	}
+	if strings.HasPrefix(cfg.Host, "https://") {
+		googleWebhookURL = strings.TrimRight(cfg.Host, "/") + "/api/v1/calendar/google/notifications"
+	}
 }
 
 func GoogleCalendarEnabled() bool {
@@ -49,15 +54,7 @@ func HandleGoogleCallback(code, state string) error {
 	if !GoogleCalendarEnabled() {
 		return fmt.Errorf("google calendar not configured")
 	}
-	parts := strings.SplitN(state, ":", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid oauth state")
-	}
-	tenantID, err := uuid.Parse(parts[0])
-	if err != nil {
-		return err
-	}
-	therapistID, err := uuid.Parse(parts[1])
+	tenantID, therapistID, err := parseCalendarOAuthState(state)
 	if err != nil {
 		return err
 	}
@@ -74,195 +71,124 @@ func HandleGoogleCallback(code, state string) error {
 	accessEnc, _ := utils.Encrypt(tok.AccessToken)
 	refreshEnc, _ := utils.Encrypt(tok.RefreshToken)
 
-	_, err = database.PostgresDB.Exec(`
-		INSERT INTO calendar_integrations (tenant_id, therapist_id, access_token_enc, refresh_token_enc, token_expires_at, sync_enabled)
-		VALUES ($1, $2, $3, $4, $5, TRUE)
-		ON CONFLICT (tenant_id, therapist_id) DO UPDATE SET
-			access_token_enc = EXCLUDED.access_token_enc,
-			refresh_token_enc = EXCLUDED.refresh_token_enc,
-			token_expires_at = EXCLUDED.token_expires_at,
-			sync_enabled = TRUE,
-			updated_at = NOW()
-	`, tenantID, therapistID, accessEnc, refreshEnc, tok.Expiry)
+	// A reconnect may be to another Google account, so sync state starts over
+	integrationID, err := saveCalendarIntegration(calendarIntegration{
+		TenantID:    tenantID,
+		TherapistID: therapistID,
+		Provider:    CalendarProviderGoogle,
+		CalendarID:  googleCalendarID,
+		accessEnc:   accessEnc,
+		refreshEnc:  refreshEnc,
+	}, tok.Expiry)
 	if err != nil {
 		log.Printf("[Google Calendar OAuth] Failed to save integration: %v", err)
 		return err
 	}
 	log.Printf("[Google Calendar OAuth] Successfully saved integration for therapist %s", therapistID)
-	go SyncAllPendingAppointments(tenantID, therapistID)
+	go startCalendarIntegration(tenantID, therapistID, integrationID)
 	return nil
 }
 
-func SyncAppointmentToGoogle(job CalendarJob) error {
-	if !GoogleCalendarEnabled() {
-		return nil
+// parseCalendarOAuthState reads the "<tenant>:<therapist>" state of a calendar OAuth flow.
+func parseCalendarOAuthState(state string) (uuid.UUID, uuid.UUID, error) {
+	parts := strings.SplitN(state, ":", 2)
+	if len(parts) != 2 {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("invalid oauth state")
 	}
-	appointmentID, err := uuid.Parse(job.AppointmentID)
+	tenantID, err := uuid.Parse(parts[0])
 	if err != nil {
-		return err
+		return uuid.Nil, uuid.Nil, err
 	}
-	tenantID, err := uuid.Parse(job.TenantID)
+	therapistID, err := uuid.Parse(parts[1])
 	if err != nil {
-		return err
-	}
-
-	log.Printf("[Google Calendar Sync] Syncing appointment %s for tenant %s (Action: %s)", appointmentID, tenantID, job.Action)
-
-	lockKey := "cal:sync:lock:" + appointmentID.String()
-	if database.RedisClient != nil {
-		ok, _ := database.RedisClient.SetNX(context.Background(), lockKey, "1", 60*time.Second).Result()
-		if !ok {
-			return nil
-		}
-		defer database.RedisClient.Del(context.Background(), lockKey)
+		return uuid.Nil, uuid.Nil, err
 	}
+	return tenantID, therapistID, nil
+}
 
-	var therapistID uuid.UUID
-	var patientName, patientEmail, aptType, status, meetingLink, location, notes sql.NullString
-	var startsAt, endsAt time.Time
-	var cancelledAt sql.NullTime
+// GoogleCalendarProvider writes appointments to a Google calendar. Google emails the patient
+// an invitation for each event.
+type GoogleCalendarProvider struct {
+	Service    *calendar.Service
+	CalendarID string
+	// Location is the tenant's time zone, used for all-day events
+	Location *time.Location
+}
 
-	err = database.PostgresDB.QueryRow(`
-		SELECT a.therapist_id, p.full_name, p.email, a.type, a.status, a.starts_at, a.ends_at,
-			a.meeting_link, a.location, a.notes, a.cancelled_at
-		FROM appointments a
-		JOIN patients p ON p.id = a.patient_id
-		WHERE a.id = $1 AND a.tenant_id = $2
-	`, appointmentID, tenantID).Scan(
-		&therapistID, &patientName, &patientEmail, &aptType, &status, &startsAt, &endsAt,
-		&meetingLink, &location, &notes, &cancelledAt,
-	)
+func (p *GoogleCalendarProvider) Connect(ctx context.Context) (string, error) {
+	cal, err := p.Service.Calendars.Get(p.CalendarID).Context(ctx).Do()
 	if err != nil {
-		return err
+		return "", err
 	}
+	return cal.Id, nil
+}
 
-	svc, integrationID, err := calendarService(tenantID, therapistID)
-	if err != nil {
-		return err
+func (p *GoogleCalendarProvider) UpsertEvent(ctx context.Context, eventID string, e CalendarEvent) (string, error) {
+	event := &calendar.Event{
+		Summary:     e.Summary,
+		Description: e.Description,
+		Start:       &calendar.EventDateTime{DateTime: e.Start.UTC().Format(time.RFC3339), TimeZone: "UTC"},
+		End:         &calendar.EventDateTime{DateTime: e.End.UTC().Format(time.RFC3339), TimeZone: "UTC"},
+		Location:    e.Location,
 	}
-	if svc == nil {
-		NotifyUser(therapistID, "therapist", "Google Calendar Not Connected", "Please connect your Google Calendar in your dashboard settings to automatically synchronize your booked therapy sessions.", "calendar")
-		return nil
-	}
-
-	var externalID string
-	_ = database.PostgresDB.QueryRow(`
-		SELECT external_event_id FROM calendar_event_mappings
-		WHERE appointment_id = $1 AND integration_id = $2
-	`, appointmentID, integrationID).Scan(&externalID)
-
-	action := job.Action
-	if status.String == "cancelled" {
-		action = "delete"
+	if e.AttendeeEmail != "" {
+		event.Attendees = []*calendar.EventAttendee{{Email: e.AttendeeEmail}}
 	}
-
-	switch action {
-	case "delete":
-		if externalID == "" {
-			return nil
-		}
-		log.Printf("[Google Calendar Sync] Deleting event %s for appointment %s", externalID, appointmentID)
-		if err := svc.Events.Delete("primary", externalID).SendUpdates("all").Do(); err != nil {
-			log.Printf("[Google Calendar Sync] Delete failed: %v", err)
-			markSyncFailed(appointmentID, integrationID)
-			return err
-		}
-		_, _ = database.PostgresDB.Exec(`DELETE FROM calendar_event_mappings WHERE appointment_id = $1 AND integration_id = $2`,
-			appointmentID, integrationID)
-		log.Printf("[Google Calendar Sync] Successfully deleted event %s", externalID)
-		return nil
-	default:
-		event := &calendar.Event{
-			Summary:     fmt.Sprintf("Session: %s", patientName.String),
-			Description: fmt.Sprintf("Type: %s\n%s", aptType.String, notes.String),
-			Start:       &calendar.EventDateTime{DateTime: startsAt.Format(time.RFC3339), TimeZone: "UTC"},
-			End:         &calendar.EventDateTime{DateTime: endsAt.Format(time.RFC3339), TimeZone: "UTC"},
-			Location:    location.String,
-		}
-		if meetingLink.Valid && meetingLink.String != "" {
-			event.Description += "\nMeeting: " + meetingLink.String
-		}
-		if patientEmail.Valid && patientEmail.String != "" {
-			event.Attendees = []*calendar.EventAttendee{
-				{Email: patientEmail.String},
-			}
-		}
-
-		if externalID != "" {
-			log.Printf("[Google Calendar Sync] Updating event %s for appointment %s", externalID, appointmentID)
-			_, err = svc.Events.Update("primary", externalID, event).SendUpdates("all").Do()
-		} else {
-			log.Printf("[Google Calendar Sync] Inserting new event for appointment %s", appointmentID)
-			var created *calendar.Event
-			created, err = svc.Events.Insert("primary", event).SendUpdates("all").Do()
-			if err == nil {
-				externalID = created.Id
-				_, _ = database.PostgresDB.Exec(`
-					INSERT INTO calendar_event_mappings (tenant_id, appointment_id, integration_id, external_event_id, sync_status, last_synced_at)
-					VALUES ($1, $2, $3, $4, 'synced', NOW())
-					ON CONFLICT (appointment_id, integration_id) DO UPDATE SET
-						external_event_id = EXCLUDED.external_event_id,
-						sync_status = 'synced', last_synced_at = NOW()
-				`, tenantID, appointmentID, integrationID, externalID)
-			}
-		}
+	if eventID != "" {
+		updated, err := p.Service.Events.Update(p.CalendarID, eventID, event).SendUpdates("all").Context(ctx).Do()
 		if err != nil {
-			log.Printf("[Google Calendar Sync] Insert/Update failed: %v", err)
-			markSyncFailed(appointmentID, integrationID)
-			return err
+			return "", err
 		}
-		_, _ = database.PostgresDB.Exec(`
-			UPDATE calendar_event_mappings SET sync_status = 'synced', last_synced_at = NOW()
-			WHERE appointment_id = $1 AND integration_id = $2
-		`, appointmentID, integrationID)
-		log.Printf("[Google Calendar Sync] Successfully completed sync for appointment %s", appointmentID)
-		return nil
+		return updated.Id, nil
 	}
+	created, err := p.Service.Events.Insert(p.CalendarID, event).SendUpdates("all").Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return created.Id, nil
 }
 
-func calendarService(tenantID, therapistID uuid.UUID) (*calendar.Service, uuid.UUID, error) {
-	var integrationID uuid.UUID
-	var accessEnc, refreshEnc string
-	var expiresAt sql.NullTime
-	var syncEnabled bool
-
-	err := database.PostgresDB.QueryRow(`
-		SELECT id, access_token_enc, refresh_token_enc, token_expires_at, sync_enabled
-		FROM calendar_integrations
-		WHERE tenant_id = $1 AND therapist_id = $2
-	`, tenantID, therapistID).Scan(&integrationID, &accessEnc, &refreshEnc, &expiresAt, &syncEnabled)
-	if err == sql.ErrNoRows || !syncEnabled {
-		return nil, uuid.Nil, nil
-	}
-	if err != nil {
-		return nil, uuid.Nil, err
+func (p *GoogleCalendarProvider) DeleteEvent(ctx context.Context, eventID string) error {
+	err := p.Service.Events.Delete(p.CalendarID, eventID).SendUpdates("all").Context(ctx).Do()
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusGone) {
+		return nil
 	}
+	return err
+}
 
-	access, _ := utils.Decrypt(accessEnc)
-	refresh, _ := utils.Decrypt(refreshEnc)
-	tok := &oauth2.Token{AccessToken: access, RefreshToken: refresh}
-	if expiresAt.Valid {
-		tok.Expiry = expiresAt.Time
+// ListBusy reads busy events directly; the sync itself uses incremental pulls instead.
+func (p *GoogleCalendarProvider) ListBusy(ctx context.Context, from, to time.Time) ([]CalendarBusyEvent, error) {
+	var busy []CalendarBusyEvent
+	err := p.Service.Events.List(p.CalendarID).SingleEvents(true).MaxResults(250).
+		TimeMin(from.UTC().Format(time.RFC3339)).TimeMax(to.UTC().Format(time.RFC3339)).
+		Pages(ctx, func(res *calendar.Events) error {
+			for _, e := range res.Items {
+				if r, ok := googleEventBusy(e, p.Location); ok {
+					busy = append(busy, CalendarBusyEvent{EventID: e.Id, TimeRange: r})
+				}
+			}
+			return nil
+		})
+	return busy, err
+}
+
+// calendarServiceByID returns a Google client for the integration, or nil when it is disabled
+// or not a Google integration.
+func calendarServiceByID(integrationID uuid.UUID) (*calendar.Service, error) {
+	in, err := loadCalendarIntegration(`id = $1`, integrationID)
+	if err != nil || in == nil || in.Provider != CalendarProviderGoogle {
+		return nil, err
 	}
+	return googleCalendarService(in)
+}
 
-	ctx := context.Background()
-	ts := googleOAuthConfig.TokenSource(ctx, tok)
-	client := oauth2.NewClient(ctx, ts)
-	newTok, err := ts.Token()
+func googleCalendarService(in *calendarIntegration) (*calendar.Service, error) {
+	client, err := oauthHTTPClient(googleOAuthConfig, in)
 	if err != nil {
-		return nil, integrationID, err
-	}
-	if newTok.AccessToken != access {
-		enc, _ := utils.Encrypt(newTok.AccessToken)
-		_, _ = database.PostgresDB.Exec(`
-			UPDATE calendar_integrations SET access_token_enc = $1, token_expires_at = $2, updated_at = NOW()
-			WHERE id = $3
-		`, enc, newTok.Expiry, integrationID)
-		client = oauth2.NewClient(ctx, ts)
+		return nil, err
 	}
-
-	svc, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	return svc, integrationID, err
+	return calendar.NewService(context.Background(), option.WithHTTPClient(client))
 }
 
 func markSyncFailed(appointmentID, integrationID uuid.UUID) {
@@ -281,20 +207,15 @@ func HasCalendarIntegration(tenantID, therapistID uuid.UUID) bool {
 	return err == nil && syncEnabled
 }
 
-func DisconnectGoogleCalendar(tenantID, therapistID uuid.UUID) error {
-	_, err := database.PostgresDB.Exec(`
-		UPDATE calendar_integrations SET sync_enabled = FALSE, updated_at = NOW()
-		WHERE tenant_id = $1 AND therapist_id = $2
-	`, tenantID, therapistID)
-	return err
-}
-
 func LogCalendarStatus() {
 	if GoogleCalendarEnabled() {
 		log.Println("✅ Google Calendar OAuth configured")
 	} else {
 		log.Println("⚠️  Google Calendar not configured (set GOOGLE_CLIENT_ID/SECRET)")
 	}
+	if MicrosoftCalendarEnabled() {
+		log.Println("✅ Microsoft 365 Calendar OAuth configured")
+	}
 }
 
 type TimeRange struct {
@@ -302,42 +223,6 @@ type TimeRange struct {
 	End   time.Time
 }
 
-func GetGoogleCalendarBusyTimes(tenantID, therapistID uuid.UUID, start, end time.Time) ([]TimeRange, error) {
-	svc, _, err := calendarService(tenantID, therapistID)
-	if err != nil || svc == nil {
-		return nil, err
-	}
-	events, err := svc.Events.List("primary").
-		TimeMin(start.Format(time.RFC3339)).
-		TimeMax(end.Format(time.RFC3339)).
-		SingleEvents(true).
-		Do()
-	if err != nil {
-		return nil, err
-	}
-
-	var ranges []TimeRange
-	for _, item := range events.Items {
-		if item.Start == nil || item.End == nil {
-			continue
-		}
-		sStr := item.Start.DateTime
-		if sStr == "" {
-			sStr = item.Start.Date + "T00:00:00Z"
-		}
-		eStr := item.End.DateTime
-		if eStr == "" {
-			eStr = item.End.Date + "T23:59:59Z"
-		}
-		sTime, err1 := time.Parse(time.RFC3339, sStr)
-		eTime, err2 := time.Parse(time.RFC3339, eStr)
-		if err1 == nil && err2 == nil {
-			ranges = append(ranges, TimeRange{Start: sTime, End: eTime})
-		}
-	}
-	return ranges, nil
-}
-
 func SyncAllPendingAppointments(tenantID, therapistID uuid.UUID) {
 	// Fetch all scheduled (non-cancelled) appointments for this therapist that don't have a successful sync mapping
 	rows, err := database.PostgresDB.Query(`
@@ -350,7 +235,7 @@ func SyncAllPendingAppointments(tenantID, therapistID uuid.UUID) {
 		)
 	`, tenantID, therapistID)
 	if err != nil {
-		log.Printf("[Google Calendar Sync] Failed to query pending appointments for retroactive sync: %v", err)
+		log.Printf("[Calendar Sync] Failed to query pending appointments for retroactive sync: %v", err)
 		return
 	}
 	defer rows.Close()
@@ -358,7 +243,7 @@ func SyncAllPendingAppointments(tenantID, therapistID uuid.UUID) {
 	for rows.Next() {
 		var aptID uuid.UUID
 		if err := rows.Scan(&aptID); err == nil {
-			log.Printf("[Google Calendar Sync] Retroactively enqueuing calendar sync for appointment %s", aptID)
+			log.Printf("[Calendar Sync] Retroactively enqueuing calendar sync for appointment %s", aptID)
 			EnqueueCalendarSync("create", tenantID, aptID)
 		}
 	}
@@ -78,8 +78,8 @@ func (s *CloudinaryService) UploadFile(
 	return uploadResult.SecureURL, nil
 }
 
-// UploadString uploads text content (e.g. HTML invoice) to Cloudinary.
-func (s *CloudinaryService) UploadString(ctx context.Context, content, folder, filename string) (string, error) {
+// UploadBytes uploads generated content (e.g. an invoice PDF) to Cloudinary as a raw file.
+func (s *CloudinaryService) UploadBytes(ctx context.Context, content []byte, folder, filename string) (string, error) {
 	params := uploader.UploadParams{
 		ResourceType: "raw",
 		PublicID:     filename,
@@ -87,7 +87,7 @@ func (s *CloudinaryService) UploadString(ctx context.Context, content, folder, f
 	if folder != "" {
 		params.Folder = folder
 	}
-	uploadResult, err := s.cld.Upload.Upload(ctx, bytes.NewReader([]byte(content)), params)
+	uploadResult, err := s.cld.Upload.Upload(ctx, bytes.NewReader(content), params)
 	if err != nil {
 		return "", fmt.Errorf("cloudinary upload failed: %w", err)
 	}
@@ -10,12 +10,10 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
-	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/AnshRaj112/serenify-backend/pkg/crypto"
-	"github.com/google/uuid"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
 	"golang.org/x/crypto/curve25519"
 )
 
@@ -24,9 +22,11 @@ type KMSClientInterface interface {
 	DecryptReportPayload(ctx context.Context, encryptedReportB64 string, reason string, operatorID string) ([]byte, error)
 }
 
-// LocalKMSEscrowClient wraps local development X25519 private keys.
+// LocalKMSEscrowClient wraps local development X25519 private keys. Reports are encrypted to the
+// public key of PrivateKey; PreviousKeys still open reports escrowed before a key rotation.
 type LocalKMSEscrowClient struct {
-	PrivateKey []byte
+	PrivateKey   []byte
+	PreviousKeys [][]byte
 }
 
 func (c *LocalKMSEscrowClient) DecryptReportPayload(ctx context.Context, encryptedReportB64 string, reason string, operatorID string) ([]byte, error) {
@@ -39,10 +39,21 @@ func (c *LocalKMSEscrowClient) DecryptReportPayload(ctx context.Context, encrypt
 		return nil, errors.New("report packet is too short")
 	}
 
+	for _, key := range append([][]byte{c.PrivateKey}, c.PreviousKeys...) {
+		if decryptedBytes, ok := decryptEscrowPacket(packet, key); ok {
+			return decryptedBytes, nil
+		}
+	}
+	return nil, errors.New("failed to decrypt report payload: cryptographic authentication failure in all standard/fallback formats")
+}
+
+// decryptEscrowPacket opens a report packet with one private key, in any of the formats clients
+// have used.
+func decryptEscrowPacket(packet, privateKey []byte) ([]byte, bool) {
 	// Try Method A: HKDF ECIES-X25519 decryption (via pkg/crypto)
-	decryptedBytes, err := crypto.DecapsulateECIES(packet, c.PrivateKey)
+	decryptedBytes, err := crypto.DecapsulateECIES(packet, privateKey)
 	if err == nil {
-		return decryptedBytes, nil
+		return decryptedBytes, true
 	}
 
 	// Try Method B: Static SHA-256 KDF (from previous disclosure.go)
@@ -50,7 +61,7 @@ func (c *LocalKMSEscrowClient) DecryptReportPayload(ctx context.Context, encrypt
 	nonce := packet[32:44]
 	ciphertext := packet[44:]
 
-	sharedSecret, err := curve25519.X25519(c.PrivateKey, ephPub)
+	sharedSecret, err := curve25519.X25519(privateKey, ephPub)
 	if err == nil {
 		// Try SHA-256 KDF
 		hashKek := sha256.Sum256(sharedSecret)
@@ -60,7 +71,7 @@ func (c *LocalKMSEscrowClient) DecryptReportPayload(ctx context.Context, encrypt
 			if err == nil {
 				decryptedBytes, err = aesgcm.Open(nil, nonce, ciphertext, nil)
 				if err == nil {
-					return decryptedBytes, nil
+					return decryptedBytes, true
 				}
 			}
 		}
@@ -72,13 +83,12 @@ func (c *LocalKMSEscrowClient) DecryptReportPayload(ctx context.Context, encrypt
 			if err == nil {
 				decryptedBytes, err = aesgcm.Open(nil, nonce, ciphertext, nil)
 				if err == nil {
-					return decryptedBytes, nil
+					return decryptedBytes, true
 				}
 			}
 		}
 	}
-
-	return nil, errors.New("failed to decrypt report payload: cryptographic authentication failure in all standard/fallback formats")
+	return nil, false
 }
 
 // DisclosureService manages the governed report disclosure workflows.
@@ -91,13 +101,12 @@ var ActiveDisclosureService *DisclosureService
 
 func (s *DisclosureService) ensureKMSInitialized() {
 	if s.KMS == nil || len(s.PrivateKeyX25519) != 32 {
-		encKey := os.Getenv("ENCRYPTION_KEY")
-		if encKey != "" {
-			if keyBytes, err := base64.StdEncoding.DecodeString(encKey); err == nil && len(keyBytes) == 32 {
-				s.PrivateKeyX25519 = keyBytes
-				s.KMS = &LocalKMSEscrowClient{PrivateKey: keyBytes}
-				return
-			}
+		// The escrow key pair follows the encryption keyring: reports go to the active key and
+		// older keys stay able to open what was escrowed before a rotation.
+		if client, ok := keyringEscrowClient(); ok {
+			s.PrivateKeyX25519 = client.PrivateKey
+			s.KMS = client
+			return
 		}
 		
 		// If PrivateKeyX25519 is already somehow set from direct initialization, wrap it
@@ -114,6 +123,24 @@ func (s *DisclosureService) ensureKMSInitialized() {
 	}
 }
 
+// keyringEscrowClient builds an escrow client from the encryption keyring.
+func keyringEscrowClient() (*LocalKMSEscrowClient, bool) {
+	ring, err := utils.ActiveKeyring()
+	if err != nil {
+		return nil, false
+	}
+	client := &LocalKMSEscrowClient{}
+	for _, id := range ring.KeyIDs() {
+		key, _ := ring.Key(id)
+		if id == ring.ActiveKeyID() {
+			client.PrivateKey = key
+		} else {
+			client.PreviousKeys = append(client.PreviousKeys, key)
+		}
+	}
+	return client, true
+}
+
 // InitDisclosureService registers the global service with the HSM private key.
 func InitDisclosureService(kmsPrivateKey []byte) {
 	ActiveDisclosureService = &DisclosureService{
@@ -186,20 +213,18 @@ func (s *DisclosureService) DecryptReportPayload(ctx context.Context, reportID s
 		return "", fmt.Errorf("failed to retrieve report payload: %w", err)
 	}
 
-	// 2. Log Access to Append-Only PostgreSQL Audit Chain
-	_, err = database.PostgresDB.ExecContext(ctx, `
-		INSERT INTO security_audit_logs (id, event_type, target_id, actor_id, actor_role, reason, ip_address, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, uuid.New(), "GOVERNED_DISCLOSURE_DECRYPTION", reportID, moderatorID, "moderator", reason, ipAddress, time.Now().UTC())
+	// 2. Log Access to Append-Only PostgreSQL Audit Chain. Unlike other events this one is not
+	// spooled: decryption only proceeds once the access is on the chain.
+	err = database.WriteSecurityEvent(ctx, database.AuditEvent{
+		EventType:     "GOVERNED_DISCLOSURE_DECRYPTION",
+		TargetID:      reportID,
+		ActorID:       moderatorID,
+		ActorRole:     "moderator",
+		ActionDetails: reason,
+		IPAddress:     ipAddress,
+	})
 	if err != nil {
-		// Fallback to inserting without ID and actor_role if schema lacks it (just in case)
-		_, err = database.PostgresDB.ExecContext(ctx, `
-			INSERT INTO security_audit_logs (event_type, target_id, actor_id, reason, ip_address, created_at)
-			VALUES ($1, $2, $3, $4, $5, NOW())
-		`, "MODERATION_DECRYPTION_REQUEST", reportID, moderatorID, "Justification: "+reason, ipAddress)
-		if err != nil {
-			return "", fmt.Errorf("audit logging failed; decryption aborted: %w", err)
-		}
+		return "", fmt.Errorf("audit logging failed; decryption aborted: %w", err)
 	}
 
 	// 3. Request KMS / HSM private key decryption of ECIES disclosure envelope
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+)
+
+// MaxICalHolidays caps how many holiday dates a single calendar import may add.
+const MaxICalHolidays = 1000
+
+var ErrICalInvalid = errors.New("not a valid iCalendar file")
+
+// ICalEvent is a VEVENT of an iCalendar (RFC 5545) file. For all-day events End is
+// exclusive, as in the file. Recurrence rules are not expanded. The fields after Transparent
+// are only written by WriteICalendar, never parsed.
+type ICalEvent struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+	// Status is CONFIRMED (the default), TENTATIVE or CANCELLED
+	Status string
+	// Transparent events do not block time (TRANSP:TRANSPARENT)
+	Transparent bool
+
+	Description string
+	Location    string
+	URL         string
+	Sequence    int
+	Organizer   *ICalAttendee
+	Attendees   []ICalAttendee
+}
+
+// ParseICalEvents reads the VEVENTs of an iCalendar file. Floating times are read in loc.
+func ParseICalEvents(r io.Reader, loc *time.Location) ([]ICalEvent, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// Folded lines continue with a leading space or tab
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, ErrICalInvalid
+	}
+
+	var events []ICalEvent
+	var cur *ICalEvent
+	for _, line := range lines {
+		name, params, value, ok := splitICalLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			cur = &ICalEvent{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if cur != nil && !cur.Start.IsZero() {
+				if cur.End.IsZero() {
+					if cur.AllDay {
+						cur.End = cur.Start.AddDate(0, 0, 1)
+					} else {
+						cur.End = cur.Start
+					}
+				}
+				events = append(events, *cur)
+			}
+			cur = nil
+		case cur == nil:
+		case name == "UID":
+			cur.UID = value
+		case name == "SUMMARY":
+			cur.Summary = unescapeICalText(value)
+		case name == "STATUS":
+			cur.Status = strings.ToUpper(value)
+		case name == "TRANSP":
+			cur.Transparent = strings.EqualFold(value, "TRANSPARENT")
+		case name == "DTSTART", name == "DTEND":
+			t, allDay, err := parseICalTime(value, params, loc)
+			if err != nil {
+				return nil, err
+			}
+			if name == "DTSTART" {
+				cur.Start, cur.AllDay = t, allDay
+			} else {
+				cur.End = t
+			}
+		}
+	}
+	return events, nil
+}
+
+// splitICalLine splits NAME;PARAM=V;...:VALUE, ignoring colons inside quoted parameters.
+func splitICalLine(line string) (name string, params map[string]string, value string, ok bool) {
+	inQuote := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		} else if c == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params = map[string]string{}
+	for _, p := range parts[1:] {
+		if k, v, found := strings.Cut(p, "="); found {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+func parseICalTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if strings.EqualFold(params["VALUE"], "DATE") || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+func unescapeICalText(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// HolidaysFromICal turns calendar events into tenant holidays, one per local date each event
+// covers: all-day events up to their exclusive end, timed events on the date they start.
+func HolidaysFromICal(events []ICalEvent, loc *time.Location) ([]models.TenantHoliday, error) {
+	var holidays []models.TenantHoliday
+	for _, ev := range events {
+		name := strings.TrimSpace(ev.Summary)
+		if !ev.AllDay {
+			holidays = append(holidays, models.TenantHoliday{
+				Date: ev.Start.In(loc).Format("2006-01-02"), Name: name, Source: "ical",
+			})
+		} else {
+			for d := ev.Start; d.Before(ev.End); d = d.AddDate(0, 0, 1) {
+				holidays = append(holidays, models.TenantHoliday{
+					Date: d.Format("2006-01-02"), Name: name, Source: "ical",
+				})
+				if len(holidays) > MaxICalHolidays {
+					break
+				}
+			}
+		}
+		if len(holidays) > MaxICalHolidays {
+			return nil, errors.New("calendar has too many holiday dates")
+		}
+	}
+	return holidays, nil
+}
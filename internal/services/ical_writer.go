@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar METHOD values used for invites (RFC 5546). Subscription feeds have no method.
+const (
+	ICalMethodRequest = "REQUEST"
+	ICalMethodCancel  = "CANCEL"
+)
+
+const (
+	icalProdID = "-//Serenify//Appointments//EN"
+	// icalLineLimit is the longest content line in octets, excluding the CRLF
+	icalLineLimit = 75
+)
+
+// ICalAttendee is an ORGANIZER or ATTENDEE of an event.
+type ICalAttendee struct {
+	Name  string
+	Email string
+}
+
+// ICalendar is a calendar to be written with WriteICalendar.
+type ICalendar struct {
+	// Name is shown by calendar apps for subscribed feeds (X-WR-CALNAME)
+	Name   string
+	Method string
+	Events []ICalEvent
+}
+
+// WriteICalendar writes cal as an RFC 5545 file with CRLF line endings and folded lines.
+// Times are written in UTC.
+func WriteICalendar(w io.Writer, cal ICalendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) { writeICalLine(bw, s) }
+
+	stamp := icalUTC(time.Now())
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + icalProdID)
+	line("CALSCALE:GREGORIAN")
+	if cal.Method != "" {
+		line("METHOD:" + cal.Method)
+	}
+	if cal.Name != "" {
+		line("X-WR-CALNAME:" + escapeICalText(cal.Name))
+	}
+	for _, e := range cal.Events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeICalText(e.UID))
+		line("DTSTAMP:" + stamp)
+		line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + e.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + icalUTC(e.Start))
+			line("DTEND:" + icalUTC(e.End))
+		}
+		line("SUMMARY:" + escapeICalText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:" + escapeICalText(e.Location))
+		}
+		if e.URL != "" {
+			line("URL:" + e.URL)
+		}
+		status := e.Status
+		if status == "" {
+			status = "CONFIRMED"
+		}
+		line("STATUS:" + status)
+		if e.Transparent {
+			line("TRANSP:TRANSPARENT")
+		}
+		if e.Organizer != nil && e.Organizer.Email != "" {
+			line("ORGANIZER" + icalNameParam(e.Organizer.Name) + ":mailto:" + e.Organizer.Email)
+		}
+		for _, a := range e.Attendees {
+			if a.Email == "" {
+				continue
+			}
+			line("ATTENDEE" + icalNameParam(a.Name) + ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:" + a.Email)
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// writeICalLine folds s into lines of at most icalLineLimit octets without splitting a UTF-8
+// sequence; continuation lines start with a space.
+func writeICalLine(w *bufio.Writer, s string) {
+	limit := icalLineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space counts towards the next line's length
+		limit = icalLineLimit - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// escapeICalText escapes a TEXT value; the inverse of unescapeICalText.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// icalNameParam renders a CN parameter. Parameter values cannot contain DQUOTE or control
+// characters, and are quoted so commas, colons and semicolons survive.
+func icalNameParam(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + name + `"`
+}
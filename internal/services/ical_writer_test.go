@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWriteICalendarFoldsAndEscapes(t *testing.T) {
+	start := time.Date(2026, 3, 2, 4, 30, 0, 0, time.UTC)
+	e := appointmentEventSource{
+		ID: uuid.MustParse("6f1c2b1e-8d4a-4c1e-9a55-2f1d3e4b5c6d"), StartsAt: start, EndsAt: start.Add(50 * time.Minute),
+		PatientName: "Asha, R.", TherapistName: "Dr. Mehta; MD", TherapistEmail: "mehta@example.com",
+		PracticeName: strings.Repeat("Calm Minds Clinic ", 6), Sequence: 2,
+	}.event(CalendarFeedPatient)
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, ICalendar{Method: ICalMethodRequest, Events: []ICalEvent{e}}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > icalLineLimit {
+			t.Fatalf("line longer than %d octets: %q", icalLineLimit, line)
+		}
+	}
+	for _, want := range []string{
+		"METHOD:REQUEST\r\n",
+		"UID:6f1c2b1e-8d4a-4c1e-9a55-2f1d3e4b5c6d@serenify\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20260302T043000Z\r\n",
+		"SUMMARY:Therapy session with Dr. Mehta\\; MD\r\n",
+		`ATTENDEE;CN="Dr. Mehta; MD";ROLE=REQ-PARTICIPANT`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in\n%s", want, out)
+		}
+	}
+	// The patient has no email, so only the practitioner is invited
+	if strings.Count(out, "ATTENDEE") != 1 {
+		t.Fatalf("unexpected attendees in\n%s", out)
+	}
+
+	events, err := ParseICalEvents(strings.NewReader(out), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != e.Summary || !events[0].Start.Equal(start) {
+		t.Fatalf("round trip mismatch %+v", events)
+	}
+}
+
+func TestWriteICalLineKeepsMultibyteRunes(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeICalLine(w, "SUMMARY:"+strings.Repeat("é", 60))
+	w.Flush()
+	unfolded := strings.ReplaceAll(buf.String(), "\r\n ", "")
+	if unfolded != "SUMMARY:"+strings.Repeat("é", 60)+"\r\n" {
+		t.Fatalf("folding split a rune: %q", buf.String())
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// DefaultInvoiceNumberFormat renders e.g. INV/2026-27/00042.
+const DefaultInvoiceNumberFormat = "{prefix}/{fy}/{seq:05}"
+
+// maxInvoiceNumberLen matches invoices.invoice_number VARCHAR(50).
+const maxInvoiceNumberLen = 50
+
+var invoiceNumberToken = regexp.MustCompile(`\{([a-z_]+)(?::(\d{1,2}))?\}`)
+
+// FinancialYearStart returns the calendar year in which the Indian financial year (April-March)
+// containing t began.
+func FinancialYearStart(t time.Time) int {
+	if t.Month() < time.April {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// ValidateInvoiceNumberFormat checks that format only uses known tokens and contains both the
+// sequence and the financial year, so numbers cannot repeat across years.
+func ValidateInvoiceNumberFormat(format string) error {
+	if format == "" {
+		return errors.New("invoice number format is empty")
+	}
+	var hasSeq, hasFY bool
+	for _, m := range invoiceNumberToken.FindAllStringSubmatch(format, -1) {
+		switch m[1] {
+		case "seq":
+			hasSeq = true
+		case "fy", "fy_short", "fy_start":
+			hasFY = true
+		case "prefix":
+		default:
+			return fmt.Errorf("unknown token {%s} in invoice number format", m[1])
+		}
+	}
+	if !hasSeq {
+		return errors.New("invoice number format must contain {seq}")
+	}
+	if !hasFY {
+		return errors.New("invoice number format must contain {fy}, {fy_short} or {fy_start}")
+	}
+	if n, _ := FormatInvoiceNumber(format, "INV", 2026, 1); strings.ContainsAny(n, "{}") {
+		return errors.New("invoice number format has unbalanced braces")
+	}
+	return nil
+}
+
+// FormatInvoiceNumber expands format. Tokens: {prefix}, {fy} (2026-27), {fy_short} (26-27),
+// {fy_start} (2026) and {seq} or {seq:NN} (zero-padded to NN digits).
+func FormatInvoiceNumber(format, prefix string, fyStart int, seq int64) (string, error) {
+	out := invoiceNumberToken.ReplaceAllStringFunc(format, func(tok string) string {
+		m := invoiceNumberToken.FindStringSubmatch(tok)
+		switch m[1] {
+		case "prefix":
+			return prefix
+		case "fy":
+			return fmt.Sprintf("%d-%02d", fyStart, (fyStart+1)%100)
+		case "fy_short":
+			return fmt.Sprintf("%02d-%02d", fyStart%100, (fyStart+1)%100)
+		case "fy_start":
+			return strconv.Itoa(fyStart)
+		case "seq":
+			width, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%0*d", width, seq)
+		}
+		return tok
+	})
+	if len(out) > maxInvoiceNumberLen {
+		return "", fmt.Errorf("invoice number %q is longer than %d characters", out, maxInvoiceNumberLen)
+	}
+	return out, nil
+}
+
+// AssignInvoiceNumber gives the invoice the next number in its tenant's financial-year sequence,
+// unless it already has one, and returns the number. It must run inside the transaction that
+// issues the invoice: the sequence row stays locked until commit and a rollback releases the
+// number again, so the series has no gaps and concurrent issuers cannot collide.
+func AssignInvoiceNumber(tx *sql.Tx, tenantID, invoiceID uuid.UUID) (string, error) {
+	var current sql.NullString
+	err := tx.QueryRow(`
+		SELECT invoice_number FROM invoices WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+	`, invoiceID, tenantID).Scan(&current)
+	if err != nil {
+		return "", err
+	}
+	if current.Valid && current.String != "" {
+		return current.String, nil
+	}
+
+	profile, err := loadBillingProfile(tx, tenantID)
+	if err != nil {
+		return "", err
+	}
+	number, err := nextDocumentNumber(tx, tenantID, "invoice", profile.InvoiceNumberFormat, profile.InvoicePrefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE invoices SET invoice_number = $3, issued_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+	`, invoiceID, tenantID, number)
+	if err != nil {
+		return "", err
+	}
+	return number, nil
+}
+
+// documentNumberColumns maps a sequence series to the table and column holding its numbers.
+var documentNumberColumns = map[string][2]string{
+	"invoice":     {"invoices", "invoice_number"},
+	"credit_note": {"credit_notes", "credit_note_number"},
+}
+
+// nextDocumentNumber takes the next value of the tenant's financial-year sequence for series
+// (invoice, credit_note) and formats it. The caller's transaction holds the sequence row.
+func nextDocumentNumber(tx *sql.Tx, tenantID uuid.UUID, series, format, prefix string) (string, error) {
+	fy := FinancialYearStart(time.Now().In(TenantLocation(tenantID)))
+	var seq int64
+	err := tx.QueryRow(`
+		UPDATE invoice_sequences SET last_value = last_value + 1, updated_at = NOW()
+		WHERE tenant_id = $1 AND series = $2 AND fiscal_year = $3
+		RETURNING last_value
+	`, tenantID, series, fy).Scan(&seq)
+	if err == sql.ErrNoRows {
+		// First number of the year: start after any number already issued in this shape, e.g.
+		// INV-2026-0042 from before the sequence existed, so the new series cannot repeat it.
+		var floor int64
+		floor, err = highestDocumentSequence(tx, tenantID, series, format, prefix, fy)
+		if err != nil {
+			return "", err
+		}
+		err = tx.QueryRow(`
+			INSERT INTO invoice_sequences (tenant_id, series, fiscal_year, last_value) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (tenant_id, series, fiscal_year) DO UPDATE
+				SET last_value = invoice_sequences.last_value + 1, updated_at = NOW()
+			RETURNING last_value
+		`, tenantID, series, fy, floor+1).Scan(&seq)
+	}
+	if err != nil {
+		return "", err
+	}
+	return FormatInvoiceNumber(format, prefix, fy, seq)
+}
+
+// highestDocumentSequence returns the largest {seq} among the tenant's existing numbers of series
+// that format renders for financial year fy, or 0 when there are none.
+func highestDocumentSequence(tx *sql.Tx, tenantID uuid.UUID, series, format, prefix string, fy int) (int64, error) {
+	cols, ok := documentNumberColumns[series]
+	if !ok {
+		return 0, fmt.Errorf("unknown document series %q", series)
+	}
+	var highest int64
+	err := tx.QueryRow(`
+		SELECT COALESCE(MAX(substring(`+cols[1]+` FROM $2)::BIGINT), 0)
+		FROM `+cols[0]+`
+		WHERE tenant_id = $1 AND `+cols[1]+` ~ $2
+	`, tenantID, documentNumberPattern(format, prefix, fy)).Scan(&highest)
+	return highest, err
+}
+
+// documentNumberPattern is a regular expression matching every number format renders for
+// financial year fy, with the first {seq} as its only capture group.
+func documentNumberPattern(format, prefix string, fy int) string {
+	var b strings.Builder
+	b.WriteString("^")
+	captured := false
+	last := 0
+	for _, loc := range invoiceNumberToken.FindAllStringSubmatchIndex(format, -1) {
+		b.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		last = loc[1]
+		if format[loc[2]:loc[3]] != "seq" {
+			tok, _ := FormatInvoiceNumber(format[loc[0]:loc[1]], prefix, fy, 0)
+			b.WriteString(regexp.QuoteMeta(tok))
+			continue
+		}
+		if captured {
+			b.WriteString(`[0-9]+`)
+			continue
+		}
+		b.WriteString(`([0-9]{1,18})`)
+		captured = true
+	}
+	b.WriteString(regexp.QuoteMeta(format[last:]))
+	b.WriteString("$")
+	return b.String()
+}
+
+// IssueInvoice numbers a draft invoice and moves it to 'sent'. Invoices that were already issued
+// keep their number and status.
+func IssueInvoice(tenantID, invoiceID uuid.UUID) (string, error) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	number, err := AssignInvoiceNumber(tx, tenantID, invoiceID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE invoices SET status = 'sent', updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND status = 'draft'
+	`, invoiceID, tenantID)
+	if err != nil {
+		return "", err
+	}
+	return number, tx.Commit()
+}
@@ -2,47 +2,486 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/models"
 )
 
 type InvoicePDFUploader interface {
-	UploadString(ctx context.Context, content, folder, filename string) (string, error)
+	UploadBytes(ctx context.Context, content []byte, folder, filename string) (string, error)
 }
 
-func BuildInvoiceHTML(inv models.Invoice, patientName, tenantName string) string {
-	var rows strings.Builder
-	for _, li := range inv.LineItems {
-		rows.WriteString(fmt.Sprintf("<tr><td>%s</td><td align='right'>%.2f</td></tr>",
-			li.Description, li.Amount))
+// GSTStateNames maps GST state codes (the first two digits of a GSTIN) to state names.
+var GSTStateNames = map[string]string{
+	"01": "Jammu and Kashmir", "02": "Himachal Pradesh", "03": "Punjab", "04": "Chandigarh",
+	"05": "Uttarakhand", "06": "Haryana", "07": "Delhi", "08": "Rajasthan", "09": "Uttar Pradesh",
+	"10": "Bihar", "11": "Sikkim", "12": "Arunachal Pradesh", "13": "Nagaland", "14": "Manipur",
+	"15": "Mizoram", "16": "Tripura", "17": "Meghalaya", "18": "Assam", "19": "West Bengal",
+	"20": "Jharkhand", "21": "Odisha", "22": "Chhattisgarh", "23": "Madhya Pradesh", "24": "Gujarat",
+	"26": "Dadra and Nagar Haveli and Daman and Diu", "27": "Maharashtra", "29": "Karnataka",
+	"30": "Goa", "31": "Lakshadweep", "32": "Kerala", "33": "Tamil Nadu", "34": "Puducherry",
+	"35": "Andaman and Nicobar Islands", "36": "Telangana", "37": "Andhra Pradesh", "38": "Ladakh",
+	"97": "Other Territory",
+}
+
+// GSTINStateCode returns the state code embedded in a GSTIN, or "" if it has none.
+func GSTINStateCode(gstin string) string {
+	gstin = strings.TrimSpace(gstin)
+	if len(gstin) < 2 {
+		return ""
+	}
+	if _, ok := GSTStateNames[gstin[:2]]; !ok {
+		return ""
+	}
+	return gstin[:2]
+}
+
+// GSTBreakdown splits an invoice's GST into CGST + SGST (intra-state) or IGST (inter-state).
+type GSTBreakdown struct {
+	TaxableValue float64 `json:"taxable_value"`
+	Rate         float64 `json:"rate"`
+	CGST         float64 `json:"cgst"`
+	SGST         float64 `json:"sgst"`
+	IGST         float64 `json:"igst"`
+	InterState   bool    `json:"inter_state"`
+}
+
+// SplitGST divides gstAmount between central and state tax. The supply is inter-state when
+// both state codes are known and differ.
+func SplitGST(subtotal, gstAmount float64, supplierState, placeOfSupply string) GSTBreakdown {
+	b := GSTBreakdown{TaxableValue: subtotal}
+	if subtotal > 0 {
+		b.Rate = math.Round(gstAmount/subtotal*10000) / 100
+	}
+	b.InterState = supplierState != "" && placeOfSupply != "" && supplierState != placeOfSupply
+	if b.InterState {
+		b.IGST = gstAmount
+		return b
+	}
+	b.CGST = math.Round(gstAmount*100/2) / 100
+	b.SGST = math.Round((gstAmount-b.CGST)*100) / 100
+	return b
+}
+
+// InvoiceParty is the seller or buyer block printed on an invoice.
+type InvoiceParty struct {
+	Name      string `json:"name"`
+	Address   string `json:"address,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	GSTIN     string `json:"gstin,omitempty"`
+	StateCode string `json:"state_code,omitempty"`
+}
+
+// InvoiceDocument is everything printed on an invoice PDF. Its hash identifies the document:
+// regenerating an unchanged invoice yields the same hash and the same bytes.
+type InvoiceDocument struct {
+	Title         string                `json:"title"`
+	Number        string                `json:"number"`
+	IssuedOn      string                `json:"issued_on"`
+	DueOn         string                `json:"due_on,omitempty"`
+	PaidOn        string                `json:"paid_on,omitempty"`
+	Status        string                `json:"status"`
+	Currency      string                `json:"currency"`
+	Seller        InvoiceParty          `json:"seller"`
+	Buyer         InvoiceParty          `json:"buyer"`
+	PlaceOfSupply string                `json:"place_of_supply,omitempty"`
+	LineItems     []InvoiceDocumentLine `json:"line_items"`
+	Tax           GSTBreakdown          `json:"tax"`
+	Total         float64               `json:"total"`
+	AmountInWords string                `json:"amount_in_words"`
+	Notes         string                `json:"notes,omitempty"`
+	Reference     string                `json:"reference,omitempty"` // original invoice of a credit note
+	created       time.Time
+}
+
+type InvoiceDocumentLine struct {
+	Description string  `json:"description"`
+	SACCode     string  `json:"sac_code"`
+	Amount      float64 `json:"amount"`
+}
+
+// BuildInvoiceDocument assembles the printable invoice. Dates are rendered in loc.
+func BuildInvoiceDocument(inv models.Invoice, profile models.BillingProfile, seller, buyer InvoiceParty, loc *time.Location) InvoiceDocument {
+	if loc == nil {
+		loc = time.UTC
+	}
+	seller.GSTIN = profile.GSTNumber
+	seller.StateCode = profile.StateCode
+	if seller.Address == "" {
+		seller.Address = profile.BusinessAddress
+	}
+	placeOfSupply := inv.PlaceOfSupply
+	if placeOfSupply == "" {
+		placeOfSupply = seller.StateCode
+	}
+
+	issued := inv.CreatedAt
+	if inv.IssuedAt != nil {
+		issued = *inv.IssuedAt
+	}
+	doc := InvoiceDocument{
+		Title:         "TAX INVOICE",
+		Number:        inv.InvoiceNumber,
+		IssuedOn:      issued.In(loc).Format("02 Jan 2006"),
+		Status:        inv.Status,
+		Currency:      inv.Currency,
+		Seller:        seller,
+		Buyer:         buyer,
+		PlaceOfSupply: placeOfSupply,
+		Tax:           SplitGST(inv.Subtotal, inv.GSTAmount, seller.StateCode, placeOfSupply),
+		Total:         inv.Total,
+		AmountInWords: AmountInWords(inv.Total, inv.Currency),
+		Notes:         inv.Notes,
+		created:       inv.CreatedAt,
+	}
+	if doc.Seller.GSTIN == "" {
+		doc.Title = "INVOICE"
+	}
+	if doc.Number == "" {
+		// Drafts are numbered when issued.
+		doc.Title = "DRAFT " + doc.Title
+		doc.Number = "DRAFT"
 	}
-	due := ""
 	if inv.DueAt != nil {
-		due = inv.DueAt.Format("2006-01-02")
-	}
-	return fmt.Sprintf(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>%s</title>
-<style>body{font-family:sans-serif;padding:40px}table{width:100%%;border-collapse:collapse}td,th{padding:8px;border-bottom:1px solid #ddd}</style>
-</head><body>
-<h1>Tax Invoice</h1>
-<p><strong>%s</strong></p>
-<p>Invoice: %s<br>Patient: %s<br>Date: %s<br>Due: %s</p>
-<table><tr><th>Description</th><th>Amount (%s)</th></tr>%s</table>
-<p>Subtotal: %.2f<br>GST: %.2f<br><strong>Total: %.2f</strong></p>
-<p>Status: %s</p>
-</body></html>`,
-		inv.InvoiceNumber, tenantName, inv.InvoiceNumber, patientName,
-		inv.CreatedAt.Format("2006-01-02"), due, inv.Currency, rows.String(),
-		inv.Subtotal, inv.GSTAmount, inv.Total, inv.Status)
-}
-
-func UploadInvoicePDF(ctx context.Context, uploader InvoicePDFUploader, tenantID string, inv models.Invoice, patientName, tenantName string) (string, error) {
+		doc.DueOn = inv.DueAt.In(loc).Format("02 Jan 2006")
+	}
+	if inv.PaidAt != nil {
+		doc.PaidOn = inv.PaidAt.In(loc).Format("02 Jan 2006")
+	}
+	for _, li := range inv.LineItems {
+		sac := li.SACCode
+		if sac == "" {
+			sac = profile.SACCode
+		}
+		doc.LineItems = append(doc.LineItems, InvoiceDocumentLine{Description: li.Description, SACCode: sac, Amount: li.Amount})
+	}
+	return doc
+}
+
+// BuildCreditNoteDocument assembles the credit note issued against inv for a refund.
+func BuildCreditNoteDocument(cn models.CreditNote, inv models.Invoice, profile models.BillingProfile, seller, buyer InvoiceParty, loc *time.Location) InvoiceDocument {
+	if loc == nil {
+		loc = time.UTC
+	}
+	doc := BuildInvoiceDocument(inv, profile, seller, buyer, loc)
+	doc.Title = "CREDIT NOTE"
+	doc.Number = cn.CreditNoteNumber
+	doc.Reference = inv.InvoiceNumber
+	doc.IssuedOn = cn.IssuedAt.In(loc).Format("02 Jan 2006")
+	doc.DueOn, doc.PaidOn, doc.Status = "", "", "refunded"
+	doc.Tax = SplitGST(cn.Subtotal, cn.GSTAmount, doc.Seller.StateCode, doc.PlaceOfSupply)
+	doc.Total = cn.Total
+	doc.AmountInWords = AmountInWords(cn.Total, cn.Currency)
+	doc.Notes = cn.Reason
+	doc.created = cn.IssuedAt
+
+	desc := "Refund against invoice " + inv.InvoiceNumber
+	sac := profile.SACCode
+	if len(doc.LineItems) == 1 {
+		desc = "Refund: " + doc.LineItems[0].Description
+		sac = doc.LineItems[0].SACCode
+	}
+	doc.LineItems = []InvoiceDocumentLine{{Description: desc, SACCode: sac, Amount: cn.Subtotal}}
+	return doc
+}
+
+// Hash is the hex SHA-256 of the document's canonical JSON form.
+func (d InvoiceDocument) Hash() string {
+	b, _ := json.Marshal(d)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// RenderInvoicePDF lays out the document on A4 pages.
+func RenderInvoicePDF(d InvoiceDocument) []byte {
+	const (
+		left   = 40.0
+		right  = pdfPageWidth - 40
+		bottom = pdfPageHeight - 60
+	)
+	hash := d.Hash()
+	w := newPDFWriter()
+	w.Title = d.Title + " " + d.Number
+	w.Created = d.created
+	w.ID = hash[:32]
+
+	// Header: seller on the left, document title and number on the right.
+	y := 60.0
+	w.Text(left, y, 16, true, d.Seller.Name)
+	w.TextRight(right, y, 18, true, d.Title)
+	y += 18
+	for _, line := range pdfWrap(d.Seller.Address, 9, false, 280) {
+		if line != "" {
+			w.Text(left, y, 9, false, line)
+			y += 12
+		}
+	}
+	if d.Seller.GSTIN != "" {
+		w.Text(left, y, 9, true, "GSTIN: "+d.Seller.GSTIN)
+		y += 12
+	}
+	if name, ok := GSTStateNames[d.Seller.StateCode]; ok {
+		w.Text(left, y, 9, false, fmt.Sprintf("State: %s (%s)", name, d.Seller.StateCode))
+		y += 12
+	}
+
+	ry := 78.0
+	meta := [][2]string{{"Invoice No.", d.Number}, {"Date", d.IssuedOn}}
+	if d.Reference != "" {
+		meta = [][2]string{{"Credit Note No.", d.Number}, {"Date", d.IssuedOn}, {"Against invoice", d.Reference}}
+	}
+	if d.DueOn != "" {
+		meta = append(meta, [2]string{"Due", d.DueOn})
+	}
+	if d.PlaceOfSupply != "" {
+		pos := d.PlaceOfSupply
+		if name, ok := GSTStateNames[pos]; ok {
+			pos = name + " (" + pos + ")"
+		}
+		meta = append(meta, [2]string{"Place of supply", pos})
+	}
+	for _, m := range meta {
+		w.TextRight(right-150, ry, 9, true, m[0]+":")
+		w.Text(right-145, ry, 9, false, m[1])
+		ry += 12
+	}
+	y = math.Max(y, ry) + 14
+
+	// Bill to
+	w.Line(left, y, right, y, 0.5)
+	y += 16
+	w.Text(left, y, 9, true, "BILL TO")
+	y += 14
+	w.Text(left, y, 11, true, d.Buyer.Name)
+	y += 13
+	for _, line := range append(pdfWrap(d.Buyer.Address, 9, false, 300), d.Buyer.Email, d.Buyer.Phone) {
+		if line != "" {
+			w.Text(left, y, 9, false, line)
+			y += 12
+		}
+	}
+	y += 10
+
+	// Line items
+	colSAC, colAmount := right-170.0, right-6
+	tableHeader := func() {
+		w.FillRect(left, y, right-left, 20, 0.92)
+		w.Text(left+6, y+14, 9, true, "#")
+		w.Text(left+26, y+14, 9, true, "Description")
+		w.Text(colSAC, y+14, 9, true, "HSN/SAC")
+		w.TextRight(colAmount, y+14, 9, true, "Amount ("+d.Currency+")")
+		y += 34
+	}
+	tableHeader()
+	for i, li := range d.LineItems {
+		lines := pdfWrap(li.Description, 9, false, colSAC-left-36)
+		if y+float64(len(lines))*12 > bottom {
+			w.AddPage()
+			y = 60
+			tableHeader()
+		}
+		w.Text(left+6, y, 9, false, strconv.Itoa(i+1))
+		w.Text(colSAC, y, 9, false, li.SACCode)
+		w.TextRight(colAmount, y, 9, false, formatIndianAmount(li.Amount))
+		for _, line := range lines {
+			w.Text(left+26, y, 9, false, line)
+			y += 12
+		}
+		y += 6
+	}
+	w.Line(left, y-6, right, y-6, 0.5)
+
+	// Totals
+	if y+120 > bottom {
+		w.AddPage()
+		y = 60
+	}
+	y += 10
+	totals := [][2]string{{"Taxable value", formatIndianAmount(d.Tax.TaxableValue)}}
+	rate := strconv.FormatFloat(d.Tax.Rate, 'f', -1, 64)
+	half := strconv.FormatFloat(d.Tax.Rate/2, 'f', -1, 64)
+	if d.Tax.InterState {
+		totals = append(totals, [2]string{"IGST @ " + rate + "%", formatIndianAmount(d.Tax.IGST)})
+	} else {
+		totals = append(totals,
+			[2]string{"CGST @ " + half + "%", formatIndianAmount(d.Tax.CGST)},
+			[2]string{"SGST @ " + half + "%", formatIndianAmount(d.Tax.SGST)})
+	}
+	for _, t := range totals {
+		w.TextRight(colAmount-110, y, 9, false, t[0])
+		w.TextRight(colAmount, y, 9, false, t[1])
+		y += 14
+	}
+	w.Line(colAmount-200, y-8, right, y-8, 0.5)
+	y += 4
+	w.TextRight(colAmount-110, y, 11, true, "Total")
+	w.TextRight(colAmount, y, 11, true, d.Currency+" "+formatIndianAmount(d.Total))
+	y += 24
+
+	w.Text(left, y, 9, true, "Amount in words:")
+	y += 12
+	for _, line := range pdfWrap(d.AmountInWords, 9, false, right-left) {
+		w.Text(left, y, 9, false, line)
+		y += 12
+	}
+	y += 8
+
+	status := "Payment status: " + strings.ToUpper(d.Status)
+	switch {
+	case d.PaidOn != "":
+		status = "Payment status: PAID on " + d.PaidOn
+	case d.DueOn != "" && d.Status != "cancelled" && d.Status != "void":
+		status += " (due " + d.DueOn + ")"
+	}
+	if d.Reference == "" {
+		w.Text(left, y, 10, true, status)
+		y += 20
+	}
+
+	if d.Notes != "" {
+		w.Text(left, y, 9, true, "Notes")
+		y += 12
+		for _, line := range pdfWrap(d.Notes, 9, false, right-left) {
+			if y > bottom {
+				break
+			}
+			w.Text(left, y, 9, false, line)
+			y += 12
+		}
+	}
+
+	footer := pdfPageHeight - 30
+	w.Line(left, footer-14, right, footer-14, 0.3)
+	w.Text(left, footer, 7, false, "This is a computer-generated document and does not require a signature.")
+	w.TextRight(right, footer, 7, false, "Document hash (SHA-256): "+hash)
+	return w.Bytes()
+}
+
+// AmountInWords spells out an amount, using the Indian numbering system (lakh, crore) for INR.
+func AmountInWords(amount float64, currency string) string {
+	paise := int64(math.Round(math.Abs(amount) * 100))
+	whole, fraction := paise/100, paise%100
+
+	unit, subunit := currency, "Cents"
+	spell := spellInternational
+	if currency == "" || currency == "INR" {
+		unit, subunit = "Rupees", "Paise"
+		spell = spellIndian
+	}
+
+	out := unit + " " + spell(whole)
+	if fraction > 0 {
+		out += " and " + subunit + " " + spell(fraction)
+	}
+	return out + " Only"
+}
+
+var (
+	wordsOnes = []string{"Zero", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten",
+		"Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	wordsTens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+// spellBelowThousand spells 0 < n < 1000.
+func spellBelowThousand(n int64) string {
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, wordsOnes[n/100], "Hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20:
+		if n%10 == 0 {
+			parts = append(parts, wordsTens[n/10])
+		} else {
+			parts = append(parts, wordsTens[n/10]+"-"+wordsOnes[n%10])
+		}
+	case n > 0:
+		parts = append(parts, wordsOnes[n])
+	}
+	return strings.Join(parts, " ")
+}
+
+func spellIndian(n int64) string {
+	if n == 0 {
+		return "Zero"
+	}
+	var parts []string
+	if n >= 10000000 {
+		parts = append(parts, spellIndian(n/10000000), "Crore")
+		n %= 10000000
+	}
+	for _, g := range []struct {
+		size int64
+		name string
+	}{{100000, "Lakh"}, {1000, "Thousand"}} {
+		if n >= g.size {
+			parts = append(parts, spellBelowThousand(n/g.size), g.name)
+			n %= g.size
+		}
+	}
+	if n > 0 {
+		parts = append(parts, spellBelowThousand(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func spellInternational(n int64) string {
+	if n == 0 {
+		return "Zero"
+	}
+	var parts []string
+	for _, g := range []struct {
+		size int64
+		name string
+	}{{1000000000, "Billion"}, {1000000, "Million"}, {1000, "Thousand"}} {
+		if n >= g.size {
+			parts = append(parts, spellInternational(n/g.size), g.name)
+			n %= g.size
+		}
+	}
+	if n > 0 {
+		parts = append(parts, spellBelowThousand(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatIndianAmount formats with two decimals and Indian digit grouping (12,34,567.89).
+func formatIndianAmount(v float64) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+	intPart, frac := s[:len(s)-3], s[len(s)-3:]
+	if len(intPart) > 3 {
+		head, tail := intPart[:len(intPart)-3], intPart[len(intPart)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		if head != "" {
+			groups = append([]string{head}, groups...)
+		}
+		intPart = strings.Join(groups, ",") + "," + tail
+	}
+	if v < 0 {
+		return "-" + intPart + frac
+	}
+	return intPart + frac
+}
+
+// UploadInvoicePDF stores a rendered PDF and returns its URL.
+func UploadInvoicePDF(ctx context.Context, uploader InvoicePDFUploader, tenantID string, invoiceNumber string, pdf []byte) (string, error) {
 	if uploader == nil {
 		return "", fmt.Errorf("cloudinary not configured")
 	}
-	html := BuildInvoiceHTML(inv, patientName, tenantName)
 	folder := fmt.Sprintf("invoices/%s", tenantID)
-	filename := strings.ReplaceAll(inv.InvoiceNumber, "/", "-")
-	return uploader.UploadString(ctx, html, folder, filename)
+	filename := strings.ReplaceAll(invoiceNumber, "/", "-") + ".pdf"
+	return uploader.UploadBytes(ctx, pdf, folder, filename)
 }
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+)
+
+func TestAmountInWords(t *testing.T) {
+	cases := map[float64]string{
+		1180:      "Rupees One Thousand One Hundred Eighty Only",
+		1250000.5: "Rupees Twelve Lakh Fifty Thousand and Paise Fifty Only",
+		30000021:  "Rupees Three Crore Twenty-One Only",
+		0:         "Rupees Zero Only",
+	}
+	for amount, want := range cases {
+		if got := AmountInWords(amount, "INR"); got != want {
+			t.Errorf("%v: got %q, want %q", amount, got, want)
+		}
+	}
+	if got := AmountInWords(2500000, "USD"); got != "USD Two Million Five Hundred Thousand Only" {
+		t.Errorf("USD: got %q", got)
+	}
+}
+
+func TestSplitGST(t *testing.T) {
+	b := SplitGST(1000, 180, "29", "29")
+	if b.InterState || b.CGST != 90 || b.SGST != 90 || b.Rate != 18 {
+		t.Fatalf("intra-state: %+v", b)
+	}
+	b = SplitGST(1000, 180, "29", "27")
+	if !b.InterState || b.IGST != 180 || b.CGST != 0 {
+		t.Fatalf("inter-state: %+v", b)
+	}
+	b = SplitGST(999.99, 180.01, "", "")
+	if b.CGST+b.SGST != 180.01 {
+		t.Fatalf("odd paise lost: %+v", b)
+	}
+}
+
+func TestFormatIndianAmount(t *testing.T) {
+	cases := map[float64]string{12.5: "12.50", 1180: "1,180.00", 1234567.891: "12,34,567.89"}
+	for v, want := range cases {
+		if got := formatIndianAmount(v); got != want {
+			t.Errorf("%v: got %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestRenderInvoicePDFIsDeterministic(t *testing.T) {
+	created := time.Date(2026, 4, 1, 6, 30, 0, 0, time.UTC)
+	inv := models.Invoice{
+		InvoiceNumber: "INV-2026-0001",
+		Subtotal:      1000, GSTAmount: 180, Total: 1180,
+		Currency: "INR", Status: "sent", CreatedAt: created,
+		LineItems: []models.InvoiceLineItem{{Description: "Therapy Session (Tom's follow-up)", Amount: 1000}},
+	}
+	profile := models.BillingProfile{GSTNumber: "29ABCDE1234F1Z5", StateCode: "29", SACCode: "9993"}
+	doc := BuildInvoiceDocument(inv, profile, InvoiceParty{Name: "Calm Clinic"}, InvoiceParty{Name: "Asha"}, time.UTC)
+
+	if doc.Title != "TAX INVOICE" || doc.LineItems[0].SACCode != "9993" || doc.Tax.CGST != 90 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	a, b := RenderInvoicePDF(doc), RenderInvoicePDF(doc)
+	if !bytes.HasPrefix(a, []byte("%PDF-1.4")) || !bytes.HasSuffix(a, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF")
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("rendering is not deterministic")
+	}
+	if !bytes.Contains(a, []byte(doc.Hash())) {
+		t.Fatal("document hash missing from PDF")
+	}
+
+	inv.Status = "paid"
+	if BuildInvoiceDocument(inv, profile, InvoiceParty{Name: "Calm Clinic"}, InvoiceParty{Name: "Asha"}, time.UTC).Hash() == doc.Hash() {
+		t.Fatal("hash should change with payment status")
+	}
+}
+
+func TestBuildCreditNoteDocument(t *testing.T) {
+	issued := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+	inv := models.Invoice{
+		InvoiceNumber: "INV/2026-27/00001",
+		Subtotal:      1000, GSTAmount: 180, Total: 1180,
+		Currency: "INR", Status: "paid", CreatedAt: issued,
+		LineItems: []models.InvoiceLineItem{{Description: "Therapy Session", Amount: 1000}},
+	}
+	cn := models.CreditNote{CreditNoteNumber: "CN/2026-27/00001", Subtotal: 500, GSTAmount: 90, Total: 590,
+		Currency: "INR", Reason: "Session cancelled", IssuedAt: issued}
+	profile := models.BillingProfile{GSTNumber: "29ABCDE1234F1Z5", StateCode: "29", SACCode: "9993"}
+	doc := BuildCreditNoteDocument(cn, inv, profile, InvoiceParty{Name: "Calm Clinic"}, InvoiceParty{Name: "Asha"}, time.UTC)
+
+	if doc.Title != "CREDIT NOTE" || doc.Reference != inv.InvoiceNumber || doc.Total != 590 || doc.Tax.SGST != 45 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	if len(doc.LineItems) != 1 || doc.LineItems[0].Amount != 500 {
+		t.Fatalf("unexpected lines %+v", doc.LineItems)
+	}
+	if !bytes.Contains(RenderInvoicePDF(doc), []byte("Against invoice")) {
+		t.Fatal("credit note should reference the invoice")
+	}
+}
@@ -1,28 +1,57 @@
 package services
 
 import (
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/AnshRaj112/serenify-backend/internal/config"
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 const (
-	AccessTokenDuration  = 7 * 24 * time.Hour  // 7 days — matches session duration
+	AccessTokenDuration  = 15 * time.Minute    // short-lived; clients renew with the refresh token
 	RefreshTokenDuration = 30 * 24 * time.Hour // 30 days
 )
 
+// Token roles carried in the role claim and stored with each refresh token.
+const (
+	TokenRoleTherapist    = "therapist"
+	TokenRoleReceptionist = "receptionist"
+	TokenRoleAdmin        = "admin"
+)
+
+// Redis keys consulted on every access token validation.
+const (
+	jtiDenylistKeyPrefix   = "jwt_denylist:"       // one access token, until it expires
+	familyRevokedKeyPrefix = "jwt_family_revoked:" // every access token of a refresh family
+	userRevokedKeyPrefix   = "jwt_user_revoked:"   // every access token issued before the stored unix time
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used; all sessions from that sign-in have been revoked")
+	errTokenRevoked        = errors.New("token revoked")
+)
+
 type TokenClaims struct {
 	UserID   string `json:"uid"`
 	TenantID string `json:"tid"`
 	Role     string `json:"role"`
+	FamilyID string `json:"fid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -30,191 +59,477 @@ type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
+	// FamilyID ties the pair to its sign-in in auth_sessions
+	FamilyID uuid.UUID `json:"-"`
 }
 
-var jwtSecret []byte
+// tokenKeys holds the Ed25519 signing keys by kid. Only the active key signs; the others still
+// verify so a rotation doesn't sign anyone out.
+var tokenKeys struct {
+	sync.RWMutex
+	keys   map[string]ed25519.PrivateKey
+	order  []string
+	active string
+	issuer string
+	// legacy verifies HS256 tokens issued before legacyCutoff, for one access-token lifetime
+	// after it. A zero cutoff rejects HS256.
+	legacy       []byte
+	legacyCutoff time.Time
+}
 
+// InitTokenService loads the signing keys from config. Production refuses to start without
+// JWT_SIGNING_KEYS; elsewhere every instance derives the same key from JWT_SECRET.
+func InitTokenService(cfg *config.Config) error {
+	InitJWT(cfg.JWTSecret)
+	tokenKeys.Lock()
+	tokenKeys.issuer = cfg.JWTIssuer
+	tokenKeys.Unlock()
+	if cfg.JWTLegacyHS256Cutoff != "" {
+		cutoff, err := time.Parse(time.RFC3339, cfg.JWTLegacyHS256Cutoff)
+		if err != nil {
+			return fmt.Errorf("JWT_LEGACY_HS256_CUTOFF: %w", err)
+		}
+		SetLegacyHS256Cutoff(cutoff)
+	}
+	if cfg.JWTSigningKeys == "" {
+		if cfg.IsProduction() {
+			return errors.New("JWT_SIGNING_KEYS must be set in production")
+		}
+		log.Println("⚠️  JWT_SIGNING_KEYS not set; signing access tokens with a key derived from JWT_SECRET")
+		return nil
+	}
+	return LoadJWTSigningKeys(cfg.JWTSigningKeys, cfg.JWTActiveKeyID)
+}
+
+// SetLegacyHS256Cutoff accepts HS256 tokens issued before cutoff until one access-token lifetime
+// after it. The zero time turns HS256 off.
+func SetLegacyHS256Cutoff(cutoff time.Time) {
+	tokenKeys.Lock()
+	defer tokenKeys.Unlock()
+	tokenKeys.legacyCutoff = cutoff
+}
+
+// InitJWT derives the default signing key from the shared secret and keeps the secret for
+// verifying legacy HS256 tokens. HS256 stays off until SetLegacyHS256Cutoff is called.
 func InitJWT(secret string) {
-	jwtSecret = []byte(secret)
+	seed := sha256.Sum256([]byte("serenify-jwt-ed25519:" + secret))
+	key := ed25519.NewKeyFromSeed(seed[:])
+	kidSum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	kid := hex.EncodeToString(kidSum[:8])
+
+	tokenKeys.Lock()
+	defer tokenKeys.Unlock()
+	tokenKeys.keys = map[string]ed25519.PrivateKey{kid: key}
+	tokenKeys.order = []string{kid}
+	tokenKeys.active = kid
+	tokenKeys.legacy = []byte(secret)
+	tokenKeys.legacyCutoff = time.Time{}
+}
+
+// LoadJWTSigningKeys replaces the signing keys with "kid:base64seed,..." pairs of 32-byte
+// Ed25519 seeds. activeKID defaults to the first key listed.
+func LoadJWTSigningKeys(spec, activeKID string) error {
+	keys := map[string]ed25519.PrivateKey{}
+	var order []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, encoded, ok := strings.Cut(part, ":")
+		if !ok || kid == "" {
+			return fmt.Errorf("jwt signing key %q: expected kid:base64seed", part)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("jwt signing key %q: seed must be %d base64-encoded bytes", kid, ed25519.SeedSize)
+		}
+		if _, dup := keys[kid]; dup {
+			return fmt.Errorf("jwt signing key %q listed twice", kid)
+		}
+		keys[kid] = ed25519.NewKeyFromSeed(seed)
+		order = append(order, kid)
+	}
+	if len(order) == 0 {
+		return errors.New("no jwt signing keys configured")
+	}
+	if activeKID == "" {
+		activeKID = order[0]
+	}
+	if _, ok := keys[activeKID]; !ok {
+		return fmt.Errorf("active jwt signing key %q is not in the key list", activeKID)
+	}
+
+	tokenKeys.Lock()
+	defer tokenKeys.Unlock()
+	tokenKeys.keys = keys
+	tokenKeys.order = order
+	tokenKeys.active = activeKID
+	return nil
 }
 
-func issueAccessToken(therapistID, tenantID uuid.UUID) (string, error) {
+// JWKS returns the public verification keys as a JSON Web Key Set.
+func JWKS() map[string]interface{} {
+	tokenKeys.RLock()
+	defer tokenKeys.RUnlock()
+	keys := make([]map[string]string, 0, len(tokenKeys.order))
+	for _, kid := range tokenKeys.order {
+		pub := tokenKeys.keys[kid].Public().(ed25519.PublicKey)
+		keys = append(keys, map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"alg": "EdDSA",
+			"use": "sig",
+			"kid": kid,
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func issueAccessToken(userID, tenantID uuid.UUID, role string, familyID uuid.UUID) (string, error) {
+	tokenKeys.RLock()
+	kid, key, issuer := tokenKeys.active, tokenKeys.keys[tokenKeys.active], tokenKeys.issuer
+	tokenKeys.RUnlock()
+	if key == nil {
+		return "", errors.New("jwt not configured")
+	}
+
 	now := time.Now()
 	claims := TokenClaims{
-		UserID:   therapistID.String(),
-		TenantID: tenantID.String(),
-		Role:     "therapist",
+		UserID:   userID.String(),
+		Role:     role,
+		FamilyID: familyID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   therapistID.String(),
+			ID:        uuid.NewString(),
+			Issuer:    issuer,
+			Subject:   userID.String(),
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-func IssueTherapistTokens(therapistID, tenantID uuid.UUID) (*TokenPair, error) {
-	if len(jwtSecret) == 0 {
-		return nil, errors.New("jwt not configured")
+	if tenantID != uuid.Nil {
+		claims.TenantID = tenantID.String()
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
 
-	accessToken, err := issueAccessToken(therapistID, tenantID)
+// IssueTokens signs a user in: an access token plus the first refresh token of a new family.
+// tenantID is uuid.Nil for admins.
+func IssueTokens(userID, tenantID uuid.UUID, role string) (*TokenPair, error) {
+	familyID := uuid.New()
+	refreshRaw, err := newRefreshToken()
 	if err != nil {
 		return nil, err
 	}
-
-	refreshRaw, err := newRefreshToken()
+	_, err = database.PostgresDB.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, tenant_id, expires_at, family_id, role)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, hashToken(refreshRaw), uuid.NullUUID{UUID: tenantID, Valid: tenantID != uuid.Nil},
+		time.Now().Add(RefreshTokenDuration), familyID, role)
 	if err != nil {
 		return nil, err
 	}
+	return newTokenPair(userID, tenantID, role, familyID, refreshRaw)
+}
 
-	_, err = database.PostgresDB.Exec(`
-		INSERT INTO refresh_tokens (user_id, token_hash, tenant_id, expires_at)
-		VALUES ($1, $2, $3, $4)
-	`, therapistID, hashToken(refreshRaw), tenantID, time.Now().Add(RefreshTokenDuration))
+func IssueTherapistTokens(therapistID, tenantID uuid.UUID) (*TokenPair, error) {
+	return IssueTokens(therapistID, tenantID, TokenRoleTherapist)
+}
+
+// IssueReceptionistTokens creates an access+refresh token pair for a receptionist.
+func IssueReceptionistTokens(receptionistID, tenantID uuid.UUID) (*TokenPair, error) {
+	return IssueTokens(receptionistID, tenantID, TokenRoleReceptionist)
+}
+
+// IssueAdminTokens creates a token pair for a platform admin; it carries no tenant.
+func IssueAdminTokens(adminID uuid.UUID) (*TokenPair, error) {
+	return IssueTokens(adminID, uuid.Nil, TokenRoleAdmin)
+}
+
+func newTokenPair(userID, tenantID uuid.UUID, role string, familyID uuid.UUID, refreshRaw string) (*TokenPair, error) {
+	accessToken, err := issueAccessToken(userID, tenantID, role, familyID)
 	if err != nil {
 		return nil, err
 	}
-
 	return &TokenPair{
 		AccessToken:  accessToken,
 		RefreshToken: refreshRaw,
 		ExpiresIn:    int(AccessTokenDuration.Seconds()),
+		FamilyID:     familyID,
 	}, nil
 }
 
-func ValidateAccessToken(tokenStr string) (*TokenClaims, bool) {
-	if len(jwtSecret) == 0 || tokenStr == "" {
-		return nil, false
+// ParseAccessToken verifies an access token's signature, expiry and revocation state.
+func ParseAccessToken(tokenStr string) (*TokenClaims, error) {
+	if tokenStr == "" {
+		return nil, errors.New("empty token")
 	}
-	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, tokenVerificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired())
 	if err != nil || !token.Valid {
-		return nil, false
+		return nil, errors.New("invalid token")
 	}
 	claims, ok := token.Claims.(*TokenClaims)
-	if !ok || claims.Role != "therapist" {
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	if accessTokenRevoked(claims) {
+		return nil, errTokenRevoked
+	}
+	return claims, nil
+}
+
+func tokenVerificationKey(t *jwt.Token) (interface{}, error) {
+	tokenKeys.RLock()
+	defer tokenKeys.RUnlock()
+	if t.Method == jwt.SigningMethodHS256 {
+		cutoff := tokenKeys.legacyCutoff
+		if len(tokenKeys.legacy) == 0 || cutoff.IsZero() || time.Now().After(cutoff.Add(AccessTokenDuration)) {
+			return nil, errors.New("legacy tokens not accepted")
+		}
+		claims, ok := t.Claims.(*TokenClaims)
+		if !ok || claims.IssuedAt == nil || !claims.IssuedAt.Before(cutoff) {
+			return nil, errors.New("legacy token issued after the cutoff")
+		}
+		return tokenKeys.legacy, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	key, ok := tokenKeys.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.Public(), nil
+}
+
+func validateRoleToken(tokenStr, role string) (*TokenClaims, bool) {
+	claims, err := ParseAccessToken(tokenStr)
+	if err != nil || claims.Role != role {
 		return nil, false
 	}
 	return claims, true
 }
 
-// issueReceptionistAccessToken mints a short-lived JWT for a receptionist.
-func issueReceptionistAccessToken(receptionistID, tenantID uuid.UUID) (string, error) {
-	now := time.Now()
-	claims := TokenClaims{
-		UserID:   receptionistID.String(),
-		TenantID: tenantID.String(),
-		Role:     "receptionist",
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   receptionistID.String(),
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenDuration)),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+func ValidateAccessToken(tokenStr string) (*TokenClaims, bool) {
+	return validateRoleToken(tokenStr, TokenRoleTherapist)
 }
 
-// IssueReceptionistTokens creates an access+refresh token pair for a receptionist.
-func IssueReceptionistTokens(receptionistID, tenantID uuid.UUID) (*TokenPair, error) {
-	if len(jwtSecret) == 0 {
-		return nil, errors.New("jwt not configured")
+// ValidateReceptionistAccessToken validates a JWT and ensures role == "receptionist".
+func ValidateReceptionistAccessToken(tokenStr string) (*TokenClaims, bool) {
+	return validateRoleToken(tokenStr, TokenRoleReceptionist)
+}
+
+// ValidateAdminAccessToken validates a JWT and ensures role == "admin".
+func ValidateAdminAccessToken(tokenStr string) (*TokenClaims, bool) {
+	return validateRoleToken(tokenStr, TokenRoleAdmin)
+}
+
+// accessTokenRevoked checks the Redis revocation lists. Without Redis, or when it is unreachable,
+// tokens stay valid until they expire; the short lifetime bounds that window.
+func accessTokenRevoked(c *TokenClaims) bool {
+	if database.RedisClient == nil {
+		return false
+	}
+	vals, err := database.RedisClient.MGet(context.Background(),
+		jtiDenylistKeyPrefix+c.ID,
+		familyRevokedKeyPrefix+c.FamilyID,
+		userRevokedKeyPrefix+c.UserID,
+	).Result()
+	if err != nil || len(vals) != 3 {
+		return false
 	}
+	if c.ID != "" && vals[0] != nil {
+		return true
+	}
+	if c.FamilyID != "" && vals[1] != nil {
+		return true
+	}
+	if s, ok := vals[2].(string); ok {
+		since, err := strconv.ParseInt(s, 10, 64)
+		if err == nil && (c.IssuedAt == nil || c.IssuedAt.Unix() <= since) {
+			return true
+		}
+	}
+	return false
+}
 
-	accessToken, err := issueReceptionistAccessToken(receptionistID, tenantID)
+// RefreshAccessToken rotates a refresh token: the presented token is retired and a new one from
+// the same family is returned with a fresh access token. Presenting a token that was already
+// rotated means two parties hold it, so the whole family is revoked.
+func RefreshAccessToken(refreshRaw string) (*TokenPair, error) {
+	tx, err := database.PostgresDB.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	refreshRaw, err := newRefreshToken()
+	var (
+		id, userID, familyID uuid.UUID
+		tenantID             uuid.NullUUID
+		role                 sql.NullString
+		expiresAt            time.Time
+		revokedAt, rotatedAt sql.NullTime
+	)
+	err = tx.QueryRow(`
+		SELECT id, user_id, tenant_id, family_id, role, expires_at, revoked_at, rotated_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(refreshRaw)).Scan(&id, &userID, &tenantID, &familyID, &role, &expiresAt, &revokedAt, &rotatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
 	if err != nil {
 		return nil, err
 	}
+	if rotatedAt.Valid {
+		tx.Rollback()
+		if err := RevokeTokenFamily(familyID); err != nil {
+			log.Printf("token family %s: revoke after reuse: %v", familyID, err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
 
-	// Reuse the refresh_tokens table — role is embedded in the access token claims
-	_, err = database.PostgresDB.Exec(`
-		INSERT INTO refresh_tokens (user_id, token_hash, tenant_id, expires_at)
-		VALUES ($1, $2, $3, $4)
-	`, receptionistID, hashToken(refreshRaw), tenantID, time.Now().Add(RefreshTokenDuration))
+	subjectRole := role.String
+	if !role.Valid {
+		// Issued before roles were stored with the token
+		subjectRole = legacyTokenRole(tx, userID)
+	}
+	if !tokenSubjectActive(tx, userID, subjectRole) {
+		return nil, errors.New("user not found or inactive")
+	}
+
+	newRaw, err := newRefreshToken()
 	if err != nil {
 		return nil, err
 	}
-
-	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshRaw,
-		ExpiresIn:    int(AccessTokenDuration.Seconds()),
-	}, nil
+	var newID uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO refresh_tokens (user_id, token_hash, tenant_id, expires_at, family_id, role)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, hashToken(newRaw), tenantID, time.Now().Add(RefreshTokenDuration), familyID, subjectRole).Scan(&newID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE refresh_tokens SET rotated_at = NOW(), replaced_by = $2 WHERE id = $1
+	`, id, newID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return newTokenPair(userID, tenantID.UUID, subjectRole, familyID, newRaw)
 }
 
-// ValidateReceptionistAccessToken validates a JWT and ensures role == "receptionist".
-func ValidateReceptionistAccessToken(tokenStr string) (*TokenClaims, bool) {
-	if len(jwtSecret) == 0 || tokenStr == "" {
-		return nil, false
-	}
-	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, false
+func legacyTokenRole(tx *sql.Tx, userID uuid.UUID) string {
+	var isTherapist bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM therapists WHERE id = $1)`, userID).Scan(&isTherapist); err == nil && isTherapist {
+		return TokenRoleTherapist
 	}
-	claims, ok := token.Claims.(*TokenClaims)
-	if !ok || claims.Role != "receptionist" {
-		return nil, false
+	var isReceptionist bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM receptionists WHERE id = $1)`, userID).Scan(&isReceptionist); err == nil && isReceptionist {
+		return TokenRoleReceptionist
 	}
-	return claims, true
+	return ""
 }
 
-func RefreshAccessToken(refreshRaw string) (*TokenPair, error) {
-	if len(jwtSecret) == 0 {
-		return nil, errors.New("jwt not configured")
+func tokenSubjectActive(tx *sql.Tx, userID uuid.UUID, role string) bool {
+	var query string
+	switch role {
+	case TokenRoleTherapist:
+		query = `SELECT EXISTS(SELECT 1 FROM therapists WHERE id = $1)`
+	case TokenRoleReceptionist:
+		query = `SELECT EXISTS(SELECT 1 FROM receptionists WHERE id = $1 AND is_active = true)`
+	case TokenRoleAdmin:
+		query = `SELECT EXISTS(SELECT 1 FROM admins WHERE id = $1 AND is_active = true)`
+	default:
+		return false
 	}
+	var ok bool
+	return tx.QueryRow(query, userID).Scan(&ok) == nil && ok
+}
 
-	var userID, tenantID uuid.UUID
-	var expiresAt time.Time
-	err := database.PostgresDB.QueryRow(`
-		SELECT user_id, tenant_id, expires_at
-		FROM refresh_tokens
-		WHERE token_hash = $1 AND revoked_at IS NULL
-	`, hashToken(refreshRaw)).Scan(&userID, &tenantID, &expiresAt)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("invalid refresh token")
+// RevokeAccessToken denylists one access token by jti until it expires.
+func RevokeAccessToken(c *TokenClaims) {
+	if database.RedisClient == nil || c.ID == "" {
+		return
 	}
-	if err != nil {
-		return nil, err
+	ttl := AccessTokenDuration
+	if c.ExpiresAt != nil {
+		ttl = time.Until(c.ExpiresAt.Time)
 	}
-	if time.Now().After(expiresAt) {
-		return nil, errors.New("refresh token expired")
+	if ttl <= 0 {
+		return
 	}
+	_ = database.RedisClient.Set(context.Background(), jtiDenylistKeyPrefix+c.ID, "1", ttl).Err()
+}
 
-	// Check if the user is a therapist
-	var isTherapist bool
-	err = database.PostgresDB.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM therapists WHERE id = $1)
-	`, userID).Scan(&isTherapist)
-	if err == nil && isTherapist {
-		return IssueTherapistTokens(userID, tenantID)
+// RevokeTokenFamily ends one sign-in: its refresh tokens stop working, its outstanding access
+// tokens are rejected and the opaque session issued with it for V1 endpoints is invalidated.
+func RevokeTokenFamily(familyID uuid.UUID) error {
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID); err != nil {
+		return err
+	}
+	if database.RedisClient != nil {
+		_ = database.RedisClient.Set(context.Background(), familyRevokedKeyPrefix+familyID.String(), "1", AccessTokenDuration).Err()
 	}
+	return endOpaqueSessions(`refresh_family_id = $1`, familyID)
+}
 
-	// Check if the user is a receptionist
-	var isReceptionist bool
-	err = database.PostgresDB.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM receptionists WHERE id = $1)
-	`, userID).Scan(&isReceptionist)
-	if err == nil && isReceptionist {
-		return IssueReceptionistTokens(userID, tenantID)
+// RevokeUserTokens signs a user out everywhere, e.g. when their account is deactivated.
+func RevokeUserTokens(userID uuid.UUID) error {
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID); err != nil {
+		return err
 	}
+	if database.RedisClient != nil {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		_ = database.RedisClient.Set(context.Background(), userRevokedKeyPrefix+userID.String(), now, AccessTokenDuration).Err()
+	}
+	return endOpaqueSessions(`actor_id = $1`, userID)
+}
 
-	return nil, errors.New("user not found or inactive")
+// Logout revokes the presented access token and its sign-in's refresh family. refreshRaw is
+// optional and covers clients whose access token has already expired. A V1 opaque session token
+// in place of the access token ends the sign-in it was issued with.
+func Logout(accessToken, refreshRaw string) error {
+	if claims, err := ParseAccessToken(accessToken); err == nil {
+		RevokeAccessToken(claims)
+		if familyID, err := uuid.Parse(claims.FamilyID); err == nil {
+			if err := RevokeTokenFamily(familyID); err != nil {
+				return err
+			}
+		}
+	} else if accessToken != "" {
+		if err := endOpaqueSignin(accessToken); err != nil {
+			return err
+		}
+	}
+	if refreshRaw == "" {
+		return nil
+	}
+	var familyID uuid.UUID
+	err := database.PostgresDB.QueryRow(`
+		SELECT family_id FROM refresh_tokens WHERE token_hash = $1
+	`, hashToken(refreshRaw)).Scan(&familyID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeTokenFamily(familyID)
 }
 
 func newRefreshToken() (string, error) {
@@ -1,8 +1,13 @@
 package services
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -11,7 +16,7 @@ func TestJWTIssueAndValidate(t *testing.T) {
 	tid := uuid.New()
 	uid := uuid.New()
 
-	accessToken, err := issueAccessToken(uid, tid)
+	accessToken, err := issueAccessToken(uid, tid, TokenRoleTherapist, uuid.New())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -26,9 +31,133 @@ func TestJWTIssueAndValidate(t *testing.T) {
 	if claims.Role != "therapist" {
 		t.Fatalf("role: %s", claims.Role)
 	}
+	if claims.ID == "" || claims.FamilyID == "" {
+		t.Fatalf("jti and family should be set: %+v", claims)
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) != AccessTokenDuration {
+		t.Fatalf("lifetime %v", claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+	}
+	if _, ok := ValidateReceptionistAccessToken(accessToken); ok {
+		t.Fatal("therapist token accepted as receptionist")
+	}
 
 	_, ok = ValidateAccessToken("invalid.token.here")
 	if ok {
 		t.Fatal("invalid token should fail")
 	}
 }
+
+func TestJWTSignedWithEdDSAAndPublishedInJWKS(t *testing.T) {
+	InitJWT("test-secret-key-for-jwt-unit-tests-only")
+	token, err := issueAccessToken(uuid.New(), uuid.Nil, TokenRoleAdmin, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &TokenClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method.Alg() != "EdDSA" {
+		t.Fatalf("alg %s", parsed.Method.Alg())
+	}
+	kid, _ := parsed.Header["kid"].(string)
+
+	keys := JWKS()["keys"].([]map[string]string)
+	if len(keys) != 1 || keys[0]["kid"] != kid || keys[0]["crv"] != "Ed25519" {
+		t.Fatalf("jwks %v does not publish kid %q", keys, kid)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(keys[0]["x"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another service verifying with only the JWKS
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return ed25519.PublicKey(x), nil },
+		jwt.WithValidMethods([]string{"EdDSA"})); err != nil {
+		t.Fatalf("token does not verify against the JWKS key: %v", err)
+	}
+	if claims, ok := ValidateAdminAccessToken(token); !ok || claims.TenantID != "" {
+		t.Fatalf("admin token: %+v %v", claims, ok)
+	}
+}
+
+func TestJWTSigningKeyRotation(t *testing.T) {
+	InitJWT("test-secret-key-for-jwt-unit-tests-only")
+	seed := func(b byte) string { return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32))) }
+
+	if err := LoadJWTSigningKeys("k1:"+seed('a'), ""); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := issueAccessToken(uuid.New(), uuid.New(), TokenRoleTherapist, uuid.New())
+
+	if err := LoadJWTSigningKeys("k1:"+seed('a')+",k2:"+seed('b'), "k2"); err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := issueAccessToken(uuid.New(), uuid.New(), TokenRoleTherapist, uuid.New())
+	if parsed, _, _ := jwt.NewParser().ParseUnverified(fresh, &TokenClaims{}); parsed.Header["kid"] != "k2" {
+		t.Fatalf("new tokens should be signed with k2, got %v", parsed.Header["kid"])
+	}
+	if _, ok := ValidateAccessToken(old); !ok {
+		t.Fatal("token signed with a retired but listed key should validate")
+	}
+
+	if err := LoadJWTSigningKeys("k2:"+seed('b'), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ValidateAccessToken(old); ok {
+		t.Fatal("token signed with a removed key should fail")
+	}
+	if _, ok := ValidateAccessToken(fresh); !ok {
+		t.Fatal("token signed with the active key should validate")
+	}
+
+	for _, spec := range []string{"", "k1", "k1:short", "k1:" + seed('a') + ",k1:" + seed('b')} {
+		if err := LoadJWTSigningKeys(spec, ""); err == nil {
+			t.Fatalf("spec %q accepted", spec)
+		}
+	}
+	if err := LoadJWTSigningKeys("k1:"+seed('a'), "missing"); err == nil {
+		t.Fatal("unknown active kid accepted")
+	}
+}
+
+func TestLegacyHS256TokensStillValidate(t *testing.T) {
+	secret := "test-secret-key-for-jwt-unit-tests-only"
+	InitJWT(secret)
+	uid := uuid.New()
+	now := time.Now()
+	hs256 := func(issued time.Time) *jwt.Token {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+			UserID: uid.String(), TenantID: uuid.NewString(), Role: TokenRoleReceptionist,
+			RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(issued), ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))},
+		})
+	}
+	legacy := hs256(now.Add(-time.Minute))
+	signed, _ := legacy.SignedString([]byte(secret))
+	if _, ok := ValidateReceptionistAccessToken(signed); ok {
+		t.Fatal("HS256 token accepted without a cutoff")
+	}
+
+	SetLegacyHS256Cutoff(now)
+	if claims, ok := ValidateReceptionistAccessToken(signed); !ok || claims.UserID != uid.String() {
+		t.Fatal("HS256 token issued before the cutoff should validate")
+	}
+	late, _ := hs256(now.Add(time.Minute)).SignedString([]byte(secret))
+	if _, ok := ValidateReceptionistAccessToken(late); ok {
+		t.Fatal("HS256 token issued after the cutoff accepted")
+	}
+	SetLegacyHS256Cutoff(now.Add(-AccessTokenDuration - time.Minute))
+	stale, _ := hs256(now.Add(-AccessTokenDuration - 2*time.Minute)).SignedString([]byte(secret))
+	if _, ok := ValidateReceptionistAccessToken(stale); ok {
+		t.Fatal("HS256 token accepted past the legacy window")
+	}
+	SetLegacyHS256Cutoff(now)
+
+	forged, _ := legacy.SignedString([]byte("another-secret"))
+	if _, ok := ValidateReceptionistAccessToken(forged); ok {
+		t.Fatal("HS256 token with the wrong secret accepted")
+	}
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, legacy.Claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, ok := ValidateReceptionistAccessToken(unsigned); ok {
+		t.Fatal("alg none accepted")
+	}
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/pkg/crypto"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	keyRotationBatchSize = 200
+	// keyRotationLease is how long a run may go without a heartbeat before another process may
+	// take it over.
+	keyRotationLease = 2 * time.Minute
+)
+
+var (
+	ErrKeyRotationRunning  = errors.New("a key rotation run is already in progress")
+	ErrKeyRotationNotFound = errors.New("key rotation run not found")
+)
+
+// encryptedColumn is a column whose values are encrypted under the keyring. Escrow columns hold
+// abuse report packets sealed to the escrow public key instead of keyring ciphertexts.
+type encryptedColumn struct {
+	Table  string
+	Column string
+	Escrow bool
+}
+
+func (c encryptedColumn) target() string { return c.Table + "." + c.Column }
+
+// encryptedColumns lists every column the re-encryption job walks. Each table is keyed by a UUID id.
+var encryptedColumns = []encryptedColumn{
+	{Table: "user_recovery", Column: "email_encrypted"},
+	{Table: "user_recovery", Column: "phone_encrypted"},
+	{Table: "calendar_integrations", Column: "access_token_enc"},
+	{Table: "calendar_integrations", Column: "refresh_token_enc"},
+	{Table: "mfa_factors", Column: "totp_secret_enc"},
+	{Table: "abuse_reports", Column: "encrypted_payload", Escrow: true},
+}
+
+// StartKeyRotation starts re-encrypting every encrypted column under the active key, in the
+// background. An interrupted run for the same key and mode is resumed rather than restarted.
+func StartKeyRotation(dryRun bool, startedBy *uuid.UUID) (models.KeyRotationRun, error) {
+	id, err := ClaimKeyRotationRun(dryRun, startedBy)
+	if err != nil {
+		return models.KeyRotationRun{}, err
+	}
+	go func() {
+		if _, err := RunKeyRotation(context.Background(), id, nil); err != nil {
+			log.Printf("key rotation %s: %v", id, err)
+		}
+	}()
+	return GetKeyRotationRun(id)
+}
+
+// ResumeKeyRotations picks up runs left unfinished by a stopped process. Taking over a run renews
+// its heartbeat, so only one replica resumes it.
+func ResumeKeyRotations() {
+	rows, err := database.PostgresDB.Query(`
+		UPDATE key_rotation_runs SET heartbeat_at = NOW()
+		WHERE status = 'running' AND heartbeat_at < $1
+		RETURNING id
+	`, time.Now().Add(-keyRotationLease))
+	if err != nil {
+		log.Printf("key rotation resume: %v", err)
+		return
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		id := id
+		go func() {
+			if _, err := RunKeyRotation(context.Background(), id, nil); err != nil {
+				log.Printf("key rotation %s: %v", id, err)
+			}
+		}()
+	}
+}
+
+// ClaimKeyRotationRun returns the run to work on: a resumable one for the same target key and
+// mode, or a new one with a progress row per column.
+func ClaimKeyRotationRun(dryRun bool, startedBy *uuid.UUID) (uuid.UUID, error) {
+	ring, err := utils.ActiveKeyring()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	// Serialize claims so two requests cannot both start a run.
+	if _, err := tx.Exec(`LOCK TABLE key_rotation_runs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return uuid.Nil, err
+	}
+
+	var busy bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM key_rotation_runs WHERE status = 'running' AND heartbeat_at >= $1)
+	`, time.Now().Add(-keyRotationLease)).Scan(&busy); err != nil {
+		return uuid.Nil, err
+	}
+	if busy {
+		return uuid.Nil, ErrKeyRotationRunning
+	}
+
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		SELECT id FROM key_rotation_runs
+		WHERE target_key_id = $1 AND dry_run = $2 AND status IN ('running', 'failed')
+		ORDER BY started_at DESC LIMIT 1
+	`, ring.ActiveKeyID(), dryRun).Scan(&id)
+	switch {
+	case err == nil:
+		if _, err := tx.Exec(`
+			UPDATE key_rotation_runs SET status = 'running', error = NULL, heartbeat_at = NOW() WHERE id = $1
+		`, id); err != nil {
+			return uuid.Nil, err
+		}
+	case err == sql.ErrNoRows:
+		if err := tx.QueryRow(`
+			INSERT INTO key_rotation_runs (target_key_id, dry_run, started_by) VALUES ($1, $2, $3) RETURNING id
+		`, ring.ActiveKeyID(), dryRun, startedBy).Scan(&id); err != nil {
+			return uuid.Nil, err
+		}
+		for _, col := range encryptedColumns {
+			var total int
+			if err := tx.QueryRow(fmt.Sprintf(`
+				SELECT COUNT(*) FROM %s WHERE %s IS NOT NULL AND %s <> ''
+			`, col.Table, col.Column, col.Column)).Scan(&total); err != nil {
+				return uuid.Nil, err
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO key_rotation_progress (run_id, target, total) VALUES ($1, $2, $3)
+			`, id, col.target(), total); err != nil {
+				return uuid.Nil, err
+			}
+		}
+	default:
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// RunKeyRotation works through a run in the calling goroutine, reporting progress after each
+// batch, and returns the finished run. It stops early when the run is cancelled.
+func RunKeyRotation(ctx context.Context, runID uuid.UUID, progress func(models.KeyRotationRun)) (models.KeyRotationRun, error) {
+	run, err := GetKeyRotationRun(runID)
+	if err != nil {
+		return run, err
+	}
+	rotator, err := newKeyRotator(run.TargetKeyID)
+	if err != nil {
+		finishKeyRotationRun(runID, "failed", err.Error())
+		return run, err
+	}
+
+	for _, col := range encryptedColumns {
+		for {
+			if err := ctx.Err(); err != nil {
+				return run, err
+			}
+			var status string
+			_ = database.PostgresDB.QueryRow(`SELECT status FROM key_rotation_runs WHERE id = $1`, runID).Scan(&status)
+			if status != "running" {
+				return GetKeyRotationRun(runID)
+			}
+			done, err := rotator.rotateBatch(runID, col, run.DryRun)
+			if err != nil {
+				finishKeyRotationRun(runID, "failed", col.target()+": "+err.Error())
+				return run, err
+			}
+			if progress != nil {
+				if r, err := GetKeyRotationRun(runID); err == nil {
+					progress(r)
+				}
+			}
+			if done {
+				break
+			}
+		}
+	}
+	finishKeyRotationRun(runID, "completed", "")
+	return GetKeyRotationRun(runID)
+}
+
+// CancelKeyRotation stops a run after its current batch. A cancelled run is not resumed.
+func CancelKeyRotation(runID uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE key_rotation_runs SET status = 'cancelled', finished_at = NOW() WHERE id = $1 AND status = 'running'
+	`, runID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrKeyRotationNotFound
+	}
+	return nil
+}
+
+func finishKeyRotationRun(runID uuid.UUID, status, detail string) {
+	_, err := database.PostgresDB.Exec(`
+		UPDATE key_rotation_runs SET status = $2, error = $3, finished_at = NOW(), heartbeat_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, runID, status, nullIfEmpty(detail))
+	if err != nil {
+		log.Printf("key rotation %s: %v", runID, err)
+	}
+}
+
+// keyRotator re-encrypts values under one target key.
+type keyRotator struct {
+	ring      *utils.Keyring
+	escrowKey []byte   // active escrow private key
+	escrowPub []byte   // and its public key, which new packets are sealed to
+	previous  [][]byte // escrow keys that may have sealed older packets
+}
+
+func newKeyRotator(targetKeyID string) (*keyRotator, error) {
+	ring, err := utils.ActiveKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if ring.ActiveKeyID() != targetKeyID {
+		return nil, fmt.Errorf("active key is %q, run targets %q", ring.ActiveKeyID(), targetKeyID)
+	}
+	r := &keyRotator{ring: ring}
+	r.escrowKey, _ = ring.Key(targetKeyID)
+	if r.escrowPub, err = curve25519.X25519(r.escrowKey, curve25519.Basepoint); err != nil {
+		return nil, err
+	}
+	for _, id := range ring.KeyIDs() {
+		if id != targetKeyID {
+			key, _ := ring.Key(id)
+			r.previous = append(r.previous, key)
+		}
+	}
+	return r, nil
+}
+
+// rotate returns the value re-encrypted under the target key, or changed=false when it already is.
+func (r *keyRotator) rotate(col encryptedColumn, value string) (string, bool, error) {
+	if !col.Escrow {
+		if !r.ring.NeedsRotation(value) {
+			return value, false, nil
+		}
+		plaintext, err := r.ring.Decrypt(value)
+		if err != nil {
+			return "", false, err
+		}
+		out, err := r.ring.Encrypt(plaintext)
+		return out, err == nil, err
+	}
+
+	packet, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false, err
+	}
+	if len(packet) < 44 {
+		return "", false, errors.New("report packet is too short")
+	}
+	if _, ok := decryptEscrowPacket(packet, r.escrowKey); ok {
+		return value, false, nil
+	}
+	for _, key := range r.previous {
+		if plaintext, ok := decryptEscrowPacket(packet, key); ok {
+			sealed, err := crypto.EncapsulateECIES(plaintext, r.escrowPub)
+			if err != nil {
+				return "", false, err
+			}
+			return base64.StdEncoding.EncodeToString(sealed), true, nil
+		}
+	}
+	return "", false, errors.New("no keyring key opens the report packet")
+}
+
+// rotateBatch processes the next batch of a column after the run's cursor and records progress.
+// It reports true once the column is finished.
+func (r *keyRotator) rotateBatch(runID uuid.UUID, col encryptedColumn, dryRun bool) (bool, error) {
+	var lastID uuid.NullUUID
+	var done bool
+	if err := database.PostgresDB.QueryRow(`
+		SELECT last_id, done FROM key_rotation_progress WHERE run_id = $1 AND target = $2
+	`, runID, col.target()).Scan(&lastID, &done); err != nil {
+		return false, err
+	}
+	if done {
+		return true, nil
+	}
+
+	rows, err := database.PostgresDB.Query(fmt.Sprintf(`
+		SELECT id, %s FROM %s
+		WHERE %s IS NOT NULL AND %s <> '' AND ($1::uuid IS NULL OR id > $1)
+		ORDER BY id LIMIT $2
+	`, col.Column, col.Table, col.Column, col.Column), lastID, keyRotationBatchSize)
+	if err != nil {
+		return false, err
+	}
+	type item struct {
+		id    uuid.UUID
+		value string
+	}
+	var batch []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.value); err != nil {
+			rows.Close()
+			return false, err
+		}
+		batch = append(batch, it)
+	}
+	rows.Close()
+
+	rotated, failed := 0, 0
+	for _, it := range batch {
+		out, changed, err := r.rotate(col, it.value)
+		if err != nil {
+			// The value stays as it is; it is reported, never logged.
+			log.Printf("key rotation %s: %s id=%s: %v", runID, col.target(), it.id, err)
+			failed++
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if !dryRun {
+			// Only replace the value that was read; a concurrent write is already on the active key.
+			if _, err := database.PostgresDB.Exec(fmt.Sprintf(`
+				UPDATE %s SET %s = $2 WHERE id = $1 AND %s = $3
+			`, col.Table, col.Column, col.Column), it.id, out, it.value); err != nil {
+				return false, err
+			}
+		}
+		rotated++
+	}
+
+	done = len(batch) < keyRotationBatchSize
+	var cursor interface{}
+	if len(batch) > 0 {
+		cursor = batch[len(batch)-1].id
+	} else if lastID.Valid {
+		cursor = lastID.UUID
+	}
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE key_rotation_progress SET
+			last_id = $3, scanned = scanned + $4, rotated = rotated + $5, failed = failed + $6,
+			done = $7, updated_at = NOW()
+		WHERE run_id = $1 AND target = $2
+	`, runID, col.target(), cursor, len(batch), rotated, failed, done); err != nil {
+		return false, err
+	}
+	_, err = database.PostgresDB.Exec(`UPDATE key_rotation_runs SET heartbeat_at = NOW() WHERE id = $1`, runID)
+	return done, err
+}
+
+const keyRotationRunColumns = `id, target_key_id, dry_run, status, COALESCE(error, ''), started_at, heartbeat_at, finished_at`
+
+func scanKeyRotationRun(s rowScanner) (models.KeyRotationRun, error) {
+	var run models.KeyRotationRun
+	var finished sql.NullTime
+	err := s.Scan(&run.ID, &run.TargetKeyID, &run.DryRun, &run.Status, &run.Error, &run.StartedAt, &run.HeartbeatAt, &finished)
+	if finished.Valid {
+		run.FinishedAt = &finished.Time
+	}
+	return run, err
+}
+
+func GetKeyRotationRun(id uuid.UUID) (models.KeyRotationRun, error) {
+	run, err := scanKeyRotationRun(database.PostgresDB.QueryRow(`
+		SELECT `+keyRotationRunColumns+` FROM key_rotation_runs WHERE id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return run, ErrKeyRotationNotFound
+	}
+	if err != nil {
+		return run, err
+	}
+	run.Progress, err = keyRotationProgress(id)
+	return run, err
+}
+
+// ListKeyRotationRuns returns recent runs, newest first, with their progress.
+func ListKeyRotationRuns(limit int) ([]models.KeyRotationRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := database.PostgresDB.Query(`
+		SELECT `+keyRotationRunColumns+` FROM key_rotation_runs ORDER BY started_at DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]models.KeyRotationRun, 0)
+	for rows.Next() {
+		run, err := scanKeyRotationRun(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	rows.Close()
+	for i := range runs {
+		if runs[i].Progress, err = keyRotationProgress(runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func keyRotationProgress(runID uuid.UUID) ([]models.KeyRotationProgress, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT target, total, scanned, rotated, failed, done FROM key_rotation_progress WHERE run_id = $1
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byTarget := map[string]models.KeyRotationProgress{}
+	for rows.Next() {
+		var p models.KeyRotationProgress
+		if err := rows.Scan(&p.Target, &p.Total, &p.Scanned, &p.Rotated, &p.Failed, &p.Done); err != nil {
+			return nil, err
+		}
+		byTarget[p.Target] = p
+	}
+	// Report columns in the order the job walks them.
+	progress := make([]models.KeyRotationProgress, 0, len(byTarget))
+	for _, col := range encryptedColumns {
+		if p, ok := byTarget[col.target()]; ok {
+			progress = append(progress, p)
+		}
+	}
+	return progress, rows.Err()
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+
+	"github.com/AnshRaj112/serenify-backend/pkg/crypto"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"golang.org/x/crypto/curve25519"
+)
+
+func testKeyring(t *testing.T, active string) *utils.Keyring {
+	t.Helper()
+	keys := map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}
+	ring, err := utils.NewKeyring(active, []string{"k1", "k2"}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestKeyringRotatesCiphertexts(t *testing.T) {
+	old := testKeyring(t, "k1")
+	ct, err := old.Encrypt("patient@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := utils.CiphertextKeyID(ct); !ok || id != "k1" {
+		t.Fatalf("ciphertext key id = %q %v, want k1", id, ok)
+	}
+
+	utils.SetKeyring(testKeyring(t, "k2"))
+	defer utils.SetKeyring(nil)
+	r, err := newKeyRotator("k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every keyring column is walked, TOTP secrets included: a retired key must not lock staff
+	// out of MFA
+	walked := map[string]bool{}
+	for _, col := range encryptedColumns {
+		if col.Escrow {
+			continue
+		}
+		walked[col.target()] = true
+		out, changed, err := r.rotate(col, ct)
+		if err != nil || !changed {
+			t.Fatalf("%s: rotate = %v %v", col.target(), changed, err)
+		}
+		if id, _ := utils.CiphertextKeyID(out); id != "k2" {
+			t.Fatalf("%s: rotated ciphertext carries %q, want k2", col.target(), id)
+		}
+		if pt, err := r.ring.Decrypt(out); err != nil || pt != "patient@example.com" {
+			t.Fatalf("%s: rotated value decrypts to %q, %v", col.target(), pt, err)
+		}
+		if _, changed, _ := r.rotate(col, out); changed {
+			t.Fatalf("%s: value under the active key should not be rotated again", col.target())
+		}
+	}
+	for _, target := range []string{"user_recovery.email_encrypted", "mfa_factors.totp_secret_enc"} {
+		if !walked[target] {
+			t.Errorf("%s is not re-encrypted", target)
+		}
+	}
+}
+
+func TestKeyringDecryptsLegacyAndBindsKeyID(t *testing.T) {
+	ring := testKeyring(t, "k1")
+	// A value written before key IDs existed: bare base64 of nonce|sealed, no additional data.
+	key, _ := ring.Key("k2")
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("token"), nil))
+	if pt, err := ring.Decrypt(legacy); err != nil || pt != "token" {
+		t.Fatalf("legacy value decrypts to %q, %v", pt, err)
+	}
+	if !ring.NeedsRotation(legacy) {
+		t.Fatal("legacy ciphertext should need rotation")
+	}
+
+	ct, _ := ring.Encrypt("token")
+	if _, err := ring.Decrypt("v1:k2:" + ct[len("v1:k1:"):]); err == nil {
+		t.Fatal("ciphertext relabelled with another key id decrypted")
+	}
+}
+
+func TestKeyRotatorReseals(t *testing.T) {
+	ring := testKeyring(t, "k1")
+	oldKey, _ := ring.Key("k1")
+	oldPub, _ := curve25519.X25519(oldKey, curve25519.Basepoint)
+	packet, err := crypto.EncapsulateECIES([]byte(`{"note":"x"}`), oldPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := base64.StdEncoding.EncodeToString(packet)
+
+	utils.SetKeyring(testKeyring(t, "k2"))
+	defer utils.SetKeyring(nil)
+	r, err := newKeyRotator("k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := encryptedColumn{Table: "abuse_reports", Column: "encrypted_payload", Escrow: true}
+	out, changed, err := r.rotate(col, value)
+	if err != nil || !changed {
+		t.Fatalf("rotate = %v %v", changed, err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(out)
+	if pt, ok := decryptEscrowPacket(sealed, r.escrowKey); !ok || string(pt) != `{"note":"x"}` {
+		t.Fatalf("re-sealed packet opens to %q %v", pt, ok)
+	}
+	if _, changed, _ := r.rotate(col, out); changed {
+		t.Fatal("packet sealed to the active key should not be rotated again")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	ring, err := utils.ParseKeyring("new:"+k2, "", k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.ActiveKeyID() != "new" || len(ring.KeyIDs()) != 2 || ring.KeyIDs()[1] != utils.DefaultKeyID {
+		t.Fatalf("unexpected keyring %q %v", ring.ActiveKeyID(), ring.KeyIDs())
+	}
+	bad := []struct{ spec, active string }{
+		{"a:" + k1 + ",a:" + k2, ""},
+		{"a:" + k1, "b"},
+		{"a:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"bad id:" + k1, ""},
+		{"", ""},
+	}
+	for _, c := range bad {
+		if _, err := utils.ParseKeyring(c.spec, c.active, ""); err == nil {
+			t.Fatalf("ParseKeyring(%q, %q) should fail", c.spec, c.active)
+		}
+	}
+}
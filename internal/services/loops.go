@@ -29,18 +29,23 @@ func SendOnboardingEmail(data OnboardingEmailData) error {
 		return fmt.Errorf("loops email is not configured")
 	}
 
+	return sendLoopsTransactional(apiKey, transactionalID, data.Email, true, map[string]string{
+		"email":             data.Email,
+		"patientEmail":      data.PatientEmail,
+		"patientName":       data.PatientName,
+		"therapistName":     data.TherapistName,
+		"username":          data.Username,
+		"temporaryPassword": data.TemporaryPassword,
+	})
+}
+
+// sendLoopsTransactional posts a transactional email with the given template variables.
+func sendLoopsTransactional(apiKey, transactionalID, email string, addToAudience bool, vars map[string]string) error {
 	payload := map[string]interface{}{
 		"transactionalId": transactionalID,
-		"email":           data.Email,
-		"addToAudience":   true,
-		"dataVariables": map[string]string{
-			"email":             data.Email,
-			"patientEmail":      data.PatientEmail,
-			"patientName":       data.PatientName,
-			"therapistName":     data.TherapistName,
-			"username":          data.Username,
-			"temporaryPassword": data.TemporaryPassword,
-		},
+		"email":           email,
+		"addToAudience":   addToAudience,
+		"dataVariables":   vars,
 	}
 
 	body, err := json.Marshal(payload)
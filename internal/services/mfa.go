@@ -0,0 +1,749 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/AnshRaj112/serenify-backend/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Staff roles that can enroll second factors.
+const (
+	MFAActorAdmin        = "admin"
+	MFAActorTherapist    = "therapist"
+	MFAActorReceptionist = "receptionist"
+)
+
+const (
+	MFAFactorTOTP     = "totp"
+	MFAFactorWebAuthn = "webauthn"
+)
+
+const (
+	mfaPurposeSignin   = "signin"
+	mfaPurposeEnroll   = "enroll"
+	mfaPurposeRegister = "register"
+
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaEnrollTTL      = 15 * time.Minute
+	mfaMaxAttempts    = 5
+	recoveryCodeCount = 10
+
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+var (
+	ErrMFAInvalid          = errors.New("invalid verification")
+	ErrMFAChallengeExpired = errors.New("MFA challenge expired or already used; sign in again")
+	ErrMFAFactorNotFound   = errors.New("MFA factor not found")
+	ErrMFARequired         = errors.New("MFA is required for this account")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAActor identifies the staff member a factor belongs to. TenantID is set for receptionists,
+// whose tenant may require MFA.
+type MFAActor struct {
+	Type     string
+	ID       uuid.UUID
+	TenantID uuid.UUID
+}
+
+func (a MFAActor) is(b MFAActor) bool { return a.Type == b.Type && a.ID == b.ID }
+
+// MFASigninChallenge is the second step a password sign-in must complete before a session is
+// issued. With EnrollmentRequired the account has no factor yet and must enroll one first.
+type MFASigninChallenge struct {
+	Token              string                 `json:"mfa_token"`
+	Methods            []string               `json:"methods"`
+	EnrollmentRequired bool                   `json:"enrollment_required"`
+	WebAuthn           map[string]interface{} `json:"webauthn,omitempty"`
+	ExpiresIn          int                    `json:"expires_in"`
+}
+
+// MFAProof completes a challenge: a TOTP code, a recovery code, a WebAuthn assertion, or (when
+// enrolling during sign-in) a WebAuthn registration.
+type MFAProof struct {
+	Code         string
+	RecoveryCode string
+	Assertion    *WebAuthnCredential
+	Registration *WebAuthnCredential
+	Name         string
+}
+
+type mfaChallenge struct {
+	ID        uuid.UUID
+	Actor     MFAActor
+	Purpose   string
+	Challenge []byte
+}
+
+type mfaFactorRow struct {
+	models.MFAFactor
+	SecretEnc    string
+	LastStep     int64
+	CredentialID string
+	PublicKey    []byte
+	SignCount    int64
+}
+
+// mfaRequiredAdminRoles are the privileged admin roles; they can't sign in without a factor.
+var mfaRequiredAdminRoles = map[string]bool{
+	AdminRoleAdmin:      true,
+	AdminRoleCompliance: true,
+	AdminRoleSafety:     true,
+	"moderator":         true,
+}
+
+// AdminRoleRequiresMFA reports whether an admin account with role must use MFA.
+func AdminRoleRequiresMFA(role string) bool {
+	return mfaRequiredAdminRoles[role]
+}
+
+// MFARequired reports whether the actor must have a factor to sign in: privileged admins always,
+// receptionists when their tenant asks for it.
+func MFARequired(actor MFAActor) (bool, error) {
+	switch actor.Type {
+	case MFAActorReceptionist:
+		return TenantReceptionistMFARequired(actor.TenantID)
+	case MFAActorAdmin:
+		role, ok, err := AdminRole(actor.ID)
+		if err != nil || !ok {
+			return false, err
+		}
+		return AdminRoleRequiresMFA(role), nil
+	}
+	return false, nil
+}
+
+func TenantReceptionistMFARequired(tenantID uuid.UUID) (bool, error) {
+	var required bool
+	err := database.PostgresDB.QueryRow(`SELECT receptionist_mfa_required FROM tenants WHERE id = $1`, tenantID).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return required, err
+}
+
+func SetTenantReceptionistMFARequired(tenantID uuid.UUID, required bool) error {
+	_, err := database.PostgresDB.Exec(`
+		UPDATE tenants SET receptionist_mfa_required = $2, updated_at = NOW() WHERE id = $1
+	`, tenantID, required)
+	return err
+}
+
+// BeginMFASignin starts the second step of a password sign-in. It returns nil when the actor has
+// no factor and none is required, so the session can be issued straight away.
+func BeginMFASignin(actor MFAActor) (*MFASigninChallenge, error) {
+	factors, err := listMFAFactorRows(actor, true)
+	if err != nil {
+		return nil, err
+	}
+	purpose, ttl := mfaPurposeSignin, mfaChallengeTTL
+	if len(factors) == 0 {
+		required, err := MFARequired(actor)
+		if err != nil || !required {
+			return nil, err
+		}
+		purpose, ttl = mfaPurposeEnroll, mfaEnrollTTL
+	}
+	token, challenge, err := createMFAChallenge(actor, purpose, ttl)
+	if err != nil {
+		return nil, err
+	}
+	out := &MFASigninChallenge{
+		Token:              token,
+		Methods:            []string{},
+		EnrollmentRequired: purpose == mfaPurposeEnroll,
+		ExpiresIn:          int(ttl.Seconds()),
+	}
+	if out.EnrollmentRequired {
+		out.Methods = []string{MFAFactorTOTP, MFAFactorWebAuthn}
+		return out, nil
+	}
+	hasTOTP := false
+	var creds []string
+	for _, f := range factors {
+		switch f.Kind {
+		case MFAFactorTOTP:
+			hasTOTP = true
+		case MFAFactorWebAuthn:
+			creds = append(creds, f.CredentialID)
+		}
+	}
+	if hasTOTP {
+		out.Methods = append(out.Methods, MFAFactorTOTP)
+	}
+	if len(creds) > 0 {
+		out.Methods = append(out.Methods, MFAFactorWebAuthn)
+		out.WebAuthn = webauthnRequestOptions(challenge, creds)
+	}
+	if n, err := unusedRecoveryCodes(actor); err == nil && n > 0 {
+		out.Methods = append(out.Methods, "recovery_code")
+	}
+	return out, nil
+}
+
+// CompleteMFASignin verifies the proof for a sign-in challenge and returns who signed in. When
+// the sign-in enrolled its first factor, fresh recovery codes are returned as well; they are
+// shown once. A challenge dies after a few wrong attempts.
+func CompleteMFASignin(actorType, token string, proof MFAProof) (MFAActor, []string, error) {
+	ch, err := loadMFAChallenge(token, mfaPurposeSignin, mfaPurposeEnroll)
+	if err != nil {
+		return MFAActor{}, nil, err
+	}
+	if ch.Actor.Type != actorType {
+		return MFAActor{}, nil, ErrMFAChallengeExpired
+	}
+	enrolling := ch.Purpose == mfaPurposeEnroll
+	switch {
+	case proof.Code != "":
+		err = verifyTOTPFactor(ch.Actor, uuid.Nil, proof.Code, enrolling)
+	case proof.RecoveryCode != "" && !enrolling:
+		err = useRecoveryCode(ch.Actor, proof.RecoveryCode)
+	case proof.Assertion != nil && !enrolling:
+		err = verifyWebAuthnFactor(ch.Actor, ch.Challenge, *proof.Assertion)
+	case proof.Registration != nil && enrolling:
+		_, err = registerWebAuthnFactor(ch.Actor, ch.Challenge, proof.Name, *proof.Registration)
+	default:
+		err = ErrMFAInvalid
+	}
+	if err != nil {
+		if errors.Is(err, ErrMFAInvalid) {
+			failMFAChallenge(ch.ID)
+		}
+		return MFAActor{}, nil, err
+	}
+	if err := consumeMFAChallenge(ch.ID); err != nil {
+		return MFAActor{}, nil, err
+	}
+	var codes []string
+	if enrolling {
+		if codes, err = ensureRecoveryCodes(ch.Actor); err != nil {
+			return MFAActor{}, nil, err
+		}
+	}
+	if err := RecordStaffMFA(ch.Actor.ID); err != nil {
+		return MFAActor{}, nil, err
+	}
+	return ch.Actor, codes, nil
+}
+
+// MFAChallengeActor returns who a pending enrollment sign-in belongs to, so that sign-in can set
+// up its first factor before it has a session.
+func MFAChallengeActor(token string) (MFAActor, error) {
+	ch, err := loadMFAChallenge(token, mfaPurposeEnroll)
+	return ch.Actor, err
+}
+
+// ListMFAFactors returns the actor's factors and how many recovery codes are left.
+func ListMFAFactors(actor MFAActor) ([]models.MFAFactor, int, error) {
+	rows, err := listMFAFactorRows(actor, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	factors := make([]models.MFAFactor, 0, len(rows))
+	for _, f := range rows {
+		factors = append(factors, f.MFAFactor)
+	}
+	codes, err := unusedRecoveryCodes(actor)
+	return factors, codes, err
+}
+
+// BeginTOTPEnrollment creates an unconfirmed TOTP factor and returns its secret and otpauth://
+// URI for the authenticator app's QR code. Any earlier unconfirmed TOTP factor is discarded.
+func BeginTOTPEnrollment(actor MFAActor) (models.MFAFactor, string, string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return models.MFAFactor{}, "", "", err
+	}
+	secret := totpEncoding.EncodeToString(raw)
+	enc, err := utils.Encrypt(secret)
+	if err != nil {
+		return models.MFAFactor{}, "", "", err
+	}
+	if _, err := database.PostgresDB.Exec(`
+		DELETE FROM mfa_factors
+		WHERE actor_type = $1 AND actor_id = $2 AND kind = $3 AND confirmed_at IS NULL
+	`, actor.Type, actor.ID, MFAFactorTOTP); err != nil {
+		return models.MFAFactor{}, "", "", err
+	}
+	f := models.MFAFactor{Kind: MFAFactorTOTP, Name: "Authenticator app"}
+	if err := database.PostgresDB.QueryRow(`
+		INSERT INTO mfa_factors (actor_type, actor_id, kind, name, totp_secret_enc)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, actor.Type, actor.ID, f.Kind, f.Name, enc).Scan(&f.ID, &f.CreatedAt); err != nil {
+		return models.MFAFactor{}, "", "", err
+	}
+	return f, secret, totpProvisioningURI(webauthnRPName, mfaAccountName(actor), secret), nil
+}
+
+// ConfirmTOTPEnrollment activates a TOTP factor with its first valid code. Recovery codes are
+// returned the first time the actor enrolls a factor.
+func ConfirmTOTPEnrollment(actor MFAActor, factorID uuid.UUID, code string) ([]string, error) {
+	if err := verifyTOTPFactor(actor, factorID, code, true); err != nil {
+		return nil, err
+	}
+	codes, err := ensureRecoveryCodes(actor)
+	if err != nil {
+		return nil, err
+	}
+	return codes, RecordStaffMFA(actor.ID)
+}
+
+// BeginWebAuthnRegistration returns the options for navigator.credentials.create and the token
+// that finishes the registration. During an enrollment sign-in the sign-in's own challenge is
+// used and the token is the mfa_token.
+func BeginWebAuthnRegistration(actor MFAActor, enrollToken string) (string, map[string]interface{}, error) {
+	token := enrollToken
+	var challenge []byte
+	if enrollToken != "" {
+		ch, err := loadMFAChallenge(enrollToken, mfaPurposeEnroll)
+		if err != nil {
+			return "", nil, err
+		}
+		if !ch.Actor.is(actor) {
+			return "", nil, ErrMFAChallengeExpired
+		}
+		challenge = ch.Challenge
+	} else {
+		var err error
+		if token, challenge, err = createMFAChallenge(actor, mfaPurposeRegister, mfaChallengeTTL); err != nil {
+			return "", nil, err
+		}
+	}
+	existing, err := listMFAFactorRows(actor, true)
+	if err != nil {
+		return "", nil, err
+	}
+	var exclude []string
+	for _, f := range existing {
+		if f.Kind == MFAFactorWebAuthn {
+			exclude = append(exclude, f.CredentialID)
+		}
+	}
+	return token, webauthnCreationOptions(challenge, actor.ID[:], mfaAccountName(actor), exclude), nil
+}
+
+// FinishWebAuthnRegistration verifies a registration started by BeginWebAuthnRegistration.
+func FinishWebAuthnRegistration(actor MFAActor, token, name string, cred WebAuthnCredential) (models.MFAFactor, []string, error) {
+	ch, err := loadMFAChallenge(token, mfaPurposeRegister)
+	if err != nil {
+		return models.MFAFactor{}, nil, err
+	}
+	if !ch.Actor.is(actor) {
+		return models.MFAFactor{}, nil, ErrMFAChallengeExpired
+	}
+	f, err := registerWebAuthnFactor(actor, ch.Challenge, name, cred)
+	if err != nil {
+		if errors.Is(err, ErrMFAInvalid) {
+			failMFAChallenge(ch.ID)
+		}
+		return models.MFAFactor{}, nil, err
+	}
+	if err := consumeMFAChallenge(ch.ID); err != nil {
+		return models.MFAFactor{}, nil, err
+	}
+	codes, err := ensureRecoveryCodes(actor)
+	if err != nil {
+		return models.MFAFactor{}, nil, err
+	}
+	return f, codes, RecordStaffMFA(actor.ID)
+}
+
+// DeleteMFAFactor removes a factor. The last one cannot be removed while MFA is required; once
+// none is left the recovery codes go too.
+func DeleteMFAFactor(actor MFAActor, factorID uuid.UUID) error {
+	factors, err := listMFAFactorRows(actor, true)
+	if err != nil {
+		return err
+	}
+	confirmed, found := 0, false
+	for _, f := range factors {
+		confirmed++
+		if f.ID == factorID {
+			found = true
+		}
+	}
+	if found && confirmed == 1 {
+		required, err := MFARequired(actor)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrMFARequired
+		}
+	}
+	res, err := database.PostgresDB.Exec(`
+		DELETE FROM mfa_factors WHERE id = $1 AND actor_type = $2 AND actor_id = $3
+	`, factorID, actor.Type, actor.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMFAFactorNotFound
+	}
+	if found && confirmed == 1 {
+		_, err = database.PostgresDB.Exec(`
+			DELETE FROM mfa_recovery_codes WHERE actor_type = $1 AND actor_id = $2
+		`, actor.Type, actor.ID)
+	}
+	return err
+}
+
+// RegenerateRecoveryCodes replaces the actor's recovery codes with a fresh set.
+func RegenerateRecoveryCodes(actor MFAActor) ([]string, error) {
+	factors, err := listMFAFactorRows(actor, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(factors) == 0 {
+		return nil, ErrMFAFactorNotFound
+	}
+	return replaceRecoveryCodes(actor)
+}
+
+// RecordStaffMFA marks the actor's staff session as MFA-verified now; MFAEnforcer reads it.
+func RecordStaffMFA(actorID uuid.UUID) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE staff_sessions SET active = FALSE WHERE actor_id = $1 AND active`, actorID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO staff_sessions (actor_id, mfa_verified, last_mfa_at, active) VALUES ($1, TRUE, NOW(), TRUE)
+	`, actorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func listMFAFactorRows(actor MFAActor, confirmedOnly bool) ([]mfaFactorRow, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, kind, name, confirmed_at, last_used_at, created_at,
+			COALESCE(totp_secret_enc, ''), totp_last_step, COALESCE(credential_id, ''), public_key, sign_count
+		FROM mfa_factors
+		WHERE actor_type = $1 AND actor_id = $2 AND ($3 = FALSE OR confirmed_at IS NOT NULL)
+		ORDER BY created_at
+	`, actor.Type, actor.ID, confirmedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []mfaFactorRow
+	for rows.Next() {
+		var f mfaFactorRow
+		if err := rows.Scan(&f.ID, &f.Kind, &f.Name, &f.ConfirmedAt, &f.LastUsedAt, &f.CreatedAt,
+			&f.SecretEnc, &f.LastStep, &f.CredentialID, &f.PublicKey, &f.SignCount); err != nil {
+			return nil, err
+		}
+		f.Confirmed = f.ConfirmedAt != nil
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// verifyTOTPFactor checks a code against the actor's TOTP factors (or only factorID when set)
+// and confirms the factor it matches. Unconfirmed factors are only tried while enrolling.
+func verifyTOTPFactor(actor MFAActor, factorID uuid.UUID, code string, enrolling bool) error {
+	factors, err := listMFAFactorRows(actor, !enrolling)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	matched := false
+	for _, f := range factors {
+		if f.Kind != MFAFactorTOTP || (factorID != uuid.Nil && f.ID != factorID) {
+			continue
+		}
+		matched = true
+		plain, err := utils.Decrypt(f.SecretEnc)
+		if err != nil {
+			return err
+		}
+		secret, err := totpEncoding.DecodeString(plain)
+		if err != nil {
+			return err
+		}
+		step, ok := verifyTOTP(secret, code, now, f.LastStep)
+		if !ok {
+			continue
+		}
+		// The step guard makes each code single-use even under concurrent requests.
+		res, err := database.PostgresDB.Exec(`
+			UPDATE mfa_factors
+			SET totp_last_step = $2, last_used_at = NOW(), confirmed_at = COALESCE(confirmed_at, NOW())
+			WHERE id = $1 AND totp_last_step < $2
+		`, f.ID, step)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return nil
+		}
+	}
+	if factorID != uuid.Nil && !matched {
+		return ErrMFAFactorNotFound
+	}
+	return ErrMFAInvalid
+}
+
+func verifyWebAuthnFactor(actor MFAActor, challenge []byte, cred WebAuthnCredential) error {
+	credID := cred.RawID
+	if credID == "" {
+		credID = cred.ID
+	}
+	credID = strings.TrimRight(credID, "=")
+	factors, err := listMFAFactorRows(actor, true)
+	if err != nil {
+		return err
+	}
+	for _, f := range factors {
+		if f.Kind != MFAFactorWebAuthn || f.CredentialID != credID {
+			continue
+		}
+		count, err := verifyWebAuthnAssertion(cred, challenge, f.PublicKey, uint32(f.SignCount))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMFAInvalid, err)
+		}
+		_, err = database.PostgresDB.Exec(`
+			UPDATE mfa_factors SET sign_count = $2, last_used_at = NOW() WHERE id = $1
+		`, f.ID, int64(count))
+		return err
+	}
+	return ErrMFAInvalid
+}
+
+func registerWebAuthnFactor(actor MFAActor, challenge []byte, name string, cred WebAuthnCredential) (models.MFAFactor, error) {
+	reg, err := verifyWebAuthnRegistration(cred, challenge)
+	if err != nil {
+		return models.MFAFactor{}, fmt.Errorf("%w: %v", ErrMFAInvalid, err)
+	}
+	f := models.MFAFactor{Kind: MFAFactorWebAuthn, Name: strings.TrimSpace(name), Confirmed: true}
+	if f.Name == "" {
+		f.Name = "Passkey"
+	}
+	if len(f.Name) > 100 {
+		f.Name = f.Name[:100]
+	}
+	err = database.PostgresDB.QueryRow(`
+		INSERT INTO mfa_factors (actor_type, actor_id, kind, name, credential_id, public_key, sign_count, confirmed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING id, confirmed_at, created_at
+	`, actor.Type, actor.ID, f.Kind, f.Name, reg.CredentialID, reg.PublicKey, int64(reg.SignCount)).Scan(&f.ID, &f.ConfirmedAt, &f.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return models.MFAFactor{}, fmt.Errorf("%w: credential already registered", ErrMFAInvalid)
+	}
+	return f, err
+}
+
+func createMFAChallenge(actor MFAActor, purpose string, ttl time.Duration) (string, []byte, error) {
+	raw := make([]byte, 32)
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(challenge); err != nil {
+		return "", nil, err
+	}
+	token := b64url(raw)
+	_, _ = database.PostgresDB.Exec(`DELETE FROM mfa_challenges WHERE expires_at < NOW() - INTERVAL '1 day'`)
+	_, err := database.PostgresDB.Exec(`
+		INSERT INTO mfa_challenges (token_hash, actor_type, actor_id, tenant_id, purpose, challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, hashToken(token), actor.Type, actor.ID, uuid.NullUUID{UUID: actor.TenantID, Valid: actor.TenantID != uuid.Nil},
+		purpose, challenge, time.Now().Add(ttl))
+	return token, challenge, err
+}
+
+func loadMFAChallenge(token string, purposes ...string) (mfaChallenge, error) {
+	var ch mfaChallenge
+	var tenantID uuid.NullUUID
+	if token == "" {
+		return ch, ErrMFAChallengeExpired
+	}
+	err := database.PostgresDB.QueryRow(`
+		SELECT id, actor_type, actor_id, tenant_id, purpose, challenge
+		FROM mfa_challenges
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > NOW() AND attempts < $2
+	`, hashToken(token), mfaMaxAttempts).Scan(&ch.ID, &ch.Actor.Type, &ch.Actor.ID, &tenantID, &ch.Purpose, &ch.Challenge)
+	if err == sql.ErrNoRows {
+		return ch, ErrMFAChallengeExpired
+	}
+	if err != nil {
+		return ch, err
+	}
+	ch.Actor.TenantID = tenantID.UUID
+	for _, p := range purposes {
+		if p == ch.Purpose {
+			return ch, nil
+		}
+	}
+	return mfaChallenge{}, ErrMFAChallengeExpired
+}
+
+func failMFAChallenge(id uuid.UUID) {
+	_, _ = database.PostgresDB.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, id)
+}
+
+func consumeMFAChallenge(id uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE mfa_challenges SET consumed_at = NOW() WHERE id = $1 AND consumed_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMFAChallengeExpired
+	}
+	return nil
+}
+
+func unusedRecoveryCodes(actor MFAActor) (int, error) {
+	var n int
+	err := database.PostgresDB.QueryRow(`
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE actor_type = $1 AND actor_id = $2 AND used_at IS NULL
+	`, actor.Type, actor.ID).Scan(&n)
+	return n, err
+}
+
+// ensureRecoveryCodes issues recovery codes when the actor has none yet.
+func ensureRecoveryCodes(actor MFAActor) ([]string, error) {
+	var exists bool
+	if err := database.PostgresDB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM mfa_recovery_codes WHERE actor_type = $1 AND actor_id = $2)
+	`, actor.Type, actor.ID).Scan(&exists); err != nil || exists {
+		return nil, err
+	}
+	return replaceRecoveryCodes(actor)
+}
+
+func replaceRecoveryCodes(actor MFAActor) ([]string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE actor_type = $1 AND actor_id = $2`, actor.Type, actor.ID); err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		if _, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (actor_type, actor_id, code_hash) VALUES ($1, $2, $3)
+		`, actor.Type, actor.ID, hashToken(normalizeRecoveryCode(c))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+func useRecoveryCode(actor MFAActor, code string) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE actor_type = $1 AND actor_id = $2 AND code_hash = $3 AND used_at IS NULL
+	`, actor.Type, actor.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMFAInvalid
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns codes like "k3f9q-x2mzt" (50 random bits each).
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	raw := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+// mfaAccountName is the label authenticators show for the account.
+func mfaAccountName(actor MFAActor) string {
+	var query string
+	switch actor.Type {
+	case MFAActorAdmin:
+		query = `SELECT username FROM admins WHERE id = $1`
+	case MFAActorTherapist:
+		query = `SELECT email FROM therapists WHERE id = $1`
+	case MFAActorReceptionist:
+		query = `SELECT email FROM receptionists WHERE id = $1`
+	}
+	var name string
+	if query == "" || database.PostgresDB.QueryRow(query, actor.ID).Scan(&name) != nil || name == "" {
+		return actor.ID.String()
+	}
+	return name
+}
+
+// totpCode is the RFC 6238 code (HMAC-SHA1, 6 digits) for a time step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// verifyTOTP accepts the code for the current step or one step either side of it, and returns
+// the step it matched. Steps up to lastStep were already used.
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		if step > lastStep && hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpProvisioningURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + q.Encode()
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"}
+	for unix, want := range cases {
+		if got := totpCode(secret, unix/totpPeriod); got != want {
+			t.Fatalf("T=%d: code %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTPWindowAndReplay(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	if got, ok := verifyTOTP(secret, totpCode(secret, step-1), now, 0); !ok || got != step-1 {
+		t.Fatalf("previous step should be accepted, got %d %v", got, ok)
+	}
+	if _, ok := verifyTOTP(secret, totpCode(secret, step-2), now, 0); ok {
+		t.Fatal("code two steps old should be rejected")
+	}
+	if _, ok := verifyTOTP(secret, totpCode(secret, step), now, step); ok {
+		t.Fatal("code for an already used step should be rejected")
+	}
+	code := totpCode(secret, step)
+	if _, ok := verifyTOTP(secret, code[:3]+" "+code[3:], now, 0); !ok {
+		t.Fatal("spaces in the code should be ignored")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := totpProvisioningURI("Serenify", "dr@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Serenify:dr@example.com?") ||
+		!strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Serenify") {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Fatalf("unexpected code format %q", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) != recoveryCodeCount {
+		t.Fatal("recovery codes should be distinct")
+	}
+	if normalizeRecoveryCode(" ABCDE-fghij ") != normalizeRecoveryCode("abcdefghij") {
+		t.Fatal("recovery codes should compare without case or dashes")
+	}
+}
+
+// testAuthenticator is a software ES256 authenticator for one credential.
+type testAuthenticator struct {
+	key    *ecdsa.PrivateKey
+	credID []byte
+	count  uint32
+}
+
+func (a *testAuthenticator) authData(attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(webauthnRPID))
+	b := append([]byte{}, rpHash[:]...)
+	flags := byte(authFlagUserPresent | authFlagUserVerified)
+	if attested {
+		flags |= authFlagAttested
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.count)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.credID)))
+		b = append(b, a.credID...)
+		pub, _ := a.key.PublicKey.Bytes()
+		b = append(b, cborMap([][2][]byte{
+			{cborInt(1), cborInt(2)},
+			{cborInt(3), cborInt(coseAlgES256)},
+			{cborInt(-1), cborInt(1)},
+			{cborInt(-2), cborBytes(pub[1:33])},
+			{cborInt(-3), cborBytes(pub[33:])},
+		})...)
+	}
+	return b
+}
+
+func (a *testAuthenticator) clientData(typ string, challenge []byte, origin string) string {
+	b, _ := json.Marshal(map[string]string{"type": typ, "challenge": b64url(challenge), "origin": origin})
+	return b64url(b)
+}
+
+func (a *testAuthenticator) register(challenge []byte, origin string) WebAuthnCredential {
+	var c WebAuthnCredential
+	c.RawID = b64url(a.credID)
+	c.Response.ClientDataJSON = a.clientData("webauthn.create", challenge, origin)
+	c.Response.AttestationObject = b64url(cborMap([][2][]byte{
+		{cborText("fmt"), cborText("none")},
+		{cborText("attStmt"), cborMap(nil)},
+		{cborText("authData"), cborBytes(a.authData(true))},
+	}))
+	return c
+}
+
+func (a *testAuthenticator) assert(challenge []byte, origin string) WebAuthnCredential {
+	a.count++
+	var c WebAuthnCredential
+	c.RawID = b64url(a.credID)
+	c.Response.ClientDataJSON = a.clientData("webauthn.get", challenge, origin)
+	authData := a.authData(false)
+	clientData, _ := b64urlDecode(c.Response.ClientDataJSON)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	c.Response.AuthenticatorData = b64url(authData)
+	c.Response.Signature = b64url(sig)
+	return c
+}
+
+func TestWebAuthnRegistrationAndAssertion(t *testing.T) {
+	webauthnRPID, webauthnOrigins = "app.example.com", []string{"https://app.example.com"}
+	defer func() { webauthnRPID, webauthnOrigins = "localhost", []string{"http://localhost:3000"} }()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auth := &testAuthenticator{key: key, credID: []byte("credential-1")}
+	challenge := []byte("registration-challenge-0123456789")
+
+	reg, err := verifyWebAuthnRegistration(auth.register(challenge, "https://app.example.com"), challenge)
+	if err != nil {
+		t.Fatalf("registration rejected: %v", err)
+	}
+	if reg.CredentialID != b64url(auth.credID) {
+		t.Fatalf("credential id = %s", reg.CredentialID)
+	}
+	if _, err := verifyWebAuthnRegistration(auth.register(challenge, "https://evil.example"), challenge); !errors.Is(err, errWebAuthnInvalid) {
+		t.Fatalf("foreign origin accepted: %v", err)
+	}
+	if _, err := verifyWebAuthnRegistration(auth.register([]byte("other"), "https://app.example.com"), challenge); !errors.Is(err, errWebAuthnInvalid) {
+		t.Fatalf("wrong challenge accepted: %v", err)
+	}
+
+	signin := []byte("signin-challenge-0123456789abcdef")
+	count, err := verifyWebAuthnAssertion(auth.assert(signin, "https://app.example.com"), signin, reg.PublicKey, reg.SignCount)
+	if err != nil || count != 1 {
+		t.Fatalf("assertion rejected: %d %v", count, err)
+	}
+	replay := auth.assert(signin, "https://app.example.com")
+	if _, err := verifyWebAuthnAssertion(replay, signin, reg.PublicKey, 5); err == nil {
+		t.Fatal("assertion with a stale signature counter accepted")
+	}
+	tampered := auth.assert(signin, "https://app.example.com")
+	altered, _ := json.Marshal(map[string]interface{}{
+		"type": "webauthn.get", "challenge": b64url(signin), "origin": "https://app.example.com", "crossOrigin": true,
+	})
+	tampered.Response.ClientDataJSON = b64url(altered)
+	if _, err := verifyWebAuthnAssertion(tampered, signin, reg.PublicKey, 0); err == nil {
+		t.Fatal("assertion with altered client data accepted")
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged := (&testAuthenticator{key: other, credID: auth.credID, count: 10}).assert(signin, "https://app.example.com")
+	if _, err := verifyWebAuthnAssertion(forged, signin, reg.PublicKey, 0); err == nil {
+		t.Fatal("assertion signed by another key accepted")
+	}
+}
+
+func TestCBORDecodeRejectsMalformedInput(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x5a, 0xff, 0xff, 0xff, 0xff}, // byte string longer than the input
+		{0x9f},                         // indefinite-length array
+		bytes.Repeat([]byte{0x81}, 40), // nesting bomb
+		{0xa1, 0x40, 0x01},             // byte-string map key
+	} {
+		if _, _, err := cborDecode(b); err == nil {
+			t.Fatalf("% x decoded without error", b)
+		}
+	}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, uint64(len(s))), s...) }
+
+func cborMap(pairs [][2][]byte) []byte {
+	out := cborHead(5, uint64(len(pairs)))
+	for _, p := range pairs {
+		out = append(append(out, p[0]...), p[1]...)
+	}
+	return out
+}
+
+func TestAdminRoleRequiresMFA(t *testing.T) {
+	for _, role := range []string{AdminRoleAdmin, AdminRoleCompliance, AdminRoleSafety, "moderator"} {
+		if !AdminRoleRequiresMFA(role) {
+			t.Fatalf("%s should require MFA", role)
+		}
+	}
+	if AdminRoleRequiresMFA("") || AdminRoleRequiresMFA(MFAActorTherapist) {
+		t.Fatal("unprivileged role requires MFA")
+	}
+}
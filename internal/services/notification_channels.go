@@ -0,0 +1,366 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+)
+
+// Channel names used in notification_preferences and notification_outbox.
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebPush = "web_push"
+	ChannelWebhook = "webhook"
+)
+
+var notificationHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+var errWebhookPrivateAddress = errors.New("notification URL resolves to a private address")
+
+// webhookHTTPClient posts to URLs recipients chose, webhooks and push endpoints alike, so it only
+// connects to public addresses and hands redirects back as failures instead of following them.
+var webhookHTTPClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refusePrivateAddresses(errWebhookPrivateAddress),
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// InitNotificationChannels registers the in-app channel plus every external channel that is
+// configured in cfg.
+func InitNotificationChannels(cfg *config.Config) {
+	RegisterChannel(InAppChannel{})
+
+	switch {
+	case cfg.SMTPHost != "" && cfg.SMTPFrom != "":
+		RegisterChannel(&EmailChannel{Sender: &SMTPEmailSender{
+			Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.SMTPFrom,
+		}})
+		log.Println("✅ Notification email channel configured (SMTP)")
+	case cfg.LoopsAPIKey != "" && cfg.LoopsNotificationTransactionalID != "":
+		RegisterChannel(&EmailChannel{Sender: &LoopsEmailSender{
+			APIKey: cfg.LoopsAPIKey, TransactionalID: cfg.LoopsNotificationTransactionalID,
+		}})
+		log.Println("✅ Notification email channel configured (Loops)")
+	}
+	if cfg.SMSGatewayURL != "" {
+		RegisterChannel(&SMSChannel{Sender: &HTTPSMSSender{URL: cfg.SMSGatewayURL, Token: cfg.SMSGatewayToken}})
+		log.Println("✅ Notification SMS channel configured")
+	}
+	if cfg.VAPIDPublicKey != "" && cfg.VAPIDPrivateKey != "" {
+		ch, err := NewWebPushChannel(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+		if err != nil {
+			log.Printf("⚠️  Web push disabled: %v", err)
+		} else {
+			RegisterChannel(ch)
+			log.Println("✅ Notification web push channel configured")
+		}
+	}
+	RegisterChannel(&WebhookChannel{Secret: cfg.NotificationWebhookSecret})
+}
+
+// InAppChannel writes rows to the notifications table.
+type InAppChannel struct{}
+
+func (InAppChannel) Name() string { return ChannelInApp }
+
+// Accepts excludes patients without a user account; there is nobody to show the row to.
+func (InAppChannel) Accepts(r Recipient) bool { return r.Role != "patient" }
+
+func (InAppChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	var data interface{}
+	if len(m.Data) > 0 {
+		b, _ := json.Marshal(m.Data)
+		data = string(b)
+	}
+	_, err := database.PostgresDB.ExecContext(ctx, `
+		INSERT INTO notifications (recipient_id, recipient_role, title, message, type, is_read, created_at, data)
+		VALUES ($1, $2, $3, $4, $5, FALSE, NOW(), $6)
+	`, r.ID, r.Role, m.Title, m.Message, m.Type, data)
+	return err
+}
+
+// EmailSender sends one plain-text email.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// AttachmentEmailSender is implemented by email senders that can attach files.
+type AttachmentEmailSender interface {
+	SendEmailWithAttachments(ctx context.Context, to, subject, body string, attachments []NotificationAttachment) error
+}
+
+// EmailChannel delivers notifications through an EmailSender. Attachments are dropped when
+// the sender cannot carry them.
+type EmailChannel struct {
+	Sender EmailSender
+}
+
+func (c *EmailChannel) Name() string             { return ChannelEmail }
+func (c *EmailChannel) Accepts(r Recipient) bool { return r.Email != "" }
+
+func (c *EmailChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	if s, ok := c.Sender.(AttachmentEmailSender); ok && len(m.Attachments) > 0 {
+		return s.SendEmailWithAttachments(ctx, r.Email, m.Subject, m.Body, m.Attachments)
+	}
+	return c.Sender.SendEmail(ctx, r.Email, m.Subject, m.Body)
+}
+
+// SMTPEmailSender sends mail through an SMTP relay using PLAIN auth when credentials are set.
+type SMTPEmailSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPEmailSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	addr := net.JoinHostPort(s.Host, s.Port)
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + strings.ReplaceAll(subject, "\n", " ") + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(addr, auth, s.From, []string{to}, []byte(msg))
+}
+
+func (s *SMTPEmailSender) SendEmailWithAttachments(ctx context.Context, to, subject, body string, attachments []NotificationAttachment) error {
+	msg, err := buildMultipartEmail(s.From, to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(s.Host, s.Port)
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(addr, auth, s.From, []string{to}, msg)
+}
+
+// buildMultipartEmail renders a multipart/mixed message: the plain-text body followed by each
+// attachment, base64 encoded.
+func buildMultipartEmail(from, to, subject, body string, attachments []NotificationAttachment) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	buf.WriteString("From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + strings.ReplaceAll(subject, "\n", " ") + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"" + mw.Boundary() + "\"\r\n\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	for _, a := range attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// RFC 2045 limits encoded lines to 76 characters
+		enc := base64.StdEncoding.EncodeToString(a.Content)
+		var wrapped strings.Builder
+		for len(enc) > 76 {
+			wrapped.WriteString(enc[:76] + "\r\n")
+			enc = enc[76:]
+		}
+		wrapped.WriteString(enc + "\r\n")
+		if _, err := part.Write([]byte(wrapped.String())); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoopsEmailSender sends through a generic Loops transactional template with subject/body variables.
+type LoopsEmailSender struct {
+	APIKey          string
+	TransactionalID string
+}
+
+func (s *LoopsEmailSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	return sendLoopsTransactional(s.APIKey, s.TransactionalID, to, false, map[string]string{
+		"subject": subject,
+		"body":    body,
+	})
+}
+
+// MemoryEmailSender records emails instead of sending them; used in tests and local development.
+type MemoryEmailSender struct {
+	mu   sync.Mutex
+	Sent []MemoryEmail
+}
+
+type MemoryEmail struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []NotificationAttachment
+}
+
+func (s *MemoryEmailSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	return s.SendEmailWithAttachments(ctx, to, subject, body, nil)
+}
+
+func (s *MemoryEmailSender) SendEmailWithAttachments(ctx context.Context, to, subject, body string, attachments []NotificationAttachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Sent = append(s.Sent, MemoryEmail{To: to, Subject: subject, Body: body, Attachments: attachments})
+	return nil
+}
+
+// SMSSender sends one text message.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, message string) error
+}
+
+// SMSChannel delivers notifications through an SMSSender. Only recipients who opted in get SMS.
+type SMSChannel struct {
+	Sender SMSSender
+}
+
+func (c *SMSChannel) Name() string             { return ChannelSMS }
+func (c *SMSChannel) Accepts(r Recipient) bool { return r.Phone != "" }
+
+func (c *SMSChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	return c.Sender.SendSMS(ctx, r.Phone, m.Body)
+}
+
+// HTTPSMSSender posts {"to", "message"} as JSON to an SMS gateway.
+type HTTPSMSSender struct {
+	URL   string
+	Token string
+}
+
+func (s *HTTPSMSSender) SendSMS(ctx context.Context, to, message string) error {
+	body, _ := json.Marshal(map[string]string{"to": to, "message": message})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return doNotificationRequest(req)
+}
+
+// WebhookChannel POSTs the notification as JSON to the recipient's webhook_url. When Secret is
+// set the body is signed with HMAC-SHA256 in the X-Serenify-Signature header.
+type WebhookChannel struct {
+	Secret string
+	// Client defaults to webhookHTTPClient, which refuses private addresses and redirects
+	Client *http.Client
+}
+
+func (c *WebhookChannel) Name() string             { return ChannelWebhook }
+func (c *WebhookChannel) Accepts(r Recipient) bool { return r.WebhookURL != "" }
+
+func (c *WebhookChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"recipient_id":   r.ID,
+		"recipient_role": r.Role,
+		"type":           m.Type,
+		"title":          m.Title,
+		"message":        m.Message,
+		"subject":        m.Subject,
+		"body":           m.Body,
+		"data":           m.Data,
+		"sent_at":        time.Now().UTC(),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Serenify-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := c.Client
+	if client == nil {
+		client = webhookHTTPClient
+	}
+	return sendNotificationRequest(client, req)
+}
+
+// MemoryChannel records deliveries for any channel name; used in tests.
+type MemoryChannel struct {
+	ChannelName string
+	mu          sync.Mutex
+	Delivered   []RenderedNotification
+}
+
+func (c *MemoryChannel) Name() string             { return c.ChannelName }
+func (c *MemoryChannel) Accepts(r Recipient) bool { return true }
+
+func (c *MemoryChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Delivered = append(c.Delivered, m)
+	return nil
+}
+
+func doNotificationRequest(req *http.Request) error {
+	return sendNotificationRequest(notificationHTTPClient, req)
+}
+
+func sendNotificationRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// notificationPollInterval is how often the outbox worker looks for due deliveries.
+	notificationPollInterval = 15 * time.Second
+	// notificationStuckAfter returns "sending" rows to the queue when a worker died mid-delivery.
+	notificationStuckAfter = 10 * time.Minute
+	notificationBatchSize  = 50
+)
+
+// Notification is a message for one recipient. RecipientRole is one of user, therapist,
+// receptionist or patient (a patients row without a user account; no in-app delivery).
+type Notification struct {
+	RecipientID   uuid.UUID
+	RecipientRole string
+	Type          string
+	Title         string
+	Message       string
+	Data          map[string]string
+	// Attachments are only delivered by email channels whose sender supports them
+	Attachments []NotificationAttachment
+	// Channels restricts delivery to the named channels; nil means every channel
+	Channels []string
+}
+
+// NotificationAttachment is a file attached to a notification email, such as a .ics invite.
+type NotificationAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// Recipient is the resolved address book entry for a notification recipient.
+type Recipient struct {
+	ID               uuid.UUID
+	Role             string
+	Email            string
+	Phone            string
+	WebhookURL       string
+	PushSubscription json.RawMessage
+	Timezone         string
+	QuietHours       *QuietHours
+}
+
+// Channel delivers a rendered notification over one medium (in_app, email, sms, web_push, webhook).
+type Channel interface {
+	Name() string
+	// Accepts reports whether the recipient can be reached on this channel at all.
+	Accepts(r Recipient) bool
+	Send(ctx context.Context, r Recipient, m RenderedNotification) error
+}
+
+var (
+	channelsMu sync.RWMutex
+	channels   = map[string]Channel{}
+
+	// notificationWake nudges the outbox worker when new deliveries are queued.
+	notificationWake = make(chan struct{}, 1)
+)
+
+// RegisterChannel installs (or replaces) the channel for ch.Name().
+func RegisterChannel(ch Channel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[ch.Name()] = ch
+}
+
+func getChannel(name string) (Channel, bool) {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	ch, ok := channels[name]
+	return ch, ok
+}
+
+func registeredChannels() []Channel {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	out := make([]Channel, 0, len(channels))
+	for _, ch := range channels {
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// Dispatch renders n and hands it to every channel the recipient can be reached on and has
+// not opted out of. In-app delivery happens immediately; other channels go through the
+// notification_outbox so they are retried and respect quiet hours.
+func Dispatch(n Notification) error {
+	if n.RecipientID == uuid.Nil {
+		return nil
+	}
+	msg, err := RenderNotification(n)
+	if err != nil {
+		return err
+	}
+	recipient := loadRecipient(n.RecipientID, n.RecipientRole)
+	prefs := loadNotificationPreferences(n.RecipientID, n.RecipientRole)
+
+	now := time.Now().UTC()
+	sendAt := now
+	if recipient.QuietHours != nil {
+		sendAt = recipient.QuietHours.DeferUntil(now)
+	}
+
+	queued := false
+	for _, ch := range registeredChannels() {
+		if !prefs.Allows(ch.Name(), n.Type) || !ch.Accepts(recipient) {
+			continue
+		}
+		if n.Channels != nil && !slices.Contains(n.Channels, ch.Name()) {
+			continue
+		}
+		if ch.Name() == ChannelInApp {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := ch.Send(ctx, recipient, msg)
+			cancel()
+			if err == nil {
+				continue
+			}
+			log.Printf("notifications: in-app delivery to %s failed, queueing: %v", n.RecipientID, err)
+			if err := enqueueNotification(recipient, ch.Name(), msg, now); err != nil {
+				return err
+			}
+			queued = true
+			continue
+		}
+		if err := enqueueNotification(recipient, ch.Name(), msg, sendAt); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case notificationWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func enqueueNotification(r Recipient, channel string, m RenderedNotification, at time.Time) error {
+	data, _ := json.Marshal(m.Data)
+	var attachments interface{}
+	if len(m.Attachments) > 0 {
+		b, _ := json.Marshal(m.Attachments)
+		attachments = string(b)
+	}
+	_, err := database.PostgresDB.Exec(`
+		INSERT INTO notification_outbox (
+			recipient_id, recipient_role, channel, notif_type, title, message, subject, body, data,
+			attachments, next_attempt_at
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+	`, r.ID, r.Role, channel, m.Type, m.Title, m.Message, m.Subject, m.Body, string(data), attachments, at)
+	return err
+}
+
+// StartNotificationWorker delivers queued outbox rows with exponential backoff; rows that
+// exhaust max_attempts are dead-lettered (status 'dead').
+func StartNotificationWorker() {
+	go func() {
+		ticker := time.NewTicker(notificationPollInterval)
+		defer ticker.Stop()
+
+		for {
+			processNotificationOutbox()
+			select {
+			case <-ticker.C:
+			case <-notificationWake:
+			}
+		}
+	}()
+	log.Println("✅ Notification outbox worker started")
+}
+
+type outboxRow struct {
+	ID            uuid.UUID
+	RecipientID   uuid.UUID
+	RecipientRole string
+	Channel       string
+	Attempts      int
+	MaxAttempts   int
+	Message       RenderedNotification
+}
+
+func processNotificationOutbox() {
+	_, _ = database.PostgresDB.Exec(`
+		UPDATE notification_outbox SET status = 'pending', updated_at = NOW()
+		WHERE status = 'sending' AND updated_at < NOW() - make_interval(secs => $1)
+	`, notificationStuckAfter.Seconds())
+
+	now := time.Now().UTC()
+
+	rows, err := database.PostgresDB.Query(`
+		UPDATE notification_outbox SET status = 'sending', attempts = attempts + 1, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM notification_outbox
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient_id, recipient_role, channel, notif_type, title, message, subject, body,
+			COALESCE(data::text, '{}'), COALESCE(attachments::text, '[]'), attempts, max_attempts
+	`, now, notificationBatchSize)
+	if err != nil {
+		log.Printf("notifications: outbox claim: %v", err)
+		return
+	}
+	var batch []outboxRow
+	for rows.Next() {
+		var o outboxRow
+		var data, attachments string
+		if err := rows.Scan(&o.ID, &o.RecipientID, &o.RecipientRole, &o.Channel, &o.Message.Type,
+			&o.Message.Title, &o.Message.Message, &o.Message.Subject, &o.Message.Body, &data,
+			&attachments, &o.Attempts, &o.MaxAttempts); err != nil {
+			continue
+		}
+		_ = json.Unmarshal([]byte(data), &o.Message.Data)
+		_ = json.Unmarshal([]byte(attachments), &o.Message.Attachments)
+		batch = append(batch, o)
+	}
+	rows.Close()
+
+	for _, o := range batch {
+		deliverOutboxRow(o)
+	}
+}
+
+func deliverOutboxRow(o outboxRow) {
+	ch, ok := getChannel(o.Channel)
+	var err error
+	if !ok {
+		err = fmt.Errorf("channel %q is not configured", o.Channel)
+		o.Attempts = o.MaxAttempts
+	} else {
+		recipient := loadRecipient(o.RecipientID, o.RecipientRole)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = ch.Send(ctx, recipient, o.Message)
+		cancel()
+	}
+
+	if err == nil {
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE notification_outbox SET status = 'sent', sent_at = NOW(), last_error = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, o.ID)
+		return
+	}
+
+	if o.Attempts >= o.MaxAttempts {
+		log.Printf("notifications: %s delivery %s dead-lettered after %d attempts: %v", o.Channel, o.ID, o.Attempts, err)
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE notification_outbox SET status = 'dead', last_error = $2, updated_at = NOW() WHERE id = $1
+		`, o.ID, err.Error())
+		return
+	}
+	_, _ = database.PostgresDB.Exec(`
+		UPDATE notification_outbox SET status = 'pending', last_error = $2, next_attempt_at = $3, updated_at = NOW()
+		WHERE id = $1
+	`, o.ID, err.Error(), time.Now().UTC().Add(OutboxBackoff(o.Attempts)))
+}
+
+// OutboxBackoff is the delay before retry number attempt+1: 1m, 2m, 4m, ... capped at 1h.
+func OutboxBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := time.Minute
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// QuietHours is a daily window (minutes since local midnight) during which only in-app
+// notifications are delivered. Start > End means the window spans midnight.
+type QuietHours struct {
+	StartMin int
+	EndMin   int
+	Location *time.Location
+}
+
+// DeferUntil returns now if now is outside the quiet window, otherwise the moment it ends.
+func (q QuietHours) DeferUntil(now time.Time) time.Time {
+	if q.StartMin == q.EndMin {
+		return now
+	}
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	inWindow := false
+	if q.StartMin < q.EndMin {
+		inWindow = minute >= q.StartMin && minute < q.EndMin
+	} else {
+		inWindow = minute >= q.StartMin || minute < q.EndMin
+	}
+	if !inWindow {
+		return now
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), q.EndMin/60, q.EndMin%60, 0, 0, loc)
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.UTC()
+}
+
+// NotificationPreferences maps "channel|type" (type "*" for all types) to enabled.
+type NotificationPreferences map[string]bool
+
+// defaultChannelEnabled applies when a recipient has no preference for a channel. SMS is opt-in.
+var defaultChannelEnabled = map[string]bool{
+	ChannelInApp: true, ChannelEmail: true, ChannelSMS: false, ChannelWebPush: true, ChannelWebhook: true,
+}
+
+// Allows reports whether notifications of notifType may be delivered on channel.
+func (p NotificationPreferences) Allows(channel, notifType string) bool {
+	if v, ok := p[channel+"|"+notifType]; ok {
+		return v
+	}
+	if v, ok := p[channel+"|*"]; ok {
+		return v
+	}
+	return defaultChannelEnabled[channel]
+}
+
+func loadNotificationPreferences(recipientID uuid.UUID, role string) NotificationPreferences {
+	prefs := NotificationPreferences{}
+	rows, err := database.PostgresDB.Query(`
+		SELECT channel, notif_type, enabled FROM notification_preferences
+		WHERE recipient_id = $1 AND recipient_role = $2
+	`, recipientID, role)
+	if err != nil {
+		return prefs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channel, notifType string
+		var enabled bool
+		if rows.Scan(&channel, &notifType, &enabled) == nil {
+			prefs[channel+"|"+notifType] = enabled
+		}
+	}
+	return prefs
+}
+
+// loadRecipient resolves contact details from notification_settings, falling back to the
+// recipient's own profile, and the timezone from the recipient's tenant.
+func loadRecipient(id uuid.UUID, role string) Recipient {
+	r := Recipient{ID: id, Role: role}
+
+	var email, phone, tz sql.NullString
+	switch role {
+	case "therapist":
+		_ = database.PostgresDB.QueryRow(`
+			SELECT t.email, t.phone, (
+				SELECT tn.timezone FROM tenant_members m JOIN tenants tn ON tn.id = m.tenant_id
+				WHERE m.therapist_id = t.id AND m.is_active = TRUE
+				ORDER BY m.joined_at DESC LIMIT 1
+			) FROM therapists t
+			WHERE t.id = $1
+		`, id).Scan(&email, &phone, &tz)
+	case "receptionist":
+		_ = database.PostgresDB.QueryRow(`
+			SELECT r.email, NULL, tn.timezone FROM receptionists r
+			JOIN tenants tn ON tn.id = r.tenant_id
+			WHERE r.id = $1
+		`, id).Scan(&email, &phone, &tz)
+	case "patient":
+		_ = database.PostgresDB.QueryRow(`
+			SELECT p.email, p.phone, tn.timezone FROM patients p
+			JOIN tenants tn ON tn.id = p.tenant_id
+			WHERE p.id = $1 AND p.deleted_at IS NULL
+		`, id).Scan(&email, &phone, &tz)
+	default:
+		_ = database.PostgresDB.QueryRow(`
+			SELECT p.email, p.phone, tn.timezone FROM patients p
+			JOIN tenants tn ON tn.id = p.tenant_id
+			WHERE p.user_id = $1 AND p.deleted_at IS NULL
+			ORDER BY p.created_at DESC LIMIT 1
+		`, id).Scan(&email, &phone, &tz)
+	}
+	r.Email, r.Phone, r.Timezone = email.String, phone.String, tz.String
+
+	var sEmail, sPhone, sWebhook, sTZ, quietStart, quietEnd sql.NullString
+	var push []byte
+	err := database.PostgresDB.QueryRow(`
+		SELECT email, phone, webhook_url, timezone, push_subscription::text,
+			to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI')
+		FROM notification_settings WHERE recipient_id = $1 AND recipient_role = $2
+	`, id, role).Scan(&sEmail, &sPhone, &sWebhook, &sTZ, &push, &quietStart, &quietEnd)
+	if err == nil {
+		if sEmail.String != "" {
+			r.Email = sEmail.String
+		}
+		if sPhone.String != "" {
+			r.Phone = sPhone.String
+		}
+		if sTZ.String != "" {
+			r.Timezone = sTZ.String
+		}
+		r.WebhookURL = sWebhook.String
+		if len(push) > 0 {
+			r.PushSubscription = json.RawMessage(push)
+		}
+	}
+	if r.Timezone == "" {
+		r.Timezone = "Asia/Kolkata"
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		loc, _ := time.LoadLocation(r.Timezone)
+		start, _ := ParseTimeOnly(quietStart.String)
+		end, _ := ParseTimeOnly(quietEnd.String)
+		r.QuietHours = &QuietHours{
+			StartMin: start.Hour()*60 + start.Minute(),
+			EndMin:   end.Hour()*60 + end.Minute(),
+			Location: loc,
+		}
+	}
+	return r
+}
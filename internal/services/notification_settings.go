@@ -0,0 +1,189 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// NotificationSettings are a recipient's contact overrides, quiet hours and channel toggles.
+type NotificationSettings struct {
+	QuietStart       string                   `json:"quiet_start"` // "HH:MM", empty when disabled
+	QuietEnd         string                   `json:"quiet_end"`
+	Timezone         string                   `json:"timezone"` // empty means the tenant timezone
+	Email            string                   `json:"email"`
+	Phone            string                   `json:"phone"`
+	WebhookURL       string                   `json:"webhook_url"`
+	PushSubscription json.RawMessage          `json:"push_subscription,omitempty"`
+	Preferences      []NotificationPreference `json:"preferences"`
+}
+
+// NotificationPreference enables or disables a channel for one notification type ("*" for all).
+type NotificationPreference struct {
+	Channel string `json:"channel"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+var notificationChannelNames = map[string]bool{
+	ChannelInApp: true, ChannelEmail: true, ChannelSMS: true, ChannelWebPush: true, ChannelWebhook: true,
+}
+
+// Validate checks the settings and normalises empty preference types to "*".
+func (s *NotificationSettings) Validate() error {
+	if (s.QuietStart == "") != (s.QuietEnd == "") {
+		return errors.New("quiet_start and quiet_end must be set together")
+	}
+	if s.QuietStart != "" {
+		if _, err := ParseTimeOnly(s.QuietStart); err != nil {
+			return errors.New("quiet_start must be HH:MM")
+		}
+		if _, err := ParseTimeOnly(s.QuietEnd); err != nil {
+			return errors.New("quiet_end must be HH:MM")
+		}
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return errors.New("unknown timezone")
+		}
+	}
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return errors.New("webhook_url must be an https URL")
+		}
+		if !publicHost(u.Hostname()) {
+			return errors.New("webhook_url must point to a public address")
+		}
+	}
+	if len(s.PushSubscription) > 0 && string(s.PushSubscription) != "null" {
+		var sub PushSubscription
+		if err := json.Unmarshal(s.PushSubscription, &sub); err != nil || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+			return errors.New("invalid push_subscription")
+		}
+		u, err := url.Parse(sub.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return errors.New("push_subscription endpoint must be https")
+		}
+		if !publicHost(u.Hostname()) {
+			return errors.New("push_subscription endpoint must point to a public address")
+		}
+	} else {
+		s.PushSubscription = nil
+	}
+	for i := range s.Preferences {
+		p := &s.Preferences[i]
+		if !notificationChannelNames[p.Channel] {
+			return errors.New("unknown channel " + p.Channel)
+		}
+		if p.Type == "" {
+			p.Type = "*"
+		}
+	}
+	return nil
+}
+
+// publicHost rejects literal private addresses and localhost names. Names that resolve to a
+// private address are refused later, when webhookHTTPClient dials.
+func publicHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return publicIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// GetNotificationSettings returns the stored settings; a recipient without a row gets zero values.
+func GetNotificationSettings(recipientID uuid.UUID, role string) (NotificationSettings, error) {
+	s := NotificationSettings{Preferences: []NotificationPreference{}}
+	var quietStart, quietEnd, tz, email, phone, webhook sql.NullString
+	var push []byte
+	err := database.PostgresDB.QueryRow(`
+		SELECT to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI'), timezone, email, phone,
+			webhook_url, push_subscription::text
+		FROM notification_settings WHERE recipient_id = $1 AND recipient_role = $2
+	`, recipientID, role).Scan(&quietStart, &quietEnd, &tz, &email, &phone, &webhook, &push)
+	if err != nil && err != sql.ErrNoRows {
+		return s, err
+	}
+	s.QuietStart, s.QuietEnd, s.Timezone = quietStart.String, quietEnd.String, tz.String
+	s.Email, s.Phone, s.WebhookURL = email.String, phone.String, webhook.String
+	if len(push) > 0 {
+		s.PushSubscription = json.RawMessage(push)
+	}
+
+	rows, err := database.PostgresDB.Query(`
+		SELECT channel, notif_type, enabled FROM notification_preferences
+		WHERE recipient_id = $1 AND recipient_role = $2
+		ORDER BY channel, notif_type
+	`, recipientID, role)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.Channel, &p.Type, &p.Enabled); err != nil {
+			return s, err
+		}
+		s.Preferences = append(s.Preferences, p)
+	}
+	return s, rows.Err()
+}
+
+// SaveNotificationSettings replaces the recipient's settings and upserts the given preferences.
+// Preferences not mentioned are left as they are.
+func SaveNotificationSettings(recipientID uuid.UUID, role string, s NotificationSettings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var push interface{}
+	if len(s.PushSubscription) > 0 {
+		push = string(s.PushSubscription)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO notification_settings (
+			recipient_id, recipient_role, quiet_start, quiet_end, timezone, email, phone, webhook_url,
+			push_subscription, updated_at
+		) VALUES ($1, $2, $3::time, $4::time, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (recipient_id, recipient_role) DO UPDATE SET
+			quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end, timezone = EXCLUDED.timezone,
+			email = EXCLUDED.email, phone = EXCLUDED.phone, webhook_url = EXCLUDED.webhook_url,
+			push_subscription = EXCLUDED.push_subscription, updated_at = NOW()
+	`, recipientID, role, nullIfEmpty(s.QuietStart), nullIfEmpty(s.QuietEnd), nullIfEmpty(s.Timezone),
+		nullIfEmpty(s.Email), nullIfEmpty(s.Phone), nullIfEmpty(s.WebhookURL), push)
+	if err != nil {
+		return err
+	}
+	for _, p := range s.Preferences {
+		if _, err := tx.Exec(`
+			INSERT INTO notification_preferences (recipient_id, recipient_role, channel, notif_type, enabled, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
+			ON CONFLICT (recipient_id, recipient_role, channel, notif_type) DO UPDATE SET
+				enabled = EXCLUDED.enabled, updated_at = NOW()
+		`, recipientID, role, p.Channel, p.Type, p.Enabled); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
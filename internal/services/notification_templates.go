@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// RenderedNotification is a notification after its type template has been applied.
+// Title/Message are the raw in-app text; Subject/Body are used by external channels.
+type RenderedNotification struct {
+	Type        string
+	Title       string
+	Message     string
+	Subject     string
+	Body        string
+	Data        map[string]string
+	Attachments []NotificationAttachment
+}
+
+// NotificationTemplate holds text/template sources evaluated against a Notification.
+type NotificationTemplate struct {
+	Subject string
+	Body    string
+}
+
+var (
+	notificationTemplatesMu sync.RWMutex
+	notificationTemplates   = map[string]NotificationTemplate{
+		"appointment_reminder": {
+			Subject: "Reminder: your session with {{.Data.therapist_name}} is in {{.Data.starts_in}}",
+			Body:    "{{.Message}}{{if .Data.meeting_link}}\n\nJoin online: {{.Data.meeting_link}}{{end}}{{if .Data.location}}\n\nLocation: {{.Data.location}}{{end}}",
+		},
+		"task_assigned": {
+			Subject: "New task from your therapist",
+			Body:    "Your therapist assigned you a new task: {{.Message}}",
+		},
+		"prescription": {
+			Subject: "New prescription",
+			Body:    "A new prescription was added to your care plan: {{.Message}}",
+		},
+		"invoice": {
+			Subject: "{{.Title}}",
+			Body:    "{{.Message}}",
+		},
+		"appointment_invite": {
+			Subject: "{{.Title}}",
+			Body:    "{{.Message}}{{if .Data.meeting_link}}\n\nJoin online: {{.Data.meeting_link}}{{end}}{{if .Data.location}}\n\nLocation: {{.Data.location}}{{end}}",
+		},
+		"calendar": {
+			Subject: "{{.Title}}",
+			Body:    "{{.Message}}",
+		},
+	}
+	defaultNotificationTemplate = NotificationTemplate{Subject: "{{.Title}}", Body: "{{.Message}}"}
+)
+
+// RegisterNotificationTemplate sets the subject/body template used for a notification type.
+func RegisterNotificationTemplate(notifType string, t NotificationTemplate) error {
+	if _, err := template.New("subject").Parse(t.Subject); err != nil {
+		return err
+	}
+	if _, err := template.New("body").Parse(t.Body); err != nil {
+		return err
+	}
+	notificationTemplatesMu.Lock()
+	defer notificationTemplatesMu.Unlock()
+	notificationTemplates[notifType] = t
+	return nil
+}
+
+// RenderNotification applies the template registered for n.Type (or the default one).
+func RenderNotification(n Notification) (RenderedNotification, error) {
+	notificationTemplatesMu.RLock()
+	t, ok := notificationTemplates[n.Type]
+	notificationTemplatesMu.RUnlock()
+	if !ok {
+		t = defaultNotificationTemplate
+	}
+	if n.Data == nil {
+		n.Data = map[string]string{}
+	}
+
+	out := RenderedNotification{Type: n.Type, Title: n.Title, Message: n.Message, Data: n.Data, Attachments: n.Attachments}
+	var err error
+	if out.Subject, err = renderNotificationText(t.Subject, n); err != nil {
+		return out, err
+	}
+	if out.Body, err = renderNotificationText(t.Body, n); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func renderNotificationText(src string, n Notification) (string, error) {
+	tmpl, err := template.New("n").Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
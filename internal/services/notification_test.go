@@ -0,0 +1,291 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursDeferUntil(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	q := QuietHours{StartMin: 22 * 60, EndMin: 7 * 60, Location: loc}
+
+	// 23:30 IST is inside the overnight window; delivery moves to 07:00 IST the next day.
+	now := time.Date(2026, 3, 1, 23, 30, 0, 0, loc)
+	want := time.Date(2026, 3, 2, 7, 0, 0, 0, loc)
+	if got := q.DeferUntil(now); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// 03:00 IST is inside the window after midnight.
+	now = time.Date(2026, 3, 2, 3, 0, 0, 0, loc)
+	if got := q.DeferUntil(now); !got.Equal(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// 12:00 IST is outside.
+	now = time.Date(2026, 3, 2, 12, 0, 0, 0, loc)
+	if got := q.DeferUntil(now); !got.Equal(now) {
+		t.Fatalf("got %v, want %v", got, now)
+	}
+
+	day := QuietHours{StartMin: 13 * 60, EndMin: 14 * 60, Location: loc}
+	now = time.Date(2026, 3, 2, 13, 15, 0, 0, loc)
+	if got := day.DeferUntil(now); !got.Equal(time.Date(2026, 3, 2, 14, 0, 0, 0, loc)) {
+		t.Fatalf("same-day window: got %v", got)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 20: time.Hour}
+	for attempt, want := range cases {
+		if got := OutboxBackoff(attempt); got != want {
+			t.Errorf("attempt %d: got %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestNotificationPreferencesAllows(t *testing.T) {
+	p := NotificationPreferences{
+		"email|*":           false,
+		"email|invoice":     true,
+		"sms|*":             true,
+		"web_push|calendar": false,
+	}
+	if !p.Allows(ChannelEmail, "invoice") || p.Allows(ChannelEmail, "task_assigned") {
+		t.Fatal("type-specific preference should override the wildcard")
+	}
+	if !p.Allows(ChannelSMS, "invoice") {
+		t.Fatal("sms opt-in not honoured")
+	}
+	if (NotificationPreferences{}).Allows(ChannelSMS, "invoice") {
+		t.Fatal("sms should be opt-in by default")
+	}
+	if p.Allows(ChannelWebPush, "calendar") || !p.Allows(ChannelWebPush, "invoice") {
+		t.Fatal("web push preferences not applied")
+	}
+}
+
+func TestRenderNotificationAppointmentReminder(t *testing.T) {
+	m, err := RenderNotification(Notification{
+		Type:    "appointment_reminder",
+		Title:   "Upcoming session reminder",
+		Message: "Your session starts soon.",
+		Data:    map[string]string{"therapist_name": "Dr. Rao", "starts_in": "1 hour", "meeting_link": "https://meet.example/x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "Reminder: your session with Dr. Rao is in 1 hour" {
+		t.Fatalf("subject %q", m.Subject)
+	}
+	if !strings.Contains(m.Body, "Join online: https://meet.example/x") || strings.Contains(m.Body, "Location") {
+		t.Fatalf("body %q", m.Body)
+	}
+
+	m, err = RenderNotification(Notification{Type: "unknown", Title: "Hello", Message: "World"})
+	if err != nil || m.Subject != "Hello" || m.Body != "World" {
+		t.Fatalf("default template: %+v %v", m, err)
+	}
+}
+
+func TestEmailChannelWithMemorySender(t *testing.T) {
+	sender := &MemoryEmailSender{}
+	ch := &EmailChannel{Sender: sender}
+	if ch.Accepts(Recipient{}) {
+		t.Fatal("recipient without email accepted")
+	}
+	r := Recipient{Email: "patient@example.com"}
+	if err := ch.Send(context.Background(), r, RenderedNotification{Subject: "s", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Sent) != 1 || sender.Sent[0].To != "patient@example.com" || sender.Sent[0].Subject != "s" {
+		t.Fatalf("unexpected sent %+v", sender.Sent)
+	}
+}
+
+func TestWebhookChannelRefusesPrivateAddressesAndRedirects(t *testing.T) {
+	var hits int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/hook", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	r := Recipient{WebhookURL: srv.URL + "/hook"}
+	m := RenderedNotification{Type: "test", Title: "t"}
+
+	if err := (&WebhookChannel{}).Send(context.Background(), r, m); !errors.Is(err, errWebhookPrivateAddress) {
+		t.Fatalf("expected errWebhookPrivateAddress, got %v", err)
+	}
+
+	// Swap the dialer for the test server's so the redirect handling runs
+	client := *webhookHTTPClient
+	client.Transport = srv.Client().Transport
+	ch := &WebhookChannel{Client: &client}
+	if err := ch.Send(context.Background(), r, m); err != nil {
+		t.Fatal(err)
+	}
+	r.WebhookURL = srv.URL + "/moved"
+	if err := ch.Send(context.Background(), r, m); err == nil {
+		t.Fatal("redirect followed")
+	}
+	if hits != 2 {
+		t.Fatalf("expected 2 requests, got %d", hits)
+	}
+
+	for _, u := range []string{"https://127.0.0.1/hook", "https://[::1]/hook", "https://10.0.0.8/hook", "https://localhost/hook", "http://example.com/hook"} {
+		s := NotificationSettings{WebhookURL: u}
+		if err := s.Validate(); err == nil {
+			t.Fatalf("webhook_url %q accepted", u)
+		}
+	}
+}
+
+func TestWebPushChannelRefusesPrivateEndpoints(t *testing.T) {
+	vapid, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ch := &WebPushChannel{privateKey: vapid, subject: "mailto:ops@example.com"}
+	ua, _ := ecdh.P256().GenerateKey(rand.Reader)
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	var hits int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	sub := PushSubscription{Endpoint: srv.URL + "/push"}
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	raw, _ := json.Marshal(sub)
+	r := Recipient{PushSubscription: raw}
+	m := RenderedNotification{Type: "test", Subject: "s", Body: "b"}
+
+	if err := ch.Send(context.Background(), r, m); !errors.Is(err, errWebhookPrivateAddress) {
+		t.Fatalf("expected errWebhookPrivateAddress, got %v", err)
+	}
+	if hits != 0 {
+		t.Fatalf("private endpoint reached %d times", hits)
+	}
+
+	for _, endpoint := range []string{"https://127.0.0.1/push", "https://[::1]/push", "https://192.168.1.4/push", "https://push.localhost/push"} {
+		sub.Endpoint = endpoint
+		raw, _ := json.Marshal(sub)
+		s := NotificationSettings{PushSubscription: raw}
+		if err := s.Validate(); err == nil {
+			t.Fatalf("push endpoint %q accepted", endpoint)
+		}
+	}
+	sub.Endpoint = "https://fcm.googleapis.com/fcm/send/abc"
+	raw, _ = json.Marshal(sub)
+	if s := (NotificationSettings{PushSubscription: raw}); s.Validate() != nil {
+		t.Fatalf("public push endpoint rejected: %v", s.Validate())
+	}
+}
+
+func TestEmailChannelAttachments(t *testing.T) {
+	sender := &MemoryEmailSender{}
+	ch := &EmailChannel{Sender: sender}
+	invite := NotificationAttachment{Filename: "invite.ics", ContentType: "text/calendar; method=REQUEST", Content: []byte("BEGIN:VCALENDAR")}
+	m := RenderedNotification{Subject: "s", Body: "b", Attachments: []NotificationAttachment{invite}}
+	if err := ch.Send(context.Background(), Recipient{Email: "patient@example.com"}, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.Sent) != 1 || len(sender.Sent[0].Attachments) != 1 || sender.Sent[0].Attachments[0].Filename != "invite.ics" {
+		t.Fatalf("attachment not delivered: %+v", sender.Sent)
+	}
+
+	msg, err := buildMultipartEmail("clinic@example.com", "patient@example.com", "Session booked", "Line one\nLine two", []NotificationAttachment{invite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected content type %q: %v", mediaType, err)
+	}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := io.ReadAll(body); string(text) != "Line one\r\nLine two" {
+		t.Fatalf("unexpected body %q", text)
+	}
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part.FileName() != "invite.ics" || part.Header.Get("Content-Type") != invite.ContentType {
+		t.Fatalf("unexpected attachment headers %v", part.Header)
+	}
+	encoded, _ := io.ReadAll(part)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || string(decoded) != "BEGIN:VCALENDAR" {
+		t.Fatalf("unexpected attachment content %q: %v", decoded, err)
+	}
+}
+
+func TestEncryptWebPushRoundTrip(t *testing.T) {
+	uaPrivate, _ := ecdh.P256().GenerateKey(rand.Reader)
+	asPrivate, _ := ecdh.P256().GenerateKey(rand.Reader)
+	authSecret := make([]byte, 16)
+	salt := make([]byte, 16)
+	rand.Read(authSecret)
+	rand.Read(salt)
+
+	payload := []byte(`{"title":"hi"}`)
+	out, err := encryptWebPushWithKeys(uaPrivate.PublicKey(), authSecret, asPrivate, salt, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decrypt as the user agent would.
+	if binary.BigEndian.Uint32(out[16:20]) != 4096 || out[20] != 65 {
+		t.Fatal("bad header")
+	}
+	asPublic, err := ecdh.P256().NewPublicKey(out[21:86])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, _ := uaPrivate.ECDH(asPublic)
+	prkKey, _ := hkdf.Extract(sha256.New, shared, authSecret)
+	ikm, _ := hkdf.Expand(sha256.New, prkKey, "WebPush: info\x00"+string(uaPrivate.PublicKey().Bytes())+string(asPublic.Bytes()), 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, out[:16])
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, out[86:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != string(payload)+"\x02" {
+		t.Fatalf("got %q", plain)
+	}
+}
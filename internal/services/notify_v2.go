@@ -1,27 +1,42 @@
 package services
 
 import (
+	"log"
+
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/google/uuid"
 )
 
+// NotifyUser dispatches a notification to every channel the recipient has enabled.
 func NotifyUser(userID uuid.UUID, role, title, message, notifType string) {
 	if userID == uuid.Nil {
 		return
 	}
-	_, _ = database.PostgresDB.Exec(`
-		INSERT INTO notifications (recipient_id, recipient_role, title, message, type, is_read, created_at)
-		VALUES ($1, $2, $3, $4, $5, FALSE, NOW())
-	`, userID, role, title, message, notifType)
+	err := Dispatch(Notification{
+		RecipientID:   userID,
+		RecipientRole: role,
+		Type:          notifType,
+		Title:         title,
+		Message:       message,
+	})
+	if err != nil {
+		log.Printf("notifications: dispatch %s to %s %s: %v", notifType, role, userID, err)
+	}
 }
 
+// NotifyPatientByID notifies the patient's user account, or the patient record itself
+// (email/SMS only) when the patient has not signed up.
 func NotifyPatientByID(patientID uuid.UUID, title, message, notifType string) {
-	var userID uuid.UUID
+	var userID uuid.NullUUID
 	err := database.PostgresDB.QueryRow(
-		`SELECT user_id FROM patients WHERE id = $1 AND user_id IS NOT NULL`, patientID,
+		`SELECT user_id FROM patients WHERE id = $1`, patientID,
 	).Scan(&userID)
 	if err != nil {
 		return
 	}
-	NotifyUser(userID, "user", title, message, notifType)
+	if userID.Valid {
+		NotifyUser(userID.UUID, "user", title, message, notifType)
+		return
+	}
+	NotifyUser(patientID, "patient", title, message, notifType)
 }
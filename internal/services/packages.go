@@ -0,0 +1,541 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPackageNotFound = errors.New("session package not found")
+	ErrPackageInvalid  = errors.New("invalid session package")
+	ErrPackageInactive = errors.New("session package is not on sale")
+	ErrNoPackageCredit = errors.New("no package credit available")
+)
+
+// Patient package statuses.
+const (
+	PackagePendingPayment = "pending_payment"
+	PackageActive         = "active"
+	PackageExhausted      = "exhausted"
+	PackageExpired        = "expired"
+)
+
+// Package ledger entries. Purchases grant credits, sessions draw one and expiry forfeits the rest.
+const (
+	packageEntryPurchase = "purchase"
+	packageEntrySession  = "session"
+	packageEntryExpiry   = "expiry"
+)
+
+// ValidateSessionPackage normalizes p and checks it can be sold.
+func ValidateSessionPackage(p *models.SessionPackage) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: name is required", ErrPackageInvalid)
+	case p.SessionCount <= 0:
+		return fmt.Errorf("%w: session_count must be positive", ErrPackageInvalid)
+	case p.Price <= 0:
+		return fmt.Errorf("%w: price must be positive", ErrPackageInvalid)
+	case p.ValidityDays <= 0:
+		return fmt.Errorf("%w: validity_days must be positive", ErrPackageInvalid)
+	case p.AppointmentType != "" && !ValidateAppointmentType(p.AppointmentType):
+		return fmt.Errorf("%w: unknown appointment_type", ErrPackageInvalid)
+	}
+	return nil
+}
+
+const sessionPackageColumns = `id, tenant_id, name, COALESCE(description, ''), session_count, price, validity_days,
+	COALESCE(appointment_type, ''), is_active, created_at, updated_at`
+
+func scanSessionPackage(s rowScanner) (models.SessionPackage, error) {
+	var p models.SessionPackage
+	err := s.Scan(&p.ID, &p.TenantID, &p.Name, &p.Description, &p.SessionCount, &p.Price, &p.ValidityDays,
+		&p.AppointmentType, &p.IsActive, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func ListSessionPackages(tenantID uuid.UUID, activeOnly bool) ([]models.SessionPackage, error) {
+	query := `SELECT ` + sessionPackageColumns + ` FROM session_packages WHERE tenant_id = $1`
+	if activeOnly {
+		query += ` AND is_active`
+	}
+	rows, err := database.PostgresDB.Query(query+` ORDER BY is_active DESC, session_count, name`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	packages := make([]models.SessionPackage, 0)
+	for rows.Next() {
+		p, err := scanSessionPackage(rows)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
+
+func GetSessionPackage(tenantID, id uuid.UUID) (models.SessionPackage, error) {
+	p, err := scanSessionPackage(database.PostgresDB.QueryRow(`
+		SELECT `+sessionPackageColumns+` FROM session_packages WHERE id = $1 AND tenant_id = $2
+	`, id, tenantID))
+	if err == sql.ErrNoRows {
+		return p, ErrPackageNotFound
+	}
+	return p, err
+}
+
+func CreateSessionPackage(p models.SessionPackage) (models.SessionPackage, error) {
+	if err := ValidateSessionPackage(&p); err != nil {
+		return p, err
+	}
+	return scanSessionPackage(database.PostgresDB.QueryRow(`
+		INSERT INTO session_packages (tenant_id, name, description, session_count, price, validity_days, appointment_type, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+sessionPackageColumns,
+		p.TenantID, p.Name, nullIfEmpty(p.Description), p.SessionCount, p.Price, p.ValidityDays,
+		nullIfEmpty(p.AppointmentType), p.IsActive))
+}
+
+// UpdateSessionPackage saves edited terms. Packages already sold keep the terms they were sold on.
+func UpdateSessionPackage(p models.SessionPackage) (models.SessionPackage, error) {
+	if err := ValidateSessionPackage(&p); err != nil {
+		return p, err
+	}
+	out, err := scanSessionPackage(database.PostgresDB.QueryRow(`
+		UPDATE session_packages SET
+			name = $3, description = $4, session_count = $5, price = $6, validity_days = $7,
+			appointment_type = $8, is_active = $9, updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING `+sessionPackageColumns,
+		p.ID, p.TenantID, p.Name, nullIfEmpty(p.Description), p.SessionCount, p.Price, p.ValidityDays,
+		nullIfEmpty(p.AppointmentType), p.IsActive))
+	if err == sql.ErrNoRows {
+		return out, ErrPackageNotFound
+	}
+	return out, err
+}
+
+// PurchaseSessionPackage sells a package to a patient. It creates a draft invoice for the package
+// and a pending patient package; the credits are granted once the invoice is paid, through
+// whichever payment flow settles it.
+func PurchaseSessionPackage(tenantID, patientID, packageID uuid.UUID, createdBy *uuid.UUID) (models.PatientPackage, error) {
+	pkg, err := GetSessionPackage(tenantID, packageID)
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+	if !pkg.IsActive {
+		return models.PatientPackage{}, ErrPackageInactive
+	}
+	profile, err := GetBillingProfile(tenantID)
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+
+	items := []models.InvoiceLineItem{{
+		Description: fmt.Sprintf("%s — %d sessions, valid %d days", pkg.Name, pkg.SessionCount, pkg.ValidityDays),
+		Amount:      pkg.Price,
+	}}
+	gst, total := CalcInvoiceTotals(pkg.Price, profile.GSTRate)
+	itemsJSON, _ := json.Marshal(items)
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+	defer tx.Rollback()
+
+	var invoiceID uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO invoices (
+			tenant_id, patient_id, subtotal, gst_amount, total, currency, status, due_at, line_items, notes
+		) VALUES ($1,$2,$3,$4,$5,$6,'draft',$7,$8,$9)
+		RETURNING id
+	`, tenantID, patientID, pkg.Price, gst, total, profile.Currency, time.Now().AddDate(0, 0, 7), string(itemsJSON),
+		"Session package: "+pkg.Name).Scan(&invoiceID)
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO patient_packages (
+			tenant_id, patient_id, package_id, invoice_id, name, appointment_type,
+			sessions_total, price, validity_days, status, created_by
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,'pending_payment',$10)
+		RETURNING id
+	`, tenantID, patientID, pkg.ID, invoiceID, pkg.Name, nullIfEmpty(pkg.AppointmentType),
+		pkg.SessionCount, total, pkg.ValidityDays, createdBy).Scan(&id)
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.PatientPackage{}, err
+	}
+	return GetPatientPackage(tenantID, id)
+}
+
+// activatePackagesForInvoice grants the credits of packages bought with a now fully paid invoice.
+// The validity period starts at payment.
+func activatePackagesForInvoice(tx *sql.Tx, tenantID, invoiceID uuid.UUID) error {
+	rows, err := tx.Query(`
+		UPDATE patient_packages pp SET
+			status = 'active', activated_at = NOW(),
+			expires_at = NOW() + pp.validity_days * INTERVAL '1 day',
+			price = i.total, updated_at = NOW()
+		FROM invoices i
+		WHERE pp.invoice_id = i.id AND i.id = $1 AND i.tenant_id = $2
+			AND i.status = 'paid' AND pp.status = 'pending_payment'
+		RETURNING pp.id, pp.patient_id, pp.sessions_total
+	`, invoiceID, tenantID)
+	if err != nil {
+		return err
+	}
+	type grant struct {
+		id, patientID uuid.UUID
+		sessions      int
+	}
+	var grants []grant
+	for rows.Next() {
+		var g grant
+		if err := rows.Scan(&g.id, &g.patientID, &g.sessions); err != nil {
+			rows.Close()
+			return err
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+	for _, g := range grants {
+		if _, err := tx.Exec(`
+			INSERT INTO package_ledger (tenant_id, patient_package_id, patient_id, entry, sessions)
+			VALUES ($1, $2, $3, $4, $5)
+		`, tenantID, g.id, g.patientID, packageEntryPurchase, g.sessions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patientPackageColumns reads a patient package with the number of credits held by booked
+// appointments that have not taken place yet.
+const patientPackageColumns = `pp.id, pp.tenant_id, pp.patient_id, pp.package_id, pp.invoice_id, pp.name,
+	COALESCE(pp.appointment_type, ''), pp.sessions_total, pp.sessions_used, pp.price, pp.validity_days, pp.status,
+	pp.activated_at, pp.expires_at, pp.created_at,
+	(SELECT COUNT(*) FROM appointments a WHERE a.patient_package_id = pp.id AND a.status IN ('scheduled', 'confirmed'))`
+
+func scanPatientPackage(s rowScanner, now time.Time) (models.PatientPackage, error) {
+	var p models.PatientPackage
+	var packageID, invoiceID uuid.NullUUID
+	var activated, expires sql.NullTime
+	err := s.Scan(&p.ID, &p.TenantID, &p.PatientID, &packageID, &invoiceID, &p.Name,
+		&p.AppointmentType, &p.SessionsTotal, &p.SessionsUsed, &p.Price, &p.ValidityDays, &p.Status,
+		&activated, &expires, &p.CreatedAt, &p.SessionsReserved)
+	if err != nil {
+		return p, err
+	}
+	if packageID.Valid {
+		p.PackageID = &packageID.UUID
+	}
+	if invoiceID.Valid {
+		p.InvoiceID = &invoiceID.UUID
+	}
+	if activated.Valid {
+		p.ActivatedAt = &activated.Time
+	}
+	if expires.Valid {
+		p.ExpiresAt = &expires.Time
+	}
+	p.SessionsAvailable = packageCreditsAvailable(p, now)
+	return p, nil
+}
+
+// packageCreditsAvailable is what can still be booked or used: unused credits of an active,
+// unexpired package less those held by upcoming appointments.
+func packageCreditsAvailable(p models.PatientPackage, now time.Time) int {
+	if p.Status != PackageActive || p.ExpiresAt == nil || !p.ExpiresAt.After(now) {
+		return 0
+	}
+	if n := p.SessionsTotal - p.SessionsUsed - p.SessionsReserved; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// packageCreditFor picks the package a session draws from: the one it was booked against while
+// that has a credit, otherwise the matching package that expires first.
+func packageCreditFor(pkgs []models.PatientPackage, aptType string, bookedAgainst uuid.UUID) (models.PatientPackage, bool) {
+	var candidates []models.PatientPackage
+	for _, p := range pkgs {
+		if p.SessionsAvailable <= 0 || (p.AppointmentType != "" && p.AppointmentType != aptType) {
+			continue
+		}
+		if p.ID == bookedAgainst {
+			return p, true
+		}
+		candidates = append(candidates, p)
+	}
+	if len(candidates) == 0 {
+		return models.PatientPackage{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ExpiresAt.Before(*candidates[j].ExpiresAt)
+	})
+	return candidates[0], true
+}
+
+// packageSessionRevenue is the share of a package's price recognized when n more sessions are
+// used after usedBefore. Shares are rounded cumulatively, so all sessions add up to the price.
+func packageSessionRevenue(price float64, total, usedBefore, n int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	paise := toPaise(price)
+	recognized := func(used int) int64 {
+		return (paise*int64(used)*2 + int64(total)) / (int64(total) * 2)
+	}
+	return fromPaise(recognized(usedBefore+n) - recognized(usedBefore))
+}
+
+func GetPatientPackage(tenantID, id uuid.UUID) (models.PatientPackage, error) {
+	p, err := scanPatientPackage(database.PostgresDB.QueryRow(`
+		SELECT `+patientPackageColumns+` FROM patient_packages pp WHERE pp.id = $1 AND pp.tenant_id = $2
+	`, id, tenantID), time.Now())
+	if err == sql.ErrNoRows {
+		return p, ErrPackageNotFound
+	}
+	return p, err
+}
+
+// ListPatientPackages returns a patient's packages, newest first.
+func ListPatientPackages(tenantID, patientID uuid.UUID) ([]models.PatientPackage, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT `+patientPackageColumns+` FROM patient_packages pp
+		WHERE pp.tenant_id = $1 AND pp.patient_id = $2
+		ORDER BY pp.created_at DESC
+	`, tenantID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now()
+	packages := make([]models.PatientPackage, 0)
+	for rows.Next() {
+		p, err := scanPatientPackage(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
+
+// ListPackageLedger returns a patient's credit movements, newest first.
+func ListPackageLedger(tenantID, patientID uuid.UUID, limit int) ([]models.PackageLedgerEntry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, patient_package_id, patient_id, appointment_id, entry, sessions, revenue, created_at
+		FROM package_ledger WHERE tenant_id = $1 AND patient_id = $2
+		ORDER BY created_at DESC LIMIT $3
+	`, tenantID, patientID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]models.PackageLedgerEntry, 0)
+	for rows.Next() {
+		var e models.PackageLedgerEntry
+		var aptID uuid.NullUUID
+		if err := rows.Scan(&e.ID, &e.PatientPackageID, &e.PatientID, &aptID, &e.Entry, &e.Sessions, &e.Revenue, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if aptID.Valid {
+			e.AppointmentID = &aptID.UUID
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// lockPatientPackages locks a patient's active packages so credits are not handed out twice.
+func lockPatientPackages(tx *sql.Tx, tenantID, patientID uuid.UUID) ([]models.PatientPackage, error) {
+	rows, err := tx.Query(`
+		SELECT `+patientPackageColumns+` FROM patient_packages pp
+		WHERE pp.tenant_id = $1 AND pp.patient_id = $2 AND pp.status = 'active' AND pp.expires_at > NOW()
+		ORDER BY pp.expires_at
+		FOR UPDATE OF pp
+	`, tenantID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now()
+	var packages []models.PatientPackage
+	for rows.Next() {
+		p, err := scanPatientPackage(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
+
+// ReservePackageCredit picks the package a new booking of aptType will be paid from. The caller
+// stores the package on the appointment in the same transaction, which holds the credit.
+func ReservePackageCredit(tx *sql.Tx, tenantID, patientID uuid.UUID, aptType string) (models.PatientPackage, error) {
+	pkgs, err := lockPatientPackages(tx, tenantID, patientID)
+	if err != nil {
+		return models.PatientPackage{}, err
+	}
+	p, ok := packageCreditFor(pkgs, aptType, uuid.Nil)
+	if !ok {
+		return p, ErrNoPackageCredit
+	}
+	return p, nil
+}
+
+// ConsumePackageCredit draws one credit for a completed appointment and recognizes its share of
+// the package price. It reports false when the patient has no usable credit, in which case the
+// session is invoiced as usual. Consuming the same appointment again is a no-op.
+func ConsumePackageCredit(tenantID, appointmentID uuid.UUID) (bool, error) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var patientID uuid.UUID
+	var aptType, status string
+	var bookedAgainst uuid.NullUUID
+	err = tx.QueryRow(`
+		SELECT patient_id, type, status, patient_package_id FROM appointments
+		WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+	`, appointmentID, tenantID).Scan(&patientID, &aptType, &status, &bookedAgainst)
+	if err != nil {
+		return false, err
+	}
+	if status != "completed" {
+		return false, nil
+	}
+	var consumed bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM package_ledger WHERE appointment_id = $1 AND entry = 'session')
+	`, appointmentID).Scan(&consumed); err != nil || consumed {
+		return consumed, err
+	}
+
+	pkgs, err := lockPatientPackages(tx, tenantID, patientID)
+	if err != nil {
+		return false, err
+	}
+	p, ok := packageCreditFor(pkgs, aptType, bookedAgainst.UUID)
+	if !ok {
+		return false, nil
+	}
+
+	revenue := packageSessionRevenue(p.Price, p.SessionsTotal, p.SessionsUsed, 1)
+	if _, err := tx.Exec(`
+		UPDATE patient_packages SET
+			sessions_used = sessions_used + 1,
+			status = CASE WHEN sessions_used + 1 >= sessions_total THEN 'exhausted' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, p.ID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO package_ledger (tenant_id, patient_package_id, patient_id, appointment_id, entry, sessions, revenue)
+		VALUES ($1, $2, $3, $4, $5, -1, $6)
+	`, tenantID, p.ID, patientID, appointmentID, packageEntrySession, revenue); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`UPDATE appointments SET patient_package_id = $2 WHERE id = $1`, appointmentID, p.ID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// StartPackageExpiry expires lapsed packages hourly.
+func StartPackageExpiry() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		ExpirePatientPackages()
+		for range ticker.C {
+			ExpirePatientPackages()
+		}
+	}()
+}
+
+// ExpirePatientPackages closes active packages past their expiry. Unused credits are forfeited
+// and the unrecognized part of the price is recognized with them.
+func ExpirePatientPackages() {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id FROM patient_packages WHERE status = 'active' AND expires_at <= NOW()
+	`)
+	if err != nil {
+		log.Printf("package expiry: %v", err)
+		return
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if err := expirePatientPackage(id); err != nil {
+			log.Printf("package expiry %s: %v", id, err)
+		}
+	}
+}
+
+func expirePatientPackage(id uuid.UUID) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tenantID, patientID uuid.UUID
+	var total, used int
+	var price float64
+	err = tx.QueryRow(`
+		SELECT tenant_id, patient_id, sessions_total, sessions_used, price FROM patient_packages
+		WHERE id = $1 AND status = 'active' AND expires_at <= NOW()
+		FOR UPDATE
+	`, id).Scan(&tenantID, &patientID, &total, &used, &price)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE patient_packages SET status = 'expired', updated_at = NOW() WHERE id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO package_ledger (tenant_id, patient_package_id, patient_id, entry, sessions, revenue)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, tenantID, id, patientID, packageEntryExpiry, -(total - used),
+		packageSessionRevenue(price, total, used, total-used)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestValidateSessionPackage(t *testing.T) {
+	ok := models.SessionPackage{Name: "  Eight sessions ", SessionCount: 8, Price: 12000, ValidityDays: 90}
+	if err := ValidateSessionPackage(&ok); err != nil {
+		t.Fatalf("valid package rejected: %v", err)
+	}
+	if ok.Name != "Eight sessions" {
+		t.Fatalf("name not trimmed: %q", ok.Name)
+	}
+	bad := []models.SessionPackage{
+		{Name: "", SessionCount: 8, Price: 1, ValidityDays: 90},
+		{Name: "x", SessionCount: 0, Price: 1, ValidityDays: 90},
+		{Name: "x", SessionCount: 8, Price: 0, ValidityDays: 90},
+		{Name: "x", SessionCount: 8, Price: 1, ValidityDays: 0},
+		{Name: "x", SessionCount: 8, Price: 1, ValidityDays: 90, AppointmentType: "massage"},
+	}
+	for i, p := range bad {
+		if err := ValidateSessionPackage(&p); !errors.Is(err, ErrPackageInvalid) {
+			t.Fatalf("case %d: expected ErrPackageInvalid, got %v", i, err)
+		}
+	}
+}
+
+func TestPackageCreditsAvailable(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	future, past := now.Add(24*time.Hour), now.Add(-time.Hour)
+	p := models.PatientPackage{Status: PackageActive, SessionsTotal: 8, SessionsUsed: 3, SessionsReserved: 2, ExpiresAt: &future}
+	if got := packageCreditsAvailable(p, now); got != 3 {
+		t.Fatalf("available = %d, want 3", got)
+	}
+	p.SessionsReserved = 9
+	if got := packageCreditsAvailable(p, now); got != 0 {
+		t.Fatalf("over-reserved package should have 0, got %d", got)
+	}
+	p.SessionsReserved = 0
+	p.ExpiresAt = &past
+	if got := packageCreditsAvailable(p, now); got != 0 {
+		t.Fatalf("expired package should have 0, got %d", got)
+	}
+	p.ExpiresAt = &future
+	p.Status = PackagePendingPayment
+	if got := packageCreditsAvailable(p, now); got != 0 {
+		t.Fatalf("unpaid package should have 0, got %d", got)
+	}
+}
+
+func TestPackageCreditForPrefersBookedThenEarliestExpiry(t *testing.T) {
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time { t := base.AddDate(0, 0, days); return &t }
+	late := models.PatientPackage{ID: uuid.New(), SessionsAvailable: 2, ExpiresAt: at(60)}
+	early := models.PatientPackage{ID: uuid.New(), SessionsAvailable: 1, ExpiresAt: at(10)}
+	videoOnly := models.PatientPackage{ID: uuid.New(), SessionsAvailable: 5, ExpiresAt: at(1), AppointmentType: "video"}
+	empty := models.PatientPackage{ID: uuid.New(), SessionsAvailable: 0, ExpiresAt: at(2)}
+	pkgs := []models.PatientPackage{late, early, videoOnly, empty}
+
+	if p, ok := packageCreditFor(pkgs, "in_person", uuid.Nil); !ok || p.ID != early.ID {
+		t.Fatalf("expected the earliest expiring matching package, got %v %v", p.ID, ok)
+	}
+	if p, ok := packageCreditFor(pkgs, "video", uuid.Nil); !ok || p.ID != videoOnly.ID {
+		t.Fatalf("expected the video package for a video session, got %v %v", p.ID, ok)
+	}
+	if p, ok := packageCreditFor(pkgs, "in_person", late.ID); !ok || p.ID != late.ID {
+		t.Fatalf("expected the package the session was booked against, got %v %v", p.ID, ok)
+	}
+	if p, ok := packageCreditFor(pkgs, "in_person", empty.ID); !ok || p.ID != early.ID {
+		t.Fatalf("booked package without credit should fall back, got %v %v", p.ID, ok)
+	}
+	if _, ok := packageCreditFor([]models.PatientPackage{videoOnly, empty}, "chat", uuid.Nil); ok {
+		t.Fatal("expected no credit for a chat session")
+	}
+}
+
+func TestPackageSessionRevenueAddsUpToPrice(t *testing.T) {
+	price, total := 10000.00, 3
+	var sum float64
+	for used := 0; used < total; used++ {
+		sum += packageSessionRevenue(price, total, used, 1)
+	}
+	if toPaise(sum) != toPaise(price) {
+		t.Fatalf("sessions recognized %.2f of %.2f", sum, price)
+	}
+	if got := packageSessionRevenue(price, total, 0, 1); got != 3333.33 {
+		t.Fatalf("first session = %.2f, want 3333.33", got)
+	}
+	// Expiry after one session recognizes the rest.
+	if got := packageSessionRevenue(price, total, 1, total-1); got != 6666.67 {
+		t.Fatalf("forfeited share = %.2f, want 6666.67", got)
+	}
+}
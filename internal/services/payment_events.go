@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Payment statuses. A payment row tracks one provider order; refunds are recorded separately and
+// do not change it.
+const (
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentSucceeded  = "succeeded"
+	PaymentFailed     = "failed"
+)
+
+// paymentTransitions lists the moves a payment may make. An order can see a failed attempt
+// followed by a successful one, but nothing leaves succeeded: a late payment.failed for an
+// earlier attempt must not undo a capture.
+var paymentTransitions = map[string][]string{
+	PaymentPending:    {PaymentAuthorized, PaymentSucceeded, PaymentFailed},
+	PaymentAuthorized: {PaymentSucceeded, PaymentFailed},
+	PaymentFailed:     {PaymentAuthorized, PaymentSucceeded},
+}
+
+// PaymentTransitionAllowed reports whether a payment in status from may move to status to.
+func PaymentTransitionAllowed(from, to string) bool {
+	for _, s := range paymentTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentOutcome is what ApplyPaymentUpdate did.
+type PaymentOutcome string
+
+const (
+	PaymentApplied   PaymentOutcome = "applied"
+	PaymentUnchanged PaymentOutcome = "unchanged" // already in that status
+	PaymentStale     PaymentOutcome = "stale"     // transition not allowed, e.g. failed after captured
+)
+
+var ErrPaymentNotFound = errors.New("no payment recorded for this order")
+
+// PaymentUpdate is a status reported for a provider order, by a webhook, the client callback or
+// a reconciliation fetch.
+type PaymentUpdate struct {
+	Provider  string
+	OrderID   string
+	PaymentID string    // provider payment ID, stored as external_id
+	Status    string    // one of the Payment* statuses
+	InvoiceID uuid.UUID // when set, the order must belong to this invoice
+}
+
+// ApplyPaymentUpdate moves the order's payment row through the state machine and settles the
+// invoice when the payment succeeds. Applying the same update twice is a no-op.
+func ApplyPaymentUpdate(tx *sql.Tx, u PaymentUpdate) (PaymentOutcome, error) {
+	var paymentID, invoiceID, tenantID uuid.UUID
+	err := tx.QueryRow(`
+		SELECT id, invoice_id, tenant_id FROM payments
+		WHERE provider = $1 AND COALESCE(order_id, external_id) = $2
+		ORDER BY created_at DESC LIMIT 1
+	`, u.Provider, u.OrderID).Scan(&paymentID, &invoiceID, &tenantID)
+	if err == sql.ErrNoRows || (err == nil && u.InvoiceID != uuid.Nil && u.InvoiceID != invoiceID) {
+		return "", ErrPaymentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Lock the invoice before the payment, in the same order as refunds do.
+	if _, err := tx.Exec(`SELECT 1 FROM invoices WHERE id = $1 FOR UPDATE`, invoiceID); err != nil {
+		return "", err
+	}
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM payments WHERE id = $1 FOR UPDATE`, paymentID).Scan(&current); err != nil {
+		return "", err
+	}
+	if current == u.Status {
+		return PaymentUnchanged, nil
+	}
+	if !PaymentTransitionAllowed(current, u.Status) {
+		return PaymentStale, nil
+	}
+	_, err = tx.Exec(`
+		UPDATE payments SET status = $2, external_id = COALESCE(NULLIF($3, ''), external_id),
+			order_id = COALESCE(order_id, $4), updated_at = NOW()
+		WHERE id = $1
+	`, paymentID, u.Status, u.PaymentID, u.OrderID)
+	if err != nil {
+		return "", err
+	}
+	if u.Status == PaymentSucceeded {
+		if err := SettleInvoicePayments(tx, tenantID, invoiceID); err != nil {
+			return "", err
+		}
+	}
+	return PaymentApplied, nil
+}
+
+// ParseRazorpayEvent reads a verified Razorpay webhook body. eventID is the X-Razorpay-Event-Id
+// header; deliveries without one are keyed by the hash of the body.
+func ParseRazorpayEvent(body []byte, eventID string) (models.PaymentEvent, error) {
+	var env struct {
+		Event     string `json:"event"`
+		CreatedAt int64  `json:"created_at"`
+		Payload   struct {
+			Payment struct {
+				Entity struct {
+					ID      string `json:"id"`
+					OrderID string `json:"order_id"`
+				} `json:"entity"`
+			} `json:"payment"`
+			Order struct {
+				Entity struct {
+					ID string `json:"id"`
+				} `json:"entity"`
+			} `json:"order"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return models.PaymentEvent{}, err
+	}
+	if env.Event == "" {
+		return models.PaymentEvent{}, errors.New("missing event type")
+	}
+	if eventID == "" {
+		sum := sha256.Sum256(body)
+		eventID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	ev := models.PaymentEvent{
+		Provider:  "razorpay",
+		EventID:   eventID,
+		EventType: env.Event,
+		OrderID:   env.Payload.Payment.Entity.OrderID,
+		PaymentID: env.Payload.Payment.Entity.ID,
+		Payload:   json.RawMessage(body),
+	}
+	if ev.OrderID == "" {
+		ev.OrderID = env.Payload.Order.Entity.ID
+	}
+	if env.CreatedAt > 0 {
+		t := time.Unix(env.CreatedAt, 0).UTC()
+		ev.OccurredAt = &t
+	}
+	return ev, nil
+}
+
+// razorpayEventStatuses maps the webhook events we act on to the payment status they report.
+var razorpayEventStatuses = map[string]string{
+	"payment.authorized": PaymentAuthorized,
+	"payment.captured":   PaymentSucceeded,
+	"order.paid":         PaymentSucceeded,
+	"payment.failed":     PaymentFailed,
+}
+
+// RecordPaymentEvent stores ev in the ledger. When the provider redelivers an event already
+// recorded, the stored row is returned with created false.
+func RecordPaymentEvent(ev models.PaymentEvent) (models.PaymentEvent, bool, error) {
+	var id uuid.UUID
+	err := database.PostgresDB.QueryRow(`
+		INSERT INTO payment_events (provider, event_id, event_type, order_id, payment_id, payload, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (provider, event_id) DO NOTHING
+		RETURNING id
+	`, ev.Provider, ev.EventID, ev.EventType, nullIfEmpty(ev.OrderID), nullIfEmpty(ev.PaymentID),
+		string(ev.Payload), ev.OccurredAt).Scan(&id)
+	created := err == nil
+	if err == sql.ErrNoRows {
+		err = database.PostgresDB.QueryRow(`
+			SELECT id FROM payment_events WHERE provider = $1 AND event_id = $2
+		`, ev.Provider, ev.EventID).Scan(&id)
+	}
+	if err != nil {
+		return ev, false, err
+	}
+	stored, err := GetPaymentEvent(id)
+	return stored, created, err
+}
+
+// ProcessPaymentEvent applies a stored event to its payment. It is safe to run again for an event
+// that was already processed, which is how replays work.
+func ProcessPaymentEvent(id uuid.UUID) (models.PaymentEvent, error) {
+	ev, err := GetPaymentEvent(id)
+	if err != nil {
+		return ev, err
+	}
+	p, ok := GetPaymentProvider(ev.Provider)
+	if !ok {
+		return ev, ErrPaymentProviderUnavailable
+	}
+	status, ok := p.EventStatus(ev.EventType)
+	if !ok || ev.OrderID == "" {
+		return finishPaymentEvent(ev, "ignored", "event type not handled", nil)
+	}
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return ev, err
+	}
+	defer tx.Rollback()
+	outcome, err := ApplyPaymentUpdate(tx, PaymentUpdate{
+		Provider: ev.Provider, OrderID: ev.OrderID, PaymentID: ev.PaymentID, Status: status,
+	})
+	if err == ErrPaymentNotFound {
+		return finishPaymentEvent(ev, "ignored", err.Error(), nil)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return finishPaymentEvent(ev, "failed", err.Error(), err)
+	}
+	if outcome == PaymentStale {
+		return finishPaymentEvent(ev, "ignored", "stale: payment already past "+status, nil)
+	}
+	return finishPaymentEvent(ev, "processed", string(outcome), nil)
+}
+
+func finishPaymentEvent(ev models.PaymentEvent, status, detail string, cause error) (models.PaymentEvent, error) {
+	err := database.PostgresDB.QueryRow(`
+		UPDATE payment_events SET status = $2, detail = $3, attempts = attempts + 1, processed_at = NOW()
+		WHERE id = $1
+		RETURNING attempts, processed_at
+	`, ev.ID, status, detail).Scan(&ev.Attempts, &ev.ProcessedAt)
+	if err != nil {
+		return ev, err
+	}
+	ev.Status, ev.Detail = status, detail
+	return ev, cause
+}
+
+const paymentEventColumns = `id, provider, event_id, event_type, COALESCE(order_id, ''), COALESCE(payment_id, ''),
+	payload, status, COALESCE(detail, ''), attempts, occurred_at, received_at, processed_at`
+
+func scanPaymentEvent(row rowScanner) (models.PaymentEvent, error) {
+	var ev models.PaymentEvent
+	var payload []byte
+	var occurred, processed sql.NullTime
+	err := row.Scan(&ev.ID, &ev.Provider, &ev.EventID, &ev.EventType, &ev.OrderID, &ev.PaymentID,
+		&payload, &ev.Status, &ev.Detail, &ev.Attempts, &occurred, &ev.ReceivedAt, &processed)
+	if err != nil {
+		return ev, err
+	}
+	ev.Payload = json.RawMessage(payload)
+	if occurred.Valid {
+		ev.OccurredAt = &occurred.Time
+	}
+	if processed.Valid {
+		ev.ProcessedAt = &processed.Time
+	}
+	return ev, nil
+}
+
+func GetPaymentEvent(id uuid.UUID) (models.PaymentEvent, error) {
+	return scanPaymentEvent(database.PostgresDB.QueryRow(`
+		SELECT `+paymentEventColumns+` FROM payment_events WHERE id = $1
+	`, id))
+}
+
+// ListPaymentEvents returns the newest events, optionally filtered by status and order.
+func ListPaymentEvents(status, orderID string, limit int) ([]models.PaymentEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := database.PostgresDB.Query(`
+		SELECT `+paymentEventColumns+` FROM payment_events
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR order_id = $2)
+		ORDER BY received_at DESC LIMIT $3
+	`, status, orderID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]models.PaymentEvent, 0)
+	for rows.Next() {
+		ev, err := scanPaymentEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// orderStatusFromAttempts picks the attempt that decides an order's status: a capture wins over
+// an authorization, which wins over failures.
+func orderStatusFromAttempts(attempts []ProviderPayment) (ProviderPayment, bool) {
+	rank := map[string]int{PaymentFailed: 1, PaymentAuthorized: 2, PaymentSucceeded: 3}
+	var best ProviderPayment
+	for _, p := range attempts {
+		if rank[p.Status] > rank[best.Status] {
+			best = p
+		}
+	}
+	return best, best.Status != ""
+}
+
+// ReconcilePaymentOrder fetches the order from the provider and applies its status, repairing
+// payments whose webhooks were lost or failed.
+func ReconcilePaymentOrder(ctx context.Context, provider, orderID string) (PaymentOutcome, error) {
+	p, ok := GetPaymentProvider(provider)
+	if !ok {
+		return "", ErrPaymentProviderUnavailable
+	}
+	attempts, err := p.FetchOrderPayments(ctx, orderID)
+	if err != nil {
+		return "", err
+	}
+	decisive, ok := orderStatusFromAttempts(attempts)
+	if !ok {
+		return PaymentUnchanged, nil
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	outcome, err := ApplyPaymentUpdate(tx, PaymentUpdate{
+		Provider: provider, OrderID: orderID, PaymentID: decisive.ID, Status: decisive.Status,
+	})
+	if err != nil {
+		return "", err
+	}
+	return outcome, tx.Commit()
+}
+
+// ReconcilePaymentEvent reconciles the order an event refers to and records the result on it.
+func ReconcilePaymentEvent(ctx context.Context, id uuid.UUID) (models.PaymentEvent, error) {
+	ev, err := GetPaymentEvent(id)
+	if err != nil {
+		return ev, err
+	}
+	if ev.OrderID == "" {
+		return ev, errors.New("event has no order to reconcile")
+	}
+	outcome, err := ReconcilePaymentOrder(ctx, ev.Provider, ev.OrderID)
+	if err != nil {
+		return finishPaymentEvent(ev, "failed", "reconcile: "+err.Error(), err)
+	}
+	return finishPaymentEvent(ev, "processed", "reconciled: "+string(outcome), nil)
+}
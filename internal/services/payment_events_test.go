@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPaymentTransitionAllowed(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{PaymentPending, PaymentSucceeded, true},
+		{PaymentPending, PaymentFailed, true},
+		{PaymentAuthorized, PaymentSucceeded, true},
+		{PaymentFailed, PaymentSucceeded, true}, // a later attempt on the same order
+		{PaymentSucceeded, PaymentFailed, false},
+		{PaymentSucceeded, PaymentAuthorized, false},
+		{PaymentAuthorized, PaymentPending, false},
+	}
+	for _, c := range cases {
+		if got := PaymentTransitionAllowed(c.from, c.to); got != c.want {
+			t.Errorf("%s -> %s: got %v", c.from, c.to, got)
+		}
+	}
+}
+
+func TestParseRazorpayEvent(t *testing.T) {
+	body := []byte(`{"entity":"event","event":"payment.captured","created_at":1767225600,
+		"payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","status":"captured"}}}}`)
+	ev, err := ParseRazorpayEvent(body, "evt_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.EventID != "evt_1" || ev.OrderID != "order_1" || ev.PaymentID != "pay_1" || ev.OccurredAt == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if razorpayEventStatuses[ev.EventType] != PaymentSucceeded {
+		t.Fatal("payment.captured should settle the payment")
+	}
+
+	// Without the header the body hash keys the event, so a redelivery matches.
+	a, _ := ParseRazorpayEvent(body, "")
+	b, _ := ParseRazorpayEvent(body, "")
+	if !strings.HasPrefix(a.EventID, "sha256:") || a.EventID != b.EventID {
+		t.Fatalf("fallback event IDs %q %q", a.EventID, b.EventID)
+	}
+
+	order, err := ParseRazorpayEvent([]byte(`{"event":"order.paid","payload":{"order":{"entity":{"id":"order_2"}}}}`), "evt_2")
+	if err != nil || order.OrderID != "order_2" {
+		t.Fatalf("order event %+v %v", order, err)
+	}
+	if _, err := ParseRazorpayEvent([]byte(`{}`), "evt_3"); err == nil {
+		t.Fatal("event without a type accepted")
+	}
+}
+
+type fakePaymentFetcher map[string][]ProviderPayment
+
+func (f fakePaymentFetcher) FetchOrderPayments(_ context.Context, orderID string) ([]ProviderPayment, error) {
+	return f[orderID], nil
+}
+
+func TestOrderStatusFromAttempts(t *testing.T) {
+	fetcher := fakePaymentFetcher{
+		"order_1": {{ID: "pay_a", Status: PaymentFailed}, {ID: "pay_b", Status: PaymentSucceeded}, {ID: "pay_c", Status: PaymentAuthorized}},
+		"order_2": {{ID: "pay_d", Status: PaymentFailed}},
+	}
+	attempts, _ := fetcher.FetchOrderPayments(context.Background(), "order_1")
+	if p, ok := orderStatusFromAttempts(attempts); !ok || p.ID != "pay_b" {
+		t.Fatalf("capture should decide the order, got %+v", p)
+	}
+	attempts, _ = fetcher.FetchOrderPayments(context.Background(), "order_2")
+	if p, _ := orderStatusFromAttempts(attempts); p.Status != PaymentFailed {
+		t.Fatalf("got %+v", p)
+	}
+	if _, ok := orderStatusFromAttempts(nil); ok {
+		t.Fatal("order without attempts has no status")
+	}
+}
+
+func TestRazorpayPaymentStatus(t *testing.T) {
+	for in, want := range map[string]string{"created": PaymentPending, "authorized": PaymentAuthorized,
+		"captured": PaymentSucceeded, "refunded": PaymentSucceeded, "failed": PaymentFailed} {
+		if got := razorpayPaymentStatus(in); got != want {
+			t.Errorf("%s: got %s want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// DefaultPaymentProvider is used by tenants that have not picked one.
+const DefaultPaymentProvider = "razorpay"
+
+var ErrPaymentProviderUnavailable = errors.New("payment provider not configured")
+
+// PaymentOrder is a checkout created with a provider. Checkout carries what the client needs to
+// open the provider's payment UI (publishable keys, client secrets).
+type PaymentOrder struct {
+	Provider string
+	ID       string
+	Amount   int64 // minor units
+	Currency string
+	Checkout map[string]string
+}
+
+// PaymentCallback is what the client posts back after checkout.
+type PaymentCallback struct {
+	OrderID   string
+	PaymentID string
+	Signature string
+}
+
+// PaymentProvider is a payment gateway. Payments rows store the provider's name, so every
+// later step (callback, webhook, refund, reconciliation) goes back to the same implementation.
+type PaymentProvider interface {
+	RefundGateway
+	PaymentStatusFetcher
+
+	Name() string
+	CreateOrder(ctx context.Context, amount float64, currency, receipt string) (PaymentOrder, error)
+	// VerifyCallback checks a client callback and returns the provider payment ID to record.
+	VerifyCallback(ctx context.Context, cb PaymentCallback) (string, error)
+	VerifyWebhook(body []byte, header http.Header) bool
+	// ParseWebhook reads a verified webhook body into a ledger event.
+	ParseWebhook(body []byte, header http.Header) (models.PaymentEvent, error)
+	// EventStatus maps a webhook event type to the payment status it reports.
+	EventStatus(eventType string) (string, bool)
+}
+
+// PaymentStatusFetcher reads the provider's view of an order, for reconciliation.
+type PaymentStatusFetcher interface {
+	FetchOrderPayments(ctx context.Context, orderID string) ([]ProviderPayment, error)
+}
+
+// ProviderPayment is a payment attempt as the provider reports it.
+type ProviderPayment struct {
+	ID      string
+	OrderID string
+	Status  string // one of the Payment* statuses
+}
+
+var (
+	paymentProvidersMu sync.RWMutex
+	paymentProviders   = map[string]PaymentProvider{}
+)
+
+// RegisterPaymentProvider makes p available to tenants and to the webhook route
+// /api/v1/webhooks/{name}. Registering a name again replaces the provider.
+func RegisterPaymentProvider(p PaymentProvider) {
+	paymentProvidersMu.Lock()
+	defer paymentProvidersMu.Unlock()
+	paymentProviders[p.Name()] = p
+}
+
+func GetPaymentProvider(name string) (PaymentProvider, bool) {
+	paymentProvidersMu.RLock()
+	defer paymentProvidersMu.RUnlock()
+	p, ok := paymentProviders[name]
+	return p, ok
+}
+
+// PaymentProviderNames lists the configured providers.
+func PaymentProviderNames() []string {
+	paymentProvidersMu.RLock()
+	defer paymentProvidersMu.RUnlock()
+	names := make([]string, 0, len(paymentProviders))
+	for name := range paymentProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitPaymentProviders registers every provider that has credentials configured.
+func InitPaymentProviders(cfg *config.Config) {
+	if cfg.RazorpayKeyID != "" && cfg.RazorpayKeySecret != "" {
+		RegisterPaymentProvider(NewRazorpayProvider(cfg.RazorpayKeyID, cfg.RazorpayKeySecret, cfg.RazorpayWebhookSecret))
+	}
+	if cfg.StripeSecretKey != "" {
+		RegisterPaymentProvider(NewStripeProvider(cfg.StripeSecretKey, cfg.StripePublishableKey, cfg.StripeWebhookSecret))
+	}
+	if cfg.PaymentSandbox {
+		if cfg.IsProduction() {
+			log.Println("⚠️  PAYMENT_SANDBOX ignored in production")
+		} else {
+			RegisterPaymentProvider(NewSandboxProvider(""))
+		}
+	}
+	if names := PaymentProviderNames(); len(names) > 0 {
+		log.Printf("✅ Payment providers: %v", names)
+	} else {
+		log.Println("⚠️  No payment provider configured; online payments are disabled")
+	}
+}
+
+// TenantPaymentProvider returns the provider the tenant chose on its billing profile.
+func TenantPaymentProvider(tenantID uuid.UUID) (PaymentProvider, error) {
+	profile, err := GetBillingProfile(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := GetPaymentProvider(profile.PaymentProvider)
+	if !ok {
+		return nil, ErrPaymentProviderUnavailable
+	}
+	return p, nil
+}
+
+// PaymentProviderForOrder returns the provider an invoice's order was created with. Callbacks
+// are verified by that provider rather than by whatever the client claims.
+func PaymentProviderForOrder(invoiceID uuid.UUID, orderID string) (PaymentProvider, error) {
+	var name string
+	err := database.PostgresDB.QueryRow(`
+		SELECT provider FROM payments
+		WHERE invoice_id = $1 AND COALESCE(order_id, external_id) = $2
+		ORDER BY created_at DESC LIMIT 1
+	`, invoiceID, orderID).Scan(&name)
+	if err != nil {
+		return nil, ErrPaymentNotFound
+	}
+	p, ok := GetPaymentProvider(name)
+	if !ok {
+		return nil, ErrPaymentProviderUnavailable
+	}
+	return p, nil
+}
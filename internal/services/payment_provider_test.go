@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	_ PaymentProvider = (*RazorpayProvider)(nil)
+	_ PaymentProvider = (*StripeProvider)(nil)
+	_ PaymentProvider = (*SandboxProvider)(nil)
+)
+
+func TestSandboxProviderCheckout(t *testing.T) {
+	p := NewSandboxProvider("")
+	ctx := context.Background()
+
+	order, err := p.CreateOrder(ctx, 1180, "INR", "inv-1")
+	if err != nil || order.ID != "order_sbx_000001" || order.Amount != 118000 {
+		t.Fatalf("unexpected order %+v %v", order, err)
+	}
+	cb := PaymentCallback{OrderID: order.ID, PaymentID: order.Checkout["payment_id"], Signature: order.Checkout["signature"]}
+	paymentID, err := p.VerifyCallback(ctx, cb)
+	if err != nil || paymentID != "pay_sbx_000001" {
+		t.Fatalf("callback rejected: %v", err)
+	}
+	cb.Signature = "forged"
+	if _, err := p.VerifyCallback(ctx, cb); err == nil {
+		t.Fatal("forged callback accepted")
+	}
+	attempts, _ := p.FetchOrderPayments(ctx, order.ID)
+	if s, _ := orderStatusFromAttempts(attempts); s.Status != PaymentSucceeded {
+		t.Fatalf("order status %+v", attempts)
+	}
+
+	declined, _ := p.CreateOrder(ctx, 500.13, "INR", "inv-2")
+	if declined.Checkout["outcome"] != "declined" || declined.Checkout["signature"] != "" {
+		t.Fatalf("order ending in 13 paise should decline: %+v", declined)
+	}
+}
+
+func TestSandboxProviderWebhook(t *testing.T) {
+	p := NewSandboxProvider("")
+	body, header := p.Webhook("payment.captured", "order_sbx_000001", "pay_sbx_000001")
+	if !p.VerifyWebhook(body, header) {
+		t.Fatal("signed webhook rejected")
+	}
+	if NewSandboxProvider("other").VerifyWebhook(body, header) {
+		t.Fatal("webhook verified with the wrong secret")
+	}
+	ev, err := p.ParseWebhook(body, header)
+	if err != nil || ev.EventID == "" || ev.OrderID != "order_sbx_000001" {
+		t.Fatalf("unexpected event %+v %v", ev, err)
+	}
+	if s, ok := p.EventStatus(ev.EventType); !ok || s != PaymentSucceeded {
+		t.Fatal("payment.captured not mapped")
+	}
+}
+
+func TestStripeSignatureValid(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	now := time.Unix(1767225600, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := hmacSHA256Hex("whsec_test", ts+"."+string(body))
+	header := fmt.Sprintf("t=%s,v1=deadbeef,v1=%s", ts, sig)
+
+	if !stripeSignatureValid(header, body, "whsec_test", now) {
+		t.Fatal("valid signature rejected")
+	}
+	if stripeSignatureValid(header, body, "whsec_other", now) {
+		t.Fatal("wrong secret accepted")
+	}
+	if stripeSignatureValid(header, body, "whsec_test", now.Add(10*time.Minute)) {
+		t.Fatal("stale signature accepted")
+	}
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	p := NewStripeProvider("sk_test", "pk_test", "whsec_test")
+	ev, err := p.ParseWebhook([]byte(`{"id":"evt_1","type":"payment_intent.succeeded","created":1767225600,
+		"data":{"object":{"id":"pi_1","object":"payment_intent"}}}`), http.Header{})
+	if err != nil || ev.OrderID != "pi_1" || ev.PaymentID != "pi_1" || ev.Provider != "stripe" {
+		t.Fatalf("unexpected event %+v %v", ev, err)
+	}
+	charge, _ := p.ParseWebhook([]byte(`{"id":"evt_2","type":"charge.refunded",
+		"data":{"object":{"id":"ch_1","object":"charge","payment_intent":"pi_1"}}}`), http.Header{})
+	if charge.OrderID != "pi_1" {
+		t.Fatalf("charge event should point at its intent: %+v", charge)
+	}
+	if _, ok := p.EventStatus("charge.refunded"); ok {
+		t.Fatal("refund events do not change payment status")
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+)
+
+// SandboxProvider is an in-process payment provider for local development and integration tests.
+// It never moves money and its IDs are sequential, so a run is reproducible. Orders whose amount
+// ends in 13 paise (e.g. 500.13) are declined.
+type SandboxProvider struct {
+	secret string
+
+	mu      sync.Mutex
+	seq     int
+	orders  map[string][]ProviderPayment
+	refunds map[string]string // receipt -> refund ID
+}
+
+const sandboxDefaultSecret = "serenify-sandbox"
+
+func NewSandboxProvider(secret string) *SandboxProvider {
+	if secret == "" {
+		secret = sandboxDefaultSecret
+	}
+	return &SandboxProvider{secret: secret, orders: map[string][]ProviderPayment{}, refunds: map[string]string{}}
+}
+
+func (p *SandboxProvider) Name() string { return "sandbox" }
+
+// Sign is the callback signature for a sandbox payment.
+func (p *SandboxProvider) Sign(orderID, paymentID string) string {
+	return hmacSHA256Hex(p.secret, orderID+"|"+paymentID)
+}
+
+// CreateOrder returns checkout parameters that already contain the payment ID and signature,
+// so a client can complete the payment by posting them back.
+func (p *SandboxProvider) CreateOrder(_ context.Context, amount float64, currency, _ string) (PaymentOrder, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	orderID := fmt.Sprintf("order_sbx_%06d", p.seq)
+	paymentID := fmt.Sprintf("pay_sbx_%06d", p.seq)
+	p.orders[orderID] = nil
+
+	paise := toPaise(amount)
+	checkout := map[string]string{"payment_id": paymentID, "outcome": "success"}
+	if paise%100 == 13 {
+		checkout["outcome"] = "declined"
+		p.orders[orderID] = []ProviderPayment{{ID: paymentID, OrderID: orderID, Status: PaymentFailed}}
+	} else {
+		checkout["signature"] = p.Sign(orderID, paymentID)
+	}
+	return PaymentOrder{Provider: p.Name(), ID: orderID, Amount: paise, Currency: currency, Checkout: checkout}, nil
+}
+
+func (p *SandboxProvider) VerifyCallback(_ context.Context, cb PaymentCallback) (string, error) {
+	if cb.Signature == "" || cb.Signature != p.Sign(cb.OrderID, cb.PaymentID) {
+		return "", errors.New("invalid payment signature")
+	}
+	p.record(cb.OrderID, cb.PaymentID, PaymentSucceeded)
+	return cb.PaymentID, nil
+}
+
+func (p *SandboxProvider) record(orderID, paymentID, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orders[orderID] = append(p.orders[orderID], ProviderPayment{ID: paymentID, OrderID: orderID, Status: status})
+}
+
+type sandboxEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	OrderID   string `json:"order_id"`
+	PaymentID string `json:"payment_id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Webhook builds a signed webhook delivery for an order, as the provider would send it to
+// /api/v1/webhooks/sandbox.
+func (p *SandboxProvider) Webhook(eventType, orderID, paymentID string) ([]byte, http.Header) {
+	if status, ok := sandboxEventStatuses[eventType]; ok {
+		p.record(orderID, paymentID, status)
+	}
+	p.mu.Lock()
+	p.seq++
+	ev := sandboxEvent{ID: fmt.Sprintf("evt_sbx_%06d", p.seq), Type: eventType, OrderID: orderID,
+		PaymentID: paymentID, CreatedAt: time.Now().Unix()}
+	p.mu.Unlock()
+	body, _ := json.Marshal(ev)
+	header := http.Header{}
+	header.Set("X-Sandbox-Signature", hmacSHA256Hex(p.secret, string(body)))
+	return body, header
+}
+
+func (p *SandboxProvider) VerifyWebhook(body []byte, header http.Header) bool {
+	return hmacSHA256Equal(p.secret, string(body), header.Get("X-Sandbox-Signature"))
+}
+
+func (p *SandboxProvider) ParseWebhook(body []byte, _ http.Header) (models.PaymentEvent, error) {
+	var env sandboxEvent
+	if err := json.Unmarshal(body, &env); err != nil {
+		return models.PaymentEvent{}, err
+	}
+	if env.ID == "" || env.Type == "" {
+		return models.PaymentEvent{}, errors.New("missing event id or type")
+	}
+	ev := models.PaymentEvent{
+		Provider: p.Name(), EventID: env.ID, EventType: env.Type,
+		OrderID: env.OrderID, PaymentID: env.PaymentID, Payload: json.RawMessage(body),
+	}
+	if env.CreatedAt > 0 {
+		t := time.Unix(env.CreatedAt, 0).UTC()
+		ev.OccurredAt = &t
+	}
+	return ev, nil
+}
+
+var sandboxEventStatuses = map[string]string{
+	"payment.authorized": PaymentAuthorized,
+	"payment.captured":   PaymentSucceeded,
+	"payment.failed":     PaymentFailed,
+}
+
+func (p *SandboxProvider) EventStatus(eventType string) (string, bool) {
+	s, ok := sandboxEventStatuses[eventType]
+	return s, ok
+}
+
+func (p *SandboxProvider) Refund(_ context.Context, paymentID string, _ float64, _, receipt string) (GatewayRefund, error) {
+	if !strings.HasPrefix(paymentID, "pay_sbx_") {
+		return GatewayRefund{}, errors.New("payment has no sandbox payment id")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.refunds[receipt]
+	if !ok {
+		id = fmt.Sprintf("rfnd_sbx_%06d", len(p.refunds)+1)
+		p.refunds[receipt] = id
+	}
+	return GatewayRefund{ID: id, Status: "processed"}, nil
+}
+
+func (p *SandboxProvider) FetchOrderPayments(_ context.Context, orderID string) ([]ProviderPayment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payments, ok := p.orders[orderID]
+	if !ok {
+		return nil, errors.New("unknown sandbox order")
+	}
+	return append([]ProviderPayment(nil), payments...), nil
+}
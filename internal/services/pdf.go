@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Minimal PDF 1.4 writer for generated documents (invoices, credit notes). It only supports the
+// built-in Helvetica faces with WinAnsiEncoding, text, lines and filled rectangles, which keeps
+// the output deterministic: identical input produces identical bytes.
+
+const (
+	pdfPageWidth  = 595.28 // A4 in points
+	pdfPageHeight = 841.89
+)
+
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+
+	Title   string
+	Created time.Time
+	ID      string // hex document identifier written to the trailer /ID
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.AddPage()
+	return w
+}
+
+func (w *pdfWriter) AddPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+}
+
+// Text draws s with its baseline at (x, y); y is measured from the top of the page.
+func (w *pdfWriter) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pdfPageHeight-y, pdfEscape(s))
+}
+
+// TextRight draws s so that it ends at x.
+func (w *pdfWriter) TextRight(x, y, size float64, bold bool, s string) {
+	w.Text(x-pdfTextWidth(s, size, bold), y, size, bold, s)
+}
+
+func (w *pdfWriter) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(w.page, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+// FillRect fills a rectangle whose top-left corner is (x, y) with a gray level (0 black, 1 white).
+func (w *pdfWriter) FillRect(x, y, width, height, gray float64) {
+	fmt.Fprintf(w.page, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, pdfPageHeight-y-height, width, height)
+}
+
+// Bytes serialises the document.
+func (w *pdfWriter) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, 5 info, then a page and a content stream per page.
+	const firstPageObj = 6
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	info := fmt.Sprintf("<< /Producer (Serenify) /Title (%s)", pdfEscape(w.Title))
+	if !w.Created.IsZero() {
+		info += " /CreationDate (D:" + w.Created.UTC().Format("20060102150405") + "Z)"
+	}
+	obj(info + " >>")
+	for i, content := range w.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPageObj+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R", len(offsets)+1)
+	if w.ID != "" {
+		fmt.Fprintf(&out, " /ID [<%s> <%s>]", w.ID, w.ID)
+	}
+	fmt.Fprintf(&out, " >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes()
+}
+
+// pdfEncode converts s to WinAnsi bytes; characters the standard fonts cannot show are replaced.
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			out = append(out, ' ')
+		case r < 0x20:
+		case r < 0x7f || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		case r == '₹':
+			out = append(out, "Rs."...)
+		case r == '€':
+			out = append(out, 0x80)
+		case r == '–':
+			out = append(out, 0x96)
+		case r == '—':
+			out = append(out, 0x97)
+		case r == '‘' || r == '’':
+			out = append(out, '\'')
+		case r == '“' || r == '”':
+			out = append(out, '"')
+		case r == '•':
+			out = append(out, 0x95)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, c := range pdfEncode(s) {
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth is the width of s in points using the Helvetica metrics.
+func pdfTextWidth(s string, size float64, bold bool) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range pdfEncode(s) {
+		if c >= 32 && c <= 126 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfWrap splits s into lines no wider than maxWidth.
+func pdfWrap(s string, size float64, bold bool, maxWidth float64) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	line := words[0]
+	for _, word := range words[1:] {
+		if pdfTextWidth(line+" "+word, size, bold) <= maxWidth {
+			line += " " + word
+			continue
+		}
+		lines = append(lines, line)
+		line = word
+	}
+	return append(lines, line)
+}
+
+// Glyph widths (1/1000 em) for WinAnsi codes 32-126.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
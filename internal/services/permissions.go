@@ -0,0 +1,416 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Tenant staff permissions. Routes declare the permission they need; staff get permissions
+// through the roles assigned to them in a tenant.
+const (
+	PermPatientsRead      = "patients.read"
+	PermPatientsWrite     = "patients.write"
+	PermPatientsRegister  = "patients.register"
+	PermNotesRead         = "notes.read"
+	PermNotesWrite        = "notes.write"
+	PermClinicalRead      = "clinical.read"
+	PermClinicalWrite     = "clinical.write"
+	PermMessagesRead      = "messages.read"
+	PermMessagesWrite     = "messages.write"
+	PermAppointmentsRead  = "appointments.read"
+	PermAppointmentsWrite = "appointments.write"
+	PermAvailabilityWrite = "availability.write"
+	PermInvoicesRead      = "invoices.read"
+	PermInvoicesWrite     = "invoices.write"
+	PermInvoicesCollect   = "invoices.collect"
+	PermInvoicesRefund    = "invoices.refund"
+	PermPackagesRead      = "packages.read"
+	PermPackagesWrite     = "packages.write"
+	PermPackagesSell      = "packages.sell"
+	PermBillingManage     = "billing.manage"
+	PermAnalyticsRead     = "analytics.read"
+	PermReferralsRead     = "referrals.read"
+	PermCalendarManage    = "calendar.manage"
+	PermStaffManage       = "staff.manage"
+	PermSettingsManage    = "settings.manage"
+)
+
+// Permission is a registry entry.
+type Permission struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// PermissionRegistry lists every permission a role can grant.
+var PermissionRegistry = []Permission{
+	{PermPatientsRead, "View patient records"},
+	{PermPatientsWrite, "Edit and remove patients"},
+	{PermPatientsRegister, "Register new patients and walk-ins"},
+	{PermNotesRead, "Read session notes"},
+	{PermNotesWrite, "Write and publish session notes"},
+	{PermClinicalRead, "View wellness logs, journals, prescriptions, tasks and AI insights"},
+	{PermClinicalWrite, "Prescribe, assign tasks and comment on journals"},
+	{PermMessagesRead, "Read patient conversations"},
+	{PermMessagesWrite, "Message patients"},
+	{PermAppointmentsRead, "View the appointment calendar"},
+	{PermAppointmentsWrite, "Book, reschedule and cancel appointments"},
+	{PermAvailabilityWrite, "Edit availability"},
+	{PermInvoicesRead, "View invoices and payments"},
+	{PermInvoicesWrite, "Create and send invoices"},
+	{PermInvoicesCollect, "Collect payments"},
+	{PermInvoicesRefund, "Issue refunds and credit notes"},
+	{PermPackagesRead, "View session packages and balances"},
+	{PermPackagesWrite, "Edit the session package catalog"},
+	{PermPackagesSell, "Sell session packages"},
+	{PermBillingManage, "Edit the billing profile"},
+	{PermAnalyticsRead, "View practice analytics"},
+	{PermReferralsRead, "View referral codes"},
+	{PermCalendarManage, "Connect and disconnect calendars"},
+	{PermStaffManage, "Manage staff accounts and their roles"},
+	{PermSettingsManage, "Change reminder and security settings"},
+}
+
+// Built-in role keys. Every tenant has these; custom roles may not reuse their keys.
+const (
+	RoleOwner              = "owner"
+	RoleReceptionist       = "receptionist"
+	RoleBillingClerk       = "billing_clerk"
+	RoleAssociateTherapist = "associate_therapist"
+	RoleSupervisor         = "supervisor"
+	RoleAuditor            = "auditor"
+)
+
+// StaffRole is a named set of permissions.
+type StaffRole struct {
+	Key         string   `json:"key"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"built_in"`
+}
+
+var builtinRoles = []StaffRole{
+	{Key: RoleOwner, Name: "Owner", Description: "The practice owner; every permission", BuiltIn: true},
+	{Key: RoleReceptionist, Name: "Receptionist", Description: "Front desk: calendar, registration and payments, no clinical data", BuiltIn: true,
+		Permissions: []string{PermPatientsRead, PermPatientsRegister, PermAppointmentsRead, PermAppointmentsWrite, PermInvoicesRead,
+			PermInvoicesCollect, PermPackagesRead, PermPackagesSell, PermReferralsRead}},
+	{Key: RoleBillingClerk, Name: "Billing clerk", Description: "Invoices, payments, refunds and packages", BuiltIn: true,
+		Permissions: []string{PermPatientsRead, PermInvoicesRead, PermInvoicesWrite, PermInvoicesCollect,
+			PermInvoicesRefund, PermPackagesRead, PermPackagesWrite, PermPackagesSell, PermBillingManage}},
+	{Key: RoleAssociateTherapist, Name: "Associate therapist", Description: "Clinical work with the practice's patients", BuiltIn: true,
+		Permissions: []string{PermPatientsRead, PermPatientsWrite, PermPatientsRegister, PermNotesRead, PermNotesWrite, PermClinicalRead,
+			PermClinicalWrite, PermMessagesRead, PermMessagesWrite, PermAppointmentsRead, PermAppointmentsWrite,
+			PermAvailabilityWrite}},
+	{Key: RoleSupervisor, Name: "Supervisor", Description: "Reviews clinical work and practice performance", BuiltIn: true,
+		Permissions: []string{PermPatientsRead, PermNotesRead, PermClinicalRead, PermMessagesRead,
+			PermAppointmentsRead, PermInvoicesRead, PermPackagesRead, PermAnalyticsRead, PermReferralsRead}},
+	{Key: RoleAuditor, Name: "Read-only auditor", Description: "Read access to records and billing; cannot change anything", BuiltIn: true,
+		Permissions: []string{PermPatientsRead, PermNotesRead, PermClinicalRead, PermMessagesRead,
+			PermAppointmentsRead, PermInvoicesRead, PermPackagesRead, PermAnalyticsRead, PermReferralsRead}},
+}
+
+func init() {
+	for _, p := range PermissionRegistry {
+		builtinRoles[0].Permissions = append(builtinRoles[0].Permissions, p.Key)
+	}
+}
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleKeyTaken      = errors.New("a role with this key already exists")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidRoleKey    = errors.New("role key must be 2-50 lowercase letters, digits or underscores")
+	ErrStaffNotFound     = errors.New("staff member not found in this tenant")
+)
+
+var roleKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// PermissionSet is the set of permissions a caller holds.
+type PermissionSet map[string]bool
+
+// Has reports whether every listed permission is held.
+func (s PermissionSet) Has(perms ...string) bool {
+	for _, p := range perms {
+		if !s[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the permissions in registry order.
+func (s PermissionSet) List() []string {
+	out := []string{}
+	for _, p := range PermissionRegistry {
+		if s[p.Key] {
+			out = append(out, p.Key)
+		}
+	}
+	return out
+}
+
+// AllPermissions is held by the tenant owner.
+func AllPermissions() PermissionSet {
+	return permissionSetOf(builtinRole(RoleOwner).Permissions)
+}
+
+func permissionSetOf(perms []string) PermissionSet {
+	s := PermissionSet{}
+	for _, p := range perms {
+		s[p] = true
+	}
+	return s
+}
+
+func builtinRole(key string) *StaffRole {
+	for i := range builtinRoles {
+		if builtinRoles[i].Key == key {
+			return &builtinRoles[i]
+		}
+	}
+	return nil
+}
+
+// validatePermissions rejects permissions missing from the registry and returns them sorted
+// in registry order without duplicates.
+func validatePermissions(perms []string) ([]string, error) {
+	s := PermissionSet{}
+	for _, p := range perms {
+		known := false
+		for _, r := range PermissionRegistry {
+			if r.Key == p {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+		s[p] = true
+	}
+	return s.List(), nil
+}
+
+// ListTenantRoles returns the built-in roles followed by the tenant's custom roles.
+func ListTenantRoles(tenantID uuid.UUID) ([]StaffRole, error) {
+	roles := append([]StaffRole{}, builtinRoles...)
+	rows, err := database.PostgresDB.Query(`
+		SELECT key, name, COALESCE(description, ''), permissions FROM tenant_roles
+		WHERE tenant_id = $1 ORDER BY name
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role StaffRole
+		if err := rows.Scan(&role.Key, &role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// CreateTenantRole defines a custom role for the tenant.
+func CreateTenantRole(tenantID uuid.UUID, role StaffRole) (*StaffRole, error) {
+	if !roleKeyPattern.MatchString(role.Key) {
+		return nil, ErrInvalidRoleKey
+	}
+	if builtinRole(role.Key) != nil {
+		return nil, ErrRoleKeyTaken
+	}
+	perms, err := validatePermissions(role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	res, err := database.PostgresDB.Exec(`
+		INSERT INTO tenant_roles (tenant_id, key, name, description, permissions)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, key) DO NOTHING
+	`, tenantID, role.Key, role.Name, role.Description, pq.Array(perms))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrRoleKeyTaken
+	}
+	role.Permissions, role.BuiltIn = perms, false
+	return &role, nil
+}
+
+// UpdateTenantRole replaces a custom role's name, description and permissions. Built-in roles
+// cannot be changed.
+func UpdateTenantRole(tenantID uuid.UUID, key string, name, description *string, permissions []string) (*StaffRole, error) {
+	if builtinRole(key) != nil {
+		return nil, ErrRoleNotFound
+	}
+	var perms interface{}
+	if permissions != nil {
+		valid, err := validatePermissions(permissions)
+		if err != nil {
+			return nil, err
+		}
+		perms = pq.Array(valid)
+	}
+	var role StaffRole
+	err := database.PostgresDB.QueryRow(`
+		UPDATE tenant_roles SET
+			name = COALESCE($3, name),
+			description = COALESCE($4, description),
+			permissions = COALESCE($5, permissions),
+			updated_at = NOW()
+		WHERE tenant_id = $1 AND key = $2
+		RETURNING key, name, COALESCE(description, ''), permissions
+	`, tenantID, key, name, description, perms).Scan(&role.Key, &role.Name, &role.Description, pq.Array(&role.Permissions))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteTenantRole removes a custom role and its assignments.
+func DeleteTenantRole(tenantID uuid.UUID, key string) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM tenant_roles WHERE tenant_id = $1 AND key = $2`, tenantID, key)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM tenant_staff_roles WHERE tenant_id = $1 AND role_key = $2`, tenantID, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StaffRoleKeys returns the roles assigned to a staff member in a tenant.
+func StaffRoleKeys(tenantID, staffID uuid.UUID) ([]string, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT role_key FROM tenant_staff_roles WHERE tenant_id = $1 AND staff_id = $2 ORDER BY role_key
+	`, tenantID, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// SetStaffRoles replaces the roles of a receptionist or practitioner of the tenant. The owner
+// role is implicit for the tenant's owner and admins, and cannot be assigned.
+func SetStaffRoles(tenantID, staffID, assignedBy uuid.UUID, keys []string) error {
+	var isStaff bool
+	if err := database.PostgresDB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM receptionists WHERE id = $1 AND tenant_id = $2)
+			OR EXISTS(SELECT 1 FROM tenant_members WHERE therapist_id = $1 AND tenant_id = $2 AND is_active = TRUE)
+	`, staffID, tenantID).Scan(&isStaff); err != nil {
+		return err
+	}
+	if !isStaff {
+		return ErrStaffNotFound
+	}
+
+	custom := map[string]bool{}
+	rows, err := database.PostgresDB.Query(`SELECT key FROM tenant_roles WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return err
+		}
+		custom[k] = true
+	}
+	rows.Close()
+	for _, k := range keys {
+		if k == RoleOwner || (builtinRole(k) == nil && !custom[k]) {
+			return fmt.Errorf("%w: %s", ErrRoleNotFound, k)
+		}
+	}
+
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM tenant_staff_roles WHERE tenant_id = $1 AND staff_id = $2`, tenantID, staffID); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if _, err := tx.Exec(`
+			INSERT INTO tenant_staff_roles (tenant_id, staff_id, role_key, assigned_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+		`, tenantID, staffID, k, assignedBy); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StaffPermissions resolves a staff member's permissions in a tenant. Staff without any role
+// assigned keep defaultRole's permissions, so existing receptionists see what they always have.
+func StaffPermissions(tenantID, staffID uuid.UUID, defaultRole string) (PermissionSet, error) {
+	keys, err := StaffRoleKeys(tenantID, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 && defaultRole != "" {
+		keys = []string{defaultRole}
+	}
+	set := PermissionSet{}
+	var custom []string
+	for _, k := range keys {
+		if r := builtinRole(k); r != nil {
+			for _, p := range r.Permissions {
+				set[p] = true
+			}
+			continue
+		}
+		custom = append(custom, k)
+	}
+	if len(custom) == 0 {
+		return set, nil
+	}
+	rows, err := database.PostgresDB.Query(`
+		SELECT permissions FROM tenant_roles WHERE tenant_id = $1 AND key = ANY($2)
+	`, tenantID, pq.Array(custom))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var perms []string
+		if err := rows.Scan(pq.Array(&perms)); err != nil {
+			return nil, err
+		}
+		for _, p := range perms {
+			set[p] = true
+		}
+	}
+	return set, rows.Err()
+}
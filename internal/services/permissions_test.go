@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuiltinRolesUseRegisteredPermissions(t *testing.T) {
+	for _, role := range builtinRoles {
+		if _, err := validatePermissions(role.Permissions); err != nil {
+			t.Fatalf("role %s: %v", role.Key, err)
+		}
+	}
+	if got, want := len(AllPermissions()), len(PermissionRegistry); got != want {
+		t.Fatalf("owner holds %d permissions, registry has %d", got, want)
+	}
+	auditor := permissionSetOf(builtinRole(RoleAuditor).Permissions)
+	for p := range auditor {
+		if len(p) < 5 || p[len(p)-5:] != ".read" {
+			t.Fatalf("auditor should be read-only, has %s", p)
+		}
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	got, err := validatePermissions([]string{PermInvoicesRead, PermPatientsRead, PermInvoicesRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != PermPatientsRead || got[1] != PermInvoicesRead {
+		t.Fatalf("expected deduplicated registry order, got %v", got)
+	}
+	if _, err := validatePermissions([]string{"patients.delete_everything"}); !errors.Is(err, ErrUnknownPermission) {
+		t.Fatalf("unknown permission accepted: %v", err)
+	}
+}
+
+func TestPermissionSetHas(t *testing.T) {
+	s := permissionSetOf(builtinRole(RoleReceptionist).Permissions)
+	if !s.Has(PermAppointmentsRead, PermInvoicesCollect) {
+		t.Fatal("receptionist should keep front-desk permissions")
+	}
+	if s.Has(PermNotesRead) || s.Has(PermAppointmentsRead, PermNotesRead) {
+		t.Fatal("receptionist should not read notes")
+	}
+	if !s.Has() {
+		t.Fatal("no permissions required should pass")
+	}
+}
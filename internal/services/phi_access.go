@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	PHIActionRead  = "read"
+	PHIActionWrite = "write"
+
+	phiAccessQueueSize     = 4096
+	phiAccessBatchSize     = 200
+	phiAccessFlushInterval = 2 * time.Second
+	// phiAccessMaxPending bounds what is kept in memory while PostgreSQL is unreachable
+	phiAccessMaxPending = 20000
+)
+
+// PHIAccess is one staff read or write of patient health data.
+type PHIAccess struct {
+	OccurredAt   time.Time
+	TenantID     uuid.UUID // uuid.Nil when unknown
+	PatientID    uuid.UUID // uuid.Nil for reads across several patients
+	ActorID      uuid.UUID
+	ActorRole    string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Method       string
+	Path         string
+	Status       int
+	IPAddress    string
+	UserAgent    string
+	BreakGlassID uuid.UUID // set for accesses made under an emergency access grant
+}
+
+// PHIAccessEntry is a phi_access_log row as shown in access reports.
+type PHIAccessEntry struct {
+	ID           uuid.UUID  `json:"id"`
+	OccurredAt   time.Time  `json:"occurred_at"`
+	TenantID     *uuid.UUID `json:"tenant_id,omitempty"`
+	PatientID    *uuid.UUID `json:"patient_id,omitempty"`
+	ActorID      uuid.UUID  `json:"actor_id"`
+	ActorName    string     `json:"actor_name"`
+	ActorRole    string     `json:"actor_role"`
+	Action       string     `json:"action"`
+	ResourceType string     `json:"resource_type"`
+	ResourceID   string     `json:"resource_id,omitempty"`
+	Method       string     `json:"method,omitempty"`
+	Path         string     `json:"path,omitempty"`
+	IPAddress    string     `json:"ip_address,omitempty"`
+	BreakGlassID *uuid.UUID `json:"break_glass_id,omitempty"`
+}
+
+// phiAccessQueue decouples requests from the database: RecordPHIAccess never waits on a write.
+var phiAccessQueue = make(chan PHIAccess, phiAccessQueueSize)
+
+// RecordPHIAccess queues an access for the background writer started by StartPHIAccessLogger.
+func RecordPHIAccess(a PHIAccess) {
+	if a.OccurredAt.IsZero() {
+		a.OccurredAt = time.Now().UTC()
+	}
+	select {
+	case phiAccessQueue <- a:
+	default:
+		// Queue full: write this one on its own rather than lose it
+		go func() {
+			if err := writePHIAccessBatch(context.Background(), []PHIAccess{a}); err != nil {
+				log.Printf("🔴 PHI access log write failed: %v | %+v", err, a)
+			}
+		}()
+	}
+}
+
+// StartPHIAccessLogger writes queued accesses in batches, every couple of seconds or as soon as a
+// batch fills. Batches that fail are retried with the next one.
+func StartPHIAccessLogger() {
+	go func() {
+		ticker := time.NewTicker(phiAccessFlushInterval)
+		defer ticker.Stop()
+		var pending []PHIAccess
+		flush := func() {
+			if len(pending) == 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for len(pending) > 0 {
+				n := min(len(pending), phiAccessBatchSize)
+				if err := writePHIAccessBatch(ctx, pending[:n]); err != nil {
+					log.Printf("PHI access log: %d entries waiting: %v", len(pending), err)
+					if over := len(pending) - phiAccessMaxPending; over > 0 {
+						log.Printf("🔴 PHI access log: dropped %d oldest entries", over)
+						pending = pending[over:]
+					}
+					return
+				}
+				pending = pending[n:]
+			}
+			pending = nil
+		}
+		for {
+			select {
+			case a := <-phiAccessQueue:
+				pending = append(pending, a)
+				if len(pending) >= phiAccessBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+func writePHIAccessBatch(ctx context.Context, batch []PHIAccess) error {
+	if database.PostgresDB == nil {
+		return fmt.Errorf("postgres connection is not active")
+	}
+	const cols = 14
+	values := make([]string, 0, len(batch))
+	args := make([]interface{}, 0, len(batch)*cols)
+	for i, a := range batch {
+		ph := make([]string, cols)
+		for j := range ph {
+			ph[j] = fmt.Sprintf("$%d", i*cols+j+1)
+		}
+		values = append(values, "("+strings.Join(ph, ", ")+")")
+		args = append(args, a.OccurredAt.UTC(), nullableUUID(a.TenantID), nullableUUID(a.PatientID), a.ActorID,
+			a.ActorRole, a.Action, a.ResourceType, a.ResourceID, a.Method, a.Path, a.Status,
+			truncate(a.IPAddress, 45), a.UserAgent, nullableUUID(a.BreakGlassID))
+	}
+	_, err := database.PostgresDB.ExecContext(ctx, `
+		INSERT INTO phi_access_log (occurred_at, tenant_id, patient_id, actor_id, actor_role, action,
+			resource_type, resource_id, method, path, status, ip_address, user_agent, break_glass_id)
+		VALUES `+strings.Join(values, ", "), args...)
+	return err
+}
+
+func nullableUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+const phiAccessEntryColumns = `l.id, l.occurred_at, l.tenant_id, l.patient_id, l.actor_id,
+	COALESCE(t.name, rc.name, ad.username, ''), l.actor_role, l.action, l.resource_type, l.resource_id, l.method,
+	l.path, l.ip_address, l.break_glass_id`
+
+const phiAccessEntryJoins = `
+	LEFT JOIN therapists t ON l.actor_role = 'therapist' AND t.id = l.actor_id
+	LEFT JOIN receptionists rc ON l.actor_role = 'receptionist' AND rc.id = l.actor_id
+	LEFT JOIN admins ad ON l.actor_role = 'safety' AND ad.id = l.actor_id`
+
+func scanPHIAccessEntries(rows *sql.Rows) ([]PHIAccessEntry, error) {
+	defer rows.Close()
+	entries := []PHIAccessEntry{}
+	for rows.Next() {
+		var e PHIAccessEntry
+		var tenant, patient, breakGlass uuid.NullUUID
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &tenant, &patient, &e.ActorID, &e.ActorName, &e.ActorRole,
+			&e.Action, &e.ResourceType, &e.ResourceID, &e.Method, &e.Path, &e.IPAddress, &breakGlass); err != nil {
+			return nil, err
+		}
+		if tenant.Valid {
+			e.TenantID = &tenant.UUID
+		}
+		if patient.Valid {
+			e.PatientID = &patient.UUID
+		}
+		if breakGlass.Valid {
+			e.BreakGlassID = &breakGlass.UUID
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ListPatientPHIAccess returns accesses to a patient's record in [from, to), newest first.
+func ListPatientPHIAccess(ctx context.Context, patientID uuid.UUID, from, to *time.Time, limit int) ([]PHIAccessEntry, error) {
+	rows, err := database.PostgresDB.QueryContext(ctx, `
+		SELECT `+phiAccessEntryColumns+`
+		FROM phi_access_log l`+phiAccessEntryJoins+`
+		WHERE l.patient_id = $1
+			AND ($2::timestamp IS NULL OR l.occurred_at >= $2)
+			AND ($3::timestamp IS NULL OR l.occurred_at < $3)
+		ORDER BY l.occurred_at DESC, l.id DESC
+		LIMIT $4
+	`, patientID, utcOrNil(from), utcOrNil(to), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanPHIAccessEntries(rows)
+}
+
+// ListRecordViewsForUser returns who accessed the records of every patient profile linked to the
+// user account, newest first, older than before when it is set. Network details are left out.
+func ListRecordViewsForUser(ctx context.Context, userID uuid.UUID, before *time.Time, limit int) ([]PHIAccessEntry, error) {
+	rows, err := database.PostgresDB.QueryContext(ctx, `
+		SELECT `+phiAccessEntryColumns+`
+		FROM phi_access_log l`+phiAccessEntryJoins+`
+		WHERE l.patient_id IN (SELECT id FROM patients WHERE user_id = $1)
+			AND ($2::timestamp IS NULL OR l.occurred_at < $2)
+		ORDER BY l.occurred_at DESC, l.id DESC
+		LIMIT $3
+	`, userID, utcOrNil(before), limit)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanPHIAccessEntries(rows)
+	for i := range entries {
+		entries[i].Method, entries[i].Path, entries[i].IPAddress = "", "", ""
+	}
+	return entries, err
+}
+
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
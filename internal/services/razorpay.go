@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -9,47 +10,47 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/AnshRaj112/serenify-backend/internal/config"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
 )
 
-var (
-	razorpayKeyID        string
-	razorpayKeySecret    string
-	razorpayWebhookSecret string
-)
-
-func InitRazorpay(cfg *config.Config) {
-	razorpayKeyID = cfg.RazorpayKeyID
-	razorpayKeySecret = cfg.RazorpayKeySecret
-	razorpayWebhookSecret = cfg.RazorpayWebhookSecret
+// RazorpayProvider takes payments through Razorpay Checkout (orders API).
+type RazorpayProvider struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
 }
 
-func RazorpayEnabled() bool {
-	return razorpayKeyID != "" && razorpayKeySecret != ""
+// NewRazorpayProvider builds the provider; webhooks are signed with the key secret when no
+// separate webhook secret is set.
+func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvider {
+	if webhookSecret == "" {
+		webhookSecret = keySecret
+	}
+	return &RazorpayProvider{keyID: keyID, keySecret: keySecret, webhookSecret: webhookSecret, baseURL: "https://api.razorpay.com/v1"}
 }
 
-func RazorpayKeyID() string { return razorpayKeyID }
+func (p *RazorpayProvider) Name() string { return "razorpay" }
 
-type RazorpayOrder struct {
-	ID     string `json:"id"`
-	Amount int    `json:"amount"`
-	Currency string `json:"currency"`
-}
-
-func CreateRazorpayOrder(amountRupees float64, currency, receipt string) (*RazorpayOrder, error) {
-	if !RazorpayEnabled() {
-		return nil, fmt.Errorf("razorpay not configured")
+func (p *RazorpayProvider) do(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = strings.NewReader(string(b))
 	}
-	paise := int(amountRupees * 100)
-	body := fmt.Sprintf(`{"amount":%d,"currency":"%s","receipt":"%s"}`, paise, currency, receipt)
-	req, err := http.NewRequest("POST", "https://api.razorpay.com/v1/orders", strings.NewReader(body))
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(razorpayKeyID, razorpayKeySecret)
+	req.SetBasicAuth(p.keyID, p.keySecret)
 	req.Header.Set("Content-Type", "application/json")
-
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -59,28 +60,138 @@ func CreateRazorpayOrder(amountRupees float64, currency, receipt string) (*Razor
 	if resp.StatusCode >= 300 {
 		return nil, fmt.Errorf("razorpay error: %s", string(data))
 	}
-	var order RazorpayOrder
+	return data, nil
+}
+
+func (p *RazorpayProvider) CreateOrder(ctx context.Context, amount float64, currency, receipt string) (PaymentOrder, error) {
+	data, err := p.do(ctx, http.MethodPost, "/orders", map[string]interface{}{
+		"amount":   toPaise(amount),
+		"currency": currency,
+		"receipt":  receipt,
+	})
+	if err != nil {
+		return PaymentOrder{}, err
+	}
+	var order struct {
+		ID       string `json:"id"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
 	if err := json.Unmarshal(data, &order); err != nil {
-		return nil, err
+		return PaymentOrder{}, err
 	}
-	return &order, nil
+	return PaymentOrder{
+		Provider: p.Name(), ID: order.ID, Amount: order.Amount, Currency: order.Currency,
+		Checkout: map[string]string{"key_id": p.keyID},
+	}, nil
 }
 
-func VerifyRazorpayPaymentSignature(orderID, paymentID, signature string) bool {
-	payload := orderID + "|" + paymentID
-	mac := hmac.New(sha256.New, []byte(razorpayKeySecret))
-	mac.Write([]byte(payload))
-	expected := hex.EncodeToString(mac.Sum(nil))
-	return hmac.Equal([]byte(expected), []byte(signature))
+// VerifyCallback checks the razorpay_signature returned by Checkout.
+func (p *RazorpayProvider) VerifyCallback(_ context.Context, cb PaymentCallback) (string, error) {
+	if !hmacSHA256Equal(p.keySecret, cb.OrderID+"|"+cb.PaymentID, cb.Signature) {
+		return "", fmt.Errorf("invalid payment signature")
+	}
+	return cb.PaymentID, nil
+}
+
+func (p *RazorpayProvider) VerifyWebhook(body []byte, header http.Header) bool {
+	return hmacSHA256Equal(p.webhookSecret, string(body), header.Get("X-Razorpay-Signature"))
+}
+
+func (p *RazorpayProvider) ParseWebhook(body []byte, header http.Header) (models.PaymentEvent, error) {
+	return ParseRazorpayEvent(body, header.Get("X-Razorpay-Event-Id"))
+}
+
+func (p *RazorpayProvider) EventStatus(eventType string) (string, bool) {
+	s, ok := razorpayEventStatuses[eventType]
+	return s, ok
+}
+
+// Refund refunds a captured Razorpay payment (pay_... ID). Razorpay has no idempotency key for
+// refunds, so a refund already made with this receipt is returned instead of refunding again.
+func (p *RazorpayProvider) Refund(ctx context.Context, paymentID string, amount float64, currency, receipt string) (GatewayRefund, error) {
+	if !strings.HasPrefix(paymentID, "pay_") {
+		return GatewayRefund{}, fmt.Errorf("payment has no captured razorpay payment id")
+	}
+	existing, err := p.do(ctx, http.MethodGet, "/payments/"+paymentID+"/refunds?count=100", nil)
+	if err != nil {
+		return GatewayRefund{}, err
+	}
+	var list struct {
+		Items []struct {
+			ID      string `json:"id"`
+			Status  string `json:"status"`
+			Receipt string `json:"receipt"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(existing, &list); err != nil {
+		return GatewayRefund{}, err
+	}
+	for _, rf := range list.Items {
+		if rf.Receipt == receipt {
+			return GatewayRefund{ID: rf.ID, Status: rf.Status}, nil
+		}
+	}
+	data, err := p.do(ctx, http.MethodPost, "/payments/"+paymentID+"/refund", map[string]interface{}{
+		"amount":  toPaise(amount),
+		"speed":   "normal",
+		"receipt": receipt,
+	})
+	if err != nil {
+		return GatewayRefund{}, err
+	}
+	var out struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return GatewayRefund{}, err
+	}
+	return GatewayRefund{ID: out.ID, Status: out.Status}, nil
 }
 
-func VerifyRazorpayWebhook(body []byte, signature string) bool {
-	secret := razorpayWebhookSecret
-	if secret == "" {
-		secret = razorpayKeySecret
+// FetchOrderPayments lists an order's payment attempts.
+func (p *RazorpayProvider) FetchOrderPayments(ctx context.Context, orderID string) ([]ProviderPayment, error) {
+	data, err := p.do(ctx, http.MethodGet, "/orders/"+orderID+"/payments", nil)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Items []struct {
+			ID      string `json:"id"`
+			OrderID string `json:"order_id"`
+			Status  string `json:"status"`
+		} `json:"items"`
 	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	payments := make([]ProviderPayment, 0, len(out.Items))
+	for _, it := range out.Items {
+		payments = append(payments, ProviderPayment{ID: it.ID, OrderID: it.OrderID, Status: razorpayPaymentStatus(it.Status)})
+	}
+	return payments, nil
+}
+
+// razorpayPaymentStatus maps a Razorpay payment status to ours. Refunded payments were captured.
+func razorpayPaymentStatus(s string) string {
+	switch s {
+	case "authorized":
+		return PaymentAuthorized
+	case "captured", "refunded":
+		return PaymentSucceeded
+	case "failed":
+		return PaymentFailed
+	}
+	return PaymentPending
+}
+
+func hmacSHA256Hex(secret, payload string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(body)
-	expected := hex.EncodeToString(mac.Sum(nil))
-	return hmac.Equal([]byte(expected), []byte(signature))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hmacSHA256Equal(secret, payload, signature string) bool {
+	return hmac.Equal([]byte(hmacSHA256Hex(secret, payload)), []byte(signature))
 }
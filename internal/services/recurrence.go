@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecurrenceRule is the subset of an RFC 5545 RRULE used for appointment series:
+// FREQ=DAILY|WEEKLY|MONTHLY with INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+type RecurrenceRule struct {
+	Freq       string // DAILY | WEEKLY | MONTHLY
+	Interval   int
+	ByDay      []RecurrenceDay
+	ByMonthDay int
+	Count      int
+	Until      *time.Time
+}
+
+// RecurrenceDay is a BYDAY entry. Ordinal is only used with FREQ=MONTHLY (e.g. 2TU, -1FR).
+type RecurrenceDay struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+const maxRecurrencePeriods = 2000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRecurrenceRule parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;COUNT=10".
+// A leading "RRULE:" prefix is accepted.
+func ParseRecurrenceRule(s string) (RecurrenceRule, error) {
+	r := RecurrenceRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return r, errors.New("empty recurrence rule")
+	}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("invalid rrule part %q", part)
+		}
+		key, val := strings.ToUpper(strings.TrimSpace(kv[0])), strings.ToUpper(strings.TrimSpace(kv[1]))
+		switch key {
+		case "FREQ":
+			if val != "DAILY" && val != "WEEKLY" && val != "MONTHLY" {
+				return r, fmt.Errorf("unsupported FREQ %q", val)
+			}
+			r.Freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("invalid COUNT %q", val)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseRRuleTime(val)
+			if err != nil {
+				return r, err
+			}
+			r.Until = &t
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				day, err := parseRecurrenceDay(d)
+				if err != nil {
+					return r, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 31 {
+				return r, fmt.Errorf("invalid BYMONTHDAY %q", val)
+			}
+			r.ByMonthDay = n
+		case "WKST":
+			// Weeks always start on Monday here; accepted for compatibility.
+		default:
+			return r, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+	if r.Freq == "" {
+		return r, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return r, errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+	for _, d := range r.ByDay {
+		if d.Ordinal != 0 && r.Freq != "MONTHLY" {
+			return r, errors.New("ordinal BYDAY is only valid with FREQ=MONTHLY")
+		}
+	}
+	if r.ByMonthDay != 0 && r.Freq != "MONTHLY" {
+		return r, errors.New("BYMONTHDAY is only valid with FREQ=MONTHLY")
+	}
+	return r, nil
+}
+
+func parseRecurrenceDay(s string) (RecurrenceDay, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return RecurrenceDay{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	wd, ok := rruleWeekdays[s[len(s)-2:]]
+	if !ok {
+		return RecurrenceDay{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	day := RecurrenceDay{Weekday: wd}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n > 5 || n < -5 {
+			return RecurrenceDay{}, fmt.Errorf("invalid BYDAY ordinal %q", s)
+		}
+		day.Ordinal = n
+	}
+	return day, nil
+}
+
+func parseRRuleTime(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", s)
+}
+
+// String renders the rule back to canonical RRULE form (without the "RRULE:" prefix).
+func (r RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, d := range r.ByDay {
+			code := ""
+			for k, v := range rruleWeekdays {
+				if v == d.Weekday {
+					code = k
+				}
+			}
+			if d.Ordinal != 0 {
+				code = strconv.Itoa(d.Ordinal) + code
+			}
+			days = append(days, code)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.ByMonthDay > 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Expand returns occurrence start times for a series beginning at dtstart, in chronological
+// order. The wall-clock time of dtstart in loc is kept across DST changes. Expansion stops at
+// COUNT/UNTIL, at windowEnd (exclusive) or after max occurrences, whichever comes first.
+// COUNT is always measured from dtstart, so callers can expand the same rule repeatedly
+// with a growing window.
+func (r RecurrenceRule) Expand(dtstart time.Time, loc *time.Location, windowEnd time.Time, max int) []time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	start := dtstart.In(loc)
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	var out []time.Time
+	emitted := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		candidates := r.periodCandidates(start, loc, period*interval)
+		if len(candidates) == 0 && r.Freq != "MONTHLY" {
+			break
+		}
+		for _, c := range candidates {
+			if c.Before(start) {
+				continue
+			}
+			if r.Until != nil && c.After(*r.Until) {
+				return out
+			}
+			if r.Count > 0 && emitted >= r.Count {
+				return out
+			}
+			if !c.Before(windowEnd) || (max > 0 && len(out) >= max) {
+				return out
+			}
+			out = append(out, c.UTC())
+			emitted++
+		}
+	}
+	return out
+}
+
+func (r RecurrenceRule) periodCandidates(start time.Time, loc *time.Location, offset int) []time.Time {
+	h, m, s := start.Clock()
+	at := func(y int, mo time.Month, d int) time.Time {
+		return time.Date(y, mo, d, h, m, s, 0, loc)
+	}
+	switch r.Freq {
+	case "DAILY":
+		d := start.AddDate(0, 0, offset)
+		return []time.Time{at(d.Year(), d.Month(), d.Day())}
+	case "WEEKLY":
+		// Monday of the week containing start, shifted by offset weeks.
+		delta := (int(start.Weekday()) + 6) % 7
+		monday := start.AddDate(0, 0, -delta+offset*7)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []RecurrenceDay{{Weekday: start.Weekday()}}
+		}
+		var out []time.Time
+		for _, d := range days {
+			idx := (int(d.Weekday) + 6) % 7
+			day := monday.AddDate(0, 0, idx)
+			out = append(out, at(day.Year(), day.Month(), day.Day()))
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+		return out
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, offset, 0)
+		y, mo := first.Year(), first.Month()
+		daysIn := time.Date(y, mo+1, 0, 0, 0, 0, 0, loc).Day()
+		var out []time.Time
+		switch {
+		case len(r.ByDay) > 0:
+			for _, d := range r.ByDay {
+				for _, day := range nthWeekdaysOfMonth(y, mo, daysIn, d, loc) {
+					out = append(out, at(y, mo, day))
+				}
+			}
+		case r.ByMonthDay > 0:
+			if r.ByMonthDay <= daysIn {
+				out = append(out, at(y, mo, r.ByMonthDay))
+			}
+		default:
+			if start.Day() <= daysIn {
+				out = append(out, at(y, mo, start.Day()))
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+		return out
+	}
+	return nil
+}
+
+// nthWeekdaysOfMonth returns the days of the month matching d (every such weekday when Ordinal is 0).
+func nthWeekdaysOfMonth(y int, mo time.Month, daysIn int, d RecurrenceDay, loc *time.Location) []int {
+	var matches []int
+	for day := 1; day <= daysIn; day++ {
+		if time.Date(y, mo, day, 0, 0, 0, 0, loc).Weekday() == d.Weekday {
+			matches = append(matches, day)
+		}
+	}
+	switch {
+	case d.Ordinal == 0:
+		return matches
+	case d.Ordinal > 0 && d.Ordinal <= len(matches):
+		return []int{matches[d.Ordinal-1]}
+	case d.Ordinal < 0 && -d.Ordinal <= len(matches):
+		return []int{matches[len(matches)+d.Ordinal]}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrenceRule(t *testing.T) {
+	r, err := ParseRecurrenceRule("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Freq != "WEEKLY" || r.Interval != 2 || len(r.ByDay) != 2 || r.Count != 6 {
+		t.Fatalf("unexpected rule %+v", r)
+	}
+	if got := r.String(); got != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=6" {
+		t.Fatalf("unexpected canonical form %q", got)
+	}
+
+	bad := []string{"", "FREQ=YEARLY", "INTERVAL=2", "FREQ=WEEKLY;COUNT=2;UNTIL=20260101", "FREQ=WEEKLY;BYDAY=2TU", "FREQ=DAILY;BYDAY=XX"}
+	for _, s := range bad {
+		if _, err := ParseRecurrenceRule(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestExpandBiweeklyCount(t *testing.T) {
+	r, _ := ParseRecurrenceRule("FREQ=WEEKLY;INTERVAL=2;COUNT=3")
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC) // Monday
+	got := r.Expand(start, time.UTC, start.AddDate(1, 0, 0), 0)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 occurrences, got %d", len(got))
+	}
+	for i, want := range []time.Time{start, start.AddDate(0, 0, 14), start.AddDate(0, 0, 28)} {
+		if !got[i].Equal(want) {
+			t.Fatalf("occurrence %d: got %v want %v", i, got[i], want)
+		}
+	}
+}
+
+func TestExpandMonthlyByWeekdayUntil(t *testing.T) {
+	r, _ := ParseRecurrenceRule("FREQ=MONTHLY;BYDAY=2TU;UNTIL=20260430")
+	start := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC) // second Tuesday of January
+	got := r.Expand(start, time.UTC, start.AddDate(2, 0, 0), 0)
+	want := []int{13, 10, 10, 14} // Jan, Feb, Mar, Apr 2026
+	if len(got) != len(want) {
+		t.Fatalf("expected %d occurrences, got %v", len(want), got)
+	}
+	for i, d := range want {
+		if got[i].Day() != d || got[i].Weekday() != time.Tuesday {
+			t.Fatalf("occurrence %d: got %v", i, got[i])
+		}
+	}
+}
+
+func TestExpandKeepsWallClockAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata unavailable")
+	}
+	r, _ := ParseRecurrenceRule("FREQ=WEEKLY;COUNT=3")
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, loc)
+	for _, occ := range r.Expand(start, loc, start.AddDate(0, 2, 0), 0) {
+		if h := occ.In(loc).Hour(); h != 10 {
+			t.Fatalf("expected 10:00 local, got %v", occ.In(loc))
+		}
+	}
+}
+
+func TestExpandRespectsWindow(t *testing.T) {
+	r, _ := ParseRecurrenceRule("FREQ=DAILY")
+	start := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	if got := r.Expand(start, time.UTC, start.AddDate(0, 0, 10), 0); len(got) != 10 {
+		t.Fatalf("expected 10 occurrences in window, got %d", len(got))
+	}
+	if got := r.Expand(start, time.UTC, start.AddDate(0, 0, 10), 4); len(got) != 4 {
+		t.Fatalf("expected max of 4, got %d", len(got))
+	}
+}
@@ -0,0 +1,535 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvoiceNotRefundable = errors.New("invoice has no refundable payments")
+	ErrRefundAmount         = errors.New("refund amount exceeds the refundable balance")
+)
+
+// GatewayRefund is the provider's record of a refund.
+type GatewayRefund struct {
+	ID     string
+	Status string // processed or pending
+}
+
+// RefundGateway returns money for a captured provider payment. receipt is our refund ID; a
+// retried call with the same receipt must return the first refund instead of paying again.
+type RefundGateway interface {
+	Refund(ctx context.Context, paymentExternalID string, amount float64, currency, receipt string) (GatewayRefund, error)
+}
+
+// refundGatewayFor returns the gateway for payments made through provider. Payments collected
+// at reception (cash, card, UPI) have no gateway and are refunded manually.
+func refundGatewayFor(provider string) (RefundGateway, bool) {
+	return GetPaymentProvider(provider)
+}
+
+// RefundResult is what RefundInvoice recorded. Incomplete is set when the gateway refused part of
+// the amount after other parts had already been refunded.
+type RefundResult struct {
+	Refunds    []models.Refund   `json:"refunds"`
+	CreditNote models.CreditNote `json:"credit_note"`
+	Incomplete error             `json:"-"`
+}
+
+type refundablePayment struct {
+	ID         uuid.UUID
+	Provider   string
+	ExternalID string
+	Paise      int64 // still refundable
+}
+
+type refundPortion struct {
+	Payment refundablePayment
+	Paise   int64
+}
+
+// allocateRefund spreads a refund over payments, newest first.
+func allocateRefund(payments []refundablePayment, paise int64) []refundPortion {
+	var out []refundPortion
+	for _, p := range payments {
+		if paise <= 0 {
+			break
+		}
+		take := min(p.Paise, paise)
+		if take <= 0 {
+			continue
+		}
+		out = append(out, refundPortion{Payment: p, Paise: take})
+		paise -= take
+	}
+	return out
+}
+
+// splitCreditNote divides a GST-inclusive refund into taxable value and tax in the same
+// proportion as the invoice.
+func splitCreditNote(amount, invoiceSubtotal, invoiceTotal float64) (subtotal, gst float64) {
+	if invoiceTotal <= 0 {
+		return amount, 0
+	}
+	subtotal = math.Round(amount*invoiceSubtotal/invoiceTotal*100) / 100
+	gst = math.Round((amount-subtotal)*100) / 100
+	return subtotal, gst
+}
+
+func toPaise(v float64) int64   { return int64(math.Round(v * 100)) }
+func fromPaise(p int64) float64 { return float64(p) / 100 }
+
+// Refund rows are written as pending before any money moves, so a crash between the gateway
+// call and the bookkeeping leaves a row the sweeper can finish. Gateways report refunds they are
+// still paying out as processing.
+const (
+	RefundStatusPending    = "pending"
+	RefundStatusProcessing = "processing"
+	RefundStatusProcessed  = "processed"
+	RefundStatusFailed     = "failed"
+)
+
+const (
+	refundSweepInterval = 5 * time.Minute
+	// refundPendingGrace leaves in-flight refunds to the request that started them
+	refundPendingGrace = 10 * time.Minute
+	// refundPendingMaxAge is how long the sweeper retries a gateway before failing the refund
+	refundPendingMaxAge = 24 * time.Hour
+)
+
+// pendingRefund is a reserved refund row and what the gateway made of it.
+type pendingRefund struct {
+	models.Refund
+	PaymentExternalID string
+	Err               error
+}
+
+// RefundInvoice refunds amount (everything refundable when amount is 0) from the invoice's
+// payments, newest first, and issues one numbered credit note for what was refunded.
+//
+// The refunds are reserved as pending rows in one transaction, sent to the gateways with no
+// locks held, and finished in a second transaction.
+func RefundInvoice(ctx context.Context, tenantID, invoiceID uuid.UUID, amount float64, reason string, createdBy uuid.UUID) (RefundResult, error) {
+	var res RefundResult
+	refunds, currency, err := reserveRefunds(ctx, tenantID, invoiceID, amount, reason, createdBy)
+	if err != nil {
+		return res, err
+	}
+	sendRefunds(ctx, refunds, currency)
+
+	var sent int
+	for _, rf := range refunds {
+		if rf.Err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		if _, _, err := finishRefunds(ctx, tenantID, invoiceID, refunds, reason, createdBy); err != nil {
+			log.Printf("refunds: releasing failed refunds for invoice %s: %v", invoiceID, err)
+		}
+		return res, refunds[0].Err
+	}
+
+	res.Refunds, res.CreditNote, err = finishRefunds(ctx, tenantID, invoiceID, refunds, reason, createdBy)
+	if err != nil {
+		return res, fmt.Errorf("refund sent but not recorded, the refund sweeper will finish it: %w", err)
+	}
+	for _, rf := range refunds {
+		if rf.Err != nil {
+			res.Incomplete = fmt.Errorf("%w after %.2f was refunded", rf.Err, res.CreditNote.Total)
+			break
+		}
+	}
+	return res, nil
+}
+
+// reserveRefunds allocates the refund over the invoice's payments and records each part as a
+// pending refund. The amounts count as refunded from here on, so concurrent refunds can't
+// return the same money twice.
+func reserveRefunds(ctx context.Context, tenantID, invoiceID uuid.UUID, amount float64, reason string, createdBy uuid.UUID) ([]pendingRefund, string, error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var paid, refunded float64
+	var currency string
+	err = tx.QueryRow(`
+		SELECT amount_paid, amount_refunded, currency
+		FROM invoices WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+	`, invoiceID, tenantID).Scan(&paid, &refunded, &currency)
+	if err != nil {
+		return nil, "", err
+	}
+	rows, err := tx.Query(`
+		SELECT id, provider, COALESCE(external_id, ''), amount, refunded_amount FROM payments
+		WHERE invoice_id = $1 AND tenant_id = $2 AND status = 'succeeded' AND amount > refunded_amount
+		ORDER BY created_at DESC
+		FOR UPDATE
+	`, invoiceID, tenantID)
+	if err != nil {
+		return nil, "", err
+	}
+	var payments []refundablePayment
+	for rows.Next() {
+		var p refundablePayment
+		var amt, ref float64
+		if err := rows.Scan(&p.ID, &p.Provider, &p.ExternalID, &amt, &ref); err != nil {
+			rows.Close()
+			return nil, "", err
+		}
+		p.Paise = toPaise(amt) - toPaise(ref)
+		payments = append(payments, p)
+	}
+	rows.Close()
+
+	// Invoices marked paid before payments were recorded have nothing to refund against.
+	var fromPayments int64
+	for _, p := range payments {
+		fromPayments += p.Paise
+	}
+	refundable := min(toPaise(paid)-toPaise(refunded), fromPayments)
+	if refundable <= 0 {
+		return nil, "", ErrInvoiceNotRefundable
+	}
+	want := toPaise(amount)
+	if want == 0 {
+		want = refundable
+	}
+	if want < 0 || want > refundable {
+		return nil, "", ErrRefundAmount
+	}
+
+	var refunds []pendingRefund
+	for _, portion := range allocateRefund(payments, want) {
+		rf := pendingRefund{
+			Refund: models.Refund{
+				ID: uuid.New(), TenantID: tenantID, InvoiceID: invoiceID, PaymentID: portion.Payment.ID,
+				Provider: portion.Payment.Provider, Amount: fromPaise(portion.Paise), Status: RefundStatusPending, Reason: reason,
+			},
+			PaymentExternalID: portion.Payment.ExternalID,
+		}
+		err = tx.QueryRow(`
+			INSERT INTO refunds (id, tenant_id, invoice_id, payment_id, provider, amount, status, reason, created_by)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+			RETURNING created_at
+		`, rf.ID, tenantID, invoiceID, rf.PaymentID, rf.Provider, rf.Amount, RefundStatusPending, nullIfEmpty(reason),
+			uuid.NullUUID{UUID: createdBy, Valid: createdBy != uuid.Nil}).Scan(&rf.CreatedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err = tx.Exec(`
+			UPDATE payments SET refunded_amount = refunded_amount + $2 WHERE id = $1
+		`, rf.PaymentID, rf.Amount); err != nil {
+			return nil, "", err
+		}
+		refunds = append(refunds, rf)
+	}
+	if _, err = tx.Exec(`
+		UPDATE invoices SET amount_refunded = amount_refunded + $3, updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+	`, invoiceID, tenantID, fromPaise(want)); err != nil {
+		return nil, "", err
+	}
+	return refunds, currency, tx.Commit()
+}
+
+// sendRefunds asks the gateways to pay out each refund, with the refund ID as the idempotency
+// key. Payments collected at reception need no gateway. Once one refund fails the rest are not
+// attempted and fail with it.
+func sendRefunds(ctx context.Context, refunds []pendingRefund, currency string) {
+	var failed error
+	for i := range refunds {
+		rf := &refunds[i]
+		if failed != nil {
+			rf.Err = failed
+			continue
+		}
+		g, ok := refundGatewayFor(rf.Provider)
+		if !ok {
+			rf.Status = RefundStatusProcessed
+			continue
+		}
+		out, err := g.Refund(ctx, rf.PaymentExternalID, rf.Amount, currency, rf.ID.String())
+		if err != nil {
+			rf.Err = fmt.Errorf("%s refund failed: %w", rf.Provider, err)
+			failed = rf.Err
+			continue
+		}
+		rf.ExternalID = out.ID
+		rf.Status = gatewayRefundStatus(out.Status)
+	}
+}
+
+// gatewayRefundStatus maps a gateway's refund status to ours; pending there means the gateway
+// accepted the refund and is still paying it out.
+func gatewayRefundStatus(s string) string {
+	switch s {
+	case "":
+		return RefundStatusProcessed
+	case "pending":
+		return RefundStatusProcessing
+	}
+	return s
+}
+
+// finishRefunds records what the gateways did with reserved refunds: sent ones get a credit note
+// and their gateway status, failed ones give their reserved amount back. Refunds another caller
+// already finished are skipped.
+func finishRefunds(ctx context.Context, tenantID, invoiceID uuid.UUID, refunds []pendingRefund, reason string, createdBy uuid.UUID) ([]models.Refund, models.CreditNote, error) {
+	var cn models.CreditNote
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, cn, err
+	}
+	defer tx.Rollback()
+
+	var subtotal, total float64
+	var currency string
+	err = tx.QueryRow(`
+		SELECT subtotal, total, currency FROM invoices WHERE id = $1 AND tenant_id = $2 FOR UPDATE
+	`, invoiceID, tenantID).Scan(&subtotal, &total, &currency)
+	if err != nil {
+		return nil, cn, err
+	}
+	ids := make([]uuid.UUID, len(refunds))
+	for i, rf := range refunds {
+		ids[i] = rf.ID
+	}
+	rows, err := tx.Query(`
+		SELECT id FROM refunds WHERE id = ANY($1) AND invoice_id = $2 AND status = 'pending' FOR UPDATE
+	`, pq.Array(ids), invoiceID)
+	if err != nil {
+		return nil, cn, err
+	}
+	stillPending := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, cn, err
+		}
+		stillPending[id] = true
+	}
+	rows.Close()
+
+	var sent []models.Refund
+	var sentPaise, releasedPaise int64
+	for _, rf := range refunds {
+		if !stillPending[rf.ID] {
+			continue
+		}
+		if rf.Err == nil {
+			sent = append(sent, rf.Refund)
+			sentPaise += toPaise(rf.Amount)
+			continue
+		}
+		releasedPaise += toPaise(rf.Amount)
+		if _, err = tx.Exec(`UPDATE refunds SET status = 'failed' WHERE id = $1`, rf.ID); err != nil {
+			return nil, cn, err
+		}
+		if _, err = tx.Exec(`
+			UPDATE payments SET refunded_amount = refunded_amount - $2 WHERE id = $1
+		`, rf.PaymentID, rf.Amount); err != nil {
+			return nil, cn, err
+		}
+	}
+
+	if sentPaise > 0 {
+		cn, err = issueCreditNote(tx, tenantID, invoiceID, fromPaise(sentPaise), subtotal, total, currency, reason, createdBy)
+		if err != nil {
+			return nil, cn, err
+		}
+		for i := range sent {
+			rf := &sent[i]
+			rf.CreditNoteID = &cn.ID
+			if _, err = tx.Exec(`
+				UPDATE refunds SET status = $2, external_id = $3, credit_note_id = $4 WHERE id = $1
+			`, rf.ID, rf.Status, nullIfEmpty(rf.ExternalID), cn.ID); err != nil {
+				return nil, cn, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE invoices SET
+			amount_refunded = amount_refunded - $3,
+			status = CASE WHEN $4 AND amount_refunded - $3 >= amount_paid THEN 'refunded' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+	`, invoiceID, tenantID, fromPaise(releasedPaise), sentPaise > 0)
+	if err != nil {
+		return nil, cn, err
+	}
+	return sent, cn, tx.Commit()
+}
+
+// StartRefundSweeper finishes refunds left pending by a crash or a failed write after the
+// gateway call. Gateways are asked again with the same idempotency key, so nothing is paid out
+// twice.
+func StartRefundSweeper() {
+	go func() {
+		ticker := time.NewTicker(refundSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			SweepPendingRefunds(context.Background())
+		}
+	}()
+	log.Println("✅ Refund sweeper started")
+}
+
+// SweepPendingRefunds retries the gateway for refunds pending longer than refundPendingGrace
+// and records the outcome. A gateway that keeps failing is retried until refundPendingMaxAge,
+// after which the refund fails and its amount is released.
+func SweepPendingRefunds(ctx context.Context) {
+	rows, err := database.PostgresDB.QueryContext(ctx, `
+		SELECT r.id, r.tenant_id, r.invoice_id, r.payment_id, r.provider, COALESCE(p.external_id, ''),
+			r.amount, COALESCE(r.reason, ''), r.created_by, r.created_at, i.currency
+		FROM refunds r
+		JOIN payments p ON p.id = r.payment_id
+		JOIN invoices i ON i.id = r.invoice_id
+		WHERE r.status = 'pending' AND r.created_at < $1
+		ORDER BY r.created_at
+		LIMIT 100
+	`, time.Now().Add(-refundPendingGrace))
+	if err != nil {
+		log.Printf("refunds: listing pending refunds: %v", err)
+		return
+	}
+	byInvoice := map[uuid.UUID][]pendingRefund{}
+	createdBy := map[uuid.UUID]uuid.UUID{}
+	currencies := map[uuid.UUID]string{}
+	var order []uuid.UUID
+	for rows.Next() {
+		var rf pendingRefund
+		var by uuid.NullUUID
+		var currency string
+		if err := rows.Scan(&rf.ID, &rf.TenantID, &rf.InvoiceID, &rf.PaymentID, &rf.Provider, &rf.PaymentExternalID,
+			&rf.Amount, &rf.Reason, &by, &rf.CreatedAt, &currency); err != nil {
+			log.Printf("refunds: reading pending refund: %v", err)
+			continue
+		}
+		if _, seen := byInvoice[rf.InvoiceID]; !seen {
+			order = append(order, rf.InvoiceID)
+			createdBy[rf.InvoiceID] = by.UUID
+			currencies[rf.InvoiceID] = currency
+		}
+		byInvoice[rf.InvoiceID] = append(byInvoice[rf.InvoiceID], rf)
+	}
+	rows.Close()
+
+	for _, invoiceID := range order {
+		refunds := byInvoice[invoiceID]
+		sendRefunds(ctx, refunds, currencies[invoiceID])
+		var retry []pendingRefund
+		for _, rf := range refunds {
+			if rf.Err != nil {
+				if time.Since(rf.CreatedAt) < refundPendingMaxAge {
+					log.Printf("refunds: refund %s for invoice %s still pending: %v", rf.ID, invoiceID, rf.Err)
+					continue
+				}
+				log.Printf("refunds: giving up on refund %s for invoice %s: %v", rf.ID, invoiceID, rf.Err)
+			}
+			retry = append(retry, rf)
+		}
+		if len(retry) == 0 {
+			continue
+		}
+		first := retry[0]
+		if _, _, err := finishRefunds(ctx, first.TenantID, invoiceID, retry, first.Reason, createdBy[invoiceID]); err != nil {
+			log.Printf("refunds: finishing pending refunds for invoice %s: %v", invoiceID, err)
+		}
+	}
+}
+
+func issueCreditNote(tx *sql.Tx, tenantID, invoiceID uuid.UUID, amount, invSubtotal, invTotal float64, currency, reason string, createdBy uuid.UUID) (models.CreditNote, error) {
+	cn := models.CreditNote{TenantID: tenantID, InvoiceID: invoiceID, Total: amount, Currency: currency, Reason: reason}
+	cn.Subtotal, cn.GSTAmount = splitCreditNote(amount, invSubtotal, invTotal)
+
+	profile, err := loadBillingProfile(tx, tenantID)
+	if err != nil {
+		return cn, err
+	}
+	cn.CreditNoteNumber, err = nextDocumentNumber(tx, tenantID, "credit_note", profile.InvoiceNumberFormat, profile.CreditNotePrefix)
+	if err != nil {
+		return cn, err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO credit_notes (tenant_id, invoice_id, credit_note_number, subtotal, gst_amount, total, currency, reason, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		RETURNING id, issued_at
+	`, tenantID, invoiceID, cn.CreditNoteNumber, cn.Subtotal, cn.GSTAmount, cn.Total, currency, nullIfEmpty(reason),
+		uuid.NullUUID{UUID: createdBy, Valid: createdBy != uuid.Nil}).Scan(&cn.ID, &cn.IssuedAt)
+	return cn, err
+}
+
+// ListInvoiceRefunds returns the refunds and credit notes recorded against an invoice.
+func ListInvoiceRefunds(tenantID, invoiceID uuid.UUID) ([]models.Refund, []models.CreditNote, error) {
+	refunds := make([]models.Refund, 0)
+	rows, err := database.PostgresDB.Query(`
+		SELECT id, tenant_id, invoice_id, payment_id, credit_note_id, provider, COALESCE(external_id, ''),
+			amount, status, COALESCE(reason, ''), created_at
+		FROM refunds WHERE tenant_id = $1 AND invoice_id = $2 ORDER BY created_at
+	`, tenantID, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rf models.Refund
+		var cnID uuid.NullUUID
+		if err := rows.Scan(&rf.ID, &rf.TenantID, &rf.InvoiceID, &rf.PaymentID, &cnID, &rf.Provider, &rf.ExternalID,
+			&rf.Amount, &rf.Status, &rf.Reason, &rf.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		if cnID.Valid {
+			rf.CreditNoteID = &cnID.UUID
+		}
+		refunds = append(refunds, rf)
+	}
+
+	notes := make([]models.CreditNote, 0)
+	cnRows, err := database.PostgresDB.Query(`
+		SELECT `+creditNoteColumns+` FROM credit_notes WHERE tenant_id = $1 AND invoice_id = $2 ORDER BY issued_at
+	`, tenantID, invoiceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cnRows.Close()
+	for cnRows.Next() {
+		cn, err := scanCreditNote(cnRows)
+		if err != nil {
+			return nil, nil, err
+		}
+		notes = append(notes, cn)
+	}
+	return refunds, notes, nil
+}
+
+const creditNoteColumns = `id, tenant_id, invoice_id, credit_note_number, subtotal, gst_amount, total, currency,
+	COALESCE(reason, ''), issued_at`
+
+func scanCreditNote(row rowScanner) (models.CreditNote, error) {
+	var cn models.CreditNote
+	err := row.Scan(&cn.ID, &cn.TenantID, &cn.InvoiceID, &cn.CreditNoteNumber, &cn.Subtotal, &cn.GSTAmount,
+		&cn.Total, &cn.Currency, &cn.Reason, &cn.IssuedAt)
+	return cn, err
+}
+
+// GetCreditNote loads one credit note of the tenant.
+func GetCreditNote(tenantID, id uuid.UUID) (models.CreditNote, error) {
+	return scanCreditNote(database.PostgresDB.QueryRow(`
+		SELECT `+creditNoteColumns+` FROM credit_notes WHERE id = $1 AND tenant_id = $2
+	`, id, tenantID))
+}
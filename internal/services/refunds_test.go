@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAllocateRefundNewestFirst(t *testing.T) {
+	payments := []refundablePayment{
+		{ID: uuid.New(), Provider: "razorpay", Paise: 30000},
+		{ID: uuid.New(), Provider: "cash", Paise: 50000},
+	}
+	got := allocateRefund(payments, 45000)
+	if len(got) != 2 || got[0].Paise != 30000 || got[1].Paise != 15000 {
+		t.Fatalf("unexpected allocation %+v", got)
+	}
+	if got := allocateRefund(payments, 10000); len(got) != 1 || got[0].Paise != 10000 {
+		t.Fatalf("small refund should come from the newest payment: %+v", got)
+	}
+}
+
+func TestSplitCreditNote(t *testing.T) {
+	// 1000 + 18% GST invoiced; refunding 590 credits half of each.
+	sub, gst := splitCreditNote(590, 1000, 1180)
+	if sub != 500 || gst != 90 {
+		t.Fatalf("got %v + %v", sub, gst)
+	}
+	if sub, gst := splitCreditNote(100, 0, 0); sub != 100 || gst != 0 {
+		t.Fatalf("zero invoice: got %v + %v", sub, gst)
+	}
+}
+
+func TestInvoiceBalanceDue(t *testing.T) {
+	if got := InvoiceBalanceDue(1180, 500); got != 680 {
+		t.Fatalf("got %v", got)
+	}
+	if got := InvoiceBalanceDue(1180, 1200); got != 0 {
+		t.Fatalf("overpaid invoice should owe nothing, got %v", got)
+	}
+}
+
+func TestRefundGatewayFor(t *testing.T) {
+	RegisterPaymentProvider(NewSandboxProvider(""))
+	g, ok := refundGatewayFor("sandbox")
+	if !ok {
+		t.Fatal("sandbox gateway missing")
+	}
+	out, err := g.Refund(context.Background(), "pay_sbx_000001", 10, "INR", "r1")
+	if err != nil || out.ID != "rfnd_sbx_000001" {
+		t.Fatalf("unexpected refund %+v %v", out, err)
+	}
+	if again, err := g.Refund(context.Background(), "pay_sbx_000001", 10, "INR", "r1"); err != nil || again.ID != out.ID {
+		t.Fatalf("retried refund paid out again: %+v %v", again, err)
+	}
+	if _, ok := refundGatewayFor("cash"); ok {
+		t.Fatal("cash payments are refunded manually")
+	}
+}
+
+func TestSendRefundsStopsAtFirstFailure(t *testing.T) {
+	RegisterPaymentProvider(NewSandboxProvider(""))
+	refunds := []pendingRefund{
+		{Refund: models.Refund{ID: uuid.New(), Provider: "cash", Amount: 5}},
+		{Refund: models.Refund{ID: uuid.New(), Provider: "sandbox", Amount: 10}, PaymentExternalID: "pay_other"},
+		{Refund: models.Refund{ID: uuid.New(), Provider: "sandbox", Amount: 10}, PaymentExternalID: "pay_sbx_000001"},
+	}
+	sendRefunds(context.Background(), refunds, "INR")
+	if refunds[0].Err != nil || refunds[0].Status != RefundStatusProcessed {
+		t.Fatalf("manual refund: %+v", refunds[0])
+	}
+	if refunds[1].Err == nil || !errors.Is(refunds[2].Err, errors.Unwrap(refunds[1].Err)) {
+		t.Fatalf("expected the failure to stop later refunds: %v / %v", refunds[1].Err, refunds[2].Err)
+	}
+	if gatewayRefundStatus("pending") != RefundStatusProcessing || gatewayRefundStatus("") != RefundStatusProcessed {
+		t.Fatal("gateway status mapping")
+	}
+}
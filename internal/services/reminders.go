@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	reminderScheduleKey = "schedule:reminders"
+	// reminderPollInterval is how often the Redis schedule is checked for due reminders.
+	reminderPollInterval = 30 * time.Second
+	// reminderFallbackInterval is how often Postgres is scanned for due reminders Redis missed.
+	reminderFallbackInterval = 5 * time.Minute
+
+	// reminderProcessingTimeout is when a reminder claimed by a replica that never finished it
+	// can be claimed again.
+	reminderProcessingTimeout = 10 * time.Minute
+	// reminderMaxAttempts is how many failed dispatches a reminder gets before it is given up.
+	reminderMaxAttempts = 5
+
+	minReminderOffset  = 5
+	maxReminderOffset  = 7 * 24 * 60
+	maxReminderOffsets = 5
+)
+
+// DefaultReminderOffsets are used when a tenant has not configured its own (minutes before starts_at).
+var DefaultReminderOffsets = []int{1440, 60}
+
+// Only appointments in these statuses receive reminders.
+var reminderActiveStatus = map[string]bool{"scheduled": true, "confirmed": true}
+
+// ReminderMessage is the appointment context a reminder is rendered from.
+type ReminderMessage struct {
+	AppointmentID uuid.UUID
+	TenantID      uuid.UUID
+	PatientID     uuid.UUID
+	TherapistName string
+	StartsAt      time.Time
+	Timezone      string
+	OffsetMin     int
+	MeetingLink   string
+	Location      string
+	Title         string
+	Body          string
+}
+
+// ReminderSlot is one reminder to schedule for an appointment.
+type ReminderSlot struct {
+	OffsetMin int
+	RemindAt  time.Time
+}
+
+// ReminderSlots returns the reminders still ahead of now for an appointment starting at startsAt.
+func ReminderSlots(startsAt time.Time, offsets []int, now time.Time) []ReminderSlot {
+	var out []ReminderSlot
+	for _, off := range offsets {
+		at := startsAt.Add(-time.Duration(off) * time.Minute)
+		if at.After(now) {
+			out = append(out, ReminderSlot{OffsetMin: off, RemindAt: at})
+		}
+	}
+	return out
+}
+
+// NormalizeReminderOffsets validates, de-duplicates and sorts (largest first) reminder offsets.
+func NormalizeReminderOffsets(offsets []int) ([]int, error) {
+	seen := map[int]bool{}
+	out := make([]int, 0, len(offsets))
+	for _, off := range offsets {
+		if off < minReminderOffset || off > maxReminderOffset {
+			return nil, fmt.Errorf("reminder offsets must be between %d and %d minutes", minReminderOffset, maxReminderOffset)
+		}
+		if !seen[off] {
+			seen[off] = true
+			out = append(out, off)
+		}
+	}
+	if len(out) > maxReminderOffsets {
+		return nil, fmt.Errorf("at most %d reminder offsets are allowed", maxReminderOffsets)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out, nil
+}
+
+// TenantReminderOffsets returns the tenant's reminder offsets in minutes.
+func TenantReminderOffsets(tenantID uuid.UUID) []int {
+	var raw []int64
+	err := database.PostgresDB.QueryRow(
+		`SELECT reminder_offsets_min FROM tenants WHERE id = $1`, tenantID,
+	).Scan(pq.Array(&raw))
+	if err != nil {
+		return DefaultReminderOffsets
+	}
+	out := make([]int, len(raw))
+	for i, v := range raw {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// SetTenantReminderOffsets stores new offsets and re-arms reminders for upcoming appointments.
+func SetTenantReminderOffsets(tenantID uuid.UUID, offsets []int) ([]int, error) {
+	offsets, err := NormalizeReminderOffsets(offsets)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE tenants SET reminder_offsets_min = $2, updated_at = NOW() WHERE id = $1
+	`, tenantID, pq.Array(offsets)); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		rows, err := database.PostgresDB.Query(`
+			SELECT id FROM appointments
+			WHERE tenant_id = $1 AND starts_at > $2 AND status IN ('scheduled', 'confirmed')
+		`, tenantID, time.Now().UTC())
+		if err != nil {
+			log.Printf("reminders: re-arm tenant %s: %v", tenantID, err)
+			return
+		}
+		ids, err := collectIDs(rows)
+		if err != nil {
+			log.Printf("reminders: re-arm tenant %s: %v", tenantID, err)
+			return
+		}
+		for _, id := range ids {
+			ScheduleAppointmentReminders(tenantID, id)
+		}
+	}()
+	return offsets, nil
+}
+
+// ScheduleAppointmentReminders (re-)arms reminders from the appointment's current state: an
+// upcoming scheduled/confirmed appointment gets one pending reminder per tenant offset, anything
+// else has its pending reminders retracted. Call it after every create, reschedule or cancel.
+func ScheduleAppointmentReminders(tenantID, appointmentID uuid.UUID) {
+	if err := scheduleReminders(tenantID, appointmentID); err != nil {
+		log.Printf("reminders: schedule %s: %v", appointmentID, err)
+	}
+}
+
+func scheduleReminders(tenantID, appointmentID uuid.UUID) error {
+	// Retract everything pending; still-valid reminders are re-armed below.
+	rows, err := database.PostgresDB.Query(`
+		UPDATE appointment_reminders SET status = 'cancelled', updated_at = NOW()
+		WHERE appointment_id = $1 AND status = 'pending'
+		RETURNING id
+	`, appointmentID)
+	if err != nil {
+		return err
+	}
+	retracted, err := collectIDs(rows)
+	if err != nil {
+		return err
+	}
+	unscheduleReminders(retracted)
+
+	var status string
+	var startsAt time.Time
+	err = database.PostgresDB.QueryRow(`
+		SELECT status, starts_at FROM appointments WHERE id = $1 AND tenant_id = $2
+	`, appointmentID, tenantID).Scan(&status, &startsAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !reminderActiveStatus[status] {
+		return nil
+	}
+
+	for _, slot := range ReminderSlots(startsAt, TenantReminderOffsets(tenantID), time.Now().UTC()) {
+		// A reminder already sent for the same start time is not sent again.
+		var id uuid.UUID
+		err := database.PostgresDB.QueryRow(`
+			INSERT INTO appointment_reminders (appointment_id, tenant_id, offset_min, remind_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (appointment_id, offset_min) DO UPDATE
+				SET remind_at = EXCLUDED.remind_at, status = 'pending', sent_at = NULL,
+					attempts = 0, next_attempt_at = NULL, updated_at = NOW()
+				WHERE appointment_reminders.status = 'cancelled'
+					OR appointment_reminders.remind_at <> EXCLUDED.remind_at
+			RETURNING id
+		`, appointmentID, tenantID, slot.OffsetMin, slot.RemindAt).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scheduleReminder(id, slot.RemindAt)
+	}
+
+	_, err = database.PostgresDB.Exec(`
+		UPDATE appointments SET reminder_sent = FALSE
+		WHERE id = $1 AND reminder_sent
+			AND NOT EXISTS (SELECT 1 FROM appointment_reminders WHERE appointment_id = $1 AND status = 'sent')
+	`, appointmentID)
+	return err
+}
+
+func scheduleReminder(id uuid.UUID, at time.Time) {
+	if database.RedisClient == nil {
+		return
+	}
+	err := database.RedisClient.ZAdd(context.Background(), reminderScheduleKey, redis.Z{
+		Score: float64(at.Unix()), Member: id.String(),
+	}).Err()
+	if err != nil {
+		log.Printf("reminders: redis schedule failed, relying on postgres scan: %v", err)
+	}
+}
+
+func unscheduleReminders(ids []uuid.UUID) {
+	if database.RedisClient == nil || len(ids) == 0 {
+		return
+	}
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id.String()
+	}
+	_ = database.RedisClient.ZRem(context.Background(), reminderScheduleKey, members...).Err()
+}
+
+// StartReminderScheduler delivers due reminders. Redis is polled every reminderPollInterval;
+// Postgres is scanned every reminderFallbackInterval (or every poll when Redis is unavailable)
+// so reminders survive a lost Redis schedule.
+func StartReminderScheduler() {
+	go func() {
+		ticker := time.NewTicker(reminderPollInterval)
+		defer ticker.Stop()
+
+		var lastScan time.Time
+		for {
+			ids := dueRemindersFromRedis()
+			if database.RedisClient == nil || time.Since(lastScan) >= reminderFallbackInterval {
+				ids = append(ids, dueRemindersFromPostgres()...)
+				lastScan = time.Now()
+			}
+			seen := map[uuid.UUID]bool{}
+			for _, id := range ids {
+				if !seen[id] {
+					seen[id] = true
+					deliverReminder(id)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+	log.Println("✅ Appointment reminder scheduler started")
+}
+
+func dueRemindersFromRedis() []uuid.UUID {
+	if database.RedisClient == nil {
+		return nil
+	}
+	ctx := context.Background()
+	members, err := database.RedisClient.ZRangeByScore(ctx, reminderScheduleKey, &redis.ZRangeBy{
+		Min: "-inf", Max: strconv.FormatInt(time.Now().Unix(), 10), Count: 100,
+	}).Result()
+	if err != nil {
+		return nil
+	}
+	var out []uuid.UUID
+	for _, m := range members {
+		// ZREM decides which replica owns the entry.
+		if n, err := database.RedisClient.ZRem(ctx, reminderScheduleKey, m).Result(); err != nil || n == 0 {
+			continue
+		}
+		if id, err := uuid.Parse(m); err == nil {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// dueRemindersFromPostgres also picks up retries whose backoff has passed and reminders left
+// processing by a replica that stopped.
+func dueRemindersFromPostgres() []uuid.UUID {
+	now := time.Now().UTC()
+	rows, err := database.PostgresDB.Query(`
+		SELECT id FROM appointment_reminders
+		WHERE (status = 'pending' AND remind_at <= $1 AND (next_attempt_at IS NULL OR next_attempt_at <= $1))
+			OR (status = 'processing' AND updated_at < $2)
+		ORDER BY remind_at LIMIT 200
+	`, now, now.Add(-reminderProcessingTimeout))
+	if err != nil {
+		log.Printf("reminders: postgres scan: %v", err)
+		return nil
+	}
+	ids, _ := collectIDs(rows)
+	return ids
+}
+
+var errReminderStale = errors.New("appointment no longer matches reminder")
+
+func deliverReminder(id uuid.UUID) {
+	// Claim the reminder; a concurrent replica or a retraction may have got there first. It is
+	// only marked sent once the notification has been dispatched.
+	var appointmentID, tenantID uuid.UUID
+	var offsetMin, attempts int
+	var remindAt time.Time
+	err := database.PostgresDB.QueryRow(`
+		UPDATE appointment_reminders SET status = 'processing', updated_at = NOW()
+		WHERE id = $1 AND (status = 'pending' OR (status = 'processing' AND updated_at < $2))
+		RETURNING appointment_id, tenant_id, offset_min, remind_at, attempts
+	`, id, time.Now().UTC().Add(-reminderProcessingTimeout)).Scan(&appointmentID, &tenantID, &offsetMin, &remindAt, &attempts)
+	if err != nil {
+		return
+	}
+
+	msg, userID, err := loadReminderMessage(appointmentID, offsetMin, remindAt)
+	if err == errReminderStale {
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE appointment_reminders SET status = 'cancelled', updated_at = NOW() WHERE id = $1
+		`, id)
+		return
+	}
+	if err != nil {
+		retryReminder(id, attempts+1, err)
+		return
+	}
+
+	// Patients without an app account are still reachable by email/SMS through their patient record.
+	n := Notification{
+		RecipientID:   userID,
+		RecipientRole: "user",
+		Type:          "appointment_reminder",
+		Title:         msg.Title,
+		Message:       msg.Body,
+		Data: map[string]string{
+			"appointment_id": appointmentID.String(),
+			"therapist_name": msg.TherapistName,
+			"starts_in":      humanizeOffset(offsetMin),
+			"starts_at":      msg.StartsAt.Format(time.RFC3339),
+			"meeting_link":   msg.MeetingLink,
+			"location":       msg.Location,
+		},
+	}
+	if userID == uuid.Nil {
+		n.RecipientID, n.RecipientRole = msg.PatientID, "patient"
+	}
+	if err := Dispatch(n); err != nil {
+		retryReminder(id, attempts+1, fmt.Errorf("dispatch %s: %w", appointmentID, err))
+		return
+	}
+
+	res, err := database.PostgresDB.Exec(`
+		UPDATE appointment_reminders SET status = 'sent', sent_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'processing'
+	`, id)
+	if err != nil {
+		log.Printf("reminders: %s dispatched but not marked sent: %v", id, err)
+		return
+	}
+	if claimed, _ := res.RowsAffected(); claimed > 0 {
+		_, _ = database.PostgresDB.Exec(`UPDATE appointments SET reminder_sent = TRUE WHERE id = $1`, appointmentID)
+	}
+}
+
+// retryReminder puts a reminder whose delivery failed back to pending with a backoff, or marks
+// it failed once it has used up its attempts.
+func retryReminder(id uuid.UUID, attempts int, cause error) {
+	if attempts >= reminderMaxAttempts {
+		log.Printf("reminders: %s failed after %d attempts: %v", id, attempts, cause)
+		_, _ = database.PostgresDB.Exec(`
+			UPDATE appointment_reminders SET status = 'failed', attempts = $2, updated_at = NOW()
+			WHERE id = $1 AND status = 'processing'
+		`, id, attempts)
+		return
+	}
+	log.Printf("reminders: %s attempt %d failed, retrying: %v", id, attempts, cause)
+	next := time.Now().UTC().Add(OutboxBackoff(attempts))
+	res, err := database.PostgresDB.Exec(`
+		UPDATE appointment_reminders SET status = 'pending', attempts = $2, next_attempt_at = $3, updated_at = NOW()
+		WHERE id = $1 AND status = 'processing'
+	`, id, attempts, next)
+	if err != nil {
+		log.Printf("reminders: %s: requeue: %v", id, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		scheduleReminder(id, next)
+	}
+}
+
+func loadReminderMessage(appointmentID uuid.UUID, offsetMin int, remindAt time.Time) (ReminderMessage, uuid.UUID, error) {
+	msg := ReminderMessage{AppointmentID: appointmentID, OffsetMin: offsetMin}
+	var status string
+	var userID uuid.NullUUID
+	var meeting, location sql.NullString
+	err := database.PostgresDB.QueryRow(`
+		SELECT a.tenant_id, a.patient_id, a.status, a.starts_at, a.meeting_link, a.location,
+			p.user_id, t.name, tn.timezone
+		FROM appointments a
+		JOIN patients p ON p.id = a.patient_id
+		JOIN therapists t ON t.id = a.therapist_id
+		JOIN tenants tn ON tn.id = a.tenant_id
+		WHERE a.id = $1
+	`, appointmentID).Scan(&msg.TenantID, &msg.PatientID, &status, &msg.StartsAt, &meeting, &location,
+		&userID, &msg.TherapistName, &msg.Timezone)
+	if err == sql.ErrNoRows {
+		return msg, uuid.Nil, errReminderStale
+	}
+	if err != nil {
+		return msg, uuid.Nil, err
+	}
+	expected := remindAt.Add(time.Duration(offsetMin) * time.Minute)
+	if !reminderActiveStatus[status] || !msg.StartsAt.Equal(expected) || !msg.StartsAt.After(time.Now()) {
+		return msg, uuid.Nil, errReminderStale
+	}
+	msg.MeetingLink = meeting.String
+	msg.Location = location.String
+
+	loc, err := time.LoadLocation(msg.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	msg.Title = "Upcoming session reminder"
+	msg.Body = fmt.Sprintf("Your session with %s starts in %s (%s).",
+		msg.TherapistName, humanizeOffset(offsetMin), msg.StartsAt.In(loc).Format("Mon 2 Jan, 3:04 PM MST"))
+	return msg, userID.UUID, nil
+}
+
+func humanizeOffset(min int) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return strconv.Itoa(n) + " " + unit + "s"
+	}
+	switch {
+	case min >= 2*1440 && min%1440 == 0:
+		return plural(min/1440, "day")
+	case min >= 60 && min%60 == 0:
+		return plural(min/60, "hour")
+	}
+	return plural(min, "minute")
+}
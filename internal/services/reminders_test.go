@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReminderSlotsSkipsPast(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	startsAt := now.Add(3 * time.Hour)
+	slots := ReminderSlots(startsAt, []int{1440, 60}, now)
+	if len(slots) != 1 || slots[0].OffsetMin != 60 || !slots[0].RemindAt.Equal(startsAt.Add(-time.Hour)) {
+		t.Fatalf("unexpected slots %+v", slots)
+	}
+}
+
+func TestNormalizeReminderOffsets(t *testing.T) {
+	got, err := NormalizeReminderOffsets([]int{60, 1440, 60, 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != 1440 || got[1] != 60 || got[2] != 15 {
+		t.Fatalf("unexpected offsets %v", got)
+	}
+	if _, err := NormalizeReminderOffsets([]int{1}); err == nil {
+		t.Fatal("expected error for offset below minimum")
+	}
+	if _, err := NormalizeReminderOffsets([]int{10, 20, 30, 40, 50, 60}); err == nil {
+		t.Fatal("expected error for too many offsets")
+	}
+}
+
+func TestHumanizeOffset(t *testing.T) {
+	cases := map[int]string{1440: "24 hours", 60: "1 hour", 30: "30 minutes", 2880: "2 days", 90: "90 minutes"}
+	for in, want := range cases {
+		if got := humanizeOffset(in); got != want {
+			t.Fatalf("humanizeOffset(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -79,6 +79,7 @@ func ValidateSession(sessionToken string) (uuid.UUID, bool, error) {
 	userSessionKey := UserSessionKeyPrefix + userID.String()
 	database.RedisClient.Expire(ctx, sessionKey, SessionDuration)
 	database.RedisClient.Expire(ctx, userSessionKey, SessionDuration)
+	touchOpaqueSession(sessionToken)
 
 	return userID, true, nil
 }
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// Slot hold statuses. Only held counts against the slot; a confirmed hold's appointment does.
+const (
+	SlotHoldHeld      = "held"
+	SlotHoldConfirmed = "confirmed"
+	SlotHoldReleased  = "released"
+	SlotHoldExpired   = "expired"
+)
+
+const (
+	// SlotHoldTTL is how long a patient has to pay for a slot they started booking.
+	SlotHoldTTL = 10 * time.Minute
+
+	slotHoldScheduleKey = "schedule:slot_holds"
+	slotHoldKeyPrefix   = "hold:slot:"
+	// slotHoldPollInterval is how often the Redis schedule is checked for lapsed holds.
+	slotHoldPollInterval = 15 * time.Second
+	// slotHoldFallbackInterval is how often Postgres is scanned for lapsed holds Redis missed and
+	// for late payments to refund.
+	slotHoldFallbackInterval = 2 * time.Minute
+
+	slotHoldCancelReason = "Payment was not completed before the slot hold expired"
+	slotHoldRefundReason = "Payment received after the slot hold expired"
+)
+
+var (
+	ErrSlotHeld        = errors.New("this time slot is being booked by someone else")
+	ErrSlotTaken       = errors.New("this time slot is already booked")
+	ErrSlotHoldExpired = errors.New("the hold on this time slot expired before payment completed")
+)
+
+// SlotHold reserves a practitioner's slot for one patient while they pay for it.
+type SlotHold struct {
+	ID            uuid.UUID  `json:"id"`
+	TenantID      uuid.UUID  `json:"tenant_id"`
+	TherapistID   uuid.UUID  `json:"therapist_id"`
+	PatientID     uuid.UUID  `json:"patient_id"`
+	AppointmentID *uuid.UUID `json:"appointment_id,omitempty"`
+	StartsAt      time.Time  `json:"starts_at"`
+	EndsAt        time.Time  `json:"ends_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	Status        string     `json:"status"`
+}
+
+// releaseSlotKeyScript deletes a reservation key only while it still belongs to the hold.
+var releaseSlotKeyScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func slotReservationKey(therapistID uuid.UUID, startsAt time.Time) string {
+	return slotHoldKeyPrefix + therapistID.String() + ":" + strconv.FormatInt(startsAt.Unix(), 10)
+}
+
+// lockTherapistSlots serializes hold changes for one practitioner within tx. It is always taken
+// before any slot_holds row lock.
+func lockTherapistSlots(tx *sql.Tx, therapistID uuid.UUID) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "slots:"+therapistID.String())
+	return err
+}
+
+// HoldSlot reserves h's slot for ttl (SlotHoldTTL when 0) inside tx. The reservation is taken
+// atomically in Redis first, so racing patients fail fast, then recorded in Postgres, whose
+// exclusion constraint is the final word on overlapping holds. If tx is rolled back the caller
+// must call DropSlotReservation.
+func HoldSlot(tx *sql.Tx, h SlotHold, ttl time.Duration) (*SlotHold, error) {
+	if ttl <= 0 {
+		ttl = SlotHoldTTL
+	}
+	h.ID = uuid.New()
+	h.Status = SlotHoldHeld
+	h.StartsAt, h.EndsAt = h.StartsAt.UTC(), h.EndsAt.UTC()
+	h.ExpiresAt = time.Now().Add(ttl).UTC()
+
+	if database.RedisClient != nil {
+		ok, err := database.RedisClient.SetNX(context.Background(),
+			slotReservationKey(h.TherapistID, h.StartsAt), h.ID.String(), ttl).Result()
+		if err == nil && !ok {
+			return nil, ErrSlotHeld
+		}
+		if err != nil {
+			log.Printf("slot holds: redis reservation failed, relying on postgres: %v", err)
+		}
+	}
+	if err := insertSlotHold(tx, &h); err != nil {
+		DropSlotReservation(&h)
+		return nil, err
+	}
+	scheduleSlotHoldExpiry(h.ID, h.ExpiresAt)
+	return &h, nil
+}
+
+func insertSlotHold(tx *sql.Tx, h *SlotHold) error {
+	if err := lockTherapistSlots(tx, h.TherapistID); err != nil {
+		return err
+	}
+	// Lapsed holds nobody paid for in time would otherwise block the slot until the sweeper
+	// gets to them
+	rows, err := tx.Query(`
+		UPDATE slot_holds h SET status = 'expired', ended_at = NOW()
+		WHERE h.therapist_id = $1 AND h.status = 'held' AND h.expires_at <= NOW()
+			AND h.starts_at < $3 AND h.ends_at > $2
+			AND NOT `+timelyHoldPayment+`
+		RETURNING h.appointment_id
+	`, h.TherapistID, h.StartsAt, h.EndsAt)
+	if err != nil {
+		return err
+	}
+	var lapsed []uuid.UUID
+	for rows.Next() {
+		var aptID uuid.NullUUID
+		if err := rows.Scan(&aptID); err != nil {
+			rows.Close()
+			return err
+		}
+		if aptID.Valid {
+			lapsed = append(lapsed, aptID.UUID)
+		}
+	}
+	rows.Close()
+	for _, aptID := range lapsed {
+		if err := cancelHeldAppointment(tx, aptID); err != nil {
+			return err
+		}
+	}
+
+	var taken bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM appointments
+			WHERE therapist_id = $1 AND status NOT IN ('cancelled', 'no_show', 'pending_payment')
+				AND starts_at < $3 AND ends_at > $2
+		)
+	`, h.TherapistID, h.StartsAt, h.EndsAt).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSlotTaken
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO slot_holds (id, tenant_id, therapist_id, patient_id, starts_at, ends_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, h.ID, h.TenantID, h.TherapistID, h.PatientID, h.StartsAt, h.EndsAt, h.ExpiresAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23P01" { // exclusion_violation
+		return ErrSlotHeld
+	}
+	return err
+}
+
+// AttachSlotHold links a hold to the pending appointment it was taken for.
+func AttachSlotHold(tx *sql.Tx, holdID, appointmentID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE slot_holds SET appointment_id = $2 WHERE id = $1`, holdID, appointmentID)
+	return err
+}
+
+// DropSlotReservation clears a hold's Redis reservation, for holds that were rolled back or
+// have ended.
+func DropSlotReservation(h *SlotHold) {
+	if h == nil || database.RedisClient == nil {
+		return
+	}
+	ctx := context.Background()
+	_ = releaseSlotKeyScript.Run(ctx, database.RedisClient,
+		[]string{slotReservationKey(h.TherapistID, h.StartsAt)}, h.ID.String()).Err()
+	_ = database.RedisClient.ZRem(ctx, slotHoldScheduleKey, h.ID.String()).Err()
+}
+
+func scheduleSlotHoldExpiry(id uuid.UUID, at time.Time) {
+	if database.RedisClient == nil {
+		return
+	}
+	err := database.RedisClient.ZAdd(context.Background(), slotHoldScheduleKey, redis.Z{
+		Score: float64(at.Unix()), Member: id.String(),
+	}).Err()
+	if err != nil {
+		log.Printf("slot holds: redis schedule failed, relying on postgres scan: %v", err)
+	}
+}
+
+// timelyHoldPayment is true when hold h's booking was paid before the hold lapsed.
+const timelyHoldPayment = `EXISTS (
+	SELECT 1 FROM invoices i JOIN payments p ON p.invoice_id = i.id
+	WHERE i.appointment_id = h.appointment_id AND p.status = 'succeeded' AND p.updated_at <= h.expires_at
+)`
+
+// ConfirmSlotHold marks the hold on a paid booking confirmed, inside the transaction that
+// schedules the appointment. A hold that has lapsed is expired and its appointment cancelled
+// instead, and ErrSlotHoldExpired returned: the caller should commit, then refund with
+// RefundLateHoldPayment. Bookings without a hold are left alone.
+func ConfirmSlotHold(tx *sql.Tx, appointmentID uuid.UUID) (*SlotHold, error) {
+	var therapistID uuid.UUID
+	err := tx.QueryRow(`
+		SELECT therapist_id FROM slot_holds WHERE appointment_id = $1 ORDER BY created_at DESC LIMIT 1
+	`, appointmentID).Scan(&therapistID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := lockTherapistSlots(tx, therapistID); err != nil {
+		return nil, err
+	}
+	h, err := scanSlotHold(tx.QueryRow(`
+		SELECT `+slotHoldColumns+` FROM slot_holds
+		WHERE appointment_id = $1 ORDER BY created_at DESC LIMIT 1
+		FOR UPDATE
+	`, appointmentID))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.Status == SlotHoldConfirmed:
+		return &h, nil
+	case h.Status == SlotHoldHeld && time.Now().Before(h.ExpiresAt):
+		_, err = tx.Exec(`UPDATE slot_holds SET status = 'confirmed', ended_at = NOW() WHERE id = $1`, h.ID)
+		h.Status = SlotHoldConfirmed
+		return &h, err
+	case h.Status == SlotHoldHeld:
+		if _, err := tx.Exec(`UPDATE slot_holds SET status = 'expired', ended_at = NOW() WHERE id = $1`, h.ID); err != nil {
+			return nil, err
+		}
+		if err := cancelHeldAppointment(tx, appointmentID); err != nil {
+			return nil, err
+		}
+		h.Status = SlotHoldExpired
+	}
+	return &h, ErrSlotHoldExpired
+}
+
+// ReleaseSlotHold gives up the hold on a booking that was abandoned or cancelled before payment.
+func ReleaseSlotHold(appointmentID uuid.UUID) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var therapistID uuid.UUID
+	err = tx.QueryRow(`
+		SELECT therapist_id FROM slot_holds WHERE appointment_id = $1 AND status = 'held' LIMIT 1
+	`, appointmentID).Scan(&therapistID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := lockTherapistSlots(tx, therapistID); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`
+		UPDATE slot_holds SET status = 'released', ended_at = NOW()
+		WHERE appointment_id = $1 AND status = 'held'
+		RETURNING `+slotHoldColumns, appointmentID)
+	if err != nil {
+		return err
+	}
+	var released []SlotHold
+	for rows.Next() {
+		h, err := scanSlotHold(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		released = append(released, h)
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range released {
+		DropSlotReservation(&released[i])
+	}
+	return nil
+}
+
+func cancelHeldAppointment(tx *sql.Tx, appointmentID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE appointments SET status = 'cancelled', cancelled_at = NOW(), cancel_reason = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending_payment'
+	`, appointmentID, slotHoldCancelReason)
+	return err
+}
+
+const slotHoldColumns = `id, tenant_id, therapist_id, patient_id, appointment_id, starts_at, ends_at, expires_at, status`
+
+func scanSlotHold(row rowScanner) (SlotHold, error) {
+	var h SlotHold
+	var aptID uuid.NullUUID
+	err := row.Scan(&h.ID, &h.TenantID, &h.TherapistID, &h.PatientID, &aptID,
+		&h.StartsAt, &h.EndsAt, &h.ExpiresAt, &h.Status)
+	if aptID.Valid {
+		h.AppointmentID = &aptID.UUID
+	}
+	return h, err
+}
+
+// ── Expiry ──────────────────────────────────────────────────────────────────
+
+// StartSlotHoldSweeper ends lapsed holds and refunds payments that arrived after their hold did.
+// Redis is polled every slotHoldPollInterval; Postgres is scanned every slotHoldFallbackInterval
+// (or every poll when Redis is unavailable).
+func StartSlotHoldSweeper() {
+	go func() {
+		ticker := time.NewTicker(slotHoldPollInterval)
+		defer ticker.Stop()
+
+		var lastScan time.Time
+		for {
+			ids := dueSlotHoldsFromRedis()
+			fullScan := database.RedisClient == nil || time.Since(lastScan) >= slotHoldFallbackInterval
+			if fullScan {
+				ids = append(ids, lapsedSlotHoldsFromPostgres()...)
+				lastScan = time.Now()
+			}
+			seen := map[uuid.UUID]bool{}
+			for _, id := range ids {
+				if !seen[id] {
+					seen[id] = true
+					if err := ExpireSlotHold(id); err != nil {
+						log.Printf("slot holds: expire %s: %v", id, err)
+					}
+				}
+			}
+			if fullScan {
+				RefundLateHoldPayments()
+			}
+			<-ticker.C
+		}
+	}()
+	log.Println("✅ Slot hold sweeper started")
+}
+
+func dueSlotHoldsFromRedis() []uuid.UUID {
+	if database.RedisClient == nil {
+		return nil
+	}
+	ctx := context.Background()
+	members, err := database.RedisClient.ZRangeByScore(ctx, slotHoldScheduleKey, &redis.ZRangeBy{
+		Min: "-inf", Max: strconv.FormatInt(time.Now().Unix(), 10), Count: 100,
+	}).Result()
+	if err != nil {
+		return nil
+	}
+	var out []uuid.UUID
+	for _, m := range members {
+		// ZREM decides which replica owns the entry.
+		if n, err := database.RedisClient.ZRem(ctx, slotHoldScheduleKey, m).Result(); err != nil || n == 0 {
+			continue
+		}
+		if id, err := uuid.Parse(m); err == nil {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func lapsedSlotHoldsFromPostgres() []uuid.UUID {
+	rows, err := database.PostgresDB.Query(`
+		SELECT id FROM slot_holds WHERE status = 'held' AND expires_at <= NOW()
+		ORDER BY expires_at LIMIT 200
+	`)
+	if err != nil {
+		log.Printf("slot holds: postgres scan: %v", err)
+		return nil
+	}
+	ids, _ := collectIDs(rows)
+	return ids
+}
+
+// ExpireSlotHold ends a lapsed hold. A booking paid before the hold lapsed, whose client never
+// came back to verify, is scheduled; otherwise the pending appointment is cancelled.
+func ExpireSlotHold(id uuid.UUID) error {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var therapistID uuid.UUID
+	err = tx.QueryRow(`SELECT therapist_id FROM slot_holds WHERE id = $1`, id).Scan(&therapistID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := lockTherapistSlots(tx, therapistID); err != nil {
+		return err
+	}
+	var paid bool
+	h, err := scanSlotHold(tx.QueryRow(`SELECT `+slotHoldColumns+` FROM slot_holds WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return err
+	}
+	if h.Status != SlotHoldHeld {
+		return nil
+	}
+	if time.Now().Before(h.ExpiresAt) {
+		// Popped from Redis early (clock skew between replicas); try again later
+		scheduleSlotHoldExpiry(h.ID, h.ExpiresAt)
+		return nil
+	}
+	if err := tx.QueryRow(`SELECT `+timelyHoldPayment+` FROM slot_holds h WHERE h.id = $1`, id).Scan(&paid); err != nil {
+		return err
+	}
+
+	if paid && h.AppointmentID != nil {
+		if _, err := tx.Exec(`UPDATE slot_holds SET status = 'confirmed', ended_at = NOW() WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE appointments SET status = 'scheduled', updated_at = NOW()
+			WHERE id = $1 AND status = 'pending_payment'
+		`, *h.AppointmentID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO therapist_user_connections (id, therapist_id, user_id, connected_at, connection_type)
+			SELECT gen_random_uuid(), $1, user_id, NOW(), 'booking' FROM patients WHERE id = $2 AND user_id IS NOT NULL
+			ON CONFLICT (therapist_id, user_id) DO NOTHING
+		`, h.TherapistID, h.PatientID); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(`UPDATE slot_holds SET status = 'expired', ended_at = NOW() WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if h.AppointmentID != nil {
+			if err := cancelHeldAppointment(tx, *h.AppointmentID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	DropSlotReservation(&h)
+	if paid && h.AppointmentID != nil {
+		EnqueueCalendarSync("create", h.TenantID, *h.AppointmentID)
+		ScheduleAppointmentReminders(h.TenantID, *h.AppointmentID)
+	}
+	return nil
+}
+
+// RefundLateHoldPayments refunds bookings paid after their hold expired or was released, such as
+// captures reported only by a webhook.
+func RefundLateHoldPayments() {
+	rows, err := database.PostgresDB.Query(`
+		SELECT h.id FROM slot_holds h
+		WHERE h.status IN ('expired', 'released') AND h.payment_refunded_at IS NULL
+			AND EXISTS (SELECT 1 FROM invoices i WHERE i.appointment_id = h.appointment_id AND i.amount_paid > i.amount_refunded)
+		ORDER BY h.ended_at LIMIT 50
+	`)
+	if err != nil {
+		log.Printf("slot holds: refund scan: %v", err)
+		return
+	}
+	ids, _ := collectIDs(rows)
+	for _, id := range ids {
+		if _, err := RefundLateHoldPayment(context.Background(), id); err != nil {
+			log.Printf("slot holds: refund for hold %s: %v", id, err)
+		}
+	}
+}
+
+// RefundLateHoldPayment refunds everything paid for an expired or released hold's booking and
+// tells the patient. It reports whether money was returned.
+func RefundLateHoldPayment(ctx context.Context, holdID uuid.UUID) (bool, error) {
+	var tenantID, patientID, invoiceID uuid.UUID
+	err := database.PostgresDB.QueryRowContext(ctx, `
+		SELECT h.tenant_id, h.patient_id, i.id FROM slot_holds h
+		JOIN invoices i ON i.appointment_id = h.appointment_id
+		WHERE h.id = $1 AND h.status IN ('expired', 'released') AND h.payment_refunded_at IS NULL
+		ORDER BY i.created_at DESC LIMIT 1
+	`, holdID).Scan(&tenantID, &patientID, &invoiceID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	res, err := RefundInvoice(ctx, tenantID, invoiceID, 0, slotHoldRefundReason, uuid.Nil)
+	if err != nil && !errors.Is(err, ErrInvoiceNotRefundable) {
+		return false, err
+	}
+	// A partial gateway failure is retried on the next scan
+	if res.Incomplete != nil {
+		return len(res.Refunds) > 0, res.Incomplete
+	}
+	if _, err := database.PostgresDB.ExecContext(ctx, `
+		UPDATE slot_holds SET payment_refunded_at = NOW() WHERE id = $1
+	`, holdID); err != nil {
+		return false, err
+	}
+	refunded := len(res.Refunds) > 0
+	if refunded {
+		NotifyPatientByID(patientID, "Booking payment refunded",
+			fmt.Sprintf("Your payment of %.2f %s arrived after your slot reservation expired, so the booking was not made and the payment has been refunded.",
+				res.CreditNote.Total, res.CreditNote.Currency),
+			"payment")
+	}
+	return refunded, nil
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSlotReservationKeyIgnoresTimezone(t *testing.T) {
+	therapistID := uuid.New()
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	utc := time.Date(2026, 5, 4, 4, 30, 0, 0, time.UTC)
+	if slotReservationKey(therapistID, utc) != slotReservationKey(therapistID, utc.In(loc)) {
+		t.Fatal("the same instant must map to the same reservation")
+	}
+	if slotReservationKey(therapistID, utc) == slotReservationKey(therapistID, utc.Add(time.Minute)) {
+		t.Fatal("different starts must not share a reservation")
+	}
+	if slotReservationKey(therapistID, utc) == slotReservationKey(uuid.New(), utc) {
+		t.Fatal("practitioners must not share reservations")
+	}
+}
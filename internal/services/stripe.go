@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/models"
+)
+
+// StripeProvider takes payments with Stripe PaymentIntents. The intent ID serves as both the
+// order and the payment ID, and refunds are issued against the intent.
+type StripeProvider struct {
+	secretKey      string
+	publishableKey string
+	webhookSecret  string
+	baseURL        string
+}
+
+func NewStripeProvider(secretKey, publishableKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{secretKey: secretKey, publishableKey: publishableKey, webhookSecret: webhookSecret,
+		baseURL: "https://api.stripe.com/v1"}
+}
+
+func (p *StripeProvider) Name() string { return "stripe" }
+
+// stripeWebhookTolerance bounds how old a signed webhook may be, against replays.
+const stripeWebhookTolerance = 5 * time.Minute
+
+func (p *StripeProvider) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string) ([]byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("stripe error: %s", string(data))
+	}
+	return data, nil
+}
+
+type stripeIntent struct {
+	ID           string `json:"id"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	ClientSecret string `json:"client_secret"`
+}
+
+func (p *StripeProvider) CreateOrder(ctx context.Context, amount float64, currency, receipt string) (PaymentOrder, error) {
+	form := url.Values{
+		"amount":                             {strconv.FormatInt(toPaise(amount), 10)},
+		"currency":                           {strings.ToLower(currency)},
+		"metadata[receipt]":                  {receipt},
+		"automatic_payment_methods[enabled]": {"true"},
+	}
+	data, err := p.do(ctx, http.MethodPost, "/payment_intents", form, "")
+	if err != nil {
+		return PaymentOrder{}, err
+	}
+	var intent stripeIntent
+	if err := json.Unmarshal(data, &intent); err != nil {
+		return PaymentOrder{}, err
+	}
+	return PaymentOrder{
+		Provider: p.Name(), ID: intent.ID, Amount: intent.Amount, Currency: strings.ToUpper(intent.Currency),
+		Checkout: map[string]string{"publishable_key": p.publishableKey, "client_secret": intent.ClientSecret},
+	}, nil
+}
+
+// VerifyCallback has no signature to check: the intent is fetched and must have succeeded.
+func (p *StripeProvider) VerifyCallback(ctx context.Context, cb PaymentCallback) (string, error) {
+	intent, err := p.fetchIntent(ctx, cb.OrderID)
+	if err != nil {
+		return "", err
+	}
+	if intent.Status != "succeeded" {
+		return "", fmt.Errorf("payment intent is %s", intent.Status)
+	}
+	return intent.ID, nil
+}
+
+func (p *StripeProvider) fetchIntent(ctx context.Context, id string) (stripeIntent, error) {
+	var intent stripeIntent
+	if !strings.HasPrefix(id, "pi_") {
+		return intent, errors.New("not a stripe payment intent")
+	}
+	data, err := p.do(ctx, http.MethodGet, "/payment_intents/"+url.PathEscape(id), nil, "")
+	if err != nil {
+		return intent, err
+	}
+	err = json.Unmarshal(data, &intent)
+	return intent, err
+}
+
+func (p *StripeProvider) VerifyWebhook(body []byte, header http.Header) bool {
+	return stripeSignatureValid(header.Get("Stripe-Signature"), body, p.webhookSecret, time.Now())
+}
+
+// stripeSignatureValid checks a Stripe-Signature header ("t=...,v1=...") against body.
+func stripeSignatureValid(header string, body []byte, secret string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, s := range sigs {
+		if hmac.Equal([]byte(expected), []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *StripeProvider) ParseWebhook(body []byte, _ http.Header) (models.PaymentEvent, error) {
+	var env struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object struct {
+				ID            string `json:"id"`
+				Object        string `json:"object"`
+				PaymentIntent string `json:"payment_intent"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return models.PaymentEvent{}, err
+	}
+	if env.ID == "" || env.Type == "" {
+		return models.PaymentEvent{}, errors.New("missing event id or type")
+	}
+	intent := env.Data.Object.PaymentIntent
+	if env.Data.Object.Object == "payment_intent" {
+		intent = env.Data.Object.ID
+	}
+	ev := models.PaymentEvent{
+		Provider: p.Name(), EventID: env.ID, EventType: env.Type,
+		OrderID: intent, PaymentID: intent, Payload: json.RawMessage(body),
+	}
+	if env.Created > 0 {
+		t := time.Unix(env.Created, 0).UTC()
+		ev.OccurredAt = &t
+	}
+	return ev, nil
+}
+
+var stripeEventStatuses = map[string]string{
+	"payment_intent.amount_capturable_updated": PaymentAuthorized,
+	"payment_intent.succeeded":                 PaymentSucceeded,
+	"payment_intent.payment_failed":            PaymentFailed,
+	"payment_intent.canceled":                  PaymentFailed,
+}
+
+func (p *StripeProvider) EventStatus(eventType string) (string, bool) {
+	s, ok := stripeEventStatuses[eventType]
+	return s, ok
+}
+
+// Refund refunds part or all of a payment intent. receipt doubles as the idempotency key, so a
+// retried refund is not paid out twice.
+func (p *StripeProvider) Refund(ctx context.Context, paymentID string, amount float64, _, receipt string) (GatewayRefund, error) {
+	if !strings.HasPrefix(paymentID, "pi_") {
+		return GatewayRefund{}, errors.New("payment has no stripe payment intent")
+	}
+	form := url.Values{
+		"payment_intent":    {paymentID},
+		"amount":            {strconv.FormatInt(toPaise(amount), 10)},
+		"metadata[receipt]": {receipt},
+	}
+	data, err := p.do(ctx, http.MethodPost, "/refunds", form, "refund-"+receipt)
+	if err != nil {
+		return GatewayRefund{}, err
+	}
+	var out struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return GatewayRefund{}, err
+	}
+	status := "pending"
+	if out.Status == "succeeded" {
+		status = "processed"
+	}
+	return GatewayRefund{ID: out.ID, Status: status}, nil
+}
+
+func (p *StripeProvider) FetchOrderPayments(ctx context.Context, orderID string) ([]ProviderPayment, error) {
+	intent, err := p.fetchIntent(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return []ProviderPayment{{ID: intent.ID, OrderID: intent.ID, Status: stripeIntentStatus(intent.Status)}}, nil
+}
+
+func stripeIntentStatus(s string) string {
+	switch s {
+	case "succeeded":
+		return PaymentSucceeded
+	case "requires_capture":
+		return PaymentAuthorized
+	case "canceled":
+		return PaymentFailed
+	}
+	return PaymentPending
+}
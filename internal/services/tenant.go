@@ -4,17 +4,25 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/AnshRaj112/serenify-backend/internal/database"
 	"github.com/AnshRaj112/serenify-backend/pkg/utils"
 	"github.com/google/uuid"
 )
 
+// EnsureTenantForTherapist returns the practice the therapist works in, creating a solo practice
+// with the therapist as owner when they belong to none. A therapist in several practices gets
+// the one they joined most recently.
 func EnsureTenantForTherapist(therapistID uuid.UUID) (uuid.UUID, error) {
 	var tenantID uuid.UUID
-	err := database.PostgresDB.QueryRow(
-		`SELECT id FROM tenants WHERE therapist_id = $1`, therapistID,
-	).Scan(&tenantID)
+	err := database.PostgresDB.QueryRow(`
+		SELECT m.tenant_id FROM tenant_members m
+		JOIN tenants tn ON tn.id = m.tenant_id
+		WHERE m.therapist_id = $1 AND m.is_active = TRUE AND tn.is_active = TRUE
+		ORDER BY m.joined_at DESC
+		LIMIT 1
+	`, therapistID).Scan(&tenantID)
 	if err == nil {
 		return tenantID, nil
 	}
@@ -30,23 +38,40 @@ func EnsureTenantForTherapist(therapistID uuid.UUID) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 
-	err = database.PostgresDB.QueryRow(`
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	// tenants.therapist_id is no longer unique, so serialise concurrent first sign-ins
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "tenant:"+therapistID.String()); err != nil {
+		return uuid.Nil, err
+	}
+	err = tx.QueryRow(`
+		SELECT tenant_id FROM tenant_members WHERE therapist_id = $1 AND is_active = TRUE LIMIT 1
+	`, therapistID).Scan(&tenantID)
+	if err == nil {
+		return tenantID, nil
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, err
+	}
+	err = tx.QueryRow(`
 		INSERT INTO tenants (therapist_id, display_name)
 		VALUES ($1, $2)
 		RETURNING id
 	`, therapistID, displayName).Scan(&tenantID)
-	return tenantID, err
-}
-
-func TherapistOwnsTenant(therapistID, tenantID uuid.UUID) (bool, error) {
-	var exists bool
-	err := database.PostgresDB.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM tenants
-			WHERE id = $1 AND therapist_id = $2 AND is_active = TRUE
-		)
-	`, tenantID, therapistID).Scan(&exists)
-	return exists, err
+	if err != nil {
+		return uuid.Nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO tenant_members (tenant_id, therapist_id, role)
+		VALUES ($1, $2, $3)
+	`, tenantID, therapistID, MemberRoleOwner)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return tenantID, tx.Commit()
 }
 
 func GetTenantIDForTherapist(therapistID uuid.UUID) (uuid.UUID, error) {
@@ -157,3 +182,17 @@ func SyncConnectedUsersToPatients(tenantID, therapistID uuid.UUID) error {
 	}
 	return nil
 }
+
+// TenantLocation returns the tenant's configured timezone, falling back to Asia/Kolkata.
+func TenantLocation(tenantID uuid.UUID) *time.Location {
+	name := "Asia/Kolkata"
+	_ = database.PostgresDB.QueryRow(`SELECT timezone FROM tenants WHERE id = $1`, tenantID).Scan(&name)
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, _ = time.LoadLocation("Asia/Kolkata")
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/AnshRaj112/serenify-backend/internal/database"
+	"github.com/google/uuid"
+)
+
+// Practitioner roles within a tenant. The owner is the therapist who created the practice
+// (tenants.therapist_id); admins manage the practice alongside them; members see shared
+// patients and run their own calendar.
+const (
+	MemberRoleOwner  = "owner"
+	MemberRoleAdmin  = "admin"
+	MemberRoleMember = "member"
+)
+
+// TenantInvitationTTL is how long an invitation to join a practice stays open.
+const TenantInvitationTTL = 14 * 24 * time.Hour
+
+// TenantInvitationNotificationType is the notification type sent to an existing therapist
+// invited to a practice.
+const TenantInvitationNotificationType = "tenant_invitation"
+
+var (
+	ErrMemberNotFound      = errors.New("practitioner is not a member of this tenant")
+	ErrInvalidMemberRole   = errors.New("role must be admin or member")
+	ErrOwnerMembership     = errors.New("the practice owner cannot be changed or removed")
+	ErrAlreadyMember       = errors.New("therapist is already a member of this tenant")
+	ErrInvitationPending   = errors.New("an invitation is already pending for this email")
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvitationExpired   = errors.New("invitation has expired")
+	ErrInvalidInviteeEmail = errors.New("a valid email is required")
+)
+
+// TenantMember is a practitioner of a tenant.
+type TenantMember struct {
+	TherapistID uuid.UUID `json:"therapist_id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	IsActive    bool      `json:"is_active"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// TenantInvitation is an open or answered invitation to join a tenant.
+type TenantInvitation struct {
+	ID         uuid.UUID  `json:"id"`
+	TenantID   uuid.UUID  `json:"tenant_id"`
+	TenantName string     `json:"tenant_name,omitempty"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	InvitedBy  uuid.UUID  `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TherapistTenant is a practice a therapist belongs to.
+type TherapistTenant struct {
+	TenantID    uuid.UUID `json:"tenant_id"`
+	DisplayName string    `json:"display_name"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// IsTenantAdminRole reports whether a member role may manage the practice.
+func IsTenantAdminRole(role string) bool {
+	return role == MemberRoleOwner || role == MemberRoleAdmin
+}
+
+// TenantMemberRole returns the therapist's role in an active tenant. ok is false when the
+// therapist is not an active member.
+func TenantMemberRole(tenantID, therapistID uuid.UUID) (role string, ok bool, err error) {
+	err = database.PostgresDB.QueryRow(`
+		SELECT m.role FROM tenant_members m
+		JOIN tenants tn ON tn.id = m.tenant_id
+		WHERE m.tenant_id = $1 AND m.therapist_id = $2 AND m.is_active = TRUE AND tn.is_active = TRUE
+	`, tenantID, therapistID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return role, true, nil
+}
+
+// MemberPermissions returns a practitioner's permissions: everything for owners and admins,
+// otherwise their assigned staff roles, defaulting to associate therapist.
+func MemberPermissions(tenantID, therapistID uuid.UUID, role string) (PermissionSet, error) {
+	if IsTenantAdminRole(role) {
+		return AllPermissions(), nil
+	}
+	return StaffPermissions(tenantID, therapistID, RoleAssociateTherapist)
+}
+
+// ListTherapistTenants returns the practices the therapist is an active member of.
+func ListTherapistTenants(therapistID uuid.UUID) ([]TherapistTenant, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT tn.id, tn.display_name, m.role, m.joined_at
+		FROM tenant_members m
+		JOIN tenants tn ON tn.id = m.tenant_id
+		WHERE m.therapist_id = $1 AND m.is_active = TRUE AND tn.is_active = TRUE
+		ORDER BY m.joined_at DESC
+	`, therapistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tenants := make([]TherapistTenant, 0)
+	for rows.Next() {
+		var t TherapistTenant
+		if err := rows.Scan(&t.TenantID, &t.DisplayName, &t.Role, &t.JoinedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// ListTenantMembers returns the tenant's practitioners, including removed ones.
+func ListTenantMembers(tenantID uuid.UUID) ([]TenantMember, error) {
+	rows, err := database.PostgresDB.Query(`
+		SELECT m.therapist_id, COALESCE(t.name, ''), COALESCE(t.email, ''), m.role, m.is_active, m.joined_at
+		FROM tenant_members m
+		JOIN therapists t ON t.id = m.therapist_id
+		WHERE m.tenant_id = $1
+		ORDER BY m.is_active DESC, m.joined_at
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]TenantMember, 0)
+	for rows.Next() {
+		var m TenantMember
+		if err := rows.Scan(&m.TherapistID, &m.Name, &m.Email, &m.Role, &m.IsActive, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetTenantMemberRole makes an active member an admin or a plain member.
+func SetTenantMemberRole(tenantID, therapistID uuid.UUID, role string) error {
+	if role != MemberRoleAdmin && role != MemberRoleMember {
+		return ErrInvalidMemberRole
+	}
+	current, ok, err := TenantMemberRole(tenantID, therapistID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMemberNotFound
+	}
+	if current == MemberRoleOwner {
+		return ErrOwnerMembership
+	}
+	_, err = database.PostgresDB.Exec(`
+		UPDATE tenant_members SET role = $3, updated_at = NOW() WHERE tenant_id = $1 AND therapist_id = $2
+	`, tenantID, therapistID, role)
+	return err
+}
+
+// RemoveTenantMember ends a practitioner's access to the tenant. Their notes, appointments and
+// availability stay with the practice; their staff role assignments are dropped.
+func RemoveTenantMember(tenantID, therapistID uuid.UUID) error {
+	current, ok, err := TenantMemberRole(tenantID, therapistID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMemberNotFound
+	}
+	if current == MemberRoleOwner {
+		return ErrOwnerMembership
+	}
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		UPDATE tenant_members SET is_active = FALSE, role = $3, updated_at = NOW()
+		WHERE tenant_id = $1 AND therapist_id = $2
+	`, tenantID, therapistID, MemberRoleMember); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tenant_staff_roles WHERE tenant_id = $1 AND staff_id = $2`, tenantID, therapistID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE availability_slots SET is_active = FALSE WHERE tenant_id = $1 AND therapist_id = $2
+	`, tenantID, therapistID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM availability_overrides WHERE tenant_id = $1 AND therapist_id = $2 AND date >= CURRENT_DATE
+	`, tenantID, therapistID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateTenantInvitation invites a therapist, by account email, to join the tenant with role.
+// If a therapist account already uses the email, its ID is returned so they can be notified.
+func CreateTenantInvitation(tenantID, invitedBy uuid.UUID, email, role string) (*TenantInvitation, uuid.UUID, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if _, err := mail.ParseAddress(email); err != nil || email == "" {
+		return nil, uuid.Nil, ErrInvalidInviteeEmail
+	}
+	if role == "" {
+		role = MemberRoleMember
+	}
+	if role != MemberRoleAdmin && role != MemberRoleMember {
+		return nil, uuid.Nil, ErrInvalidMemberRole
+	}
+
+	var inviteeID uuid.UUID
+	err := database.PostgresDB.QueryRow(`SELECT id FROM therapists WHERE LOWER(email) = $1`, email).Scan(&inviteeID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, uuid.Nil, err
+	}
+	if inviteeID != uuid.Nil && TherapistInTenant(tenantID, inviteeID) {
+		return nil, uuid.Nil, ErrAlreadyMember
+	}
+
+	// Lapsed invitations no longer block a fresh one
+	if _, err := database.PostgresDB.Exec(`
+		UPDATE tenant_invitations SET revoked_at = NOW()
+		WHERE tenant_id = $1 AND LOWER(email) = $2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= NOW()
+	`, tenantID, email); err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	inv := &TenantInvitation{TenantID: tenantID, Email: email, Role: role, InvitedBy: invitedBy}
+	err = database.PostgresDB.QueryRow(`
+		INSERT INTO tenant_invitations (tenant_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id, expires_at, created_at
+	`, tenantID, email, role, invitedBy, time.Now().Add(TenantInvitationTTL)).Scan(&inv.ID, &inv.ExpiresAt, &inv.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, uuid.Nil, ErrInvitationPending
+	}
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return inv, inviteeID, nil
+}
+
+// ListTenantInvitations returns the tenant's invitations that have not been answered or revoked.
+func ListTenantInvitations(tenantID uuid.UUID) ([]TenantInvitation, error) {
+	return queryInvitations(`
+		SELECT i.id, i.tenant_id, tn.display_name, i.email, i.role, i.invited_by, i.expires_at, i.accepted_at, i.created_at
+		FROM tenant_invitations i
+		JOIN tenants tn ON tn.id = i.tenant_id
+		WHERE i.tenant_id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL
+		ORDER BY i.created_at DESC
+	`, tenantID)
+}
+
+// ListInvitationsForTherapist returns the open invitations addressed to the therapist's email.
+func ListInvitationsForTherapist(therapistID uuid.UUID) ([]TenantInvitation, error) {
+	return queryInvitations(`
+		SELECT i.id, i.tenant_id, tn.display_name, i.email, i.role, i.invited_by, i.expires_at, i.accepted_at, i.created_at
+		FROM tenant_invitations i
+		JOIN tenants tn ON tn.id = i.tenant_id AND tn.is_active = TRUE
+		JOIN therapists t ON LOWER(t.email) = LOWER(i.email)
+		WHERE t.id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC
+	`, therapistID)
+}
+
+func queryInvitations(query string, arg uuid.UUID) ([]TenantInvitation, error) {
+	rows, err := database.PostgresDB.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invitations := make([]TenantInvitation, 0)
+	for rows.Next() {
+		var inv TenantInvitation
+		var acceptedAt sql.NullTime
+		if err := rows.Scan(&inv.ID, &inv.TenantID, &inv.TenantName, &inv.Email, &inv.Role, &inv.InvitedBy,
+			&inv.ExpiresAt, &acceptedAt, &inv.CreatedAt); err != nil {
+			return nil, err
+		}
+		if acceptedAt.Valid {
+			inv.AcceptedAt = &acceptedAt.Time
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeTenantInvitation withdraws an open invitation.
+func RevokeTenantInvitation(tenantID, invitationID uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE tenant_invitations SET revoked_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, invitationID, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptTenantInvitation adds the therapist to the inviting tenant. The invitation must be
+// addressed to the therapist's account email. A previously removed member is reinstated.
+func AcceptTenantInvitation(therapistID, invitationID uuid.UUID) (*TherapistTenant, error) {
+	tx, err := database.PostgresDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var tenantID, invitedBy uuid.UUID
+	var role string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT i.tenant_id, i.role, i.invited_by, i.expires_at
+		FROM tenant_invitations i
+		JOIN therapists t ON LOWER(t.email) = LOWER(i.email)
+		WHERE i.id = $1 AND t.id = $2 AND i.accepted_at IS NULL AND i.revoked_at IS NULL
+		FOR UPDATE OF i
+	`, invitationID, therapistID).Scan(&tenantID, &role, &invitedBy, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrInvitationExpired
+	}
+
+	var member TherapistTenant
+	err = tx.QueryRow(`
+		INSERT INTO tenant_members (tenant_id, therapist_id, role, invited_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, therapist_id) DO UPDATE
+			SET is_active = TRUE, invited_by = EXCLUDED.invited_by, joined_at = NOW(), updated_at = NOW(),
+				role = CASE WHEN tenant_members.role = 'owner' THEN tenant_members.role ELSE EXCLUDED.role END
+		RETURNING tenant_id, role, joined_at
+	`, tenantID, therapistID, role, invitedBy).Scan(&member.TenantID, &member.Role, &member.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE tenant_invitations SET accepted_at = NOW(), accepted_by = $2 WHERE id = $1
+	`, invitationID, therapistID); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(`SELECT display_name FROM tenants WHERE id = $1`, tenantID).Scan(&member.DisplayName); err != nil {
+		return nil, err
+	}
+	return &member, tx.Commit()
+}
+
+// DeclineTenantInvitation closes an invitation addressed to the therapist without joining.
+func DeclineTenantInvitation(therapistID, invitationID uuid.UUID) error {
+	res, err := database.PostgresDB.Exec(`
+		UPDATE tenant_invitations i SET revoked_at = NOW()
+		FROM therapists t
+		WHERE i.id = $1 AND t.id = $2 AND LOWER(t.email) = LOWER(i.email)
+			AND i.accepted_at IS NULL AND i.revoked_at IS NULL
+	`, invitationID, therapistID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
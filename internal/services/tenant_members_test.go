@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemberPermissionsForAdmins(t *testing.T) {
+	for _, role := range []string{MemberRoleOwner, MemberRoleAdmin} {
+		if !IsTenantAdminRole(role) {
+			t.Fatalf("%s should manage the tenant", role)
+		}
+		perms, err := MemberPermissions(uuid.New(), uuid.New(), role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !perms.Has(PermStaffManage, PermBillingManage, PermNotesWrite) {
+			t.Fatalf("%s should hold every permission", role)
+		}
+	}
+	if IsTenantAdminRole(MemberRoleMember) || IsTenantAdminRole("") {
+		t.Fatal("members and receptionists must not manage the tenant")
+	}
+}
+
+func TestCreateTenantInvitationValidation(t *testing.T) {
+	if _, _, err := CreateTenantInvitation(uuid.New(), uuid.New(), "not-an-email", MemberRoleMember); !errors.Is(err, ErrInvalidInviteeEmail) {
+		t.Fatalf("invalid email accepted: %v", err)
+	}
+	if _, _, err := CreateTenantInvitation(uuid.New(), uuid.New(), "colleague@example.com", MemberRoleOwner); !errors.Is(err, ErrInvalidMemberRole) {
+		t.Fatalf("owner invitation accepted: %v", err)
+	}
+	if err := SetTenantMemberRole(uuid.New(), uuid.New(), MemberRoleOwner); !errors.Is(err, ErrInvalidMemberRole) {
+		t.Fatalf("promotion to owner accepted: %v", err)
+	}
+}
+
+func TestSessionNoteVisibility(t *testing.T) {
+	staff := SessionNoteVisibility("")
+	if len(staff) != 1 || staff["shared"] != true {
+		t.Fatalf("staff should see shared notes only, got %v", staff)
+	}
+	author := SessionNoteVisibility("therapist-1")
+	or, ok := author["$or"].(bson.A)
+	if !ok || len(or) != 2 {
+		t.Fatalf("practitioner filter: %v", author)
+	}
+	if own, _ := or[0].(bson.M); own["therapist_id"] != "therapist-1" {
+		t.Fatalf("practitioner should see their own notes, got %v", or[0])
+	}
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/AnshRaj112/serenify-backend/internal/config"
+)
+
+// WebAuthn relying party settings, set by InitMFA.
+var (
+	webauthnRPID    = "localhost"
+	webauthnRPName  = "Serenify"
+	webauthnOrigins = []string{"http://localhost:3000"}
+)
+
+// COSE algorithms offered to authenticators, in order of preference.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	authFlagUserPresent  = 0x01
+	authFlagUserVerified = 0x04
+	authFlagAttested     = 0x40
+)
+
+var errWebAuthnInvalid = errors.New("webauthn: invalid credential")
+
+// InitMFA configures the WebAuthn relying party. The RP ID defaults to the frontend host and the
+// accepted origins to the CORS origins.
+func InitMFA(cfg *config.Config) {
+	if cfg.WebAuthnRPName != "" {
+		webauthnRPName = cfg.WebAuthnRPName
+	}
+	webauthnRPID = cfg.WebAuthnRPID
+	if webauthnRPID == "" {
+		if u, err := url.Parse(cfg.FrontendURL); err == nil && u.Hostname() != "" {
+			webauthnRPID = u.Hostname()
+		}
+	}
+	webauthnOrigins = cfg.WebAuthnOrigins
+	if len(webauthnOrigins) == 0 {
+		webauthnOrigins = cfg.AllowedOrigins
+	}
+}
+
+// WebAuthnCredential is a PublicKeyCredential as serialized by the browser, with binary fields
+// base64url-encoded. Registrations carry attestationObject; assertions carry authenticatorData
+// and signature.
+type WebAuthnCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject,omitempty"`
+		AuthenticatorData string `json:"authenticatorData,omitempty"`
+		Signature         string `json:"signature,omitempty"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// webauthnCreationOptions are the PublicKeyCredentialCreationOptions for navigator.credentials.create.
+func webauthnCreationOptions(challenge, userID []byte, account string, exclude []string) map[string]interface{} {
+	excluded := make([]map[string]interface{}, 0, len(exclude))
+	for _, id := range exclude {
+		excluded = append(excluded, map[string]interface{}{"type": "public-key", "id": id})
+	}
+	return map[string]interface{}{
+		"challenge": b64url(challenge),
+		"rp":        map[string]interface{}{"id": webauthnRPID, "name": webauthnRPName},
+		"user": map[string]interface{}{
+			"id":          b64url(userID),
+			"name":        account,
+			"displayName": account,
+		},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": coseAlgES256},
+			{"type": "public-key", "alg": coseAlgEdDSA},
+			{"type": "public-key", "alg": coseAlgRS256},
+		},
+		"timeout":     int(mfaChallengeTTL.Milliseconds()),
+		"attestation": "none",
+		"authenticatorSelection": map[string]interface{}{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+		"excludeCredentials": excluded,
+	}
+}
+
+// webauthnRequestOptions are the PublicKeyCredentialRequestOptions for navigator.credentials.get.
+func webauthnRequestOptions(challenge []byte, allow []string) map[string]interface{} {
+	allowed := make([]map[string]interface{}, 0, len(allow))
+	for _, id := range allow {
+		allowed = append(allowed, map[string]interface{}{"type": "public-key", "id": id})
+	}
+	return map[string]interface{}{
+		"challenge":        b64url(challenge),
+		"rpId":             webauthnRPID,
+		"timeout":          int(mfaChallengeTTL.Milliseconds()),
+		"userVerification": "preferred",
+		"allowCredentials": allowed,
+	}
+}
+
+// webauthnRegistration is what a verified registration yields.
+type webauthnRegistration struct {
+	CredentialID string // base64url
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+}
+
+// verifyWebAuthnRegistration checks a registration against the challenge that was issued for it.
+// Attestation statements are not verified (options ask for "none"); the credential is trusted
+// on first use like a TOTP secret.
+func verifyWebAuthnRegistration(cred WebAuthnCredential, challenge []byte) (webauthnRegistration, error) {
+	if err := verifyClientData(cred.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return webauthnRegistration{}, err
+	}
+	raw, err := b64urlDecode(cred.Response.AttestationObject)
+	if err != nil {
+		return webauthnRegistration{}, fmt.Errorf("%w: attestationObject", errWebAuthnInvalid)
+	}
+	obj, _, err := cborDecode(raw)
+	if err != nil {
+		return webauthnRegistration{}, fmt.Errorf("%w: attestationObject: %v", errWebAuthnInvalid, err)
+	}
+	m, _ := obj.(map[interface{}]interface{})
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return webauthnRegistration{}, fmt.Errorf("%w: missing authData", errWebAuthnInvalid)
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return webauthnRegistration{}, err
+	}
+	if ad.Flags&authFlagAttested == 0 || len(ad.CredentialID) == 0 {
+		return webauthnRegistration{}, fmt.Errorf("%w: no attested credential", errWebAuthnInvalid)
+	}
+	if _, _, err := parseCOSEKey(ad.PublicKey); err != nil {
+		return webauthnRegistration{}, err
+	}
+	return webauthnRegistration{
+		CredentialID: b64url(ad.CredentialID),
+		PublicKey:    ad.PublicKey,
+		SignCount:    ad.SignCount,
+	}, nil
+}
+
+// verifyWebAuthnAssertion checks an assertion signed by a registered credential and returns the
+// authenticator's new signature counter.
+func verifyWebAuthnAssertion(cred WebAuthnCredential, challenge, publicKey []byte, storedCount uint32) (uint32, error) {
+	if err := verifyClientData(cred.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := b64urlDecode(cred.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: authenticatorData", errWebAuthnInvalid)
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	clientData, _ := b64urlDecode(cred.Response.ClientDataJSON)
+	sig, err := b64urlDecode(cred.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: signature", errWebAuthnInvalid)
+	}
+	clientHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientHash[:]...)
+	alg, pub, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	if !verifyCOSESignature(alg, pub, signed, sig) {
+		return 0, fmt.Errorf("%w: bad signature", errWebAuthnInvalid)
+	}
+	// A counter that does not move forward means a cloned authenticator. Authenticators
+	// without counters always report zero.
+	if (ad.SignCount != 0 || storedCount != 0) && ad.SignCount <= storedCount {
+		return 0, fmt.Errorf("%w: signature counter went backwards", errWebAuthnInvalid)
+	}
+	return ad.SignCount, nil
+}
+
+func verifyClientData(clientDataB64, wantType string, challenge []byte) error {
+	raw, err := b64urlDecode(clientDataB64)
+	if err != nil {
+		return fmt.Errorf("%w: clientDataJSON", errWebAuthnInvalid)
+	}
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: clientDataJSON", errWebAuthnInvalid)
+	}
+	if cd.Type != wantType {
+		return fmt.Errorf("%w: type %q", errWebAuthnInvalid, cd.Type)
+	}
+	got, err := b64urlDecode(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", errWebAuthnInvalid)
+	}
+	for _, o := range webauthnOrigins {
+		if strings.TrimRight(o, "/") == cd.Origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q not allowed", errWebAuthnInvalid, cd.Origin)
+}
+
+type authenticatorData struct {
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// parseAuthenticatorData reads rpIdHash | flags | signCount [| aaguid | credIdLen | credId | COSE key].
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(b) < 37 {
+		return ad, fmt.Errorf("%w: authenticator data too short", errWebAuthnInvalid)
+	}
+	rpHash := sha256.Sum256([]byte(webauthnRPID))
+	if !bytes.Equal(b[:32], rpHash[:]) {
+		return ad, fmt.Errorf("%w: RP ID mismatch", errWebAuthnInvalid)
+	}
+	ad.Flags = b[32]
+	if ad.Flags&authFlagUserPresent == 0 {
+		return ad, fmt.Errorf("%w: user not present", errWebAuthnInvalid)
+	}
+	ad.SignCount = binary.BigEndian.Uint32(b[33:37])
+	if ad.Flags&authFlagAttested == 0 {
+		return ad, nil
+	}
+	rest := b[37:]
+	if len(rest) < 18 {
+		return ad, fmt.Errorf("%w: attested data too short", errWebAuthnInvalid)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || len(rest) < idLen {
+		return ad, fmt.Errorf("%w: bad credential ID", errWebAuthnInvalid)
+	}
+	ad.CredentialID = rest[:idLen]
+	rest = rest[idLen:]
+	_, n, err := cborDecode(rest)
+	if err != nil {
+		return ad, fmt.Errorf("%w: credential public key: %v", errWebAuthnInvalid, err)
+	}
+	ad.PublicKey = rest[:n]
+	return ad, nil
+}
+
+// parseCOSEKey reads an ES256 (P-256), EdDSA (Ed25519) or RS256 public key.
+func parseCOSEKey(b []byte) (int64, crypto.PublicKey, error) {
+	v, _, err := cborDecode(b)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: COSE key: %v", errWebAuthnInvalid, err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: COSE key is not a map", errWebAuthnInvalid)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case alg == coseAlgES256 && kty == 2:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("%w: unsupported EC key", errWebAuthnInvalid)
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: %v", errWebAuthnInvalid, err)
+		}
+		return alg, pub, nil
+	case alg == coseAlgEdDSA && kty == 1:
+		x, _ := m[int64(-2)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("%w: unsupported OKP key", errWebAuthnInvalid)
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case alg == coseAlgRS256 && kty == 3:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, fmt.Errorf("%w: unsupported RSA key", errWebAuthnInvalid)
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return 0, nil, fmt.Errorf("%w: unsupported algorithm %d", errWebAuthnInvalid, alg)
+}
+
+func verifyCOSESignature(alg int64, pub crypto.PublicKey, signed, sig []byte) bool {
+	switch alg {
+	case coseAlgES256:
+		h := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), h[:], sig)
+	case coseAlgEdDSA:
+		return ed25519.Verify(pub.(ed25519.PublicKey), signed, sig)
+	case coseAlgRS256:
+		h := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, h[:], sig) == nil
+	}
+	return false
+}
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// b64urlDecode accepts base64url with or without padding.
+func b64urlDecode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// cborDecode decodes the CBOR subset WebAuthn uses (RFC 8949 definite-length items) and returns
+// the value and the number of bytes read. Integers decode to int64, byte strings to []byte, text
+// to string, arrays to []interface{} and maps to map[interface{}]interface{}.
+func cborDecode(b []byte) (interface{}, int, error) {
+	return cborItem(b, 0)
+}
+
+func cborItem(b []byte, depth int) (interface{}, int, error) {
+	if depth > 16 {
+		return nil, 0, errors.New("cbor: nested too deeply")
+	}
+	if len(b) == 0 {
+		return nil, 0, errors.New("cbor: unexpected end of data")
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	arg, n, err := cborArg(b, info)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errors.New("cbor: string runs past end of data")
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte(nil), b[n:end]...), end, nil
+		}
+		return string(b[n:end]), end, nil
+	case 4:
+		if arg > uint64(len(b)) {
+			return nil, 0, errors.New("cbor: array too long")
+		}
+		arr := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, m, err := cborItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			n += m
+		}
+		return arr, n, nil
+	case 5:
+		if arg > uint64(len(b)) {
+			return nil, 0, errors.New("cbor: map too long")
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, kn, err := cborItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += kn
+			v, vn, err := cborItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += vn
+			switch k.(type) {
+			case int64, string:
+				m[k] = v
+			default:
+				return nil, 0, errors.New("cbor: unsupported map key")
+			}
+		}
+		return m, n, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22, 23:
+			return nil, n, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("cbor: unsupported item 0x%02x", b[0])
+}
+
+// cborArg reads the argument that follows an initial byte and returns it with the header length.
+func cborArg(b []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < 1+size {
+			return 0, 0, errors.New("cbor: unexpected end of data")
+		}
+		var v uint64
+		for _, c := range b[1 : 1+size] {
+			v = v<<8 | uint64(c)
+		}
+		return v, 1 + size, nil
+	}
+	return 0, 0, errors.New("cbor: indefinite lengths are not supported")
+}
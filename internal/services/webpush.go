@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PushSubscription is the browser PushSubscription JSON stored in notification_settings.
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// WebPushChannel sends RFC 8291 (aes128gcm) encrypted pushes authenticated with VAPID (RFC 8292).
+type WebPushChannel struct {
+	publicKey  string // base64url uncompressed P-256 point, as handed to the browser
+	privateKey *ecdsa.PrivateKey
+	subject    string
+	// Client defaults to webhookHTTPClient: the endpoint comes from the subscriber
+	Client *http.Client
+}
+
+// NewWebPushChannel parses base64url VAPID keys (65-byte public point, 32-byte private scalar).
+func NewWebPushChannel(publicKey, privateKey, subject string) (*WebPushChannel, error) {
+	raw, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	priv, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	pub, err := priv.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if base64.RawURLEncoding.EncodeToString(pub) != strings.TrimRight(publicKey, "=") {
+		return nil, errors.New("VAPID public key does not match private key")
+	}
+	return &WebPushChannel{publicKey: base64.RawURLEncoding.EncodeToString(pub), privateKey: priv, subject: subject}, nil
+}
+
+func (c *WebPushChannel) Name() string             { return ChannelWebPush }
+func (c *WebPushChannel) Accepts(r Recipient) bool { return len(r.PushSubscription) > 0 }
+
+func (c *WebPushChannel) Send(ctx context.Context, r Recipient, m RenderedNotification) error {
+	var sub PushSubscription
+	if err := json.Unmarshal(r.PushSubscription, &sub); err != nil || sub.Endpoint == "" {
+		return errors.New("invalid push subscription")
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"title": m.Subject,
+		"body":  m.Body,
+		"type":  m.Type,
+		"data":  m.Data,
+	})
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := c.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Authorization", auth)
+	client := c.Client
+	if client == nil {
+		client = webhookHTTPClient
+	}
+	return sendNotificationRequest(client, req)
+}
+
+func (c *WebPushChannel) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": c.subject,
+	})
+	signed, err := token.SignedString(c.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + signed + ", k=" + c.publicKey, nil
+}
+
+// encryptWebPush encrypts payload for sub as a single aes128gcm record (RFC 8188 / RFC 8291).
+func encryptWebPush(sub PushSubscription, payload []byte) ([]byte, error) {
+	uaPublicRaw, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptWebPushWithKeys(uaPublic, authSecret, asPrivate, salt, payload)
+}
+
+func encryptWebPushWithKeys(uaPublic *ecdh.PublicKey, authSecret []byte, asPrivate *ecdh.PrivateKey, salt, payload []byte) ([]byte, error) {
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record.
+	ciphertext := gcm.Seal(nil, nonce, append(append([]byte{}, payload...), 0x02), nil)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, 4096)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return append(header, ciphertext...), nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
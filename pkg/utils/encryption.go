@@ -6,99 +6,281 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 )
 
-// GetEncryptionKey retrieves encryption key from environment
-// Expects base64-encoded 32-byte key
-func GetEncryptionKey() ([]byte, error) {
-	keyBase64 := os.Getenv("ENCRYPTION_KEY")
-	if keyBase64 == "" {
-		return nil, errors.New("ENCRYPTION_KEY environment variable not set")
+// Ciphertexts are written as "v1:<key id>:<base64(nonce|sealed)>", with the key ID bound to the
+// ciphertext as GCM additional data. Values written before key IDs existed are bare base64 and
+// are decrypted by trying each key in the ring.
+const ciphertextV1 = "v1"
+
+// DefaultKeyID names the key given by ENCRYPTION_KEY.
+const DefaultKeyID = "default"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Keyring holds the data encryption keys: one active key that encrypts, and older keys kept to
+// decrypt values that have not been re-encrypted yet.
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+	order  []string // active first, then the rest as configured
+}
+
+// NewKeyring builds a keyring. Every key must be 32 bytes and active must be one of them.
+func NewKeyring(active string, ids []string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{active: active, keys: map[string][]byte{}, order: []string{active}}
+	for _, id := range ids {
+		key, ok := keys[id]
+		if !ok {
+			return nil, fmt.Errorf("key %q is not in the keyring", id)
+		}
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be exactly 32 bytes (256 bits)", id)
+		}
+		if _, dup := k.keys[id]; dup {
+			continue
+		}
+		k.keys[id] = key
+		if id != active {
+			k.order = append(k.order, id)
+		}
 	}
-	
-	// Decode base64 key
-	keyBytes, err := base64.StdEncoding.DecodeString(keyBase64)
-	if err != nil {
-		return nil, errors.New("ENCRYPTION_KEY must be base64-encoded")
+	if _, ok := k.keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q is not listed", active)
+	}
+	return k, nil
+}
+
+// ParseKeyring reads a keyring from "id:base64key,id:base64key". The active key defaults to the
+// first one listed. A legacy single key, when given, joins the ring as DefaultKeyID unless the
+// same key is already listed.
+func ParseKeyring(spec, active, legacyKey string) (*Keyring, error) {
+	keys := map[string][]byte{}
+	var ids []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, b64, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("keyring entry %q must be id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+		if err != nil {
+			return nil, fmt.Errorf("key %q must be base64-encoded", id)
+		}
+		id = strings.TrimSpace(id)
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("key %q is listed twice", id)
+		}
+		keys[id] = key
+		ids = append(ids, id)
+	}
+	if legacyKey != "" {
+		key, err := base64.StdEncoding.DecodeString(legacyKey)
+		if err != nil {
+			return nil, errors.New("ENCRYPTION_KEY must be base64-encoded")
+		}
+		listed := false
+		for _, k := range keys {
+			if string(k) == string(key) {
+				listed = true
+			}
+		}
+		if _, taken := keys[DefaultKeyID]; !listed && !taken {
+			keys[DefaultKeyID] = key
+			ids = append(ids, DefaultKeyID)
+		}
 	}
-	
-	// Key must be 32 bytes for AES-256
-	if len(keyBytes) != 32 {
-		return nil, errors.New("ENCRYPTION_KEY must decode to exactly 32 bytes (256 bits)")
+	if len(ids) == 0 {
+		return nil, errors.New("ENCRYPTION_KEY environment variable not set")
 	}
-	
-	return keyBytes, nil
+	if active == "" {
+		active = ids[0]
+	}
+	return NewKeyring(active, ids, keys)
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM
-func Encrypt(plaintext string) (string, error) {
+// ActiveKeyID is the ID new ciphertexts are written with.
+func (k *Keyring) ActiveKeyID() string { return k.active }
+
+// KeyIDs lists the key IDs, active first.
+func (k *Keyring) KeyIDs() []string { return append([]string(nil), k.order...) }
+
+// Key returns the raw key with the given ID.
+func (k *Keyring) Key(id string) ([]byte, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// Encrypt encrypts plaintext with the active key using AES-256-GCM.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
-	
-	key, err := GetEncryptionKey()
-	if err != nil {
-		return "", err
-	}
-	
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-	
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(k.keys[k.active])
 	if err != nil {
 		return "", err
 	}
-	
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
-	
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(k.active))
+	return ciphertextV1 + ":" + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
 }
 
-// Decrypt decrypts ciphertext using AES-256-GCM
-func Decrypt(ciphertext string) (string, error) {
+// Decrypt decrypts a ciphertext written by any key in the ring, in either format.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
-	
-	key, err := GetEncryptionKey()
-	if err != nil {
-		return "", err
+	if id, payload, ok := splitCiphertext(ciphertext); ok {
+		key, known := k.keys[id]
+		if !known {
+			return "", fmt.Errorf("ciphertext key %q is not in the keyring", id)
+		}
+		return openGCM(key, payload, []byte(id))
 	}
-	
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
-	if err != nil {
-		return "", err
+	var lastErr error
+	for _, id := range k.order {
+		plaintext, err := openGCM(k.keys[id], ciphertext, nil)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// NeedsRotation reports whether a ciphertext was not written with the active key.
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	if ciphertext == "" {
+		return false
+	}
+	id, ok := CiphertextKeyID(ciphertext)
+	return !ok || id != k.active
+}
+
+// CiphertextKeyID returns the key ID a ciphertext carries; legacy ciphertexts carry none.
+func CiphertextKeyID(ciphertext string) (string, bool) {
+	id, _, ok := splitCiphertext(ciphertext)
+	return id, ok
+}
+
+func splitCiphertext(ciphertext string) (id, payload string, ok bool) {
+	version, rest, found := strings.Cut(ciphertext, ":")
+	if !found || version != ciphertextV1 {
+		return "", "", false
 	}
-	
+	id, payload, found = strings.Cut(rest, ":")
+	return id, payload, found
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func openGCM(key []byte, payloadB64 string, additional []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(payloadB64)
 	if err != nil {
 		return "", err
 	}
-	
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
-	
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
 		return "", errors.New("ciphertext too short")
 	}
-	
-	nonce, ciphertextBytes := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertextBytes, nil)
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, sealed, additional)
 	if err != nil {
 		return "", err
 	}
-	
 	return string(plaintext), nil
 }
 
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// LoadKeyringFromEnv reads ENCRYPTION_KEYS ("id:base64key,..."), ENCRYPTION_ACTIVE_KEY_ID and the
+// legacy single ENCRYPTION_KEY.
+func LoadKeyringFromEnv() (*Keyring, error) {
+	return ParseKeyring(os.Getenv("ENCRYPTION_KEYS"), strings.TrimSpace(os.Getenv("ENCRYPTION_ACTIVE_KEY_ID")),
+		strings.TrimSpace(os.Getenv("ENCRYPTION_KEY")))
+}
+
+// SetKeyring replaces the process keyring.
+func SetKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	keyring = k
+}
+
+// ActiveKeyring returns the process keyring, loading it from the environment on first use.
+func ActiveKeyring() (*Keyring, error) {
+	keyringMu.RLock()
+	k := keyring
+	keyringMu.RUnlock()
+	if k != nil {
+		return k, nil
+	}
+	k, err := LoadKeyringFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	SetKeyring(k)
+	return k, nil
+}
+
+// GetEncryptionKey returns the active 32-byte key.
+func GetEncryptionKey() ([]byte, error) {
+	k, err := ActiveKeyring()
+	if err != nil {
+		return nil, err
+	}
+	key, _ := k.Key(k.ActiveKeyID())
+	return key, nil
+}
+
+// Encrypt encrypts plaintext with the active key using AES-256-GCM
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	k, err := ActiveKeyring()
+	if err != nil {
+		return "", err
+	}
+	return k.Encrypt(plaintext)
+}
+
+// Decrypt decrypts ciphertext written with any key in the keyring
+func Decrypt(ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	k, err := ActiveKeyring()
+	if err != nil {
+		return "", err
+	}
+	return k.Decrypt(ciphertext)
+}